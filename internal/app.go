@@ -3,6 +3,7 @@ package internal
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/InVisionApp/go-health"
 	"github.com/InVisionApp/go-health/handlers"
 	"github.com/ProtocolONE/geoip-service/pkg"
@@ -13,6 +14,7 @@ import (
 	_ "github.com/golang-migrate/migrate/v4/database/mongodb"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/golang/protobuf/ptypes"
+	"github.com/google/uuid"
 	"github.com/micro/cli"
 	"github.com/micro/go-micro"
 	goConfig "github.com/micro/go-micro/config"
@@ -21,6 +23,7 @@ import (
 	"github.com/micro/go-plugins/client/selector/static"
 	"github.com/paysuper/paysuper-billing-server/internal/config"
 	"github.com/paysuper/paysuper-billing-server/internal/database"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
 	"github.com/paysuper/paysuper-billing-server/internal/service"
 	"github.com/paysuper/paysuper-billing-server/pkg"
 	paysuperI18n "github.com/paysuper/paysuper-i18n"
@@ -44,6 +47,14 @@ import (
 	"time"
 )
 
+const (
+	daemonLockKey = "billing_daemon_lock:%s"
+	// daemonLockTtl is the maximal processing time of daemon job, lock is released after the time
+	// even if instance which processed the job was stopped
+	daemonLockTtl      = 10 * time.Minute
+	daemonUnlockScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+)
+
 type Application struct {
 	cfg          *config.Config
 	database     mongodb.SourceInterface
@@ -142,6 +153,15 @@ func (app *Application) Init() {
 				Value: "",
 				Usage: "task context date, i.e. 2006-01-02T15:04:05Z07:00",
 			},
+			cli.StringFlag{
+				Name:  "merchant",
+				Value: "",
+				Usage: "task context merchant identifier",
+			},
+			cli.BoolFlag{
+				Name:  "apply",
+				Usage: "apply changes of task, otherwise changes are only shown",
+			},
 		),
 	}
 
@@ -230,6 +250,12 @@ func (app *Application) Init() {
 		app.logger.Fatal("Service init failed", zap.Error(err))
 	}
 
+	err = internalPkg.RegisterBillingInternalServiceHandler(app.service.Server(), app.svc)
+
+	if err != nil {
+		app.logger.Fatal("Internal service init failed", zap.Error(err))
+	}
+
 	app.router = http.NewServeMux()
 	app.initHealth()
 	app.initMetrics()
@@ -387,6 +413,95 @@ func (app *Application) TaskFixTaxes() error {
 	return app.svc.FixTaxes(context.TODO())
 }
 
+func (app *Application) TaskReleaseRollingReserves() error {
+	count, err := app.svc.ReleaseRollingReserves(context.TODO())
+
+	if err != nil {
+		return err
+	}
+
+	zap.L().Info("Rolling reserves released", zap.Int("count", count))
+
+	return nil
+}
+
+func (app *Application) TaskRebuildLedger() error {
+	count, err := app.svc.RebuildLedger(context.TODO())
+
+	if err != nil {
+		return err
+	}
+
+	zap.L().Info("Ledger rebuilt", zap.Int("journals", count))
+
+	return nil
+}
+
+func (app *Application) TaskReprocessAccounting(date, merchantId string, apply bool) error {
+	zap.S().Info("Start to reprocessing of accounting")
+	req := &internalPkg.ReprocessAccountingRequest{
+		MerchantId: merchantId,
+		Refunds:    true,
+		Apply:      apply,
+		Limit:      pkg.DatabaseRequestDefaultLimit,
+	}
+
+	if date != "" {
+		from, err := time.Parse("2006-01-02", date)
+
+		if err != nil {
+			return err
+		}
+
+		req.From = from.Unix()
+		req.To = from.AddDate(0, 0, 1).Unix() - 1
+	}
+
+	for {
+		rsp := &internalPkg.ReprocessAccountingResponse{}
+		err := app.svc.ReprocessAccounting(context.TODO(), req, rsp)
+
+		if err != nil {
+			return err
+		}
+
+		if rsp.Status != billingpb.ResponseStatusOk {
+			return rsp.Message
+		}
+
+		for _, item := range rsp.Items {
+			if len(item.Diffs) <= 0 && item.ErrorMessage == "" {
+				continue
+			}
+
+			zap.L().Info(
+				"Accounting entries of source differ",
+				zap.String("source_type", item.SourceType),
+				zap.String("source_id", item.SourceId),
+				zap.String("order_id", item.OrderId),
+				zap.Any("diffs", item.Diffs),
+				zap.Strings("correction_ids", item.CorrectionIds),
+				zap.String("error_code", item.ErrorCode),
+				zap.String("error_message", item.ErrorMessage),
+			)
+		}
+
+		zap.L().Info(
+			"Accounting reprocessing page finished",
+			zap.Int64("offset", req.Offset),
+			zap.Int64("count", rsp.Count),
+			zap.Int64("changed", rsp.Changed),
+			zap.Bool("apply", req.Apply),
+		)
+
+		if rsp.Count < req.Limit {
+			return nil
+		}
+
+		req.Offset += req.Limit
+	}
+}
+
 func (app *Application) KeyDaemonStart() {
 	zap.L().Info("Key daemon started", zap.Int64("RestartInterval", app.cfg.KeyDaemonRestartInterval))
 
@@ -414,3 +529,94 @@ func (app *Application) KeyDaemonStart() {
 		}
 	}()
 }
+
+// startDaemon starts the job of daemon with the interval until the service is stopped. Replicas of the service
+// compete for the daemon lock in Redis, so the job is processed only by one of them at the same time.
+func (app *Application) startDaemon(name string, interval time.Duration, job func(context.Context) (int, error)) {
+	zap.L().Info(name+" daemon started", zap.Duration("RestartInterval", interval))
+
+	go func() {
+		key := fmt.Sprintf(daemonLockKey, name)
+		owner := uuid.New().String()
+		shutdown := make(chan os.Signal, 1)
+		signal.Notify(shutdown, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
+
+		for {
+			zap.L().Debug(name + " daemon working")
+
+			select {
+			case <-shutdown:
+				zap.L().Info(name + " daemon stopping")
+				return
+			default:
+				app.runDaemonJob(name, key, owner, job)
+				time.Sleep(interval)
+			}
+		}
+	}()
+}
+
+func (app *Application) runDaemonJob(name, key, owner string, job func(context.Context) (int, error)) {
+	ok, err := app.redis.SetNX(key, owner, daemonLockTtl).Result()
+
+	if err != nil {
+		zap.L().Error(name+" daemon lock failed", zap.Error(err))
+		return
+	}
+
+	if !ok {
+		zap.L().Debug(name + " daemon job is processing by other instance")
+		return
+	}
+
+	defer func() {
+		err := app.redis.Eval(daemonUnlockScript, []string{key}, owner).Err()
+
+		if err != nil && err != redis.Nil {
+			zap.L().Error(name+" daemon unlock failed", zap.Error(err))
+		}
+	}()
+
+	count, err := job(context.TODO())
+
+	if err != nil {
+		zap.L().Error(name+" daemon process failed", zap.Error(err))
+	}
+
+	zap.L().Debug(name+" daemon job finished", zap.Int("count", count))
+}
+
+func (app *Application) AuthorizationDaemonStart() {
+	interval := time.Duration(app.cfg.AuthorizationDaemonInterval) * time.Second
+	app.startDaemon("Payment authorization", interval, app.svc.VoidExpiredAuthorizations)
+}
+
+func (app *Application) OrderExpirationDaemonStart() {
+	interval := time.Duration(app.cfg.OrderExpirationDaemonInterval) * time.Second
+	app.startDaemon("Order expiration", interval, app.svc.ExpireAbandonedOrders)
+}
+
+func (app *Application) SubscriptionDaemonStart() {
+	interval := time.Duration(app.cfg.SubscriptionDaemonInterval) * time.Second
+	app.startDaemon("Subscription", interval, app.svc.ChargeSubscriptions)
+}
+
+func (app *Application) SavedCardExpirationDaemonStart() {
+	interval := time.Duration(app.cfg.SavedCardExpirationDaemonInterval) * time.Second
+	app.startDaemon("Saved card expiration", interval, app.svc.NotifyExpiringSavedCards)
+}
+
+func (app *Application) DisputeDaemonStart() {
+	interval := time.Duration(app.cfg.DisputeDaemonInterval) * time.Second
+	app.startDaemon("Dispute", interval, app.svc.CloseOverdueDisputes)
+}
+
+func (app *Application) BulkRefundDaemonStart() {
+	interval := time.Duration(app.cfg.BulkRefundDaemonInterval) * time.Second
+	app.startDaemon("Bulk refund", interval, app.svc.ProcessBulkRefundJobs)
+}
+
+func (app *Application) AccountingExportDaemonStart() {
+	interval := time.Duration(app.cfg.AccountingExportDaemonInterval) * time.Second
+	app.startDaemon("Accounting export", interval, app.svc.ProcessAccountingExports)
+}
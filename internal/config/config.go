@@ -16,6 +16,18 @@ type PaymentSystemConfig struct {
 	CardPayApiSandboxUrl string `envconfig:"CARD_PAY_API_SANDBOX_URL" required:"true"`
 	RedirectUrlSuccess   string `envconfig:"REDIRECT_URL_SUCCESS" default:"https://checkout.pay.super.com/pay/order/?result=success"`
 	RedirectUrlFail      string `envconfig:"REDIRECT_URL_FAIL" default:"https://checkout.pay.super.com/pay/order/?result=fail"`
+
+	// Settings of payment systems health tracking. Window and open timeout are in seconds.
+	HealthWindow      int64   `envconfig:"PAYMENT_SYSTEM_HEALTH_WINDOW" default:"300"`
+	HealthMinRequests int64   `envconfig:"PAYMENT_SYSTEM_HEALTH_MIN_REQUESTS" default:"20"`
+	HealthErrorRate   float64 `envconfig:"PAYMENT_SYSTEM_HEALTH_ERROR_RATE" default:"0.5"`
+	HealthDeclineRate float64 `envconfig:"PAYMENT_SYSTEM_HEALTH_DECLINE_RATE" default:"0.9"`
+	HealthOpenTimeout int64   `envconfig:"PAYMENT_SYSTEM_HEALTH_OPEN_TIMEOUT" default:"60"`
+
+	// Settings of two-step payments. Authorizations which weren't captured during the ttl are voided by daemon.
+	// Ttl and daemon interval are in seconds.
+	AuthorizationTtl            int64 `envconfig:"PAYMENT_AUTHORIZATION_TTL" default:"3600"`
+	AuthorizationDaemonInterval int64 `envconfig:"PAYMENT_AUTHORIZATION_DAEMON_INTERVAL" default:"60"`
 }
 
 type CustomerTokenConfig struct {
@@ -52,6 +64,8 @@ type EmailTemplates struct {
 	OnboardingVerificationAdmin    string `envconfig:"EMAIL_ADMIN_NEW_ONBOARDING_REQUEST_TEMPLATE" default:"p1_email_admin_new_onboarding_request_template"`
 	OnboardingCompleted            string `envconfig:"EMAIL_MERCHANT_ONBOARDING_REQUEST_COMPLETE_TEMPLATE" default:"p1_email_merchant_onboarding_request_complete_template"`
 	UserInvite                     string `envconfig:"EMAIL_INVITE_TEMPLATE" default:"code-your-own"`
+	SubscriptionPaymentFailed      string `envconfig:"EMAIL_SUBSCRIPTION_PAYMENT_FAILED_TEMPLATE" default:"p1_subscription_payment_failed"`
+	SavedCardExpiring              string `envconfig:"EMAIL_SAVED_CARD_EXPIRING_TEMPLATE" default:"p1_saved_card_expiring"`
 }
 
 type Centrifugo struct {
@@ -96,6 +110,60 @@ type Config struct {
 
 	KeyDaemonRestartInterval int64 `envconfig:"KEY_DAEMON_RESTART_INTERVAL" default:"60"`
 
+	// Orders which weren't paid during the lifetime are canceled as expired by daemon, lifetime can be overridden
+	// for project. Lifetime and daemon interval are in seconds.
+	OrderLifetime                 int64 `envconfig:"ORDER_LIFETIME" default:"86400"`
+	OrderExpirationDaemonInterval int64 `envconfig:"ORDER_EXPIRATION_DAEMON_INTERVAL" default:"300"`
+
+	SubscriptionDaemonInterval int64 `envconfig:"SUBSCRIPTION_DAEMON_INTERVAL" default:"600"`
+
+	// Default dunning policy of projects which didn't override it. Retry intervals are in seconds, negative retry hour
+	// disables moving of retries after decline for insufficient funds.
+	DunningRetryIntervals                []int64  `envconfig:"DUNNING_RETRY_INTERVALS" default:"86400,259200,432000"`
+	DunningMaxAttempts                   int32    `envconfig:"DUNNING_MAX_ATTEMPTS" default:"3"`
+	DunningRetryHour                     int32    `envconfig:"DUNNING_RETRY_HOUR" default:"9"`
+	DunningHardDeclineCodes              []string `envconfig:"DUNNING_HARD_DECLINE_CODES" default:"04,07,14,15,41,43,54,57,62"`
+	DunningInsufficientFundsDeclineCodes []string `envconfig:"DUNNING_INSUFFICIENT_FUNDS_DECLINE_CODES" default:"51,61,65"`
+
+	// Owners of saved cards expiring next month are notified by daemon once per card, interval is in seconds.
+	SavedCardExpirationDaemonInterval int64 `envconfig:"SAVED_CARD_EXPIRATION_DAEMON_INTERVAL" default:"86400"`
+
+	// Default fraud screening policy of projects which didn't override it. Velocity window is in seconds,
+	// average amount of project payments for the amount anomaly rule is calculated for the period in seconds.
+	FraudReviewScore            int32    `envconfig:"FRAUD_REVIEW_SCORE" default:"30"`
+	FraudBlockScore             int32    `envconfig:"FRAUD_BLOCK_SCORE" default:"70"`
+	FraudVelocityWindow         int64    `envconfig:"FRAUD_VELOCITY_WINDOW" default:"60"`
+	FraudVelocityLimit          int32    `envconfig:"FRAUD_VELOCITY_LIMIT" default:"10"`
+	FraudAmountAnomalyFactor    float64  `envconfig:"FRAUD_AMOUNT_ANOMALY_FACTOR" default:"5"`
+	FraudAmountAnomalyPeriod    int64    `envconfig:"FRAUD_AMOUNT_ANOMALY_PERIOD" default:"2592000"`
+	FraudDisposableEmailDomains []string `envconfig:"FRAUD_DISPOSABLE_EMAIL_DOMAINS" default:"mailinator.com,guerrillamail.com,10minutemail.com,temp-mail.org,yopmail.com,trashmail.com,throwawaymail.com"`
+
+	// Secret key of fingerprints of bank cards used by fraud screening and fraud lists.
+	FraudCardFingerprintKey string `envconfig:"FRAUD_CARD_FINGERPRINT_KEY"`
+
+	// Response deadlines of disputes by the status in seconds, used if payment system didn't set the deadline.
+	// Disputes without response after the deadline are closed as lost by daemon, interval is in seconds.
+	DisputeInquiryResponseTime        int64 `envconfig:"DISPUTE_INQUIRY_RESPONSE_TIME" default:"864000"`
+	DisputeChargebackResponseTime     int64 `envconfig:"DISPUTE_CHARGEBACK_RESPONSE_TIME" default:"1296000"`
+	DisputePreArbitrationResponseTime int64 `envconfig:"DISPUTE_PRE_ARBITRATION_RESPONSE_TIME" default:"864000"`
+	DisputeDaemonInterval             int64 `envconfig:"DISPUTE_DAEMON_INTERVAL" default:"3600"`
+
+	// Refunds of bulk refund jobs are created by daemon, no more than batch size of refunds per run with pause
+	// between refunds in milliseconds. Daemon interval is in seconds.
+	BulkRefundMaxRows         int   `envconfig:"BULK_REFUND_MAX_ROWS" default:"5000"`
+	BulkRefundBatchSize       int   `envconfig:"BULK_REFUND_BATCH_SIZE" default:"100"`
+	BulkRefundThrottle        int64 `envconfig:"BULK_REFUND_THROTTLE" default:"200"`
+	BulkRefundDaemonInterval  int64 `envconfig:"BULK_REFUND_DAEMON_INTERVAL" default:"60"`
+	BulkRefundRowClaimTimeout int64 `envconfig:"BULK_REFUND_ROW_CLAIM_TIMEOUT" default:"600"`
+
+	// Default policy of duplicate payments for merchants which didn't set it, window is in seconds.
+	DuplicatePaymentAction string `envconfig:"DUPLICATE_PAYMENT_ACTION" default:"review"`
+	DuplicatePaymentWindow int64  `envconfig:"DUPLICATE_PAYMENT_WINDOW" default:"3600"`
+
+	// Files of accounting exports are built by daemon, interval and claim timeout are in seconds.
+	AccountingExportDaemonInterval int64 `envconfig:"ACCOUNTING_EXPORT_DAEMON_INTERVAL" default:"60"`
+	AccountingExportClaimTimeout   int64 `envconfig:"ACCOUNTING_EXPORT_CLAIM_TIMEOUT" default:"3600"`
+
 	PaylinkMinProducts int `envconfig:"PAYLINK_MIN_PRODUCTS" required:"false" default:"1"`
 	PaylinkMaxProducts int `envconfig:"PAYLINK_MAX_PRODUCTS" required:"false" default:"8"`
 
@@ -183,6 +251,14 @@ func (cfg *Config) GetCustomerTokenExpire() time.Duration {
 	return time.Second * time.Duration(cfg.CustomerTokenConfig.LifeTime)
 }
 
+func (cfg *Config) GetPaymentAuthorizationTtl() time.Duration {
+	return time.Second * time.Duration(cfg.PaymentSystemConfig.AuthorizationTtl)
+}
+
+func (cfg *Config) GetOrderLifetime() time.Duration {
+	return time.Second * time.Duration(cfg.OrderLifetime)
+}
+
 func (cfg *Config) GetEmailConfirmTokenLifetime() time.Duration {
 	return time.Second * time.Duration(cfg.EmailConfirmTokenLifetime)
 }
@@ -260,3 +336,7 @@ func (cfg *Config) GetAdminOnboardingRequestsUrl() string {
 func (cfg *Config) GetUserInviteUrl(token string) string {
 	return fmt.Sprintf(pkg.UserInviteUrl, cfg.DashboardUrl, token)
 }
+
+func (cfg *Config) GetSubscriptionCardUrl(subscriptionId string) string {
+	return fmt.Sprintf(pkg.SubscriptionCardUrl, cfg.CheckoutUrl, subscriptionId)
+}
@@ -55,6 +55,29 @@ func (_m *KeyRepositoryInterface) CountKeysByProductPlatform(_a0 context.Context
 	return r0, r1
 }
 
+// FindByOrderId provides a mock function with given fields: _a0, _a1
+func (_m *KeyRepositoryInterface) FindByOrderId(_a0 context.Context, _a1 string) ([]*billingpb.Key, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 []*billingpb.Key
+	if rf, ok := ret.Get(0).(func(context.Context, string) []*billingpb.Key); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*billingpb.Key)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // FindUnfinished provides a mock function with given fields: _a0
 func (_m *KeyRepositoryInterface) FindUnfinished(_a0 context.Context) ([]*billingpb.Key, error) {
 	ret := _m.Called(_a0)
@@ -160,3 +183,26 @@ func (_m *KeyRepositoryInterface) ReserveKey(_a0 context.Context, _a1 string, _a
 
 	return r0, r1
 }
+
+// RevokeById provides a mock function with given fields: _a0, _a1, _a2
+func (_m *KeyRepositoryInterface) RevokeById(_a0 context.Context, _a1 string, _a2 string) (*billingpb.Key, error) {
+	ret := _m.Called(_a0, _a1, _a2)
+
+	var r0 *billingpb.Key
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) *billingpb.Key); ok {
+		r0 = rf(_a0, _a1, _a2)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*billingpb.Key)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(_a0, _a1, _a2)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
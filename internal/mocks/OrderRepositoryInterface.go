@@ -5,12 +5,106 @@ package mocks
 import billingpb "github.com/paysuper/paysuper-proto/go/billingpb"
 import context "context"
 import mock "github.com/stretchr/testify/mock"
+import pkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+import time "time"
 
 // OrderRepositoryInterface is an autogenerated mock type for the OrderRepositoryInterface type
 type OrderRepositoryInterface struct {
 	mock.Mock
 }
 
+// FindByPrivateStatus provides a mock function with given fields: _a0, _a1, _a2
+func (_m *OrderRepositoryInterface) FindByPrivateStatus(_a0 context.Context, _a1 int32, _a2 time.Time) ([]*billingpb.Order, error) {
+	ret := _m.Called(_a0, _a1, _a2)
+
+	var r0 []*billingpb.Order
+	if rf, ok := ret.Get(0).(func(context.Context, int32, time.Time) []*billingpb.Order); ok {
+		r0 = rf(_a0, _a1, _a2)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*billingpb.Order)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int32, time.Time) error); ok {
+		r1 = rf(_a0, _a1, _a2)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindNotPaid provides a mock function with given fields: _a0, _a1
+func (_m *OrderRepositoryInterface) FindNotPaid(_a0 context.Context, _a1 *pkg.NotPaidOrderFilter) ([]*billingpb.Order, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 []*billingpb.Order
+	if rf, ok := ret.Get(0).(func(context.Context, *pkg.NotPaidOrderFilter) []*billingpb.Order); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*billingpb.Order)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *pkg.NotPaidOrderFilter) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindPaid provides a mock function with given fields: _a0, _a1
+func (_m *OrderRepositoryInterface) FindPaid(_a0 context.Context, _a1 *pkg.PaidOrderFilter) ([]*billingpb.Order, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 []*billingpb.Order
+	if rf, ok := ret.Get(0).(func(context.Context, *pkg.PaidOrderFilter) []*billingpb.Order); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*billingpb.Order)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *pkg.PaidOrderFilter) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindProcessedByProjectOrderId provides a mock function with given fields: _a0, _a1, _a2, _a3
+func (_m *OrderRepositoryInterface) FindProcessedByProjectOrderId(_a0 context.Context, _a1 string, _a2 string, _a3 time.Time) ([]*billingpb.Order, error) {
+	ret := _m.Called(_a0, _a1, _a2, _a3)
+
+	var r0 []*billingpb.Order
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, time.Time) []*billingpb.Order); ok {
+		r0 = rf(_a0, _a1, _a2, _a3)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*billingpb.Order)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, time.Time) error); ok {
+		r1 = rf(_a0, _a1, _a2, _a3)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetById provides a mock function with given fields: _a0, _a1
 func (_m *OrderRepositoryInterface) GetById(_a0 context.Context, _a1 string) (*billingpb.Order, error) {
 	ret := _m.Called(_a0, _a1)
@@ -130,3 +224,24 @@ func (_m *OrderRepositoryInterface) Update(_a0 context.Context, _a1 *billingpb.O
 
 	return r0
 }
+
+// UpdateWithPrivateStatus provides a mock function with given fields: _a0, _a1, _a2
+func (_m *OrderRepositoryInterface) UpdateWithPrivateStatus(_a0 context.Context, _a1 *billingpb.Order, _a2 int32) (bool, error) {
+	ret := _m.Called(_a0, _a1, _a2)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context, *billingpb.Order, int32) bool); ok {
+		r0 = rf(_a0, _a1, _a2)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *billingpb.Order, int32) error); ok {
+		r1 = rf(_a0, _a1, _a2)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
@@ -11,6 +11,41 @@ type PaymentSystem struct {
 	mock.Mock
 }
 
+// AuthorizePayment provides a mock function with given fields: order, successUrl, failUrl, requisites
+func (_m *PaymentSystem) AuthorizePayment(order *billingpb.Order, successUrl string, failUrl string, requisites map[string]string) (string, error) {
+	ret := _m.Called(order, successUrl, failUrl, requisites)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(*billingpb.Order, string, string, map[string]string) string); ok {
+		r0 = rf(order, successUrl, failUrl, requisites)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*billingpb.Order, string, string, map[string]string) error); ok {
+		r1 = rf(order, successUrl, failUrl, requisites)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CapturePayment provides a mock function with given fields: order, amount
+func (_m *PaymentSystem) CapturePayment(order *billingpb.Order, amount float64) error {
+	ret := _m.Called(order, amount)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*billingpb.Order, float64) error); ok {
+		r0 = rf(order, amount)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // CreatePayment provides a mock function with given fields: order, successUrl, failUrl, requisites
 func (_m *PaymentSystem) CreatePayment(order *billingpb.Order, successUrl string, failUrl string, requisites map[string]string) (string, error) {
 	ret := _m.Called(order, successUrl, failUrl, requisites)
@@ -46,6 +81,103 @@ func (_m *PaymentSystem) CreateRefund(order *billingpb.Order, refund *billingpb.
 	return r0
 }
 
+// DecodePaymentCallback provides a mock function with given fields: raw
+func (_m *PaymentSystem) DecodePaymentCallback(raw []byte) (proto.Message, error) {
+	ret := _m.Called(raw)
+
+	var r0 proto.Message
+	if rf, ok := ret.Get(0).(func([]byte) proto.Message); ok {
+		r0 = rf(raw)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(proto.Message)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func([]byte) error); ok {
+		r1 = rf(raw)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DecodeRefundCallback provides a mock function with given fields: raw
+func (_m *PaymentSystem) DecodeRefundCallback(raw []byte) (proto.Message, error) {
+	ret := _m.Called(raw)
+
+	var r0 proto.Message
+	if rf, ok := ret.Get(0).(func([]byte) proto.Message); ok {
+		r0 = rf(raw)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(proto.Message)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func([]byte) error); ok {
+		r1 = rf(raw)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CheckCallbackSignature provides a mock function with given fields: order, raw, signature
+func (_m *PaymentSystem) CheckCallbackSignature(order *billingpb.Order, raw string, signature string) error {
+	ret := _m.Called(order, raw, signature)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*billingpb.Order, string, string) error); ok {
+		r0 = rf(order, raw, signature)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetCallbackTransaction provides a mock function with given fields: request
+func (_m *PaymentSystem) GetCallbackTransaction(request proto.Message) (string, string) {
+	ret := _m.Called(request)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(proto.Message) string); ok {
+		r0 = rf(request)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 string
+	if rf, ok := ret.Get(1).(func(proto.Message) string); ok {
+		r1 = rf(request)
+	} else {
+		r1 = ret.Get(1).(string)
+	}
+
+	return r0, r1
+}
+
+// GetPaymentMethodGroups provides a mock function with given fields:
+func (_m *PaymentSystem) GetPaymentMethodGroups() []string {
+	ret := _m.Called()
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func() []string); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	return r0
+}
+
 // GetRecurringId provides a mock function with given fields: request
 func (_m *PaymentSystem) GetRecurringId(request proto.Message) string {
 	ret := _m.Called(request)
@@ -60,6 +192,20 @@ func (_m *PaymentSystem) GetRecurringId(request proto.Message) string {
 	return r0
 }
 
+// GetRefundId provides a mock function with given fields: request
+func (_m *PaymentSystem) GetRefundId(request proto.Message) string {
+	ret := _m.Called(request)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(proto.Message) string); ok {
+		r0 = rf(request)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
 // IsRecurringCallback provides a mock function with given fields: request
 func (_m *PaymentSystem) IsRecurringCallback(request proto.Message) bool {
 	ret := _m.Called(request)
@@ -101,3 +247,17 @@ func (_m *PaymentSystem) ProcessRefund(order *billingpb.Order, refund *billingpb
 
 	return r0
 }
+
+// VoidPayment provides a mock function with given fields: order
+func (_m *PaymentSystem) VoidPayment(order *billingpb.Order) error {
+	ret := _m.Called(order)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*billingpb.Order) error); ok {
+		r0 = rf(order)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
@@ -11,6 +11,29 @@ type RefundRepositoryInterface struct {
 	mock.Mock
 }
 
+// ClaimApproval provides a mock function with given fields: _a0, _a1, _a2, _a3
+func (_m *RefundRepositoryInterface) ClaimApproval(_a0 context.Context, _a1 string, _a2 int32, _a3 string) (*billingpb.Refund, error) {
+	ret := _m.Called(_a0, _a1, _a2, _a3)
+
+	var r0 *billingpb.Refund
+	if rf, ok := ret.Get(0).(func(context.Context, string, int32, string) *billingpb.Refund); ok {
+		r0 = rf(_a0, _a1, _a2, _a3)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*billingpb.Refund)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, int32, string) error); ok {
+		r1 = rf(_a0, _a1, _a2, _a3)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // CountByOrderUuid provides a mock function with given fields: _a0, _a1
 func (_m *RefundRepositoryInterface) CountByOrderUuid(_a0 context.Context, _a1 string) (int64, error) {
 	ret := _m.Called(_a0, _a1)
@@ -113,6 +136,20 @@ func (_m *RefundRepositoryInterface) Insert(_a0 context.Context, _a1 *billingpb.
 	return r0
 }
 
+// ReleaseApproval provides a mock function with given fields: _a0, _a1
+func (_m *RefundRepositoryInterface) ReleaseApproval(_a0 context.Context, _a1 string) error {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Update provides a mock function with given fields: _a0, _a1
 func (_m *RefundRepositoryInterface) Update(_a0 context.Context, _a1 *billingpb.Refund) error {
 	ret := _m.Called(_a0, _a1)
@@ -0,0 +1,78 @@
+package pkg
+
+import (
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"time"
+)
+
+const (
+	AccountingCorrectionBatchStatusPending  = "pending"
+	AccountingCorrectionBatchStatusApproved = "approved"
+	AccountingCorrectionBatchStatusRejected = "rejected"
+	AccountingCorrectionBatchStatusReversed = "reversed"
+
+	// AccountingCorrectionBatchStatusPartiallyBooked is a status of the batch which entries or reversal entries
+	// are saved only partially, the batch keeps identifiers of saved entries and must be resolved manually.
+	AccountingCorrectionBatchStatusPartiallyBooked = "partially_booked"
+)
+
+// AccountingCorrectionBatch is a batch of manual accounting corrections of merchants. The batch is validated
+// as a whole on creation, entries are booked only after approval by the user other than creator.
+// Booked entries have the batch as source, so corrections are traced and reversed as a unit.
+type AccountingCorrectionBatch struct {
+	Id               string                  `bson:"_id" json:"id"`
+	Status           string                  `bson:"status" json:"status"`
+	Corrections      []*AccountingCorrection `bson:"corrections" json:"corrections"`
+	Date             int64                   `bson:"date" json:"date"`
+	CreatorId        string                  `bson:"creator_id" json:"creator_id"`
+	ApproverId       string                  `bson:"approver_id" json:"approver_id"`
+	Comment          string                  `bson:"comment" json:"comment"`
+	ReverserId       string                  `bson:"reverser_id" json:"reverser_id"`
+	ReversalReason   string                  `bson:"reversal_reason" json:"reversal_reason"`
+	EntryIds         []string                `bson:"entry_ids" json:"entry_ids"`
+	ReversalEntryIds []string                `bson:"reversal_entry_ids" json:"reversal_entry_ids"`
+	CreatedAt        time.Time               `bson:"created_at" json:"created_at"`
+	DecidedAt        *time.Time              `bson:"decided_at" json:"decided_at"`
+	ReversedAt       *time.Time              `bson:"reversed_at" json:"reversed_at"`
+}
+
+// AccountingCorrection is a correction of the batch. Empty type means the royalty correction of merchant,
+// currency must be the payout currency of merchant. Reference is unique in the batch.
+type AccountingCorrection struct {
+	Line         int32   `bson:"line" json:"line"`
+	MerchantId   string  `bson:"merchant_id" json:"merchant_id"`
+	Type         string  `bson:"type" json:"type"`
+	Currency     string  `bson:"currency" json:"currency"`
+	Amount       float64 `bson:"amount" json:"amount"`
+	Reason       string  `bson:"reason" json:"reason"`
+	Reference    string  `bson:"reference" json:"reference"`
+	EntryId      string  `bson:"entry_id" json:"entry_id"`
+	ErrorCode    string  `bson:"error_code" json:"error_code"`
+	ErrorMessage string  `bson:"error_message" json:"error_message"`
+}
+
+// CreateAccountingCorrectionBatchRequest contains corrections as the list or as CSV file with header
+// merchant_id,type,currency,amount,reason,reference. Date is unix timestamp of booked entries, now if it's empty.
+type CreateAccountingCorrectionBatchRequest struct {
+	CreatorId   string                  `json:"creator_id"`
+	Date        int64                   `json:"date"`
+	Corrections []*AccountingCorrection `json:"corrections"`
+	File        []byte                  `json:"file"`
+}
+
+type GetAccountingCorrectionBatchRequest struct {
+	Id string `json:"id"`
+}
+
+// ChangeAccountingCorrectionBatchRequest is a decision of the user about the batch or its reversal.
+type ChangeAccountingCorrectionBatchRequest struct {
+	Id      string `json:"id"`
+	UserId  string `json:"user_id"`
+	Comment string `json:"comment"`
+}
+
+type AccountingCorrectionBatchResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Item    *AccountingCorrectionBatch      `json:"item"`
+}
@@ -0,0 +1,90 @@
+package pkg
+
+import (
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"time"
+)
+
+const (
+	AccountingExportFormatCsv   = "csv"
+	AccountingExportFormatXml   = "xml"
+	AccountingExportFormatJsonl = "jsonl"
+
+	AccountingExportStatusPending    = "pending"
+	AccountingExportStatusProcessing = "processing"
+	AccountingExportStatusCompleted  = "completed"
+	AccountingExportStatusFailed     = "failed"
+
+	// AccountingExportSchemaVersion is a version of columns and elements of export files, it must be changed
+	// on every change of them.
+	AccountingExportSchemaVersion = "1.0"
+)
+
+// AccountingExport is a job of export of accounting entries of the operating company for the period. File is built
+// by daemon which claims the pending export by moving it to the processing status, entries are grouped by source
+// document. Content of file is stored in chunks and passed to reporter as report file, reporter reads it by
+// GetAccountingExportFile. Checksum is SHA-256 of the whole file.
+type AccountingExport struct {
+	Id                 string                   `bson:"_id" json:"id"`
+	OperatingCompanyId string                   `bson:"operating_company_id" json:"operating_company_id"`
+	CreatorId          string                   `bson:"creator_id" json:"creator_id"`
+	Format             string                   `bson:"format" json:"format"`
+	From               time.Time                `bson:"from" json:"from"`
+	To                 time.Time                `bson:"to" json:"to"`
+	Status             string                   `bson:"status" json:"status"`
+	SchemaVersion      string                   `bson:"schema_version" json:"schema_version"`
+	Documents          int64                    `bson:"documents" json:"documents"`
+	Entries            int64                    `bson:"entries" json:"entries"`
+	Chunks             int32                    `bson:"chunks" json:"chunks"`
+	Size               int64                    `bson:"size" json:"size"`
+	Checksum           string                   `bson:"checksum" json:"checksum"`
+	Totals             []*AccountingExportTotal `bson:"totals" json:"totals"`
+	ErrorMessage       string                   `bson:"error_message" json:"error_message"`
+	CreatedAt          time.Time                `bson:"created_at" json:"created_at"`
+	UpdatedAt          time.Time                `bson:"updated_at" json:"updated_at"`
+	FinishedAt         *time.Time               `bson:"finished_at" json:"finished_at"`
+}
+
+// AccountingExportTotal is a control total of exported entries in the currency.
+type AccountingExportTotal struct {
+	Currency string  `bson:"currency" json:"currency"`
+	Entries  int64   `bson:"entries" json:"entries"`
+	Amount   float64 `bson:"amount" json:"amount"`
+}
+
+// AccountingExportChunk is a part of content of export file, chunks are concatenated in order of numbers.
+type AccountingExportChunk struct {
+	Id       string `bson:"_id" json:"id"`
+	ExportId string `bson:"export_id" json:"export_id"`
+	Number   int32  `bson:"number" json:"number"`
+	Data     []byte `bson:"data" json:"data"`
+}
+
+// CreateAccountingExportRequest is a request of export for the period, dates are unix timestamps
+// and both are inclusive.
+type CreateAccountingExportRequest struct {
+	OperatingCompanyId string `json:"operating_company_id"`
+	CreatorId          string `json:"creator_id"`
+	Format             string `json:"format"`
+	From               int64  `json:"from"`
+	To                 int64  `json:"to"`
+}
+
+type GetAccountingExportRequest struct {
+	Id string `json:"id"`
+}
+
+type AccountingExportResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Item    *AccountingExport               `json:"item"`
+}
+
+// AccountingExportFileResponse is a content of file of the completed export.
+type AccountingExportFileResponse struct {
+	Status   int32                           `json:"status"`
+	Message  *billingpb.ResponseErrorMessage `json:"message"`
+	Format   string                          `json:"format"`
+	Checksum string                          `json:"checksum"`
+	File     []byte                          `json:"file"`
+}
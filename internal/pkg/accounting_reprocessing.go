@@ -0,0 +1,66 @@
+package pkg
+
+import (
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"time"
+)
+
+// PaidOrderFilter is a filter of payment orders paid by payment system, orders are filtered by the merchant
+// and identifiers if they're specified and by the date of payment inclusive, zero dates don't limit the period.
+type PaidOrderFilter struct {
+	MerchantId           string
+	Ids                  []string
+	PmOrderCloseDateFrom time.Time
+	PmOrderCloseDateTo   time.Time
+	Limit                int64
+	Offset               int64
+}
+
+// ReprocessAccountingRequest selects payment orders and optionally their completed refunds to recompute
+// accounting entries by the current rules. Dates are unix timestamps of payment of orders and both are inclusive.
+// Entries are only compared without Apply, otherwise differences are booked by correction entries.
+type ReprocessAccountingRequest struct {
+	MerchantId string   `json:"merchant_id"`
+	OrderIds   []string `json:"order_ids"`
+	From       int64    `json:"from"`
+	To         int64    `json:"to"`
+	Refunds    bool     `json:"refunds"`
+	Apply      bool     `json:"apply"`
+	Limit      int64    `json:"limit"`
+	Offset     int64    `json:"offset"`
+}
+
+// AccountingEntryDiff is a difference between the sum of saved entries of the type in the currency
+// and the recomputed entry. Delta is booked by correction entry of the same type.
+type AccountingEntryDiff struct {
+	Type                string  `json:"type"`
+	Currency            string  `json:"currency"`
+	Amount              float64 `json:"amount"`
+	NewAmount           float64 `json:"new_amount"`
+	Delta               float64 `json:"delta"`
+	OriginalCurrency    string  `json:"original_currency"`
+	OriginalAmountDelta float64 `json:"original_amount_delta"`
+	LocalCurrency       string  `json:"local_currency"`
+	LocalAmountDelta    float64 `json:"local_amount_delta"`
+}
+
+// AccountingReprocessingItem is a result of reprocessing of entries of the order or the refund. CorrectionIds are
+// identifiers of booked correction entries, error is set if entries couldn't be recomputed or booked.
+type AccountingReprocessingItem struct {
+	SourceType    string                 `json:"source_type"`
+	SourceId      string                 `json:"source_id"`
+	OrderId       string                 `json:"order_id"`
+	MerchantId    string                 `json:"merchant_id"`
+	Diffs         []*AccountingEntryDiff `json:"diffs"`
+	CorrectionIds []string               `json:"correction_ids"`
+	ErrorCode     string                 `json:"error_code"`
+	ErrorMessage  string                 `json:"error_message"`
+}
+
+type ReprocessAccountingResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Count   int64                           `json:"count"`
+	Changed int64                           `json:"changed"`
+	Items   []*AccountingReprocessingItem   `json:"items"`
+}
@@ -0,0 +1,99 @@
+package pkg
+
+import (
+	"context"
+	"github.com/micro/go-micro/server"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+)
+
+const (
+	// BillingInternalServiceContentType is the content type of requests to BillingInternalService endpoints.
+	// Requests and responses of the service aren't protobuf messages, so they must be encoded to JSON by clients.
+	BillingInternalServiceContentType = "application/json"
+)
+
+// BillingInternalServiceHandler is implemented by billing service for methods which requests and responses aren't
+// described in billing proto. Methods are available in the billing micro service by BillingInternalService.<Method>
+// endpoints, e.g. BillingInternalService.SetPaymentRoute.
+type BillingInternalServiceHandler interface {
+	SetPaymentRoute(context.Context, *PaymentRoute, *PaymentRouteResponse) error
+	GetPaymentRoutes(context.Context, *GetPaymentRoutesRequest, *GetPaymentRoutesResponse) error
+	DeletePaymentRoute(context.Context, *PaymentRouteRequest, *billingpb.ResponseError) error
+	GetOrderPaymentRouting(context.Context, *billingpb.GetOrderRequest, *OrderPaymentRoutingResponse) error
+	GetPaymentSystemsHealth(context.Context, *PaymentSystemHealthRequest, *GetPaymentSystemsHealthResponse) error
+	ResetPaymentSystemHealth(context.Context, *PaymentSystemHealthRequest, *billingpb.ResponseError) error
+	CapturePayment(context.Context, *PaymentAuthorizationRequest, *PaymentAuthorizationResponse) error
+	VoidPayment(context.Context, *PaymentAuthorizationRequest, *PaymentAuthorizationResponse) error
+	ListCallbackJournal(context.Context, *ListCallbackJournalRequest, *ListCallbackJournalResponse) error
+	ReplayCallback(context.Context, *ReplayCallbackRequest, *ReplayCallbackResponse) error
+	GetOrderStatusEvents(context.Context, *billingpb.GetOrderRequest, *OrderStatusEventsResponse) error
+	GetProjectOrderLifetime(context.Context, *ProjectOrderLifetimeRequest, *ProjectOrderLifetimeResponse) error
+	SetProjectOrderLifetime(context.Context, *ProjectOrderLifetimeRequest, *ProjectOrderLifetimeResponse) error
+	CreateOrUpdateSubscriptionPlan(context.Context, *SubscriptionPlan, *SubscriptionPlanResponse) error
+	GetSubscriptionPlans(context.Context, *ListSubscriptionPlansRequest, *ListSubscriptionPlansResponse) error
+	CreateSubscription(context.Context, *CreateSubscriptionRequest, *CreateSubscriptionResponse) error
+	GetSubscription(context.Context, *SubscriptionRequest, *SubscriptionResponse) error
+	CancelSubscription(context.Context, *SubscriptionRequest, *SubscriptionResponse) error
+	PauseSubscription(context.Context, *SubscriptionRequest, *SubscriptionResponse) error
+	ResumeSubscription(context.Context, *SubscriptionRequest, *SubscriptionResponse) error
+	UpdateSubscriptionCard(context.Context, *UpdateSubscriptionCardRequest, *SubscriptionResponse) error
+	ChangeSubscriptionPlan(context.Context, *SubscriptionRequest, *SubscriptionResponse) error
+	GetDunningPolicy(context.Context, *DunningPolicyRequest, *DunningPolicyResponse) error
+	SetDunningPolicy(context.Context, *DunningPolicy, *DunningPolicyResponse) error
+	ListSavedPaymentMethods(context.Context, *SavedPaymentMethodsRequest, *SavedPaymentMethodsResponse) error
+	SetDefaultSavedPaymentMethod(context.Context, *SavedPaymentMethodsRequest, *SavedPaymentMethodsResponse) error
+	RenameSavedPaymentMethod(context.Context, *SavedPaymentMethodsRequest, *SavedPaymentMethodsResponse) error
+	GetFraudPolicy(context.Context, *FraudPolicyRequest, *FraudPolicyResponse) error
+	SetFraudPolicy(context.Context, *FraudPolicy, *FraudPolicyResponse) error
+	GetOrderFraudCheck(context.Context, *OrderFraudCheckRequest, *OrderFraudCheckResponse) error
+	CreateFraudListEntry(context.Context, *FraudListEntry, *FraudListEntryResponse) error
+	UpdateFraudListEntry(context.Context, *FraudListEntry, *FraudListEntryResponse) error
+	DeleteFraudListEntry(context.Context, *FraudListEntryRequest, *FraudListEntryResponse) error
+	GetFraudListEntry(context.Context, *FraudListEntryRequest, *FraudListEntryResponse) error
+	ListFraudListEntries(context.Context, *ListFraudListEntriesRequest, *ListFraudListEntriesResponse) error
+	ImportFraudListEntries(context.Context, *ImportFraudListEntriesRequest, *ImportFraudListEntriesResponse) error
+	ListFraudListBlockedAttempts(context.Context, *ListFraudListBlockedAttemptsRequest, *ListFraudListBlockedAttemptsResponse) error
+	CreateDispute(context.Context, *CreateDisputeRequest, *DisputeResponse) error
+	ChangeDisputeStatus(context.Context, *ChangeDisputeStatusRequest, *DisputeResponse) error
+	AddDisputeEvidence(context.Context, *AddDisputeEvidenceRequest, *DisputeResponse) error
+	GetDispute(context.Context, *GetDisputeRequest, *DisputeResponse) error
+	ListDisputes(context.Context, *ListDisputesRequest, *ListDisputesResponse) error
+	CreateItemsRefund(context.Context, *CreateItemsRefundRequest, *CreateItemsRefundResponse) error
+	GetRefundApprovalPolicy(context.Context, *RefundApprovalPolicyRequest, *RefundApprovalPolicyResponse) error
+	SetRefundApprovalPolicy(context.Context, *RefundApprovalPolicy, *RefundApprovalPolicyResponse) error
+	ApproveRefund(context.Context, *ChangeRefundApprovalRequest, *ChangeRefundApprovalResponse) error
+	RejectRefund(context.Context, *ChangeRefundApprovalRequest, *ChangeRefundApprovalResponse) error
+	ListRefundApprovals(context.Context, *ListRefundApprovalsRequest, *ListRefundApprovalsResponse) error
+	CreateBulkRefund(context.Context, *CreateBulkRefundRequest, *BulkRefundJobResponse) error
+	GetBulkRefundJob(context.Context, *GetBulkRefundJobRequest, *BulkRefundJobResponse) error
+	GetDuplicatePaymentPolicy(context.Context, *DuplicatePaymentPolicyRequest, *DuplicatePaymentPolicyResponse) error
+	SetDuplicatePaymentPolicy(context.Context, *DuplicatePaymentPolicy, *DuplicatePaymentPolicyResponse) error
+	ListDuplicatePayments(context.Context, *ListDuplicatePaymentsRequest, *ListDuplicatePaymentsResponse) error
+	GetTrialBalance(context.Context, *TrialBalanceRequest, *TrialBalanceResponse) error
+	GetAccountLedger(context.Context, *AccountLedgerRequest, *AccountLedgerResponse) error
+	CreateAccountingExport(context.Context, *CreateAccountingExportRequest, *AccountingExportResponse) error
+	GetAccountingExport(context.Context, *GetAccountingExportRequest, *AccountingExportResponse) error
+	GetAccountingExportFile(context.Context, *GetAccountingExportRequest, *AccountingExportFileResponse) error
+	ReprocessAccounting(context.Context, *ReprocessAccountingRequest, *ReprocessAccountingResponse) error
+	CreateAccountingCorrectionBatch(context.Context, *CreateAccountingCorrectionBatchRequest, *AccountingCorrectionBatchResponse) error
+	GetAccountingCorrectionBatch(context.Context, *GetAccountingCorrectionBatchRequest, *AccountingCorrectionBatchResponse) error
+	ApproveAccountingCorrectionBatch(context.Context, *ChangeAccountingCorrectionBatchRequest, *AccountingCorrectionBatchResponse) error
+	RejectAccountingCorrectionBatch(context.Context, *ChangeAccountingCorrectionBatchRequest, *AccountingCorrectionBatchResponse) error
+	ReverseAccountingCorrectionBatch(context.Context, *ChangeAccountingCorrectionBatchRequest, *AccountingCorrectionBatchResponse) error
+	GetRollingReserveTerms(context.Context, *RollingReserveTermsRequest, *RollingReserveTermsResponse) error
+	SetRollingReserveTerms(context.Context, *RollingReserveTerms, *RollingReserveTermsResponse) error
+	GetRollingReserveAmounts(context.Context, *RollingReserveAmountsRequest, *RollingReserveAmountsResponse) error
+}
+
+// RegisterBillingInternalServiceHandler registers the handler in the micro server along with billing service handler.
+func RegisterBillingInternalServiceHandler(
+	s server.Server,
+	hdlr BillingInternalServiceHandler,
+	opts ...server.HandlerOption,
+) error {
+	type BillingInternalService struct {
+		BillingInternalServiceHandler
+	}
+
+	return s.Handle(s.NewHandler(&BillingInternalService{hdlr}, opts...))
+}
@@ -0,0 +1,68 @@
+package pkg
+
+import (
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"time"
+)
+
+const (
+	BulkRefundJobStatusProcessing = "processing"
+	BulkRefundJobStatusCompleted  = "completed"
+
+	BulkRefundRowStatusPending    = "pending"
+	BulkRefundRowStatusProcessing = "processing"
+	BulkRefundRowStatusSucceeded  = "succeeded"
+	BulkRefundRowStatusFailed     = "failed"
+)
+
+// BulkRefundJob is a job of refunds of orders uploaded by merchant in CSV file. Rows are validated on upload,
+// refunds of valid rows are created by daemon with throttling. Result report of the job is requested
+// from reporter when all rows are processed.
+type BulkRefundJob struct {
+	Id         string           `bson:"_id" json:"id"`
+	MerchantId string           `bson:"merchant_id" json:"merchant_id"`
+	CreatorId  string           `bson:"creator_id" json:"creator_id"`
+	Status     string           `bson:"status" json:"status"`
+	Rows       []*BulkRefundRow `bson:"rows" json:"rows"`
+	Total      int32            `bson:"total" json:"total"`
+	Succeeded  int32            `bson:"succeeded" json:"succeeded"`
+	Failed     int32            `bson:"failed" json:"failed"`
+	CreatedAt  time.Time        `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time        `bson:"updated_at" json:"updated_at"`
+	FinishedAt *time.Time       `bson:"finished_at" json:"finished_at"`
+}
+
+// BulkRefundRow is a row of CSV file of bulk refund. OrderId is the order uuid or the order identifier in project
+// if ProjectId is set. Empty amount means the charge amount of order, otherwise it must be equal to it.
+// ClaimedAt is the time when the row was moved to processing status by daemon.
+type BulkRefundRow struct {
+	Line         int32      `bson:"line" json:"line"`
+	OrderId      string     `bson:"order_id" json:"order_id"`
+	ProjectId    string     `bson:"project_id" json:"project_id"`
+	OrderUuid    string     `bson:"order_uuid" json:"order_uuid"`
+	Amount       float64    `bson:"amount" json:"amount"`
+	Reason       string     `bson:"reason" json:"reason"`
+	Status       string     `bson:"status" json:"status"`
+	RefundId     string     `bson:"refund_id" json:"refund_id"`
+	ErrorCode    string     `bson:"error_code" json:"error_code"`
+	ErrorMessage string     `bson:"error_message" json:"error_message"`
+	ClaimedAt    *time.Time `bson:"claimed_at" json:"claimed_at"`
+}
+
+// CreateBulkRefundRequest is CSV file of bulk refund with header order_id,project_id,amount,reason.
+type CreateBulkRefundRequest struct {
+	MerchantId string `json:"merchant_id"`
+	CreatorId  string `json:"creator_id"`
+	File       []byte `json:"file"`
+}
+
+type GetBulkRefundJobRequest struct {
+	Id         string `json:"id"`
+	MerchantId string `json:"merchant_id"`
+}
+
+type BulkRefundJobResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Item    *BulkRefundJob                  `json:"item"`
+}
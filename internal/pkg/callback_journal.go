@@ -0,0 +1,66 @@
+package pkg
+
+import (
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"time"
+)
+
+const (
+	CallbackJournalTypePayment = "payment"
+	CallbackJournalTypeRefund  = "refund"
+
+	CallbackJournalStatusProcessing = "processing"
+	CallbackJournalStatusReplaying  = "replaying"
+	CallbackJournalStatusSuccess    = "success"
+	CallbackJournalStatusSkipped    = "skipped"
+	CallbackJournalStatusFailed     = "failed"
+	CallbackJournalStatusDuplicate  = "duplicate"
+	CallbackJournalStatusConflict   = "conflict"
+)
+
+// CallbackJournalEntry is a raw callback of payment system with the result of its processing.
+// Entry is created before processing of callback, so callback isn't lost if processing fails halfway
+// and it can be replayed later through the same processing path.
+type CallbackJournalEntry struct {
+	Id             string     `bson:"_id" json:"id"`
+	Type           string     `bson:"type" json:"type"`
+	Handler        string     `bson:"handler" json:"handler"`
+	Body           []byte     `bson:"body" json:"body"`
+	Signature      string     `bson:"signature" json:"signature"`
+	OrderId        string     `bson:"order_id" json:"order_id"`
+	RefundId       string     `bson:"refund_id" json:"refund_id"`
+	Status         string     `bson:"status" json:"status"`
+	ResponseStatus int32      `bson:"response_status" json:"response_status"`
+	Error          string     `bson:"error" json:"error"`
+	ReplayCount    int32      `bson:"replay_count" json:"replay_count"`
+	CreatedAt      time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt      time.Time  `bson:"updated_at" json:"updated_at"`
+	ReplayedAt     *time.Time `bson:"replayed_at" json:"replayed_at"`
+}
+
+// ListCallbackJournalRequest is a filter of callbacks journal, empty fields match any value.
+type ListCallbackJournalRequest struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Handler string `json:"handler"`
+	OrderId string `json:"order_id"`
+	Limit   int64  `json:"limit"`
+	Offset  int64  `json:"offset"`
+}
+
+type ListCallbackJournalResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Count   int64                           `json:"count"`
+	Items   []*CallbackJournalEntry         `json:"items"`
+}
+
+type ReplayCallbackRequest struct {
+	Id string `json:"id"`
+}
+
+type ReplayCallbackResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Item    *CallbackJournalEntry           `json:"item"`
+}
@@ -0,0 +1,28 @@
+package pkg
+
+import "time"
+
+const (
+	CallbackTransactionStateProcessing = "processing"
+	CallbackTransactionStateProcessed  = "processed"
+	CallbackTransactionStateConflict   = "conflict"
+)
+
+// CallbackTransaction is a lock and result of processing of payment system notification about transaction
+// of payment or refund in the specified status. Identifier is built from handler, type of callback, identifier
+// of transaction in payment system and its status, so every notification is processed only once.
+// IsFinal is true if order or refund got final status by the notification and can't be changed by other statuses.
+type CallbackTransaction struct {
+	Id                string    `bson:"_id" json:"id"`
+	Handler           string    `bson:"handler" json:"handler"`
+	Type              string    `bson:"type" json:"type"`
+	TransactionId     string    `bson:"transaction_id" json:"transaction_id"`
+	Status            string    `bson:"status" json:"status"`
+	State             string    `bson:"state" json:"state"`
+	IsFinal           bool      `bson:"is_final" json:"is_final"`
+	ResponseStatus    int32     `bson:"response_status" json:"response_status"`
+	ResponseError     string    `bson:"response_error" json:"response_error"`
+	CallbackJournalId string    `bson:"callback_journal_id" json:"callback_journal_id"`
+	CreatedAt         time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt         time.Time `bson:"updated_at" json:"updated_at"`
+}
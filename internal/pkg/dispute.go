@@ -0,0 +1,119 @@
+package pkg
+
+import (
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"time"
+)
+
+const (
+	DisputeStatusInquiry           = "inquiry"
+	DisputeStatusChargeback        = "chargeback"
+	DisputeStatusEvidenceSubmitted = "evidence_submitted"
+	DisputeStatusPreArbitration    = "pre_arbitration"
+	DisputeStatusWon               = "won"
+	DisputeStatusLost              = "lost"
+)
+
+// Dispute is a dispute of the order payment opened by the issuer of customer card. Merchant has to respond
+// to the dispute with evidences before the deadline. Chargeback of the dispute is booked as refund of the order,
+// RefundId is the identifier of this refund, it's reversed in accounting when the dispute is won.
+type Dispute struct {
+	Id                 string             `bson:"_id" json:"id"`
+	OrderId            string             `bson:"order_id" json:"order_id"`
+	OrderUuid          string             `bson:"order_uuid" json:"order_uuid"`
+	MerchantId         string             `bson:"merchant_id" json:"merchant_id"`
+	ProjectId          string             `bson:"project_id" json:"project_id"`
+	ExternalId         string             `bson:"external_id" json:"external_id"`
+	ReasonCode         string             `bson:"reason_code" json:"reason_code"`
+	Reason             string             `bson:"reason" json:"reason"`
+	Amount             float64            `bson:"amount" json:"amount"`
+	Currency           string             `bson:"currency" json:"currency"`
+	Status             string             `bson:"status" json:"status"`
+	DueAt              *time.Time         `bson:"due_at" json:"due_at"`
+	Evidences          []*DisputeEvidence `bson:"evidences" json:"evidences"`
+	History            []*DisputeEvent    `bson:"history" json:"history"`
+	RefundId           string             `bson:"refund_id" json:"refund_id"`
+	OrderPrivateStatus int32              `bson:"order_private_status" json:"-"`
+	OrderPublicStatus  string             `bson:"order_public_status" json:"-"`
+	IsReversed         bool               `bson:"is_reversed" json:"is_reversed"`
+	CreatedAt          time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt          time.Time          `bson:"updated_at" json:"updated_at"`
+	ClosedAt           *time.Time         `bson:"closed_at" json:"closed_at"`
+}
+
+// DisputeEvidence is an attachment of merchant to respond to the dispute, file is stored by the url.
+type DisputeEvidence struct {
+	Id          string    `bson:"id" json:"id"`
+	Name        string    `bson:"name" json:"name"`
+	Url         string    `bson:"url" json:"url"`
+	Description string    `bson:"description" json:"description"`
+	CreatorId   string    `bson:"creator_id" json:"creator_id"`
+	CreatedAt   time.Time `bson:"created_at" json:"created_at"`
+}
+
+// DisputeEvent is a change of dispute status with the comment of user or payment system.
+type DisputeEvent struct {
+	From      string    `bson:"from" json:"from"`
+	To        string    `bson:"to" json:"to"`
+	Comment   string    `bson:"comment" json:"comment"`
+	CreatorId string    `bson:"creator_id" json:"creator_id"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+// CreateDisputeRequest opens dispute of the order. Amount of order charge is disputed if amount is empty,
+// deadline is calculated by the status if it isn't set. Status is inquiry or chargeback.
+type CreateDisputeRequest struct {
+	OrderId    string  `json:"order_id"`
+	ExternalId string  `json:"external_id"`
+	ReasonCode string  `json:"reason_code"`
+	Reason     string  `json:"reason"`
+	Amount     float64 `json:"amount"`
+	Status     string  `json:"status"`
+	DueAt      int64   `json:"due_at"`
+	CreatorId  string  `json:"creator_id"`
+}
+
+// ChangeDisputeStatusRequest moves dispute to the status, deadline is calculated by the status if it isn't set.
+type ChangeDisputeStatusRequest struct {
+	Id        string `json:"id"`
+	Status    string `json:"status"`
+	DueAt     int64  `json:"due_at"`
+	Comment   string `json:"comment"`
+	CreatorId string `json:"creator_id"`
+}
+
+type AddDisputeEvidenceRequest struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	Url         string `json:"url"`
+	Description string `json:"description"`
+	CreatorId   string `json:"creator_id"`
+}
+
+type GetDisputeRequest struct {
+	Id string `json:"id"`
+}
+
+type DisputeResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Item    *Dispute                        `json:"item"`
+}
+
+// ListDisputesRequest is a filter of disputes, empty fields match any value. DueBefore selects disputes
+// with the deadline before the time.
+type ListDisputesRequest struct {
+	MerchantId string `json:"merchant_id"`
+	OrderId    string `json:"order_id"`
+	Status     string `json:"status"`
+	DueBefore  int64  `json:"due_before"`
+	Limit      int64  `json:"limit"`
+	Offset     int64  `json:"offset"`
+}
+
+type ListDisputesResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Count   int64                           `json:"count"`
+	Items   []*Dispute                      `json:"items"`
+}
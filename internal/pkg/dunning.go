@@ -0,0 +1,44 @@
+package pkg
+
+import (
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"time"
+)
+
+const (
+	DunningDeclineTypeSoft              = "soft"
+	DunningDeclineTypeInsufficientFunds = "insufficient_funds"
+	DunningDeclineTypeHard              = "hard"
+)
+
+// DunningPolicy is a policy of retries of failed renewal payments of subscriptions of the project.
+// Retry intervals are in seconds, the last interval is used for the rest of attempts. Retries of payments declined
+// for insufficient funds are moved to the hour of day (UTC) if it's set. Payments declined by the hard decline codes,
+// e.g. for lost or stolen card, aren't retried.
+type DunningPolicy struct {
+	ProjectId                     string    `bson:"_id" json:"project_id"`
+	RetryIntervals                []int64   `bson:"retry_intervals" json:"retry_intervals"`
+	MaxAttempts                   int32     `bson:"max_attempts" json:"max_attempts"`
+	RetryHour                     *int32    `bson:"retry_hour" json:"retry_hour"`
+	HardDeclineCodes              []string  `bson:"hard_decline_codes" json:"hard_decline_codes"`
+	InsufficientFundsDeclineCodes []string  `bson:"insufficient_funds_decline_codes" json:"insufficient_funds_decline_codes"`
+	UpdatedAt                     time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+type DunningPolicyRequest struct {
+	ProjectId string `json:"project_id"`
+}
+
+type DunningPolicyResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Item    *DunningPolicy                  `json:"item"`
+}
+
+// UpdateSubscriptionCardRequest is a request of customer to replace the card which is charged for renewals
+// of subscription, customer gets link to it when renewal payment fails.
+type UpdateSubscriptionCardRequest struct {
+	SubscriptionId string `json:"subscription_id"`
+	UserId         string `json:"user_id"`
+	StoredCardId   string `json:"stored_card_id"`
+}
@@ -0,0 +1,67 @@
+package pkg
+
+import (
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"time"
+)
+
+const (
+	DuplicatePaymentActionRefund = "refund"
+	DuplicatePaymentActionReview = "review"
+)
+
+// DuplicatePaymentPolicy is a policy of merchant how to handle duplicate payments. Payment is a duplicate when
+// other order of the project with the same project order identifier, customer, amount and products was processed
+// during the window (in seconds) before it. Duplicate payment is refunded automatically or merchant is notified
+// to review it manually depending on the action.
+type DuplicatePaymentPolicy struct {
+	MerchantId string    `bson:"_id" json:"merchant_id"`
+	Action     string    `bson:"action" json:"action"`
+	Window     int64     `bson:"window" json:"window"`
+	UpdatedAt  time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+type DuplicatePaymentPolicyRequest struct {
+	MerchantId string `json:"merchant_id"`
+}
+
+type DuplicatePaymentPolicyResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Item    *DuplicatePaymentPolicy         `json:"item"`
+}
+
+// DuplicatePayment is a detected duplicate payment, Id is the identifier of the order processed later. Action is
+// the action actually taken, payment is left for review when automatic refund failed. RefundId is the identifier
+// of the automatic refund.
+type DuplicatePayment struct {
+	Id                string    `bson:"_id" json:"id"`
+	OrderUuid         string    `bson:"order_uuid" json:"order_uuid"`
+	OriginalOrderId   string    `bson:"original_order_id" json:"original_order_id"`
+	OriginalOrderUuid string    `bson:"original_order_uuid" json:"original_order_uuid"`
+	MerchantId        string    `bson:"merchant_id" json:"merchant_id"`
+	ProjectId         string    `bson:"project_id" json:"project_id"`
+	ProjectOrderId    string    `bson:"project_order_id" json:"project_order_id"`
+	CustomerId        string    `bson:"customer_id" json:"customer_id"`
+	Amount            float64   `bson:"amount" json:"amount"`
+	Currency          string    `bson:"currency" json:"currency"`
+	Action            string    `bson:"action" json:"action"`
+	RefundId          string    `bson:"refund_id" json:"refund_id"`
+	ErrorCode         string    `bson:"error_code" json:"error_code"`
+	ErrorMessage      string    `bson:"error_message" json:"error_message"`
+	CreatedAt         time.Time `bson:"created_at" json:"created_at"`
+}
+
+type ListDuplicatePaymentsRequest struct {
+	MerchantId string `json:"merchant_id"`
+	Action     string `json:"action"`
+	Limit      int64  `json:"limit"`
+	Offset     int64  `json:"offset"`
+}
+
+type ListDuplicatePaymentsResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Count   int64                           `json:"count"`
+	Items   []*DuplicatePayment             `json:"items"`
+}
@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"time"
+)
+
+const (
+	FraudDecisionAllow  = "allow"
+	FraudDecisionReview = "review"
+	FraudDecisionBlock  = "block"
+
+	FraudRuleVelocityIp                = "velocity_ip"
+	FraudRuleVelocityEmail             = "velocity_email"
+	FraudRuleVelocityCustomer          = "velocity_customer"
+	FraudRuleVelocityCard              = "velocity_card"
+	FraudRuleBinIpCountryMismatch      = "bin_ip_country_mismatch"
+	FraudRuleBinBillingCountryMismatch = "bin_billing_country_mismatch"
+	FraudRuleIpBillingCountryMismatch  = "ip_billing_country_mismatch"
+	FraudRuleDisposableEmail           = "disposable_email"
+	FraudRuleAmountAnomaly             = "amount_anomaly"
+)
+
+// FraudPolicy is a policy of fraud screening of payments of the project. Payment with score lower than the review
+// score is allowed, payment with score lower than the block score is allowed and marked for review, other payments
+// are blocked. Velocity rules are triggered when number of payment attempts with the same IP, email, customer
+// or card during the window (in seconds) exceeds the limit. Amount is anomalous when it exceeds the average amount
+// of payments of the project in the same currency by the factor.
+type FraudPolicy struct {
+	ProjectId           string    `bson:"_id" json:"project_id"`
+	ReviewScore         int32     `bson:"review_score" json:"review_score"`
+	BlockScore          int32     `bson:"block_score" json:"block_score"`
+	VelocityWindow      int64     `bson:"velocity_window" json:"velocity_window"`
+	VelocityLimit       int32     `bson:"velocity_limit" json:"velocity_limit"`
+	AmountAnomalyFactor float64   `bson:"amount_anomaly_factor" json:"amount_anomaly_factor"`
+	UpdatedAt           time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// OrderFraudCheck is a result of fraud screening of the order payment attempt. Identities of customer are stored
+// for the velocity rules, card is identified by the fingerprint of its number.
+type OrderFraudCheck struct {
+	Id              string                `bson:"_id" json:"id"`
+	OrderId         string                `bson:"order_id" json:"order_id"`
+	OrderUuid       string                `bson:"order_uuid" json:"order_uuid"`
+	ProjectId       string                `bson:"project_id" json:"project_id"`
+	Ip              string                `bson:"ip" json:"ip"`
+	Email           string                `bson:"email" json:"email"`
+	CustomerId      string                `bson:"customer_id" json:"customer_id"`
+	CardFingerprint string                `bson:"card_fingerprint" json:"-"`
+	Amount          float64               `bson:"amount" json:"amount"`
+	Currency        string                `bson:"currency" json:"currency"`
+	Score           int32                 `bson:"score" json:"score"`
+	Decision        string                `bson:"decision" json:"decision"`
+	Rules           []*FraudRuleTriggered `bson:"rules" json:"rules"`
+	CreatedAt       time.Time             `bson:"created_at" json:"created_at"`
+}
+
+// FraudRuleTriggered is a rule of fraud screening triggered by the payment attempt with its score.
+type FraudRuleTriggered struct {
+	Rule    string `bson:"rule" json:"rule"`
+	Score   int32  `bson:"score" json:"score"`
+	Details string `bson:"details" json:"details"`
+}
+
+type FraudPolicyRequest struct {
+	ProjectId string `json:"project_id"`
+}
+
+type FraudPolicyResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Item    *FraudPolicy                    `json:"item"`
+}
+
+type OrderFraudCheckRequest struct {
+	OrderId string `json:"order_id"`
+}
+
+type OrderFraudCheckResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Item    *OrderFraudCheck                `json:"item"`
+}
@@ -0,0 +1,134 @@
+package pkg
+
+import (
+	"encoding/hex"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"net"
+	"time"
+)
+
+const (
+	FraudListBlock = "block"
+	FraudListAllow = "allow"
+
+	FraudListEntryTypeEmail           = "email"
+	FraudListEntryTypeIp              = "ip"
+	FraudListEntryTypeBin             = "bin"
+	FraudListEntryTypeCardFingerprint = "card_fingerprint"
+	FraudListEntryTypeCustomerId      = "customer_id"
+	FraudListEntryTypeCountry         = "country"
+
+	FraudListStageOrderCreate   = "order_create"
+	FraudListStagePaymentCreate = "payment_create"
+)
+
+// FraudListEntry is an entry of block or allow list of the merchant, entry without merchant belongs to the
+// platform-wide lists. Value of IP entry is an address or a range in CIDR notation, value of BIN entry
+// is a prefix of card number up to 6 digits. Hits is a number of payment attempts matched by the entry.
+// First and last addresses of IP range are stored as keys of GetFraudListIpRangeKey to be matched by index.
+type FraudListEntry struct {
+	Id         string     `bson:"_id" json:"id"`
+	MerchantId string     `bson:"merchant_id" json:"merchant_id"`
+	List       string     `bson:"list" json:"list"`
+	Type       string     `bson:"type" json:"type"`
+	Value      string     `bson:"value" json:"value"`
+	RangeStart string     `bson:"range_start,omitempty" json:"-"`
+	RangeEnd   string     `bson:"range_end,omitempty" json:"-"`
+	Comment    string     `bson:"comment" json:"comment"`
+	Hits       int64      `bson:"hits" json:"hits"`
+	LastHitAt  *time.Time `bson:"last_hit_at" json:"last_hit_at"`
+	CreatedAt  time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time  `bson:"updated_at" json:"updated_at"`
+}
+
+// FraudListBlockedAttempt is an order creation or payment attempt declined by the block list entry. MatchedValue
+// is the value of attempt matched by the entry, e.g. address of customer matched by the IP range. Declined order
+// creation has only the order identifier of project because order isn't created.
+type FraudListBlockedAttempt struct {
+	Id             string    `bson:"_id" json:"id"`
+	EntryId        string    `bson:"entry_id" json:"entry_id"`
+	MerchantId     string    `bson:"merchant_id" json:"merchant_id"`
+	ProjectId      string    `bson:"project_id" json:"project_id"`
+	ProjectOrderId string    `bson:"project_order_id" json:"project_order_id"`
+	OrderId        string    `bson:"order_id" json:"order_id"`
+	OrderUuid      string    `bson:"order_uuid" json:"order_uuid"`
+	Stage          string    `bson:"stage" json:"stage"`
+	Type           string    `bson:"type" json:"type"`
+	Value          string    `bson:"value" json:"value"`
+	MatchedValue   string    `bson:"matched_value" json:"matched_value"`
+	CreatedAt      time.Time `bson:"created_at" json:"created_at"`
+}
+
+// GetFraudListIpRangeKey returns key of IP address which is compared with the bounds of IP ranges of lists.
+// Keys of IPv4 and IPv6 addresses have the same length, so keys are ordered as addresses.
+func GetFraudListIpRangeKey(ip net.IP) string {
+	return hex.EncodeToString(ip.To16())
+}
+
+type FraudListEntryRequest struct {
+	Id string `json:"id"`
+}
+
+type FraudListEntryResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Item    *FraudListEntry                 `json:"item"`
+}
+
+// ListFraudListEntriesRequest is a filter of entries of the merchant lists or of the platform-wide lists
+// if merchant is empty, other empty fields match any value.
+type ListFraudListEntriesRequest struct {
+	MerchantId string `json:"merchant_id"`
+	List       string `json:"list"`
+	Type       string `json:"type"`
+	Value      string `json:"value"`
+	Limit      int64  `json:"limit"`
+	Offset     int64  `json:"offset"`
+}
+
+type ListFraudListEntriesResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Count   int64                           `json:"count"`
+	Items   []*FraudListEntry               `json:"items"`
+}
+
+// ImportFraudListEntriesRequest is a bulk import of entries to the list of the merchant or to the platform-wide
+// list if merchant is empty. Only type, value and comment of imported entries are used.
+type ImportFraudListEntriesRequest struct {
+	MerchantId string            `json:"merchant_id"`
+	List       string            `json:"list"`
+	Entries    []*FraudListEntry `json:"entries"`
+}
+
+// ImportFraudListEntriesResponse contains numbers of imported entries and of entries skipped as already existing
+// and errors of invalid entries by their index in the request.
+type ImportFraudListEntriesResponse struct {
+	Status   int32                           `json:"status"`
+	Message  *billingpb.ResponseErrorMessage `json:"message"`
+	Imported int32                           `json:"imported"`
+	Skipped  int32                           `json:"skipped"`
+	Errors   []*FraudListImportError         `json:"errors"`
+}
+
+type FraudListImportError struct {
+	Index   int32                           `json:"index"`
+	Value   string                          `json:"value"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+}
+
+// ListFraudListBlockedAttemptsRequest is a filter of blocked attempts, empty fields match any value.
+type ListFraudListBlockedAttemptsRequest struct {
+	MerchantId string `json:"merchant_id"`
+	OrderId    string `json:"order_id"`
+	EntryId    string `json:"entry_id"`
+	Limit      int64  `json:"limit"`
+	Offset     int64  `json:"offset"`
+}
+
+type ListFraudListBlockedAttemptsResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Count   int64                           `json:"count"`
+	Items   []*FraudListBlockedAttempt      `json:"items"`
+}
@@ -0,0 +1,123 @@
+package pkg
+
+import (
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"time"
+)
+
+const (
+	LedgerAccountPaymentSystem     = "payment_system"
+	LedgerAccountCustomerClearing  = "customer_clearing"
+	LedgerAccountTaxPayable        = "tax_payable"
+	LedgerAccountMerchantPayable   = "merchant_payable"
+	LedgerAccountMerchantReserve   = "merchant_rolling_reserve"
+	LedgerAccountFeeIncome         = "fee_income"
+	LedgerAccountPaymentSystemCost = "payment_system_cost"
+	LedgerAccountFxResult          = "fx_result"
+	LedgerAccountAdjustments       = "adjustments"
+	LedgerAccountMemo              = "memo"
+	LedgerAccountMemoContra        = "memo_contra"
+
+	LedgerEntryTypeClearingSettlement = "clearing_settlement"
+)
+
+// LedgerEntry is a line of the double-entry journal. Every accounting entry is booked as two lines with the same
+// amount on the debit and on the credit account, lines of accounting entries saved together share the journal.
+// Settlement of the customer clearing account of the source document isn't an accounting entry and is booked
+// as lines with the clearing settlement type and without the accounting entry.
+type LedgerEntry struct {
+	Id                 string    `bson:"_id" json:"id"`
+	JournalId          string    `bson:"journal_id" json:"journal_id"`
+	AccountingEntryId  string    `bson:"accounting_entry_id" json:"accounting_entry_id"`
+	EntryType          string    `bson:"entry_type" json:"entry_type"`
+	Account            string    `bson:"account" json:"account"`
+	Debit              float64   `bson:"debit" json:"debit"`
+	Credit             float64   `bson:"credit" json:"credit"`
+	Currency           string    `bson:"currency" json:"currency"`
+	OperatingCompanyId string    `bson:"operating_company_id" json:"operating_company_id"`
+	MerchantId         string    `bson:"merchant_id" json:"merchant_id"`
+	SourceId           string    `bson:"source_id" json:"source_id"`
+	SourceType         string    `bson:"source_type" json:"source_type"`
+	Date               time.Time `bson:"date" json:"date"`
+	CreatedAt          time.Time `bson:"created_at" json:"created_at"`
+}
+
+// LedgerEntryFilter is a filter of journal lines, lines are filtered by the account if it's specified and by
+// the date from inclusive to exclusive, zero dates don't limit the period.
+type LedgerEntryFilter struct {
+	OperatingCompanyId string
+	Currency           string
+	Account            string
+	From               time.Time
+	To                 time.Time
+}
+
+// LedgerAccountTurnover is a sum of debit and credit of the account lines.
+type LedgerAccountTurnover struct {
+	Account string  `bson:"_id" json:"account"`
+	Debit   float64 `bson:"debit" json:"debit"`
+	Credit  float64 `bson:"credit" json:"credit"`
+}
+
+// TrialBalanceRequest is a request of trial balance for the period, dates are unix timestamps
+// and both are inclusive.
+type TrialBalanceRequest struct {
+	OperatingCompanyId string `json:"operating_company_id"`
+	Currency           string `json:"currency"`
+	From               int64  `json:"from"`
+	To                 int64  `json:"to"`
+}
+
+// TrialBalanceAccount is a row of trial balance, balances are debit minus credit.
+type TrialBalanceAccount struct {
+	Account        string  `json:"account"`
+	OpeningBalance float64 `json:"opening_balance"`
+	Debit          float64 `json:"debit"`
+	Credit         float64 `json:"credit"`
+	ClosingBalance float64 `json:"closing_balance"`
+}
+
+type TrialBalance struct {
+	OperatingCompanyId string                 `json:"operating_company_id"`
+	Currency           string                 `json:"currency"`
+	From               time.Time              `json:"from"`
+	To                 time.Time              `json:"to"`
+	Accounts           []*TrialBalanceAccount `json:"accounts"`
+	TotalDebit         float64                `json:"total_debit"`
+	TotalCredit        float64                `json:"total_credit"`
+	IsBalanced         bool                   `json:"is_balanced"`
+}
+
+type TrialBalanceResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Item    *TrialBalance                   `json:"item"`
+}
+
+// AccountLedgerRequest is a request of lines of the account for the period, dates are unix timestamps
+// and both are inclusive.
+type AccountLedgerRequest struct {
+	OperatingCompanyId string `json:"operating_company_id"`
+	Currency           string `json:"currency"`
+	Account            string `json:"account"`
+	From               int64  `json:"from"`
+	To                 int64  `json:"to"`
+	Limit              int64  `json:"limit"`
+	Offset             int64  `json:"offset"`
+}
+
+type AccountLedger struct {
+	Account        string         `json:"account"`
+	OpeningBalance float64        `json:"opening_balance"`
+	Debit          float64        `json:"debit"`
+	Credit         float64        `json:"credit"`
+	ClosingBalance float64        `json:"closing_balance"`
+	Count          int64          `json:"count"`
+	Items          []*LedgerEntry `json:"items"`
+}
+
+type AccountLedgerResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Item    *AccountLedger                  `json:"item"`
+}
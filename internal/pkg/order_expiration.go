@@ -0,0 +1,56 @@
+package pkg
+
+import (
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"time"
+)
+
+// ProjectOrderLifetime overrides lifetime of orders of the project. Lifetime is in seconds.
+type ProjectOrderLifetime struct {
+	ProjectId string    `bson:"_id" json:"project_id"`
+	Lifetime  int64     `bson:"lifetime" json:"lifetime"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// ProjectOrderLifetimeRequest is a request to get or set lifetime of orders of the project.
+// Lifetime is used by set only, zero lifetime resets lifetime to the default value.
+type ProjectOrderLifetimeRequest struct {
+	ProjectId string `json:"project_id"`
+	Lifetime  int64  `json:"lifetime"`
+}
+
+type ProjectOrderLifetimeResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Item    *ProjectOrderLifetime           `json:"item"`
+}
+
+const (
+	VirtualCurrencyHoldStatusHeld     = "held"
+	VirtualCurrencyHoldStatusReleased = "released"
+	VirtualCurrencyHoldStatusCaptured = "captured"
+)
+
+// VirtualCurrencyHold is amount of virtual currency of the project held by not paid order of customer.
+// Hold is released when order is canceled or rejected (expired orders too) and captured when order is processed.
+type VirtualCurrencyHold struct {
+	// OrderId is the unique identifier of order, only one hold may be created for order.
+	OrderId   string    `bson:"_id" json:"order_id"`
+	ProjectId string    `bson:"project_id" json:"project_id"`
+	UserId    string    `bson:"user_id" json:"user_id"`
+	Amount    float64   `bson:"amount" json:"amount"`
+	Status    string    `bson:"status" json:"status"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// NotPaidOrderFilter selects orders which weren't paid and were created before the date. Orders are filtered
+// by the project if it's specified, orders of the excluded projects aren't selected. Orders are ordered
+// by identifier and only orders after AfterId are selected if it's specified.
+type NotPaidOrderFilter struct {
+	CreatedBefore     time.Time
+	ProjectId         string
+	ExcludeProjectIds []string
+	AfterId           string
+	Limit             int64
+}
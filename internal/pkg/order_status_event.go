@@ -0,0 +1,35 @@
+package pkg
+
+import (
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"time"
+)
+
+const (
+	OrderStatusEventCauseOrderUpdate        = "order_update"
+	OrderStatusEventCausePaymentCreate      = "payment_create"
+	OrderStatusEventCausePaymentCallback    = "payment_callback"
+	OrderStatusEventCausePaymentVoid        = "payment_void"
+	OrderStatusEventCauseRefundCallback     = "refund_callback"
+	OrderStatusEventCauseCountryRestriction = "country_restriction"
+	OrderStatusEventCauseItemReplaced       = "item_replaced"
+	OrderStatusEventCauseOrderExpiration    = "order_expiration"
+	OrderStatusEventCauseDispute            = "dispute"
+)
+
+// OrderStatusEvent is a transition of order private status with the cause of it.
+type OrderStatusEvent struct {
+	Id        string    `bson:"_id" json:"id"`
+	OrderId   string    `bson:"order_id" json:"order_id"`
+	OrderUuid string    `bson:"order_uuid" json:"order_uuid"`
+	From      int32     `bson:"from" json:"from"`
+	To        int32     `bson:"to" json:"to"`
+	Cause     string    `bson:"cause" json:"cause"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+type OrderStatusEventsResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Items   []*OrderStatusEvent             `json:"items"`
+}
@@ -0,0 +1,31 @@
+package pkg
+
+import (
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"time"
+)
+
+// PaymentCapture is a request to payment system to capture authorized payment of order. Charge amount of order
+// is the authorized amount and it's replaced by the captured amount only when payment system completes the payment.
+type PaymentCapture struct {
+	// OrderId is the unique identifier of order, only one capture may be requested for authorized payment.
+	OrderId          string    `bson:"_id" json:"order_id"`
+	AuthorizedAmount float64   `bson:"authorized_amount" json:"authorized_amount"`
+	CapturedAmount   float64   `bson:"captured_amount" json:"captured_amount"`
+	Currency         string    `bson:"currency" json:"currency"`
+	CreatedAt        time.Time `bson:"created_at" json:"created_at"`
+}
+
+// PaymentAuthorizationRequest is a request to capture or void authorized payment of order.
+// Amount is used by capture only, zero amount captures payment fully.
+type PaymentAuthorizationRequest struct {
+	OrderId string  `json:"order_id"`
+	Amount  float64 `json:"amount"`
+}
+
+type PaymentAuthorizationResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Item    *billingpb.Order                `json:"item"`
+	Capture *PaymentCapture                 `json:"capture,omitempty"`
+}
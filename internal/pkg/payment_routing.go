@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"time"
+)
+
+const (
+	PaymentRouteStrategyCost     = "cost"
+	PaymentRouteStrategyPriority = "priority"
+
+	PaymentRoutingAttemptStatusSuccess     = "success"
+	PaymentRoutingAttemptStatusDeclined    = "declined"
+	PaymentRoutingAttemptStatusFailed      = "failed"
+	PaymentRoutingAttemptStatusUnavailable = "unavailable"
+	PaymentRoutingAttemptStatusUnsupported = "unsupported"
+	PaymentRoutingAttemptStatusNoCosts     = "no_costs"
+	PaymentRoutingAttemptStatusNoSettings  = "no_settings"
+)
+
+// PaymentRoute is a ranked list of payment systems which can process payments by payment method
+// for specified payer region, charge currency and merchant risk level (mcc code).
+// Empty region, currency or mcc code means that route matches any value of the field.
+type PaymentRoute struct {
+	Id              string                   `bson:"_id" json:"id"`
+	PaymentMethodId string                   `bson:"payment_method_id" json:"payment_method_id"`
+	Region          string                   `bson:"region" json:"region"`
+	Currency        string                   `bson:"currency" json:"currency"`
+	MccCode         string                   `bson:"mcc_code" json:"mcc_code"`
+	Strategy        string                   `bson:"strategy" json:"strategy"`
+	Candidates      []*PaymentRouteCandidate `bson:"candidates" json:"candidates"`
+	IsActive        bool                     `bson:"is_active" json:"is_active"`
+	CreatedAt       time.Time                `bson:"created_at" json:"created_at"`
+	UpdatedAt       time.Time                `bson:"updated_at" json:"updated_at"`
+}
+
+// PaymentRouteCandidate is a payment system in the payment route.
+// CostMethodName overrides name of payment method used to search payment channel system costs,
+// it's required when the payment system has own tariffs for the payment method.
+// ProductionSettings and TestSettings are terminals of the payment system keyed like settings of the payment method,
+// settings of the payment method are used only for the payment system linked to the payment method.
+type PaymentRouteCandidate struct {
+	PaymentSystemId    string                                    `bson:"payment_system_id" json:"payment_system_id"`
+	Priority           int32                                     `bson:"priority" json:"priority"`
+	CostMethodName     string                                    `bson:"cost_method_name" json:"cost_method_name"`
+	ProductionSettings map[string]*billingpb.PaymentMethodParams `bson:"production_settings" json:"production_settings"`
+	TestSettings       map[string]*billingpb.PaymentMethodParams `bson:"test_settings" json:"test_settings"`
+}
+
+// OrderPaymentRouting is a log of routing decisions made for the order payment.
+type OrderPaymentRouting struct {
+	Id              string                   `bson:"_id" json:"id"`
+	OrderId         string                   `bson:"order_id" json:"order_id"`
+	OrderUuid       string                   `bson:"order_uuid" json:"order_uuid"`
+	RouteId         string                   `bson:"route_id" json:"route_id"`
+	Strategy        string                   `bson:"strategy" json:"strategy"`
+	PaymentSystemId string                   `bson:"payment_system_id" json:"payment_system_id"`
+	Handler         string                   `bson:"handler" json:"handler"`
+	Attempts        []*PaymentRoutingAttempt `bson:"attempts" json:"attempts"`
+	CreatedAt       time.Time                `bson:"created_at" json:"created_at"`
+}
+
+// PaymentRoutingAttempt is the result of the payment system evaluation or payment creation in it.
+type PaymentRoutingAttempt struct {
+	PaymentSystemId string    `bson:"payment_system_id" json:"payment_system_id"`
+	Handler         string    `bson:"handler" json:"handler"`
+	Cost            float64   `bson:"cost" json:"cost"`
+	CostCurrency    string    `bson:"cost_currency" json:"cost_currency"`
+	Status          string    `bson:"status" json:"status"`
+	Error           string    `bson:"error" json:"error"`
+	CreatedAt       time.Time `bson:"created_at" json:"created_at"`
+}
+
+type GetPaymentRoutesRequest struct {
+	PaymentMethodId string `json:"payment_method_id"`
+}
+
+type PaymentRouteRequest struct {
+	Id string `json:"id"`
+}
+
+type PaymentRouteResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Item    *PaymentRoute                   `json:"item"`
+}
+
+type GetPaymentRoutesResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Items   []*PaymentRoute                 `json:"items"`
+}
+
+type OrderPaymentRoutingResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Item    *OrderPaymentRouting            `json:"item"`
+}
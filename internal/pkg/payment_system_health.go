@@ -0,0 +1,38 @@
+package pkg
+
+import (
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"time"
+)
+
+const (
+	PaymentSystemCircuitStateClosed   = "closed"
+	PaymentSystemCircuitStateHalfOpen = "half_open"
+	PaymentSystemCircuitStateOpen     = "open"
+)
+
+// PaymentSystemHealth is a snapshot of the payment system handler health over the rolling window.
+// Error rate is calculated by requests to payment system API, decline rate by results of payments.
+type PaymentSystemHealth struct {
+	Handler      string    `json:"handler"`
+	State        string    `json:"state"`
+	Requests     int64     `json:"requests"`
+	Errors       int64     `json:"errors"`
+	Approvals    int64     `json:"approvals"`
+	Declines     int64     `json:"declines"`
+	ErrorRate    float64   `json:"error_rate"`
+	DeclineRate  float64   `json:"decline_rate"`
+	AvgLatencyMs int64     `json:"avg_latency_ms"`
+	MaxLatencyMs int64     `json:"max_latency_ms"`
+	OpenedAt     time.Time `json:"opened_at"`
+}
+
+type PaymentSystemHealthRequest struct {
+	Handler string `json:"handler"`
+}
+
+type GetPaymentSystemsHealthResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Items   []*PaymentSystemHealth          `json:"items"`
+}
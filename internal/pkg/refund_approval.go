@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"time"
+)
+
+const (
+	RefundApprovalStatusPending  = "pending"
+	RefundApprovalStatusApproved = "approved"
+	RefundApprovalStatusRejected = "rejected"
+
+	RefundApprovalReasonAmount     = "amount"
+	RefundApprovalReasonPaymentAge = "payment_age"
+)
+
+// RefundApprovalPolicy is a policy of merchant which refunds have to be approved by the second user before they're
+// sent to the payment system. Refund needs approval when its amount converted to the currency of policy exceeds
+// the threshold or when it's created more than the number of days after the payment. Empty values disable the rule.
+type RefundApprovalPolicy struct {
+	MerchantId       string    `bson:"_id" json:"merchant_id"`
+	AmountThreshold  float64   `bson:"amount_threshold" json:"amount_threshold"`
+	Currency         string    `bson:"currency" json:"currency"`
+	DaysAfterPayment int32     `bson:"days_after_payment" json:"days_after_payment"`
+	UpdatedAt        time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+type RefundApprovalPolicyRequest struct {
+	MerchantId string `json:"merchant_id"`
+}
+
+type RefundApprovalPolicyResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Item    *RefundApprovalPolicy           `json:"item"`
+}
+
+// RefundApproval is an approval of the refund held by the approval policy of merchant, Id is the identifier
+// of the refund. Reasons are the rules of policy matched by the refund, ApproverId is the user who approved
+// or rejected the refund.
+type RefundApproval struct {
+	Id         string     `bson:"_id" json:"id"`
+	OrderId    string     `bson:"order_id" json:"order_id"`
+	MerchantId string     `bson:"merchant_id" json:"merchant_id"`
+	Amount     float64    `bson:"amount" json:"amount"`
+	Currency   string     `bson:"currency" json:"currency"`
+	Status     string     `bson:"status" json:"status"`
+	Reasons    []string   `bson:"reasons" json:"reasons"`
+	CreatorId  string     `bson:"creator_id" json:"creator_id"`
+	ApproverId string     `bson:"approver_id" json:"approver_id"`
+	Comment    string     `bson:"comment" json:"comment"`
+	CreatedAt  time.Time  `bson:"created_at" json:"created_at"`
+	DecidedAt  *time.Time `bson:"decided_at" json:"decided_at"`
+}
+
+// ChangeRefundApprovalRequest is a decision of the user about refund waiting for approval.
+type ChangeRefundApprovalRequest struct {
+	RefundId   string `json:"refund_id"`
+	MerchantId string `json:"merchant_id"`
+	ApproverId string `json:"approver_id"`
+	Comment    string `json:"comment"`
+}
+
+type ChangeRefundApprovalResponse struct {
+	Status   int32                           `json:"status"`
+	Message  *billingpb.ResponseErrorMessage `json:"message"`
+	Item     *billingpb.Refund               `json:"item"`
+	Approval *RefundApproval                 `json:"approval"`
+}
+
+type ListRefundApprovalsRequest struct {
+	MerchantId string `json:"merchant_id"`
+	Status     string `json:"status"`
+	Limit      int64  `json:"limit"`
+	Offset     int64  `json:"offset"`
+}
+
+type ListRefundApprovalsResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Count   int64                           `json:"count"`
+	Items   []*RefundApproval               `json:"items"`
+}
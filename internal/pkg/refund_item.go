@@ -0,0 +1,48 @@
+package pkg
+
+import (
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"time"
+)
+
+// RefundItems contains items of order refunded by the refund, Id is the identifier of the refund.
+type RefundItems struct {
+	Id        string               `bson:"_id" json:"id"`
+	OrderId   string               `bson:"order_id" json:"order_id"`
+	Items     []*RefundedOrderItem `bson:"items" json:"items"`
+	CreatedAt time.Time            `bson:"created_at" json:"created_at"`
+}
+
+// RefundedOrderItem is the order item refunded by the refund. Index is a position of item in the order items,
+// order can contain the same item several times. Amount is the part of refund amount for the item in currency
+// of the refund. KeyId is the key of key product revoked by the refund.
+type RefundedOrderItem struct {
+	Index    int32   `bson:"index" json:"index"`
+	ItemId   string  `bson:"item_id" json:"item_id"`
+	Name     string  `bson:"name" json:"name"`
+	Amount   float64 `bson:"amount" json:"amount"`
+	Currency string  `bson:"currency" json:"currency"`
+	KeyId    string  `bson:"key_id" json:"key_id"`
+}
+
+// RefundItemRequest is a number of order items with the identifier to refund.
+type RefundItemRequest struct {
+	ItemId   string `json:"item_id"`
+	Quantity int32  `json:"quantity"`
+}
+
+// CreateItemsRefundRequest refunds the items of order, amount of refund is calculated by the prices of items.
+type CreateItemsRefundRequest struct {
+	OrderId    string               `json:"order_id"`
+	MerchantId string               `json:"merchant_id"`
+	CreatorId  string               `json:"creator_id"`
+	Reason     string               `json:"reason"`
+	Items      []*RefundItemRequest `json:"items"`
+}
+
+type CreateItemsRefundResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Item    *billingpb.Refund               `json:"item"`
+	Items   []*RefundedOrderItem            `json:"items"`
+}
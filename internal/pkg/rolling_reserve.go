@@ -0,0 +1,51 @@
+package pkg
+
+import (
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"time"
+)
+
+// RollingReserveTerms are terms of rolling reserve of merchant. Percentage of gross revenue of each payment
+// is held in payout currency of merchant until the total held amount reaches the cap, empty cap doesn't limit it.
+// Reserves are released automatically when the number of hold days passes, empty hold days disable the release.
+type RollingReserveTerms struct {
+	MerchantId string    `bson:"_id" json:"merchant_id"`
+	Percentage float64   `bson:"percentage" json:"percentage"`
+	HoldDays   int32     `bson:"hold_days" json:"hold_days"`
+	Cap        float64   `bson:"cap" json:"cap"`
+	UpdatedAt  time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+type RollingReserveTermsRequest struct {
+	MerchantId string `json:"merchant_id"`
+}
+
+type RollingReserveTermsResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Item    *RollingReserveTerms            `json:"item"`
+}
+
+// RollingReserveAmountsRequest requests amounts of rolling reserve of merchant on the date, date is unix timestamp,
+// now if it's empty.
+type RollingReserveAmountsRequest struct {
+	MerchantId string `json:"merchant_id"`
+	Date       int64  `json:"date"`
+}
+
+// RollingReserveAmounts are amounts of rolling reserve of merchant on the date. Held is the reserved amount which
+// isn't released yet, releasable is its part which hold period is over and pending is the rest.
+type RollingReserveAmounts struct {
+	MerchantId string    `json:"merchant_id"`
+	Currency   string    `json:"currency"`
+	Date       time.Time `json:"date"`
+	Held       float64   `json:"held"`
+	Releasable float64   `json:"releasable"`
+	Pending    float64   `json:"pending"`
+}
+
+type RollingReserveAmountsResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Item    *RollingReserveAmounts          `json:"item"`
+}
@@ -0,0 +1,42 @@
+package pkg
+
+import (
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"time"
+)
+
+// SavedPaymentMethod is a card of customer saved in the recurring repository with the settings of customer for it.
+// Card data is synchronized with the recurring repository, identifier is the identifier of saved card in it.
+type SavedPaymentMethod struct {
+	Id                   string     `bson:"_id" json:"id"`
+	Token                string     `bson:"token" json:"-"`
+	ProjectId            string     `bson:"project_id" json:"project_id"`
+	Email                string     `bson:"email" json:"-"`
+	Name                 string     `bson:"name" json:"name"`
+	MaskedPan            string     `bson:"masked_pan" json:"masked_pan"`
+	CardHolder           string     `bson:"card_holder" json:"card_holder"`
+	Brand                string     `bson:"brand" json:"brand"`
+	ExpireMonth          string     `bson:"expire_month" json:"expire_month"`
+	ExpireYear           string     `bson:"expire_year" json:"expire_year"`
+	IsDefault            bool       `bson:"is_default" json:"is_default"`
+	LastUsedAt           *time.Time `bson:"last_used_at" json:"last_used_at"`
+	ExpirationNotifiedAt *time.Time `bson:"expiration_notified_at" json:"-"`
+	CreatedAt            time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt            time.Time  `bson:"updated_at" json:"updated_at"`
+}
+
+// SavedPaymentMethodsRequest is a request of customer to manage saved cards. Customer is identified
+// by the browser cookie or by the customer token if cookie isn't set. Id is used by set default and rename only,
+// Name is used by rename only.
+type SavedPaymentMethodsRequest struct {
+	Cookie string `json:"cookie"`
+	Token  string `json:"token"`
+	Id     string `json:"id"`
+	Name   string `json:"name"`
+}
+
+type SavedPaymentMethodsResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Items   []*SavedPaymentMethod           `json:"items"`
+}
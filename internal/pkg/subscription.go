@@ -0,0 +1,134 @@
+package pkg
+
+import (
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"time"
+)
+
+const (
+	SubscriptionIntervalDay   = "day"
+	SubscriptionIntervalWeek  = "week"
+	SubscriptionIntervalMonth = "month"
+	SubscriptionIntervalYear  = "year"
+
+	SubscriptionStatusIncomplete = "incomplete"
+	SubscriptionStatusTrial      = "trial"
+	SubscriptionStatusActive     = "active"
+	SubscriptionStatusPastDue    = "past_due"
+	SubscriptionStatusPaused     = "paused"
+	SubscriptionStatusCanceled   = "canceled"
+
+	SubscriptionPaymentInitial   = "initial"
+	SubscriptionPaymentRenewal   = "renewal"
+	SubscriptionPaymentProration = "proration"
+)
+
+// SubscriptionPlan is a plan of recurring payments of the project. Plan has price per price group,
+// the price is matched to the price group by region.
+type SubscriptionPlan struct {
+	Id            string                    `bson:"_id" json:"id"`
+	MerchantId    string                    `bson:"merchant_id" json:"merchant_id"`
+	ProjectId     string                    `bson:"project_id" json:"project_id"`
+	Name          string                    `bson:"name" json:"name"`
+	Prices        []*billingpb.ProductPrice `bson:"prices" json:"prices"`
+	Interval      string                    `bson:"interval" json:"interval"`
+	IntervalCount int32                     `bson:"interval_count" json:"interval_count"`
+	TrialDays     int32                     `bson:"trial_days" json:"trial_days"`
+	Proration     bool                      `bson:"proration" json:"proration"`
+	IsActive      bool                      `bson:"is_active" json:"is_active"`
+	CreatedAt     time.Time                 `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time                 `bson:"updated_at" json:"updated_at"`
+}
+
+// Subscription is a subscription of customer to the plan. Price of subscription is fixed in the currency
+// of customer price group when customer subscribes. Renewals are charged by the recurring identifier
+// of the card saved by the first payment or chosen by customer on subscription. Failed renewals are retried
+// by the dunning policy of the project. LastOrderId is the last order created for subscription,
+// LastProcessedOrderId is the last order which result of payment was applied to subscription.
+type Subscription struct {
+	Id                   string               `bson:"_id" json:"id"`
+	PlanId               string               `bson:"plan_id" json:"plan_id"`
+	MerchantId           string               `bson:"merchant_id" json:"merchant_id"`
+	ProjectId            string               `bson:"project_id" json:"project_id"`
+	User                 *billingpb.OrderUser `bson:"user" json:"user"`
+	Status               string               `bson:"status" json:"status"`
+	Amount               float64              `bson:"amount" json:"amount"`
+	Currency             string               `bson:"currency" json:"currency"`
+	Balance              float64              `bson:"balance" json:"balance"`
+	PaymentMethodId      string               `bson:"payment_method_id" json:"payment_method_id"`
+	Card                 *SubscriptionCard    `bson:"card" json:"card"`
+	CurrentPeriodStart   time.Time            `bson:"current_period_start" json:"current_period_start"`
+	CurrentPeriodEnd     time.Time            `bson:"current_period_end" json:"current_period_end"`
+	NextBillingAt        time.Time            `bson:"next_billing_at" json:"next_billing_at"`
+	TrialEnd             *time.Time           `bson:"trial_end" json:"trial_end"`
+	PendingOrderId       string               `bson:"pending_order_id" json:"pending_order_id"`
+	ClaimedAt            *time.Time           `bson:"claimed_at" json:"claimed_at"`
+	LastOrderId          string               `bson:"last_order_id" json:"last_order_id"`
+	LastProcessedOrderId string               `bson:"last_processed_order_id" json:"last_processed_order_id"`
+	LastChargeError      string               `bson:"last_charge_error" json:"last_charge_error"`
+	FailedAttempts       int32                `bson:"failed_attempts" json:"failed_attempts"`
+	RetryAt              time.Time            `bson:"retry_at" json:"retry_at"`
+	CancelAtPeriodEnd    bool                 `bson:"cancel_at_period_end" json:"cancel_at_period_end"`
+	PausedAt             *time.Time           `bson:"paused_at" json:"paused_at"`
+	StatusBeforePause    string               `bson:"status_before_pause" json:"status_before_pause"`
+	CanceledAt           *time.Time           `bson:"canceled_at" json:"canceled_at"`
+	CreatedAt            time.Time            `bson:"created_at" json:"created_at"`
+	UpdatedAt            time.Time            `bson:"updated_at" json:"updated_at"`
+}
+
+// SubscriptionCard is a saved card of customer which is charged for renewals of subscription.
+type SubscriptionCard struct {
+	MaskedPan   string `bson:"masked_pan" json:"masked_pan"`
+	CardHolder  string `bson:"card_holder" json:"card_holder"`
+	ExpireMonth string `bson:"expire_month" json:"expire_month"`
+	ExpireYear  string `bson:"expire_year" json:"expire_year"`
+	RecurringId string `bson:"recurring_id" json:"recurring_id"`
+}
+
+type SubscriptionPlanResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Item    *SubscriptionPlan               `json:"item"`
+}
+
+type ListSubscriptionPlansRequest struct {
+	ProjectId string `json:"project_id"`
+}
+
+type ListSubscriptionPlansResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Items   []*SubscriptionPlan             `json:"items"`
+}
+
+// CreateSubscriptionRequest is a request of customer to subscribe to the plan from the payment form.
+// Subscription without saved card is started by the first order which must be paid with saving of card,
+// identifier of the order is returned in response.
+type CreateSubscriptionRequest struct {
+	ProjectId    string               `json:"project_id"`
+	PlanId       string               `json:"plan_id"`
+	User         *billingpb.OrderUser `json:"user"`
+	StoredCardId string               `json:"stored_card_id"`
+}
+
+type CreateSubscriptionResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Item    *Subscription                   `json:"item"`
+	OrderId string                          `json:"order_id"`
+}
+
+// SubscriptionRequest is a request of merchant to get or change the subscription. AtPeriodEnd is used by cancel only,
+// PlanId is used by change of plan only.
+type SubscriptionRequest struct {
+	MerchantId     string `json:"merchant_id"`
+	SubscriptionId string `json:"subscription_id"`
+	PlanId         string `json:"plan_id"`
+	AtPeriodEnd    bool   `json:"at_period_end"`
+}
+
+type SubscriptionResponse struct {
+	Status  int32                           `json:"status"`
+	Message *billingpb.ResponseErrorMessage `json:"message"`
+	Item    *Subscription                   `json:"item"`
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+)
+
+type accountingCorrectionBatchRepository repository
+
+// NewAccountingCorrectionBatchRepository create and return an object for working with the accounting correction
+// batch repository. The returned object implements the AccountingCorrectionBatchRepositoryInterface interface.
+func NewAccountingCorrectionBatchRepository(db mongodb.SourceInterface) AccountingCorrectionBatchRepositoryInterface {
+	s := &accountingCorrectionBatchRepository{db: db}
+	return s
+}
+
+func (h *accountingCorrectionBatchRepository) Insert(
+	ctx context.Context,
+	batch *internalPkg.AccountingCorrectionBatch,
+) error {
+	_, err := h.db.Collection(CollectionAccountingCorrectionBatch).InsertOne(ctx, batch)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, CollectionAccountingCorrectionBatch),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationInsert),
+			zap.String(pkg.ErrorDatabaseFieldDocumentId, batch.Id),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *accountingCorrectionBatchRepository) Update(
+	ctx context.Context,
+	batch *internalPkg.AccountingCorrectionBatch,
+	status string,
+) error {
+	query := bson.M{"_id": batch.Id, "status": status}
+	res, err := h.db.Collection(CollectionAccountingCorrectionBatch).ReplaceOne(ctx, query, batch)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, CollectionAccountingCorrectionBatch),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpdate),
+			zap.String(pkg.ErrorDatabaseFieldDocumentId, batch.Id),
+		)
+		return err
+	}
+
+	if res.MatchedCount <= 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (h *accountingCorrectionBatchRepository) GetById(
+	ctx context.Context,
+	id string,
+) (*internalPkg.AccountingCorrectionBatch, error) {
+	var batch *internalPkg.AccountingCorrectionBatch
+
+	query := bson.M{"_id": id}
+	err := h.db.Collection(CollectionAccountingCorrectionBatch).FindOne(ctx, query).Decode(&batch)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return batch, nil
+}
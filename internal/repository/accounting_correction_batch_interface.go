@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+)
+
+const (
+	// CollectionAccountingCorrectionBatch is name of table for collection of batches of accounting corrections,
+	// it's also the type of source of entries booked by the batch.
+	CollectionAccountingCorrectionBatch = "accounting_correction_batch"
+)
+
+// AccountingCorrectionBatchRepositoryInterface is abstraction layer for working with batches of manual
+// accounting corrections and representation in database.
+type AccountingCorrectionBatchRepositoryInterface interface {
+	// Insert adds the batch to the collection.
+	Insert(context.Context, *internalPkg.AccountingCorrectionBatch) error
+
+	// Update updates the batch in the collection if the saved batch is still in the status from the second argument,
+	// otherwise mongo.ErrNoDocuments is returned.
+	Update(context.Context, *internalPkg.AccountingCorrectionBatch, string) error
+
+	// GetById returns the batch by unique identity.
+	GetById(context.Context, string) (*internalPkg.AccountingCorrectionBatch, error)
+}
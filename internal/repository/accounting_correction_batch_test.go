@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type AccountingCorrectionBatchTestSuite struct {
+	suite.Suite
+	db         mongodb.SourceInterface
+	repository AccountingCorrectionBatchRepositoryInterface
+	log        *zap.Logger
+}
+
+func Test_AccountingCorrectionBatch(t *testing.T) {
+	suite.Run(t, new(AccountingCorrectionBatchTestSuite))
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) SetupTest() {
+	_, err := config.NewConfig()
+	assert.NoError(suite.T(), err, "Config load failed")
+
+	suite.log, err = zap.NewProduction()
+	assert.NoError(suite.T(), err, "Logger initialization failed")
+
+	suite.db, err = mongodb.NewDatabase()
+	assert.NoError(suite.T(), err, "Database connection failed")
+
+	suite.repository = NewAccountingCorrectionBatchRepository(suite.db)
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) TearDownTest() {
+	if err := suite.db.Drop(); err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	if err := suite.db.Close(); err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) TestAccountingCorrectionBatch_NewAccountingCorrectionBatchRepository_Ok() {
+	repository := NewAccountingCorrectionBatchRepository(suite.db)
+	assert.IsType(suite.T(), &accountingCorrectionBatchRepository{}, repository)
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) TestAccountingCorrectionBatch_InsertUpdateGetById_Ok() {
+	batch := suite.getBatch()
+	err := suite.repository.Insert(context.TODO(), batch)
+	assert.NoError(suite.T(), err)
+
+	batch.Status = internalPkg.AccountingCorrectionBatchStatusApproved
+	batch.ApproverId = primitive.NewObjectID().Hex()
+	batch.EntryIds = []string{primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex()}
+	batch.Corrections[0].EntryId = batch.EntryIds[0]
+	batch.Corrections[1].EntryId = batch.EntryIds[1]
+	err = suite.repository.Update(context.TODO(), batch, internalPkg.AccountingCorrectionBatchStatusPending)
+	assert.NoError(suite.T(), err)
+
+	batch2, err := suite.repository.GetById(context.TODO(), batch.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.AccountingCorrectionBatchStatusApproved, batch2.Status)
+	assert.Equal(suite.T(), batch.ApproverId, batch2.ApproverId)
+	assert.Equal(suite.T(), batch.EntryIds, batch2.EntryIds)
+	assert.Len(suite.T(), batch2.Corrections, 2)
+	assert.Equal(suite.T(), batch.Corrections[1].Reference, batch2.Corrections[1].Reference)
+	assert.Equal(suite.T(), batch.Corrections[1].EntryId, batch2.Corrections[1].EntryId)
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) TestAccountingCorrectionBatch_Update_StatusChanged_Error() {
+	batch := suite.getBatch()
+	err := suite.repository.Insert(context.TODO(), batch)
+	assert.NoError(suite.T(), err)
+
+	batch.Status = internalPkg.AccountingCorrectionBatchStatusRejected
+	err = suite.repository.Update(context.TODO(), batch, internalPkg.AccountingCorrectionBatchStatusApproved)
+	assert.Equal(suite.T(), mongo.ErrNoDocuments, err)
+
+	batch2, err := suite.repository.GetById(context.TODO(), batch.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.AccountingCorrectionBatchStatusPending, batch2.Status)
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) TestAccountingCorrectionBatch_GetById_NotFound() {
+	_, err := suite.repository.GetById(context.TODO(), primitive.NewObjectID().Hex())
+	assert.Equal(suite.T(), mongo.ErrNoDocuments, err)
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) getBatch() *internalPkg.AccountingCorrectionBatch {
+	merchantId := primitive.NewObjectID().Hex()
+
+	return &internalPkg.AccountingCorrectionBatch{
+		Id:        primitive.NewObjectID().Hex(),
+		Status:    internalPkg.AccountingCorrectionBatchStatusPending,
+		Date:      time.Now().Unix(),
+		CreatorId: primitive.NewObjectID().Hex(),
+		Corrections: []*internalPkg.AccountingCorrection{
+			{
+				Line:       1,
+				MerchantId: merchantId,
+				Type:       "merchant_royalty_correction",
+				Currency:   "USD",
+				Amount:     10.5,
+				Reason:     "Goodwill adjustment",
+				Reference:  "GW-1",
+			},
+			{
+				Line:       2,
+				MerchantId: merchantId,
+				Type:       "merchant_royalty_correction",
+				Currency:   "USD",
+				Amount:     -2,
+				Reason:     "FX correction",
+				Reference:  "FX-1",
+			},
+		},
+		CreatedAt: time.Now(),
+	}
+}
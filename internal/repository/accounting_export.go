@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"time"
+)
+
+type accountingExportRepository repository
+
+// NewAccountingExportRepository create and return an object for working with the accounting export repository.
+// The returned object implements the AccountingExportRepositoryInterface interface.
+func NewAccountingExportRepository(db mongodb.SourceInterface) AccountingExportRepositoryInterface {
+	s := &accountingExportRepository{db: db}
+	return s
+}
+
+func (h *accountingExportRepository) Insert(ctx context.Context, export *internalPkg.AccountingExport) error {
+	_, err := h.db.Collection(collectionAccountingExport).InsertOne(ctx, export)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionAccountingExport),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationInsert),
+			zap.String(pkg.ErrorDatabaseFieldDocumentId, export.Id),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *accountingExportRepository) Update(ctx context.Context, export *internalPkg.AccountingExport) error {
+	_, err := h.db.Collection(collectionAccountingExport).ReplaceOne(ctx, bson.M{"_id": export.Id}, export)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionAccountingExport),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpdate),
+			zap.String(pkg.ErrorDatabaseFieldDocumentId, export.Id),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *accountingExportRepository) GetById(ctx context.Context, id string) (*internalPkg.AccountingExport, error) {
+	var export *internalPkg.AccountingExport
+
+	query := bson.M{"_id": id}
+	err := h.db.Collection(collectionAccountingExport).FindOne(ctx, query).Decode(&export)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+func (h *accountingExportRepository) ClaimPending(
+	ctx context.Context,
+	claimedAt, staleBefore time.Time,
+) (*internalPkg.AccountingExport, error) {
+	var export *internalPkg.AccountingExport
+
+	query := bson.M{
+		"$or": []bson.M{
+			{"status": internalPkg.AccountingExportStatusPending},
+			{
+				"status":     internalPkg.AccountingExportStatusProcessing,
+				"updated_at": bson.M{"$lt": staleBefore},
+			},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":     internalPkg.AccountingExportStatusProcessing,
+			"updated_at": claimedAt,
+		},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.M{"created_at": 1}).
+		SetReturnDocument(options.After)
+	err := h.db.Collection(collectionAccountingExport).FindOneAndUpdate(ctx, query, update, opts).Decode(&export)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionAccountingExport),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpdate),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return export, nil
+}
+
+func (h *accountingExportRepository) InsertChunk(ctx context.Context, chunk *internalPkg.AccountingExportChunk) error {
+	_, err := h.db.Collection(collectionAccountingExportChunk).InsertOne(ctx, chunk)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionAccountingExportChunk),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationInsert),
+			zap.String(pkg.ErrorDatabaseFieldDocumentId, chunk.Id),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *accountingExportRepository) DeleteChunks(ctx context.Context, exportId string) error {
+	query := bson.M{"export_id": exportId}
+	_, err := h.db.Collection(collectionAccountingExportChunk).DeleteMany(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionAccountingExportChunk),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *accountingExportRepository) GetChunks(
+	ctx context.Context,
+	exportId string,
+) ([]*internalPkg.AccountingExportChunk, error) {
+	var chunks []*internalPkg.AccountingExportChunk
+
+	query := bson.M{"export_id": exportId}
+	opts := options.Find().SetSort(bson.M{"number": 1})
+	cursor, err := h.db.Collection(collectionAccountingExportChunk).Find(ctx, query, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionAccountingExportChunk),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &chunks)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionAccountingExportChunk),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return chunks, nil
+}
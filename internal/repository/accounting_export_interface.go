@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"time"
+)
+
+const (
+	collectionAccountingExport      = "accounting_export"
+	collectionAccountingExportChunk = "accounting_export_chunk"
+)
+
+// AccountingExportRepositoryInterface is abstraction layer for working with jobs of accounting exports,
+// chunks of their files and representation in database.
+type AccountingExportRepositoryInterface interface {
+	// Insert adds the export to the collection.
+	Insert(context.Context, *internalPkg.AccountingExport) error
+
+	// Update updates the export in the collection.
+	Update(context.Context, *internalPkg.AccountingExport) error
+
+	// GetById returns the export by unique identity.
+	GetById(context.Context, string) (*internalPkg.AccountingExport, error)
+
+	// ClaimPending moves the oldest pending export to the processing status and returns it, nil is returned
+	// if there are no pending exports. Processing export updated before the second time is claimed again
+	// as its build was interrupted.
+	ClaimPending(context.Context, time.Time, time.Time) (*internalPkg.AccountingExport, error)
+
+	// InsertChunk adds the chunk of export file to the collection.
+	InsertChunk(context.Context, *internalPkg.AccountingExportChunk) error
+
+	// DeleteChunks removes all chunks of file of the export.
+	DeleteChunks(context.Context, string) error
+
+	// GetChunks returns chunks of file of the export ordered by number.
+	GetChunks(context.Context, string) ([]*internalPkg.AccountingExportChunk, error)
+}
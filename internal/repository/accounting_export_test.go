@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type AccountingExportTestSuite struct {
+	suite.Suite
+	db         mongodb.SourceInterface
+	repository AccountingExportRepositoryInterface
+	log        *zap.Logger
+}
+
+func Test_AccountingExport(t *testing.T) {
+	suite.Run(t, new(AccountingExportTestSuite))
+}
+
+func (suite *AccountingExportTestSuite) SetupTest() {
+	_, err := config.NewConfig()
+	assert.NoError(suite.T(), err, "Config load failed")
+
+	suite.log, err = zap.NewProduction()
+	assert.NoError(suite.T(), err, "Logger initialization failed")
+
+	suite.db, err = mongodb.NewDatabase()
+	assert.NoError(suite.T(), err, "Database connection failed")
+
+	suite.repository = NewAccountingExportRepository(suite.db)
+}
+
+func (suite *AccountingExportTestSuite) TearDownTest() {
+	if err := suite.db.Drop(); err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	if err := suite.db.Close(); err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *AccountingExportTestSuite) TestAccountingExport_NewAccountingExportRepository_Ok() {
+	repository := NewAccountingExportRepository(suite.db)
+	assert.IsType(suite.T(), &accountingExportRepository{}, repository)
+}
+
+func (suite *AccountingExportTestSuite) TestAccountingExport_InsertUpdateGetById_Ok() {
+	export := suite.getExport(internalPkg.AccountingExportStatusPending, time.Now())
+	err := suite.repository.Insert(context.TODO(), export)
+	assert.NoError(suite.T(), err)
+
+	export.Status = internalPkg.AccountingExportStatusCompleted
+	export.Checksum = "checksum"
+	export.Totals = []*internalPkg.AccountingExportTotal{{Currency: "USD", Entries: 2, Amount: 10}}
+	err = suite.repository.Update(context.TODO(), export)
+	assert.NoError(suite.T(), err)
+
+	export2, err := suite.repository.GetById(context.TODO(), export.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), export.OperatingCompanyId, export2.OperatingCompanyId)
+	assert.Equal(suite.T(), internalPkg.AccountingExportStatusCompleted, export2.Status)
+	assert.Equal(suite.T(), export.Checksum, export2.Checksum)
+	assert.Len(suite.T(), export2.Totals, 1)
+}
+
+func (suite *AccountingExportTestSuite) TestAccountingExport_GetById_NotFound() {
+	_, err := suite.repository.GetById(context.TODO(), primitive.NewObjectID().Hex())
+	assert.Equal(suite.T(), mongo.ErrNoDocuments, err)
+}
+
+func (suite *AccountingExportTestSuite) TestAccountingExport_ClaimPending_Ok() {
+	export1 := suite.getExport(internalPkg.AccountingExportStatusPending, time.Now())
+	export2 := suite.getExport(internalPkg.AccountingExportStatusPending, time.Now().Add(-time.Hour))
+	export3 := suite.getExport(internalPkg.AccountingExportStatusCompleted, time.Now().Add(-2*time.Hour))
+
+	for _, export := range []*internalPkg.AccountingExport{export1, export2, export3} {
+		assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), export))
+	}
+
+	export, err := suite.repository.ClaimPending(context.TODO(), time.Now(), time.Now().Add(-time.Hour))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), export2.Id, export.Id)
+	assert.Equal(suite.T(), internalPkg.AccountingExportStatusProcessing, export.Status)
+
+	export, err = suite.repository.ClaimPending(context.TODO(), time.Now(), time.Now().Add(-time.Hour))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), export1.Id, export.Id)
+
+	export, err = suite.repository.ClaimPending(context.TODO(), time.Now(), time.Now().Add(-time.Hour))
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), export)
+
+	export, err = suite.repository.GetById(context.TODO(), export2.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.AccountingExportStatusProcessing, export.Status)
+}
+
+func (suite *AccountingExportTestSuite) TestAccountingExport_ClaimPending_StaleClaimedAgain() {
+	export1 := suite.getExport(internalPkg.AccountingExportStatusProcessing, time.Now().Add(-3*time.Hour))
+	export1.UpdatedAt = time.Now().Add(-2 * time.Hour)
+	export2 := suite.getExport(internalPkg.AccountingExportStatusProcessing, time.Now().Add(-2*time.Hour))
+	export2.UpdatedAt = time.Now()
+
+	for _, export := range []*internalPkg.AccountingExport{export1, export2} {
+		assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), export))
+	}
+
+	claimedAt := time.Now()
+	export, err := suite.repository.ClaimPending(context.TODO(), claimedAt, claimedAt.Add(-time.Hour))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), export1.Id, export.Id)
+	assert.Equal(suite.T(), internalPkg.AccountingExportStatusProcessing, export.Status)
+	assert.WithinDuration(suite.T(), claimedAt, export.UpdatedAt, time.Second)
+
+	export, err = suite.repository.ClaimPending(context.TODO(), time.Now(), time.Now().Add(-time.Hour))
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), export)
+}
+
+func (suite *AccountingExportTestSuite) TestAccountingExport_InsertGetDeleteChunks_Ok() {
+	exportId := primitive.NewObjectID().Hex()
+
+	for _, number := range []int32{2, 1} {
+		chunk := &internalPkg.AccountingExportChunk{
+			Id:       primitive.NewObjectID().Hex(),
+			ExportId: exportId,
+			Number:   number,
+			Data:     []byte{byte(number)},
+		}
+		assert.NoError(suite.T(), suite.repository.InsertChunk(context.TODO(), chunk))
+	}
+
+	chunks, err := suite.repository.GetChunks(context.TODO(), exportId)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), chunks, 2)
+	assert.Equal(suite.T(), int32(1), chunks[0].Number)
+	assert.Equal(suite.T(), []byte{1}, chunks[0].Data)
+
+	err = suite.repository.DeleteChunks(context.TODO(), exportId)
+	assert.NoError(suite.T(), err)
+
+	chunks, err = suite.repository.GetChunks(context.TODO(), exportId)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), chunks)
+}
+
+func (suite *AccountingExportTestSuite) getExport(status string, createdAt time.Time) *internalPkg.AccountingExport {
+	return &internalPkg.AccountingExport{
+		Id:                 primitive.NewObjectID().Hex(),
+		OperatingCompanyId: primitive.NewObjectID().Hex(),
+		CreatorId:          primitive.NewObjectID().Hex(),
+		Format:             internalPkg.AccountingExportFormatCsv,
+		From:               createdAt.Add(-24 * time.Hour),
+		To:                 createdAt,
+		Status:             status,
+		SchemaVersion:      internalPkg.AccountingExportSchemaVersion,
+		CreatedAt:          createdAt,
+		UpdatedAt:          createdAt,
+	}
+}
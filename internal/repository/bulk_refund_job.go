@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"time"
+)
+
+type bulkRefundJobRepository repository
+
+// NewBulkRefundJobRepository create and return an object for working with the bulk refund job repository.
+// The returned object implements the BulkRefundJobRepositoryInterface interface.
+func NewBulkRefundJobRepository(db mongodb.SourceInterface) BulkRefundJobRepositoryInterface {
+	s := &bulkRefundJobRepository{db: db}
+	return s
+}
+
+func (h *bulkRefundJobRepository) Insert(ctx context.Context, job *internalPkg.BulkRefundJob) error {
+	_, err := h.db.Collection(collectionBulkRefundJob).InsertOne(ctx, job)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionBulkRefundJob),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationInsert),
+			zap.String(pkg.ErrorDatabaseFieldDocumentId, job.Id),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *bulkRefundJobRepository) ClaimRow(
+	ctx context.Context,
+	id string,
+	line int32,
+	claimedAt, staleBefore time.Time,
+) (bool, error) {
+	query := bson.M{
+		"_id": id,
+		"rows": bson.M{
+			"$elemMatch": bson.M{
+				"line": line,
+				"$or": bson.A{
+					bson.M{"status": internalPkg.BulkRefundRowStatusPending},
+					bson.M{
+						"status": internalPkg.BulkRefundRowStatusProcessing,
+						"$or": bson.A{
+							bson.M{"claimed_at": bson.M{"$lt": staleBefore}},
+							bson.M{"claimed_at": nil},
+						},
+					},
+				},
+			},
+		},
+	}
+	set := bson.M{
+		"$set": bson.M{
+			"rows.$.status":     internalPkg.BulkRefundRowStatusProcessing,
+			"rows.$.claimed_at": claimedAt,
+			"updated_at":        claimedAt,
+		},
+	}
+
+	return h.updateOne(ctx, query, set)
+}
+
+func (h *bulkRefundJobRepository) SetRowResult(ctx context.Context, id string, row *internalPkg.BulkRefundRow) error {
+	inc := bson.M{"failed": 1}
+
+	if row.Status == internalPkg.BulkRefundRowStatusSucceeded {
+		inc = bson.M{"succeeded": 1}
+	}
+
+	query := bson.M{
+		"_id": id,
+		"rows": bson.M{
+			"$elemMatch": bson.M{
+				"line":       row.Line,
+				"status":     internalPkg.BulkRefundRowStatusProcessing,
+				"claimed_at": row.ClaimedAt,
+			},
+		},
+	}
+	set := bson.M{
+		"$set": bson.M{
+			"rows.$":     row,
+			"updated_at": time.Now(),
+		},
+		"$inc": inc,
+	}
+	_, err := h.updateOne(ctx, query, set)
+
+	return err
+}
+
+func (h *bulkRefundJobRepository) Complete(ctx context.Context, id string, finishedAt time.Time) (bool, error) {
+	query := bson.M{
+		"_id":    id,
+		"status": internalPkg.BulkRefundJobStatusProcessing,
+		"$expr":  bson.M{"$eq": bson.A{bson.M{"$add": bson.A{"$succeeded", "$failed"}}, "$total"}},
+	}
+	set := bson.M{
+		"$set": bson.M{
+			"status":      internalPkg.BulkRefundJobStatusCompleted,
+			"finished_at": finishedAt,
+			"updated_at":  finishedAt,
+		},
+	}
+
+	return h.updateOne(ctx, query, set)
+}
+
+func (h *bulkRefundJobRepository) GetById(ctx context.Context, id string) (*internalPkg.BulkRefundJob, error) {
+	var job *internalPkg.BulkRefundJob
+
+	query := bson.M{"_id": id}
+	err := h.db.Collection(collectionBulkRefundJob).FindOne(ctx, query).Decode(&job)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (h *bulkRefundJobRepository) FindProcessing(ctx context.Context) ([]*internalPkg.BulkRefundJob, error) {
+	var jobs []*internalPkg.BulkRefundJob
+
+	query := bson.M{"status": internalPkg.BulkRefundJobStatusProcessing}
+	opts := options.Find().SetSort(bson.M{"created_at": 1})
+	cursor, err := h.db.Collection(collectionBulkRefundJob).Find(ctx, query, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionBulkRefundJob),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &jobs)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionBulkRefundJob),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+func (h *bulkRefundJobRepository) updateOne(ctx context.Context, query, set bson.M) (bool, error) {
+	res, err := h.db.Collection(collectionBulkRefundJob).UpdateOne(ctx, query, set)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionBulkRefundJob),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpdate),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+			zap.Any(pkg.ErrorDatabaseFieldSet, set),
+		)
+		return false, err
+	}
+
+	return res.MatchedCount > 0, nil
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"time"
+)
+
+const (
+	collectionBulkRefundJob = "bulk_refund_job"
+)
+
+// BulkRefundJobRepositoryInterface is abstraction layer for working with jobs of bulk refunds
+// and representation in database.
+type BulkRefundJobRepositoryInterface interface {
+	// Insert adds the job to the collection.
+	Insert(context.Context, *internalPkg.BulkRefundJob) error
+
+	// ClaimRow moves the pending row of the job with the line number to processing status with the claim time,
+	// so refund of the row is created only once. The row which is processing since the time before the last
+	// argument is claimed again. Returns false if the row can't be claimed or was claimed by other process.
+	ClaimRow(context.Context, string, int32, time.Time, time.Time) (bool, error)
+
+	// SetRowResult replaces the processing row of the job with the processed row and increments the number
+	// of succeeded or failed rows of the job by the status of the row. The row isn't replaced if it was claimed
+	// again after the claim time of the processed row.
+	SetRowResult(context.Context, string, *internalPkg.BulkRefundRow) error
+
+	// Complete moves the processing job which rows are all processed to completed status. Returns false if the job
+	// has not processed rows or was completed by other process.
+	Complete(context.Context, string, time.Time) (bool, error)
+
+	// GetById returns the job by unique identity.
+	GetById(context.Context, string) (*internalPkg.BulkRefundJob, error)
+
+	// FindProcessing returns jobs with not processed rows ordered from oldest to newest.
+	FindProcessing(context.Context) ([]*internalPkg.BulkRefundJob, error)
+}
@@ -0,0 +1,226 @@
+package repository
+
+import (
+	"context"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type BulkRefundJobTestSuite struct {
+	suite.Suite
+	db         mongodb.SourceInterface
+	repository BulkRefundJobRepositoryInterface
+	log        *zap.Logger
+}
+
+func Test_BulkRefundJob(t *testing.T) {
+	suite.Run(t, new(BulkRefundJobTestSuite))
+}
+
+func (suite *BulkRefundJobTestSuite) SetupTest() {
+	_, err := config.NewConfig()
+	assert.NoError(suite.T(), err, "Config load failed")
+
+	suite.log, err = zap.NewProduction()
+	assert.NoError(suite.T(), err, "Logger initialization failed")
+
+	suite.db, err = mongodb.NewDatabase()
+	assert.NoError(suite.T(), err, "Database connection failed")
+
+	suite.repository = NewBulkRefundJobRepository(suite.db)
+}
+
+func (suite *BulkRefundJobTestSuite) TearDownTest() {
+	if err := suite.db.Drop(); err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	if err := suite.db.Close(); err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *BulkRefundJobTestSuite) TestBulkRefundJob_NewBulkRefundJobRepository_Ok() {
+	repository := NewBulkRefundJobRepository(suite.db)
+	assert.IsType(suite.T(), &bulkRefundJobRepository{}, repository)
+}
+
+func (suite *BulkRefundJobTestSuite) TestBulkRefundJob_InsertGetById_Ok() {
+	job := suite.getJob(internalPkg.BulkRefundJobStatusProcessing, time.Now())
+	err := suite.repository.Insert(context.TODO(), job)
+	assert.NoError(suite.T(), err)
+
+	job2, err := suite.repository.GetById(context.TODO(), job.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), job.MerchantId, job2.MerchantId)
+	assert.Len(suite.T(), job2.Rows, 2)
+	assert.Equal(suite.T(), internalPkg.BulkRefundRowStatusPending, job2.Rows[0].Status)
+	assert.Equal(suite.T(), job.Rows[1].ErrorCode, job2.Rows[1].ErrorCode)
+	assert.Equal(suite.T(), int32(1), job2.Failed)
+}
+
+func (suite *BulkRefundJobTestSuite) TestBulkRefundJob_ClaimRow_Ok() {
+	job := suite.getJob(internalPkg.BulkRefundJobStatusProcessing, time.Now())
+	err := suite.repository.Insert(context.TODO(), job)
+	assert.NoError(suite.T(), err)
+
+	claimedAt := time.Now()
+	ok, err := suite.repository.ClaimRow(context.TODO(), job.Id, job.Rows[0].Line, claimedAt, claimedAt.Add(-time.Minute))
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	ok, err = suite.repository.ClaimRow(context.TODO(), job.Id, job.Rows[0].Line, time.Now(), claimedAt.Add(-time.Minute))
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+
+	ok, err = suite.repository.ClaimRow(context.TODO(), job.Id, job.Rows[1].Line, time.Now(), time.Now())
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+
+	job2, err := suite.repository.GetById(context.TODO(), job.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.BulkRefundRowStatusProcessing, job2.Rows[0].Status)
+	assert.NotNil(suite.T(), job2.Rows[0].ClaimedAt)
+	assert.Equal(suite.T(), claimedAt.Unix(), job2.Rows[0].ClaimedAt.Unix())
+	assert.Equal(suite.T(), internalPkg.BulkRefundRowStatusFailed, job2.Rows[1].Status)
+}
+
+func (suite *BulkRefundJobTestSuite) TestBulkRefundJob_ClaimRow_StaleClaimedAgain() {
+	job := suite.getJob(internalPkg.BulkRefundJobStatusProcessing, time.Now())
+	err := suite.repository.Insert(context.TODO(), job)
+	assert.NoError(suite.T(), err)
+
+	staleClaimedAt := time.Now().Add(-time.Hour)
+	ok, err := suite.repository.ClaimRow(context.TODO(), job.Id, job.Rows[0].Line, staleClaimedAt, staleClaimedAt)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	claimedAt := time.Now()
+	ok, err = suite.repository.ClaimRow(context.TODO(), job.Id, job.Rows[0].Line, claimedAt, claimedAt.Add(-time.Minute))
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	row := *job.Rows[0]
+	row.Status = internalPkg.BulkRefundRowStatusSucceeded
+	row.RefundId = primitive.NewObjectID().Hex()
+	row.ClaimedAt = &staleClaimedAt
+	err = suite.repository.SetRowResult(context.TODO(), job.Id, &row)
+	assert.NoError(suite.T(), err)
+
+	job2, err := suite.repository.GetById(context.TODO(), job.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.BulkRefundRowStatusProcessing, job2.Rows[0].Status)
+	assert.Empty(suite.T(), job2.Rows[0].RefundId)
+	assert.Zero(suite.T(), job2.Succeeded)
+
+	row.ClaimedAt = &claimedAt
+	err = suite.repository.SetRowResult(context.TODO(), job.Id, &row)
+	assert.NoError(suite.T(), err)
+
+	job2, err = suite.repository.GetById(context.TODO(), job.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.BulkRefundRowStatusSucceeded, job2.Rows[0].Status)
+	assert.Equal(suite.T(), int32(1), job2.Succeeded)
+}
+
+func (suite *BulkRefundJobTestSuite) TestBulkRefundJob_SetRowResult_Complete_Ok() {
+	job := suite.getJob(internalPkg.BulkRefundJobStatusProcessing, time.Now())
+	err := suite.repository.Insert(context.TODO(), job)
+	assert.NoError(suite.T(), err)
+
+	ok, err := suite.repository.Complete(context.TODO(), job.Id, time.Now())
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+
+	claimedAt := time.Now()
+	ok, err = suite.repository.ClaimRow(context.TODO(), job.Id, job.Rows[0].Line, claimedAt, claimedAt.Add(-time.Minute))
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	row := job.Rows[0]
+	row.ClaimedAt = &claimedAt
+	row.Status = internalPkg.BulkRefundRowStatusSucceeded
+	row.RefundId = primitive.NewObjectID().Hex()
+	err = suite.repository.SetRowResult(context.TODO(), job.Id, row)
+	assert.NoError(suite.T(), err)
+
+	err = suite.repository.SetRowResult(context.TODO(), job.Id, row)
+	assert.NoError(suite.T(), err)
+
+	job2, err := suite.repository.GetById(context.TODO(), job.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.BulkRefundRowStatusSucceeded, job2.Rows[0].Status)
+	assert.Equal(suite.T(), row.RefundId, job2.Rows[0].RefundId)
+	assert.Equal(suite.T(), job.Rows[1].ErrorCode, job2.Rows[1].ErrorCode)
+	assert.Equal(suite.T(), int32(1), job2.Succeeded)
+	assert.Equal(suite.T(), int32(1), job2.Failed)
+
+	ok, err = suite.repository.Complete(context.TODO(), job.Id, time.Now())
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	ok, err = suite.repository.Complete(context.TODO(), job.Id, time.Now())
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+
+	job2, err = suite.repository.GetById(context.TODO(), job.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.BulkRefundJobStatusCompleted, job2.Status)
+	assert.NotNil(suite.T(), job2.FinishedAt)
+}
+
+func (suite *BulkRefundJobTestSuite) TestBulkRefundJob_GetById_NotFound() {
+	_, err := suite.repository.GetById(context.TODO(), primitive.NewObjectID().Hex())
+	assert.Equal(suite.T(), mongo.ErrNoDocuments, err)
+}
+
+func (suite *BulkRefundJobTestSuite) TestBulkRefundJob_FindProcessing_Ok() {
+	last := suite.getJob(internalPkg.BulkRefundJobStatusProcessing, time.Now())
+	err := suite.repository.Insert(context.TODO(), last)
+	assert.NoError(suite.T(), err)
+
+	first := suite.getJob(internalPkg.BulkRefundJobStatusProcessing, time.Now().Add(-time.Hour))
+	err = suite.repository.Insert(context.TODO(), first)
+	assert.NoError(suite.T(), err)
+
+	err = suite.repository.Insert(context.TODO(), suite.getJob(internalPkg.BulkRefundJobStatusCompleted, time.Now()))
+	assert.NoError(suite.T(), err)
+
+	jobs, err := suite.repository.FindProcessing(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), jobs, 2)
+	assert.Equal(suite.T(), first.Id, jobs[0].Id)
+	assert.Equal(suite.T(), last.Id, jobs[1].Id)
+}
+
+func (suite *BulkRefundJobTestSuite) getJob(status string, createdAt time.Time) *internalPkg.BulkRefundJob {
+	return &internalPkg.BulkRefundJob{
+		Id:         primitive.NewObjectID().Hex(),
+		MerchantId: primitive.NewObjectID().Hex(),
+		CreatorId:  primitive.NewObjectID().Hex(),
+		Status:     status,
+		Rows: []*internalPkg.BulkRefundRow{
+			{Line: 2, OrderId: "a3c4b2e0-0c1e-4d52-8c35-4d3c1d4f4b6a", Status: internalPkg.BulkRefundRowStatusPending},
+			{
+				Line:         3,
+				OrderId:      "1001",
+				ProjectId:    primitive.NewObjectID().Hex(),
+				Status:       internalPkg.BulkRefundRowStatusFailed,
+				ErrorCode:    "rf000005",
+				ErrorMessage: "refund with specified data not found",
+			},
+		},
+		Total:     2,
+		Failed:    1,
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+	}
+}
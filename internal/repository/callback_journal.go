@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"time"
+)
+
+type callbackJournalRepository repository
+
+// NewCallbackJournalRepository create and return an object for working with the callback journal repository.
+// The returned object implements the CallbackJournalRepositoryInterface interface.
+func NewCallbackJournalRepository(db mongodb.SourceInterface) CallbackJournalRepositoryInterface {
+	s := &callbackJournalRepository{db: db}
+	return s
+}
+
+func (h *callbackJournalRepository) Insert(ctx context.Context, entry *internalPkg.CallbackJournalEntry) error {
+	_, err := h.db.Collection(collectionCallbackJournal).InsertOne(ctx, entry)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionCallbackJournal),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationInsert),
+			zap.String("callback_id", entry.Id),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *callbackJournalRepository) Update(ctx context.Context, entry *internalPkg.CallbackJournalEntry) error {
+	_, err := h.db.Collection(collectionCallbackJournal).ReplaceOne(ctx, bson.M{"_id": entry.Id}, entry)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionCallbackJournal),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpdate),
+			zap.String("callback_id", entry.Id),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *callbackJournalRepository) ClaimReplay(
+	ctx context.Context,
+	id string,
+	replayedAt time.Time,
+) (*internalPkg.CallbackJournalEntry, error) {
+	var entry *internalPkg.CallbackJournalEntry
+
+	query := bson.M{"_id": id, "status": internalPkg.CallbackJournalStatusFailed}
+	update := bson.M{
+		"$set": bson.M{
+			"status":      internalPkg.CallbackJournalStatusReplaying,
+			"replayed_at": replayedAt,
+			"updated_at":  replayedAt,
+		},
+		"$inc": bson.M{"replay_count": 1},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := h.db.Collection(collectionCallbackJournal).FindOneAndUpdate(ctx, query, update, opts).Decode(&entry)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionCallbackJournal),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpdate),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func (h *callbackJournalRepository) GetById(ctx context.Context, id string) (*internalPkg.CallbackJournalEntry, error) {
+	var entry *internalPkg.CallbackJournalEntry
+
+	query := bson.M{"_id": id}
+	err := h.db.Collection(collectionCallbackJournal).FindOne(ctx, query).Decode(&entry)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionCallbackJournal),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func (h *callbackJournalRepository) Find(
+	ctx context.Context,
+	req *internalPkg.ListCallbackJournalRequest,
+) ([]*internalPkg.CallbackJournalEntry, error) {
+	var entries []*internalPkg.CallbackJournalEntry
+
+	query := h.getFindQuery(req)
+	opts := options.Find().
+		SetSort(bson.M{"created_at": -1}).
+		SetLimit(req.Limit).
+		SetSkip(req.Offset)
+	cursor, err := h.db.Collection(collectionCallbackJournal).Find(ctx, query, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionCallbackJournal),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &entries)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionCallbackJournal),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (h *callbackJournalRepository) FindCount(
+	ctx context.Context,
+	req *internalPkg.ListCallbackJournalRequest,
+) (int64, error) {
+	query := h.getFindQuery(req)
+	count, err := h.db.Collection(collectionCallbackJournal).CountDocuments(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionCallbackJournal),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (h *callbackJournalRepository) getFindQuery(req *internalPkg.ListCallbackJournalRequest) bson.M {
+	query := bson.M{}
+
+	if req.Type != "" {
+		query["type"] = req.Type
+	}
+
+	if req.Status != "" {
+		query["status"] = req.Status
+	}
+
+	if req.Handler != "" {
+		query["handler"] = req.Handler
+	}
+
+	if req.OrderId != "" {
+		query["order_id"] = req.OrderId
+	}
+
+	return query
+}
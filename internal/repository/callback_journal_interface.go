@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"time"
+)
+
+const (
+	collectionCallbackJournal = "callback_journal"
+)
+
+// CallbackJournalRepositoryInterface is abstraction layer for working with journal of raw payment system callbacks
+// and representation in database.
+type CallbackJournalRepositoryInterface interface {
+	// Insert adds callback to the journal.
+	Insert(context.Context, *internalPkg.CallbackJournalEntry) error
+
+	// Update updates the callback in the journal.
+	Update(context.Context, *internalPkg.CallbackJournalEntry) error
+
+	// ClaimReplay moves failed callback to replaying status and increments number of its replays.
+	// Returns nil without error if callback isn't failed or was claimed for replay by other process.
+	ClaimReplay(context.Context, string, time.Time) (*internalPkg.CallbackJournalEntry, error)
+
+	// GetById returns the callback by unique identity.
+	GetById(context.Context, string) (*internalPkg.CallbackJournalEntry, error)
+
+	// Find returns a list of callbacks by the filter ordered from newest to oldest.
+	Find(context.Context, *internalPkg.ListCallbackJournalRequest) ([]*internalPkg.CallbackJournalEntry, error)
+
+	// FindCount returns the number of callbacks by the filter.
+	FindCount(context.Context, *internalPkg.ListCallbackJournalRequest) (int64, error)
+}
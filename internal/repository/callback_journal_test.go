@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type CallbackJournalTestSuite struct {
+	suite.Suite
+	db         mongodb.SourceInterface
+	repository CallbackJournalRepositoryInterface
+	log        *zap.Logger
+}
+
+func Test_CallbackJournal(t *testing.T) {
+	suite.Run(t, new(CallbackJournalTestSuite))
+}
+
+func (suite *CallbackJournalTestSuite) SetupTest() {
+	_, err := config.NewConfig()
+	assert.NoError(suite.T(), err, "Config load failed")
+
+	suite.log, err = zap.NewProduction()
+	assert.NoError(suite.T(), err, "Logger initialization failed")
+
+	suite.db, err = mongodb.NewDatabase()
+	assert.NoError(suite.T(), err, "Database connection failed")
+
+	suite.repository = NewCallbackJournalRepository(suite.db)
+}
+
+func (suite *CallbackJournalTestSuite) TearDownTest() {
+	if err := suite.db.Drop(); err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	if err := suite.db.Close(); err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *CallbackJournalTestSuite) TestCallbackJournal_NewCallbackJournalRepository_Ok() {
+	repository := NewCallbackJournalRepository(suite.db)
+	assert.IsType(suite.T(), &callbackJournalRepository{}, repository)
+}
+
+func (suite *CallbackJournalTestSuite) TestCallbackJournal_InsertUpdate_Ok() {
+	entry := suite.getEntry(internalPkg.CallbackJournalStatusProcessing, time.Now())
+	err := suite.repository.Insert(context.TODO(), entry)
+	assert.NoError(suite.T(), err)
+
+	entry.Status = internalPkg.CallbackJournalStatusFailed
+	entry.Error = "some error"
+	err = suite.repository.Update(context.TODO(), entry)
+	assert.NoError(suite.T(), err)
+
+	entry2, err := suite.repository.GetById(context.TODO(), entry.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), entry.Body, entry2.Body)
+	assert.Equal(suite.T(), entry.Signature, entry2.Signature)
+	assert.Equal(suite.T(), internalPkg.CallbackJournalStatusFailed, entry2.Status)
+	assert.Equal(suite.T(), "some error", entry2.Error)
+}
+
+func (suite *CallbackJournalTestSuite) TestCallbackJournal_ClaimReplay_Ok() {
+	entry := suite.getEntry(internalPkg.CallbackJournalStatusFailed, time.Now())
+	err := suite.repository.Insert(context.TODO(), entry)
+	assert.NoError(suite.T(), err)
+
+	entry2, err := suite.repository.ClaimReplay(context.TODO(), entry.Id, time.Now())
+	assert.NoError(suite.T(), err)
+	assert.NotNil(suite.T(), entry2)
+	assert.Equal(suite.T(), internalPkg.CallbackJournalStatusReplaying, entry2.Status)
+	assert.EqualValues(suite.T(), 1, entry2.ReplayCount)
+	assert.NotNil(suite.T(), entry2.ReplayedAt)
+
+	// callback which is replaying already can't be claimed again
+	entry2, err = suite.repository.ClaimReplay(context.TODO(), entry.Id, time.Now())
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), entry2)
+}
+
+func (suite *CallbackJournalTestSuite) TestCallbackJournal_GetById_NotFound() {
+	_, err := suite.repository.GetById(context.TODO(), primitive.NewObjectID().Hex())
+	assert.Equal(suite.T(), mongo.ErrNoDocuments, err)
+}
+
+func (suite *CallbackJournalTestSuite) TestCallbackJournal_Find_Ok() {
+	failed := suite.getEntry(internalPkg.CallbackJournalStatusFailed, time.Now().Add(-time.Hour))
+	failed2 := suite.getEntry(internalPkg.CallbackJournalStatusFailed, time.Now())
+	success := suite.getEntry(internalPkg.CallbackJournalStatusSuccess, time.Now())
+
+	for _, entry := range []*internalPkg.CallbackJournalEntry{failed, failed2, success} {
+		err := suite.repository.Insert(context.TODO(), entry)
+		assert.NoError(suite.T(), err)
+	}
+
+	req := &internalPkg.ListCallbackJournalRequest{Status: internalPkg.CallbackJournalStatusFailed, Limit: 10}
+	entries, err := suite.repository.Find(context.TODO(), req)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), entries, 2)
+	assert.Equal(suite.T(), failed2.Id, entries[0].Id)
+	assert.Equal(suite.T(), failed.Id, entries[1].Id)
+
+	count, err := suite.repository.FindCount(context.TODO(), req)
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), 2, count)
+
+	req = &internalPkg.ListCallbackJournalRequest{Status: internalPkg.CallbackJournalStatusFailed, Limit: 1, Offset: 1}
+	entries, err = suite.repository.Find(context.TODO(), req)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), entries, 1)
+	assert.Equal(suite.T(), failed.Id, entries[0].Id)
+}
+
+func (suite *CallbackJournalTestSuite) getEntry(status string, createdAt time.Time) *internalPkg.CallbackJournalEntry {
+	return &internalPkg.CallbackJournalEntry{
+		Id:        primitive.NewObjectID().Hex(),
+		Type:      internalPkg.CallbackJournalTypePayment,
+		Handler:   "cardpay",
+		Body:      []byte(`{"payment_data":{"id":"123"}}`),
+		Signature: "signature",
+		OrderId:   primitive.NewObjectID().Hex(),
+		Status:    status,
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+	}
+}
@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"time"
+)
+
+const (
+	mongoErrorCodeDuplicateKey = 11000
+)
+
+type callbackTransactionRepository repository
+
+// NewCallbackTransactionRepository create and return an object for working with the callback transaction repository.
+// The returned object implements the CallbackTransactionRepositoryInterface interface.
+func NewCallbackTransactionRepository(db mongodb.SourceInterface) CallbackTransactionRepositoryInterface {
+	s := &callbackTransactionRepository{db: db}
+	return s
+}
+
+func (h *callbackTransactionRepository) Claim(ctx context.Context, tx *internalPkg.CallbackTransaction) (bool, error) {
+	_, err := h.db.Collection(collectionCallbackTransaction).InsertOne(ctx, tx)
+
+	if err != nil {
+		if isDuplicateKeyError(err) {
+			return false, nil
+		}
+
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionCallbackTransaction),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationInsert),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, tx),
+		)
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (h *callbackTransactionRepository) Reclaim(
+	ctx context.Context,
+	tx *internalPkg.CallbackTransaction,
+	before time.Time,
+) (bool, error) {
+	query := bson.M{
+		"_id":        tx.Id,
+		"state":      internalPkg.CallbackTransactionStateProcessing,
+		"updated_at": bson.M{"$lt": before},
+	}
+	res, err := h.db.Collection(collectionCallbackTransaction).ReplaceOne(ctx, query, tx)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionCallbackTransaction),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpdate),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return false, err
+	}
+
+	return res.ModifiedCount > 0, nil
+}
+
+func (h *callbackTransactionRepository) Update(ctx context.Context, tx *internalPkg.CallbackTransaction) error {
+	_, err := h.db.Collection(collectionCallbackTransaction).ReplaceOne(ctx, bson.M{"_id": tx.Id}, tx)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionCallbackTransaction),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpdate),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, tx),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *callbackTransactionRepository) Delete(ctx context.Context, id string) error {
+	query := bson.M{"_id": id}
+	_, err := h.db.Collection(collectionCallbackTransaction).DeleteOne(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionCallbackTransaction),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *callbackTransactionRepository) GetById(ctx context.Context, id string) (*internalPkg.CallbackTransaction, error) {
+	var tx *internalPkg.CallbackTransaction
+
+	query := bson.M{"_id": id}
+	err := h.db.Collection(collectionCallbackTransaction).FindOne(ctx, query).Decode(&tx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+func (h *callbackTransactionRepository) FindByTransactionId(
+	ctx context.Context,
+	handler, callbackType, transactionId string,
+) ([]*internalPkg.CallbackTransaction, error) {
+	var txs []*internalPkg.CallbackTransaction
+
+	query := bson.M{
+		"handler":        handler,
+		"type":           callbackType,
+		"transaction_id": transactionId,
+	}
+	opts := options.Find().SetSort(bson.M{"created_at": 1})
+	cursor, err := h.db.Collection(collectionCallbackTransaction).Find(ctx, query, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionCallbackTransaction),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &txs)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionCallbackTransaction),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return txs, nil
+}
+
+func isDuplicateKeyError(err error) bool {
+	e, ok := err.(mongo.WriteException)
+
+	if !ok {
+		return false
+	}
+
+	for _, we := range e.WriteErrors {
+		if we.Code == mongoErrorCodeDuplicateKey {
+			return true
+		}
+	}
+
+	return false
+}
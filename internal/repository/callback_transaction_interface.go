@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"time"
+)
+
+const (
+	collectionCallbackTransaction = "callback_transaction"
+)
+
+// CallbackTransactionRepositoryInterface is abstraction layer for working with results of processing
+// of payment system notifications about transactions and representation in database.
+type CallbackTransactionRepositoryInterface interface {
+	// Claim adds callback transaction to the collection if it not exists yet.
+	// Returns false if callback transaction with the same identifier already exists.
+	Claim(context.Context, *internalPkg.CallbackTransaction) (bool, error)
+
+	// Reclaim replaces callback transaction which is still processing but wasn't updated after the specified time.
+	// Returns false if callback transaction was processed or updated by other process.
+	Reclaim(context.Context, *internalPkg.CallbackTransaction, time.Time) (bool, error)
+
+	// Update updates the callback transaction in the collection.
+	Update(context.Context, *internalPkg.CallbackTransaction) error
+
+	// Delete removes the callback transaction from the collection.
+	Delete(context.Context, string) error
+
+	// GetById returns the callback transaction by unique identity.
+	GetById(context.Context, string) (*internalPkg.CallbackTransaction, error)
+
+	// FindByTransactionId returns all callbacks of transaction in payment system by handler and type of callback.
+	FindByTransactionId(context.Context, string, string, string) ([]*internalPkg.CallbackTransaction, error)
+}
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type CallbackTransactionTestSuite struct {
+	suite.Suite
+	db         mongodb.SourceInterface
+	repository CallbackTransactionRepositoryInterface
+	log        *zap.Logger
+}
+
+func Test_CallbackTransaction(t *testing.T) {
+	suite.Run(t, new(CallbackTransactionTestSuite))
+}
+
+func (suite *CallbackTransactionTestSuite) SetupTest() {
+	_, err := config.NewConfig()
+	assert.NoError(suite.T(), err, "Config load failed")
+
+	suite.log, err = zap.NewProduction()
+	assert.NoError(suite.T(), err, "Logger initialization failed")
+
+	suite.db, err = mongodb.NewDatabase()
+	assert.NoError(suite.T(), err, "Database connection failed")
+
+	suite.repository = NewCallbackTransactionRepository(suite.db)
+}
+
+func (suite *CallbackTransactionTestSuite) TearDownTest() {
+	if err := suite.db.Drop(); err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	if err := suite.db.Close(); err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *CallbackTransactionTestSuite) TestCallbackTransaction_NewCallbackTransactionRepository_Ok() {
+	repository := NewCallbackTransactionRepository(suite.db)
+	assert.IsType(suite.T(), &callbackTransactionRepository{}, repository)
+}
+
+func (suite *CallbackTransactionTestSuite) TestCallbackTransaction_Claim_Ok() {
+	tx := suite.getCallbackTransaction("COMPLETED", time.Now())
+	ok, err := suite.repository.Claim(context.TODO(), tx)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	ok, err = suite.repository.Claim(context.TODO(), suite.getCallbackTransaction("COMPLETED", time.Now()))
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+
+	tx2, err := suite.repository.GetById(context.TODO(), tx.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), tx.State, tx2.State)
+	assert.Equal(suite.T(), tx.TransactionId, tx2.TransactionId)
+}
+
+func (suite *CallbackTransactionTestSuite) TestCallbackTransaction_Reclaim_Ok() {
+	tx := suite.getCallbackTransaction("COMPLETED", time.Now().Add(-time.Hour))
+	ok, err := suite.repository.Claim(context.TODO(), tx)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	tx2 := suite.getCallbackTransaction("COMPLETED", time.Now())
+	ok, err = suite.repository.Reclaim(context.TODO(), tx2, time.Now().Add(-2*time.Hour))
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+
+	ok, err = suite.repository.Reclaim(context.TODO(), tx2, time.Now().Add(-time.Minute))
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	tx2.State = internalPkg.CallbackTransactionStateProcessed
+	err = suite.repository.Update(context.TODO(), tx2)
+	assert.NoError(suite.T(), err)
+
+	// processed callback can't be reclaimed
+	ok, err = suite.repository.Reclaim(context.TODO(), tx2, time.Now().Add(time.Minute))
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+}
+
+func (suite *CallbackTransactionTestSuite) TestCallbackTransaction_Delete_Ok() {
+	tx := suite.getCallbackTransaction("COMPLETED", time.Now())
+	_, err := suite.repository.Claim(context.TODO(), tx)
+	assert.NoError(suite.T(), err)
+
+	err = suite.repository.Delete(context.TODO(), tx.Id)
+	assert.NoError(suite.T(), err)
+
+	_, err = suite.repository.GetById(context.TODO(), tx.Id)
+	assert.Equal(suite.T(), mongo.ErrNoDocuments, err)
+}
+
+func (suite *CallbackTransactionTestSuite) TestCallbackTransaction_FindByTransactionId_Ok() {
+	for _, status := range []string{"AUTHORIZED", "COMPLETED"} {
+		_, err := suite.repository.Claim(context.TODO(), suite.getCallbackTransaction(status, time.Now()))
+		assert.NoError(suite.T(), err)
+	}
+
+	txs, err := suite.repository.FindByTransactionId(context.TODO(), "cardpay", internalPkg.CallbackJournalTypePayment, "123456")
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), txs, 2)
+
+	txs, err = suite.repository.FindByTransactionId(context.TODO(), "cardpay", internalPkg.CallbackJournalTypeRefund, "123456")
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), txs)
+}
+
+func (suite *CallbackTransactionTestSuite) getCallbackTransaction(status string, updatedAt time.Time) *internalPkg.CallbackTransaction {
+	return &internalPkg.CallbackTransaction{
+		Id:            "cardpay:payment:123456:" + status,
+		Handler:       "cardpay",
+		Type:          internalPkg.CallbackJournalTypePayment,
+		TransactionId: "123456",
+		Status:        status,
+		State:         internalPkg.CallbackTransactionStateProcessing,
+		CreatedAt:     updatedAt,
+		UpdatedAt:     updatedAt,
+	}
+}
@@ -0,0 +1,257 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"time"
+)
+
+var disputeClosedStatuses = []string{internalPkg.DisputeStatusWon, internalPkg.DisputeStatusLost}
+
+type disputeRepository repository
+
+// NewDisputeRepository create and return an object for working with the dispute repository.
+// The returned object implements the DisputeRepositoryInterface interface.
+func NewDisputeRepository(db mongodb.SourceInterface) DisputeRepositoryInterface {
+	s := &disputeRepository{db: db}
+	return s
+}
+
+func (h *disputeRepository) Insert(ctx context.Context, dispute *internalPkg.Dispute) error {
+	_, err := h.db.Collection(collectionDispute).InsertOne(ctx, dispute)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionDispute),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationInsert),
+			zap.Any(pkg.ErrorDatabaseFieldDocument, dispute),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *disputeRepository) UpdateStatus(
+	ctx context.Context,
+	dispute *internalPkg.Dispute,
+	from string,
+) (bool, error) {
+	query := bson.M{
+		"_id":         dispute.Id,
+		"status":      from,
+		"refund_id":   dispute.RefundId,
+		"is_reversed": dispute.IsReversed,
+	}
+	set := bson.M{
+		"$set": bson.M{
+			"status":     dispute.Status,
+			"due_at":     dispute.DueAt,
+			"history":    dispute.History,
+			"updated_at": dispute.UpdatedAt,
+			"closed_at":  dispute.ClosedAt,
+		},
+	}
+
+	return h.updateOne(ctx, query, set)
+}
+
+func (h *disputeRepository) ClaimChargeback(
+	ctx context.Context,
+	dispute *internalPkg.Dispute,
+	refundId string,
+) (bool, error) {
+	query := bson.M{"_id": dispute.Id, "status": dispute.Status, "refund_id": ""}
+	set := bson.M{"$set": bson.M{"refund_id": refundId}}
+
+	return h.updateOne(ctx, query, set)
+}
+
+func (h *disputeRepository) ReleaseChargeback(ctx context.Context, id, refundId string) error {
+	query := bson.M{"_id": id, "refund_id": refundId}
+	set := bson.M{"$set": bson.M{"refund_id": ""}}
+	_, err := h.updateOne(ctx, query, set)
+
+	return err
+}
+
+func (h *disputeRepository) ClaimReversal(ctx context.Context, dispute *internalPkg.Dispute) (bool, error) {
+	query := bson.M{
+		"_id":         dispute.Id,
+		"status":      dispute.Status,
+		"refund_id":   dispute.RefundId,
+		"is_reversed": false,
+	}
+	set := bson.M{"$set": bson.M{"is_reversed": true}}
+
+	return h.updateOne(ctx, query, set)
+}
+
+func (h *disputeRepository) ReleaseReversal(ctx context.Context, id string) error {
+	query := bson.M{"_id": id, "is_reversed": true}
+	set := bson.M{"$set": bson.M{"is_reversed": false}}
+	_, err := h.updateOne(ctx, query, set)
+
+	return err
+}
+
+func (h *disputeRepository) AddEvidence(
+	ctx context.Context,
+	id string,
+	evidence *internalPkg.DisputeEvidence,
+	updatedAt time.Time,
+) (bool, error) {
+	query := bson.M{"_id": id, "status": bson.M{"$nin": disputeClosedStatuses}}
+	set := bson.M{
+		"$push": bson.M{"evidences": evidence},
+		"$set":  bson.M{"updated_at": updatedAt},
+	}
+
+	return h.updateOne(ctx, query, set)
+}
+
+func (h *disputeRepository) GetById(ctx context.Context, id string) (*internalPkg.Dispute, error) {
+	var dispute *internalPkg.Dispute
+
+	query := bson.M{"_id": id}
+	err := h.db.Collection(collectionDispute).FindOne(ctx, query).Decode(&dispute)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return dispute, nil
+}
+
+func (h *disputeRepository) GetActiveByOrderId(ctx context.Context, orderId string) (*internalPkg.Dispute, error) {
+	var dispute *internalPkg.Dispute
+
+	query := bson.M{"order_id": orderId, "status": bson.M{"$nin": disputeClosedStatuses}}
+	err := h.db.Collection(collectionDispute).FindOne(ctx, query).Decode(&dispute)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return dispute, nil
+}
+
+func (h *disputeRepository) Find(
+	ctx context.Context,
+	req *internalPkg.ListDisputesRequest,
+) ([]*internalPkg.Dispute, error) {
+	query := h.getFindQuery(req)
+	opts := options.Find().
+		SetSort(bson.M{"created_at": -1}).
+		SetLimit(req.Limit).
+		SetSkip(req.Offset)
+
+	return h.find(ctx, query, opts)
+}
+
+func (h *disputeRepository) FindCount(ctx context.Context, req *internalPkg.ListDisputesRequest) (int64, error) {
+	query := h.getFindQuery(req)
+	count, err := h.db.Collection(collectionDispute).CountDocuments(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionDispute),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (h *disputeRepository) FindOverdue(ctx context.Context, at time.Time) ([]*internalPkg.Dispute, error) {
+	query := bson.M{
+		"status": bson.M{"$nin": disputeClosedStatuses},
+		"due_at": bson.M{"$ne": nil, "$lt": at},
+	}
+
+	return h.find(ctx, query, options.Find().SetSort(bson.M{"due_at": 1}))
+}
+
+func (h *disputeRepository) find(
+	ctx context.Context,
+	query bson.M,
+	opts *options.FindOptions,
+) ([]*internalPkg.Dispute, error) {
+	var disputes []*internalPkg.Dispute
+
+	cursor, err := h.db.Collection(collectionDispute).Find(ctx, query, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionDispute),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &disputes)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionDispute),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return disputes, nil
+}
+
+func (h *disputeRepository) getFindQuery(req *internalPkg.ListDisputesRequest) bson.M {
+	query := bson.M{}
+
+	if req.MerchantId != "" {
+		query["merchant_id"] = req.MerchantId
+	}
+
+	if req.OrderId != "" {
+		query["order_id"] = req.OrderId
+	}
+
+	if req.Status != "" {
+		query["status"] = req.Status
+	}
+
+	if req.DueBefore > 0 {
+		query["due_at"] = bson.M{"$lt": time.Unix(req.DueBefore, 0)}
+	}
+
+	return query
+}
+
+func (h *disputeRepository) updateOne(ctx context.Context, query, set bson.M) (bool, error) {
+	res, err := h.db.Collection(collectionDispute).UpdateOne(ctx, query, set)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionDispute),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpdate),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+			zap.Any(pkg.ErrorDatabaseFieldSet, set),
+		)
+		return false, err
+	}
+
+	return res.MatchedCount > 0, nil
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"time"
+)
+
+const (
+	collectionDispute = "dispute"
+)
+
+// DisputeRepositoryInterface is abstraction layer for working with disputes of orders and representation in database.
+type DisputeRepositoryInterface interface {
+	// Insert adds the dispute to the collection.
+	Insert(context.Context, *internalPkg.Dispute) error
+
+	// UpdateStatus sets status, response deadline, history and closing time of the dispute only if the dispute
+	// still has the status passed as the last argument and the chargeback and its reversal of the dispute.
+	// Returns false if dispute was changed concurrently.
+	UpdateStatus(context.Context, *internalPkg.Dispute, string) (bool, error)
+
+	// ClaimChargeback sets refund of chargeback of the dispute only if the dispute still has its status and
+	// chargeback wasn't claimed yet. Returns false if dispute was changed concurrently.
+	ClaimChargeback(context.Context, *internalPkg.Dispute, string) (bool, error)
+
+	// ReleaseChargeback removes the refund of chargeback claimed by the dispute when the refund wasn't created.
+	ReleaseChargeback(context.Context, string, string) error
+
+	// ClaimReversal marks chargeback of the dispute as reversed only if the dispute still has its status and
+	// chargeback and the chargeback wasn't reversed yet. Returns false if dispute was changed concurrently.
+	ClaimReversal(context.Context, *internalPkg.Dispute) (bool, error)
+
+	// ReleaseReversal marks chargeback of the dispute as not reversed when reversal failed.
+	ReleaseReversal(context.Context, string) error
+
+	// AddEvidence adds evidence to the open dispute. Returns false if dispute is closed.
+	AddEvidence(context.Context, string, *internalPkg.DisputeEvidence, time.Time) (bool, error)
+
+	// GetById returns the dispute by unique identity.
+	GetById(context.Context, string) (*internalPkg.Dispute, error)
+
+	// GetActiveByOrderId returns the open dispute of the order.
+	GetActiveByOrderId(context.Context, string) (*internalPkg.Dispute, error)
+
+	// Find returns a list of disputes by the filter ordered from newest to oldest.
+	Find(context.Context, *internalPkg.ListDisputesRequest) ([]*internalPkg.Dispute, error)
+
+	// FindCount returns the number of disputes by the filter.
+	FindCount(context.Context, *internalPkg.ListDisputesRequest) (int64, error)
+
+	// FindOverdue returns open disputes with the response deadline before the time.
+	FindOverdue(context.Context, time.Time) ([]*internalPkg.Dispute, error)
+}
@@ -0,0 +1,271 @@
+package repository
+
+import (
+	"context"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type DisputeTestSuite struct {
+	suite.Suite
+	db         mongodb.SourceInterface
+	repository DisputeRepositoryInterface
+	log        *zap.Logger
+}
+
+func Test_Dispute(t *testing.T) {
+	suite.Run(t, new(DisputeTestSuite))
+}
+
+func (suite *DisputeTestSuite) SetupTest() {
+	_, err := config.NewConfig()
+	assert.NoError(suite.T(), err, "Config load failed")
+
+	suite.log, err = zap.NewProduction()
+	assert.NoError(suite.T(), err, "Logger initialization failed")
+
+	suite.db, err = mongodb.NewDatabase()
+	assert.NoError(suite.T(), err, "Database connection failed")
+
+	suite.repository = NewDisputeRepository(suite.db)
+}
+
+func (suite *DisputeTestSuite) TearDownTest() {
+	if err := suite.db.Drop(); err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	if err := suite.db.Close(); err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *DisputeTestSuite) TestDispute_NewDisputeRepository_Ok() {
+	repository := NewDisputeRepository(suite.db)
+	assert.IsType(suite.T(), &disputeRepository{}, repository)
+}
+
+func (suite *DisputeTestSuite) TestDispute_InsertGetById_Ok() {
+	dispute := suite.getDispute(primitive.NewObjectID().Hex(), internalPkg.DisputeStatusInquiry, time.Now())
+	err := suite.repository.Insert(context.TODO(), dispute)
+	assert.NoError(suite.T(), err)
+
+	dispute2, err := suite.repository.GetById(context.TODO(), dispute.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), dispute.Status, dispute2.Status)
+	assert.Equal(suite.T(), dispute.OrderId, dispute2.OrderId)
+}
+
+func (suite *DisputeTestSuite) TestDispute_UpdateStatus_Ok() {
+	dispute := suite.getDispute(primitive.NewObjectID().Hex(), internalPkg.DisputeStatusInquiry, time.Now())
+	err := suite.repository.Insert(context.TODO(), dispute)
+	assert.NoError(suite.T(), err)
+
+	dispute.Status = internalPkg.DisputeStatusWon
+	dispute.History = append(dispute.History, &internalPkg.DisputeEvent{
+		From:      internalPkg.DisputeStatusInquiry,
+		To:        internalPkg.DisputeStatusWon,
+		CreatedAt: time.Now(),
+	})
+	ok, err := suite.repository.UpdateStatus(context.TODO(), dispute, internalPkg.DisputeStatusInquiry)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	dispute2, err := suite.repository.GetById(context.TODO(), dispute.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.DisputeStatusWon, dispute2.Status)
+	assert.Len(suite.T(), dispute2.History, 1)
+
+	// status was already changed
+	dispute.Status = internalPkg.DisputeStatusLost
+	ok, err = suite.repository.UpdateStatus(context.TODO(), dispute, internalPkg.DisputeStatusInquiry)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+}
+
+func (suite *DisputeTestSuite) TestDispute_ClaimChargeback_Ok() {
+	dispute := suite.getDispute(primitive.NewObjectID().Hex(), internalPkg.DisputeStatusInquiry, time.Now())
+	err := suite.repository.Insert(context.TODO(), dispute)
+	assert.NoError(suite.T(), err)
+
+	refundId := primitive.NewObjectID().Hex()
+	ok, err := suite.repository.ClaimChargeback(context.TODO(), dispute, refundId)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	ok, err = suite.repository.ClaimChargeback(context.TODO(), dispute, primitive.NewObjectID().Hex())
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+
+	// status can't be changed by the copy of dispute without the claimed chargeback
+	dispute.Status = internalPkg.DisputeStatusWon
+	ok, err = suite.repository.UpdateStatus(context.TODO(), dispute, internalPkg.DisputeStatusInquiry)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+
+	err = suite.repository.ReleaseChargeback(context.TODO(), dispute.Id, refundId)
+	assert.NoError(suite.T(), err)
+
+	dispute2, err := suite.repository.GetById(context.TODO(), dispute.Id)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), dispute2.RefundId)
+}
+
+func (suite *DisputeTestSuite) TestDispute_ClaimReversal_Ok() {
+	dispute := suite.getDispute(primitive.NewObjectID().Hex(), internalPkg.DisputeStatusChargeback, time.Now())
+	dispute.RefundId = primitive.NewObjectID().Hex()
+	err := suite.repository.Insert(context.TODO(), dispute)
+	assert.NoError(suite.T(), err)
+
+	ok, err := suite.repository.ClaimReversal(context.TODO(), dispute)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	ok, err = suite.repository.ClaimReversal(context.TODO(), dispute)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+
+	err = suite.repository.ReleaseReversal(context.TODO(), dispute.Id)
+	assert.NoError(suite.T(), err)
+
+	dispute2, err := suite.repository.GetById(context.TODO(), dispute.Id)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), dispute2.IsReversed)
+}
+
+func (suite *DisputeTestSuite) TestDispute_AddEvidence_Ok() {
+	dispute := suite.getDispute(primitive.NewObjectID().Hex(), internalPkg.DisputeStatusInquiry, time.Now())
+	err := suite.repository.Insert(context.TODO(), dispute)
+	assert.NoError(suite.T(), err)
+
+	evidence := &internalPkg.DisputeEvidence{
+		Id:        primitive.NewObjectID().Hex(),
+		Name:      "receipt.pdf",
+		Url:       "https://cdn.unit.test/receipt.pdf",
+		CreatedAt: time.Now(),
+	}
+	ok, err := suite.repository.AddEvidence(context.TODO(), dispute.Id, evidence, time.Now())
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	dispute2, err := suite.repository.GetById(context.TODO(), dispute.Id)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), dispute2.Evidences, 1)
+	assert.Equal(suite.T(), "receipt.pdf", dispute2.Evidences[0].Name)
+
+	closed := suite.getDispute(primitive.NewObjectID().Hex(), internalPkg.DisputeStatusLost, time.Now())
+	err = suite.repository.Insert(context.TODO(), closed)
+	assert.NoError(suite.T(), err)
+
+	ok, err = suite.repository.AddEvidence(context.TODO(), closed.Id, evidence, time.Now())
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+}
+
+func (suite *DisputeTestSuite) TestDispute_GetById_NotFound() {
+	_, err := suite.repository.GetById(context.TODO(), primitive.NewObjectID().Hex())
+	assert.Equal(suite.T(), mongo.ErrNoDocuments, err)
+}
+
+func (suite *DisputeTestSuite) TestDispute_GetActiveByOrderId_Ok() {
+	orderId := primitive.NewObjectID().Hex()
+
+	closed := suite.getDispute(orderId, internalPkg.DisputeStatusLost, time.Now())
+	err := suite.repository.Insert(context.TODO(), closed)
+	assert.NoError(suite.T(), err)
+
+	_, err = suite.repository.GetActiveByOrderId(context.TODO(), orderId)
+	assert.Equal(suite.T(), mongo.ErrNoDocuments, err)
+
+	active := suite.getDispute(orderId, internalPkg.DisputeStatusChargeback, time.Now())
+	err = suite.repository.Insert(context.TODO(), active)
+	assert.NoError(suite.T(), err)
+
+	dispute, err := suite.repository.GetActiveByOrderId(context.TODO(), orderId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), active.Id, dispute.Id)
+}
+
+func (suite *DisputeTestSuite) TestDispute_FindFindCount_Ok() {
+	merchantId := primitive.NewObjectID().Hex()
+
+	old := suite.getDispute(primitive.NewObjectID().Hex(), internalPkg.DisputeStatusInquiry, time.Now().Add(-time.Hour))
+	old.MerchantId = merchantId
+	err := suite.repository.Insert(context.TODO(), old)
+	assert.NoError(suite.T(), err)
+
+	last := suite.getDispute(primitive.NewObjectID().Hex(), internalPkg.DisputeStatusWon, time.Now())
+	last.MerchantId = merchantId
+	err = suite.repository.Insert(context.TODO(), last)
+	assert.NoError(suite.T(), err)
+
+	other := suite.getDispute(primitive.NewObjectID().Hex(), internalPkg.DisputeStatusInquiry, time.Now())
+	err = suite.repository.Insert(context.TODO(), other)
+	assert.NoError(suite.T(), err)
+
+	req := &internalPkg.ListDisputesRequest{MerchantId: merchantId, Limit: 10}
+	count, err := suite.repository.FindCount(context.TODO(), req)
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), 2, count)
+
+	list, err := suite.repository.Find(context.TODO(), req)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), list, 2)
+	assert.Equal(suite.T(), last.Id, list[0].Id)
+	assert.Equal(suite.T(), old.Id, list[1].Id)
+
+	req.Status = internalPkg.DisputeStatusInquiry
+	list, err = suite.repository.Find(context.TODO(), req)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), list, 1)
+	assert.Equal(suite.T(), old.Id, list[0].Id)
+}
+
+func (suite *DisputeTestSuite) TestDispute_FindOverdue_Ok() {
+	overdue := suite.getDispute(primitive.NewObjectID().Hex(), internalPkg.DisputeStatusInquiry, time.Now())
+	dueAt := time.Now().Add(-time.Hour)
+	overdue.DueAt = &dueAt
+	err := suite.repository.Insert(context.TODO(), overdue)
+	assert.NoError(suite.T(), err)
+
+	closed := suite.getDispute(primitive.NewObjectID().Hex(), internalPkg.DisputeStatusWon, time.Now())
+	closed.DueAt = &dueAt
+	err = suite.repository.Insert(context.TODO(), closed)
+	assert.NoError(suite.T(), err)
+
+	active := suite.getDispute(primitive.NewObjectID().Hex(), internalPkg.DisputeStatusChargeback, time.Now())
+	dueAt2 := time.Now().Add(time.Hour)
+	active.DueAt = &dueAt2
+	err = suite.repository.Insert(context.TODO(), active)
+	assert.NoError(suite.T(), err)
+
+	list, err := suite.repository.FindOverdue(context.TODO(), time.Now())
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), list, 1)
+	assert.Equal(suite.T(), overdue.Id, list[0].Id)
+}
+
+func (suite *DisputeTestSuite) getDispute(orderId, status string, createdAt time.Time) *internalPkg.Dispute {
+	return &internalPkg.Dispute{
+		Id:         primitive.NewObjectID().Hex(),
+		OrderId:    orderId,
+		OrderUuid:  primitive.NewObjectID().Hex(),
+		MerchantId: primitive.NewObjectID().Hex(),
+		ProjectId:  primitive.NewObjectID().Hex(),
+		Amount:     100,
+		Currency:   "RUB",
+		Status:     status,
+		Evidences:  []*internalPkg.DisputeEvidence{},
+		History:    []*internalPkg.DisputeEvent{},
+		CreatedAt:  createdAt,
+		UpdatedAt:  createdAt,
+	}
+}
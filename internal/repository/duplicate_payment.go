@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+)
+
+type duplicatePaymentRepository repository
+
+// NewDuplicatePaymentRepository create and return an object for working with the duplicate payment repository.
+// The returned object implements the DuplicatePaymentRepositoryInterface interface.
+func NewDuplicatePaymentRepository(db mongodb.SourceInterface) DuplicatePaymentRepositoryInterface {
+	s := &duplicatePaymentRepository{db: db}
+	return s
+}
+
+func (h *duplicatePaymentRepository) Claim(ctx context.Context, payment *internalPkg.DuplicatePayment) (bool, error) {
+	_, err := h.db.Collection(collectionDuplicatePayment).InsertOne(ctx, payment)
+
+	if err != nil {
+		if isDuplicateKeyError(err) {
+			return false, nil
+		}
+
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionDuplicatePayment),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationInsert),
+			zap.Any(pkg.ErrorDatabaseFieldDocument, payment),
+		)
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (h *duplicatePaymentRepository) Update(ctx context.Context, payment *internalPkg.DuplicatePayment) error {
+	_, err := h.db.Collection(collectionDuplicatePayment).ReplaceOne(ctx, bson.M{"_id": payment.Id}, payment)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionDuplicatePayment),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpdate),
+			zap.Any(pkg.ErrorDatabaseFieldDocument, payment),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *duplicatePaymentRepository) GetById(ctx context.Context, id string) (*internalPkg.DuplicatePayment, error) {
+	var payment *internalPkg.DuplicatePayment
+
+	query := bson.M{"_id": id}
+	err := h.db.Collection(collectionDuplicatePayment).FindOne(ctx, query).Decode(&payment)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+func (h *duplicatePaymentRepository) Find(
+	ctx context.Context,
+	req *internalPkg.ListDuplicatePaymentsRequest,
+) ([]*internalPkg.DuplicatePayment, error) {
+	var payments []*internalPkg.DuplicatePayment
+
+	query := h.getFindQuery(req)
+	opts := options.Find().
+		SetSort(bson.M{"created_at": -1}).
+		SetLimit(req.Limit).
+		SetSkip(req.Offset)
+	cursor, err := h.db.Collection(collectionDuplicatePayment).Find(ctx, query, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionDuplicatePayment),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &payments)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionDuplicatePayment),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+func (h *duplicatePaymentRepository) FindCount(
+	ctx context.Context,
+	req *internalPkg.ListDuplicatePaymentsRequest,
+) (int64, error) {
+	query := h.getFindQuery(req)
+	count, err := h.db.Collection(collectionDuplicatePayment).CountDocuments(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionDuplicatePayment),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (h *duplicatePaymentRepository) getFindQuery(req *internalPkg.ListDuplicatePaymentsRequest) bson.M {
+	query := bson.M{}
+
+	if req.MerchantId != "" {
+		query["merchant_id"] = req.MerchantId
+	}
+
+	if req.Action != "" {
+		query["action"] = req.Action
+	}
+
+	return query
+}
@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+)
+
+const (
+	collectionDuplicatePayment = "duplicate_payment"
+)
+
+// DuplicatePaymentRepositoryInterface is abstraction layer for working with duplicate payments
+// and representation in database.
+type DuplicatePaymentRepositoryInterface interface {
+	// Claim adds the duplicate payment to the collection if it not exists yet, so duplicate order is processed once.
+	// Returns false if duplicate payment of the same order already exists.
+	Claim(context.Context, *internalPkg.DuplicatePayment) (bool, error)
+
+	// Update updates the duplicate payment in the collection.
+	Update(context.Context, *internalPkg.DuplicatePayment) error
+
+	// GetById returns the duplicate payment by the identifier of duplicate order.
+	GetById(context.Context, string) (*internalPkg.DuplicatePayment, error)
+
+	// Find returns a list of duplicate payments by the filter ordered from newest to oldest.
+	Find(context.Context, *internalPkg.ListDuplicatePaymentsRequest) ([]*internalPkg.DuplicatePayment, error)
+
+	// FindCount returns the number of duplicate payments by the filter.
+	FindCount(context.Context, *internalPkg.ListDuplicatePaymentsRequest) (int64, error)
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type DuplicatePaymentTestSuite struct {
+	suite.Suite
+	db         mongodb.SourceInterface
+	repository DuplicatePaymentRepositoryInterface
+	log        *zap.Logger
+}
+
+func Test_DuplicatePayment(t *testing.T) {
+	suite.Run(t, new(DuplicatePaymentTestSuite))
+}
+
+func (suite *DuplicatePaymentTestSuite) SetupTest() {
+	_, err := config.NewConfig()
+	assert.NoError(suite.T(), err, "Config load failed")
+
+	suite.log, err = zap.NewProduction()
+	assert.NoError(suite.T(), err, "Logger initialization failed")
+
+	suite.db, err = mongodb.NewDatabase()
+	assert.NoError(suite.T(), err, "Database connection failed")
+
+	suite.repository = NewDuplicatePaymentRepository(suite.db)
+}
+
+func (suite *DuplicatePaymentTestSuite) TearDownTest() {
+	if err := suite.db.Drop(); err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	if err := suite.db.Close(); err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *DuplicatePaymentTestSuite) TestDuplicatePayment_NewDuplicatePaymentRepository_Ok() {
+	repository := NewDuplicatePaymentRepository(suite.db)
+	assert.IsType(suite.T(), &duplicatePaymentRepository{}, repository)
+}
+
+func (suite *DuplicatePaymentTestSuite) TestDuplicatePayment_ClaimGetById_Ok() {
+	payment := suite.getDuplicatePayment(primitive.NewObjectID().Hex(), time.Now())
+	ok, err := suite.repository.Claim(context.TODO(), payment)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	payment2, err := suite.repository.GetById(context.TODO(), payment.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), payment.OriginalOrderId, payment2.OriginalOrderId)
+	assert.Equal(suite.T(), payment.ProjectOrderId, payment2.ProjectOrderId)
+	assert.Equal(suite.T(), payment.Action, payment2.Action)
+	assert.Equal(suite.T(), payment.Amount, payment2.Amount)
+
+	ok, err = suite.repository.Claim(context.TODO(), payment)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+}
+
+func (suite *DuplicatePaymentTestSuite) TestDuplicatePayment_Update_Ok() {
+	payment := suite.getDuplicatePayment(primitive.NewObjectID().Hex(), time.Now())
+	_, err := suite.repository.Claim(context.TODO(), payment)
+	assert.NoError(suite.T(), err)
+
+	payment.RefundId = primitive.NewObjectID().Hex()
+	err = suite.repository.Update(context.TODO(), payment)
+	assert.NoError(suite.T(), err)
+
+	payment2, err := suite.repository.GetById(context.TODO(), payment.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), payment.RefundId, payment2.RefundId)
+}
+
+func (suite *DuplicatePaymentTestSuite) TestDuplicatePayment_GetById_NotFound() {
+	_, err := suite.repository.GetById(context.TODO(), primitive.NewObjectID().Hex())
+	assert.Equal(suite.T(), mongo.ErrNoDocuments, err)
+}
+
+func (suite *DuplicatePaymentTestSuite) TestDuplicatePayment_FindFindCount_Ok() {
+	merchantId := primitive.NewObjectID().Hex()
+
+	old := suite.getDuplicatePayment(merchantId, time.Now().Add(-time.Hour))
+	_, err := suite.repository.Claim(context.TODO(), old)
+	assert.NoError(suite.T(), err)
+
+	last := suite.getDuplicatePayment(merchantId, time.Now())
+	last.Action = internalPkg.DuplicatePaymentActionRefund
+	_, err = suite.repository.Claim(context.TODO(), last)
+	assert.NoError(suite.T(), err)
+
+	_, err = suite.repository.Claim(context.TODO(), suite.getDuplicatePayment(primitive.NewObjectID().Hex(), time.Now()))
+	assert.NoError(suite.T(), err)
+
+	req := &internalPkg.ListDuplicatePaymentsRequest{MerchantId: merchantId, Limit: 10}
+	count, err := suite.repository.FindCount(context.TODO(), req)
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), 2, count)
+
+	list, err := suite.repository.Find(context.TODO(), req)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), list, 2)
+	assert.Equal(suite.T(), last.Id, list[0].Id)
+	assert.Equal(suite.T(), old.Id, list[1].Id)
+
+	req.Action = internalPkg.DuplicatePaymentActionReview
+	list, err = suite.repository.Find(context.TODO(), req)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), list, 1)
+	assert.Equal(suite.T(), old.Id, list[0].Id)
+}
+
+func (suite *DuplicatePaymentTestSuite) getDuplicatePayment(merchantId string, createdAt time.Time) *internalPkg.DuplicatePayment {
+	return &internalPkg.DuplicatePayment{
+		Id:                primitive.NewObjectID().Hex(),
+		OrderUuid:         uuid.New().String(),
+		OriginalOrderId:   primitive.NewObjectID().Hex(),
+		OriginalOrderUuid: uuid.New().String(),
+		MerchantId:        merchantId,
+		ProjectId:         primitive.NewObjectID().Hex(),
+		ProjectOrderId:    primitive.NewObjectID().Hex(),
+		CustomerId:        primitive.NewObjectID().Hex(),
+		Amount:            150,
+		Currency:          "EUR",
+		Action:            internalPkg.DuplicatePaymentActionReview,
+		CreatedAt:         createdAt,
+	}
+}
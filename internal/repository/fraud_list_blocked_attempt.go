@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+)
+
+type fraudListBlockedAttemptRepository repository
+
+// NewFraudListBlockedAttemptRepository create and return an object for working with the repository of attempts
+// blocked by fraud lists. The returned object implements the FraudListBlockedAttemptRepositoryInterface interface.
+func NewFraudListBlockedAttemptRepository(db mongodb.SourceInterface) FraudListBlockedAttemptRepositoryInterface {
+	s := &fraudListBlockedAttemptRepository{db: db}
+	return s
+}
+
+func (h *fraudListBlockedAttemptRepository) Insert(
+	ctx context.Context,
+	attempt *internalPkg.FraudListBlockedAttempt,
+) error {
+	_, err := h.db.Collection(collectionFraudListBlockedAttempt).InsertOne(ctx, attempt)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionFraudListBlockedAttempt),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationInsert),
+			zap.Any(pkg.ErrorDatabaseFieldDocument, attempt),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *fraudListBlockedAttemptRepository) Find(
+	ctx context.Context,
+	req *internalPkg.ListFraudListBlockedAttemptsRequest,
+) ([]*internalPkg.FraudListBlockedAttempt, error) {
+	var attempts []*internalPkg.FraudListBlockedAttempt
+
+	query := h.getFindQuery(req)
+	opts := options.Find().
+		SetSort(bson.M{"created_at": -1}).
+		SetLimit(req.Limit).
+		SetSkip(req.Offset)
+	cursor, err := h.db.Collection(collectionFraudListBlockedAttempt).Find(ctx, query, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionFraudListBlockedAttempt),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &attempts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionFraudListBlockedAttempt),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return attempts, nil
+}
+
+func (h *fraudListBlockedAttemptRepository) FindCount(
+	ctx context.Context,
+	req *internalPkg.ListFraudListBlockedAttemptsRequest,
+) (int64, error) {
+	query := h.getFindQuery(req)
+	count, err := h.db.Collection(collectionFraudListBlockedAttempt).CountDocuments(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionFraudListBlockedAttempt),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (h *fraudListBlockedAttemptRepository) getFindQuery(req *internalPkg.ListFraudListBlockedAttemptsRequest) bson.M {
+	query := bson.M{}
+
+	if req.MerchantId != "" {
+		query["merchant_id"] = req.MerchantId
+	}
+
+	if req.OrderId != "" {
+		query["order_id"] = req.OrderId
+	}
+
+	if req.EntryId != "" {
+		query["entry_id"] = req.EntryId
+	}
+
+	return query
+}
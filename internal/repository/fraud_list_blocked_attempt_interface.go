@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+)
+
+const (
+	collectionFraudListBlockedAttempt = "fraud_list_blocked_attempt"
+)
+
+// FraudListBlockedAttemptRepositoryInterface is abstraction layer for working with attempts declined by block lists
+// and representation in database.
+type FraudListBlockedAttemptRepositoryInterface interface {
+	// Insert adds the blocked attempt.
+	Insert(context.Context, *internalPkg.FraudListBlockedAttempt) error
+
+	// Find returns a list of blocked attempts by the filter ordered from newest to oldest.
+	Find(context.Context, *internalPkg.ListFraudListBlockedAttemptsRequest) ([]*internalPkg.FraudListBlockedAttempt, error)
+
+	// FindCount returns the number of blocked attempts by the filter.
+	FindCount(context.Context, *internalPkg.ListFraudListBlockedAttemptsRequest) (int64, error)
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type FraudListBlockedAttemptTestSuite struct {
+	suite.Suite
+	db         mongodb.SourceInterface
+	repository FraudListBlockedAttemptRepositoryInterface
+	log        *zap.Logger
+}
+
+func Test_FraudListBlockedAttempt(t *testing.T) {
+	suite.Run(t, new(FraudListBlockedAttemptTestSuite))
+}
+
+func (suite *FraudListBlockedAttemptTestSuite) SetupTest() {
+	_, err := config.NewConfig()
+	assert.NoError(suite.T(), err, "Config load failed")
+
+	suite.log, err = zap.NewProduction()
+	assert.NoError(suite.T(), err, "Logger initialization failed")
+
+	suite.db, err = mongodb.NewDatabase()
+	assert.NoError(suite.T(), err, "Database connection failed")
+
+	suite.repository = NewFraudListBlockedAttemptRepository(suite.db)
+}
+
+func (suite *FraudListBlockedAttemptTestSuite) TearDownTest() {
+	if err := suite.db.Drop(); err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	if err := suite.db.Close(); err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *FraudListBlockedAttemptTestSuite) TestFraudListBlockedAttempt_NewFraudListBlockedAttemptRepository_Ok() {
+	repository := NewFraudListBlockedAttemptRepository(suite.db)
+	assert.IsType(suite.T(), &fraudListBlockedAttemptRepository{}, repository)
+}
+
+func (suite *FraudListBlockedAttemptTestSuite) TestFraudListBlockedAttempt_InsertFind_Ok() {
+	merchantId := primitive.NewObjectID().Hex()
+	orderId := primitive.NewObjectID().Hex()
+
+	old := suite.getAttempt(merchantId, orderId, time.Now().Add(-time.Hour))
+	err := suite.repository.Insert(context.TODO(), old)
+	assert.NoError(suite.T(), err)
+
+	last := suite.getAttempt(merchantId, orderId, time.Now())
+	err = suite.repository.Insert(context.TODO(), last)
+	assert.NoError(suite.T(), err)
+
+	other := suite.getAttempt(primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex(), time.Now())
+	err = suite.repository.Insert(context.TODO(), other)
+	assert.NoError(suite.T(), err)
+
+	req := &internalPkg.ListFraudListBlockedAttemptsRequest{OrderId: orderId, Limit: 10}
+	count, err := suite.repository.FindCount(context.TODO(), req)
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), 2, count)
+
+	list, err := suite.repository.Find(context.TODO(), req)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), list, 2)
+	assert.Equal(suite.T(), last.Id, list[0].Id)
+	assert.Equal(suite.T(), old.Id, list[1].Id)
+
+	req = &internalPkg.ListFraudListBlockedAttemptsRequest{EntryId: other.EntryId, Limit: 10}
+	list, err = suite.repository.Find(context.TODO(), req)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), list, 1)
+	assert.Equal(suite.T(), other.Id, list[0].Id)
+}
+
+func (suite *FraudListBlockedAttemptTestSuite) getAttempt(
+	merchantId, orderId string,
+	createdAt time.Time,
+) *internalPkg.FraudListBlockedAttempt {
+	return &internalPkg.FraudListBlockedAttempt{
+		Id:           primitive.NewObjectID().Hex(),
+		EntryId:      primitive.NewObjectID().Hex(),
+		MerchantId:   merchantId,
+		ProjectId:    primitive.NewObjectID().Hex(),
+		OrderId:      orderId,
+		OrderUuid:    primitive.NewObjectID().Hex(),
+		Stage:        internalPkg.FraudListStagePaymentCreate,
+		Type:         internalPkg.FraudListEntryTypeIp,
+		Value:        "127.0.0.0/8",
+		MatchedValue: "127.0.0.1",
+		CreatedAt:    createdAt,
+	}
+}
@@ -0,0 +1,270 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"net"
+	"time"
+)
+
+type fraudListEntryRepository repository
+
+// NewFraudListEntryRepository create and return an object for working with the fraud list entry repository.
+// The returned object implements the FraudListEntryRepositoryInterface interface.
+func NewFraudListEntryRepository(db mongodb.SourceInterface) FraudListEntryRepositoryInterface {
+	s := &fraudListEntryRepository{db: db}
+	return s
+}
+
+func (h *fraudListEntryRepository) Insert(ctx context.Context, entry *internalPkg.FraudListEntry) error {
+	_, err := h.db.Collection(collectionFraudListEntry).InsertOne(ctx, entry)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionFraudListEntry),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationInsert),
+			zap.Any(pkg.ErrorDatabaseFieldDocument, entry),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *fraudListEntryRepository) MultipleInsert(ctx context.Context, entries []*internalPkg.FraudListEntry) error {
+	e := make([]interface{}, len(entries))
+	for i, v := range entries {
+		e[i] = v
+	}
+
+	_, err := h.db.Collection(collectionFraudListEntry).InsertMany(ctx, e)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionFraudListEntry),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationInsert),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, e),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *fraudListEntryRepository) Update(ctx context.Context, entry *internalPkg.FraudListEntry) error {
+	_, err := h.db.Collection(collectionFraudListEntry).ReplaceOne(ctx, bson.M{"_id": entry.Id}, entry)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionFraudListEntry),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpdate),
+			zap.Any(pkg.ErrorDatabaseFieldDocument, entry),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *fraudListEntryRepository) Delete(ctx context.Context, id string) error {
+	query := bson.M{"_id": id}
+	_, err := h.db.Collection(collectionFraudListEntry).DeleteOne(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionFraudListEntry),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *fraudListEntryRepository) GetById(ctx context.Context, id string) (*internalPkg.FraudListEntry, error) {
+	var entry *internalPkg.FraudListEntry
+
+	query := bson.M{"_id": id}
+	err := h.db.Collection(collectionFraudListEntry).FindOne(ctx, query).Decode(&entry)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func (h *fraudListEntryRepository) GetByValue(
+	ctx context.Context,
+	merchantId, entryType, value string,
+) (*internalPkg.FraudListEntry, error) {
+	var entry *internalPkg.FraudListEntry
+
+	query := bson.M{"merchant_id": merchantId, "type": entryType, "value": value}
+	err := h.db.Collection(collectionFraudListEntry).FindOne(ctx, query).Decode(&entry)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func (h *fraudListEntryRepository) Find(
+	ctx context.Context,
+	req *internalPkg.ListFraudListEntriesRequest,
+) ([]*internalPkg.FraudListEntry, error) {
+	query := h.getFindQuery(req)
+	opts := options.Find().
+		SetSort(bson.M{"created_at": -1}).
+		SetLimit(req.Limit).
+		SetSkip(req.Offset)
+
+	return h.find(ctx, query, opts)
+}
+
+func (h *fraudListEntryRepository) FindCount(
+	ctx context.Context,
+	req *internalPkg.ListFraudListEntriesRequest,
+) (int64, error) {
+	query := h.getFindQuery(req)
+	count, err := h.db.Collection(collectionFraudListEntry).CountDocuments(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionFraudListEntry),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (h *fraudListEntryRepository) FindByValues(
+	ctx context.Context,
+	merchantId string,
+	values map[string][]string,
+) ([]*internalPkg.FraudListEntry, error) {
+	var or []bson.M
+
+	for _, v := range values[internalPkg.FraudListEntryTypeIp] {
+		ip := net.ParseIP(v)
+
+		if ip == nil {
+			continue
+		}
+
+		key := internalPkg.GetFraudListIpRangeKey(ip)
+		or = append(or, bson.M{
+			"type":        internalPkg.FraudListEntryTypeIp,
+			"range_start": bson.M{"$lte": key},
+			"range_end":   bson.M{"$gte": key},
+		})
+	}
+
+	for entryType, v := range values {
+		if len(v) <= 0 {
+			continue
+		}
+
+		or = append(or, bson.M{"type": entryType, "value": bson.M{"$in": v}})
+	}
+
+	if len(or) <= 0 {
+		return nil, nil
+	}
+
+	query := bson.M{
+		"merchant_id": bson.M{"$in": []string{merchantId, ""}},
+		"$or":         or,
+	}
+
+	return h.find(ctx, query, options.Find())
+}
+
+func (h *fraudListEntryRepository) IncrementHits(ctx context.Context, ids []string, at time.Time) error {
+	query := bson.M{"_id": bson.M{"$in": ids}}
+	set := bson.M{"$inc": bson.M{"hits": 1}, "$set": bson.M{"last_hit_at": at}}
+	_, err := h.db.Collection(collectionFraudListEntry).UpdateMany(ctx, query, set)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionFraudListEntry),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+			zap.Any(pkg.ErrorDatabaseFieldSet, set),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *fraudListEntryRepository) find(
+	ctx context.Context,
+	query bson.M,
+	opts *options.FindOptions,
+) ([]*internalPkg.FraudListEntry, error) {
+	var entries []*internalPkg.FraudListEntry
+
+	cursor, err := h.db.Collection(collectionFraudListEntry).Find(ctx, query, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionFraudListEntry),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &entries)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionFraudListEntry),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (h *fraudListEntryRepository) getFindQuery(req *internalPkg.ListFraudListEntriesRequest) bson.M {
+	query := bson.M{"merchant_id": req.MerchantId}
+
+	if req.List != "" {
+		query["list"] = req.List
+	}
+
+	if req.Type != "" {
+		query["type"] = req.Type
+	}
+
+	if req.Value != "" {
+		query["value"] = req.Value
+	}
+
+	return query
+}
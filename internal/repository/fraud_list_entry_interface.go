@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"time"
+)
+
+const (
+	collectionFraudListEntry = "fraud_list_entry"
+)
+
+// FraudListEntryRepositoryInterface is abstraction layer for working with entries of block and allow lists
+// and representation in database.
+type FraudListEntryRepositoryInterface interface {
+	// Insert adds the entry to the list.
+	Insert(context.Context, *internalPkg.FraudListEntry) error
+
+	// MultipleInsert adds entries to the lists.
+	MultipleInsert(context.Context, []*internalPkg.FraudListEntry) error
+
+	// Update updates the entry of the list.
+	Update(context.Context, *internalPkg.FraudListEntry) error
+
+	// Delete removes the entry by unique identity.
+	Delete(context.Context, string) error
+
+	// GetById returns the entry by unique identity.
+	GetById(context.Context, string) (*internalPkg.FraudListEntry, error)
+
+	// GetByValue returns the entry of the merchant lists by the type and the value.
+	GetByValue(context.Context, string, string, string) (*internalPkg.FraudListEntry, error)
+
+	// Find returns a list of entries by the filter ordered from newest to oldest.
+	Find(context.Context, *internalPkg.ListFraudListEntriesRequest) ([]*internalPkg.FraudListEntry, error)
+
+	// FindCount returns the number of entries by the filter.
+	FindCount(context.Context, *internalPkg.ListFraudListEntriesRequest) (int64, error)
+
+	// FindByValues returns entries of the merchant lists and of the platform-wide lists with any of the values
+	// by the type and IP ranges of these lists containing any of IP addresses of the values.
+	FindByValues(context.Context, string, map[string][]string) ([]*internalPkg.FraudListEntry, error)
+
+	// IncrementHits increments the hit counters of entries and sets time of the last hit.
+	IncrementHits(context.Context, []string, time.Time) error
+}
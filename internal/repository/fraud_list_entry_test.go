@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"context"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"net"
+	"testing"
+	"time"
+)
+
+type FraudListEntryTestSuite struct {
+	suite.Suite
+	db         mongodb.SourceInterface
+	repository FraudListEntryRepositoryInterface
+	log        *zap.Logger
+}
+
+func Test_FraudListEntry(t *testing.T) {
+	suite.Run(t, new(FraudListEntryTestSuite))
+}
+
+func (suite *FraudListEntryTestSuite) SetupTest() {
+	_, err := config.NewConfig()
+	assert.NoError(suite.T(), err, "Config load failed")
+
+	suite.log, err = zap.NewProduction()
+	assert.NoError(suite.T(), err, "Logger initialization failed")
+
+	suite.db, err = mongodb.NewDatabase()
+	assert.NoError(suite.T(), err, "Database connection failed")
+
+	suite.repository = NewFraudListEntryRepository(suite.db)
+}
+
+func (suite *FraudListEntryTestSuite) TearDownTest() {
+	if err := suite.db.Drop(); err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	if err := suite.db.Close(); err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *FraudListEntryTestSuite) TestFraudListEntry_NewFraudListEntryRepository_Ok() {
+	repository := NewFraudListEntryRepository(suite.db)
+	assert.IsType(suite.T(), &fraudListEntryRepository{}, repository)
+}
+
+func (suite *FraudListEntryTestSuite) TestFraudListEntry_InsertUpdateDelete_Ok() {
+	merchantId := primitive.NewObjectID().Hex()
+	entry := suite.getEntry(merchantId, internalPkg.FraudListEntryTypeEmail, "test@unit.unit")
+	err := suite.repository.Insert(context.TODO(), entry)
+	assert.NoError(suite.T(), err)
+
+	entry.Comment = "known fraudster"
+	err = suite.repository.Update(context.TODO(), entry)
+	assert.NoError(suite.T(), err)
+
+	entry2, err := suite.repository.GetById(context.TODO(), entry.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "known fraudster", entry2.Comment)
+
+	entry2, err = suite.repository.GetByValue(context.TODO(), merchantId, internalPkg.FraudListEntryTypeEmail, "test@unit.unit")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), entry.Id, entry2.Id)
+
+	_, err = suite.repository.GetByValue(context.TODO(), "", internalPkg.FraudListEntryTypeEmail, "test@unit.unit")
+	assert.Equal(suite.T(), mongo.ErrNoDocuments, err)
+
+	err = suite.repository.Delete(context.TODO(), entry.Id)
+	assert.NoError(suite.T(), err)
+
+	_, err = suite.repository.GetById(context.TODO(), entry.Id)
+	assert.Equal(suite.T(), mongo.ErrNoDocuments, err)
+}
+
+func (suite *FraudListEntryTestSuite) TestFraudListEntry_Find_Ok() {
+	merchantId := primitive.NewObjectID().Hex()
+	entries := []*internalPkg.FraudListEntry{
+		suite.getEntry(merchantId, internalPkg.FraudListEntryTypeEmail, "test@unit.unit"),
+		suite.getEntry(merchantId, internalPkg.FraudListEntryTypeCountry, "RU"),
+		suite.getEntry("", internalPkg.FraudListEntryTypeEmail, "test@unit.unit"),
+	}
+	entries[1].List = internalPkg.FraudListAllow
+	err := suite.repository.MultipleInsert(context.TODO(), entries)
+	assert.NoError(suite.T(), err)
+
+	req := &internalPkg.ListFraudListEntriesRequest{MerchantId: merchantId, Limit: 10}
+	count, err := suite.repository.FindCount(context.TODO(), req)
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), 2, count)
+
+	req.List = internalPkg.FraudListAllow
+	list, err := suite.repository.Find(context.TODO(), req)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), list, 1)
+	assert.Equal(suite.T(), entries[1].Id, list[0].Id)
+
+	req = &internalPkg.ListFraudListEntriesRequest{Type: internalPkg.FraudListEntryTypeEmail, Limit: 10}
+	list, err = suite.repository.Find(context.TODO(), req)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), list, 1)
+	assert.Equal(suite.T(), entries[2].Id, list[0].Id)
+}
+
+func (suite *FraudListEntryTestSuite) TestFraudListEntry_FindByValues_Ok() {
+	merchantId := primitive.NewObjectID().Hex()
+	entries := []*internalPkg.FraudListEntry{
+		suite.getEntry(merchantId, internalPkg.FraudListEntryTypeEmail, "test@unit.unit"),
+		suite.getEntry(merchantId, internalPkg.FraudListEntryTypeIp, "10.0.0.0/8"),
+		suite.getEntry(merchantId, internalPkg.FraudListEntryTypeIp, "127.0.0.2"),
+		suite.getEntry("", internalPkg.FraudListEntryTypeBin, "4000"),
+		suite.getEntry(primitive.NewObjectID().Hex(), internalPkg.FraudListEntryTypeEmail, "test@unit.unit"),
+		suite.getEntry("", internalPkg.FraudListEntryTypeIp, "127.0.0.0/24"),
+	}
+	entries[1].RangeStart = internalPkg.GetFraudListIpRangeKey(net.ParseIP("10.0.0.0"))
+	entries[1].RangeEnd = internalPkg.GetFraudListIpRangeKey(net.ParseIP("10.255.255.255"))
+	entries[5].RangeStart = internalPkg.GetFraudListIpRangeKey(net.ParseIP("127.0.0.0"))
+	entries[5].RangeEnd = internalPkg.GetFraudListIpRangeKey(net.ParseIP("127.0.0.255"))
+	err := suite.repository.MultipleInsert(context.TODO(), entries)
+	assert.NoError(suite.T(), err)
+
+	values := map[string][]string{
+		internalPkg.FraudListEntryTypeEmail: {"test@unit.unit"},
+		internalPkg.FraudListEntryTypeIp:    {"127.0.0.1"},
+		internalPkg.FraudListEntryTypeBin:   {"4", "40", "400", "4000", "40000", "400000"},
+	}
+	list, err := suite.repository.FindByValues(context.TODO(), merchantId, values)
+	assert.NoError(suite.T(), err)
+
+	var ids []string
+	for _, v := range list {
+		ids = append(ids, v.Id)
+	}
+	assert.ElementsMatch(suite.T(), []string{entries[0].Id, entries[3].Id, entries[5].Id}, ids)
+
+	values = map[string][]string{internalPkg.FraudListEntryTypeIp: {"10.1.2.3"}}
+	list, err = suite.repository.FindByValues(context.TODO(), merchantId, values)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), list, 1)
+	assert.Equal(suite.T(), entries[1].Id, list[0].Id)
+
+	list, err = suite.repository.FindByValues(context.TODO(), merchantId, map[string][]string{})
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), list)
+}
+
+func (suite *FraudListEntryTestSuite) TestFraudListEntry_IncrementHits_Ok() {
+	entry := suite.getEntry("", internalPkg.FraudListEntryTypeCountry, "RU")
+	err := suite.repository.Insert(context.TODO(), entry)
+	assert.NoError(suite.T(), err)
+
+	err = suite.repository.IncrementHits(context.TODO(), []string{entry.Id}, time.Now())
+	assert.NoError(suite.T(), err)
+	err = suite.repository.IncrementHits(context.TODO(), []string{entry.Id}, time.Now())
+	assert.NoError(suite.T(), err)
+
+	entry2, err := suite.repository.GetById(context.TODO(), entry.Id)
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), 2, entry2.Hits)
+	assert.NotNil(suite.T(), entry2.LastHitAt)
+}
+
+func (suite *FraudListEntryTestSuite) getEntry(merchantId, entryType, value string) *internalPkg.FraudListEntry {
+	return &internalPkg.FraudListEntry{
+		Id:         primitive.NewObjectID().Hex(),
+		MerchantId: merchantId,
+		List:       internalPkg.FraudListBlock,
+		Type:       entryType,
+		Value:      value,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+}
@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+)
+
+type ledgerEntryRepository repository
+
+// NewLedgerEntryRepository create and return an object for working with the ledger entry repository.
+// The returned object implements the LedgerEntryRepositoryInterface interface.
+func NewLedgerEntryRepository(db mongodb.SourceInterface) LedgerEntryRepositoryInterface {
+	s := &ledgerEntryRepository{db: db}
+	return s
+}
+
+func (h *ledgerEntryRepository) MultipleInsert(ctx context.Context, entries []*internalPkg.LedgerEntry) error {
+	e := make([]interface{}, len(entries))
+	for i, v := range entries {
+		e[i] = v
+	}
+
+	_, err := h.db.Collection(collectionLedgerEntry).InsertMany(ctx, e)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionLedgerEntry),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationInsert),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, e),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *ledgerEntryRepository) DeleteByJournalId(ctx context.Context, journalId string) error {
+	query := bson.M{"journal_id": journalId}
+	_, err := h.db.Collection(collectionLedgerEntry).DeleteMany(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionLedgerEntry),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *ledgerEntryRepository) GetBookedAccountingEntryIds(ctx context.Context, ids []string) ([]string, error) {
+	query := bson.M{"accounting_entry_id": bson.M{"$in": ids}}
+	values, err := h.db.Collection(collectionLedgerEntry).Distinct(ctx, "accounting_entry_id", query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionLedgerEntry),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	booked := make([]string, 0, len(values))
+
+	for _, value := range values {
+		if id, ok := value.(string); ok {
+			booked = append(booked, id)
+		}
+	}
+
+	return booked, nil
+}
+
+func (h *ledgerEntryRepository) Find(
+	ctx context.Context,
+	filter *internalPkg.LedgerEntryFilter,
+	limit, offset int64,
+) ([]*internalPkg.LedgerEntry, error) {
+	var entries []*internalPkg.LedgerEntry
+
+	query := h.getFindQuery(filter)
+	opts := options.Find().
+		SetSort(bson.D{{"date", 1}, {"_id", 1}}).
+		SetLimit(limit).
+		SetSkip(offset)
+	cursor, err := h.db.Collection(collectionLedgerEntry).Find(ctx, query, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionLedgerEntry),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &entries)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionLedgerEntry),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (h *ledgerEntryRepository) FindCount(ctx context.Context, filter *internalPkg.LedgerEntryFilter) (int64, error) {
+	query := h.getFindQuery(filter)
+	count, err := h.db.Collection(collectionLedgerEntry).CountDocuments(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionLedgerEntry),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (h *ledgerEntryRepository) GetTurnovers(
+	ctx context.Context,
+	filter *internalPkg.LedgerEntryFilter,
+) ([]*internalPkg.LedgerAccountTurnover, error) {
+	var turnovers []*internalPkg.LedgerAccountTurnover
+
+	query := []bson.M{
+		{
+			"$match": h.getFindQuery(filter),
+		},
+		{
+			"$group": bson.M{
+				"_id":    "$account",
+				"debit":  bson.M{"$sum": "$debit"},
+				"credit": bson.M{"$sum": "$credit"},
+			},
+		},
+		{
+			"$sort": bson.M{"_id": 1},
+		},
+	}
+	cursor, err := h.db.Collection(collectionLedgerEntry).Aggregate(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionLedgerEntry),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &turnovers)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionLedgerEntry),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return turnovers, nil
+}
+
+func (h *ledgerEntryRepository) getFindQuery(filter *internalPkg.LedgerEntryFilter) bson.M {
+	query := bson.M{
+		"operating_company_id": filter.OperatingCompanyId,
+		"currency":             filter.Currency,
+	}
+
+	if filter.Account != "" {
+		query["account"] = filter.Account
+	}
+
+	date := bson.M{}
+
+	if !filter.From.IsZero() {
+		date["$gte"] = filter.From
+	}
+
+	if !filter.To.IsZero() {
+		date["$lt"] = filter.To
+	}
+
+	if len(date) > 0 {
+		query["date"] = date
+	}
+
+	return query
+}
@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+)
+
+const (
+	collectionLedgerEntry = "ledger_entry"
+)
+
+// LedgerEntryRepositoryInterface is abstraction layer for working with lines of the double-entry journal
+// and representation in database.
+type LedgerEntryRepositoryInterface interface {
+	// MultipleInsert adds the journal lines to the collection.
+	MultipleInsert(context.Context, []*internalPkg.LedgerEntry) error
+
+	// DeleteByJournalId removes lines of the journal.
+	DeleteByJournalId(context.Context, string) error
+
+	// GetBookedAccountingEntryIds returns identifiers of the accounting entries from the list which are booked
+	// to the journal.
+	GetBookedAccountingEntryIds(context.Context, []string) ([]string, error)
+
+	// Find returns a list of journal lines by the filter ordered by the date.
+	Find(context.Context, *internalPkg.LedgerEntryFilter, int64, int64) ([]*internalPkg.LedgerEntry, error)
+
+	// FindCount returns the number of journal lines by the filter.
+	FindCount(context.Context, *internalPkg.LedgerEntryFilter) (int64, error)
+
+	// GetTurnovers returns debit and credit turnovers of accounts by the filter ordered by the account.
+	GetTurnovers(context.Context, *internalPkg.LedgerEntryFilter) ([]*internalPkg.LedgerAccountTurnover, error)
+}
@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type LedgerEntryTestSuite struct {
+	suite.Suite
+	db         mongodb.SourceInterface
+	repository LedgerEntryRepositoryInterface
+	log        *zap.Logger
+}
+
+func Test_LedgerEntry(t *testing.T) {
+	suite.Run(t, new(LedgerEntryTestSuite))
+}
+
+func (suite *LedgerEntryTestSuite) SetupTest() {
+	_, err := config.NewConfig()
+	assert.NoError(suite.T(), err, "Config load failed")
+
+	suite.log, err = zap.NewProduction()
+	assert.NoError(suite.T(), err, "Logger initialization failed")
+
+	suite.db, err = mongodb.NewDatabase()
+	assert.NoError(suite.T(), err, "Database connection failed")
+
+	suite.repository = NewLedgerEntryRepository(suite.db)
+}
+
+func (suite *LedgerEntryTestSuite) TearDownTest() {
+	if err := suite.db.Drop(); err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	if err := suite.db.Close(); err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *LedgerEntryTestSuite) TestLedgerEntry_NewLedgerEntryRepository_Ok() {
+	repository := NewLedgerEntryRepository(suite.db)
+	assert.IsType(suite.T(), &ledgerEntryRepository{}, repository)
+}
+
+func (suite *LedgerEntryTestSuite) TestLedgerEntry_GetTurnoversFind_Ok() {
+	operatingCompanyId := primitive.NewObjectID().Hex()
+	date := time.Date(2020, time.January, 15, 10, 0, 0, 0, time.UTC)
+
+	entries := []*internalPkg.LedgerEntry{
+		suite.getLedgerEntry(operatingCompanyId, internalPkg.LedgerAccountPaymentSystem, 100, 0, date.AddDate(0, -1, 0)),
+		suite.getLedgerEntry(operatingCompanyId, internalPkg.LedgerAccountCustomerClearing, 0, 100, date.AddDate(0, -1, 0)),
+		suite.getLedgerEntry(operatingCompanyId, internalPkg.LedgerAccountPaymentSystem, 50, 0, date),
+		suite.getLedgerEntry(operatingCompanyId, internalPkg.LedgerAccountCustomerClearing, 0, 50, date),
+		suite.getLedgerEntry(operatingCompanyId, internalPkg.LedgerAccountPaymentSystem, 0, 20, date.Add(time.Hour)),
+		suite.getLedgerEntry(operatingCompanyId, internalPkg.LedgerAccountPaymentSystemCost, 20, 0, date.Add(time.Hour)),
+		suite.getLedgerEntry(primitive.NewObjectID().Hex(), internalPkg.LedgerAccountPaymentSystem, 10, 0, date),
+	}
+	err := suite.repository.MultipleInsert(context.TODO(), entries)
+	assert.NoError(suite.T(), err)
+
+	filter := &internalPkg.LedgerEntryFilter{
+		OperatingCompanyId: operatingCompanyId,
+		Currency:           "EUR",
+		From:               date.AddDate(0, 0, -1),
+		To:                 date.AddDate(0, 0, 1),
+	}
+	turnovers, err := suite.repository.GetTurnovers(context.TODO(), filter)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), turnovers, 3)
+	assert.Equal(suite.T(), internalPkg.LedgerAccountCustomerClearing, turnovers[0].Account)
+	assert.EqualValues(suite.T(), 50, turnovers[0].Credit)
+	assert.Equal(suite.T(), internalPkg.LedgerAccountPaymentSystem, turnovers[1].Account)
+	assert.EqualValues(suite.T(), 50, turnovers[1].Debit)
+	assert.EqualValues(suite.T(), 20, turnovers[1].Credit)
+	assert.Equal(suite.T(), internalPkg.LedgerAccountPaymentSystemCost, turnovers[2].Account)
+
+	filter.From = time.Time{}
+	turnovers, err = suite.repository.GetTurnovers(context.TODO(), filter)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), turnovers, 3)
+	assert.EqualValues(suite.T(), 150, turnovers[1].Debit)
+
+	filter.Account = internalPkg.LedgerAccountPaymentSystem
+	count, err := suite.repository.FindCount(context.TODO(), filter)
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), 3, count)
+
+	list, err := suite.repository.Find(context.TODO(), filter, 2, 1)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), list, 2)
+	assert.Equal(suite.T(), entries[2].Id, list[0].Id)
+	assert.Equal(suite.T(), entries[4].Id, list[1].Id)
+}
+
+func (suite *LedgerEntryTestSuite) TestLedgerEntry_DeleteByJournalId_Ok() {
+	operatingCompanyId := primitive.NewObjectID().Hex()
+	date := time.Now()
+
+	entries := []*internalPkg.LedgerEntry{
+		suite.getLedgerEntry(operatingCompanyId, internalPkg.LedgerAccountPaymentSystem, 100, 0, date),
+		suite.getLedgerEntry(operatingCompanyId, internalPkg.LedgerAccountCustomerClearing, 0, 100, date),
+	}
+	entries[1].JournalId = entries[0].JournalId
+	err := suite.repository.MultipleInsert(context.TODO(), entries)
+	assert.NoError(suite.T(), err)
+
+	err = suite.repository.DeleteByJournalId(context.TODO(), entries[0].JournalId)
+	assert.NoError(suite.T(), err)
+
+	filter := &internalPkg.LedgerEntryFilter{OperatingCompanyId: operatingCompanyId, Currency: "EUR"}
+	count, err := suite.repository.FindCount(context.TODO(), filter)
+	assert.NoError(suite.T(), err)
+	assert.Zero(suite.T(), count)
+}
+
+func (suite *LedgerEntryTestSuite) TestLedgerEntry_GetBookedAccountingEntryIds_Ok() {
+	operatingCompanyId := primitive.NewObjectID().Hex()
+	date := time.Now()
+
+	entries := []*internalPkg.LedgerEntry{
+		suite.getLedgerEntry(operatingCompanyId, internalPkg.LedgerAccountPaymentSystem, 100, 0, date),
+		suite.getLedgerEntry(operatingCompanyId, internalPkg.LedgerAccountCustomerClearing, 0, 100, date),
+	}
+	entries[1].AccountingEntryId = entries[0].AccountingEntryId
+	err := suite.repository.MultipleInsert(context.TODO(), entries)
+	assert.NoError(suite.T(), err)
+
+	notBookedId := primitive.NewObjectID().Hex()
+	ids, err := suite.repository.GetBookedAccountingEntryIds(
+		context.TODO(),
+		[]string{entries[0].AccountingEntryId, notBookedId},
+	)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{entries[0].AccountingEntryId}, ids)
+
+	ids, err = suite.repository.GetBookedAccountingEntryIds(context.TODO(), []string{notBookedId})
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), ids)
+}
+
+func (suite *LedgerEntryTestSuite) getLedgerEntry(
+	operatingCompanyId, account string,
+	debit, credit float64,
+	date time.Time,
+) *internalPkg.LedgerEntry {
+	return &internalPkg.LedgerEntry{
+		Id:                 primitive.NewObjectID().Hex(),
+		JournalId:          primitive.NewObjectID().Hex(),
+		AccountingEntryId:  primitive.NewObjectID().Hex(),
+		EntryType:          "real_gross_revenue",
+		Account:            account,
+		Debit:              debit,
+		Credit:             credit,
+		Currency:           "EUR",
+		OperatingCompanyId: operatingCompanyId,
+		MerchantId:         primitive.NewObjectID().Hex(),
+		SourceId:           primitive.NewObjectID().Hex(),
+		SourceType:         "order",
+		Date:               date,
+		CreatedAt:          time.Now(),
+	}
+}
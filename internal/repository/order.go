@@ -2,12 +2,16 @@ package repository
 
 import (
 	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
 	"github.com/paysuper/paysuper-billing-server/pkg"
 	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"github.com/paysuper/paysuper-proto/go/recurringpb"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
 	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"time"
 )
 
 type orderRepository repository
@@ -65,6 +69,41 @@ func (h *orderRepository) Update(ctx context.Context, order *billingpb.Order) er
 	return nil
 }
 
+func (h *orderRepository) UpdateWithPrivateStatus(
+	ctx context.Context,
+	order *billingpb.Order,
+	privateStatus int32,
+) (bool, error) {
+	oid, err := primitive.ObjectIDFromHex(order.Id)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseInvalidObjectId,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, CollectionOrder),
+			zap.String(pkg.ErrorDatabaseFieldQuery, order.Id),
+		)
+		return false, err
+	}
+
+	query := bson.M{"_id": oid, "private_status": privateStatus}
+	res, err := h.db.Collection(CollectionOrder).ReplaceOne(ctx, query, order)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, CollectionOrder),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpdate),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+			zap.Any(pkg.ErrorDatabaseFieldSet, order),
+		)
+		return false, err
+	}
+
+	return res.MatchedCount > 0, nil
+}
+
 func (h *orderRepository) GetByUuid(ctx context.Context, uuid string) (*billingpb.Order, error) {
 	order := &billingpb.Order{}
 	query := bson.M{"uuid": uuid}
@@ -160,3 +199,261 @@ func (h *orderRepository) GetByProjectOrderId(ctx context.Context, projectId, pr
 
 	return order, nil
 }
+
+func (h *orderRepository) FindByPrivateStatus(
+	ctx context.Context,
+	status int32,
+	pmOrderCloseDateBefore time.Time,
+) ([]*billingpb.Order, error) {
+	var orders []*billingpb.Order
+
+	query := bson.M{
+		"private_status":      status,
+		"pm_order_close_date": bson.M{"$lt": pmOrderCloseDateBefore},
+	}
+	cursor, err := h.db.Collection(CollectionOrder).Find(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, CollectionOrder),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &orders)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, CollectionOrder),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+func (h *orderRepository) FindNotPaid(
+	ctx context.Context,
+	filter *internalPkg.NotPaidOrderFilter,
+) ([]*billingpb.Order, error) {
+	var orders []*billingpb.Order
+
+	query := bson.M{
+		"type":           pkg.OrderTypeOrder,
+		"private_status": recurringpb.OrderStatusNew,
+		"created_at":     bson.M{"$lt": filter.CreatedBefore},
+	}
+
+	if filter.ProjectId != "" {
+		oid, err := primitive.ObjectIDFromHex(filter.ProjectId)
+
+		if err != nil {
+			zap.L().Error(
+				pkg.ErrorDatabaseInvalidObjectId,
+				zap.Error(err),
+				zap.String(pkg.ErrorDatabaseFieldCollection, CollectionOrder),
+				zap.String(pkg.ErrorDatabaseFieldQuery, filter.ProjectId),
+			)
+			return nil, err
+		}
+
+		query["project._id"] = oid
+	} else if len(filter.ExcludeProjectIds) > 0 {
+		var oids []primitive.ObjectID
+
+		for _, id := range filter.ExcludeProjectIds {
+			oid, err := primitive.ObjectIDFromHex(id)
+
+			if err != nil {
+				continue
+			}
+
+			oids = append(oids, oid)
+		}
+
+		query["project._id"] = bson.M{"$nin": oids}
+	}
+
+	if filter.AfterId != "" {
+		oid, err := primitive.ObjectIDFromHex(filter.AfterId)
+
+		if err != nil {
+			zap.L().Error(
+				pkg.ErrorDatabaseInvalidObjectId,
+				zap.Error(err),
+				zap.String(pkg.ErrorDatabaseFieldCollection, CollectionOrder),
+				zap.String(pkg.ErrorDatabaseFieldQuery, filter.AfterId),
+			)
+			return nil, err
+		}
+
+		query["_id"] = bson.M{"$gt": oid}
+	}
+
+	opts := options.Find().
+		SetSort(bson.M{"_id": 1}).
+		SetLimit(filter.Limit)
+	cursor, err := h.db.Collection(CollectionOrder).Find(ctx, query, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, CollectionOrder),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &orders)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, CollectionOrder),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+func (h *orderRepository) FindProcessedByProjectOrderId(
+	ctx context.Context,
+	projectId, projectOrderId string,
+	pmOrderCloseDateAfter time.Time,
+) ([]*billingpb.Order, error) {
+	var orders []*billingpb.Order
+
+	oid, err := primitive.ObjectIDFromHex(projectId)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseInvalidObjectId,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, CollectionOrder),
+			zap.String(pkg.ErrorDatabaseFieldQuery, projectId),
+		)
+		return nil, err
+	}
+
+	query := bson.M{
+		"project._id":         oid,
+		"project_order_id":    projectOrderId,
+		"status":              recurringpb.OrderPublicStatusProcessed,
+		"pm_order_close_date": bson.M{"$gte": pmOrderCloseDateAfter},
+	}
+	cursor, err := h.db.Collection(CollectionOrder).Find(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, CollectionOrder),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &orders)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, CollectionOrder),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+func (h *orderRepository) FindPaid(ctx context.Context, filter *internalPkg.PaidOrderFilter) ([]*billingpb.Order, error) {
+	var orders []*billingpb.Order
+
+	query := bson.M{
+		"type": pkg.OrderTypeOrder,
+		"status": bson.M{"$in": []string{
+			recurringpb.OrderPublicStatusProcessed,
+			recurringpb.OrderPublicStatusRefunded,
+			recurringpb.OrderPublicStatusChargeback,
+		}},
+	}
+
+	if filter.MerchantId != "" {
+		query["project.merchant_id"], _ = primitive.ObjectIDFromHex(filter.MerchantId)
+	}
+
+	if len(filter.Ids) > 0 {
+		var oids []primitive.ObjectID
+
+		for _, id := range filter.Ids {
+			oid, err := primitive.ObjectIDFromHex(id)
+
+			if err != nil {
+				zap.L().Error(
+					pkg.ErrorDatabaseInvalidObjectId,
+					zap.Error(err),
+					zap.String(pkg.ErrorDatabaseFieldCollection, CollectionOrder),
+					zap.String(pkg.ErrorDatabaseFieldQuery, id),
+				)
+				return nil, err
+			}
+
+			oids = append(oids, oid)
+		}
+
+		query["_id"] = bson.M{"$in": oids}
+	}
+
+	date := bson.M{"$ne": nil}
+
+	if !filter.PmOrderCloseDateFrom.IsZero() {
+		date["$gte"] = filter.PmOrderCloseDateFrom
+	}
+
+	if !filter.PmOrderCloseDateTo.IsZero() {
+		date["$lte"] = filter.PmOrderCloseDateTo
+	}
+
+	query["pm_order_close_date"] = date
+	opts := options.Find().
+		SetSort(bson.D{{"pm_order_close_date", 1}, {"_id", 1}}).
+		SetLimit(filter.Limit).
+		SetSkip(filter.Offset)
+	cursor, err := h.db.Collection(CollectionOrder).Find(ctx, query, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, CollectionOrder),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &orders)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, CollectionOrder),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return orders, nil
+}
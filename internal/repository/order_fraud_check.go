@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"time"
+)
+
+type orderFraudCheckRepository repository
+
+// NewOrderFraudCheckRepository create and return an object for working with the order fraud check repository.
+// The returned object implements the OrderFraudCheckRepositoryInterface interface.
+func NewOrderFraudCheckRepository(db mongodb.SourceInterface) OrderFraudCheckRepositoryInterface {
+	s := &orderFraudCheckRepository{db: db}
+	return s
+}
+
+func (h *orderFraudCheckRepository) Insert(ctx context.Context, check *internalPkg.OrderFraudCheck) error {
+	raw, err := bson.Marshal(check)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionOrderFraudCheck),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationInsert),
+			zap.Any(pkg.ErrorDatabaseFieldDocument, check),
+		)
+		return err
+	}
+
+	document := bson.M{}
+
+	if err = bson.Unmarshal(raw, &document); err != nil {
+		return err
+	}
+
+	// object identifier of order is used to join fraud checks with orders
+	if oid, err := primitive.ObjectIDFromHex(check.OrderId); err == nil {
+		document[fieldOrderFraudCheckOrderOid] = oid
+	}
+
+	_, err = h.db.Collection(collectionOrderFraudCheck).InsertOne(ctx, document)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionOrderFraudCheck),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationInsert),
+			zap.Any(pkg.ErrorDatabaseFieldDocument, check),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *orderFraudCheckRepository) GetByOrderId(ctx context.Context, orderId string) (*internalPkg.OrderFraudCheck, error) {
+	var check *internalPkg.OrderFraudCheck
+
+	query := bson.M{"order_id": orderId}
+	opts := options.FindOne().SetSort(bson.M{"created_at": -1})
+	err := h.db.Collection(collectionOrderFraudCheck).FindOne(ctx, query, opts).Decode(&check)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return check, nil
+}
+
+func (h *orderFraudCheckRepository) CountSince(ctx context.Context, field, value string, since time.Time) (int64, error) {
+	query := bson.M{field: value, "created_at": bson.M{"$gte": since}}
+	count, err := h.db.Collection(collectionOrderFraudCheck).CountDocuments(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionOrderFraudCheck),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (h *orderFraudCheckRepository) GetAverageAmount(
+	ctx context.Context,
+	projectId, currency string,
+	since time.Time,
+) (float64, int64, error) {
+	var res struct {
+		Amount float64 `bson:"amount"`
+		Count  int64   `bson:"count"`
+	}
+
+	query := []bson.M{
+		{
+			"$match": bson.M{
+				"project_id": projectId,
+				"currency":   currency,
+				"created_at": bson.M{"$gte": since},
+			},
+		},
+		{"$group": bson.M{"_id": nil, "amount": bson.M{"$avg": "$amount"}, "count": bson.M{"$sum": 1}}},
+	}
+
+	cursor, err := h.db.Collection(collectionOrderFraudCheck).Aggregate(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionOrderFraudCheck),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return 0, 0, err
+	}
+
+	defer cursor.Close(ctx)
+
+	if cursor.Next(ctx) {
+		err = cursor.Decode(&res)
+
+		if err != nil {
+			zap.L().Error(
+				pkg.ErrorQueryCursorExecutionFailed,
+				zap.Error(err),
+				zap.String(pkg.ErrorDatabaseFieldCollection, collectionOrderFraudCheck),
+				zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+			)
+			return 0, 0, err
+		}
+	}
+
+	return res.Amount, res.Count, nil
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"time"
+)
+
+const (
+	collectionOrderFraudCheck = "order_fraud_check"
+
+	fieldOrderFraudCheckOrderOid = "order_oid"
+)
+
+// OrderFraudCheckRepositoryInterface is abstraction layer for working with results of fraud screening
+// of order payments and representation in database.
+type OrderFraudCheckRepositoryInterface interface {
+	// Insert adds result of fraud screening to the collection. Identifier of order is stored as object identifier
+	// in order_oid field also to join results with orders.
+	Insert(context.Context, *internalPkg.OrderFraudCheck) error
+
+	// GetByOrderId returns the latest result of fraud screening by the order identifier.
+	GetByOrderId(context.Context, string) (*internalPkg.OrderFraudCheck, error)
+
+	// CountSince returns number of payment attempts with the value of identity field (e.g. ip or email)
+	// made since the time.
+	CountSince(context.Context, string, string, time.Time) (int64, error)
+
+	// GetAverageAmount returns average amount of payment attempts of the project in the currency made since the time
+	// and number of these attempts.
+	GetAverageAmount(context.Context, string, string, time.Time) (float64, int64, error)
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type OrderFraudCheckTestSuite struct {
+	suite.Suite
+	db         mongodb.SourceInterface
+	repository OrderFraudCheckRepositoryInterface
+	log        *zap.Logger
+}
+
+func Test_OrderFraudCheck(t *testing.T) {
+	suite.Run(t, new(OrderFraudCheckTestSuite))
+}
+
+func (suite *OrderFraudCheckTestSuite) SetupTest() {
+	_, err := config.NewConfig()
+	assert.NoError(suite.T(), err, "Config load failed")
+
+	suite.log, err = zap.NewProduction()
+	assert.NoError(suite.T(), err, "Logger initialization failed")
+
+	suite.db, err = mongodb.NewDatabase()
+	assert.NoError(suite.T(), err, "Database connection failed")
+
+	suite.repository = NewOrderFraudCheckRepository(suite.db)
+}
+
+func (suite *OrderFraudCheckTestSuite) TearDownTest() {
+	if err := suite.db.Drop(); err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	if err := suite.db.Close(); err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *OrderFraudCheckTestSuite) TestOrderFraudCheck_NewOrderFraudCheckRepository_Ok() {
+	repository := NewOrderFraudCheckRepository(suite.db)
+	assert.IsType(suite.T(), &orderFraudCheckRepository{}, repository)
+}
+
+func (suite *OrderFraudCheckTestSuite) TestOrderFraudCheck_Insert_Ok() {
+	orderId := primitive.NewObjectID().Hex()
+	check := suite.getCheck(orderId, primitive.NewObjectID().Hex(), time.Now().Add(-time.Minute))
+	err := suite.repository.Insert(context.TODO(), check)
+	assert.NoError(suite.T(), err)
+
+	check2 := suite.getCheck(orderId, check.ProjectId, time.Now())
+	check2.Score = 50
+	check2.Decision = internalPkg.FraudDecisionReview
+	check2.Rules = []*internalPkg.FraudRuleTriggered{{Rule: internalPkg.FraudRuleDisposableEmail, Score: 50}}
+	err = suite.repository.Insert(context.TODO(), check2)
+	assert.NoError(suite.T(), err)
+
+	check3, err := suite.repository.GetByOrderId(context.TODO(), orderId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), check2.Id, check3.Id)
+	assert.Equal(suite.T(), check2.Score, check3.Score)
+	assert.Equal(suite.T(), check2.Decision, check3.Decision)
+	assert.Len(suite.T(), check3.Rules, 1)
+	assert.Equal(suite.T(), internalPkg.FraudRuleDisposableEmail, check3.Rules[0].Rule)
+
+	oid, err := primitive.ObjectIDFromHex(orderId)
+	assert.NoError(suite.T(), err)
+	count, err := suite.db.Collection(collectionOrderFraudCheck).
+		CountDocuments(context.TODO(), bson.M{fieldOrderFraudCheckOrderOid: oid})
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), 2, count)
+}
+
+func (suite *OrderFraudCheckTestSuite) TestOrderFraudCheck_GetByOrderId_NotFound() {
+	_, err := suite.repository.GetByOrderId(context.TODO(), primitive.NewObjectID().Hex())
+	assert.Equal(suite.T(), mongo.ErrNoDocuments, err)
+}
+
+func (suite *OrderFraudCheckTestSuite) TestOrderFraudCheck_CountSince_Ok() {
+	projectId := primitive.NewObjectID().Hex()
+
+	for i := 0; i < 3; i++ {
+		check := suite.getCheck(primitive.NewObjectID().Hex(), projectId, time.Now())
+		assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), check))
+	}
+
+	check := suite.getCheck(primitive.NewObjectID().Hex(), projectId, time.Now().Add(-time.Hour))
+	assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), check))
+
+	check = suite.getCheck(primitive.NewObjectID().Hex(), projectId, time.Now())
+	check.Ip = "127.0.0.2"
+	assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), check))
+
+	count, err := suite.repository.CountSince(context.TODO(), "ip", "127.0.0.1", time.Now().Add(-time.Minute))
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), 3, count)
+
+	count, err = suite.repository.CountSince(context.TODO(), "email", "test@unit.test", time.Now().Add(-2*time.Hour))
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), 5, count)
+}
+
+func (suite *OrderFraudCheckTestSuite) TestOrderFraudCheck_GetAverageAmount_Ok() {
+	projectId := primitive.NewObjectID().Hex()
+
+	for _, amount := range []float64{10, 20, 30} {
+		check := suite.getCheck(primitive.NewObjectID().Hex(), projectId, time.Now())
+		check.Amount = amount
+		assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), check))
+	}
+
+	check := suite.getCheck(primitive.NewObjectID().Hex(), projectId, time.Now())
+	check.Amount = 1000
+	check.Currency = "EUR"
+	assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), check))
+
+	amount, count, err := suite.repository.GetAverageAmount(context.TODO(), projectId, "USD", time.Now().Add(-time.Hour))
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), 3, count)
+	assert.Equal(suite.T(), float64(20), amount)
+
+	amount, count, err = suite.repository.GetAverageAmount(context.TODO(), primitive.NewObjectID().Hex(), "USD", time.Now().Add(-time.Hour))
+	assert.NoError(suite.T(), err)
+	assert.Zero(suite.T(), count)
+	assert.Zero(suite.T(), amount)
+}
+
+func (suite *OrderFraudCheckTestSuite) getCheck(orderId, projectId string, createdAt time.Time) *internalPkg.OrderFraudCheck {
+	return &internalPkg.OrderFraudCheck{
+		Id:              primitive.NewObjectID().Hex(),
+		OrderId:         orderId,
+		OrderUuid:       primitive.NewObjectID().Hex(),
+		ProjectId:       projectId,
+		Ip:              "127.0.0.1",
+		Email:           "test@unit.test",
+		CustomerId:      primitive.NewObjectID().Hex(),
+		CardFingerprint: primitive.NewObjectID().Hex(),
+		Amount:          100,
+		Currency:        "USD",
+		Decision:        internalPkg.FraudDecisionAllow,
+		CreatedAt:       createdAt,
+	}
+}
@@ -2,7 +2,9 @@ package repository
 
 import (
 	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
 	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"time"
 )
 
 const (
@@ -18,6 +20,10 @@ type OrderRepositoryInterface interface {
 	// Update updates the order in the collection.
 	Update(context.Context, *billingpb.Order) error
 
+	// UpdateWithPrivateStatus updates the order in the collection only if the private status of the stored order
+	// equals to passed one. Returns false if the order wasn't found by identifier and status.
+	UpdateWithPrivateStatus(context.Context, *billingpb.Order, int32) (bool, error)
+
 	// GetById returns a order by its identifier.
 	GetById(context.Context, string) (*billingpb.Order, error)
 
@@ -29,4 +35,20 @@ type OrderRepositoryInterface interface {
 
 	// GetByProjectOrderId returns a order by project and order identifiers.
 	GetByProjectOrderId(context.Context, string, string) (*billingpb.Order, error)
+
+	// FindByPrivateStatus returns orders with the private status which were processed by payment system
+	// before the date.
+	FindByPrivateStatus(context.Context, int32, time.Time) ([]*billingpb.Order, error)
+
+	// FindNotPaid returns new orders which payment wasn't created by customer and which match the filter
+	// ordered by identifier.
+	FindNotPaid(context.Context, *internalPkg.NotPaidOrderFilter) ([]*billingpb.Order, error)
+
+	// FindProcessedByProjectOrderId returns processed orders of the project with the project order identifier
+	// which were processed by payment system after the date.
+	FindProcessedByProjectOrderId(context.Context, string, string, time.Time) ([]*billingpb.Order, error)
+
+	// FindPaid returns payment orders paid by payment system which match the filter ordered by the date
+	// of payment, refunded and charged back orders are returned too.
+	FindPaid(context.Context, *internalPkg.PaidOrderFilter) ([]*billingpb.Order, error)
 }
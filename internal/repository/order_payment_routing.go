@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+)
+
+type orderPaymentRoutingRepository repository
+
+// NewOrderPaymentRoutingRepository create and return an object for working with the order payment routing repository.
+// The returned object implements the OrderPaymentRoutingRepositoryInterface interface.
+func NewOrderPaymentRoutingRepository(db mongodb.SourceInterface) OrderPaymentRoutingRepositoryInterface {
+	s := &orderPaymentRoutingRepository{db: db}
+	return s
+}
+
+func (h *orderPaymentRoutingRepository) Insert(ctx context.Context, routing *internalPkg.OrderPaymentRouting) error {
+	_, err := h.db.Collection(collectionOrderPaymentRouting).InsertOne(ctx, routing)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionOrderPaymentRouting),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationInsert),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, routing),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *orderPaymentRoutingRepository) GetByOrderUuid(
+	ctx context.Context,
+	uuid string,
+) (*internalPkg.OrderPaymentRouting, error) {
+	var routing *internalPkg.OrderPaymentRouting
+
+	query := bson.M{"order_uuid": uuid}
+	opts := options.FindOne().SetSort(bson.M{"created_at": -1})
+	err := h.db.Collection(collectionOrderPaymentRouting).FindOne(ctx, query, opts).Decode(&routing)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionOrderPaymentRouting),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return routing, nil
+}
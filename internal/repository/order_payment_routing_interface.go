@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+)
+
+const (
+	collectionOrderPaymentRouting = "order_payment_routing"
+)
+
+// OrderPaymentRoutingRepositoryInterface is abstraction layer for working with log of order payment routing decisions
+// and representation in database.
+type OrderPaymentRoutingRepositoryInterface interface {
+	// Insert adds order payment routing to the collection.
+	Insert(context.Context, *internalPkg.OrderPaymentRouting) error
+
+	// GetByOrderUuid returns the latest payment routing by the public identifier of the order.
+	GetByOrderUuid(context.Context, string) (*internalPkg.OrderPaymentRouting, error)
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type OrderPaymentRoutingTestSuite struct {
+	suite.Suite
+	db         mongodb.SourceInterface
+	repository OrderPaymentRoutingRepositoryInterface
+	log        *zap.Logger
+}
+
+func Test_OrderPaymentRouting(t *testing.T) {
+	suite.Run(t, new(OrderPaymentRoutingTestSuite))
+}
+
+func (suite *OrderPaymentRoutingTestSuite) SetupTest() {
+	_, err := config.NewConfig()
+	assert.NoError(suite.T(), err, "Config load failed")
+
+	suite.log, err = zap.NewProduction()
+	assert.NoError(suite.T(), err, "Logger initialization failed")
+
+	suite.db, err = mongodb.NewDatabase()
+	assert.NoError(suite.T(), err, "Database connection failed")
+
+	suite.repository = NewOrderPaymentRoutingRepository(suite.db)
+}
+
+func (suite *OrderPaymentRoutingTestSuite) TearDownTest() {
+	if err := suite.db.Drop(); err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	if err := suite.db.Close(); err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *OrderPaymentRoutingTestSuite) TestOrderPaymentRouting_NewOrderPaymentRoutingRepository_Ok() {
+	repository := NewOrderPaymentRoutingRepository(suite.db)
+	assert.IsType(suite.T(), &orderPaymentRoutingRepository{}, repository)
+}
+
+func (suite *OrderPaymentRoutingTestSuite) TestOrderPaymentRouting_Insert_Ok() {
+	routing := &internalPkg.OrderPaymentRouting{
+		Id:              primitive.NewObjectID().Hex(),
+		OrderId:         primitive.NewObjectID().Hex(),
+		OrderUuid:       "uuid",
+		PaymentSystemId: primitive.NewObjectID().Hex(),
+		Handler:         "cardpay",
+		Attempts: []*internalPkg.PaymentRoutingAttempt{
+			{Handler: "cardpay", Status: internalPkg.PaymentRoutingAttemptStatusSuccess, CreatedAt: time.Now()},
+		},
+		CreatedAt: time.Now(),
+	}
+	err := suite.repository.Insert(context.TODO(), routing)
+	assert.NoError(suite.T(), err)
+
+	routing2, err := suite.repository.GetByOrderUuid(context.TODO(), routing.OrderUuid)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), routing.Id, routing2.Id)
+	assert.Equal(suite.T(), routing.PaymentSystemId, routing2.PaymentSystemId)
+	assert.Len(suite.T(), routing2.Attempts, 1)
+}
+
+func (suite *OrderPaymentRoutingTestSuite) TestOrderPaymentRouting_GetByOrderUuid_LatestRouting() {
+	routing := &internalPkg.OrderPaymentRouting{
+		Id:        primitive.NewObjectID().Hex(),
+		OrderUuid: "uuid",
+		CreatedAt: time.Now().Add(-time.Hour),
+	}
+	err := suite.repository.Insert(context.TODO(), routing)
+	assert.NoError(suite.T(), err)
+
+	routing2 := &internalPkg.OrderPaymentRouting{
+		Id:        primitive.NewObjectID().Hex(),
+		OrderUuid: "uuid",
+		CreatedAt: time.Now(),
+	}
+	err = suite.repository.Insert(context.TODO(), routing2)
+	assert.NoError(suite.T(), err)
+
+	routing3, err := suite.repository.GetByOrderUuid(context.TODO(), "uuid")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), routing2.Id, routing3.Id)
+}
+
+func (suite *OrderPaymentRoutingTestSuite) TestOrderPaymentRouting_GetByOrderUuid_NotFound() {
+	_, err := suite.repository.GetByOrderUuid(context.TODO(), "unknown")
+	assert.Equal(suite.T(), mongo.ErrNoDocuments, err)
+}
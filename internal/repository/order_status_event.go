@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+)
+
+type orderStatusEventRepository repository
+
+// NewOrderStatusEventRepository create and return an object for working with the order status event repository.
+// The returned object implements the OrderStatusEventRepositoryInterface interface.
+func NewOrderStatusEventRepository(db mongodb.SourceInterface) OrderStatusEventRepositoryInterface {
+	s := &orderStatusEventRepository{db: db}
+	return s
+}
+
+func (h *orderStatusEventRepository) Insert(ctx context.Context, event *internalPkg.OrderStatusEvent) error {
+	_, err := h.db.Collection(collectionOrderStatusEvent).InsertOne(ctx, event)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionOrderStatusEvent),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationInsert),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, event),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *orderStatusEventRepository) FindByOrderId(
+	ctx context.Context,
+	orderId string,
+) ([]*internalPkg.OrderStatusEvent, error) {
+	var events []*internalPkg.OrderStatusEvent
+
+	query := bson.M{"order_id": orderId}
+	opts := options.Find().SetSort(bson.M{"created_at": 1})
+	cursor, err := h.db.Collection(collectionOrderStatusEvent).Find(ctx, query, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionOrderStatusEvent),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &events)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionOrderStatusEvent),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+)
+
+const (
+	collectionOrderStatusEvent = "order_status_event"
+)
+
+// OrderStatusEventRepositoryInterface is abstraction layer for working with log of order status transitions
+// and representation in database.
+type OrderStatusEventRepositoryInterface interface {
+	// Insert adds transition of order status to the collection.
+	Insert(context.Context, *internalPkg.OrderStatusEvent) error
+
+	// FindByOrderId returns transitions of order status by the identifier of the order ordered from oldest to newest.
+	FindByOrderId(context.Context, string) ([]*internalPkg.OrderStatusEvent, error)
+}
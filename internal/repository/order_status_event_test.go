@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-proto/go/recurringpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type OrderStatusEventTestSuite struct {
+	suite.Suite
+	db         mongodb.SourceInterface
+	repository OrderStatusEventRepositoryInterface
+	log        *zap.Logger
+}
+
+func Test_OrderStatusEvent(t *testing.T) {
+	suite.Run(t, new(OrderStatusEventTestSuite))
+}
+
+func (suite *OrderStatusEventTestSuite) SetupTest() {
+	_, err := config.NewConfig()
+	assert.NoError(suite.T(), err, "Config load failed")
+
+	suite.log, err = zap.NewProduction()
+	assert.NoError(suite.T(), err, "Logger initialization failed")
+
+	suite.db, err = mongodb.NewDatabase()
+	assert.NoError(suite.T(), err, "Database connection failed")
+
+	suite.repository = NewOrderStatusEventRepository(suite.db)
+}
+
+func (suite *OrderStatusEventTestSuite) TearDownTest() {
+	if err := suite.db.Drop(); err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	if err := suite.db.Close(); err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *OrderStatusEventTestSuite) TestOrderStatusEvent_NewOrderStatusEventRepository_Ok() {
+	repository := NewOrderStatusEventRepository(suite.db)
+	assert.IsType(suite.T(), &orderStatusEventRepository{}, repository)
+}
+
+func (suite *OrderStatusEventTestSuite) TestOrderStatusEvent_Insert_Ok() {
+	orderId := primitive.NewObjectID().Hex()
+	event := suite.getEvent(orderId, recurringpb.OrderStatusNew, recurringpb.OrderStatusPaymentSystemCreate, time.Now())
+	err := suite.repository.Insert(context.TODO(), event)
+	assert.NoError(suite.T(), err)
+
+	events, err := suite.repository.FindByOrderId(context.TODO(), orderId)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), events, 1)
+	assert.Equal(suite.T(), event.Id, events[0].Id)
+	assert.Equal(suite.T(), event.From, events[0].From)
+	assert.Equal(suite.T(), event.To, events[0].To)
+	assert.Equal(suite.T(), event.Cause, events[0].Cause)
+}
+
+func (suite *OrderStatusEventTestSuite) TestOrderStatusEvent_FindByOrderId_Ordered() {
+	orderId := primitive.NewObjectID().Hex()
+	event := suite.getEvent(
+		orderId,
+		recurringpb.OrderStatusPaymentSystemCreate,
+		recurringpb.OrderStatusPaymentSystemComplete,
+		time.Now(),
+	)
+	err := suite.repository.Insert(context.TODO(), event)
+	assert.NoError(suite.T(), err)
+
+	event2 := suite.getEvent(
+		orderId,
+		recurringpb.OrderStatusNew,
+		recurringpb.OrderStatusPaymentSystemCreate,
+		time.Now().Add(-time.Minute),
+	)
+	err = suite.repository.Insert(context.TODO(), event2)
+	assert.NoError(suite.T(), err)
+
+	err = suite.repository.Insert(context.TODO(), suite.getEvent(primitive.NewObjectID().Hex(), 0, 1, time.Now()))
+	assert.NoError(suite.T(), err)
+
+	events, err := suite.repository.FindByOrderId(context.TODO(), orderId)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), events, 2)
+	assert.Equal(suite.T(), event2.Id, events[0].Id)
+	assert.Equal(suite.T(), event.Id, events[1].Id)
+}
+
+func (suite *OrderStatusEventTestSuite) TestOrderStatusEvent_FindByOrderId_Empty() {
+	events, err := suite.repository.FindByOrderId(context.TODO(), primitive.NewObjectID().Hex())
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), events)
+}
+
+func (suite *OrderStatusEventTestSuite) getEvent(
+	orderId string,
+	from, to int32,
+	createdAt time.Time,
+) *internalPkg.OrderStatusEvent {
+	return &internalPkg.OrderStatusEvent{
+		Id:        primitive.NewObjectID().Hex(),
+		OrderId:   orderId,
+		OrderUuid: "uuid",
+		From:      from,
+		To:        to,
+		Cause:     internalPkg.OrderStatusEventCausePaymentCallback,
+		CreatedAt: createdAt,
+	}
+}
@@ -2,15 +2,20 @@ package repository
 
 import (
 	"context"
+	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/timestamp"
 	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
 	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"github.com/paysuper/paysuper-proto/go/recurringpb"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.uber.org/zap"
 	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
 	"testing"
+	"time"
 )
 
 type OrderTestSuite struct {
@@ -116,6 +121,33 @@ func (suite *OrderTestSuite) TestOrder_Update_Ok() {
 	assert.Equal(suite.T(), order.MccCode, order2.MccCode)
 }
 
+func (suite *OrderTestSuite) TestOrder_UpdateWithPrivateStatus_Ok() {
+	order := &billingpb.Order{
+		Id: primitive.NewObjectID().Hex(),
+		Project: &billingpb.ProjectOrder{
+			Id:         primitive.NewObjectID().Hex(),
+			MerchantId: primitive.NewObjectID().Hex(),
+		},
+		PrivateStatus: recurringpb.OrderStatusNew,
+	}
+	err := suite.repository.Insert(context.TODO(), order)
+	assert.NoError(suite.T(), err)
+
+	order.PrivateStatus = recurringpb.OrderStatusPaymentSystemCreate
+	ok, err := suite.repository.UpdateWithPrivateStatus(context.TODO(), order, recurringpb.OrderStatusNew)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	order.PrivateStatus = recurringpb.OrderStatusProjectReject
+	ok, err = suite.repository.UpdateWithPrivateStatus(context.TODO(), order, recurringpb.OrderStatusNew)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+
+	order2, err := suite.repository.GetById(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), recurringpb.OrderStatusPaymentSystemCreate, order2.PrivateStatus)
+}
+
 // TODO: Use the DB mock for return error on insert entry
 func (suite *OrderTestSuite) TestOrder_Update_Error() {
 	order := &billingpb.Order{
@@ -287,6 +319,210 @@ func (suite *OrderTestSuite) TestOrder_GetByProjectOrderId_ErrorNotFound_Invalid
 	assert.Nil(suite.T(), order2)
 }
 
+func (suite *OrderTestSuite) TestOrder_FindByPrivateStatus_Ok() {
+	order := suite.getOrderTemplate()
+	order.PrivateStatus = 20
+	order.PaymentMethodOrderClosedAt = ptypes.TimestampNow()
+	err := suite.repository.Insert(context.TODO(), order)
+	assert.NoError(suite.T(), err)
+
+	order2 := suite.getOrderTemplate()
+	order2.Uuid = "Uuid2"
+	err = suite.repository.Insert(context.TODO(), order2)
+	assert.NoError(suite.T(), err)
+
+	orders, err := suite.repository.FindByPrivateStatus(context.TODO(), 20, time.Now().Add(-time.Hour))
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), orders)
+
+	orders, err = suite.repository.FindByPrivateStatus(context.TODO(), 20, time.Now().Add(time.Minute))
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), orders, 1)
+	assert.Equal(suite.T(), order.Id, orders[0].Id)
+}
+
+func (suite *OrderTestSuite) TestOrder_FindNotPaid_Ok() {
+	order := suite.getOrderTemplate()
+	order.Type = pkg.OrderTypeOrder
+	order.PrivateStatus = recurringpb.OrderStatusNew
+	err := suite.repository.Insert(context.TODO(), order)
+	assert.NoError(suite.T(), err)
+
+	order2 := suite.getOrderTemplate()
+	order2.Uuid = "Uuid2"
+	order2.Type = pkg.OrderTypeOrder
+	order2.PrivateStatus = recurringpb.OrderStatusPaymentSystemCreate
+	err = suite.repository.Insert(context.TODO(), order2)
+	assert.NoError(suite.T(), err)
+
+	order3 := suite.getOrderTemplate()
+	order3.Uuid = "Uuid3"
+	order3.Type = pkg.OrderTypeOrder
+	order3.PrivateStatus = recurringpb.OrderStatusPaymentSystemComplete
+	err = suite.repository.Insert(context.TODO(), order3)
+	assert.NoError(suite.T(), err)
+
+	order4 := suite.getOrderTemplate()
+	order4.Uuid = "Uuid4"
+	order4.Type = pkg.OrderTypeOrder
+	order4.PrivateStatus = recurringpb.OrderStatusNew
+	err = suite.repository.Insert(context.TODO(), order4)
+	assert.NoError(suite.T(), err)
+
+	filter := &internalPkg.NotPaidOrderFilter{CreatedBefore: time.Now(), Limit: 10}
+	orders, err := suite.repository.FindNotPaid(context.TODO(), filter)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), orders, 2)
+	assert.Equal(suite.T(), order.Id, orders[0].Id)
+	assert.Equal(suite.T(), order4.Id, orders[1].Id)
+
+	filter = &internalPkg.NotPaidOrderFilter{CreatedBefore: time.Now(), Limit: 1}
+	orders, err = suite.repository.FindNotPaid(context.TODO(), filter)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), orders, 1)
+	assert.Equal(suite.T(), order.Id, orders[0].Id)
+
+	filter.AfterId = orders[0].Id
+	orders, err = suite.repository.FindNotPaid(context.TODO(), filter)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), orders, 1)
+	assert.Equal(suite.T(), order4.Id, orders[0].Id)
+
+	filter = &internalPkg.NotPaidOrderFilter{CreatedBefore: time.Now(), ProjectId: order.Project.Id, Limit: 10}
+	orders, err = suite.repository.FindNotPaid(context.TODO(), filter)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), orders, 1)
+	assert.Equal(suite.T(), order.Id, orders[0].Id)
+
+	filter = &internalPkg.NotPaidOrderFilter{
+		CreatedBefore:     time.Now(),
+		ExcludeProjectIds: []string{order.Project.Id},
+		Limit:             10,
+	}
+	orders, err = suite.repository.FindNotPaid(context.TODO(), filter)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), orders, 1)
+	assert.Equal(suite.T(), order4.Id, orders[0].Id)
+
+	filter = &internalPkg.NotPaidOrderFilter{CreatedBefore: time.Unix(50, 0), Limit: 10}
+	orders, err = suite.repository.FindNotPaid(context.TODO(), filter)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), orders)
+}
+
+func (suite *OrderTestSuite) TestOrder_FindNotPaid_InvalidProjectId() {
+	filter := &internalPkg.NotPaidOrderFilter{CreatedBefore: time.Now(), ProjectId: "invalid", Limit: 10}
+	_, err := suite.repository.FindNotPaid(context.TODO(), filter)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *OrderTestSuite) TestOrder_FindProcessedByProjectOrderId_Ok() {
+	order := suite.getOrderTemplate()
+	order.ProjectOrderId = primitive.NewObjectID().Hex()
+	order.PaymentMethodOrderClosedAt = ptypes.TimestampNow()
+	err := suite.repository.Insert(context.TODO(), order)
+	assert.NoError(suite.T(), err)
+
+	order2 := suite.getOrderTemplate()
+	order2.Uuid = "Uuid2"
+	order2.Project = order.Project
+	order2.ProjectOrderId = order.ProjectOrderId
+	order2.Status = recurringpb.OrderPublicStatusCreated
+	order2.PaymentMethodOrderClosedAt = ptypes.TimestampNow()
+	err = suite.repository.Insert(context.TODO(), order2)
+	assert.NoError(suite.T(), err)
+
+	order3 := suite.getOrderTemplate()
+	order3.Uuid = "Uuid3"
+	order3.ProjectOrderId = order.ProjectOrderId
+	order3.PaymentMethodOrderClosedAt = ptypes.TimestampNow()
+	err = suite.repository.Insert(context.TODO(), order3)
+	assert.NoError(suite.T(), err)
+
+	orders, err := suite.repository.FindProcessedByProjectOrderId(
+		context.TODO(),
+		order.Project.Id,
+		order.ProjectOrderId,
+		time.Now().Add(-time.Hour),
+	)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), orders, 1)
+	assert.Equal(suite.T(), order.Id, orders[0].Id)
+
+	orders, err = suite.repository.FindProcessedByProjectOrderId(
+		context.TODO(),
+		order.Project.Id,
+		order.ProjectOrderId,
+		time.Now().Add(time.Minute),
+	)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), orders)
+}
+
+func (suite *OrderTestSuite) TestOrder_FindProcessedByProjectOrderId_InvalidProjectId() {
+	_, err := suite.repository.FindProcessedByProjectOrderId(context.TODO(), "invalid", "order_id", time.Now())
+	assert.Error(suite.T(), err)
+}
+
+func (suite *OrderTestSuite) TestOrder_FindPaid_Ok() {
+	closedAt := time.Now().Add(-time.Hour)
+	order := suite.getOrderTemplate()
+	order.Type = pkg.OrderTypeOrder
+	order.PaymentMethodOrderClosedAt, _ = ptypes.TimestampProto(closedAt)
+	err := suite.repository.Insert(context.TODO(), order)
+	assert.NoError(suite.T(), err)
+
+	order2 := suite.getOrderTemplate()
+	order2.Uuid = "Uuid2"
+	order2.Project = order.Project
+	order2.Type = pkg.OrderTypeOrder
+	order2.Status = recurringpb.OrderPublicStatusRefunded
+	order2.PaymentMethodOrderClosedAt = ptypes.TimestampNow()
+	err = suite.repository.Insert(context.TODO(), order2)
+	assert.NoError(suite.T(), err)
+
+	order3 := suite.getOrderTemplate()
+	order3.Uuid = "Uuid3"
+	order3.Project = order.Project
+	order3.Type = pkg.OrderTypeOrder
+	order3.Status = recurringpb.OrderPublicStatusCreated
+	err = suite.repository.Insert(context.TODO(), order3)
+	assert.NoError(suite.T(), err)
+
+	order4 := suite.getOrderTemplate()
+	order4.Uuid = "Uuid4"
+	order4.Type = pkg.OrderTypeRefund
+	order4.Project = order.Project
+	order4.PaymentMethodOrderClosedAt = ptypes.TimestampNow()
+	err = suite.repository.Insert(context.TODO(), order4)
+	assert.NoError(suite.T(), err)
+
+	filter := &internalPkg.PaidOrderFilter{MerchantId: order.Project.MerchantId, Limit: 10}
+	orders, err := suite.repository.FindPaid(context.TODO(), filter)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), orders, 2)
+	assert.Equal(suite.T(), order.Id, orders[0].Id)
+	assert.Equal(suite.T(), order2.Id, orders[1].Id)
+
+	filter.PmOrderCloseDateFrom = closedAt.Add(time.Minute)
+	orders, err = suite.repository.FindPaid(context.TODO(), filter)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), orders, 1)
+	assert.Equal(suite.T(), order2.Id, orders[0].Id)
+
+	filter = &internalPkg.PaidOrderFilter{Ids: []string{order.Id, order3.Id}, Limit: 10}
+	orders, err = suite.repository.FindPaid(context.TODO(), filter)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), orders, 1)
+	assert.Equal(suite.T(), order.Id, orders[0].Id)
+}
+
+func (suite *OrderTestSuite) TestOrder_FindPaid_InvalidId() {
+	filter := &internalPkg.PaidOrderFilter{Ids: []string{"invalid"}, Limit: 10}
+	_, err := suite.repository.FindPaid(context.TODO(), filter)
+	assert.Error(suite.T(), err)
+}
+
 func (suite *OrderTestSuite) getOrderTemplate() *billingpb.Order {
 	return &billingpb.Order{
 		Id: primitive.NewObjectID().Hex(),
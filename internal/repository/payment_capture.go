@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+)
+
+type paymentCaptureRepository repository
+
+// NewPaymentCaptureRepository create and return an object for working with the payment capture repository.
+// The returned object implements the PaymentCaptureRepositoryInterface interface.
+func NewPaymentCaptureRepository(db mongodb.SourceInterface) PaymentCaptureRepositoryInterface {
+	s := &paymentCaptureRepository{db: db}
+	return s
+}
+
+func (h *paymentCaptureRepository) Claim(ctx context.Context, capture *internalPkg.PaymentCapture) (bool, error) {
+	_, err := h.db.Collection(collectionPaymentCapture).InsertOne(ctx, capture)
+
+	if err != nil {
+		if isDuplicateKeyError(err) {
+			return false, nil
+		}
+
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionPaymentCapture),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationInsert),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, capture),
+		)
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (h *paymentCaptureRepository) Delete(ctx context.Context, orderId string) error {
+	query := bson.M{"_id": orderId}
+	_, err := h.db.Collection(collectionPaymentCapture).DeleteOne(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionPaymentCapture),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *paymentCaptureRepository) GetByOrderId(ctx context.Context, orderId string) (*internalPkg.PaymentCapture, error) {
+	var capture *internalPkg.PaymentCapture
+
+	query := bson.M{"_id": orderId}
+	err := h.db.Collection(collectionPaymentCapture).FindOne(ctx, query).Decode(&capture)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return capture, nil
+}
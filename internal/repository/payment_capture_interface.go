@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+)
+
+const (
+	collectionPaymentCapture = "payment_capture"
+)
+
+// PaymentCaptureRepositoryInterface is abstraction layer for working with requested captures of authorized payments
+// and representation in database.
+type PaymentCaptureRepositoryInterface interface {
+	// Claim adds capture of payment to the collection if capture of the order payment isn't requested yet.
+	// Returns false if capture of the order payment already exists.
+	Claim(context.Context, *internalPkg.PaymentCapture) (bool, error)
+
+	// Delete removes capture of the order payment from the collection.
+	Delete(context.Context, string) error
+
+	// GetByOrderId returns capture of the order payment by order identifier.
+	GetByOrderId(context.Context, string) (*internalPkg.PaymentCapture, error)
+}
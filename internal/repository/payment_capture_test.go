@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type PaymentCaptureTestSuite struct {
+	suite.Suite
+	db         mongodb.SourceInterface
+	repository PaymentCaptureRepositoryInterface
+	log        *zap.Logger
+}
+
+func Test_PaymentCapture(t *testing.T) {
+	suite.Run(t, new(PaymentCaptureTestSuite))
+}
+
+func (suite *PaymentCaptureTestSuite) SetupTest() {
+	_, err := config.NewConfig()
+	assert.NoError(suite.T(), err, "Config load failed")
+
+	suite.log, err = zap.NewProduction()
+	assert.NoError(suite.T(), err, "Logger initialization failed")
+
+	suite.db, err = mongodb.NewDatabase()
+	assert.NoError(suite.T(), err, "Database connection failed")
+
+	suite.repository = NewPaymentCaptureRepository(suite.db)
+}
+
+func (suite *PaymentCaptureTestSuite) TearDownTest() {
+	if err := suite.db.Drop(); err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	if err := suite.db.Close(); err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *PaymentCaptureTestSuite) TestPaymentCapture_NewPaymentCaptureRepository_Ok() {
+	repository := NewPaymentCaptureRepository(suite.db)
+	assert.IsType(suite.T(), &paymentCaptureRepository{}, repository)
+}
+
+func (suite *PaymentCaptureTestSuite) TestPaymentCapture_Claim_Ok() {
+	capture := suite.getPaymentCapture(60)
+	ok, err := suite.repository.Claim(context.TODO(), capture)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	// capture of the same payment can't be requested twice
+	capture2 := suite.getPaymentCapture(100)
+	capture2.OrderId = capture.OrderId
+	ok, err = suite.repository.Claim(context.TODO(), capture2)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+
+	capture3, err := suite.repository.GetByOrderId(context.TODO(), capture.OrderId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), capture.AuthorizedAmount, capture3.AuthorizedAmount)
+	assert.Equal(suite.T(), capture.CapturedAmount, capture3.CapturedAmount)
+	assert.Equal(suite.T(), capture.Currency, capture3.Currency)
+}
+
+func (suite *PaymentCaptureTestSuite) TestPaymentCapture_Delete_Ok() {
+	capture := suite.getPaymentCapture(100)
+	_, err := suite.repository.Claim(context.TODO(), capture)
+	assert.NoError(suite.T(), err)
+
+	err = suite.repository.Delete(context.TODO(), capture.OrderId)
+	assert.NoError(suite.T(), err)
+
+	_, err = suite.repository.GetByOrderId(context.TODO(), capture.OrderId)
+	assert.Equal(suite.T(), mongo.ErrNoDocuments, err)
+}
+
+func (suite *PaymentCaptureTestSuite) getPaymentCapture(amount float64) *internalPkg.PaymentCapture {
+	return &internalPkg.PaymentCapture{
+		OrderId:          primitive.NewObjectID().Hex(),
+		AuthorizedAmount: 100,
+		CapturedAmount:   amount,
+		Currency:         "RUB",
+		CreatedAt:        time.Now(),
+	}
+}
@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+)
+
+type paymentRouteRepository repository
+
+// NewPaymentRouteRepository create and return an object for working with the payment routes repository.
+// The returned object implements the PaymentRouteRepositoryInterface interface.
+func NewPaymentRouteRepository(db mongodb.SourceInterface) PaymentRouteRepositoryInterface {
+	s := &paymentRouteRepository{db: db}
+	return s
+}
+
+func (h *paymentRouteRepository) Insert(ctx context.Context, route *internalPkg.PaymentRoute) error {
+	_, err := h.db.Collection(collectionPaymentRoute).InsertOne(ctx, route)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionPaymentRoute),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationInsert),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, route),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *paymentRouteRepository) Update(ctx context.Context, route *internalPkg.PaymentRoute) error {
+	_, err := h.db.Collection(collectionPaymentRoute).ReplaceOne(ctx, bson.M{"_id": route.Id}, route)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionPaymentRoute),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpdate),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, route),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *paymentRouteRepository) Delete(ctx context.Context, id string) error {
+	query := bson.M{"_id": id}
+	_, err := h.db.Collection(collectionPaymentRoute).DeleteOne(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionPaymentRoute),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *paymentRouteRepository) GetById(ctx context.Context, id string) (*internalPkg.PaymentRoute, error) {
+	var route *internalPkg.PaymentRoute
+
+	query := bson.M{"_id": id}
+	err := h.db.Collection(collectionPaymentRoute).FindOne(ctx, query).Decode(&route)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionPaymentRoute),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return route, nil
+}
+
+func (h *paymentRouteRepository) FindByPaymentMethodId(
+	ctx context.Context,
+	paymentMethodId string,
+) ([]*internalPkg.PaymentRoute, error) {
+	var routes []*internalPkg.PaymentRoute
+
+	query := bson.M{}
+
+	if paymentMethodId != "" {
+		query["payment_method_id"] = paymentMethodId
+	}
+
+	opts := options.Find().SetSort(bson.M{"payment_method_id": 1, "region": 1, "currency": 1, "mcc_code": 1})
+	cursor, err := h.db.Collection(collectionPaymentRoute).Find(ctx, query, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionPaymentRoute),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &routes)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionPaymentRoute),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return routes, nil
+}
+
+func (h *paymentRouteRepository) GetByParams(
+	ctx context.Context,
+	paymentMethodId, region, currency, mccCode string,
+) (*internalPkg.PaymentRoute, error) {
+	var routes []*internalPkg.PaymentRoute
+
+	query := bson.M{
+		"payment_method_id": paymentMethodId,
+		"region":            bson.M{"$in": []string{region, ""}},
+		"currency":          bson.M{"$in": []string{currency, ""}},
+		"mcc_code":          bson.M{"$in": []string{mccCode, ""}},
+		"is_active":         true,
+	}
+	cursor, err := h.db.Collection(collectionPaymentRoute).Find(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionPaymentRoute),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &routes)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionPaymentRoute),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	var (
+		route *internalPkg.PaymentRoute
+		score = -1
+	)
+
+	// Route with filled field wins over route which matches any value of the field,
+	// the currency is more important than mcc code and the mcc code is more important than region
+	for _, v := range routes {
+		s := 0
+
+		if v.Currency != "" {
+			s += 4
+		}
+
+		if v.MccCode != "" {
+			s += 2
+		}
+
+		if v.Region != "" {
+			s += 1
+		}
+
+		if s > score || (s == score && v.UpdatedAt.After(route.UpdatedAt)) {
+			route = v
+			score = s
+		}
+	}
+
+	if route == nil {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	return route, nil
+}
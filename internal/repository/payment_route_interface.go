@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+)
+
+const (
+	collectionPaymentRoute = "payment_route"
+)
+
+// PaymentRouteRepositoryInterface is abstraction layer for working with payment routes and representation in database.
+type PaymentRouteRepositoryInterface interface {
+	// Insert adds payment route to the collection.
+	Insert(context.Context, *internalPkg.PaymentRoute) error
+
+	// Update updates the payment route in the collection.
+	Update(context.Context, *internalPkg.PaymentRoute) error
+
+	// Delete removes the payment route from the collection.
+	Delete(context.Context, string) error
+
+	// GetById returns a payment route by its identifier.
+	GetById(context.Context, string) (*internalPkg.PaymentRoute, error)
+
+	// FindByPaymentMethodId returns a list of payment routes by the payment method identifier.
+	// If the payment method identifier is empty then all payment routes will be returned.
+	FindByPaymentMethodId(context.Context, string) ([]*internalPkg.PaymentRoute, error)
+
+	// GetByParams returns the most specific active payment route by payment method identifier, payer region,
+	// charge currency and mcc code. Routes with empty region, currency or mcc code match any value of the field.
+	GetByParams(context.Context, string, string, string, string) (*internalPkg.PaymentRoute, error)
+}
@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"context"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type PaymentRouteTestSuite struct {
+	suite.Suite
+	db         mongodb.SourceInterface
+	repository PaymentRouteRepositoryInterface
+	log        *zap.Logger
+}
+
+func Test_PaymentRoute(t *testing.T) {
+	suite.Run(t, new(PaymentRouteTestSuite))
+}
+
+func (suite *PaymentRouteTestSuite) SetupTest() {
+	_, err := config.NewConfig()
+	assert.NoError(suite.T(), err, "Config load failed")
+
+	suite.log, err = zap.NewProduction()
+	assert.NoError(suite.T(), err, "Logger initialization failed")
+
+	suite.db, err = mongodb.NewDatabase()
+	assert.NoError(suite.T(), err, "Database connection failed")
+
+	suite.repository = NewPaymentRouteRepository(suite.db)
+}
+
+func (suite *PaymentRouteTestSuite) TearDownTest() {
+	if err := suite.db.Drop(); err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	if err := suite.db.Close(); err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *PaymentRouteTestSuite) TestPaymentRoute_NewPaymentRouteRepository_Ok() {
+	repository := NewPaymentRouteRepository(suite.db)
+	assert.IsType(suite.T(), &paymentRouteRepository{}, repository)
+}
+
+func (suite *PaymentRouteTestSuite) TestPaymentRoute_Insert_Ok() {
+	route := suite.getPaymentRouteTemplate()
+	err := suite.repository.Insert(context.TODO(), route)
+	assert.NoError(suite.T(), err)
+
+	route2, err := suite.repository.GetById(context.TODO(), route.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), route.Id, route2.Id)
+	assert.Equal(suite.T(), route.PaymentMethodId, route2.PaymentMethodId)
+	assert.Len(suite.T(), route2.Candidates, 2)
+}
+
+func (suite *PaymentRouteTestSuite) TestPaymentRoute_Update_Ok() {
+	route := suite.getPaymentRouteTemplate()
+	err := suite.repository.Insert(context.TODO(), route)
+	assert.NoError(suite.T(), err)
+
+	route.Strategy = internalPkg.PaymentRouteStrategyPriority
+	err = suite.repository.Update(context.TODO(), route)
+	assert.NoError(suite.T(), err)
+
+	route2, err := suite.repository.GetById(context.TODO(), route.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.PaymentRouteStrategyPriority, route2.Strategy)
+}
+
+func (suite *PaymentRouteTestSuite) TestPaymentRoute_Delete_Ok() {
+	route := suite.getPaymentRouteTemplate()
+	err := suite.repository.Insert(context.TODO(), route)
+	assert.NoError(suite.T(), err)
+
+	err = suite.repository.Delete(context.TODO(), route.Id)
+	assert.NoError(suite.T(), err)
+
+	_, err = suite.repository.GetById(context.TODO(), route.Id)
+	assert.Equal(suite.T(), mongo.ErrNoDocuments, err)
+}
+
+func (suite *PaymentRouteTestSuite) TestPaymentRoute_FindByPaymentMethodId_Ok() {
+	route := suite.getPaymentRouteTemplate()
+	err := suite.repository.Insert(context.TODO(), route)
+	assert.NoError(suite.T(), err)
+
+	route2 := suite.getPaymentRouteTemplate()
+	route2.PaymentMethodId = primitive.NewObjectID().Hex()
+	err = suite.repository.Insert(context.TODO(), route2)
+	assert.NoError(suite.T(), err)
+
+	routes, err := suite.repository.FindByPaymentMethodId(context.TODO(), route.PaymentMethodId)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), routes, 1)
+	assert.Equal(suite.T(), route.Id, routes[0].Id)
+
+	routes, err = suite.repository.FindByPaymentMethodId(context.TODO(), "")
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), routes, 2)
+}
+
+func (suite *PaymentRouteTestSuite) TestPaymentRoute_GetByParams_MostSpecificRoute() {
+	common := suite.getPaymentRouteTemplate()
+	common.Region = ""
+	common.Currency = ""
+	common.MccCode = ""
+	err := suite.repository.Insert(context.TODO(), common)
+	assert.NoError(suite.T(), err)
+
+	byCurrency := suite.getPaymentRouteTemplate()
+	byCurrency.PaymentMethodId = common.PaymentMethodId
+	byCurrency.Region = ""
+	byCurrency.MccCode = ""
+	err = suite.repository.Insert(context.TODO(), byCurrency)
+	assert.NoError(suite.T(), err)
+
+	route, err := suite.repository.GetByParams(context.TODO(), common.PaymentMethodId, "europe", "EUR", "5816")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), common.Id, route.Id)
+
+	route, err = suite.repository.GetByParams(context.TODO(), common.PaymentMethodId, "europe", "USD", "5816")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), byCurrency.Id, route.Id)
+}
+
+func (suite *PaymentRouteTestSuite) TestPaymentRoute_GetByParams_InactiveNotFound() {
+	route := suite.getPaymentRouteTemplate()
+	route.IsActive = false
+	err := suite.repository.Insert(context.TODO(), route)
+	assert.NoError(suite.T(), err)
+
+	_, err = suite.repository.GetByParams(context.TODO(), route.PaymentMethodId, route.Region, route.Currency, route.MccCode)
+	assert.Equal(suite.T(), mongo.ErrNoDocuments, err)
+}
+
+func (suite *PaymentRouteTestSuite) getPaymentRouteTemplate() *internalPkg.PaymentRoute {
+	return &internalPkg.PaymentRoute{
+		Id:              primitive.NewObjectID().Hex(),
+		PaymentMethodId: primitive.NewObjectID().Hex(),
+		Region:          "north_america",
+		Currency:        "USD",
+		MccCode:         "5816",
+		Strategy:        internalPkg.PaymentRouteStrategyCost,
+		Candidates: []*internalPkg.PaymentRouteCandidate{
+			{PaymentSystemId: primitive.NewObjectID().Hex(), Priority: 1},
+			{PaymentSystemId: primitive.NewObjectID().Hex(), Priority: 2},
+		},
+		IsActive:  true,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+}
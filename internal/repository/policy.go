@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+)
+
+type policyRepository struct {
+	db         mongodb.SourceInterface
+	collection string
+}
+
+// NewDunningPolicyRepository create and return an object for working with the dunning policies of projects.
+// The returned object implements the PolicyRepositoryInterface interface.
+func NewDunningPolicyRepository(db mongodb.SourceInterface) PolicyRepositoryInterface {
+	return newPolicyRepository(db, collectionDunningPolicy)
+}
+
+// NewFraudPolicyRepository create and return an object for working with the fraud policies of projects.
+// The returned object implements the PolicyRepositoryInterface interface.
+func NewFraudPolicyRepository(db mongodb.SourceInterface) PolicyRepositoryInterface {
+	return newPolicyRepository(db, collectionFraudPolicy)
+}
+
+// NewRefundApprovalPolicyRepository create and return an object for working with the refund approval policies
+// of merchants. The returned object implements the PolicyRepositoryInterface interface.
+func NewRefundApprovalPolicyRepository(db mongodb.SourceInterface) PolicyRepositoryInterface {
+	return newPolicyRepository(db, collectionRefundApprovalPolicy)
+}
+
+// NewDuplicatePaymentPolicyRepository create and return an object for working with the duplicate payment policies
+// of merchants. The returned object implements the PolicyRepositoryInterface interface.
+func NewDuplicatePaymentPolicyRepository(db mongodb.SourceInterface) PolicyRepositoryInterface {
+	return newPolicyRepository(db, collectionDuplicatePaymentPolicy)
+}
+
+func newPolicyRepository(db mongodb.SourceInterface, collection string) PolicyRepositoryInterface {
+	s := &policyRepository{db: db, collection: collection}
+	return s
+}
+
+func (h *policyRepository) Upsert(ctx context.Context, ownerId string, policy interface{}) error {
+	filter := bson.M{"_id": ownerId}
+	opts := options.Replace().SetUpsert(true)
+	_, err := h.db.Collection(h.collection).ReplaceOne(ctx, filter, policy, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, h.collection),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpsert),
+			zap.Any(pkg.ErrorDatabaseFieldDocument, policy),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *policyRepository) GetByOwnerId(ctx context.Context, ownerId string, policy interface{}) error {
+	query := bson.M{"_id": ownerId}
+	return h.db.Collection(h.collection).FindOne(ctx, query).Decode(policy)
+}
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+)
+
+const (
+	collectionDunningPolicy          = "dunning_policy"
+	collectionFraudPolicy            = "fraud_policy"
+	collectionRefundApprovalPolicy   = "refund_approval_policy"
+	collectionDuplicatePaymentPolicy = "duplicate_payment_policy"
+)
+
+// PolicyRepositoryInterface is abstraction layer for working with policies overridden for their owners (projects
+// or merchants) and representation in database. Policy is stored in the collection of the policy type
+// by the owner identifier.
+type PolicyRepositoryInterface interface {
+	// Upsert adds or updates policy of the owner.
+	Upsert(context.Context, string, interface{}) error
+
+	// GetByOwnerId decodes policy of the owner into the value which must be a pointer to policy.
+	GetByOwnerId(context.Context, string, interface{}) error
+}
@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"context"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type PolicyTestSuite struct {
+	suite.Suite
+	db  mongodb.SourceInterface
+	log *zap.Logger
+}
+
+func Test_Policy(t *testing.T) {
+	suite.Run(t, new(PolicyTestSuite))
+}
+
+func (suite *PolicyTestSuite) SetupTest() {
+	_, err := config.NewConfig()
+	assert.NoError(suite.T(), err, "Config load failed")
+
+	suite.log, err = zap.NewProduction()
+	assert.NoError(suite.T(), err, "Logger initialization failed")
+
+	suite.db, err = mongodb.NewDatabase()
+	assert.NoError(suite.T(), err, "Database connection failed")
+}
+
+func (suite *PolicyTestSuite) TearDownTest() {
+	if err := suite.db.Drop(); err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	if err := suite.db.Close(); err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *PolicyTestSuite) TestPolicy_NewPolicyRepository_Ok() {
+	repository := NewDunningPolicyRepository(suite.db)
+	assert.IsType(suite.T(), &policyRepository{}, repository)
+	assert.Equal(suite.T(), collectionDunningPolicy, repository.(*policyRepository).collection)
+
+	repository = NewFraudPolicyRepository(suite.db)
+	assert.IsType(suite.T(), &policyRepository{}, repository)
+	assert.Equal(suite.T(), collectionFraudPolicy, repository.(*policyRepository).collection)
+
+	repository = NewRefundApprovalPolicyRepository(suite.db)
+	assert.IsType(suite.T(), &policyRepository{}, repository)
+	assert.Equal(suite.T(), collectionRefundApprovalPolicy, repository.(*policyRepository).collection)
+
+	repository = NewDuplicatePaymentPolicyRepository(suite.db)
+	assert.IsType(suite.T(), &policyRepository{}, repository)
+	assert.Equal(suite.T(), collectionDuplicatePaymentPolicy, repository.(*policyRepository).collection)
+}
+
+func (suite *PolicyTestSuite) TestPolicy_Upsert_DunningPolicy() {
+	repository := NewDunningPolicyRepository(suite.db)
+	retryHour := int32(9)
+	policy := &internalPkg.DunningPolicy{
+		ProjectId:                     primitive.NewObjectID().Hex(),
+		RetryIntervals:                []int64{3600, 86400},
+		MaxAttempts:                   2,
+		RetryHour:                     &retryHour,
+		HardDeclineCodes:              []string{"41", "43"},
+		InsufficientFundsDeclineCodes: []string{"51"},
+		UpdatedAt:                     time.Now(),
+	}
+	err := repository.Upsert(context.TODO(), policy.ProjectId, policy)
+	assert.NoError(suite.T(), err)
+
+	policy2 := &internalPkg.DunningPolicy{}
+	err = repository.GetByOwnerId(context.TODO(), policy.ProjectId, policy2)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), policy.RetryIntervals, policy2.RetryIntervals)
+	assert.Equal(suite.T(), policy.MaxAttempts, policy2.MaxAttempts)
+	assert.Equal(suite.T(), retryHour, *policy2.RetryHour)
+	assert.Equal(suite.T(), policy.HardDeclineCodes, policy2.HardDeclineCodes)
+	assert.Equal(suite.T(), policy.InsufficientFundsDeclineCodes, policy2.InsufficientFundsDeclineCodes)
+
+	policy.MaxAttempts = 5
+	policy.RetryHour = nil
+	err = repository.Upsert(context.TODO(), policy.ProjectId, policy)
+	assert.NoError(suite.T(), err)
+
+	policy2 = &internalPkg.DunningPolicy{}
+	err = repository.GetByOwnerId(context.TODO(), policy.ProjectId, policy2)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int32(5), policy2.MaxAttempts)
+	assert.Nil(suite.T(), policy2.RetryHour)
+}
+
+func (suite *PolicyTestSuite) TestPolicy_Upsert_FraudPolicy() {
+	repository := NewFraudPolicyRepository(suite.db)
+	policy := &internalPkg.FraudPolicy{
+		ProjectId:           primitive.NewObjectID().Hex(),
+		ReviewScore:         20,
+		BlockScore:          60,
+		VelocityWindow:      60,
+		VelocityLimit:       5,
+		AmountAnomalyFactor: 3,
+		UpdatedAt:           time.Now(),
+	}
+	err := repository.Upsert(context.TODO(), policy.ProjectId, policy)
+	assert.NoError(suite.T(), err)
+
+	policy2 := &internalPkg.FraudPolicy{}
+	err = repository.GetByOwnerId(context.TODO(), policy.ProjectId, policy2)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), policy.ReviewScore, policy2.ReviewScore)
+	assert.Equal(suite.T(), policy.BlockScore, policy2.BlockScore)
+	assert.Equal(suite.T(), policy.VelocityWindow, policy2.VelocityWindow)
+	assert.Equal(suite.T(), policy.VelocityLimit, policy2.VelocityLimit)
+	assert.Equal(suite.T(), policy.AmountAnomalyFactor, policy2.AmountAnomalyFactor)
+}
+
+func (suite *PolicyTestSuite) TestPolicy_Upsert_RefundApprovalPolicy() {
+	repository := NewRefundApprovalPolicyRepository(suite.db)
+	policy := &internalPkg.RefundApprovalPolicy{
+		MerchantId:       primitive.NewObjectID().Hex(),
+		AmountThreshold:  100,
+		Currency:         "EUR",
+		DaysAfterPayment: 30,
+		UpdatedAt:        time.Now(),
+	}
+	err := repository.Upsert(context.TODO(), policy.MerchantId, policy)
+	assert.NoError(suite.T(), err)
+
+	policy2 := &internalPkg.RefundApprovalPolicy{}
+	err = repository.GetByOwnerId(context.TODO(), policy.MerchantId, policy2)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), policy.AmountThreshold, policy2.AmountThreshold)
+	assert.Equal(suite.T(), policy.Currency, policy2.Currency)
+	assert.Equal(suite.T(), policy.DaysAfterPayment, policy2.DaysAfterPayment)
+
+	policy.DaysAfterPayment = 0
+	err = repository.Upsert(context.TODO(), policy.MerchantId, policy)
+	assert.NoError(suite.T(), err)
+
+	policy2 = &internalPkg.RefundApprovalPolicy{}
+	err = repository.GetByOwnerId(context.TODO(), policy.MerchantId, policy2)
+	assert.NoError(suite.T(), err)
+	assert.Zero(suite.T(), policy2.DaysAfterPayment)
+}
+
+func (suite *PolicyTestSuite) TestPolicy_Upsert_DuplicatePaymentPolicy() {
+	repository := NewDuplicatePaymentPolicyRepository(suite.db)
+	policy := &internalPkg.DuplicatePaymentPolicy{
+		MerchantId: primitive.NewObjectID().Hex(),
+		Action:     internalPkg.DuplicatePaymentActionRefund,
+		Window:     600,
+		UpdatedAt:  time.Now(),
+	}
+	err := repository.Upsert(context.TODO(), policy.MerchantId, policy)
+	assert.NoError(suite.T(), err)
+
+	policy2 := &internalPkg.DuplicatePaymentPolicy{}
+	err = repository.GetByOwnerId(context.TODO(), policy.MerchantId, policy2)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), policy.Action, policy2.Action)
+	assert.Equal(suite.T(), policy.Window, policy2.Window)
+
+	policy.Action = internalPkg.DuplicatePaymentActionReview
+	err = repository.Upsert(context.TODO(), policy.MerchantId, policy)
+	assert.NoError(suite.T(), err)
+
+	policy2 = &internalPkg.DuplicatePaymentPolicy{}
+	err = repository.GetByOwnerId(context.TODO(), policy.MerchantId, policy2)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.DuplicatePaymentActionReview, policy2.Action)
+}
+
+func (suite *PolicyTestSuite) TestPolicy_Upsert_CollectionsSeparated() {
+	projectId := primitive.NewObjectID().Hex()
+	policy := &internalPkg.FraudPolicy{ProjectId: projectId, ReviewScore: 20, BlockScore: 60}
+	err := NewFraudPolicyRepository(suite.db).Upsert(context.TODO(), projectId, policy)
+	assert.NoError(suite.T(), err)
+
+	err = NewDunningPolicyRepository(suite.db).GetByOwnerId(context.TODO(), projectId, &internalPkg.DunningPolicy{})
+	assert.Equal(suite.T(), mongo.ErrNoDocuments, err)
+}
+
+func (suite *PolicyTestSuite) TestPolicy_GetByOwnerId_NotFound() {
+	repository := NewFraudPolicyRepository(suite.db)
+	err := repository.GetByOwnerId(context.TODO(), primitive.NewObjectID().Hex(), &internalPkg.FraudPolicy{})
+	assert.Equal(suite.T(), mongo.ErrNoDocuments, err)
+}
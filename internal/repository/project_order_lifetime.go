@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+)
+
+type projectOrderLifetimeRepository repository
+
+// NewProjectOrderLifetimeRepository create and return an object for working with the project order lifetime repository.
+// The returned object implements the ProjectOrderLifetimeRepositoryInterface interface.
+func NewProjectOrderLifetimeRepository(db mongodb.SourceInterface) ProjectOrderLifetimeRepositoryInterface {
+	s := &projectOrderLifetimeRepository{db: db}
+	return s
+}
+
+func (h *projectOrderLifetimeRepository) Upsert(ctx context.Context, lifetime *internalPkg.ProjectOrderLifetime) error {
+	filter := bson.M{"_id": lifetime.ProjectId}
+	opts := options.Replace().SetUpsert(true)
+	_, err := h.db.Collection(collectionProjectOrderLifetime).ReplaceOne(ctx, filter, lifetime, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionProjectOrderLifetime),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpsert),
+			zap.Any(pkg.ErrorDatabaseFieldDocument, lifetime),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *projectOrderLifetimeRepository) Delete(ctx context.Context, projectId string) error {
+	query := bson.M{"_id": projectId}
+	_, err := h.db.Collection(collectionProjectOrderLifetime).DeleteOne(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionProjectOrderLifetime),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *projectOrderLifetimeRepository) GetByProjectId(
+	ctx context.Context,
+	projectId string,
+) (*internalPkg.ProjectOrderLifetime, error) {
+	var lifetime *internalPkg.ProjectOrderLifetime
+
+	query := bson.M{"_id": projectId}
+	err := h.db.Collection(collectionProjectOrderLifetime).FindOne(ctx, query).Decode(&lifetime)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return lifetime, nil
+}
+
+func (h *projectOrderLifetimeRepository) GetAll(ctx context.Context) ([]*internalPkg.ProjectOrderLifetime, error) {
+	var lifetimes []*internalPkg.ProjectOrderLifetime
+
+	query := bson.M{}
+	cursor, err := h.db.Collection(collectionProjectOrderLifetime).Find(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionProjectOrderLifetime),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &lifetimes)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionProjectOrderLifetime),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return lifetimes, nil
+}
@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+)
+
+const (
+	collectionProjectOrderLifetime = "project_order_lifetime"
+)
+
+// ProjectOrderLifetimeRepositoryInterface is abstraction layer for working with lifetime of orders overridden
+// for projects and representation in database.
+type ProjectOrderLifetimeRepositoryInterface interface {
+	// Upsert adds or updates lifetime of orders of the project.
+	Upsert(context.Context, *internalPkg.ProjectOrderLifetime) error
+
+	// Delete removes lifetime of orders of the project, so default lifetime is used for it.
+	Delete(context.Context, string) error
+
+	// GetByProjectId returns lifetime of orders by the project identifier.
+	GetByProjectId(context.Context, string) (*internalPkg.ProjectOrderLifetime, error)
+
+	// GetAll returns lifetimes of orders of all projects for which it's overridden.
+	GetAll(context.Context) ([]*internalPkg.ProjectOrderLifetime, error)
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type ProjectOrderLifetimeTestSuite struct {
+	suite.Suite
+	db         mongodb.SourceInterface
+	repository ProjectOrderLifetimeRepositoryInterface
+	log        *zap.Logger
+}
+
+func Test_ProjectOrderLifetime(t *testing.T) {
+	suite.Run(t, new(ProjectOrderLifetimeTestSuite))
+}
+
+func (suite *ProjectOrderLifetimeTestSuite) SetupTest() {
+	_, err := config.NewConfig()
+	assert.NoError(suite.T(), err, "Config load failed")
+
+	suite.log, err = zap.NewProduction()
+	assert.NoError(suite.T(), err, "Logger initialization failed")
+
+	suite.db, err = mongodb.NewDatabase()
+	assert.NoError(suite.T(), err, "Database connection failed")
+
+	suite.repository = NewProjectOrderLifetimeRepository(suite.db)
+}
+
+func (suite *ProjectOrderLifetimeTestSuite) TearDownTest() {
+	if err := suite.db.Drop(); err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	if err := suite.db.Close(); err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *ProjectOrderLifetimeTestSuite) TestProjectOrderLifetime_NewProjectOrderLifetimeRepository_Ok() {
+	repository := NewProjectOrderLifetimeRepository(suite.db)
+	assert.IsType(suite.T(), &projectOrderLifetimeRepository{}, repository)
+}
+
+func (suite *ProjectOrderLifetimeTestSuite) TestProjectOrderLifetime_Upsert_Ok() {
+	lifetime := &internalPkg.ProjectOrderLifetime{
+		ProjectId: primitive.NewObjectID().Hex(),
+		Lifetime:  3600,
+		UpdatedAt: time.Now(),
+	}
+	err := suite.repository.Upsert(context.TODO(), lifetime)
+	assert.NoError(suite.T(), err)
+
+	lifetime2, err := suite.repository.GetByProjectId(context.TODO(), lifetime.ProjectId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), lifetime.Lifetime, lifetime2.Lifetime)
+
+	lifetime.Lifetime = 60
+	err = suite.repository.Upsert(context.TODO(), lifetime)
+	assert.NoError(suite.T(), err)
+
+	lifetime2, err = suite.repository.GetByProjectId(context.TODO(), lifetime.ProjectId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(60), lifetime2.Lifetime)
+
+	lifetimes, err := suite.repository.GetAll(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), lifetimes, 1)
+}
+
+func (suite *ProjectOrderLifetimeTestSuite) TestProjectOrderLifetime_Delete_Ok() {
+	lifetime := &internalPkg.ProjectOrderLifetime{
+		ProjectId: primitive.NewObjectID().Hex(),
+		Lifetime:  3600,
+		UpdatedAt: time.Now(),
+	}
+	err := suite.repository.Upsert(context.TODO(), lifetime)
+	assert.NoError(suite.T(), err)
+
+	err = suite.repository.Delete(context.TODO(), lifetime.ProjectId)
+	assert.NoError(suite.T(), err)
+
+	_, err = suite.repository.GetByProjectId(context.TODO(), lifetime.ProjectId)
+	assert.Equal(suite.T(), mongo.ErrNoDocuments, err)
+
+	lifetimes, err := suite.repository.GetAll(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), lifetimes)
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/paysuper/paysuper-proto/go/billingpb"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
 	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
@@ -50,7 +51,7 @@ func (h *refundRepository) Update(ctx context.Context, refund *billingpb.Refund)
 		return err
 	}
 
-	_, err = h.db.Collection(CollectionRefund).ReplaceOne(ctx, bson.M{"_id": oid}, refund)
+	_, err = h.db.Collection(CollectionRefund).UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$set": refund})
 
 	if err != nil {
 		zap.L().Error(
@@ -66,6 +67,89 @@ func (h *refundRepository) Update(ctx context.Context, refund *billingpb.Refund)
 	return nil
 }
 
+func (h *refundRepository) ClaimApproval(
+	ctx context.Context,
+	id string,
+	status int32,
+	approverId string,
+) (*billingpb.Refund, error) {
+	var refund *billingpb.Refund
+	oid, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseInvalidObjectId,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, CollectionRefund),
+			zap.String(pkg.ErrorDatabaseFieldQuery, id),
+		)
+		return nil, err
+	}
+
+	query := bson.M{"_id": oid, "status": pkg.RefundStatusPendingApproval}
+	update := bson.M{
+		"$set": bson.M{
+			"status":      status,
+			"approver_id": approverId,
+		},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = h.db.Collection(CollectionRefund).FindOneAndUpdate(ctx, query, update, opts).Decode(&refund)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, CollectionRefund),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpdate),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+			zap.Any(pkg.ErrorDatabaseFieldSet, update),
+		)
+		return nil, err
+	}
+
+	return refund, nil
+}
+
+func (h *refundRepository) ReleaseApproval(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseInvalidObjectId,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, CollectionRefund),
+			zap.String(pkg.ErrorDatabaseFieldQuery, id),
+		)
+		return err
+	}
+
+	query := bson.M{"_id": oid, "status": pkg.RefundStatusCreated}
+	update := bson.M{
+		"$set":   bson.M{"status": pkg.RefundStatusPendingApproval},
+		"$unset": bson.M{"approver_id": ""},
+	}
+	_, err = h.db.Collection(CollectionRefund).UpdateOne(ctx, query, update)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, CollectionRefund),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpdate),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+			zap.Any(pkg.ErrorDatabaseFieldSet, update),
+		)
+		return err
+	}
+
+	return nil
+}
+
 func (h *refundRepository) GetById(ctx context.Context, id string) (*billingpb.Refund, error) {
 	var refund *billingpb.Refund
 	oid, err := primitive.ObjectIDFromHex(id)
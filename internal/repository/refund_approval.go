@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+)
+
+type refundApprovalRepository repository
+
+// NewRefundApprovalRepository create and return an object for working with the refund approval repository.
+// The returned object implements the RefundApprovalRepositoryInterface interface.
+func NewRefundApprovalRepository(db mongodb.SourceInterface) RefundApprovalRepositoryInterface {
+	s := &refundApprovalRepository{db: db}
+	return s
+}
+
+func (h *refundApprovalRepository) Insert(ctx context.Context, approval *internalPkg.RefundApproval) error {
+	_, err := h.db.Collection(collectionRefundApproval).InsertOne(ctx, approval)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionRefundApproval),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationInsert),
+			zap.Any(pkg.ErrorDatabaseFieldDocument, approval),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *refundApprovalRepository) Update(ctx context.Context, approval *internalPkg.RefundApproval) error {
+	_, err := h.db.Collection(collectionRefundApproval).ReplaceOne(ctx, bson.M{"_id": approval.Id}, approval)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionRefundApproval),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpdate),
+			zap.Any(pkg.ErrorDatabaseFieldDocument, approval),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *refundApprovalRepository) GetById(ctx context.Context, id string) (*internalPkg.RefundApproval, error) {
+	var approval *internalPkg.RefundApproval
+
+	query := bson.M{"_id": id}
+	err := h.db.Collection(collectionRefundApproval).FindOne(ctx, query).Decode(&approval)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return approval, nil
+}
+
+func (h *refundApprovalRepository) Find(
+	ctx context.Context,
+	req *internalPkg.ListRefundApprovalsRequest,
+) ([]*internalPkg.RefundApproval, error) {
+	var approvals []*internalPkg.RefundApproval
+
+	query := h.getFindQuery(req)
+	opts := options.Find().
+		SetSort(bson.M{"created_at": -1}).
+		SetLimit(req.Limit).
+		SetSkip(req.Offset)
+	cursor, err := h.db.Collection(collectionRefundApproval).Find(ctx, query, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionRefundApproval),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &approvals)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionRefundApproval),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return approvals, nil
+}
+
+func (h *refundApprovalRepository) FindCount(
+	ctx context.Context,
+	req *internalPkg.ListRefundApprovalsRequest,
+) (int64, error) {
+	query := h.getFindQuery(req)
+	count, err := h.db.Collection(collectionRefundApproval).CountDocuments(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionRefundApproval),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (h *refundApprovalRepository) getFindQuery(req *internalPkg.ListRefundApprovalsRequest) bson.M {
+	query := bson.M{}
+
+	if req.MerchantId != "" {
+		query["merchant_id"] = req.MerchantId
+	}
+
+	if req.Status != "" {
+		query["status"] = req.Status
+	}
+
+	return query
+}
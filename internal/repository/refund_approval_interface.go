@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+)
+
+const (
+	collectionRefundApproval = "refund_approval"
+)
+
+// RefundApprovalRepositoryInterface is abstraction layer for working with approvals of refunds
+// and representation in database.
+type RefundApprovalRepositoryInterface interface {
+	// Insert adds the refund approval to the collection.
+	Insert(context.Context, *internalPkg.RefundApproval) error
+
+	// Update updates the refund approval in the collection.
+	Update(context.Context, *internalPkg.RefundApproval) error
+
+	// GetById returns the approval by the refund identifier.
+	GetById(context.Context, string) (*internalPkg.RefundApproval, error)
+
+	// Find returns a list of refund approvals by the filter ordered from newest to oldest.
+	Find(context.Context, *internalPkg.ListRefundApprovalsRequest) ([]*internalPkg.RefundApproval, error)
+
+	// FindCount returns the number of refund approvals by the filter.
+	FindCount(context.Context, *internalPkg.ListRefundApprovalsRequest) (int64, error)
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type RefundApprovalTestSuite struct {
+	suite.Suite
+	db         mongodb.SourceInterface
+	repository RefundApprovalRepositoryInterface
+	log        *zap.Logger
+}
+
+func Test_RefundApproval(t *testing.T) {
+	suite.Run(t, new(RefundApprovalTestSuite))
+}
+
+func (suite *RefundApprovalTestSuite) SetupTest() {
+	_, err := config.NewConfig()
+	assert.NoError(suite.T(), err, "Config load failed")
+
+	suite.log, err = zap.NewProduction()
+	assert.NoError(suite.T(), err, "Logger initialization failed")
+
+	suite.db, err = mongodb.NewDatabase()
+	assert.NoError(suite.T(), err, "Database connection failed")
+
+	suite.repository = NewRefundApprovalRepository(suite.db)
+}
+
+func (suite *RefundApprovalTestSuite) TearDownTest() {
+	if err := suite.db.Drop(); err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	if err := suite.db.Close(); err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *RefundApprovalTestSuite) TestRefundApproval_NewRefundApprovalRepository_Ok() {
+	repository := NewRefundApprovalRepository(suite.db)
+	assert.IsType(suite.T(), &refundApprovalRepository{}, repository)
+}
+
+func (suite *RefundApprovalTestSuite) TestRefundApproval_InsertUpdateGetById_Ok() {
+	approval := suite.getRefundApproval(primitive.NewObjectID().Hex(), time.Now())
+	err := suite.repository.Insert(context.TODO(), approval)
+	assert.NoError(suite.T(), err)
+
+	decidedAt := time.Now()
+	approval.Status = internalPkg.RefundApprovalStatusApproved
+	approval.ApproverId = primitive.NewObjectID().Hex()
+	approval.DecidedAt = &decidedAt
+	err = suite.repository.Update(context.TODO(), approval)
+	assert.NoError(suite.T(), err)
+
+	approval2, err := suite.repository.GetById(context.TODO(), approval.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.RefundApprovalStatusApproved, approval2.Status)
+	assert.Equal(suite.T(), approval.ApproverId, approval2.ApproverId)
+	assert.Equal(suite.T(), approval.Reasons, approval2.Reasons)
+	assert.NotNil(suite.T(), approval2.DecidedAt)
+}
+
+func (suite *RefundApprovalTestSuite) TestRefundApproval_GetById_NotFound() {
+	_, err := suite.repository.GetById(context.TODO(), primitive.NewObjectID().Hex())
+	assert.Equal(suite.T(), mongo.ErrNoDocuments, err)
+}
+
+func (suite *RefundApprovalTestSuite) TestRefundApproval_FindFindCount_Ok() {
+	merchantId := primitive.NewObjectID().Hex()
+
+	old := suite.getRefundApproval(merchantId, time.Now().Add(-time.Hour))
+	err := suite.repository.Insert(context.TODO(), old)
+	assert.NoError(suite.T(), err)
+
+	last := suite.getRefundApproval(merchantId, time.Now())
+	last.Status = internalPkg.RefundApprovalStatusRejected
+	err = suite.repository.Insert(context.TODO(), last)
+	assert.NoError(suite.T(), err)
+
+	err = suite.repository.Insert(context.TODO(), suite.getRefundApproval(primitive.NewObjectID().Hex(), time.Now()))
+	assert.NoError(suite.T(), err)
+
+	req := &internalPkg.ListRefundApprovalsRequest{MerchantId: merchantId, Limit: 10}
+	count, err := suite.repository.FindCount(context.TODO(), req)
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), 2, count)
+
+	list, err := suite.repository.Find(context.TODO(), req)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), list, 2)
+	assert.Equal(suite.T(), last.Id, list[0].Id)
+	assert.Equal(suite.T(), old.Id, list[1].Id)
+
+	req.Status = internalPkg.RefundApprovalStatusPending
+	list, err = suite.repository.Find(context.TODO(), req)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), list, 1)
+	assert.Equal(suite.T(), old.Id, list[0].Id)
+}
+
+func (suite *RefundApprovalTestSuite) getRefundApproval(merchantId string, createdAt time.Time) *internalPkg.RefundApproval {
+	return &internalPkg.RefundApproval{
+		Id:         primitive.NewObjectID().Hex(),
+		OrderId:    primitive.NewObjectID().Hex(),
+		MerchantId: merchantId,
+		Amount:     150,
+		Currency:   "EUR",
+		Status:     internalPkg.RefundApprovalStatusPending,
+		Reasons:    []string{internalPkg.RefundApprovalReasonAmount},
+		CreatorId:  primitive.NewObjectID().Hex(),
+		CreatedAt:  createdAt,
+	}
+}
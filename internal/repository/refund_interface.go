@@ -15,9 +15,19 @@ type RefundRepositoryInterface interface {
 	// Insert adds refund to the collection.
 	Insert(context.Context, *billingpb.Refund) error
 
-	// Update updates the refund in the collection.
+	// Update updates the refund in the collection, fields of the refund document which aren't the fields
+	// of refund (approver identifier) are kept.
 	Update(context.Context, *billingpb.Refund) error
 
+	// ClaimApproval moves the refund waiting for approval to the status decided by the approver and stores
+	// the approver identifier in the refund. Returns nil without error if refund isn't waiting for approval
+	// or was claimed by other approver.
+	ClaimApproval(context.Context, string, int32, string) (*billingpb.Refund, error)
+
+	// ReleaseApproval returns the refund claimed by the approver to waiting for approval if it wasn't sent
+	// to the payment system.
+	ReleaseApproval(context.Context, string) error
+
 	// GetById returns a refund by its identifier.
 	GetById(context.Context, string) (*billingpb.Refund, error)
 
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+)
+
+type refundItemsRepository repository
+
+// NewRefundItemsRepository create and return an object for working with the refund items repository.
+// The returned object implements the RefundItemsRepositoryInterface interface.
+func NewRefundItemsRepository(db mongodb.SourceInterface) RefundItemsRepositoryInterface {
+	s := &refundItemsRepository{db: db}
+	return s
+}
+
+func (h *refundItemsRepository) Insert(ctx context.Context, items *internalPkg.RefundItems) error {
+	_, err := h.db.Collection(collectionRefundItems).InsertOne(ctx, items)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionRefundItems),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationInsert),
+			zap.Any(pkg.ErrorDatabaseFieldDocument, items),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *refundItemsRepository) GetByRefundId(ctx context.Context, refundId string) (*internalPkg.RefundItems, error) {
+	var items *internalPkg.RefundItems
+
+	query := bson.M{"_id": refundId}
+	err := h.db.Collection(collectionRefundItems).FindOne(ctx, query).Decode(&items)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (h *refundItemsRepository) FindByOrderId(ctx context.Context, orderId string) ([]*internalPkg.RefundItems, error) {
+	var items []*internalPkg.RefundItems
+
+	query := bson.M{"order_id": orderId}
+	cursor, err := h.db.Collection(collectionRefundItems).Find(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionRefundItems),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &items)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionRefundItems),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return items, nil
+}
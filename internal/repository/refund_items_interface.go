@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+)
+
+const (
+	collectionRefundItems = "refund_items"
+)
+
+// RefundItemsRepositoryInterface is abstraction layer for working with items of order refunded by refunds
+// and representation in database.
+type RefundItemsRepositoryInterface interface {
+	// Insert adds the refunded items to the collection.
+	Insert(context.Context, *internalPkg.RefundItems) error
+
+	// GetByRefundId returns the items refunded by the refund.
+	GetByRefundId(context.Context, string) (*internalPkg.RefundItems, error)
+
+	// FindByOrderId returns the items of order refunded by all refunds of the order.
+	FindByOrderId(context.Context, string) ([]*internalPkg.RefundItems, error)
+}
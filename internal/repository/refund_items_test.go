@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type RefundItemsTestSuite struct {
+	suite.Suite
+	db         mongodb.SourceInterface
+	repository RefundItemsRepositoryInterface
+	log        *zap.Logger
+}
+
+func Test_RefundItems(t *testing.T) {
+	suite.Run(t, new(RefundItemsTestSuite))
+}
+
+func (suite *RefundItemsTestSuite) SetupTest() {
+	_, err := config.NewConfig()
+	assert.NoError(suite.T(), err, "Config load failed")
+
+	suite.log, err = zap.NewProduction()
+	assert.NoError(suite.T(), err, "Logger initialization failed")
+
+	suite.db, err = mongodb.NewDatabase()
+	assert.NoError(suite.T(), err, "Database connection failed")
+
+	suite.repository = NewRefundItemsRepository(suite.db)
+}
+
+func (suite *RefundItemsTestSuite) TearDownTest() {
+	if err := suite.db.Drop(); err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	if err := suite.db.Close(); err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *RefundItemsTestSuite) TestRefundItems_NewRefundItemsRepository_Ok() {
+	repository := NewRefundItemsRepository(suite.db)
+	assert.IsType(suite.T(), &refundItemsRepository{}, repository)
+}
+
+func (suite *RefundItemsTestSuite) TestRefundItems_InsertGetByRefundId_Ok() {
+	items := suite.getRefundItems(primitive.NewObjectID().Hex(), 0, 1)
+	err := suite.repository.Insert(context.TODO(), items)
+	assert.NoError(suite.T(), err)
+
+	items2, err := suite.repository.GetByRefundId(context.TODO(), items.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), items.OrderId, items2.OrderId)
+	assert.Len(suite.T(), items2.Items, 2)
+	assert.EqualValues(suite.T(), 1, items2.Items[1].Index)
+	assert.Equal(suite.T(), items.Items[1].KeyId, items2.Items[1].KeyId)
+}
+
+func (suite *RefundItemsTestSuite) TestRefundItems_Insert_Duplicate() {
+	items := suite.getRefundItems(primitive.NewObjectID().Hex(), 0)
+	err := suite.repository.Insert(context.TODO(), items)
+	assert.NoError(suite.T(), err)
+
+	err = suite.repository.Insert(context.TODO(), items)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *RefundItemsTestSuite) TestRefundItems_GetByRefundId_NotFound() {
+	_, err := suite.repository.GetByRefundId(context.TODO(), primitive.NewObjectID().Hex())
+	assert.Equal(suite.T(), mongo.ErrNoDocuments, err)
+}
+
+func (suite *RefundItemsTestSuite) TestRefundItems_FindByOrderId_Ok() {
+	orderId := primitive.NewObjectID().Hex()
+
+	err := suite.repository.Insert(context.TODO(), suite.getRefundItems(orderId, 0))
+	assert.NoError(suite.T(), err)
+	err = suite.repository.Insert(context.TODO(), suite.getRefundItems(orderId, 1, 2))
+	assert.NoError(suite.T(), err)
+	err = suite.repository.Insert(context.TODO(), suite.getRefundItems(primitive.NewObjectID().Hex(), 0))
+	assert.NoError(suite.T(), err)
+
+	items, err := suite.repository.FindByOrderId(context.TODO(), orderId)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), items, 2)
+
+	items, err = suite.repository.FindByOrderId(context.TODO(), primitive.NewObjectID().Hex())
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), items)
+}
+
+func (suite *RefundItemsTestSuite) getRefundItems(orderId string, indexes ...int32) *internalPkg.RefundItems {
+	items := &internalPkg.RefundItems{
+		Id:        primitive.NewObjectID().Hex(),
+		OrderId:   orderId,
+		CreatedAt: time.Now(),
+	}
+
+	for _, index := range indexes {
+		items.Items = append(items.Items, &internalPkg.RefundedOrderItem{
+			Index:    index,
+			ItemId:   primitive.NewObjectID().Hex(),
+			Name:     "Item",
+			Amount:   10,
+			Currency: "RUB",
+			KeyId:    primitive.NewObjectID().Hex(),
+		})
+	}
+
+	return items
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/paysuper/paysuper-proto/go/billingpb"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.uber.org/zap"
 	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
@@ -356,3 +357,66 @@ func (suite *RefundTestSuite) TestRefund_GetAmountByOrderId_SkipRejectStatus() {
 	assert.NoError(suite.T(), err)
 	assert.Equal(suite.T(), float64(0), amount)
 }
+
+func (suite *RefundTestSuite) TestRefund_ClaimApproval_Ok() {
+	refund := &billingpb.Refund{
+		Id:        primitive.NewObjectID().Hex(),
+		CreatorId: primitive.NewObjectID().Hex(),
+		OriginalOrder: &billingpb.RefundOrder{
+			Id: primitive.NewObjectID().Hex(),
+		},
+		Status: pkg.RefundStatusPendingApproval,
+		Amount: 10,
+	}
+	err := suite.repository.Insert(context.TODO(), refund)
+	assert.NoError(suite.T(), err)
+
+	approverId := primitive.NewObjectID().Hex()
+	refund2, err := suite.repository.ClaimApproval(context.TODO(), refund.Id, pkg.RefundStatusCreated, approverId)
+	assert.NoError(suite.T(), err)
+	assert.NotNil(suite.T(), refund2)
+	assert.Equal(suite.T(), pkg.RefundStatusCreated, refund2.Status)
+
+	refund3, err := suite.repository.ClaimApproval(context.TODO(), refund.Id, pkg.RefundStatusRejected, approverId)
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), refund3)
+
+	refund2.Reason = "approved"
+	err = suite.repository.Update(context.TODO(), refund2)
+	assert.NoError(suite.T(), err)
+
+	var document bson.M
+	oid, _ := primitive.ObjectIDFromHex(refund.Id)
+	err = suite.db.Collection(CollectionRefund).FindOne(context.TODO(), bson.M{"_id": oid}).Decode(&document)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), approverId, document["approver_id"])
+	assert.Equal(suite.T(), "approved", document["reason"])
+}
+
+func (suite *RefundTestSuite) TestRefund_ReleaseApproval_Ok() {
+	refund := &billingpb.Refund{
+		Id:        primitive.NewObjectID().Hex(),
+		CreatorId: primitive.NewObjectID().Hex(),
+		OriginalOrder: &billingpb.RefundOrder{
+			Id: primitive.NewObjectID().Hex(),
+		},
+		Status: pkg.RefundStatusPendingApproval,
+		Amount: 10,
+	}
+	err := suite.repository.Insert(context.TODO(), refund)
+	assert.NoError(suite.T(), err)
+
+	_, err = suite.repository.ClaimApproval(context.TODO(), refund.Id, pkg.RefundStatusCreated, primitive.NewObjectID().Hex())
+	assert.NoError(suite.T(), err)
+
+	err = suite.repository.ReleaseApproval(context.TODO(), refund.Id)
+	assert.NoError(suite.T(), err)
+
+	refund2, err := suite.repository.GetById(context.TODO(), refund.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), pkg.RefundStatusPendingApproval, refund2.Status)
+
+	refund3, err := suite.repository.ClaimApproval(context.TODO(), refund.Id, pkg.RefundStatusRejected, primitive.NewObjectID().Hex())
+	assert.NoError(suite.T(), err)
+	assert.NotNil(suite.T(), refund3)
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+)
+
+type rollingReserveTermsRepository repository
+
+// NewRollingReserveTermsRepository create and return an object for working with the rolling reserve terms
+// repository. The returned object implements the RollingReserveTermsRepositoryInterface interface.
+func NewRollingReserveTermsRepository(db mongodb.SourceInterface) RollingReserveTermsRepositoryInterface {
+	s := &rollingReserveTermsRepository{db: db}
+	return s
+}
+
+func (h *rollingReserveTermsRepository) Upsert(ctx context.Context, terms *internalPkg.RollingReserveTerms) error {
+	filter := bson.M{"_id": terms.MerchantId}
+	opts := options.Replace().SetUpsert(true)
+	_, err := h.db.Collection(collectionRollingReserveTerms).ReplaceOne(ctx, filter, terms, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionRollingReserveTerms),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpsert),
+			zap.Any(pkg.ErrorDatabaseFieldDocument, terms),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *rollingReserveTermsRepository) GetByMerchantId(
+	ctx context.Context,
+	merchantId string,
+) (*internalPkg.RollingReserveTerms, error) {
+	var terms *internalPkg.RollingReserveTerms
+
+	query := bson.M{"_id": merchantId}
+	err := h.db.Collection(collectionRollingReserveTerms).FindOne(ctx, query).Decode(&terms)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return terms, nil
+}
+
+func (h *rollingReserveTermsRepository) FindWithHoldPeriod(ctx context.Context) ([]*internalPkg.RollingReserveTerms, error) {
+	var terms []*internalPkg.RollingReserveTerms
+
+	query := bson.M{"hold_days": bson.M{"$gt": 0}}
+	cursor, err := h.db.Collection(collectionRollingReserveTerms).Find(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionRollingReserveTerms),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &terms)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionRollingReserveTerms),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return terms, nil
+}
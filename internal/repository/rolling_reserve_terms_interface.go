@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+)
+
+const (
+	collectionRollingReserveTerms = "rolling_reserve_terms"
+)
+
+// RollingReserveTermsRepositoryInterface is abstraction layer for working with rolling reserve terms of merchants
+// and representation in database.
+type RollingReserveTermsRepositoryInterface interface {
+	// Upsert adds or updates rolling reserve terms of the merchant.
+	Upsert(context.Context, *internalPkg.RollingReserveTerms) error
+
+	// GetByMerchantId returns rolling reserve terms by the merchant identifier.
+	GetByMerchantId(context.Context, string) (*internalPkg.RollingReserveTerms, error)
+
+	// FindWithHoldPeriod returns terms of merchants which reserves are released after the hold period.
+	FindWithHoldPeriod(context.Context) ([]*internalPkg.RollingReserveTerms, error)
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type RollingReserveTermsTestSuite struct {
+	suite.Suite
+	db         mongodb.SourceInterface
+	repository RollingReserveTermsRepositoryInterface
+	log        *zap.Logger
+}
+
+func Test_RollingReserveTerms(t *testing.T) {
+	suite.Run(t, new(RollingReserveTermsTestSuite))
+}
+
+func (suite *RollingReserveTermsTestSuite) SetupTest() {
+	_, err := config.NewConfig()
+	assert.NoError(suite.T(), err, "Config load failed")
+
+	suite.log, err = zap.NewProduction()
+	assert.NoError(suite.T(), err, "Logger initialization failed")
+
+	suite.db, err = mongodb.NewDatabase()
+	assert.NoError(suite.T(), err, "Database connection failed")
+
+	suite.repository = NewRollingReserveTermsRepository(suite.db)
+}
+
+func (suite *RollingReserveTermsTestSuite) TearDownTest() {
+	if err := suite.db.Drop(); err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	if err := suite.db.Close(); err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *RollingReserveTermsTestSuite) TestRollingReserveTerms_NewRollingReserveTermsRepository_Ok() {
+	repository := NewRollingReserveTermsRepository(suite.db)
+	assert.IsType(suite.T(), &rollingReserveTermsRepository{}, repository)
+}
+
+func (suite *RollingReserveTermsTestSuite) TestRollingReserveTerms_Upsert_Ok() {
+	terms := &internalPkg.RollingReserveTerms{
+		MerchantId: primitive.NewObjectID().Hex(),
+		Percentage: 10,
+		HoldDays:   90,
+		Cap:        1000,
+		UpdatedAt:  time.Now(),
+	}
+	err := suite.repository.Upsert(context.TODO(), terms)
+	assert.NoError(suite.T(), err)
+
+	terms2, err := suite.repository.GetByMerchantId(context.TODO(), terms.MerchantId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), terms.Percentage, terms2.Percentage)
+	assert.Equal(suite.T(), terms.HoldDays, terms2.HoldDays)
+	assert.Equal(suite.T(), terms.Cap, terms2.Cap)
+
+	terms.Cap = 0
+	err = suite.repository.Upsert(context.TODO(), terms)
+	assert.NoError(suite.T(), err)
+
+	terms2, err = suite.repository.GetByMerchantId(context.TODO(), terms.MerchantId)
+	assert.NoError(suite.T(), err)
+	assert.Zero(suite.T(), terms2.Cap)
+}
+
+func (suite *RollingReserveTermsTestSuite) TestRollingReserveTerms_GetByMerchantId_NotFound() {
+	_, err := suite.repository.GetByMerchantId(context.TODO(), primitive.NewObjectID().Hex())
+	assert.Equal(suite.T(), mongo.ErrNoDocuments, err)
+}
+
+func (suite *RollingReserveTermsTestSuite) TestRollingReserveTerms_FindWithHoldPeriod_Ok() {
+	terms := &internalPkg.RollingReserveTerms{MerchantId: primitive.NewObjectID().Hex(), Percentage: 5, HoldDays: 30}
+	err := suite.repository.Upsert(context.TODO(), terms)
+	assert.NoError(suite.T(), err)
+
+	err = suite.repository.Upsert(
+		context.TODO(),
+		&internalPkg.RollingReserveTerms{MerchantId: primitive.NewObjectID().Hex(), Percentage: 5},
+	)
+	assert.NoError(suite.T(), err)
+
+	items, err := suite.repository.FindWithHoldPeriod(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), items, 1)
+	assert.Equal(suite.T(), terms.MerchantId, items[0].MerchantId)
+}
@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"time"
+)
+
+type savedPaymentMethodRepository repository
+
+// NewSavedPaymentMethodRepository create and return an object for working with the saved payment method repository.
+// The returned object implements the SavedPaymentMethodRepositoryInterface interface.
+func NewSavedPaymentMethodRepository(db mongodb.SourceInterface) SavedPaymentMethodRepositoryInterface {
+	s := &savedPaymentMethodRepository{db: db}
+	return s
+}
+
+func (h *savedPaymentMethodRepository) Upsert(ctx context.Context, method *internalPkg.SavedPaymentMethod) error {
+	filter := bson.M{"_id": method.Id}
+	opts := options.Replace().SetUpsert(true)
+	_, err := h.db.Collection(collectionSavedPaymentMethod).ReplaceOne(ctx, filter, method, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionSavedPaymentMethod),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpsert),
+			zap.Any(pkg.ErrorDatabaseFieldDocument, method),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *savedPaymentMethodRepository) Delete(ctx context.Context, id string) error {
+	query := bson.M{"_id": id}
+	_, err := h.db.Collection(collectionSavedPaymentMethod).DeleteOne(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionSavedPaymentMethod),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *savedPaymentMethodRepository) GetById(ctx context.Context, id string) (*internalPkg.SavedPaymentMethod, error) {
+	var method *internalPkg.SavedPaymentMethod
+
+	query := bson.M{"_id": id}
+	err := h.db.Collection(collectionSavedPaymentMethod).FindOne(ctx, query).Decode(&method)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return method, nil
+}
+
+func (h *savedPaymentMethodRepository) FindByToken(
+	ctx context.Context,
+	token string,
+) ([]*internalPkg.SavedPaymentMethod, error) {
+	query := bson.M{"token": token}
+
+	return h.find(ctx, query)
+}
+
+func (h *savedPaymentMethodRepository) SetDefault(ctx context.Context, token, id string) error {
+	query := bson.M{"token": token, "_id": bson.M{"$ne": id}}
+	set := bson.M{"$set": bson.M{"is_default": false, "updated_at": time.Now()}}
+	_, err := h.db.Collection(collectionSavedPaymentMethod).UpdateMany(ctx, query, set)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionSavedPaymentMethod),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+			zap.Any(pkg.ErrorDatabaseFieldSet, set),
+		)
+		return err
+	}
+
+	query = bson.M{"token": token, "_id": id}
+	set = bson.M{"$set": bson.M{"is_default": true, "updated_at": time.Now()}}
+	_, err = h.db.Collection(collectionSavedPaymentMethod).UpdateOne(ctx, query, set)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionSavedPaymentMethod),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+			zap.Any(pkg.ErrorDatabaseFieldSet, set),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *savedPaymentMethodRepository) FindExpiring(
+	ctx context.Context,
+	month, year string,
+) ([]*internalPkg.SavedPaymentMethod, error) {
+	query := bson.M{
+		"expire_month":           month,
+		"expire_year":            year,
+		"expiration_notified_at": nil,
+		"email":                  bson.M{"$ne": ""},
+	}
+
+	return h.find(ctx, query)
+}
+
+func (h *savedPaymentMethodRepository) find(
+	ctx context.Context,
+	query bson.M,
+) ([]*internalPkg.SavedPaymentMethod, error) {
+	var methods []*internalPkg.SavedPaymentMethod
+
+	opts := options.Find().SetSort(bson.M{"created_at": 1})
+	cursor, err := h.db.Collection(collectionSavedPaymentMethod).Find(ctx, query, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionSavedPaymentMethod),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &methods)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionSavedPaymentMethod),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return methods, nil
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+)
+
+const (
+	collectionSavedPaymentMethod = "saved_payment_method"
+)
+
+// SavedPaymentMethodRepositoryInterface is abstraction layer for working with saved cards of customers
+// and representation in database.
+type SavedPaymentMethodRepositoryInterface interface {
+	// Upsert adds or updates the saved card.
+	Upsert(context.Context, *internalPkg.SavedPaymentMethod) error
+
+	// Delete removes the saved card by unique identity.
+	Delete(context.Context, string) error
+
+	// GetById returns the saved card by unique identity.
+	GetById(context.Context, string) (*internalPkg.SavedPaymentMethod, error)
+
+	// FindByToken returns saved cards of the customer.
+	FindByToken(context.Context, string) ([]*internalPkg.SavedPaymentMethod, error)
+
+	// SetDefault marks the saved card of the customer as default and unmarks other cards of the customer.
+	SetDefault(context.Context, string, string) error
+
+	// FindExpiring returns saved cards expiring in the month of the year which owners weren't notified about it.
+	FindExpiring(context.Context, string, string) ([]*internalPkg.SavedPaymentMethod, error)
+}
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type SavedPaymentMethodTestSuite struct {
+	suite.Suite
+	db         mongodb.SourceInterface
+	repository SavedPaymentMethodRepositoryInterface
+	log        *zap.Logger
+}
+
+func Test_SavedPaymentMethod(t *testing.T) {
+	suite.Run(t, new(SavedPaymentMethodTestSuite))
+}
+
+func (suite *SavedPaymentMethodTestSuite) SetupTest() {
+	_, err := config.NewConfig()
+	assert.NoError(suite.T(), err, "Config load failed")
+
+	suite.log, err = zap.NewProduction()
+	assert.NoError(suite.T(), err, "Logger initialization failed")
+
+	suite.db, err = mongodb.NewDatabase()
+	assert.NoError(suite.T(), err, "Database connection failed")
+
+	suite.repository = NewSavedPaymentMethodRepository(suite.db)
+}
+
+func (suite *SavedPaymentMethodTestSuite) TearDownTest() {
+	if err := suite.db.Drop(); err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	if err := suite.db.Close(); err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *SavedPaymentMethodTestSuite) TestSavedPaymentMethod_NewSavedPaymentMethodRepository_Ok() {
+	repository := NewSavedPaymentMethodRepository(suite.db)
+	assert.IsType(suite.T(), &savedPaymentMethodRepository{}, repository)
+}
+
+func (suite *SavedPaymentMethodTestSuite) TestSavedPaymentMethod_Upsert_Ok() {
+	method := suite.getMethod(primitive.NewObjectID().Hex(), "12", "2020")
+	err := suite.repository.Upsert(context.TODO(), method)
+	assert.NoError(suite.T(), err)
+
+	method.Name = "my card"
+	err = suite.repository.Upsert(context.TODO(), method)
+	assert.NoError(suite.T(), err)
+
+	method2, err := suite.repository.GetById(context.TODO(), method.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "my card", method2.Name)
+	assert.Equal(suite.T(), method.Token, method2.Token)
+	assert.Equal(suite.T(), method.MaskedPan, method2.MaskedPan)
+}
+
+func (suite *SavedPaymentMethodTestSuite) TestSavedPaymentMethod_Delete_Ok() {
+	method := suite.getMethod(primitive.NewObjectID().Hex(), "12", "2020")
+	err := suite.repository.Upsert(context.TODO(), method)
+	assert.NoError(suite.T(), err)
+
+	err = suite.repository.Delete(context.TODO(), method.Id)
+	assert.NoError(suite.T(), err)
+
+	_, err = suite.repository.GetById(context.TODO(), method.Id)
+	assert.Equal(suite.T(), mongo.ErrNoDocuments, err)
+}
+
+func (suite *SavedPaymentMethodTestSuite) TestSavedPaymentMethod_FindByToken_Ok() {
+	token := primitive.NewObjectID().Hex()
+	method := suite.getMethod(token, "12", "2020")
+	assert.NoError(suite.T(), suite.repository.Upsert(context.TODO(), method))
+
+	method2 := suite.getMethod(token, "01", "2021")
+	assert.NoError(suite.T(), suite.repository.Upsert(context.TODO(), method2))
+
+	method3 := suite.getMethod(primitive.NewObjectID().Hex(), "12", "2020")
+	assert.NoError(suite.T(), suite.repository.Upsert(context.TODO(), method3))
+
+	methods, err := suite.repository.FindByToken(context.TODO(), token)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), methods, 2)
+}
+
+func (suite *SavedPaymentMethodTestSuite) TestSavedPaymentMethod_SetDefault_Ok() {
+	token := primitive.NewObjectID().Hex()
+	method := suite.getMethod(token, "12", "2020")
+	method.IsDefault = true
+	assert.NoError(suite.T(), suite.repository.Upsert(context.TODO(), method))
+
+	method2 := suite.getMethod(token, "01", "2021")
+	assert.NoError(suite.T(), suite.repository.Upsert(context.TODO(), method2))
+
+	other := suite.getMethod(primitive.NewObjectID().Hex(), "12", "2020")
+	other.IsDefault = true
+	assert.NoError(suite.T(), suite.repository.Upsert(context.TODO(), other))
+
+	err := suite.repository.SetDefault(context.TODO(), token, method2.Id)
+	assert.NoError(suite.T(), err)
+
+	method, err = suite.repository.GetById(context.TODO(), method.Id)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), method.IsDefault)
+
+	method2, err = suite.repository.GetById(context.TODO(), method2.Id)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), method2.IsDefault)
+
+	other, err = suite.repository.GetById(context.TODO(), other.Id)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), other.IsDefault)
+}
+
+func (suite *SavedPaymentMethodTestSuite) TestSavedPaymentMethod_FindExpiring_Ok() {
+	expiring := suite.getMethod(primitive.NewObjectID().Hex(), "03", "2020")
+	assert.NoError(suite.T(), suite.repository.Upsert(context.TODO(), expiring))
+
+	notified := suite.getMethod(primitive.NewObjectID().Hex(), "03", "2020")
+	notifiedAt := time.Now()
+	notified.ExpirationNotifiedAt = &notifiedAt
+	assert.NoError(suite.T(), suite.repository.Upsert(context.TODO(), notified))
+
+	withoutEmail := suite.getMethod(primitive.NewObjectID().Hex(), "03", "2020")
+	withoutEmail.Email = ""
+	assert.NoError(suite.T(), suite.repository.Upsert(context.TODO(), withoutEmail))
+
+	notExpiring := suite.getMethod(primitive.NewObjectID().Hex(), "04", "2020")
+	assert.NoError(suite.T(), suite.repository.Upsert(context.TODO(), notExpiring))
+
+	methods, err := suite.repository.FindExpiring(context.TODO(), "03", "2020")
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), methods, 1)
+	assert.Equal(suite.T(), expiring.Id, methods[0].Id)
+}
+
+func (suite *SavedPaymentMethodTestSuite) getMethod(token, month, year string) *internalPkg.SavedPaymentMethod {
+	return &internalPkg.SavedPaymentMethod{
+		Id:          primitive.NewObjectID().Hex(),
+		Token:       token,
+		ProjectId:   primitive.NewObjectID().Hex(),
+		Email:       "test@unit.unit",
+		MaskedPan:   "400000******0002",
+		CardHolder:  "MR. CARD HOLDER",
+		Brand:       "VISA",
+		ExpireMonth: month,
+		ExpireYear:  year,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+}
@@ -0,0 +1,255 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"time"
+)
+
+type subscriptionRepository repository
+
+// NewSubscriptionRepository create and return an object for working with the subscription repository.
+// The returned object implements the SubscriptionRepositoryInterface interface.
+func NewSubscriptionRepository(db mongodb.SourceInterface) SubscriptionRepositoryInterface {
+	s := &subscriptionRepository{db: db}
+	return s
+}
+
+func (h *subscriptionRepository) Insert(ctx context.Context, subscription *internalPkg.Subscription) error {
+	_, err := h.db.Collection(collectionSubscription).InsertOne(ctx, subscription)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionSubscription),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationInsert),
+			zap.String("subscription_id", subscription.Id),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *subscriptionRepository) Update(ctx context.Context, subscription *internalPkg.Subscription) error {
+	_, err := h.update(ctx, bson.M{"_id": subscription.Id}, subscription)
+
+	return err
+}
+
+func (h *subscriptionRepository) UpdateIf(
+	ctx context.Context,
+	subscription *internalPkg.Subscription,
+	status string,
+	currentPeriodEnd time.Time,
+) (bool, error) {
+	query := bson.M{"_id": subscription.Id, "status": status, "current_period_end": currentPeriodEnd}
+
+	return h.update(ctx, query, subscription)
+}
+
+func (h *subscriptionRepository) update(
+	ctx context.Context,
+	query bson.M,
+	subscription *internalPkg.Subscription,
+) (bool, error) {
+	raw, err := bson.Marshal(subscription)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionSubscription),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpdate),
+			zap.String("subscription_id", subscription.Id),
+		)
+		return false, err
+	}
+
+	set := bson.M{}
+
+	if err = bson.Unmarshal(raw, &set); err != nil {
+		return false, err
+	}
+
+	delete(set, "_id")
+	delete(set, "pending_order_id")
+	delete(set, "claimed_at")
+
+	res, err := h.db.Collection(collectionSubscription).UpdateOne(ctx, query, bson.M{"$set": set})
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionSubscription),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpdate),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return false, err
+	}
+
+	return res.MatchedCount > 0, nil
+}
+
+func (h *subscriptionRepository) Claim(
+	ctx context.Context,
+	id, claimId string,
+	claimedAt time.Time,
+) (*internalPkg.Subscription, error) {
+	var subscription *internalPkg.Subscription
+
+	query := bson.M{"_id": id, "pending_order_id": ""}
+	set := bson.M{"$set": bson.M{"pending_order_id": claimId, "claimed_at": claimedAt}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := h.db.Collection(collectionSubscription).FindOneAndUpdate(ctx, query, set, opts).Decode(&subscription)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionSubscription),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpdate),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return subscription, nil
+}
+
+func (h *subscriptionRepository) SetPendingOrder(ctx context.Context, id, claimId, orderId string) (bool, error) {
+	query := bson.M{"_id": id, "pending_order_id": claimId}
+	set := bson.M{"$set": bson.M{"pending_order_id": orderId, "last_order_id": orderId}}
+	res, err := h.db.Collection(collectionSubscription).UpdateOne(ctx, query, set)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionSubscription),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpdate),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return false, err
+	}
+
+	return res.ModifiedCount > 0, nil
+}
+
+func (h *subscriptionRepository) ReleasePendingOrder(ctx context.Context, id string, pendingIds ...string) error {
+	query := bson.M{"_id": id, "pending_order_id": bson.M{"$in": pendingIds, "$ne": ""}}
+	set := bson.M{"$set": bson.M{"pending_order_id": "", "claimed_at": nil}}
+	_, err := h.db.Collection(collectionSubscription).UpdateOne(ctx, query, set)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionSubscription),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpdate),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *subscriptionRepository) GetById(ctx context.Context, id string) (*internalPkg.Subscription, error) {
+	var subscription *internalPkg.Subscription
+
+	query := bson.M{"_id": id}
+	err := h.db.Collection(collectionSubscription).FindOne(ctx, query).Decode(&subscription)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return subscription, nil
+}
+
+func (h *subscriptionRepository) FindDue(ctx context.Context, before time.Time) ([]*internalPkg.Subscription, error) {
+	var subscriptions []*internalPkg.Subscription
+
+	query := bson.M{
+		"status": bson.M{
+			"$in": []string{internalPkg.SubscriptionStatusTrial, internalPkg.SubscriptionStatusActive},
+		},
+		"next_billing_at":  bson.M{"$lte": before},
+		"pending_order_id": "",
+	}
+	opts := options.Find().SetSort(bson.M{"next_billing_at": 1})
+	cursor, err := h.db.Collection(collectionSubscription).Find(ctx, query, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionSubscription),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &subscriptions)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionSubscription),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return subscriptions, nil
+}
+
+func (h *subscriptionRepository) FindRetryDue(ctx context.Context, before time.Time) ([]*internalPkg.Subscription, error) {
+	var subscriptions []*internalPkg.Subscription
+
+	query := bson.M{
+		"status":           internalPkg.SubscriptionStatusPastDue,
+		"retry_at":         bson.M{"$lte": before},
+		"pending_order_id": "",
+	}
+	opts := options.Find().SetSort(bson.M{"retry_at": 1})
+	cursor, err := h.db.Collection(collectionSubscription).Find(ctx, query, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionSubscription),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &subscriptions)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionSubscription),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return subscriptions, nil
+}
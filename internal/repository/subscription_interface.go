@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"time"
+)
+
+const (
+	collectionSubscription = "subscription"
+)
+
+// SubscriptionRepositoryInterface is abstraction layer for working with subscriptions of customers
+// and representation in database.
+type SubscriptionRepositoryInterface interface {
+	// Insert adds the subscription to the collection.
+	Insert(context.Context, *internalPkg.Subscription) error
+
+	// Update updates the subscription in the collection. Pending order of the subscription isn't changed by update,
+	// it's changed by Claim, SetPendingOrder and ReleasePendingOrder only.
+	Update(context.Context, *internalPkg.Subscription) error
+
+	// UpdateIf updates the subscription like Update only if its stored status and end of current period equal
+	// to passed ones. Returns false if the subscription was changed by other process.
+	UpdateIf(context.Context, *internalPkg.Subscription, string, time.Time) (bool, error)
+
+	// Claim sets the claim identifier as pending order of the subscription if it doesn't wait for result
+	// of other payment. Returns the claimed subscription or nil if subscription is claimed by other process
+	// or waits for result of payment.
+	Claim(context.Context, string, string, time.Time) (*internalPkg.Subscription, error)
+
+	// SetPendingOrder replaces the claim identifier by the identifier of order which result of payment is waited
+	// by the subscription. Returns false if the subscription isn't claimed by the claim identifier anymore.
+	SetPendingOrder(context.Context, string, string, string) (bool, error)
+
+	// ReleasePendingOrder resets pending order of the subscription if it's one of the identifiers.
+	ReleasePendingOrder(context.Context, string, ...string) error
+
+	// GetById returns the subscription by unique identity.
+	GetById(context.Context, string) (*internalPkg.Subscription, error)
+
+	// FindDue returns subscriptions in trial or active status which have to be renewed before the date
+	// and don't wait for result of other payment.
+	FindDue(context.Context, time.Time) ([]*internalPkg.Subscription, error)
+
+	// FindRetryDue returns past due subscriptions which failed renewal payment has to be retried before the date
+	// and don't wait for result of other payment.
+	FindRetryDue(context.Context, time.Time) ([]*internalPkg.Subscription, error)
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+)
+
+type subscriptionPlanRepository repository
+
+// NewSubscriptionPlanRepository create and return an object for working with the subscription plan repository.
+// The returned object implements the SubscriptionPlanRepositoryInterface interface.
+func NewSubscriptionPlanRepository(db mongodb.SourceInterface) SubscriptionPlanRepositoryInterface {
+	s := &subscriptionPlanRepository{db: db}
+	return s
+}
+
+func (h *subscriptionPlanRepository) Insert(ctx context.Context, plan *internalPkg.SubscriptionPlan) error {
+	_, err := h.db.Collection(collectionSubscriptionPlan).InsertOne(ctx, plan)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionSubscriptionPlan),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationInsert),
+			zap.Any(pkg.ErrorDatabaseFieldDocument, plan),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *subscriptionPlanRepository) Update(ctx context.Context, plan *internalPkg.SubscriptionPlan) error {
+	_, err := h.db.Collection(collectionSubscriptionPlan).ReplaceOne(ctx, bson.M{"_id": plan.Id}, plan)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionSubscriptionPlan),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpdate),
+			zap.Any(pkg.ErrorDatabaseFieldDocument, plan),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *subscriptionPlanRepository) GetById(ctx context.Context, id string) (*internalPkg.SubscriptionPlan, error) {
+	var plan *internalPkg.SubscriptionPlan
+
+	query := bson.M{"_id": id}
+	err := h.db.Collection(collectionSubscriptionPlan).FindOne(ctx, query).Decode(&plan)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+func (h *subscriptionPlanRepository) FindByProjectId(
+	ctx context.Context,
+	projectId string,
+) ([]*internalPkg.SubscriptionPlan, error) {
+	var plans []*internalPkg.SubscriptionPlan
+
+	query := bson.M{"project_id": projectId}
+	opts := options.Find().SetSort(bson.M{"created_at": 1})
+	cursor, err := h.db.Collection(collectionSubscriptionPlan).Find(ctx, query, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionSubscriptionPlan),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &plans)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionSubscriptionPlan),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return plans, nil
+}
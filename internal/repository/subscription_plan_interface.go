@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+)
+
+const (
+	collectionSubscriptionPlan = "subscription_plan"
+)
+
+// SubscriptionPlanRepositoryInterface is abstraction layer for working with subscription plans of projects
+// and representation in database.
+type SubscriptionPlanRepositoryInterface interface {
+	// Insert adds the subscription plan to the collection.
+	Insert(context.Context, *internalPkg.SubscriptionPlan) error
+
+	// Update updates the subscription plan in the collection.
+	Update(context.Context, *internalPkg.SubscriptionPlan) error
+
+	// GetById returns the subscription plan by unique identity.
+	GetById(context.Context, string) (*internalPkg.SubscriptionPlan, error)
+
+	// FindByProjectId returns subscription plans of the project.
+	FindByProjectId(context.Context, string) ([]*internalPkg.SubscriptionPlan, error)
+}
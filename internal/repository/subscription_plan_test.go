@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type SubscriptionPlanTestSuite struct {
+	suite.Suite
+	db         mongodb.SourceInterface
+	repository SubscriptionPlanRepositoryInterface
+	log        *zap.Logger
+}
+
+func Test_SubscriptionPlan(t *testing.T) {
+	suite.Run(t, new(SubscriptionPlanTestSuite))
+}
+
+func (suite *SubscriptionPlanTestSuite) SetupTest() {
+	_, err := config.NewConfig()
+	assert.NoError(suite.T(), err, "Config load failed")
+
+	suite.log, err = zap.NewProduction()
+	assert.NoError(suite.T(), err, "Logger initialization failed")
+
+	suite.db, err = mongodb.NewDatabase()
+	assert.NoError(suite.T(), err, "Database connection failed")
+
+	suite.repository = NewSubscriptionPlanRepository(suite.db)
+}
+
+func (suite *SubscriptionPlanTestSuite) TearDownTest() {
+	if err := suite.db.Drop(); err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	if err := suite.db.Close(); err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *SubscriptionPlanTestSuite) TestSubscriptionPlan_NewSubscriptionPlanRepository_Ok() {
+	repository := NewSubscriptionPlanRepository(suite.db)
+	assert.IsType(suite.T(), &subscriptionPlanRepository{}, repository)
+}
+
+func (suite *SubscriptionPlanTestSuite) TestSubscriptionPlan_Insert_Ok() {
+	plan := suite.getPlan(primitive.NewObjectID().Hex())
+	assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), plan))
+
+	plan2, err := suite.repository.GetById(context.TODO(), plan.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), plan.Id, plan2.Id)
+	assert.Equal(suite.T(), plan.Interval, plan2.Interval)
+	assert.Len(suite.T(), plan2.Prices, 1)
+}
+
+func (suite *SubscriptionPlanTestSuite) TestSubscriptionPlan_Update_Ok() {
+	plan := suite.getPlan(primitive.NewObjectID().Hex())
+	assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), plan))
+
+	plan.IsActive = false
+	assert.NoError(suite.T(), suite.repository.Update(context.TODO(), plan))
+
+	plan2, err := suite.repository.GetById(context.TODO(), plan.Id)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), plan2.IsActive)
+}
+
+func (suite *SubscriptionPlanTestSuite) TestSubscriptionPlan_GetById_NotFound() {
+	_, err := suite.repository.GetById(context.TODO(), primitive.NewObjectID().Hex())
+	assert.Error(suite.T(), err)
+}
+
+func (suite *SubscriptionPlanTestSuite) TestSubscriptionPlan_FindByProjectId_Ok() {
+	projectId := primitive.NewObjectID().Hex()
+	assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), suite.getPlan(projectId)))
+	assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), suite.getPlan(projectId)))
+	assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), suite.getPlan(primitive.NewObjectID().Hex())))
+
+	plans, err := suite.repository.FindByProjectId(context.TODO(), projectId)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), plans, 2)
+}
+
+func (suite *SubscriptionPlanTestSuite) getPlan(projectId string) *internalPkg.SubscriptionPlan {
+	return &internalPkg.SubscriptionPlan{
+		Id:            primitive.NewObjectID().Hex(),
+		MerchantId:    primitive.NewObjectID().Hex(),
+		ProjectId:     projectId,
+		Name:          "unit test",
+		Prices:        []*billingpb.ProductPrice{{Amount: 100, Currency: "RUB", Region: "RUB"}},
+		Interval:      internalPkg.SubscriptionIntervalMonth,
+		IntervalCount: 1,
+		IsActive:      true,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+}
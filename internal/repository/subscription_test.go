@@ -0,0 +1,232 @@
+package repository
+
+import (
+	"context"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type SubscriptionTestSuite struct {
+	suite.Suite
+	db         mongodb.SourceInterface
+	repository SubscriptionRepositoryInterface
+	log        *zap.Logger
+}
+
+func Test_Subscription(t *testing.T) {
+	suite.Run(t, new(SubscriptionTestSuite))
+}
+
+func (suite *SubscriptionTestSuite) SetupTest() {
+	_, err := config.NewConfig()
+	assert.NoError(suite.T(), err, "Config load failed")
+
+	suite.log, err = zap.NewProduction()
+	assert.NoError(suite.T(), err, "Logger initialization failed")
+
+	suite.db, err = mongodb.NewDatabase()
+	assert.NoError(suite.T(), err, "Database connection failed")
+
+	suite.repository = NewSubscriptionRepository(suite.db)
+}
+
+func (suite *SubscriptionTestSuite) TearDownTest() {
+	if err := suite.db.Drop(); err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	if err := suite.db.Close(); err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_NewSubscriptionRepository_Ok() {
+	repository := NewSubscriptionRepository(suite.db)
+	assert.IsType(suite.T(), &subscriptionRepository{}, repository)
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_Insert_Ok() {
+	subscription := suite.getSubscription(internalPkg.SubscriptionStatusActive, time.Now())
+	assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), subscription))
+
+	subscription2, err := suite.repository.GetById(context.TODO(), subscription.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), subscription.Id, subscription2.Id)
+	assert.Equal(suite.T(), subscription.Status, subscription2.Status)
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_Update_Ok() {
+	subscription := suite.getSubscription(internalPkg.SubscriptionStatusActive, time.Now())
+	assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), subscription))
+
+	subscription.Status = internalPkg.SubscriptionStatusPaused
+	assert.NoError(suite.T(), suite.repository.Update(context.TODO(), subscription))
+
+	subscription2, err := suite.repository.GetById(context.TODO(), subscription.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.SubscriptionStatusPaused, subscription2.Status)
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_UpdateIf_Ok() {
+	subscription := suite.getSubscription(internalPkg.SubscriptionStatusActive, time.Now())
+	subscription.CurrentPeriodEnd = time.Now().AddDate(0, 1, 0)
+	assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), subscription))
+
+	subscription, err := suite.repository.GetById(context.TODO(), subscription.Id)
+	assert.NoError(suite.T(), err)
+	periodEnd := subscription.CurrentPeriodEnd
+
+	subscription.CurrentPeriodEnd = periodEnd.AddDate(0, 1, 0)
+	ok, err := suite.repository.UpdateIf(context.TODO(), subscription, internalPkg.SubscriptionStatusActive, periodEnd)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	// period was already changed, so stale subscription isn't saved
+	subscription.Status = internalPkg.SubscriptionStatusCanceled
+	ok, err = suite.repository.UpdateIf(context.TODO(), subscription, internalPkg.SubscriptionStatusActive, periodEnd)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+
+	subscription2, err := suite.repository.GetById(context.TODO(), subscription.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.SubscriptionStatusActive, subscription2.Status)
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_Update_PendingOrderNotChanged() {
+	subscription := suite.getSubscription(internalPkg.SubscriptionStatusActive, time.Now())
+	assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), subscription))
+
+	claimed, err := suite.repository.Claim(context.TODO(), subscription.Id, "claim", time.Now())
+	assert.NoError(suite.T(), err)
+	assert.NotNil(suite.T(), claimed)
+
+	subscription.FailedAttempts = 1
+	assert.NoError(suite.T(), suite.repository.Update(context.TODO(), subscription))
+
+	subscription2, err := suite.repository.GetById(context.TODO(), subscription.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "claim", subscription2.PendingOrderId)
+	assert.EqualValues(suite.T(), 1, subscription2.FailedAttempts)
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_Claim_Ok() {
+	subscription := suite.getSubscription(internalPkg.SubscriptionStatusActive, time.Now())
+	assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), subscription))
+
+	claimed, err := suite.repository.Claim(context.TODO(), subscription.Id, "claim", time.Now())
+	assert.NoError(suite.T(), err)
+	assert.NotNil(suite.T(), claimed)
+	assert.Equal(suite.T(), "claim", claimed.PendingOrderId)
+	assert.NotNil(suite.T(), claimed.ClaimedAt)
+
+	// subscription can't be claimed twice
+	claimed, err = suite.repository.Claim(context.TODO(), subscription.Id, "claim2", time.Now())
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), claimed)
+
+	ok, err := suite.repository.SetPendingOrder(context.TODO(), subscription.Id, "claim2", "order")
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+
+	ok, err = suite.repository.SetPendingOrder(context.TODO(), subscription.Id, "claim", "order")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	subscription2, err := suite.repository.GetById(context.TODO(), subscription.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "order", subscription2.PendingOrderId)
+	assert.Equal(suite.T(), "order", subscription2.LastOrderId)
+
+	assert.NoError(suite.T(), suite.repository.ReleasePendingOrder(context.TODO(), subscription.Id, "claim"))
+	subscription2, err = suite.repository.GetById(context.TODO(), subscription.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "order", subscription2.PendingOrderId)
+
+	assert.NoError(suite.T(), suite.repository.ReleasePendingOrder(context.TODO(), subscription.Id, "order", "claim"))
+	subscription2, err = suite.repository.GetById(context.TODO(), subscription.Id)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), subscription2.PendingOrderId)
+	assert.Nil(suite.T(), subscription2.ClaimedAt)
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_GetById_NotFound() {
+	_, err := suite.repository.GetById(context.TODO(), primitive.NewObjectID().Hex())
+	assert.Error(suite.T(), err)
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_FindDue_Ok() {
+	now := time.Now()
+	due := suite.getSubscription(internalPkg.SubscriptionStatusActive, now.Add(-time.Hour))
+	assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), due))
+
+	trial := suite.getSubscription(internalPkg.SubscriptionStatusTrial, now.Add(-time.Minute))
+	assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), trial))
+
+	notDue := suite.getSubscription(internalPkg.SubscriptionStatusActive, now.Add(time.Hour))
+	assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), notDue))
+
+	paused := suite.getSubscription(internalPkg.SubscriptionStatusPaused, now.Add(-time.Hour))
+	assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), paused))
+
+	pending := suite.getSubscription(internalPkg.SubscriptionStatusActive, now.Add(-time.Hour))
+	pending.PendingOrderId = primitive.NewObjectID().Hex()
+	assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), pending))
+
+	subscriptions, err := suite.repository.FindDue(context.TODO(), now)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), subscriptions, 2)
+	assert.Equal(suite.T(), due.Id, subscriptions[0].Id)
+	assert.Equal(suite.T(), trial.Id, subscriptions[1].Id)
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_FindRetryDue_Ok() {
+	now := time.Now()
+	due := suite.getSubscription(internalPkg.SubscriptionStatusPastDue, now.Add(-48*time.Hour))
+	due.RetryAt = now.Add(-time.Minute)
+	assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), due))
+
+	first := suite.getSubscription(internalPkg.SubscriptionStatusPastDue, now.Add(-48*time.Hour))
+	first.RetryAt = now.Add(-time.Hour)
+	assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), first))
+
+	notDue := suite.getSubscription(internalPkg.SubscriptionStatusPastDue, now.Add(-48*time.Hour))
+	notDue.RetryAt = now.Add(time.Hour)
+	assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), notDue))
+
+	active := suite.getSubscription(internalPkg.SubscriptionStatusActive, now.Add(-time.Hour))
+	active.RetryAt = now.Add(-time.Hour)
+	assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), active))
+
+	pending := suite.getSubscription(internalPkg.SubscriptionStatusPastDue, now.Add(-48*time.Hour))
+	pending.RetryAt = now.Add(-time.Hour)
+	pending.PendingOrderId = primitive.NewObjectID().Hex()
+	assert.NoError(suite.T(), suite.repository.Insert(context.TODO(), pending))
+
+	subscriptions, err := suite.repository.FindRetryDue(context.TODO(), now)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), subscriptions, 2)
+	assert.Equal(suite.T(), first.Id, subscriptions[0].Id)
+	assert.Equal(suite.T(), due.Id, subscriptions[1].Id)
+}
+
+func (suite *SubscriptionTestSuite) getSubscription(status string, nextBillingAt time.Time) *internalPkg.Subscription {
+	return &internalPkg.Subscription{
+		Id:            primitive.NewObjectID().Hex(),
+		PlanId:        primitive.NewObjectID().Hex(),
+		MerchantId:    primitive.NewObjectID().Hex(),
+		ProjectId:     primitive.NewObjectID().Hex(),
+		Status:        status,
+		Amount:        100,
+		Currency:      "RUB",
+		NextBillingAt: nextBillingAt,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"time"
+)
+
+type virtualCurrencyHoldRepository repository
+
+// NewVirtualCurrencyHoldRepository create and return an object for working with the virtual currency hold repository.
+// The returned object implements the VirtualCurrencyHoldRepositoryInterface interface.
+func NewVirtualCurrencyHoldRepository(db mongodb.SourceInterface) VirtualCurrencyHoldRepositoryInterface {
+	s := &virtualCurrencyHoldRepository{db: db}
+	return s
+}
+
+func (h *virtualCurrencyHoldRepository) Insert(ctx context.Context, hold *internalPkg.VirtualCurrencyHold) error {
+	_, err := h.db.Collection(collectionVirtualCurrencyHold).InsertOne(ctx, hold)
+
+	if err != nil && !isDuplicateKeyError(err) {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionVirtualCurrencyHold),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationInsert),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, hold),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (h *virtualCurrencyHoldRepository) Finish(ctx context.Context, orderId, status string) (bool, error) {
+	query := bson.M{"_id": orderId, "status": internalPkg.VirtualCurrencyHoldStatusHeld}
+	set := bson.M{"$set": bson.M{"status": status, "updated_at": time.Now()}}
+	res, err := h.db.Collection(collectionVirtualCurrencyHold).UpdateOne(ctx, query, set)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionVirtualCurrencyHold),
+			zap.String(pkg.ErrorDatabaseFieldOperation, pkg.ErrorDatabaseFieldOperationUpdate),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return false, err
+	}
+
+	return res.ModifiedCount > 0, nil
+}
+
+func (h *virtualCurrencyHoldRepository) GetByOrderId(
+	ctx context.Context,
+	orderId string,
+) (*internalPkg.VirtualCurrencyHold, error) {
+	var hold *internalPkg.VirtualCurrencyHold
+
+	query := bson.M{"_id": orderId}
+	err := h.db.Collection(collectionVirtualCurrencyHold).FindOne(ctx, query).Decode(&hold)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return hold, nil
+}
@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+)
+
+const (
+	collectionVirtualCurrencyHold = "virtual_currency_hold"
+)
+
+// VirtualCurrencyHoldRepositoryInterface is abstraction layer for working with virtual currency held by not paid orders
+// and representation in database.
+type VirtualCurrencyHoldRepositoryInterface interface {
+	// Insert adds hold of virtual currency to the collection, hold of the order is added only once.
+	Insert(context.Context, *internalPkg.VirtualCurrencyHold) error
+
+	// Finish changes status of held virtual currency of the order to the status.
+	// Returns false if virtual currency isn't held by the order.
+	Finish(context.Context, string, string) (bool, error)
+
+	// GetByOrderId returns hold of virtual currency by order identifier.
+	GetByOrderId(context.Context, string) (*internalPkg.VirtualCurrencyHold, error)
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type VirtualCurrencyHoldTestSuite struct {
+	suite.Suite
+	db         mongodb.SourceInterface
+	repository VirtualCurrencyHoldRepositoryInterface
+	log        *zap.Logger
+}
+
+func Test_VirtualCurrencyHold(t *testing.T) {
+	suite.Run(t, new(VirtualCurrencyHoldTestSuite))
+}
+
+func (suite *VirtualCurrencyHoldTestSuite) SetupTest() {
+	_, err := config.NewConfig()
+	assert.NoError(suite.T(), err, "Config load failed")
+
+	suite.log, err = zap.NewProduction()
+	assert.NoError(suite.T(), err, "Logger initialization failed")
+
+	suite.db, err = mongodb.NewDatabase()
+	assert.NoError(suite.T(), err, "Database connection failed")
+
+	suite.repository = NewVirtualCurrencyHoldRepository(suite.db)
+}
+
+func (suite *VirtualCurrencyHoldTestSuite) TearDownTest() {
+	if err := suite.db.Drop(); err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	if err := suite.db.Close(); err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *VirtualCurrencyHoldTestSuite) TestVirtualCurrencyHold_NewVirtualCurrencyHoldRepository_Ok() {
+	repository := NewVirtualCurrencyHoldRepository(suite.db)
+	assert.IsType(suite.T(), &virtualCurrencyHoldRepository{}, repository)
+}
+
+func (suite *VirtualCurrencyHoldTestSuite) TestVirtualCurrencyHold_Insert_Ok() {
+	hold := suite.getVirtualCurrencyHold(10)
+	err := suite.repository.Insert(context.TODO(), hold)
+	assert.NoError(suite.T(), err)
+
+	// hold of the same order is added only once
+	hold2 := suite.getVirtualCurrencyHold(20)
+	hold2.OrderId = hold.OrderId
+	err = suite.repository.Insert(context.TODO(), hold2)
+	assert.NoError(suite.T(), err)
+
+	hold3, err := suite.repository.GetByOrderId(context.TODO(), hold.OrderId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), hold.Amount, hold3.Amount)
+	assert.Equal(suite.T(), internalPkg.VirtualCurrencyHoldStatusHeld, hold3.Status)
+}
+
+func (suite *VirtualCurrencyHoldTestSuite) TestVirtualCurrencyHold_Finish_Ok() {
+	hold := suite.getVirtualCurrencyHold(10)
+	err := suite.repository.Insert(context.TODO(), hold)
+	assert.NoError(suite.T(), err)
+
+	ok, err := suite.repository.Finish(context.TODO(), hold.OrderId, internalPkg.VirtualCurrencyHoldStatusReleased)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	// released hold can't be captured
+	ok, err = suite.repository.Finish(context.TODO(), hold.OrderId, internalPkg.VirtualCurrencyHoldStatusCaptured)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+
+	hold2, err := suite.repository.GetByOrderId(context.TODO(), hold.OrderId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.VirtualCurrencyHoldStatusReleased, hold2.Status)
+}
+
+func (suite *VirtualCurrencyHoldTestSuite) TestVirtualCurrencyHold_Finish_NotFound() {
+	ok, err := suite.repository.Finish(context.TODO(), primitive.NewObjectID().Hex(), internalPkg.VirtualCurrencyHoldStatusReleased)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+}
+
+func (suite *VirtualCurrencyHoldTestSuite) getVirtualCurrencyHold(amount float64) *internalPkg.VirtualCurrencyHold {
+	return &internalPkg.VirtualCurrencyHold{
+		OrderId:   primitive.NewObjectID().Hex(),
+		ProjectId: primitive.NewObjectID().Hex(),
+		UserId:    primitive.NewObjectID().Hex(),
+		Amount:    amount,
+		Status:    internalPkg.VirtualCurrencyHoldStatusHeld,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+}
@@ -0,0 +1,731 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"github.com/paysuper/paysuper-billing-server/internal/helper"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	tools "github.com/paysuper/paysuper-tools/number"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	accountingCorrectionBatchMaxSize = 1000
+
+	accountingCorrectionReasonMask      = "%s (reference %s)"
+	accountingCorrectionReversalMask    = "Reversal of accounting correction batch %s: %s"
+	accountingCorrectionColumnMerchant  = "merchant_id"
+	accountingCorrectionColumnType      = "type"
+	accountingCorrectionColumnCurrency  = "currency"
+	accountingCorrectionColumnAmount    = "amount"
+	accountingCorrectionColumnReason    = "reason"
+	accountingCorrectionColumnReference = "reference"
+)
+
+var (
+	correctionBatchErrorEmpty              = newBillingServerErrorMsg("cb000001", "accounting correction batch doesn't contain corrections")
+	correctionBatchErrorTooManyCorrections = newBillingServerErrorMsg("cb000002", "accounting correction batch contains too many corrections")
+	correctionBatchErrorFileInvalid        = newBillingServerErrorMsg("cb000003", "accounting correction batch file must be CSV with merchant_id, currency, amount, reason and reference columns in header")
+	correctionBatchErrorCorrectionInvalid  = newBillingServerErrorMsg("cb000004", "accounting correction must have merchant, non-zero amount, reason and reference")
+	correctionBatchErrorCurrencyMismatch   = newBillingServerErrorMsg("cb000005", "currency of accounting correction differs from payout currency of merchant")
+	correctionBatchErrorDuplicatedRef      = newBillingServerErrorMsg("cb000006", "reference of accounting correction is used by other correction of batch")
+	correctionBatchErrorInvalid            = newBillingServerErrorMsg("cb000007", "accounting correction batch contains invalid corrections")
+	correctionBatchErrorNotFound           = newBillingServerErrorMsg("cb000008", "accounting correction batch not found")
+	correctionBatchErrorNotPending         = newBillingServerErrorMsg("cb000009", "accounting correction batch isn't waiting for approval")
+	correctionBatchErrorNotApproved        = newBillingServerErrorMsg("cb000010", "only approved accounting correction batch can be reversed")
+	correctionBatchErrorSameUser           = newBillingServerErrorMsg("cb000011", "accounting correction batch must be approved by user other than creator of batch")
+	correctionBatchErrorAccessDenied       = newBillingServerErrorMsg("cb000012", "user isn't allowed to approve accounting corrections")
+	correctionBatchErrorCreatorRequired    = newBillingServerErrorMsg("cb000013", "creator of accounting correction batch is required")
+
+	accountingCorrectionColumns = []string{
+		accountingCorrectionColumnMerchant,
+		accountingCorrectionColumnType,
+		accountingCorrectionColumnCurrency,
+		accountingCorrectionColumnAmount,
+		accountingCorrectionColumnReason,
+		accountingCorrectionColumnReference,
+	}
+
+	accountingCorrectionApproverRoles = []string{billingpb.RoleSystemAdmin, billingpb.RoleSystemFinancial}
+)
+
+// CreateAccountingCorrectionBatch validates the batch of manual accounting corrections as a whole and saves it
+// for approval. Nothing is saved if any correction is invalid, errors are returned for each correction.
+func (s *Service) CreateAccountingCorrectionBatch(
+	ctx context.Context,
+	req *internalPkg.CreateAccountingCorrectionBatchRequest,
+	rsp *internalPkg.AccountingCorrectionBatchResponse,
+) error {
+	if req.CreatorId == "" {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = correctionBatchErrorCreatorRequired
+		return nil
+	}
+
+	corrections := req.Corrections
+
+	if len(req.File) > 0 {
+		var err error
+		corrections, err = parseAccountingCorrectionFile(req.File)
+
+		if err != nil {
+			rsp.Status = billingpb.ResponseStatusBadData
+			rsp.Message = err.(*billingpb.ResponseErrorMessage)
+			return nil
+		}
+	}
+
+	if len(corrections) <= 0 {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = correctionBatchErrorEmpty
+		return nil
+	}
+
+	if len(corrections) > accountingCorrectionBatchMaxSize {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = correctionBatchErrorTooManyCorrections
+		return nil
+	}
+
+	batch := &internalPkg.AccountingCorrectionBatch{
+		Id:          primitive.NewObjectID().Hex(),
+		Status:      internalPkg.AccountingCorrectionBatchStatusPending,
+		Corrections: corrections,
+		Date:        req.Date,
+		CreatorId:   req.CreatorId,
+		CreatedAt:   time.Now(),
+	}
+
+	if batch.Date <= 0 {
+		batch.Date = batch.CreatedAt.Unix()
+	}
+
+	if !s.validateAccountingCorrectionBatch(ctx, batch) {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = correctionBatchErrorInvalid
+		rsp.Item = batch
+		return nil
+	}
+
+	if err := s.correctionBatchRepository.Insert(ctx, batch); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = accountingEntryErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = batch
+
+	return nil
+}
+
+func (s *Service) GetAccountingCorrectionBatch(
+	ctx context.Context,
+	req *internalPkg.GetAccountingCorrectionBatchRequest,
+	rsp *internalPkg.AccountingCorrectionBatchResponse,
+) error {
+	batch, err := s.correctionBatchRepository.GetById(ctx, req.Id)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = correctionBatchErrorNotFound
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = batch
+
+	return nil
+}
+
+// ApproveAccountingCorrectionBatch books entries of all corrections of the batch at once, corrections are
+// validated again before booking.
+func (s *Service) ApproveAccountingCorrectionBatch(
+	ctx context.Context,
+	req *internalPkg.ChangeAccountingCorrectionBatchRequest,
+	rsp *internalPkg.AccountingCorrectionBatchResponse,
+) error {
+	batch, err := s.getPendingAccountingCorrectionBatch(ctx, req)
+
+	if err != nil {
+		rsp.Status = err.(*billingpb.ResponseError).Status
+		rsp.Message = err.(*billingpb.ResponseError).Message
+		return nil
+	}
+
+	if !s.validateAccountingCorrectionBatch(ctx, batch) {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = correctionBatchErrorInvalid
+		rsp.Item = batch
+		return nil
+	}
+
+	entries, msg := s.getAccountingCorrectionEntries(ctx, batch, false)
+
+	if msg != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = msg
+		return nil
+	}
+
+	decidedAt := time.Now()
+	batch.Status = internalPkg.AccountingCorrectionBatchStatusApproved
+	batch.ApproverId = req.UserId
+	batch.Comment = req.Comment
+	batch.DecidedAt = &decidedAt
+	batch.EntryIds = nil
+
+	for i, entry := range entries {
+		batch.Corrections[i].EntryId = entry.(*billingpb.AccountingEntry).Id
+		batch.EntryIds = append(batch.EntryIds, batch.Corrections[i].EntryId)
+	}
+
+	e := s.bookAccountingCorrectionBatch(ctx, batch, entries, internalPkg.AccountingCorrectionBatchStatusPending)
+
+	if e != nil {
+		rsp.Status = e.Status
+		rsp.Message = e.Message
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = batch
+
+	return nil
+}
+
+// RejectAccountingCorrectionBatch rejects the batch waiting for approval, entries of the batch are never booked.
+func (s *Service) RejectAccountingCorrectionBatch(
+	ctx context.Context,
+	req *internalPkg.ChangeAccountingCorrectionBatchRequest,
+	rsp *internalPkg.AccountingCorrectionBatchResponse,
+) error {
+	batch, err := s.getPendingAccountingCorrectionBatch(ctx, req)
+
+	if err != nil {
+		rsp.Status = err.(*billingpb.ResponseError).Status
+		rsp.Message = err.(*billingpb.ResponseError).Message
+		return nil
+	}
+
+	decidedAt := time.Now()
+	batch.Status = internalPkg.AccountingCorrectionBatchStatusRejected
+	batch.ApproverId = req.UserId
+	batch.Comment = req.Comment
+	batch.DecidedAt = &decidedAt
+
+	err = s.correctionBatchRepository.Update(ctx, batch, internalPkg.AccountingCorrectionBatchStatusPending)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = accountingEntryErrorUnknown
+
+		if err == mongo.ErrNoDocuments {
+			rsp.Status = billingpb.ResponseStatusBadData
+			rsp.Message = correctionBatchErrorNotPending
+		}
+
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = batch
+
+	return nil
+}
+
+// ReverseAccountingCorrectionBatch books entries which reverse all entries of the approved batch.
+// Booked entries of the batch aren't changed.
+func (s *Service) ReverseAccountingCorrectionBatch(
+	ctx context.Context,
+	req *internalPkg.ChangeAccountingCorrectionBatchRequest,
+	rsp *internalPkg.AccountingCorrectionBatchResponse,
+) error {
+	batch, err := s.correctionBatchRepository.GetById(ctx, req.Id)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = correctionBatchErrorNotFound
+		return nil
+	}
+
+	if batch.Status != internalPkg.AccountingCorrectionBatchStatusApproved {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = correctionBatchErrorNotApproved
+		return nil
+	}
+
+	if !s.isAccountingCorrectionApprover(ctx, req.UserId) {
+		rsp.Status = billingpb.ResponseStatusForbidden
+		rsp.Message = correctionBatchErrorAccessDenied
+		return nil
+	}
+
+	reversedAt := time.Now()
+	batch.ReverserId = req.UserId
+	batch.ReversalReason = req.Comment
+	batch.ReversedAt = &reversedAt
+
+	entries, msg := s.getAccountingCorrectionEntries(ctx, batch, true)
+
+	if msg != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = msg
+		return nil
+	}
+
+	batch.Status = internalPkg.AccountingCorrectionBatchStatusReversed
+	batch.ReversalEntryIds = nil
+
+	for _, entry := range entries {
+		batch.ReversalEntryIds = append(batch.ReversalEntryIds, entry.(*billingpb.AccountingEntry).Id)
+	}
+
+	e := s.bookAccountingCorrectionBatch(ctx, batch, entries, internalPkg.AccountingCorrectionBatchStatusApproved)
+
+	if e != nil {
+		rsp.Status = e.Status
+		rsp.Message = e.Message
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = batch
+
+	return nil
+}
+
+// getPendingAccountingCorrectionBatch returns the batch waiting for approval if the user of request is allowed
+// to decide on it.
+func (s *Service) getPendingAccountingCorrectionBatch(
+	ctx context.Context,
+	req *internalPkg.ChangeAccountingCorrectionBatchRequest,
+) (*internalPkg.AccountingCorrectionBatch, error) {
+	batch, err := s.correctionBatchRepository.GetById(ctx, req.Id)
+
+	if err != nil {
+		return nil, newBillingServerResponseError(billingpb.ResponseStatusNotFound, correctionBatchErrorNotFound)
+	}
+
+	if batch.Status != internalPkg.AccountingCorrectionBatchStatusPending {
+		return nil, newBillingServerResponseError(billingpb.ResponseStatusBadData, correctionBatchErrorNotPending)
+	}
+
+	if req.UserId == batch.CreatorId {
+		return nil, newBillingServerResponseError(billingpb.ResponseStatusForbidden, correctionBatchErrorSameUser)
+	}
+
+	if !s.isAccountingCorrectionApprover(ctx, req.UserId) {
+		return nil, newBillingServerResponseError(billingpb.ResponseStatusForbidden, correctionBatchErrorAccessDenied)
+	}
+
+	return batch, nil
+}
+
+// isAccountingCorrectionApprover checks that the user is admin or financial manager of platform.
+func (s *Service) isAccountingCorrectionApprover(ctx context.Context, userId string) bool {
+	if userId == "" {
+		return false
+	}
+
+	role, err := s.userRoleRepository.GetAdminUserByUserId(ctx, userId)
+
+	return err == nil && helper.Contains(accountingCorrectionApproverRoles, role.Role)
+}
+
+// validateAccountingCorrectionBatch sets errors of invalid corrections and returns true if all corrections are valid.
+func (s *Service) validateAccountingCorrectionBatch(
+	ctx context.Context,
+	batch *internalPkg.AccountingCorrectionBatch,
+) bool {
+	isValid := true
+	references := make(map[string]bool)
+	merchants := make(map[string]*billingpb.Merchant)
+
+	for i, correction := range batch.Corrections {
+		if correction.Line <= 0 {
+			correction.Line = int32(i + 1)
+		}
+
+		correction.ErrorCode = ""
+		correction.ErrorMessage = ""
+		msg := s.validateAccountingCorrection(ctx, correction, merchants)
+
+		if msg == nil && references[correction.Reference] {
+			msg = correctionBatchErrorDuplicatedRef
+		}
+
+		if msg != nil {
+			correction.ErrorCode = msg.Code
+			correction.ErrorMessage = msg.Message
+			isValid = false
+			continue
+		}
+
+		references[correction.Reference] = true
+	}
+
+	return isValid
+}
+
+func (s *Service) validateAccountingCorrection(
+	ctx context.Context,
+	correction *internalPkg.AccountingCorrection,
+	merchants map[string]*billingpb.Merchant,
+) *billingpb.ResponseErrorMessage {
+	if correction.Type == "" {
+		correction.Type = pkg.AccountingEntryTypeMerchantRoyaltyCorrection
+	}
+
+	if _, ok := availableAccountingEntries[correction.Type]; !ok {
+		return accountingEntryErrorUnknownEntry
+	}
+
+	correction.Amount = tools.ToPrecise(correction.Amount)
+
+	if correction.MerchantId == "" || correction.Amount == 0 || correction.Reason == "" || correction.Reference == "" {
+		return correctionBatchErrorCorrectionInvalid
+	}
+
+	merchant, ok := merchants[correction.MerchantId]
+
+	if !ok {
+		var err error
+		merchant, err = s.merchantRepository.GetById(ctx, correction.MerchantId)
+
+		if err != nil {
+			return accountingEntryErrorMerchantNotFound
+		}
+
+		merchants[correction.MerchantId] = merchant
+	}
+
+	if correction.Currency != merchant.GetPayoutCurrency() {
+		return correctionBatchErrorCurrencyMismatch
+	}
+
+	return nil
+}
+
+// getAccountingCorrectionEntries returns entries of corrections of the batch in the order of corrections,
+// reversal entries have opposite amounts.
+func (s *Service) getAccountingCorrectionEntries(
+	ctx context.Context,
+	batch *internalPkg.AccountingCorrectionBatch,
+	isReversal bool,
+) ([]interface{}, *billingpb.ResponseErrorMessage) {
+	var entries []interface{}
+
+	for _, correction := range batch.Corrections {
+		merchant, err := s.merchantRepository.GetById(ctx, correction.MerchantId)
+
+		if err != nil {
+			return nil, accountingEntryErrorMerchantNotFound
+		}
+
+		country, err := s.country.GetByIsoCodeA2(ctx, merchant.GetCompany().GetCountry())
+
+		if err != nil {
+			return nil, accountingEntryErrorCountryNotFound
+		}
+
+		req := &billingpb.CreateAccountingEntryRequest{
+			Type:       correction.Type,
+			MerchantId: correction.MerchantId,
+			Amount:     correction.Amount,
+			Currency:   correction.Currency,
+			Reason:     fmt.Sprintf(accountingCorrectionReasonMask, correction.Reason, correction.Reference),
+			Date:       batch.Date,
+			Status:     pkg.BalanceTransactionStatusAvailable,
+		}
+
+		if isReversal {
+			req.Amount = -correction.Amount
+			req.Reason = fmt.Sprintf(accountingCorrectionReversalMask, batch.Id, req.Reason)
+			req.Date = batch.ReversedAt.Unix()
+		}
+
+		handler := &accountingEntry{
+			Service:           s,
+			ctx:               ctx,
+			merchant:          merchant,
+			country:           country,
+			req:               req,
+			correctionBatchId: batch.Id,
+		}
+
+		if err = handler.processManualCorrectionEvent(); err != nil {
+			zap.L().Error(
+				"Accounting correction entry build failed",
+				zap.Error(err),
+				zap.String("batch_id", batch.Id),
+				zap.String("reference", correction.Reference),
+			)
+
+			if msg, ok := err.(*billingpb.ResponseErrorMessage); ok {
+				return nil, msg
+			}
+
+			return nil, accountingEntryErrorUnknown
+		}
+
+		entries = append(entries, handler.accountingEntries...)
+	}
+
+	return entries, nil
+}
+
+// bookAccountingCorrectionBatch moves the batch from the previous status and saves its entries. If entries couldn't
+// be saved the status is restored only when none of them is saved, otherwise the batch is marked as partially booked
+// with identifiers of saved entries. Balances of merchants of the batch are updated after that.
+func (s *Service) bookAccountingCorrectionBatch(
+	ctx context.Context,
+	batch *internalPkg.AccountingCorrectionBatch,
+	entries []interface{},
+	previousStatus string,
+) *billingpb.ResponseError {
+	err := s.correctionBatchRepository.Update(ctx, batch, previousStatus)
+
+	if err == mongo.ErrNoDocuments {
+		if previousStatus == internalPkg.AccountingCorrectionBatchStatusPending {
+			return newBillingServerResponseError(billingpb.ResponseStatusBadData, correctionBatchErrorNotPending)
+		}
+
+		return newBillingServerResponseError(billingpb.ResponseStatusBadData, correctionBatchErrorNotApproved)
+	}
+
+	if err != nil {
+		return newBillingServerResponseError(billingpb.ResponseStatusSystemError, accountingEntryErrorUnknown)
+	}
+
+	handler := &accountingEntry{Service: s, ctx: ctx, accountingEntries: entries}
+
+	if err = handler.saveAccountingEntries(); err != nil {
+		s.failAccountingCorrectionBatchBooking(ctx, batch, entries, previousStatus)
+		return newBillingServerResponseError(billingpb.ResponseStatusSystemError, accountingEntryErrorUnknown)
+	}
+
+	if err = s.updateAccountingCorrectionBatchBalances(ctx, batch); err != nil {
+		return newBillingServerResponseError(billingpb.ResponseStatusSystemError, accountingEntryBalanceUpdateFailed)
+	}
+
+	return nil
+}
+
+// failAccountingCorrectionBatchBooking restores the previous status of the batch if none of its entries is saved,
+// otherwise the batch is marked as partially booked, keeps identifiers of saved entries only and balances
+// of its merchants are updated. Batch is marked as partially booked if saved entries couldn't be found.
+func (s *Service) failAccountingCorrectionBatchBooking(
+	ctx context.Context,
+	batch *internalPkg.AccountingCorrectionBatch,
+	entries []interface{},
+	previousStatus string,
+) {
+	status := batch.Status
+	isReversal := status == internalPkg.AccountingCorrectionBatchStatusReversed
+	savedIds, err := s.getSavedAccountingEntryIds(ctx, entries)
+
+	switch {
+	case err == nil && len(savedIds) == 0:
+		batch.Status = previousStatus
+		savedIds = nil
+	case err == nil:
+		batch.Status = internalPkg.AccountingCorrectionBatchStatusPartiallyBooked
+	default:
+		batch.Status = internalPkg.AccountingCorrectionBatchStatusPartiallyBooked
+		savedIds = nil
+
+		for _, entry := range entries {
+			savedIds = append(savedIds, entry.(*billingpb.AccountingEntry).Id)
+		}
+	}
+
+	if isReversal {
+		batch.ReversalEntryIds = savedIds
+	} else {
+		batch.EntryIds = savedIds
+	}
+
+	if err = s.correctionBatchRepository.Update(ctx, batch, status); err != nil {
+		zap.L().Error(
+			"Status of accounting correction batch not changed after failed booking",
+			zap.Error(err),
+			zap.String("batch_id", batch.Id),
+			zap.String("status", batch.Status),
+			zap.Strings("saved_entry_ids", savedIds),
+		)
+		return
+	}
+
+	if batch.Status == internalPkg.AccountingCorrectionBatchStatusPartiallyBooked {
+		zap.L().Error(
+			"Accounting correction batch partially booked",
+			zap.String("batch_id", batch.Id),
+			zap.Strings("saved_entry_ids", savedIds),
+		)
+		_ = s.updateAccountingCorrectionBatchBalances(ctx, batch)
+	}
+}
+
+// getSavedAccountingEntryIds returns identifiers of the entries which are saved in database.
+func (s *Service) getSavedAccountingEntryIds(ctx context.Context, entries []interface{}) ([]string, error) {
+	var saved []*struct {
+		Id primitive.ObjectID `bson:"_id"`
+	}
+
+	oids := make([]primitive.ObjectID, 0, len(entries))
+
+	for _, entry := range entries {
+		oid, err := primitive.ObjectIDFromHex(entry.(*billingpb.AccountingEntry).Id)
+
+		if err != nil {
+			return nil, err
+		}
+
+		oids = append(oids, oid)
+	}
+
+	query := bson.M{"_id": bson.M{"$in": oids}}
+	opts := options.Find().SetProjection(bson.M{"_id": 1})
+	cursor, err := s.db.Collection(collectionAccountingEntry).Find(ctx, query, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionAccountingEntry),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	if err = cursor.All(ctx, &saved); err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionAccountingEntry),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(saved))
+
+	for _, entry := range saved {
+		ids = append(ids, entry.Id.Hex())
+	}
+
+	return ids, nil
+}
+
+// updateAccountingCorrectionBatchBalances updates balances of merchants of corrections of the batch.
+func (s *Service) updateAccountingCorrectionBatchBalances(
+	ctx context.Context,
+	batch *internalPkg.AccountingCorrectionBatch,
+) error {
+	merchants := make(map[string]bool)
+
+	for _, correction := range batch.Corrections {
+		if merchants[correction.MerchantId] {
+			continue
+		}
+
+		merchants[correction.MerchantId] = true
+
+		if _, err := s.updateMerchantBalance(ctx, correction.MerchantId); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseAccountingCorrectionFile reads corrections from CSV file, lines of file are kept in corrections.
+func parseAccountingCorrectionFile(file []byte) ([]*internalPkg.AccountingCorrection, error) {
+	reader := csv.NewReader(bytes.NewReader(file))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+
+	if err != nil {
+		return nil, correctionBatchErrorFileInvalid
+	}
+
+	columns := make(map[string]int)
+
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		if helper.Contains(accountingCorrectionColumns, name) {
+			columns[name] = i
+		}
+	}
+
+	for _, name := range accountingCorrectionColumns {
+		if _, ok := columns[name]; !ok && name != accountingCorrectionColumnType {
+			return nil, correctionBatchErrorFileInvalid
+		}
+	}
+
+	var corrections []*internalPkg.AccountingCorrection
+
+	for line := int32(2); ; line++ {
+		record, err := reader.Read()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, correctionBatchErrorFileInvalid
+		}
+
+		if len(corrections) >= accountingCorrectionBatchMaxSize {
+			return nil, correctionBatchErrorTooManyCorrections
+		}
+
+		value := func(column string) string {
+			i, ok := columns[column]
+
+			if !ok || i >= len(record) {
+				return ""
+			}
+
+			return strings.TrimSpace(record[i])
+		}
+
+		correction := &internalPkg.AccountingCorrection{
+			Line:       line,
+			MerchantId: value(accountingCorrectionColumnMerchant),
+			Type:       value(accountingCorrectionColumnType),
+			Currency:   strings.ToUpper(value(accountingCorrectionColumnCurrency)),
+			Reason:     value(accountingCorrectionColumnReason),
+			Reference:  value(accountingCorrectionColumnReference),
+		}
+
+		if amount := value(accountingCorrectionColumnAmount); amount != "" {
+			correction.Amount, err = strconv.ParseFloat(amount, 64)
+
+			if err != nil {
+				return nil, correctionBatchErrorFileInvalid
+			}
+		}
+
+		corrections = append(corrections, correction)
+	}
+
+	return corrections, nil
+}
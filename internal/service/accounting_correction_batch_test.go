@@ -0,0 +1,406 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/go-redis/redis"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/mongodb"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	"github.com/paysuper/paysuper-billing-server/internal/database"
+	"github.com/paysuper/paysuper-billing-server/internal/mocks"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/internal/repository"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	casbinMocks "github.com/paysuper/paysuper-proto/go/casbinpb/mocks"
+	reportingMocks "github.com/paysuper/paysuper-proto/go/reporterpb/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	rabbitmq "gopkg.in/ProtocolONE/rabbitmq.v1/pkg"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type AccountingCorrectionBatchTestSuite struct {
+	suite.Suite
+	service *Service
+	log     *zap.Logger
+	cache   database.CacheInterface
+
+	merchant      *billingpb.Merchant
+	project       *billingpb.Project
+	paymentMethod *billingpb.PaymentMethod
+	paymentSystem *billingpb.PaymentSystem
+}
+
+func Test_AccountingCorrectionBatch(t *testing.T) {
+	suite.Run(t, new(AccountingCorrectionBatchTestSuite))
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) SetupTest() {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		suite.FailNow("Config load failed", "%v", err)
+	}
+	cfg.CardPayApiUrl = "https://sandbox.cardpay.com"
+
+	m, err := migrate.New(
+		"file://../../migrations/tests",
+		cfg.MongoDsn)
+	assert.NoError(suite.T(), err, "Migrate init failed")
+
+	err = m.Up()
+	if err != nil && err.Error() != "no change" {
+		suite.FailNow("Migrations failed", "%v", err)
+	}
+
+	ctx, _ := context.WithTimeout(context.Background(), 50*time.Second)
+	opts := []mongodb.Option{mongodb.Context(ctx)}
+	db, err := mongodb.NewDatabase(opts...)
+	if err != nil {
+		suite.FailNow("Database connection failed", "%v", err)
+	}
+
+	suite.log, err = zap.NewProduction()
+
+	if err != nil {
+		suite.FailNow("Logger initialization failed", "%v", err)
+	}
+
+	broker, err := rabbitmq.NewBroker(cfg.BrokerAddress)
+
+	if err != nil {
+		suite.FailNow("Creating RabbitMQ publisher failed", "%v", err)
+	}
+
+	redisClient := database.NewRedis(
+		&redis.Options{
+			Addr:     cfg.RedisHost,
+			Password: cfg.RedisPassword,
+		},
+	)
+
+	redisdb := mocks.NewTestRedis()
+	suite.cache, err = database.NewCacheRedis(redisdb, "cache")
+	suite.service = NewBillingService(
+		db,
+		cfg,
+		mocks.NewGeoIpServiceTestOk(),
+		mocks.NewRepositoryServiceOk(),
+		mocks.NewTaxServiceOkMock(),
+		broker,
+		redisClient,
+		suite.cache,
+		mocks.NewCurrencyServiceMockOk(),
+		mocks.NewDocumentSignerMockOk(),
+		&reportingMocks.ReporterService{},
+		mocks.NewFormatterOK(),
+		mocks.NewBrokerMockOk(),
+		&casbinMocks.CasbinService{},
+	)
+
+	if err := suite.service.Init(); err != nil {
+		suite.FailNow("Billing service initialization failed", "%v", err)
+	}
+
+	suite.merchant, suite.project, suite.paymentMethod, suite.paymentSystem = helperCreateEntitiesForTests(suite.Suite, suite.service)
+
+	centrifugoMock := &mocks.CentrifugoInterface{}
+	centrifugoMock.On("GetChannelToken", mock.Anything, mock.Anything).Return("token")
+	centrifugoMock.On("Publish", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	suite.service.centrifugoDashboard = centrifugoMock
+	suite.service.centrifugoPaymentForm = centrifugoMock
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) TearDownTest() {
+	err := suite.service.db.Drop()
+
+	if err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	err = suite.service.db.Close()
+
+	if err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) TestAccountingCorrectionBatch_Create_Ok() {
+	rsp := suite.createBatch(suite.getCorrections())
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), internalPkg.AccountingCorrectionBatchStatusPending, rsp.Item.Status)
+	assert.Equal(suite.T(), pkg.AccountingEntryTypeMerchantRoyaltyCorrection, rsp.Item.Corrections[0].Type)
+	assert.EqualValues(suite.T(), 2, rsp.Item.Corrections[1].Line)
+
+	rsp2 := &internalPkg.AccountingCorrectionBatchResponse{}
+	err := suite.service.GetAccountingCorrectionBatch(
+		context.TODO(),
+		&internalPkg.GetAccountingCorrectionBatchRequest{Id: rsp.Item.Id},
+		rsp2,
+	)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp2.Status)
+	assert.Len(suite.T(), rsp2.Item.Corrections, 2)
+	assert.Empty(suite.T(), rsp2.Item.EntryIds)
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) TestAccountingCorrectionBatch_Create_File_Ok() {
+	currency := suite.merchant.GetPayoutCurrency()
+	file := "merchant_id,currency,amount,reason,reference\n" +
+		suite.merchant.Id + "," + currency + ",10.50,Goodwill adjustment,GW-1\n" +
+		suite.merchant.Id + "," + currency + ",-3,Fee rebate,FR-1\n"
+	req := &internalPkg.CreateAccountingCorrectionBatchRequest{
+		CreatorId: primitive.NewObjectID().Hex(),
+		File:      []byte(file),
+	}
+	rsp := &internalPkg.AccountingCorrectionBatchResponse{}
+	err := suite.service.CreateAccountingCorrectionBatch(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Len(suite.T(), rsp.Item.Corrections, 2)
+	assert.EqualValues(suite.T(), 2, rsp.Item.Corrections[0].Line)
+	assert.Equal(suite.T(), 10.5, rsp.Item.Corrections[0].Amount)
+	assert.Equal(suite.T(), "FR-1", rsp.Item.Corrections[1].Reference)
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) TestAccountingCorrectionBatch_Create_FileInvalid_Error() {
+	req := &internalPkg.CreateAccountingCorrectionBatchRequest{
+		CreatorId: primitive.NewObjectID().Hex(),
+		File:      []byte("merchant_id,amount\n" + suite.merchant.Id + ",10\n"),
+	}
+	rsp := &internalPkg.AccountingCorrectionBatchResponse{}
+	err := suite.service.CreateAccountingCorrectionBatch(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), correctionBatchErrorFileInvalid, rsp.Message)
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) TestAccountingCorrectionBatch_Create_InvalidCorrections_Error() {
+	corrections := suite.getCorrections()
+	corrections[1].Reference = corrections[0].Reference
+	corrections = append(corrections, &internalPkg.AccountingCorrection{
+		MerchantId: suite.merchant.Id,
+		Currency:   "XXX",
+		Amount:     1,
+		Reason:     "FX correction",
+		Reference:  "FX-1",
+	})
+
+	rsp := suite.createBatch(corrections)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), correctionBatchErrorInvalid, rsp.Message)
+	assert.Empty(suite.T(), rsp.Item.Corrections[0].ErrorCode)
+	assert.Equal(suite.T(), correctionBatchErrorDuplicatedRef.Code, rsp.Item.Corrections[1].ErrorCode)
+	assert.Equal(suite.T(), correctionBatchErrorCurrencyMismatch.Code, rsp.Item.Corrections[2].ErrorCode)
+
+	_, err := suite.service.correctionBatchRepository.GetById(context.TODO(), rsp.Item.Id)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) TestAccountingCorrectionBatch_Create_CreatorRequired_Error() {
+	req := &internalPkg.CreateAccountingCorrectionBatchRequest{Corrections: suite.getCorrections()}
+	rsp := &internalPkg.AccountingCorrectionBatchResponse{}
+	err := suite.service.CreateAccountingCorrectionBatch(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), correctionBatchErrorCreatorRequired, rsp.Message)
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) TestAccountingCorrectionBatch_Approve_Ok() {
+	batch := suite.createBatch(suite.getCorrections()).Item
+	rsp := suite.changeBatch(suite.service.ApproveAccountingCorrectionBatch, batch.Id, suite.addAdminUser())
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), internalPkg.AccountingCorrectionBatchStatusApproved, rsp.Item.Status)
+	assert.Len(suite.T(), rsp.Item.EntryIds, 2)
+	assert.NotNil(suite.T(), rsp.Item.DecidedAt)
+
+	entries := suite.getBatchEntries(batch.Id)
+	assert.Len(suite.T(), entries, 2)
+
+	for i, entry := range entries {
+		assert.Equal(suite.T(), rsp.Item.Corrections[i].EntryId, entry.Id)
+		assert.Equal(suite.T(), suite.merchant.Id, entry.MerchantId)
+		assert.Equal(suite.T(), rsp.Item.Corrections[i].Amount, entry.Amount)
+		assert.Contains(suite.T(), entry.Reason, rsp.Item.Corrections[i].Reference)
+	}
+
+	rsp = suite.changeBatch(suite.service.ApproveAccountingCorrectionBatch, batch.Id, suite.addAdminUser())
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), correctionBatchErrorNotPending, rsp.Message)
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) TestAccountingCorrectionBatch_Approve_SameUser_Error() {
+	batch := suite.createBatch(suite.getCorrections()).Item
+	rsp := suite.changeBatch(suite.service.ApproveAccountingCorrectionBatch, batch.Id, batch.CreatorId)
+	assert.Equal(suite.T(), billingpb.ResponseStatusForbidden, rsp.Status)
+	assert.Equal(suite.T(), correctionBatchErrorSameUser, rsp.Message)
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) TestAccountingCorrectionBatch_Approve_AccessDenied_Error() {
+	batch := suite.createBatch(suite.getCorrections()).Item
+	rsp := suite.changeBatch(suite.service.ApproveAccountingCorrectionBatch, batch.Id, primitive.NewObjectID().Hex())
+	assert.Equal(suite.T(), billingpb.ResponseStatusForbidden, rsp.Status)
+	assert.Equal(suite.T(), correctionBatchErrorAccessDenied, rsp.Message)
+	assert.Empty(suite.T(), suite.getBatchEntries(batch.Id))
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) TestAccountingCorrectionBatch_Reject_Ok() {
+	batch := suite.createBatch(suite.getCorrections()).Item
+	rsp := suite.changeBatch(suite.service.RejectAccountingCorrectionBatch, batch.Id, suite.addAdminUser())
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), internalPkg.AccountingCorrectionBatchStatusRejected, rsp.Item.Status)
+	assert.Empty(suite.T(), suite.getBatchEntries(batch.Id))
+
+	rsp = suite.changeBatch(suite.service.ReverseAccountingCorrectionBatch, batch.Id, suite.addAdminUser())
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), correctionBatchErrorNotApproved, rsp.Message)
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) TestAccountingCorrectionBatch_Reverse_Ok() {
+	batch := suite.createBatch(suite.getCorrections()).Item
+	userId := suite.addAdminUser()
+	rsp := suite.changeBatch(suite.service.ApproveAccountingCorrectionBatch, batch.Id, userId)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	rsp = suite.changeBatch(suite.service.ReverseAccountingCorrectionBatch, batch.Id, userId)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), internalPkg.AccountingCorrectionBatchStatusReversed, rsp.Item.Status)
+	assert.Len(suite.T(), rsp.Item.ReversalEntryIds, 2)
+	assert.Equal(suite.T(), userId, rsp.Item.ReverserId)
+
+	entries := suite.getBatchEntries(batch.Id)
+	assert.Len(suite.T(), entries, 4)
+
+	total := float64(0)
+
+	for _, entry := range entries {
+		total += entry.Amount
+	}
+
+	assert.Zero(suite.T(), total)
+
+	rsp = suite.changeBatch(suite.service.ReverseAccountingCorrectionBatch, batch.Id, userId)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), correctionBatchErrorNotApproved, rsp.Message)
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) TestAccountingCorrectionBatch_Approve_NothingBooked_StatusRestored() {
+	ledgerEntryRepository := &mocks.LedgerEntryRepositoryInterface{}
+	ledgerEntryRepository.On("MultipleInsert", mock.Anything, mock.Anything).Return(errors.New("some error"))
+	ledgerEntryRepository.On("DeleteByJournalId", mock.Anything, mock.Anything).Return(nil)
+	suite.service.ledgerEntryRepository = ledgerEntryRepository
+
+	batch := suite.createBatch(suite.getCorrections()).Item
+	rsp := suite.changeBatch(suite.service.ApproveAccountingCorrectionBatch, batch.Id, suite.addAdminUser())
+	assert.Equal(suite.T(), billingpb.ResponseStatusSystemError, rsp.Status)
+	assert.Empty(suite.T(), suite.getBatchEntries(batch.Id))
+
+	batch, err := suite.service.correctionBatchRepository.GetById(context.TODO(), batch.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.AccountingCorrectionBatchStatusPending, batch.Status)
+	assert.Empty(suite.T(), batch.EntryIds)
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) TestAccountingCorrectionBatch_Approve_PartiallyBooked() {
+	ledgerEntryRepository := &mocks.LedgerEntryRepositoryInterface{}
+	ledgerEntryRepository.On("MultipleInsert", mock.Anything, mock.Anything).Return(errors.New("some error"))
+	ledgerEntryRepository.On("DeleteByJournalId", mock.Anything, mock.Anything).Return(errors.New("some error"))
+	suite.service.ledgerEntryRepository = ledgerEntryRepository
+
+	batch := suite.createBatch(suite.getCorrections()).Item
+	rsp := suite.changeBatch(suite.service.ApproveAccountingCorrectionBatch, batch.Id, suite.addAdminUser())
+	assert.Equal(suite.T(), billingpb.ResponseStatusSystemError, rsp.Status)
+
+	entries := suite.getBatchEntries(batch.Id)
+	assert.Len(suite.T(), entries, 2)
+
+	batch, err := suite.service.correctionBatchRepository.GetById(context.TODO(), batch.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.AccountingCorrectionBatchStatusPartiallyBooked, batch.Status)
+	assert.ElementsMatch(suite.T(), []string{entries[0].Id, entries[1].Id}, batch.EntryIds)
+
+	rsp = suite.changeBatch(suite.service.ApproveAccountingCorrectionBatch, batch.Id, suite.addAdminUser())
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), correctionBatchErrorNotPending, rsp.Message)
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) getCorrections() []*internalPkg.AccountingCorrection {
+	return []*internalPkg.AccountingCorrection{
+		{
+			MerchantId: suite.merchant.Id,
+			Currency:   suite.merchant.GetPayoutCurrency(),
+			Amount:     10.5,
+			Reason:     "Goodwill adjustment",
+			Reference:  "GW-1",
+		},
+		{
+			MerchantId: suite.merchant.Id,
+			Currency:   suite.merchant.GetPayoutCurrency(),
+			Amount:     -3,
+			Reason:     "Fee rebate",
+			Reference:  "FR-1",
+		},
+	}
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) createBatch(
+	corrections []*internalPkg.AccountingCorrection,
+) *internalPkg.AccountingCorrectionBatchResponse {
+	req := &internalPkg.CreateAccountingCorrectionBatchRequest{
+		CreatorId:   primitive.NewObjectID().Hex(),
+		Corrections: corrections,
+	}
+	rsp := &internalPkg.AccountingCorrectionBatchResponse{}
+	err := suite.service.CreateAccountingCorrectionBatch(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+
+	return rsp
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) changeBatch(
+	fn func(context.Context, *internalPkg.ChangeAccountingCorrectionBatchRequest, *internalPkg.AccountingCorrectionBatchResponse) error,
+	id, userId string,
+) *internalPkg.AccountingCorrectionBatchResponse {
+	req := &internalPkg.ChangeAccountingCorrectionBatchRequest{Id: id, UserId: userId, Comment: "month end"}
+	rsp := &internalPkg.AccountingCorrectionBatchResponse{}
+	err := fn(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+
+	return rsp
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) addAdminUser() string {
+	userRole := &billingpb.UserRole{
+		Id:     primitive.NewObjectID().Hex(),
+		UserId: primitive.NewObjectID().Hex(),
+		Role:   billingpb.RoleSystemFinancial,
+	}
+	err := suite.service.userRoleRepository.AddAdminUser(context.TODO(), userRole)
+	assert.NoError(suite.T(), err)
+
+	return userRole.UserId
+}
+
+func (suite *AccountingCorrectionBatchTestSuite) getBatchEntries(id string) []*billingpb.AccountingEntry {
+	var entries []*billingpb.AccountingEntry
+
+	oid, _ := primitive.ObjectIDFromHex(id)
+	query := bson.M{"source.id": oid, "source.type": repository.CollectionAccountingCorrectionBatch}
+	opts := options.Find().SetSort(bson.M{"_id": 1})
+	cursor, err := suite.service.db.Collection(collectionAccountingEntry).Find(context.TODO(), query, opts)
+	assert.NoError(suite.T(), err)
+
+	err = cursor.All(context.TODO(), &entries)
+	assert.NoError(suite.T(), err)
+
+	return entries
+}
@@ -3,7 +3,9 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/golang/protobuf/ptypes"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
 	"github.com/paysuper/paysuper-billing-server/internal/repository"
 	"github.com/paysuper/paysuper-billing-server/pkg"
 	"github.com/paysuper/paysuper-proto/go/billingpb"
@@ -31,6 +33,7 @@ const (
 	accountingEventTypePayment          = "payment"
 	accountingEventTypeRefund           = "refund"
 	accountingEventTypeManualCorrection = "manual-correction"
+	accountingEventTypeDisputeReversal  = "dispute-reversal"
 )
 
 var (
@@ -51,6 +54,9 @@ var (
 	accountingEntryBalanceUpdateFailed             = newBillingServerErrorMsg("ae00015", "balance update failed after create accounting entry")
 	accountingEntryOriginalTaxNotFound             = newBillingServerErrorMsg("ae00016", "real_tax_fee entry from original order not found, refund processing failed")
 	accountingEntryVatCurrencyNotSet               = newBillingServerErrorMsg("ae00017", "vat currency not set")
+	accountingEntryChargebackNotFound              = newBillingServerErrorMsg("ae00018", "chargeback entries of refund not found, dispute reversal failed")
+	accountingEntryErrorLedgerAccountsNotFound     = newBillingServerErrorMsg("ae00019", "ledger accounts of accounting entry type not found")
+	accountingEntryErrorJournalUnbalanced          = newBillingServerErrorMsg("ae00020", "journal of accounting entries is unbalanced")
 
 	availableAccountingEntries = map[string]bool{
 		pkg.AccountingEntryTypeRealGrossRevenue:                    true,
@@ -100,12 +106,14 @@ var (
 		pkg.AccountingEntryTypeMerchantRollingReserveCreate:        true,
 		pkg.AccountingEntryTypeMerchantRollingReserveRelease:       true,
 		pkg.AccountingEntryTypeMerchantRoyaltyCorrection:           true,
+		pkg.AccountingEntryTypeRealChargebackReversal:              true,
 	}
 
 	availableAccountingEntriesSourceTypes = map[string]bool{
-		repository.CollectionOrder:    true,
-		repository.CollectionRefund:   true,
-		repository.CollectionMerchant: true,
+		repository.CollectionOrder:                     true,
+		repository.CollectionRefund:                    true,
+		repository.CollectionMerchant:                  true,
+		repository.CollectionAccountingCorrectionBatch: true,
 	}
 
 	rollingReserveAccountingEntries = map[string]bool{
@@ -126,10 +134,24 @@ type accountingEntry struct {
 	order             *billingpb.Order
 	refund            *billingpb.Refund
 	refundOrder       *billingpb.Order
+	dispute           *internalPkg.Dispute
 	merchant          *billingpb.Merchant
 	country           *billingpb.Country
 	accountingEntries []interface{}
 	req               *billingpb.CreateAccountingEntryRequest
+
+	// Entries are recomputed by reprocessing of accounting even if they were already created.
+	reprocessing bool
+
+	// Manual corrections of the batch have the batch as source instead of merchant.
+	correctionBatchId string
+
+	// Releases lock of rolling reserve of merchant acquired to book the reserve of the payment up to the cap.
+	rollingReserveUnlock func()
+
+	// Shares of the merchant in customer money of source documents computed from amounts of the order or the refund,
+	// they are settled from the customer clearing account to the merchant payable account by the journal.
+	clearingSettlements map[ledgerClearingKey]float64
 }
 
 type AccountingServiceInterface interface {
@@ -265,14 +287,34 @@ func (s *Service) CreateAccountingEntry(
 }
 
 func (s *Service) onPaymentNotify(ctx context.Context, order *billingpb.Order) error {
-	country, err := s.country.GetByIsoCodeA2(ctx, order.GetCountry())
+	handler, err := s.getPaymentAccountingHandler(ctx, order)
+
+	if err != nil {
+		return err
+	}
+
+	return s.processEvent(handler, accountingEventTypePayment)
+}
+
+func (s *Service) onRefundNotify(ctx context.Context, refund *billingpb.Refund, order *billingpb.Order) error {
+	handler, err := s.getRefundAccountingHandler(ctx, refund, order)
+
 	if err != nil {
 		return err
 	}
 
+	return s.processEvent(handler, accountingEventTypeRefund)
+}
+
+func (s *Service) getPaymentAccountingHandler(ctx context.Context, order *billingpb.Order) (*accountingEntry, error) {
+	country, err := s.country.GetByIsoCodeA2(ctx, order.GetCountry())
+	if err != nil {
+		return nil, err
+	}
+
 	merchant, err := s.merchantRepository.GetById(ctx, order.GetMerchantId())
 	if err != nil {
-		return merchantErrorNotFound
+		return nil, merchantErrorNotFound
 	}
 
 	handler := &accountingEntry{
@@ -283,10 +325,51 @@ func (s *Service) onPaymentNotify(ctx context.Context, order *billingpb.Order) e
 		merchant: merchant,
 	}
 
-	return s.processEvent(handler, accountingEventTypePayment)
+	return handler, nil
 }
 
-func (s *Service) onRefundNotify(ctx context.Context, refund *billingpb.Refund, order *billingpb.Order) error {
+func (s *Service) getRefundAccountingHandler(
+	ctx context.Context,
+	refund *billingpb.Refund,
+	order *billingpb.Order,
+) (*accountingEntry, error) {
+	country, err := s.country.GetByIsoCodeA2(ctx, order.GetCountry())
+
+	if err != nil {
+		return nil, err
+	}
+
+	refundOrder, err := s.getOrderById(ctx, refund.CreatedOrderId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	merchant, err := s.merchantRepository.GetById(ctx, refundOrder.GetMerchantId())
+	if err != nil {
+		return nil, merchantErrorNotFound
+	}
+
+	handler := &accountingEntry{
+		Service:     s,
+		refund:      refund,
+		order:       order,
+		refundOrder: refundOrder,
+		ctx:         ctx,
+		country:     country,
+		merchant:    merchant,
+	}
+
+	return handler, nil
+}
+
+// onDisputeReversalNotify books reversal of the chargeback refund of the dispute won by merchant.
+func (s *Service) onDisputeReversalNotify(
+	ctx context.Context,
+	dispute *internalPkg.Dispute,
+	refund *billingpb.Refund,
+	order *billingpb.Order,
+) error {
 	country, err := s.country.GetByIsoCodeA2(ctx, order.GetCountry())
 
 	if err != nil {
@@ -309,12 +392,13 @@ func (s *Service) onRefundNotify(ctx context.Context, refund *billingpb.Refund,
 		refund:      refund,
 		order:       order,
 		refundOrder: refundOrder,
+		dispute:     dispute,
 		ctx:         ctx,
 		country:     country,
 		merchant:    merchant,
 	}
 
-	return s.processEvent(handler, accountingEventTypeRefund)
+	return s.processEvent(handler, accountingEventTypeDisputeReversal)
 }
 
 func (s *Service) processEvent(handler *accountingEntry, eventType string) error {
@@ -333,10 +417,18 @@ func (s *Service) processEvent(handler *accountingEntry, eventType string) error
 		err = handler.processManualCorrectionEvent()
 		break
 
+	case accountingEventTypeDisputeReversal:
+		err = handler.processDisputeReversalEvent()
+		break
+
 	default:
 		return accountingEntryUnknownEvent
 	}
 
+	if handler.rollingReserveUnlock != nil {
+		defer handler.rollingReserveUnlock()
+	}
+
 	if err != nil {
 		return err
 	}
@@ -365,6 +457,11 @@ func (h *accountingEntry) processManualCorrectionEvent() error {
 		entry.MerchantId = h.merchant.Id
 	}
 
+	if h.correctionBatchId != "" {
+		entry.Source.Type = repository.CollectionAccountingCorrectionBatch
+		entry.Source.Id = h.correctionBatchId
+	}
+
 	if err = h.addEntry(entry); err != nil {
 		return err
 	}
@@ -393,7 +490,7 @@ func (h *accountingEntry) processPaymentEvent() error {
 
 	foundCount := len(aes)
 
-	if foundCount > 0 {
+	if foundCount > 0 && !h.reprocessing {
 		zap.L().Error(
 			accountingEntryAlreadyCreated.Message,
 			zap.Error(err),
@@ -589,6 +686,14 @@ func (h *accountingEntry) processPaymentEvent() error {
 	// 26. psProfitTotal
 	// calculated in order_view
 
+	// 27. merchantRollingReserveCreate
+	if err = h.addRollingReserveEntry(merchantGrossRevenue.Amount); err != nil {
+		return err
+	}
+
+	// gross revenue of merchant less tax of the order is the share of merchant in money paid by customer
+	h.setLedgerClearingSettlement(realGrossRevenue, merchantGrossRevenue.Amount-realTaxFee.Amount)
+
 	return nil
 }
 
@@ -630,7 +735,7 @@ func (h *accountingEntry) processRefundEvent() error {
 	}
 
 	foundCount := len(aes)
-	if foundCount > 0 {
+	if foundCount > 0 && !h.reprocessing {
 		zap.L().Error(
 			accountingEntryAlreadyCreated.Message,
 			zap.Error(err),
@@ -863,6 +968,88 @@ func (h *accountingEntry) processRefundEvent() error {
 	// 18. psRefundProfit
 	// calculated in order_view
 
+	// refund to customer which isn't covered by refund of merchant and reversed tax is charged to merchant
+	h.setLedgerClearingSettlement(realRefund, merchantRefund.Amount+reverseTaxFee.Amount-realRefund.Amount)
+
+	return nil
+}
+
+// processDisputeReversalEvent returns the charged back amount to the payment system and to the merchant.
+// Merchant amount is booked as royalty correction to be paid by the next royalty report, chargeback fees
+// aren't reversed.
+func (h *accountingEntry) processDisputeReversalEvent() error {
+	id, _ := primitive.ObjectIDFromHex(h.refund.CreatedOrderId)
+	query := bson.M{
+		"object":      pkg.ObjectTypeBalanceTransaction,
+		"source.id":   id,
+		"source.type": repository.CollectionRefund,
+		"type":        pkg.AccountingEntryTypeRealChargebackReversal,
+	}
+	count, err := h.Service.db.Collection(collectionAccountingEntry).CountDocuments(h.ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionAccountingEntry),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return err
+	}
+
+	if count > 0 {
+		return accountingEntryAlreadyCreated
+	}
+
+	realRefund := h.newEntry("")
+	query["type"] = pkg.AccountingEntryTypeRealRefund
+	err = h.Service.db.Collection(collectionAccountingEntry).FindOne(h.ctx, query).Decode(&realRefund)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return accountingEntryChargebackNotFound
+		}
+
+		return err
+	}
+
+	merchantRefund := h.newEntry("")
+	query["type"] = pkg.AccountingEntryTypeMerchantRefund
+	err = h.Service.db.Collection(collectionAccountingEntry).FindOne(h.ctx, query).Decode(&merchantRefund)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return accountingEntryChargebackNotFound
+		}
+
+		return err
+	}
+
+	// 1. realChargebackReversal
+	realReversal := h.newEntry(pkg.AccountingEntryTypeRealChargebackReversal)
+	realReversal.CreatedAt = ptypes.TimestampNow()
+	realReversal.Amount = realRefund.Amount
+	realReversal.Currency = realRefund.Currency
+	realReversal.OriginalAmount = realRefund.OriginalAmount
+	realReversal.OriginalCurrency = realRefund.OriginalCurrency
+	realReversal.LocalAmount = realRefund.LocalAmount
+	realReversal.LocalCurrency = realRefund.LocalCurrency
+	if err = h.addEntry(realReversal); err != nil {
+		return err
+	}
+
+	// 2. merchantRoyaltyCorrection
+	correction := h.newEntry(pkg.AccountingEntryTypeMerchantRoyaltyCorrection)
+	correction.CreatedAt = ptypes.TimestampNow()
+	correction.Amount = merchantRefund.Amount
+	correction.Currency = merchantRefund.Currency
+	correction.Reason = fmt.Sprintf(disputeReversalReasonMask, h.dispute.Id)
+	if err = h.addEntry(correction); err != nil {
+		return err
+	}
+
+	h.setLedgerClearingSettlement(realReversal, realReversal.Amount)
+
 	return nil
 }
 
@@ -1063,7 +1250,19 @@ func (h *accountingEntry) addEntry(entry *billingpb.AccountingEntry) error {
 }
 
 func (h *accountingEntry) saveAccountingEntries() error {
-	_, err := h.db.Collection(collectionAccountingEntry).InsertMany(h.ctx, h.accountingEntries)
+	journal, err := h.getJournal()
+
+	if err != nil {
+		zap.L().Error(
+			"Accounting entries journal is invalid",
+			zap.Error(err),
+			zap.Any("accounting_entries", h.accountingEntries),
+		)
+
+		return err
+	}
+
+	_, err = h.db.Collection(collectionAccountingEntry).InsertMany(h.ctx, h.accountingEntries)
 
 	if err != nil {
 		zap.L().Error(
@@ -1071,10 +1270,18 @@ func (h *accountingEntry) saveAccountingEntries() error {
 			zap.Error(err),
 			zap.Any("accounting_entries", h.accountingEntries),
 		)
+		h.rollbackAccountingEntries("")
 
 		return err
 	}
 
+	if len(journal) > 0 {
+		if err = h.ledgerEntryRepository.MultipleInsert(h.ctx, journal); err != nil {
+			h.rollbackAccountingEntries(journal[0].JournalId)
+			return err
+		}
+	}
+
 	var ids []string
 	var paylinks = map[string]string{}
 	if h.order != nil {
@@ -1110,6 +1317,47 @@ func (h *accountingEntry) saveAccountingEntries() error {
 	return nil
 }
 
+// rollbackAccountingEntries deletes the accounting entries of the handler and lines of the journal saved before
+// the failure, so accounting entries of the source document can be saved again. Accounting entries are kept if
+// lines of the journal can't be deleted to not book the source document twice on the next attempt.
+func (h *accountingEntry) rollbackAccountingEntries(journalId string) {
+	if journalId != "" {
+		if err := h.ledgerEntryRepository.DeleteByJournalId(h.ctx, journalId); err != nil {
+			zap.L().Error(
+				"Accounting entries saved without lines of journal",
+				zap.Error(err),
+				zap.String("journal_id", journalId),
+				zap.Any("accounting_entries", h.accountingEntries),
+			)
+			return
+		}
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(h.accountingEntries))
+
+	for _, item := range h.accountingEntries {
+		oid, err := primitive.ObjectIDFromHex(item.(*billingpb.AccountingEntry).Id)
+
+		if err != nil {
+			continue
+		}
+
+		ids = append(ids, oid)
+	}
+
+	query := bson.M{"_id": bson.M{"$in": ids}}
+	_, err := h.db.Collection(collectionAccountingEntry).DeleteMany(h.ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionAccountingEntry),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+	}
+}
+
 func (h *accountingEntry) newEntry(entryType string) *billingpb.AccountingEntry {
 
 	var (
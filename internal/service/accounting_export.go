@@ -0,0 +1,810 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/paysuper/paysuper-billing-server/internal/helper"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/internal/repository"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"github.com/paysuper/paysuper-proto/go/reporterpb"
+	tools "github.com/paysuper/paysuper-tools/number"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"hash"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	reportTypeAccountingExport = "accounting_export"
+
+	// Size of chunks of export file in bytes, it must be less than the maximal size of document in database.
+	accountingExportChunkSize = 4 << 20
+
+	accountingExportXmlNamespace    = "urn:OECD:StandardAuditFile-Tax:2.00"
+	accountingExportXmlVersion      = "2.00"
+	accountingExportXmlSoftwareName = "PaySuper"
+	accountingExportXmlSoftwareId   = "paysuper-billing-server"
+	accountingExportXmlJournalId    = "accounting_entry"
+	accountingExportXmlJournalType  = "GL"
+	accountingExportXmlDateFormat   = "2006-01-02"
+)
+
+var (
+	accountingExportErrorFormatInvalid = newBillingServerErrorMsg("ax000001", "format of accounting export must be csv, xml or jsonl")
+	accountingExportErrorPeriodInvalid = newBillingServerErrorMsg("ax000002", "period of accounting export is invalid")
+	accountingExportErrorNotFound      = newBillingServerErrorMsg("ax000003", "accounting export not found")
+
+	accountingExportFormats = []string{
+		internalPkg.AccountingExportFormatCsv,
+		internalPkg.AccountingExportFormatXml,
+		internalPkg.AccountingExportFormatJsonl,
+	}
+
+	// Columns of CSV file, every row is an accounting entry and rows of the same source document follow each other.
+	accountingExportCsvColumns = []string{
+		"document_type",
+		"document_id",
+		"document_date",
+		"entry_id",
+		"entry_type",
+		"entry_date",
+		"merchant_id",
+		"country",
+		"debit_account",
+		"credit_account",
+		"amount",
+		"currency",
+		"original_amount",
+		"original_currency",
+		"local_amount",
+		"local_currency",
+		"status",
+	}
+)
+
+// CreateAccountingExport creates job of export of accounting entries of the operating company for the period,
+// file of export is built later by daemon.
+func (s *Service) CreateAccountingExport(
+	ctx context.Context,
+	req *internalPkg.CreateAccountingExportRequest,
+	rsp *internalPkg.AccountingExportResponse,
+) error {
+	if !helper.Contains(accountingExportFormats, req.Format) {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = accountingExportErrorFormatInvalid
+		return nil
+	}
+
+	if req.From <= 0 || req.To < req.From {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = accountingExportErrorPeriodInvalid
+		return nil
+	}
+
+	if !s.operatingCompany.Exists(ctx, req.OperatingCompanyId) {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = errorOperatingCompanyNotFound
+		return nil
+	}
+
+	now := time.Now()
+	export := &internalPkg.AccountingExport{
+		Id:                 primitive.NewObjectID().Hex(),
+		OperatingCompanyId: req.OperatingCompanyId,
+		CreatorId:          req.CreatorId,
+		Format:             req.Format,
+		From:               time.Unix(req.From, 0),
+		To:                 time.Unix(req.To, 0),
+		Status:             internalPkg.AccountingExportStatusPending,
+		SchemaVersion:      internalPkg.AccountingExportSchemaVersion,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}
+
+	if err := s.accountingExportRepository.Insert(ctx, export); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = export
+
+	return nil
+}
+
+// GetAccountingExport returns the export job with its status, checksum and control totals.
+func (s *Service) GetAccountingExport(
+	ctx context.Context,
+	req *internalPkg.GetAccountingExportRequest,
+	rsp *internalPkg.AccountingExportResponse,
+) error {
+	export, err := s.accountingExportRepository.GetById(ctx, req.Id)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = accountingExportErrorNotFound
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = export
+
+	return nil
+}
+
+// GetAccountingExportFile returns content of file of the completed export, reporter reads the file by it
+// when report file of the export is requested.
+func (s *Service) GetAccountingExportFile(
+	ctx context.Context,
+	req *internalPkg.GetAccountingExportRequest,
+	rsp *internalPkg.AccountingExportFileResponse,
+) error {
+	export, err := s.accountingExportRepository.GetById(ctx, req.Id)
+
+	if err != nil || export.Status != internalPkg.AccountingExportStatusCompleted {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = accountingExportErrorNotFound
+		return nil
+	}
+
+	chunks, err := s.accountingExportRepository.GetChunks(ctx, export.Id)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	file := make([]byte, 0, export.Size)
+
+	for _, chunk := range chunks {
+		file = append(file, chunk.Data...)
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Format = export.Format
+	rsp.Checksum = export.Checksum
+	rsp.File = file
+
+	return nil
+}
+
+// ProcessAccountingExports claims pending exports from oldest to newest one by one, builds their files and returns
+// the number of processed exports. Export is claimed by moving it to the processing status, so concurrent daemons
+// don't build the same export, export left in the processing status longer than claim timeout is claimed again
+// and its file is rebuilt from scratch. File of completed export is passed to reporter, failed export keeps the reason
+// of failure.
+func (s *Service) ProcessAccountingExports(ctx context.Context) (int, error) {
+	counter := 0
+	claimTimeout := time.Duration(s.cfg.AccountingExportClaimTimeout) * time.Second
+
+	for {
+		claimedAt := time.Now()
+		export, err := s.accountingExportRepository.ClaimPending(ctx, claimedAt, claimedAt.Add(-claimTimeout))
+
+		if err != nil {
+			return counter, err
+		}
+
+		if export == nil {
+			return counter, nil
+		}
+
+		err = s.buildAccountingExport(ctx, export)
+		finishedAt := time.Now()
+		export.FinishedAt = &finishedAt
+		export.UpdatedAt = finishedAt
+		export.Status = internalPkg.AccountingExportStatusCompleted
+
+		if err != nil {
+			zap.L().Error(
+				"Accounting export build failed",
+				zap.Error(err),
+				zap.String("export_id", export.Id),
+			)
+
+			export.Status = internalPkg.AccountingExportStatusFailed
+			export.ErrorMessage = err.Error()
+			_ = s.accountingExportRepository.DeleteChunks(ctx, export.Id)
+		}
+
+		if err = s.accountingExportRepository.Update(ctx, export); err != nil {
+			return counter, err
+		}
+
+		if export.Status == internalPkg.AccountingExportStatusCompleted {
+			s.requestAccountingExportReport(ctx, export)
+		}
+
+		counter++
+	}
+}
+
+// buildAccountingExport streams accounting entries of the export ordered by source document into the file
+// of the export format and calculates checksum and control totals of the file.
+func (s *Service) buildAccountingExport(ctx context.Context, export *internalPkg.AccountingExport) error {
+	oc, err := s.operatingCompany.GetById(ctx, export.OperatingCompanyId)
+
+	if err != nil {
+		return err
+	}
+
+	if err = s.accountingExportRepository.DeleteChunks(ctx, export.Id); err != nil {
+		return err
+	}
+
+	export.Documents = 0
+	export.Entries = 0
+	export.Chunks = 0
+	export.Size = 0
+	export.Totals = nil
+
+	file := newAccountingExportFile(ctx, s.accountingExportRepository, export)
+	writer := newAccountingExportWriter(export, oc, file)
+
+	if err = writer.writeHeader(); err != nil {
+		return err
+	}
+
+	query := bson.M{
+		"operating_company_id": export.OperatingCompanyId,
+		"created_at": bson.M{
+			"$gte": export.From,
+			"$lt":  export.To.Add(time.Second),
+		},
+	}
+	opts := options.Find().SetSort(bson.D{{"source.type", 1}, {"source.id", 1}, {"created_at", 1}, {"_id", 1}})
+	cursor, err := s.db.Collection(collectionAccountingEntry).Find(ctx, query, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionAccountingEntry),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return err
+	}
+
+	defer cursor.Close(ctx)
+
+	var document *accountingExportDocument
+	totals := make(map[string]*internalPkg.AccountingExportTotal)
+
+	for cursor.Next(ctx) {
+		entry := &billingpb.AccountingEntry{}
+
+		if err = cursor.Decode(entry); err != nil {
+			zap.L().Error(
+				pkg.ErrorQueryCursorExecutionFailed,
+				zap.Error(err),
+				zap.String(pkg.ErrorDatabaseFieldCollection, collectionAccountingEntry),
+				zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+			)
+			return err
+		}
+
+		if document == nil || !document.contains(entry) {
+			if document != nil {
+				if err = writer.writeDocument(document); err != nil {
+					return err
+				}
+			}
+
+			document = newAccountingExportDocument(entry)
+			export.Documents++
+		}
+
+		document.entries = append(document.entries, entry)
+		export.Entries++
+
+		total, ok := totals[entry.Currency]
+
+		if !ok {
+			total = &internalPkg.AccountingExportTotal{Currency: entry.Currency}
+			totals[entry.Currency] = total
+		}
+
+		total.Entries++
+		total.Amount = tools.ToPrecise(total.Amount + entry.Amount)
+	}
+
+	if err = cursor.Err(); err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionAccountingEntry),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return err
+	}
+
+	if document != nil {
+		if err = writer.writeDocument(document); err != nil {
+			return err
+		}
+	}
+
+	if err = writer.close(); err != nil {
+		return err
+	}
+
+	if err = file.flush(); err != nil {
+		return err
+	}
+
+	for _, total := range totals {
+		export.Totals = append(export.Totals, total)
+	}
+
+	sort.Slice(export.Totals, func(i, j int) bool {
+		return export.Totals[i].Currency < export.Totals[j].Currency
+	})
+
+	export.Checksum = hex.EncodeToString(file.hash.Sum(nil))
+
+	return nil
+}
+
+// requestAccountingExportReport requests report file of the completed export from reporter, the file is stored
+// in report files of the creator of export who is notified when it's ready.
+func (s *Service) requestAccountingExportReport(ctx context.Context, export *internalPkg.AccountingExport) {
+	params, _ := json.Marshal(map[string]interface{}{reporterpb.ParamsFieldId: export.Id})
+	req := &reporterpb.ReportFile{
+		UserId:           export.CreatorId,
+		ReportType:       reportTypeAccountingExport,
+		FileType:         export.Format,
+		Params:           params,
+		SendNotification: true,
+	}
+
+	if _, err := s.reporterService.CreateFile(ctx, req); err != nil {
+		zap.L().Error(
+			pkg.ErrorGrpcServiceCallFailed,
+			zap.Error(err),
+			zap.String(errorFieldService, reporterpb.ServiceName),
+			zap.String(errorFieldMethod, "CreateFile"),
+			zap.Any(errorFieldRequest, req),
+		)
+	}
+}
+
+// accountingExportFile writes content of export file to database by chunks and calculates its checksum.
+type accountingExportFile struct {
+	ctx        context.Context
+	repository repository.AccountingExportRepositoryInterface
+	export     *internalPkg.AccountingExport
+	hash       hash.Hash
+	buffer     bytes.Buffer
+}
+
+func newAccountingExportFile(
+	ctx context.Context,
+	repo repository.AccountingExportRepositoryInterface,
+	export *internalPkg.AccountingExport,
+) *accountingExportFile {
+	return &accountingExportFile{
+		ctx:        ctx,
+		repository: repo,
+		export:     export,
+		hash:       sha256.New(),
+	}
+}
+
+func (f *accountingExportFile) Write(p []byte) (int, error) {
+	f.hash.Write(p)
+	f.buffer.Write(p)
+	f.export.Size += int64(len(p))
+
+	if f.buffer.Len() >= accountingExportChunkSize {
+		if err := f.flush(); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+func (f *accountingExportFile) flush() error {
+	if f.buffer.Len() <= 0 {
+		return nil
+	}
+
+	chunk := &internalPkg.AccountingExportChunk{
+		Id:       primitive.NewObjectID().Hex(),
+		ExportId: f.export.Id,
+		Number:   f.export.Chunks + 1,
+		Data:     append([]byte(nil), f.buffer.Bytes()...),
+	}
+
+	if err := f.repository.InsertChunk(f.ctx, chunk); err != nil {
+		return err
+	}
+
+	f.export.Chunks++
+	f.buffer.Reset()
+
+	return nil
+}
+
+// accountingExportDocument is a group of accounting entries of the same source document.
+type accountingExportDocument struct {
+	sourceType string
+	sourceId   string
+	entries    []*billingpb.AccountingEntry
+}
+
+func newAccountingExportDocument(entry *billingpb.AccountingEntry) *accountingExportDocument {
+	return &accountingExportDocument{
+		sourceType: entry.GetSource().GetType(),
+		sourceId:   entry.GetSource().GetId(),
+	}
+}
+
+func (d *accountingExportDocument) contains(entry *billingpb.AccountingEntry) bool {
+	return d.sourceType == entry.GetSource().GetType() && d.sourceId == entry.GetSource().GetId()
+}
+
+// date returns date of the earliest entry of the document.
+func (d *accountingExportDocument) date() time.Time {
+	return getAccountingExportEntryDate(d.entries[0])
+}
+
+// accountingExportLine is an accounting entry with debit and credit accounts of the ledger,
+// it's a row of CSV file and an entry of document in JSON lines file.
+type accountingExportLine struct {
+	Id               string  `json:"id"`
+	Type             string  `json:"type"`
+	Date             string  `json:"date"`
+	MerchantId       string  `json:"merchant_id"`
+	Country          string  `json:"country"`
+	DebitAccount     string  `json:"debit_account"`
+	CreditAccount    string  `json:"credit_account"`
+	Amount           float64 `json:"amount"`
+	Currency         string  `json:"currency"`
+	OriginalAmount   float64 `json:"original_amount"`
+	OriginalCurrency string  `json:"original_currency"`
+	LocalAmount      float64 `json:"local_amount"`
+	LocalCurrency    string  `json:"local_currency"`
+	Status           string  `json:"status"`
+}
+
+func getAccountingExportLine(entry *billingpb.AccountingEntry) (*accountingExportLine, error) {
+	debit, credit, amount, err := getLedgerBooking(entry)
+
+	if err != nil {
+		return nil, err
+	}
+
+	line := &accountingExportLine{
+		Id:               entry.Id,
+		Type:             entry.Type,
+		Date:             getAccountingExportEntryDate(entry).Format(time.RFC3339),
+		MerchantId:       entry.MerchantId,
+		Country:          entry.Country,
+		DebitAccount:     debit,
+		CreditAccount:    credit,
+		Amount:           amount,
+		Currency:         entry.Currency,
+		OriginalAmount:   tools.ToPrecise(entry.OriginalAmount),
+		OriginalCurrency: entry.OriginalCurrency,
+		LocalAmount:      tools.ToPrecise(entry.LocalAmount),
+		LocalCurrency:    entry.LocalCurrency,
+		Status:           entry.Status,
+	}
+
+	return line, nil
+}
+
+func getAccountingExportEntryDate(entry *billingpb.AccountingEntry) time.Time {
+	date, err := ptypes.Timestamp(entry.CreatedAt)
+
+	if err != nil {
+		return time.Time{}
+	}
+
+	return date.UTC()
+}
+
+func formatAccountingExportAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', -1, 64)
+}
+
+type accountingExportWriter interface {
+	writeHeader() error
+	writeDocument(*accountingExportDocument) error
+	close() error
+}
+
+func newAccountingExportWriter(
+	export *internalPkg.AccountingExport,
+	oc *billingpb.OperatingCompany,
+	w io.Writer,
+) accountingExportWriter {
+	switch export.Format {
+	case internalPkg.AccountingExportFormatXml:
+		return &accountingExportXmlWriter{export: export, oc: oc, encoder: xml.NewEncoder(w)}
+	case internalPkg.AccountingExportFormatJsonl:
+		return &accountingExportJsonlWriter{encoder: json.NewEncoder(w)}
+	default:
+		return &accountingExportCsvWriter{writer: csv.NewWriter(w)}
+	}
+}
+
+type accountingExportCsvWriter struct {
+	writer *csv.Writer
+}
+
+func (w *accountingExportCsvWriter) writeHeader() error {
+	return w.writer.Write(accountingExportCsvColumns)
+}
+
+func (w *accountingExportCsvWriter) writeDocument(document *accountingExportDocument) error {
+	date := document.date().Format(time.RFC3339)
+
+	for _, entry := range document.entries {
+		line, err := getAccountingExportLine(entry)
+
+		if err != nil {
+			return err
+		}
+
+		record := []string{
+			document.sourceType,
+			document.sourceId,
+			date,
+			line.Id,
+			line.Type,
+			line.Date,
+			line.MerchantId,
+			line.Country,
+			line.DebitAccount,
+			line.CreditAccount,
+			formatAccountingExportAmount(line.Amount),
+			line.Currency,
+			formatAccountingExportAmount(line.OriginalAmount),
+			line.OriginalCurrency,
+			formatAccountingExportAmount(line.LocalAmount),
+			line.LocalCurrency,
+			line.Status,
+		}
+
+		if err = w.writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *accountingExportCsvWriter) close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+type accountingExportJsonlDocument struct {
+	SchemaVersion string                  `json:"schema_version"`
+	DocumentType  string                  `json:"document_type"`
+	DocumentId    string                  `json:"document_id"`
+	DocumentDate  string                  `json:"document_date"`
+	Entries       []*accountingExportLine `json:"entries"`
+}
+
+// accountingExportJsonlWriter writes every source document as a JSON object on a separate line.
+type accountingExportJsonlWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *accountingExportJsonlWriter) writeHeader() error {
+	return nil
+}
+
+func (w *accountingExportJsonlWriter) writeDocument(document *accountingExportDocument) error {
+	item := &accountingExportJsonlDocument{
+		SchemaVersion: internalPkg.AccountingExportSchemaVersion,
+		DocumentType:  document.sourceType,
+		DocumentId:    document.sourceId,
+		DocumentDate:  document.date().Format(time.RFC3339),
+	}
+
+	for _, entry := range document.entries {
+		line, err := getAccountingExportLine(entry)
+
+		if err != nil {
+			return err
+		}
+
+		item.Entries = append(item.Entries, line)
+	}
+
+	return w.encoder.Encode(item)
+}
+
+func (w *accountingExportJsonlWriter) close() error {
+	return nil
+}
+
+type accountingExportXmlHeader struct {
+	XMLName              xml.Name                              `xml:"Header"`
+	AuditFileVersion     string                                `xml:"AuditFileVersion"`
+	AuditFileDateCreated string                                `xml:"AuditFileDateCreated"`
+	SoftwareCompanyName  string                                `xml:"SoftwareCompanyName"`
+	SoftwareID           string                                `xml:"SoftwareID"`
+	SoftwareVersion      string                                `xml:"SoftwareVersion"`
+	Company              *accountingExportXmlCompany           `xml:"Company"`
+	SelectionCriteria    *accountingExportXmlSelectionCriteria `xml:"SelectionCriteria"`
+	HeaderComment        string                                `xml:"HeaderComment"`
+}
+
+type accountingExportXmlCompany struct {
+	RegistrationNumber string `xml:"RegistrationNumber"`
+	Name               string `xml:"Name"`
+}
+
+type accountingExportXmlSelectionCriteria struct {
+	SelectionStartDate string `xml:"SelectionStartDate"`
+	SelectionEndDate   string `xml:"SelectionEndDate"`
+}
+
+type accountingExportXmlTransaction struct {
+	XMLName          xml.Name                   `xml:"Transaction"`
+	TransactionID    string                     `xml:"TransactionID"`
+	TransactionDate  string                     `xml:"TransactionDate"`
+	SourceDocumentID string                     `xml:"SourceDocumentID"`
+	Description      string                     `xml:"Description"`
+	Lines            []*accountingExportXmlLine `xml:"Line"`
+}
+
+type accountingExportXmlLine struct {
+	RecordID         string                     `xml:"RecordID"`
+	AccountID        string                     `xml:"AccountID"`
+	SourceDocumentID string                     `xml:"SourceDocumentID"`
+	SystemEntryDate  string                     `xml:"SystemEntryDate"`
+	Description      string                     `xml:"Description"`
+	DebitAmount      *accountingExportXmlAmount `xml:"DebitAmount,omitempty"`
+	CreditAmount     *accountingExportXmlAmount `xml:"CreditAmount,omitempty"`
+}
+
+type accountingExportXmlAmount struct {
+	Amount       string `xml:"Amount"`
+	CurrencyCode string `xml:"CurrencyCode"`
+}
+
+// accountingExportXmlWriter writes SAF-T style general ledger file, every source document is a transaction
+// of the single journal with debit and credit lines of every accounting entry.
+type accountingExportXmlWriter struct {
+	export  *internalPkg.AccountingExport
+	oc      *billingpb.OperatingCompany
+	encoder *xml.Encoder
+}
+
+func (w *accountingExportXmlWriter) writeHeader() error {
+	w.encoder.Indent("", "  ")
+
+	tokens := []xml.Token{
+		xml.ProcInst{Target: "xml", Inst: []byte(`version="1.0" encoding="UTF-8"`)},
+		xml.CharData("\n"),
+		xml.StartElement{
+			Name: xml.Name{Local: "AuditFile"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: accountingExportXmlNamespace}},
+		},
+	}
+
+	for _, token := range tokens {
+		if err := w.encoder.EncodeToken(token); err != nil {
+			return err
+		}
+	}
+
+	header := &accountingExportXmlHeader{
+		AuditFileVersion:     accountingExportXmlVersion,
+		AuditFileDateCreated: w.export.CreatedAt.UTC().Format(accountingExportXmlDateFormat),
+		SoftwareCompanyName:  accountingExportXmlSoftwareName,
+		SoftwareID:           accountingExportXmlSoftwareId,
+		SoftwareVersion:      w.export.SchemaVersion,
+		Company: &accountingExportXmlCompany{
+			RegistrationNumber: w.oc.RegistrationNumber,
+			Name:               w.oc.Name,
+		},
+		SelectionCriteria: &accountingExportXmlSelectionCriteria{
+			SelectionStartDate: w.export.From.UTC().Format(accountingExportXmlDateFormat),
+			SelectionEndDate:   w.export.To.UTC().Format(accountingExportXmlDateFormat),
+		},
+		HeaderComment: fmt.Sprintf("Accounting entries of operating company %s", w.oc.Id),
+	}
+
+	if err := w.encoder.Encode(header); err != nil {
+		return err
+	}
+
+	for _, name := range []string{"GeneralLedgerEntries", "Journal"} {
+		if err := w.encoder.EncodeToken(xml.StartElement{Name: xml.Name{Local: name}}); err != nil {
+			return err
+		}
+	}
+
+	journal := []struct {
+		name  string
+		value string
+	}{
+		{"JournalID", accountingExportXmlJournalId},
+		{"Description", "Accounting entries"},
+		{"Type", accountingExportXmlJournalType},
+	}
+
+	for _, item := range journal {
+		if err := w.encoder.EncodeElement(item.value, xml.StartElement{Name: xml.Name{Local: item.name}}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *accountingExportXmlWriter) writeDocument(document *accountingExportDocument) error {
+	sourceDocumentId := document.sourceType + "/" + document.sourceId
+	transaction := &accountingExportXmlTransaction{
+		TransactionID:    sourceDocumentId,
+		TransactionDate:  document.date().Format(accountingExportXmlDateFormat),
+		SourceDocumentID: sourceDocumentId,
+		Description:      document.sourceType,
+	}
+
+	for _, entry := range document.entries {
+		line, err := getAccountingExportLine(entry)
+
+		if err != nil {
+			return err
+		}
+
+		amount := &accountingExportXmlAmount{
+			Amount:       formatAccountingExportAmount(line.Amount),
+			CurrencyCode: line.Currency,
+		}
+		debit := &accountingExportXmlLine{
+			RecordID:         line.Id + "-D",
+			AccountID:        line.DebitAccount,
+			SourceDocumentID: sourceDocumentId,
+			SystemEntryDate:  line.Date,
+			Description:      line.Type,
+			DebitAmount:      amount,
+		}
+		credit := &accountingExportXmlLine{
+			RecordID:         line.Id + "-C",
+			AccountID:        line.CreditAccount,
+			SourceDocumentID: sourceDocumentId,
+			SystemEntryDate:  line.Date,
+			Description:      line.Type,
+			CreditAmount:     amount,
+		}
+
+		transaction.Lines = append(transaction.Lines, debit, credit)
+	}
+
+	return w.encoder.Encode(transaction)
+}
+
+func (w *accountingExportXmlWriter) close() error {
+	for _, name := range []string{"Journal", "GeneralLedgerEntries", "AuditFile"} {
+		if err := w.encoder.EncodeToken(xml.EndElement{Name: xml.Name{Local: name}}); err != nil {
+			return err
+		}
+	}
+
+	return w.encoder.Flush()
+}
@@ -0,0 +1,322 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"github.com/go-redis/redis"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/mongodb"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	"github.com/paysuper/paysuper-billing-server/internal/database"
+	"github.com/paysuper/paysuper-billing-server/internal/mocks"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	casbinMocks "github.com/paysuper/paysuper-proto/go/casbinpb/mocks"
+	"github.com/paysuper/paysuper-proto/go/reporterpb"
+	reportingMocks "github.com/paysuper/paysuper-proto/go/reporterpb/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	rabbitmq "gopkg.in/ProtocolONE/rabbitmq.v1/pkg"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"strings"
+	"testing"
+	"time"
+)
+
+type AccountingExportTestSuite struct {
+	suite.Suite
+	service *Service
+	log     *zap.Logger
+	cache   database.CacheInterface
+
+	merchant      *billingpb.Merchant
+	project       *billingpb.Project
+	paymentMethod *billingpb.PaymentMethod
+	paymentSystem *billingpb.PaymentSystem
+	reporter      *reportingMocks.ReporterService
+}
+
+func Test_AccountingExport(t *testing.T) {
+	suite.Run(t, new(AccountingExportTestSuite))
+}
+
+func (suite *AccountingExportTestSuite) SetupTest() {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		suite.FailNow("Config load failed", "%v", err)
+	}
+	cfg.CardPayApiUrl = "https://sandbox.cardpay.com"
+
+	m, err := migrate.New(
+		"file://../../migrations/tests",
+		cfg.MongoDsn)
+	assert.NoError(suite.T(), err, "Migrate init failed")
+
+	err = m.Up()
+	if err != nil && err.Error() != "no change" {
+		suite.FailNow("Migrations failed", "%v", err)
+	}
+
+	ctx, _ := context.WithTimeout(context.Background(), 50*time.Second)
+	opts := []mongodb.Option{mongodb.Context(ctx)}
+	db, err := mongodb.NewDatabase(opts...)
+	if err != nil {
+		suite.FailNow("Database connection failed", "%v", err)
+	}
+
+	suite.log, err = zap.NewProduction()
+
+	if err != nil {
+		suite.FailNow("Logger initialization failed", "%v", err)
+	}
+
+	broker, err := rabbitmq.NewBroker(cfg.BrokerAddress)
+
+	if err != nil {
+		suite.FailNow("Creating RabbitMQ publisher failed", "%v", err)
+	}
+
+	redisClient := database.NewRedis(
+		&redis.Options{
+			Addr:     cfg.RedisHost,
+			Password: cfg.RedisPassword,
+		},
+	)
+
+	redisdb := mocks.NewTestRedis()
+	suite.cache, err = database.NewCacheRedis(redisdb, "cache")
+	suite.service = NewBillingService(
+		db,
+		cfg,
+		mocks.NewGeoIpServiceTestOk(),
+		mocks.NewRepositoryServiceOk(),
+		mocks.NewTaxServiceOkMock(),
+		broker,
+		redisClient,
+		suite.cache,
+		mocks.NewCurrencyServiceMockOk(),
+		mocks.NewDocumentSignerMockOk(),
+		&reportingMocks.ReporterService{},
+		mocks.NewFormatterOK(),
+		mocks.NewBrokerMockOk(),
+		&casbinMocks.CasbinService{},
+	)
+
+	if err := suite.service.Init(); err != nil {
+		suite.FailNow("Billing service initialization failed", "%v", err)
+	}
+
+	suite.merchant, suite.project, suite.paymentMethod, suite.paymentSystem = helperCreateEntitiesForTests(suite.Suite, suite.service)
+
+	centrifugoMock := &mocks.CentrifugoInterface{}
+	centrifugoMock.On("GetChannelToken", mock.Anything, mock.Anything).Return("token")
+	centrifugoMock.On("Publish", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	suite.service.centrifugoDashboard = centrifugoMock
+	suite.service.centrifugoPaymentForm = centrifugoMock
+
+	reporterMock := &reportingMocks.ReporterService{}
+	reporterMock.On("CreateFile", mock.Anything, mock.Anything, mock.Anything).
+		Return(&reporterpb.CreateFileResponse{Status: billingpb.ResponseStatusOk}, nil)
+	suite.service.reporterService = reporterMock
+	suite.reporter = reporterMock
+}
+
+func (suite *AccountingExportTestSuite) TearDownTest() {
+	err := suite.service.db.Drop()
+
+	if err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	err = suite.service.db.Close()
+
+	if err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *AccountingExportTestSuite) TestAccountingExport_CreateAccountingExport_Ok() {
+	req := suite.getCreateRequest(internalPkg.AccountingExportFormatCsv)
+	rsp := &internalPkg.AccountingExportResponse{}
+	err := suite.service.CreateAccountingExport(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), internalPkg.AccountingExportStatusPending, rsp.Item.Status)
+	assert.Equal(suite.T(), internalPkg.AccountingExportSchemaVersion, rsp.Item.SchemaVersion)
+
+	rsp2 := &internalPkg.AccountingExportResponse{}
+	err = suite.service.GetAccountingExport(context.TODO(), &internalPkg.GetAccountingExportRequest{Id: rsp.Item.Id}, rsp2)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp2.Status)
+	assert.Equal(suite.T(), rsp.Item.OperatingCompanyId, rsp2.Item.OperatingCompanyId)
+	assert.Equal(suite.T(), rsp.Item.Format, rsp2.Item.Format)
+}
+
+func (suite *AccountingExportTestSuite) TestAccountingExport_CreateAccountingExport_FormatInvalid_Error() {
+	req := suite.getCreateRequest("pdf")
+	rsp := &internalPkg.AccountingExportResponse{}
+	err := suite.service.CreateAccountingExport(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), accountingExportErrorFormatInvalid, rsp.Message)
+}
+
+func (suite *AccountingExportTestSuite) TestAccountingExport_CreateAccountingExport_PeriodInvalid_Error() {
+	req := suite.getCreateRequest(internalPkg.AccountingExportFormatCsv)
+	req.From, req.To = req.To, req.From
+	rsp := &internalPkg.AccountingExportResponse{}
+	err := suite.service.CreateAccountingExport(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), accountingExportErrorPeriodInvalid, rsp.Message)
+}
+
+func (suite *AccountingExportTestSuite) TestAccountingExport_CreateAccountingExport_OperatingCompanyNotFound_Error() {
+	req := suite.getCreateRequest(internalPkg.AccountingExportFormatCsv)
+	req.OperatingCompanyId = "ffffffffffffffffffffffff"
+	rsp := &internalPkg.AccountingExportResponse{}
+	err := suite.service.CreateAccountingExport(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), errorOperatingCompanyNotFound, rsp.Message)
+}
+
+func (suite *AccountingExportTestSuite) TestAccountingExport_GetAccountingExport_NotFound() {
+	rsp := &internalPkg.AccountingExportResponse{}
+	err := suite.service.GetAccountingExport(context.TODO(), &internalPkg.GetAccountingExportRequest{Id: "ffffffffffffffffffffffff"}, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), accountingExportErrorNotFound, rsp.Message)
+}
+
+func (suite *AccountingExportTestSuite) TestAccountingExport_ProcessAccountingExports_Csv_Ok() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	export, file := suite.createAndProcessExport(internalPkg.AccountingExportFormatCsv)
+
+	records, err := csv.NewReader(bytes.NewReader(file)).ReadAll()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), accountingExportCsvColumns, records[0])
+	assert.Len(suite.T(), records, int(export.Entries)+1)
+
+	for _, record := range records[1:] {
+		assert.Len(suite.T(), record, len(accountingExportCsvColumns))
+		assert.Equal(suite.T(), order.Id, record[1])
+		assert.NotEqual(suite.T(), record[8], record[9])
+	}
+}
+
+func (suite *AccountingExportTestSuite) TestAccountingExport_ProcessAccountingExports_Xml_Ok() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	export, file := suite.createAndProcessExport(internalPkg.AccountingExportFormatXml)
+
+	auditFile := &struct {
+		XMLName      xml.Name                          `xml:"AuditFile"`
+		Header       *accountingExportXmlHeader        `xml:"Header"`
+		Transactions []*accountingExportXmlTransaction `xml:"GeneralLedgerEntries>Journal>Transaction"`
+	}{}
+	err := xml.Unmarshal(file, auditFile)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), accountingExportXmlVersion, auditFile.Header.AuditFileVersion)
+	assert.Len(suite.T(), auditFile.Transactions, int(export.Documents))
+	assert.Equal(suite.T(), "order/"+order.Id, auditFile.Transactions[0].SourceDocumentID)
+	assert.Len(suite.T(), auditFile.Transactions[0].Lines, int(export.Entries)*2)
+}
+
+func (suite *AccountingExportTestSuite) TestAccountingExport_ProcessAccountingExports_Jsonl_Ok() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	export, file := suite.createAndProcessExport(internalPkg.AccountingExportFormatJsonl)
+
+	lines := strings.Split(strings.TrimSpace(string(file)), "\n")
+	assert.Len(suite.T(), lines, int(export.Documents))
+
+	document := &accountingExportJsonlDocument{}
+	err := json.Unmarshal([]byte(lines[0]), document)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.AccountingExportSchemaVersion, document.SchemaVersion)
+	assert.Equal(suite.T(), order.Id, document.DocumentId)
+	assert.Len(suite.T(), document.Entries, int(export.Entries))
+}
+
+func (suite *AccountingExportTestSuite) TestAccountingExport_ProcessAccountingExports_Empty_Ok() {
+	export, file := suite.createAndProcessExport(internalPkg.AccountingExportFormatCsv)
+	assert.Zero(suite.T(), export.Documents)
+	assert.Zero(suite.T(), export.Entries)
+	assert.Empty(suite.T(), export.Totals)
+
+	records, err := csv.NewReader(bytes.NewReader(file)).ReadAll()
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), records, 1)
+}
+
+func (suite *AccountingExportTestSuite) TestAccountingExport_GetAccountingExportFile_NotCompleted_Error() {
+	rsp := &internalPkg.AccountingExportResponse{}
+	err := suite.service.CreateAccountingExport(context.TODO(), suite.getCreateRequest(internalPkg.AccountingExportFormatCsv), rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	fileRsp := &internalPkg.AccountingExportFileResponse{}
+	err = suite.service.GetAccountingExportFile(context.TODO(), &internalPkg.GetAccountingExportRequest{Id: rsp.Item.Id}, fileRsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, fileRsp.Status)
+	assert.Equal(suite.T(), accountingExportErrorNotFound, fileRsp.Message)
+	assert.Empty(suite.T(), fileRsp.File)
+}
+
+func (suite *AccountingExportTestSuite) getCreateRequest(format string) *internalPkg.CreateAccountingExportRequest {
+	return &internalPkg.CreateAccountingExportRequest{
+		OperatingCompanyId: suite.merchant.OperatingCompanyId,
+		CreatorId:          suite.merchant.GetUser().GetId(),
+		Format:             format,
+		From:               time.Now().Add(-time.Hour).Unix(),
+		To:                 time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+// createAndProcessExport creates export in the format, builds it by daemon and returns completed export
+// with content of its file.
+func (suite *AccountingExportTestSuite) createAndProcessExport(format string) (*internalPkg.AccountingExport, []byte) {
+	rsp := &internalPkg.AccountingExportResponse{}
+	err := suite.service.CreateAccountingExport(context.TODO(), suite.getCreateRequest(format), rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	count, err := suite.service.ProcessAccountingExports(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, count)
+	suite.reporter.AssertNumberOfCalls(suite.T(), "CreateFile", 1)
+
+	export, err := suite.service.accountingExportRepository.GetById(context.TODO(), rsp.Item.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.AccountingExportStatusCompleted, export.Status)
+	assert.NotNil(suite.T(), export.FinishedAt)
+
+	count, err = suite.service.ProcessAccountingExports(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Zero(suite.T(), count)
+
+	chunks, err := suite.service.accountingExportRepository.GetChunks(context.TODO(), export.Id)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), chunks, int(export.Chunks))
+
+	fileRsp := &internalPkg.AccountingExportFileResponse{}
+	err = suite.service.GetAccountingExportFile(context.TODO(), &internalPkg.GetAccountingExportRequest{Id: export.Id}, fileRsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, fileRsp.Status)
+	assert.Equal(suite.T(), export.Format, fileRsp.Format)
+	assert.Equal(suite.T(), export.Checksum, fileRsp.Checksum)
+
+	file := fileRsp.File
+	checksum := sha256.Sum256(file)
+	assert.Equal(suite.T(), hex.EncodeToString(checksum[:]), export.Checksum)
+	assert.Equal(suite.T(), int64(len(file)), export.Size)
+
+	return export, file
+}
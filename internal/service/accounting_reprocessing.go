@@ -0,0 +1,416 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang/protobuf/ptypes"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/internal/repository"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	tools "github.com/paysuper/paysuper-tools/number"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	accountingReprocessingReasonMask = "Accounting reprocessing at %s"
+)
+
+var (
+	accountingReprocessingErrorFilterEmpty   = newBillingServerErrorMsg("ar000001", "orders for accounting reprocessing must be filtered by merchant, identifiers or period")
+	accountingReprocessingErrorPeriodInvalid = newBillingServerErrorMsg("ar000002", "period of accounting reprocessing is invalid")
+
+	// Types of entries created by payment and refund events, saved entries of other types of the same source
+	// (rolling reserves, corrections of disputes) aren't compared with recomputed entries.
+	accountingPaymentEntryTypes = []string{
+		pkg.AccountingEntryTypeRealGrossRevenue,
+		pkg.AccountingEntryTypeRealTaxFee,
+		pkg.AccountingEntryTypeCentralBankTaxFee,
+		pkg.AccountingEntryTypeRealTaxFeeTotal,
+		pkg.AccountingEntryTypePsGrossRevenueFx,
+		pkg.AccountingEntryTypePsGrossRevenueFxTaxFee,
+		pkg.AccountingEntryTypePsGrossRevenueFxProfit,
+		pkg.AccountingEntryTypeMerchantGrossRevenue,
+		pkg.AccountingEntryTypeMerchantTaxFeeCostValue,
+		pkg.AccountingEntryTypeMerchantTaxFeeCentralBankFx,
+		pkg.AccountingEntryTypeMerchantTaxFee,
+		pkg.AccountingEntryTypePsMethodFee,
+		pkg.AccountingEntryTypeMerchantMethodFee,
+		pkg.AccountingEntryTypeMerchantMethodFeeCostValue,
+		pkg.AccountingEntryTypePsMarkupMerchantMethodFee,
+		pkg.AccountingEntryTypeMerchantMethodFixedFee,
+		pkg.AccountingEntryTypeRealMerchantMethodFixedFee,
+		pkg.AccountingEntryTypeMarkupMerchantMethodFixedFeeFx,
+		pkg.AccountingEntryTypeRealMerchantMethodFixedFeeCostValue,
+		pkg.AccountingEntryTypePsMethodFixedFeeProfit,
+		pkg.AccountingEntryTypeMerchantPsFixedFee,
+		pkg.AccountingEntryTypeRealMerchantPsFixedFee,
+		pkg.AccountingEntryTypeMarkupMerchantPsFixedFee,
+		pkg.AccountingEntryTypePsMethodProfit,
+		pkg.AccountingEntryTypeMerchantNetRevenue,
+		pkg.AccountingEntryTypePsProfitTotal,
+	}
+
+	accountingRefundEntryTypes = []string{
+		pkg.AccountingEntryTypeRealRefund,
+		pkg.AccountingEntryTypeRealRefundTaxFee,
+		pkg.AccountingEntryTypeRealRefundFee,
+		pkg.AccountingEntryTypeRealRefundFixedFee,
+		pkg.AccountingEntryTypeMerchantRefund,
+		pkg.AccountingEntryTypePsMerchantRefundFx,
+		pkg.AccountingEntryTypeMerchantRefundFee,
+		pkg.AccountingEntryTypePsMarkupMerchantRefundFee,
+		pkg.AccountingEntryTypeMerchantRefundFixedFeeCostValue,
+		pkg.AccountingEntryTypeMerchantRefundFixedFee,
+		pkg.AccountingEntryTypePsMerchantRefundFixedFeeFx,
+		pkg.AccountingEntryTypePsMerchantRefundFixedFeeProfit,
+		pkg.AccountingEntryTypeReverseTaxFee,
+		pkg.AccountingEntryTypeReverseTaxFeeDelta,
+		pkg.AccountingEntryTypePsReverseTaxFeeDelta,
+		pkg.AccountingEntryTypeMerchantReverseTaxFee,
+		pkg.AccountingEntryTypeMerchantReverseRevenue,
+		pkg.AccountingEntryTypePsRefundProfit,
+	}
+)
+
+// ReprocessAccounting recomputes accounting entries of the selected orders and their refunds by the current
+// rules and returns differences with saved entries. Saved entries are never changed, differences are booked
+// by correction entries if they must be applied, then order view and balances of merchants are refreshed.
+func (s *Service) ReprocessAccounting(
+	ctx context.Context,
+	req *internalPkg.ReprocessAccountingRequest,
+	rsp *internalPkg.ReprocessAccountingResponse,
+) error {
+	if req.MerchantId == "" && len(req.OrderIds) <= 0 && req.From <= 0 && req.To <= 0 {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = accountingReprocessingErrorFilterEmpty
+		return nil
+	}
+
+	if req.From < 0 || req.To < 0 || (req.To > 0 && req.To < req.From) {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = accountingReprocessingErrorPeriodInvalid
+		return nil
+	}
+
+	if req.MerchantId != "" {
+		if _, err := s.merchantRepository.GetById(ctx, req.MerchantId); err != nil {
+			rsp.Status = billingpb.ResponseStatusNotFound
+			rsp.Message = merchantErrorNotFound
+			return nil
+		}
+	}
+
+	if req.Limit <= 0 {
+		req.Limit = pkg.DatabaseRequestDefaultLimit
+	}
+
+	if req.Offset <= 0 {
+		req.Offset = 0
+	}
+
+	filter := &internalPkg.PaidOrderFilter{
+		MerchantId: req.MerchantId,
+		Ids:        req.OrderIds,
+		Limit:      req.Limit,
+		Offset:     req.Offset,
+	}
+
+	if req.From > 0 {
+		filter.PmOrderCloseDateFrom = time.Unix(req.From, 0)
+	}
+
+	if req.To > 0 {
+		filter.PmOrderCloseDateTo = time.Unix(req.To, 0)
+	}
+
+	orders, err := s.orderRepository.FindPaid(ctx, filter)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	for _, order := range orders {
+		rsp.Items = append(rsp.Items, s.reprocessPaymentAccounting(ctx, order, req.Apply))
+
+		if !req.Refunds {
+			continue
+		}
+
+		refunds, err := s.refundRepository.FindByOrderUuid(ctx, order.Uuid, 0, 0)
+
+		if err != nil {
+			rsp.Status = billingpb.ResponseStatusSystemError
+			rsp.Message = orderErrorUnknown
+			return nil
+		}
+
+		for _, refund := range refunds {
+			if refund.Status != pkg.RefundStatusCompleted {
+				continue
+			}
+
+			rsp.Items = append(rsp.Items, s.reprocessRefundAccounting(ctx, refund, order, req.Apply))
+		}
+	}
+
+	for _, item := range rsp.Items {
+		if len(item.Diffs) > 0 {
+			rsp.Changed++
+		}
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Count = int64(len(orders))
+
+	return nil
+}
+
+func (s *Service) reprocessPaymentAccounting(
+	ctx context.Context,
+	order *billingpb.Order,
+	apply bool,
+) *internalPkg.AccountingReprocessingItem {
+	item := &internalPkg.AccountingReprocessingItem{
+		SourceType: repository.CollectionOrder,
+		SourceId:   order.Id,
+		OrderId:    order.Id,
+		MerchantId: order.GetMerchantId(),
+	}
+	handler, err := s.getPaymentAccountingHandler(ctx, order)
+
+	if err == nil {
+		handler.reprocessing = true
+		err = handler.processPaymentEvent()
+	}
+
+	if err == nil {
+		err = s.reprocessAccountingEntries(handler, item, accountingPaymentEntryTypes, apply)
+	}
+
+	if err != nil {
+		setAccountingReprocessingError(item, err)
+	}
+
+	return item
+}
+
+func (s *Service) reprocessRefundAccounting(
+	ctx context.Context,
+	refund *billingpb.Refund,
+	order *billingpb.Order,
+	apply bool,
+) *internalPkg.AccountingReprocessingItem {
+	item := &internalPkg.AccountingReprocessingItem{
+		SourceType: repository.CollectionRefund,
+		SourceId:   refund.CreatedOrderId,
+		OrderId:    order.Id,
+		MerchantId: order.GetMerchantId(),
+	}
+	handler, err := s.getRefundAccountingHandler(ctx, refund, order)
+
+	if err == nil {
+		handler.reprocessing = true
+		err = handler.processRefundEvent()
+	}
+
+	if err == nil {
+		err = s.reprocessAccountingEntries(handler, item, accountingRefundEntryTypes, apply)
+	}
+
+	if err != nil {
+		setAccountingReprocessingError(item, err)
+	}
+
+	return item
+}
+
+// reprocessAccountingEntries compares entries recomputed by the handler with saved entries of the source
+// and books differences by correction entries if they must be applied. Differences are applied under
+// the accounting lock of the source, so entries created concurrently by callback aren't booked twice.
+func (s *Service) reprocessAccountingEntries(
+	h *accountingEntry,
+	item *internalPkg.AccountingReprocessingItem,
+	entryTypes []string,
+	apply bool,
+) error {
+	if apply {
+		unlock, err := s.lockAccountingSource(h.ctx, item.SourceType, item.SourceId)
+
+		if err != nil {
+			return err
+		}
+
+		defer unlock()
+	}
+
+	saved, err := s.getAccountingEntriesOfSource(h.ctx, item.SourceType, item.SourceId, entryTypes)
+
+	if err != nil {
+		return err
+	}
+
+	item.Diffs = getAccountingEntryDiffs(saved, h.accountingEntries)
+
+	if !apply || len(item.Diffs) <= 0 {
+		return nil
+	}
+
+	h.accountingEntries = nil
+	createdAt := ptypes.TimestampNow()
+	reason := fmt.Sprintf(accountingReprocessingReasonMask, time.Now().UTC().Format(time.RFC3339))
+
+	for _, diff := range item.Diffs {
+		entry := h.newEntry(diff.Type)
+		entry.Object = pkg.ObjectTypeBalanceTransactionCorrection
+		entry.CreatedAt = createdAt
+		entry.Reason = reason
+		entry.Amount = diff.Delta
+		entry.Currency = diff.Currency
+		entry.OriginalAmount = diff.OriginalAmountDelta
+		entry.OriginalCurrency = diff.OriginalCurrency
+		entry.LocalAmount = diff.LocalAmountDelta
+		entry.LocalCurrency = diff.LocalCurrency
+
+		if err = h.addEntry(entry); err != nil {
+			return err
+		}
+	}
+
+	h.clearingSettlements = getLedgerClearingSettlements(h.accountingEntries)
+
+	if err = h.saveAccountingEntries(); err != nil {
+		return err
+	}
+
+	for _, entry := range h.accountingEntries {
+		item.CorrectionIds = append(item.CorrectionIds, entry.(*billingpb.AccountingEntry).Id)
+	}
+
+	if _, err = s.updateMerchantBalance(h.ctx, item.MerchantId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// getAccountingEntriesOfSource returns saved entries of the types of the source including corrections.
+func (s *Service) getAccountingEntriesOfSource(
+	ctx context.Context,
+	sourceType, sourceId string,
+	entryTypes []string,
+) ([]*billingpb.AccountingEntry, error) {
+	var entries []*billingpb.AccountingEntry
+
+	oid, _ := primitive.ObjectIDFromHex(sourceId)
+	query := bson.M{
+		"source.id":   oid,
+		"source.type": sourceType,
+		"type":        bson.M{"$in": entryTypes},
+	}
+	opts := options.Find().SetSort(bson.D{{"created_at", 1}, {"_id", 1}})
+	cursor, err := s.db.Collection(collectionAccountingEntry).Find(ctx, query, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionAccountingEntry),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &entries)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionAccountingEntry),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// getAccountingEntryDiffs sums saved and recomputed entries by the type and the currency and returns
+// only sums which differ. Differences follow the order of recomputed entries, entries which aren't
+// recomputed anymore follow them.
+func getAccountingEntryDiffs(
+	saved []*billingpb.AccountingEntry,
+	recomputed []interface{},
+) []*internalPkg.AccountingEntryDiff {
+	var keys []string
+	diffs := make(map[string]*internalPkg.AccountingEntryDiff)
+
+	getDiff := func(entry *billingpb.AccountingEntry) *internalPkg.AccountingEntryDiff {
+		key := entry.Type + "/" + entry.Currency
+		diff, ok := diffs[key]
+
+		if !ok {
+			diff = &internalPkg.AccountingEntryDiff{
+				Type:             entry.Type,
+				Currency:         entry.Currency,
+				OriginalCurrency: entry.OriginalCurrency,
+				LocalCurrency:    entry.LocalCurrency,
+			}
+			diffs[key] = diff
+			keys = append(keys, key)
+		}
+
+		return diff
+	}
+
+	for _, item := range recomputed {
+		entry := item.(*billingpb.AccountingEntry)
+		diff := getDiff(entry)
+		diff.NewAmount += entry.Amount
+		diff.OriginalAmountDelta += entry.OriginalAmount
+		diff.LocalAmountDelta += entry.LocalAmount
+	}
+
+	for _, entry := range saved {
+		diff := getDiff(entry)
+		diff.Amount += entry.Amount
+		diff.OriginalAmountDelta -= entry.OriginalAmount
+		diff.LocalAmountDelta -= entry.LocalAmount
+	}
+
+	var result []*internalPkg.AccountingEntryDiff
+
+	for _, key := range keys {
+		diff := diffs[key]
+		diff.Amount = tools.ToPrecise(diff.Amount)
+		diff.NewAmount = tools.ToPrecise(diff.NewAmount)
+		diff.Delta = tools.ToPrecise(diff.NewAmount - diff.Amount)
+		diff.OriginalAmountDelta = tools.ToPrecise(diff.OriginalAmountDelta)
+		diff.LocalAmountDelta = tools.ToPrecise(diff.LocalAmountDelta)
+
+		if diff.Delta == 0 && diff.OriginalAmountDelta == 0 && diff.LocalAmountDelta == 0 {
+			continue
+		}
+
+		result = append(result, diff)
+	}
+
+	return result
+}
+
+func setAccountingReprocessingError(item *internalPkg.AccountingReprocessingItem, err error) {
+	item.Diffs = nil
+	item.ErrorMessage = err.Error()
+
+	if msg, ok := err.(*billingpb.ResponseErrorMessage); ok {
+		item.ErrorCode = msg.Code
+		item.ErrorMessage = msg.Message
+	}
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"github.com/go-redis/redis"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/mongodb"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	"github.com/paysuper/paysuper-billing-server/internal/database"
+	"github.com/paysuper/paysuper-billing-server/internal/mocks"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/internal/repository"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	casbinMocks "github.com/paysuper/paysuper-proto/go/casbinpb/mocks"
+	reportingMocks "github.com/paysuper/paysuper-proto/go/reporterpb/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	rabbitmq "gopkg.in/ProtocolONE/rabbitmq.v1/pkg"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type AccountingReprocessingTestSuite struct {
+	suite.Suite
+	service *Service
+	log     *zap.Logger
+	cache   database.CacheInterface
+
+	merchant      *billingpb.Merchant
+	project       *billingpb.Project
+	paymentMethod *billingpb.PaymentMethod
+	paymentSystem *billingpb.PaymentSystem
+}
+
+func Test_AccountingReprocessing(t *testing.T) {
+	suite.Run(t, new(AccountingReprocessingTestSuite))
+}
+
+func (suite *AccountingReprocessingTestSuite) SetupTest() {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		suite.FailNow("Config load failed", "%v", err)
+	}
+	cfg.CardPayApiUrl = "https://sandbox.cardpay.com"
+
+	m, err := migrate.New(
+		"file://../../migrations/tests",
+		cfg.MongoDsn)
+	assert.NoError(suite.T(), err, "Migrate init failed")
+
+	err = m.Up()
+	if err != nil && err.Error() != "no change" {
+		suite.FailNow("Migrations failed", "%v", err)
+	}
+
+	ctx, _ := context.WithTimeout(context.Background(), 50*time.Second)
+	opts := []mongodb.Option{mongodb.Context(ctx)}
+	db, err := mongodb.NewDatabase(opts...)
+	if err != nil {
+		suite.FailNow("Database connection failed", "%v", err)
+	}
+
+	suite.log, err = zap.NewProduction()
+
+	if err != nil {
+		suite.FailNow("Logger initialization failed", "%v", err)
+	}
+
+	broker, err := rabbitmq.NewBroker(cfg.BrokerAddress)
+
+	if err != nil {
+		suite.FailNow("Creating RabbitMQ publisher failed", "%v", err)
+	}
+
+	redisClient := database.NewRedis(
+		&redis.Options{
+			Addr:     cfg.RedisHost,
+			Password: cfg.RedisPassword,
+		},
+	)
+
+	redisdb := mocks.NewTestRedis()
+	suite.cache, err = database.NewCacheRedis(redisdb, "cache")
+	suite.service = NewBillingService(
+		db,
+		cfg,
+		mocks.NewGeoIpServiceTestOk(),
+		mocks.NewRepositoryServiceOk(),
+		mocks.NewTaxServiceOkMock(),
+		broker,
+		redisClient,
+		suite.cache,
+		mocks.NewCurrencyServiceMockOk(),
+		mocks.NewDocumentSignerMockOk(),
+		&reportingMocks.ReporterService{},
+		mocks.NewFormatterOK(),
+		mocks.NewBrokerMockOk(),
+		&casbinMocks.CasbinService{},
+	)
+
+	if err := suite.service.Init(); err != nil {
+		suite.FailNow("Billing service initialization failed", "%v", err)
+	}
+
+	suite.merchant, suite.project, suite.paymentMethod, suite.paymentSystem = helperCreateEntitiesForTests(suite.Suite, suite.service)
+
+	centrifugoMock := &mocks.CentrifugoInterface{}
+	centrifugoMock.On("GetChannelToken", mock.Anything, mock.Anything).Return("token")
+	centrifugoMock.On("Publish", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	suite.service.centrifugoDashboard = centrifugoMock
+	suite.service.centrifugoPaymentForm = centrifugoMock
+}
+
+func (suite *AccountingReprocessingTestSuite) TearDownTest() {
+	err := suite.service.db.Drop()
+
+	if err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	err = suite.service.db.Close()
+
+	if err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *AccountingReprocessingTestSuite) TestAccountingReprocessing_DryRun_NoDiffs_Ok() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	req := &internalPkg.ReprocessAccountingRequest{OrderIds: []string{order.Id}, Refunds: true}
+	rsp := &internalPkg.ReprocessAccountingResponse{}
+	err := suite.service.ReprocessAccounting(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.EqualValues(suite.T(), 1, rsp.Count)
+	assert.Zero(suite.T(), rsp.Changed)
+	assert.Len(suite.T(), rsp.Items, 1)
+	assert.Equal(suite.T(), order.Id, rsp.Items[0].SourceId)
+	assert.Empty(suite.T(), rsp.Items[0].Diffs)
+	assert.Empty(suite.T(), rsp.Items[0].ErrorMessage)
+}
+
+func (suite *AccountingReprocessingTestSuite) TestAccountingReprocessing_Apply_Ok() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	oid, err := primitive.ObjectIDFromHex(order.Id)
+	assert.NoError(suite.T(), err)
+
+	filter := bson.M{"source.id": oid, "source.type": repository.CollectionOrder, "type": pkg.AccountingEntryTypeRealGrossRevenue}
+	_, err = suite.service.db.Collection(collectionAccountingEntry).UpdateOne(
+		context.TODO(),
+		filter,
+		bson.M{"$inc": bson.M{"amount": -10}},
+	)
+	assert.NoError(suite.T(), err)
+
+	req := &internalPkg.ReprocessAccountingRequest{MerchantId: suite.merchant.Id}
+	rsp := &internalPkg.ReprocessAccountingResponse{}
+	err = suite.service.ReprocessAccounting(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.EqualValues(suite.T(), 1, rsp.Changed)
+	assert.Len(suite.T(), rsp.Items[0].Diffs, 1)
+	assert.Equal(suite.T(), pkg.AccountingEntryTypeRealGrossRevenue, rsp.Items[0].Diffs[0].Type)
+	assert.EqualValues(suite.T(), 10, rsp.Items[0].Diffs[0].Delta)
+	assert.Empty(suite.T(), rsp.Items[0].CorrectionIds)
+
+	filter["object"] = pkg.ObjectTypeBalanceTransactionCorrection
+	count, err := suite.service.db.Collection(collectionAccountingEntry).CountDocuments(context.TODO(), filter)
+	assert.NoError(suite.T(), err)
+	assert.Zero(suite.T(), count)
+
+	req.Apply = true
+	rsp = &internalPkg.ReprocessAccountingResponse{}
+	err = suite.service.ReprocessAccounting(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.EqualValues(suite.T(), 1, rsp.Changed)
+	assert.Len(suite.T(), rsp.Items[0].CorrectionIds, 1)
+
+	var correction *billingpb.AccountingEntry
+	err = suite.service.db.Collection(collectionAccountingEntry).FindOne(context.TODO(), filter).Decode(&correction)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), rsp.Items[0].CorrectionIds[0], correction.Id)
+	assert.EqualValues(suite.T(), 10, correction.Amount)
+	assert.NotEmpty(suite.T(), correction.Reason)
+
+	req.Apply = false
+	rsp = &internalPkg.ReprocessAccountingResponse{}
+	err = suite.service.ReprocessAccounting(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Zero(suite.T(), rsp.Changed)
+}
+
+func (suite *AccountingReprocessingTestSuite) TestAccountingReprocessing_Apply_SourceLocked() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+
+	handler, err := suite.service.getPaymentAccountingHandler(context.TODO(), order)
+	assert.NoError(suite.T(), err)
+	handler.reprocessing = true
+	assert.NoError(suite.T(), handler.processPaymentEvent())
+
+	unlock, err := suite.service.lockAccountingSource(context.TODO(), repository.CollectionOrder, order.Id)
+	assert.NoError(suite.T(), err)
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*redisLockWaitInterval)
+	defer cancel()
+
+	handler.ctx = ctx
+	item := &internalPkg.AccountingReprocessingItem{
+		SourceType: repository.CollectionOrder,
+		SourceId:   order.Id,
+		OrderId:    order.Id,
+		MerchantId: order.GetMerchantId(),
+	}
+	err = suite.service.reprocessAccountingEntries(handler, item, accountingPaymentEntryTypes, true)
+	assert.Equal(suite.T(), callbackJournalErrorAccountingLocked, err)
+	assert.Empty(suite.T(), item.CorrectionIds)
+}
+
+func (suite *AccountingReprocessingTestSuite) TestAccountingReprocessing_FilterEmpty_Error() {
+	rsp := &internalPkg.ReprocessAccountingResponse{}
+	err := suite.service.ReprocessAccounting(context.TODO(), &internalPkg.ReprocessAccountingRequest{}, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), accountingReprocessingErrorFilterEmpty, rsp.Message)
+}
+
+func (suite *AccountingReprocessingTestSuite) TestAccountingReprocessing_PeriodInvalid_Error() {
+	req := &internalPkg.ReprocessAccountingRequest{
+		From: time.Now().Unix(),
+		To:   time.Now().Add(-time.Hour).Unix(),
+	}
+	rsp := &internalPkg.ReprocessAccountingResponse{}
+	err := suite.service.ReprocessAccounting(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), accountingReprocessingErrorPeriodInvalid, rsp.Message)
+}
+
+func (suite *AccountingReprocessingTestSuite) TestAccountingReprocessing_MerchantNotFound_Error() {
+	req := &internalPkg.ReprocessAccountingRequest{MerchantId: primitive.NewObjectID().Hex()}
+	rsp := &internalPkg.ReprocessAccountingResponse{}
+	err := suite.service.ReprocessAccounting(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), merchantErrorNotFound, rsp.Message)
+}
@@ -0,0 +1,453 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/paysuper/paysuper-billing-server/internal/helper"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"github.com/paysuper/paysuper-proto/go/reporterpb"
+	tools "github.com/paysuper/paysuper-tools/number"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	reportTypeBulkRefund = "bulk_refund"
+
+	bulkRefundColumnOrderId   = "order_id"
+	bulkRefundColumnProjectId = "project_id"
+	bulkRefundColumnAmount    = "amount"
+	bulkRefundColumnReason    = "reason"
+)
+
+var (
+	bulkRefundErrorFileInvalid     = newBillingServerErrorMsg("br000001", "bulk refund file must be CSV with order_id column in header")
+	bulkRefundErrorFileEmpty       = newBillingServerErrorMsg("br000002", "bulk refund file doesn't contain rows")
+	bulkRefundErrorTooManyRows     = newBillingServerErrorMsg("br000003", "bulk refund file contains too many rows")
+	bulkRefundErrorNotFound        = newBillingServerErrorMsg("br000004", "bulk refund job not found")
+	bulkRefundErrorRowInvalid      = newBillingServerErrorMsg("br000005", "row of bulk refund file is invalid")
+	bulkRefundErrorAmountMismatch  = newBillingServerErrorMsg("br000006", "amount of row differs from charge amount of order")
+	bulkRefundErrorDuplicatedOrder = newBillingServerErrorMsg("br000007", "order is refunded by other row of bulk refund file")
+
+	bulkRefundColumns = []string{
+		bulkRefundColumnOrderId,
+		bulkRefundColumnProjectId,
+		bulkRefundColumnAmount,
+		bulkRefundColumnReason,
+	}
+)
+
+// CreateBulkRefund creates job of refunds of orders from CSV file. All rows are validated by the rules of refund
+// creation, refunds of valid rows are created later by daemon.
+func (s *Service) CreateBulkRefund(
+	ctx context.Context,
+	req *internalPkg.CreateBulkRefundRequest,
+	rsp *internalPkg.BulkRefundJobResponse,
+) error {
+	rows, err := s.parseBulkRefundFile(req.File)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = err.(*billingpb.ResponseErrorMessage)
+		return nil
+	}
+
+	if _, err = s.merchantRepository.GetById(ctx, req.MerchantId); err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = merchantErrorNotFound
+		return nil
+	}
+
+	now := time.Now()
+	job := &internalPkg.BulkRefundJob{
+		Id:         primitive.NewObjectID().Hex(),
+		MerchantId: req.MerchantId,
+		CreatorId:  req.CreatorId,
+		Status:     internalPkg.BulkRefundJobStatusProcessing,
+		Rows:       rows,
+		Total:      int32(len(rows)),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	orders := make(map[string]bool)
+
+	for _, row := range rows {
+		if row.Status != internalPkg.BulkRefundRowStatusPending {
+			job.Failed++
+			continue
+		}
+
+		msg := s.validateBulkRefundRow(ctx, job, row)
+
+		if msg == nil && orders[row.OrderUuid] {
+			msg = bulkRefundErrorDuplicatedOrder
+		}
+
+		if msg != nil {
+			setBulkRefundRowFailed(row, msg)
+			job.Failed++
+			continue
+		}
+
+		orders[row.OrderUuid] = true
+	}
+
+	isFinished := job.Failed == job.Total
+
+	if isFinished {
+		setBulkRefundJobCompleted(job)
+	}
+
+	if err = s.bulkRefundJobRepository.Insert(ctx, job); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	if isFinished {
+		s.requestBulkRefundReport(ctx, job)
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = job
+
+	return nil
+}
+
+func (s *Service) GetBulkRefundJob(
+	ctx context.Context,
+	req *internalPkg.GetBulkRefundJobRequest,
+	rsp *internalPkg.BulkRefundJobResponse,
+) error {
+	job, err := s.bulkRefundJobRepository.GetById(ctx, req.Id)
+
+	if err != nil || job.MerchantId != req.MerchantId {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = bulkRefundErrorNotFound
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = job
+
+	return nil
+}
+
+// ProcessBulkRefundJobs creates refunds of pending rows of bulk refund jobs from oldest to newest and returns
+// the number of processed rows. No more than batch size of rows is processed per call with pause between refunds.
+// Each row is claimed before its refund is created and its result is saved by the row, so the row is refunded
+// once if jobs are processed concurrently. Row which is processing longer than claim timeout was interrupted and
+// is claimed again, refund of the row is created only if the interrupted processing hasn't created it.
+func (s *Service) ProcessBulkRefundJobs(ctx context.Context) (int, error) {
+	counter := 0
+	jobs, err := s.bulkRefundJobRepository.FindProcessing(ctx)
+
+	if err != nil {
+		return counter, err
+	}
+
+	throttle := time.Duration(s.cfg.BulkRefundThrottle) * time.Millisecond
+	staleBefore := time.Now().Add(-time.Duration(s.cfg.BulkRefundRowClaimTimeout) * time.Second)
+
+	for _, job := range jobs {
+		for _, row := range job.Rows {
+			isStale := row.Status == internalPkg.BulkRefundRowStatusProcessing &&
+				(row.ClaimedAt == nil || row.ClaimedAt.Before(staleBefore))
+
+			if row.Status != internalPkg.BulkRefundRowStatusPending && !isStale {
+				continue
+			}
+
+			if counter >= s.cfg.BulkRefundBatchSize {
+				return counter, nil
+			}
+
+			if counter > 0 && throttle > 0 {
+				time.Sleep(throttle)
+			}
+
+			claimedAt := time.Now()
+			ok, err := s.bulkRefundJobRepository.ClaimRow(ctx, job.Id, row.Line, claimedAt, staleBefore)
+
+			if err != nil {
+				return counter, err
+			}
+
+			if !ok {
+				continue
+			}
+
+			row.ClaimedAt = &claimedAt
+			refund, err := s.getBulkRefundRowRefund(ctx, job, row, isStale)
+
+			if err != nil {
+				return counter, err
+			}
+
+			if refund != nil {
+				row.Status = internalPkg.BulkRefundRowStatusSucceeded
+				row.RefundId = refund.Id
+			} else {
+				s.processBulkRefundRow(ctx, job, row)
+			}
+
+			counter++
+
+			if err = s.bulkRefundJobRepository.SetRowResult(ctx, job.Id, row); err != nil {
+				return counter, err
+			}
+		}
+
+		ok, err := s.bulkRefundJobRepository.Complete(ctx, job.Id, time.Now())
+
+		if err != nil {
+			return counter, err
+		}
+
+		if ok {
+			s.requestBulkRefundReport(ctx, job)
+		}
+	}
+
+	return counter, nil
+}
+
+// parseBulkRefundFile reads rows of CSV file, rows which can't be parsed are returned as failed.
+func (s *Service) parseBulkRefundFile(file []byte) ([]*internalPkg.BulkRefundRow, error) {
+	reader := csv.NewReader(bytes.NewReader(file))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+
+	if err != nil {
+		return nil, bulkRefundErrorFileInvalid
+	}
+
+	columns := make(map[string]int)
+
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		if helper.Contains(bulkRefundColumns, name) {
+			columns[name] = i
+		}
+	}
+
+	if _, ok := columns[bulkRefundColumnOrderId]; !ok {
+		return nil, bulkRefundErrorFileInvalid
+	}
+
+	var rows []*internalPkg.BulkRefundRow
+
+	for line := int32(2); ; line++ {
+		record, err := reader.Read()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, bulkRefundErrorFileInvalid
+		}
+
+		if len(rows) >= s.cfg.BulkRefundMaxRows {
+			return nil, bulkRefundErrorTooManyRows
+		}
+
+		rows = append(rows, getBulkRefundRow(line, record, columns))
+	}
+
+	if len(rows) <= 0 {
+		return nil, bulkRefundErrorFileEmpty
+	}
+
+	return rows, nil
+}
+
+func getBulkRefundRow(line int32, record []string, columns map[string]int) *internalPkg.BulkRefundRow {
+	value := func(column string) string {
+		i, ok := columns[column]
+
+		if !ok || i >= len(record) {
+			return ""
+		}
+
+		return strings.TrimSpace(record[i])
+	}
+
+	row := &internalPkg.BulkRefundRow{
+		Line:      line,
+		OrderId:   value(bulkRefundColumnOrderId),
+		ProjectId: value(bulkRefundColumnProjectId),
+		Reason:    value(bulkRefundColumnReason),
+		Status:    internalPkg.BulkRefundRowStatusPending,
+	}
+
+	if row.OrderId == "" {
+		setBulkRefundRowFailed(row, bulkRefundErrorRowInvalid)
+		return row
+	}
+
+	if amount := value(bulkRefundColumnAmount); amount != "" {
+		val, err := strconv.ParseFloat(amount, 64)
+
+		if err != nil || val < 0 {
+			setBulkRefundRowFailed(row, bulkRefundErrorRowInvalid)
+			return row
+		}
+
+		row.Amount = val
+	}
+
+	return row
+}
+
+// validateBulkRefundRow finds order of the row and checks that refund can be created for it.
+func (s *Service) validateBulkRefundRow(
+	ctx context.Context,
+	job *internalPkg.BulkRefundJob,
+	row *internalPkg.BulkRefundRow,
+) *billingpb.ResponseErrorMessage {
+	row.OrderUuid = row.OrderId
+
+	if row.ProjectId != "" {
+		order, err := s.orderRepository.GetByProjectOrderId(ctx, row.ProjectId, row.OrderId)
+
+		if err != nil || order == nil {
+			return refundErrorNotFound
+		}
+
+		row.OrderUuid = order.Uuid
+	}
+
+	processor := &createRefundProcessor{
+		service: s,
+		request: s.getBulkRefundRequest(job, row),
+		checked: &createRefundChecked{},
+		ctx:     ctx,
+	}
+
+	if err := processor.validate(); err != nil {
+		return err.(*billingpb.ResponseError).Message
+	}
+
+	if row.Amount > 0 && tools.FormatAmount(row.Amount) != processor.checked.order.ChargeAmount {
+		return bulkRefundErrorAmountMismatch
+	}
+
+	return nil
+}
+
+// getBulkRefundRowRefund returns refund of the order of row created by the creator of job if processing of the row
+// was interrupted, nil is returned if the refund wasn't created or the row wasn't processed before.
+func (s *Service) getBulkRefundRowRefund(
+	ctx context.Context,
+	job *internalPkg.BulkRefundJob,
+	row *internalPkg.BulkRefundRow,
+	isInterrupted bool,
+) (*billingpb.Refund, error) {
+	if !isInterrupted {
+		return nil, nil
+	}
+
+	refunds, err := s.refundRepository.FindByOrderUuid(ctx, row.OrderUuid, 0, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, refund := range refunds {
+		if refund.Status != pkg.RefundStatusRejected && refund.CreatorId == job.CreatorId {
+			return refund, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *Service) processBulkRefundRow(ctx context.Context, job *internalPkg.BulkRefundJob, row *internalPkg.BulkRefundRow) {
+	rsp := &billingpb.CreateRefundResponse{}
+	err := s.CreateRefund(ctx, s.getBulkRefundRequest(job, row), rsp)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.MethodFinishedWithError,
+			zap.String("method", "CreateRefund"),
+			zap.Error(err),
+			zap.String("job_id", job.Id),
+			zap.Int32("line", row.Line),
+		)
+		setBulkRefundRowFailed(row, refundErrorUnknown)
+		return
+	}
+
+	if rsp.Status != billingpb.ResponseStatusOk {
+		setBulkRefundRowFailed(row, rsp.Message)
+		return
+	}
+
+	row.Status = internalPkg.BulkRefundRowStatusSucceeded
+	row.RefundId = rsp.Item.Id
+}
+
+func (s *Service) getBulkRefundRequest(
+	job *internalPkg.BulkRefundJob,
+	row *internalPkg.BulkRefundRow,
+) *billingpb.CreateRefundRequest {
+	return &billingpb.CreateRefundRequest{
+		OrderId:    row.OrderUuid,
+		Amount:     row.Amount,
+		CreatorId:  job.CreatorId,
+		Reason:     row.Reason,
+		MerchantId: job.MerchantId,
+	}
+}
+
+// requestBulkRefundReport requests result report of the completed job from reporter, the report is stored
+// in report files of merchant and the creator of job is notified when it's ready.
+func (s *Service) requestBulkRefundReport(ctx context.Context, job *internalPkg.BulkRefundJob) {
+	params, _ := json.Marshal(map[string]interface{}{reporterpb.ParamsFieldId: job.Id})
+	req := &reporterpb.ReportFile{
+		UserId:           job.CreatorId,
+		MerchantId:       job.MerchantId,
+		ReportType:       reportTypeBulkRefund,
+		FileType:         reporterpb.OutputExtensionCsv,
+		Params:           params,
+		SendNotification: true,
+	}
+
+	if _, err := s.reporterService.CreateFile(ctx, req); err != nil {
+		zap.L().Error(
+			pkg.ErrorGrpcServiceCallFailed,
+			zap.Error(err),
+			zap.String(errorFieldService, reporterpb.ServiceName),
+			zap.String(errorFieldMethod, "CreateFile"),
+			zap.Any(errorFieldRequest, req),
+		)
+	}
+}
+
+func setBulkRefundJobCompleted(job *internalPkg.BulkRefundJob) {
+	finishedAt := time.Now()
+	job.Status = internalPkg.BulkRefundJobStatusCompleted
+	job.FinishedAt = &finishedAt
+}
+
+func setBulkRefundRowFailed(row *internalPkg.BulkRefundRow, msg *billingpb.ResponseErrorMessage) {
+	row.Status = internalPkg.BulkRefundRowStatusFailed
+
+	if msg != nil {
+		row.ErrorCode = msg.Code
+		row.ErrorMessage = msg.Message
+	}
+}
@@ -0,0 +1,376 @@
+package service
+
+import (
+	"context"
+	"github.com/go-redis/redis"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/mongodb"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/google/uuid"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	"github.com/paysuper/paysuper-billing-server/internal/database"
+	"github.com/paysuper/paysuper-billing-server/internal/mocks"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	casbinMocks "github.com/paysuper/paysuper-proto/go/casbinpb/mocks"
+	"github.com/paysuper/paysuper-proto/go/reporterpb"
+	reportingMocks "github.com/paysuper/paysuper-proto/go/reporterpb/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	rabbitmq "gopkg.in/ProtocolONE/rabbitmq.v1/pkg"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type BulkRefundTestSuite struct {
+	suite.Suite
+	service *Service
+	log     *zap.Logger
+	cache   database.CacheInterface
+
+	merchant      *billingpb.Merchant
+	project       *billingpb.Project
+	paymentMethod *billingpb.PaymentMethod
+	paymentSystem *billingpb.PaymentSystem
+	reporter      *reportingMocks.ReporterService
+}
+
+func Test_BulkRefund(t *testing.T) {
+	suite.Run(t, new(BulkRefundTestSuite))
+}
+
+func (suite *BulkRefundTestSuite) SetupTest() {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		suite.FailNow("Config load failed", "%v", err)
+	}
+	cfg.CardPayApiUrl = "https://sandbox.cardpay.com"
+
+	m, err := migrate.New(
+		"file://../../migrations/tests",
+		cfg.MongoDsn)
+	assert.NoError(suite.T(), err, "Migrate init failed")
+
+	err = m.Up()
+	if err != nil && err.Error() != "no change" {
+		suite.FailNow("Migrations failed", "%v", err)
+	}
+
+	ctx, _ := context.WithTimeout(context.Background(), 50*time.Second)
+	opts := []mongodb.Option{mongodb.Context(ctx)}
+	db, err := mongodb.NewDatabase(opts...)
+	if err != nil {
+		suite.FailNow("Database connection failed", "%v", err)
+	}
+
+	suite.log, err = zap.NewProduction()
+
+	if err != nil {
+		suite.FailNow("Logger initialization failed", "%v", err)
+	}
+
+	broker, err := rabbitmq.NewBroker(cfg.BrokerAddress)
+
+	if err != nil {
+		suite.FailNow("Creating RabbitMQ publisher failed", "%v", err)
+	}
+
+	redisClient := database.NewRedis(
+		&redis.Options{
+			Addr:     cfg.RedisHost,
+			Password: cfg.RedisPassword,
+		},
+	)
+
+	redisdb := mocks.NewTestRedis()
+	suite.cache, err = database.NewCacheRedis(redisdb, "cache")
+	suite.service = NewBillingService(
+		db,
+		cfg,
+		mocks.NewGeoIpServiceTestOk(),
+		mocks.NewRepositoryServiceOk(),
+		mocks.NewTaxServiceOkMock(),
+		broker,
+		redisClient,
+		suite.cache,
+		mocks.NewCurrencyServiceMockOk(),
+		mocks.NewDocumentSignerMockOk(),
+		&reportingMocks.ReporterService{},
+		mocks.NewFormatterOK(),
+		mocks.NewBrokerMockOk(),
+		&casbinMocks.CasbinService{},
+	)
+
+	if err := suite.service.Init(); err != nil {
+		suite.FailNow("Billing service initialization failed", "%v", err)
+	}
+
+	suite.merchant, suite.project, suite.paymentMethod, suite.paymentSystem = helperCreateEntitiesForTests(suite.Suite, suite.service)
+
+	centrifugoMock := &mocks.CentrifugoInterface{}
+	centrifugoMock.On("GetChannelToken", mock.Anything, mock.Anything).Return("token")
+	centrifugoMock.On("Publish", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	suite.service.centrifugoDashboard = centrifugoMock
+	suite.service.centrifugoPaymentForm = centrifugoMock
+
+	reporterMock := &reportingMocks.ReporterService{}
+	reporterMock.On("CreateFile", mock.Anything, mock.Anything, mock.Anything).
+		Return(&reporterpb.CreateFileResponse{Status: billingpb.ResponseStatusOk}, nil)
+	suite.service.reporterService = reporterMock
+	suite.reporter = reporterMock
+
+	suite.service.cfg.BulkRefundThrottle = 0
+}
+
+func (suite *BulkRefundTestSuite) TearDownTest() {
+	err := suite.service.db.Drop()
+
+	if err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	err = suite.service.db.Close()
+
+	if err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *BulkRefundTestSuite) TestBulkRefund_CreateBulkRefund_FileInvalid() {
+	files := map[string]*billingpb.ResponseErrorMessage{
+		"":                          bulkRefundErrorFileInvalid,
+		"uuid,amount\n1,10\n":       bulkRefundErrorFileInvalid,
+		"order_id,amount,reason\n":  bulkRefundErrorFileEmpty,
+		"order_id\n\"1\"\"2,3\n":    bulkRefundErrorFileInvalid,
+		"order_id\n1\n2\n3\n4\n5\n": bulkRefundErrorTooManyRows,
+	}
+	suite.service.cfg.BulkRefundMaxRows = 4
+
+	for file, message := range files {
+		rsp := suite.createBulkRefund(file)
+		assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+		assert.Equal(suite.T(), message, rsp.Message)
+	}
+}
+
+func (suite *BulkRefundTestSuite) TestBulkRefund_CreateBulkRefund_MerchantNotFound() {
+	req := &internalPkg.CreateBulkRefundRequest{
+		MerchantId: primitive.NewObjectID().Hex(),
+		CreatorId:  primitive.NewObjectID().Hex(),
+		File:       []byte("order_id\n" + uuid.New().String() + "\n"),
+	}
+	rsp := &internalPkg.BulkRefundJobResponse{}
+	err := suite.service.CreateBulkRefund(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), merchantErrorNotFound, rsp.Message)
+}
+
+func (suite *BulkRefundTestSuite) TestBulkRefund_ProcessBulkRefundJobs_Ok() {
+	order1 := suite.createAndPayOrder()
+	order2 := suite.createAndPayOrder()
+	order3 := suite.createAndPayOrder()
+
+	file := "order_id,project_id,amount,reason\n" +
+		order1.Uuid + ",,,broken key batch\n" +
+		order2.ProjectOrderId + "," + suite.project.Id + "," + strconv.FormatFloat(order2.ChargeAmount, 'f', -1, 64) + ",duplicate charge\n" +
+		uuid.New().String() + ",,,unknown order\n" +
+		order1.Uuid + ",,,duplicate row\n" +
+		order3.Uuid + ",,0.01,amount mismatch\n" +
+		",,,empty order\n"
+	rsp := suite.createBulkRefund(file)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	job := rsp.Item
+	assert.Equal(suite.T(), internalPkg.BulkRefundJobStatusProcessing, job.Status)
+	assert.Equal(suite.T(), int32(6), job.Total)
+	assert.Equal(suite.T(), int32(4), job.Failed)
+	assert.Equal(suite.T(), internalPkg.BulkRefundRowStatusPending, job.Rows[0].Status)
+	assert.Equal(suite.T(), internalPkg.BulkRefundRowStatusPending, job.Rows[1].Status)
+	assert.Equal(suite.T(), order2.Uuid, job.Rows[1].OrderUuid)
+	assert.Equal(suite.T(), refundErrorNotFound.Code, job.Rows[2].ErrorCode)
+	assert.Equal(suite.T(), bulkRefundErrorDuplicatedOrder.Code, job.Rows[3].ErrorCode)
+	assert.Equal(suite.T(), bulkRefundErrorAmountMismatch.Code, job.Rows[4].ErrorCode)
+	assert.Equal(suite.T(), bulkRefundErrorRowInvalid.Code, job.Rows[5].ErrorCode)
+	assert.Equal(suite.T(), int32(7), job.Rows[5].Line)
+
+	count, err := suite.service.ProcessBulkRefundJobs(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 2, count)
+
+	job = suite.getBulkRefundJob(job.Id)
+	assert.Equal(suite.T(), internalPkg.BulkRefundJobStatusCompleted, job.Status)
+	assert.Equal(suite.T(), int32(2), job.Succeeded)
+	assert.Equal(suite.T(), int32(4), job.Failed)
+	assert.NotNil(suite.T(), job.FinishedAt)
+
+	for i, order := range []*billingpb.Order{order1, order2} {
+		assert.Equal(suite.T(), internalPkg.BulkRefundRowStatusSucceeded, job.Rows[i].Status)
+
+		refund, err := suite.service.refundRepository.GetById(context.TODO(), job.Rows[i].RefundId)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), order.Id, refund.OriginalOrder.Id)
+		assert.Equal(suite.T(), job.Rows[i].Reason, refund.Reason)
+	}
+
+	suite.reporter.AssertNumberOfCalls(suite.T(), "CreateFile", 1)
+
+	count, err = suite.service.ProcessBulkRefundJobs(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Zero(suite.T(), count)
+}
+
+func (suite *BulkRefundTestSuite) TestBulkRefund_ProcessBulkRefundJobs_BatchSize() {
+	order1 := suite.createAndPayOrder()
+	order2 := suite.createAndPayOrder()
+	suite.service.cfg.BulkRefundBatchSize = 1
+
+	rsp := suite.createBulkRefund("order_id\n" + order1.Uuid + "\n" + order2.Uuid + "\n")
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	count, err := suite.service.ProcessBulkRefundJobs(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, count)
+
+	job := suite.getBulkRefundJob(rsp.Item.Id)
+	assert.Equal(suite.T(), internalPkg.BulkRefundJobStatusProcessing, job.Status)
+	assert.Equal(suite.T(), internalPkg.BulkRefundRowStatusSucceeded, job.Rows[0].Status)
+	assert.Equal(suite.T(), internalPkg.BulkRefundRowStatusPending, job.Rows[1].Status)
+	suite.reporter.AssertNotCalled(suite.T(), "CreateFile", mock.Anything, mock.Anything, mock.Anything)
+
+	count, err = suite.service.ProcessBulkRefundJobs(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, count)
+
+	job = suite.getBulkRefundJob(rsp.Item.Id)
+	assert.Equal(suite.T(), internalPkg.BulkRefundJobStatusCompleted, job.Status)
+	assert.Equal(suite.T(), int32(2), job.Succeeded)
+	suite.reporter.AssertNumberOfCalls(suite.T(), "CreateFile", 1)
+}
+
+func (suite *BulkRefundTestSuite) TestBulkRefund_ProcessBulkRefundJobs_RowClaimedByOther() {
+	order1 := suite.createAndPayOrder()
+	order2 := suite.createAndPayOrder()
+
+	rsp := suite.createBulkRefund("order_id\n" + order1.Uuid + "\n" + order2.Uuid + "\n")
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	ok, err := suite.service.bulkRefundJobRepository.ClaimRow(
+		context.TODO(),
+		rsp.Item.Id,
+		rsp.Item.Rows[0].Line,
+		time.Now(),
+		time.Now().Add(-time.Minute),
+	)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	count, err := suite.service.ProcessBulkRefundJobs(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, count)
+
+	job := suite.getBulkRefundJob(rsp.Item.Id)
+	assert.Equal(suite.T(), internalPkg.BulkRefundJobStatusProcessing, job.Status)
+	assert.Equal(suite.T(), internalPkg.BulkRefundRowStatusProcessing, job.Rows[0].Status)
+	assert.Empty(suite.T(), job.Rows[0].RefundId)
+	assert.Equal(suite.T(), internalPkg.BulkRefundRowStatusSucceeded, job.Rows[1].Status)
+	assert.Equal(suite.T(), int32(1), job.Succeeded)
+	suite.reporter.AssertNotCalled(suite.T(), "CreateFile", mock.Anything, mock.Anything, mock.Anything)
+
+	refunds, err := suite.service.refundRepository.FindByOrderUuid(context.TODO(), order1.Uuid, 0, 0)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), refunds)
+}
+
+func (suite *BulkRefundTestSuite) TestBulkRefund_ProcessBulkRefundJobs_InterruptedRowsClaimedAgain() {
+	order1 := suite.createAndPayOrder()
+	order2 := suite.createAndPayOrder()
+
+	rsp := suite.createBulkRefund("order_id\n" + order1.Uuid + "\n" + order2.Uuid + "\n")
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	claimedAt := time.Now().Add(-time.Duration(suite.service.cfg.BulkRefundRowClaimTimeout+1) * time.Second)
+
+	for _, row := range rsp.Item.Rows {
+		ok, err := suite.service.bulkRefundJobRepository.ClaimRow(context.TODO(), rsp.Item.Id, row.Line, claimedAt, claimedAt)
+		assert.NoError(suite.T(), err)
+		assert.True(suite.T(), ok)
+	}
+
+	rsp1 := &billingpb.CreateRefundResponse{}
+	err := suite.service.CreateRefund(
+		context.TODO(),
+		suite.service.getBulkRefundRequest(rsp.Item, rsp.Item.Rows[0]),
+		rsp1,
+	)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp1.Status)
+
+	count, err := suite.service.ProcessBulkRefundJobs(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 2, count)
+
+	job := suite.getBulkRefundJob(rsp.Item.Id)
+	assert.Equal(suite.T(), internalPkg.BulkRefundJobStatusCompleted, job.Status)
+	assert.Equal(suite.T(), int32(2), job.Succeeded)
+	assert.Equal(suite.T(), internalPkg.BulkRefundRowStatusSucceeded, job.Rows[0].Status)
+	assert.Equal(suite.T(), rsp1.Item.Id, job.Rows[0].RefundId)
+	assert.Equal(suite.T(), internalPkg.BulkRefundRowStatusSucceeded, job.Rows[1].Status)
+	assert.NotEmpty(suite.T(), job.Rows[1].RefundId)
+
+	refunds, err := suite.service.refundRepository.FindByOrderUuid(context.TODO(), order1.Uuid, 0, 0)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), refunds, 1)
+}
+
+func (suite *BulkRefundTestSuite) TestBulkRefund_CreateBulkRefund_AllRowsFailed_Completed() {
+	rsp := suite.createBulkRefund("order_id\n" + uuid.New().String() + "\n")
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), internalPkg.BulkRefundJobStatusCompleted, rsp.Item.Status)
+	assert.Equal(suite.T(), int32(1), rsp.Item.Failed)
+	suite.reporter.AssertNumberOfCalls(suite.T(), "CreateFile", 1)
+}
+
+func (suite *BulkRefundTestSuite) TestBulkRefund_GetBulkRefundJob_NotFound() {
+	rsp := suite.createBulkRefund("order_id\n" + uuid.New().String() + "\n")
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	req := &internalPkg.GetBulkRefundJobRequest{Id: rsp.Item.Id, MerchantId: primitive.NewObjectID().Hex()}
+	rsp1 := &internalPkg.BulkRefundJobResponse{}
+	err := suite.service.GetBulkRefundJob(context.TODO(), req, rsp1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp1.Status)
+	assert.Equal(suite.T(), bulkRefundErrorNotFound, rsp1.Message)
+}
+
+func (suite *BulkRefundTestSuite) createAndPayOrder() *billingpb.Order {
+	return helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+}
+
+func (suite *BulkRefundTestSuite) createBulkRefund(file string) *internalPkg.BulkRefundJobResponse {
+	req := &internalPkg.CreateBulkRefundRequest{
+		MerchantId: suite.merchant.Id,
+		CreatorId:  primitive.NewObjectID().Hex(),
+		File:       []byte(file),
+	}
+	rsp := &internalPkg.BulkRefundJobResponse{}
+	err := suite.service.CreateBulkRefund(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+
+	return rsp
+}
+
+func (suite *BulkRefundTestSuite) getBulkRefundJob(id string) *internalPkg.BulkRefundJob {
+	req := &internalPkg.GetBulkRefundJobRequest{Id: id, MerchantId: suite.merchant.Id}
+	rsp := &internalPkg.BulkRefundJobResponse{}
+	err := suite.service.GetBulkRefundJob(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	return rsp.Item
+}
@@ -0,0 +1,323 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/internal/repository"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"time"
+)
+
+var (
+	callbackJournalErrorNotFound              = newBillingServerErrorMsg("cj000001", "callback not found in journal")
+	callbackJournalErrorReplayNotAllowed      = newBillingServerErrorMsg("cj000002", "only failed callback can be replayed")
+	callbackJournalErrorTypeUnknown           = newBillingServerErrorMsg("cj000003", "type of callback is unknown")
+	callbackJournalErrorReplayFailed          = newBillingServerErrorMsg("cj000004", "replay of callback failed")
+	callbackJournalErrorAccountingCheckFailed = newBillingServerErrorMsg("cj000005", "check of accounting entries created by callback failed")
+	callbackJournalErrorAccountingLocked      = newBillingServerErrorMsg("cj000006", "accounting entries of source are creating by other process now")
+)
+
+const (
+	accountingSourceLockKey = "accounting_source_lock:%s:%s"
+)
+
+// newCallbackJournalEntry saves raw callback of payment system to the journal before it will be processed.
+// Processing of callback isn't interrupted if journal is unavailable, error is only logged by repository.
+func (s *Service) newCallbackJournalEntry(
+	ctx context.Context,
+	callbackType, handler string,
+	body []byte,
+	signature string,
+) *internalPkg.CallbackJournalEntry {
+	now := time.Now()
+	entry := &internalPkg.CallbackJournalEntry{
+		Id:        primitive.NewObjectID().Hex(),
+		Type:      callbackType,
+		Handler:   handler,
+		Body:      body,
+		Signature: signature,
+		Status:    internalPkg.CallbackJournalStatusProcessing,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	_ = s.callbackJournalRepository.Insert(ctx, entry)
+
+	return entry
+}
+
+// finishCallbackJournalEntry saves result of callback processing to the journal.
+// Callback with temporary status of payment is skipped by payment system handler and isn't considered as failed.
+// Duplicated and conflicting callbacks keep status set by idempotency check.
+func (s *Service) finishCallbackJournalEntry(
+	ctx context.Context,
+	entry *internalPkg.CallbackJournalEntry,
+	rsp *billingpb.PaymentNotifyResponse,
+	err error,
+) {
+	entry.ResponseStatus = rsp.Status
+	entry.Error = rsp.Error
+	entry.UpdatedAt = time.Now()
+
+	switch {
+	case entry.Status == internalPkg.CallbackJournalStatusDuplicate,
+		entry.Status == internalPkg.CallbackJournalStatusConflict:
+		// status is set by idempotency check of callback
+	case err != nil:
+		entry.Status = internalPkg.CallbackJournalStatusFailed
+		entry.Error = err.Error()
+	case entry.Type == internalPkg.CallbackJournalTypePayment && rsp.Status == pkg.StatusOK,
+		entry.Type == internalPkg.CallbackJournalTypeRefund && rsp.Status == billingpb.ResponseStatusOk:
+		entry.Status = internalPkg.CallbackJournalStatusSuccess
+	case entry.Type == internalPkg.CallbackJournalTypePayment && rsp.Status == pkg.StatusTemporary:
+		entry.Status = internalPkg.CallbackJournalStatusSkipped
+	default:
+		entry.Status = internalPkg.CallbackJournalStatusFailed
+	}
+
+	_ = s.callbackJournalRepository.Update(ctx, entry)
+}
+
+// processPaymentAccounting creates accounting entries of paid order. Check of accounting entries created earlier
+// on replay of callback and their creation are done under the accounting lock of order, so entries aren't created
+// twice by replay and the original callback processed concurrently.
+func (s *Service) processPaymentAccounting(ctx context.Context, order *billingpb.Order, replay bool) error {
+	unlock, err := s.lockAccountingSource(ctx, repository.CollectionOrder, order.Id)
+
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	if replay {
+		return s.onPaymentNotifyReplay(ctx, order)
+	}
+
+	return s.onPaymentNotify(ctx, order)
+}
+
+// processRefundAccounting creates accounting entries of refund under the accounting lock of refund order.
+func (s *Service) processRefundAccounting(
+	ctx context.Context,
+	refund *billingpb.Refund,
+	order *billingpb.Order,
+	replay bool,
+) error {
+	unlock, err := s.lockAccountingSource(ctx, repository.CollectionRefund, refund.CreatedOrderId)
+
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	if replay {
+		return s.onRefundNotifyReplay(ctx, refund, order)
+	}
+
+	return s.onRefundNotify(ctx, refund, order)
+}
+
+// lockAccountingSource acquires lock of accounting entries creation for source document in Redis and returns
+// function which releases the lock. Lock is held no longer than callbackTransactionLockTtl and waited for
+// callbackTransactionWaitTimeout.
+func (s *Service) lockAccountingSource(ctx context.Context, sourceType, sourceId string) (func(), error) {
+	unlock, ok, err := s.acquireRedisLock(
+		ctx,
+		fmt.Sprintf(accountingSourceLockKey, sourceType, sourceId),
+		callbackTransactionLockTtl,
+		callbackTransactionWaitTimeout,
+	)
+
+	if err != nil {
+		return nil, callbackJournalErrorAccountingCheckFailed
+	}
+
+	if !ok {
+		return nil, callbackJournalErrorAccountingLocked
+	}
+
+	return unlock, nil
+}
+
+// onPaymentNotifyReplay creates accounting entries of order on replay of payment callback
+// only if they weren't created by the original callback.
+func (s *Service) onPaymentNotifyReplay(ctx context.Context, order *billingpb.Order) error {
+	exists, err := s.hasAccountingEntries(ctx, repository.CollectionOrder, order.Id)
+
+	if err != nil {
+		return callbackJournalErrorAccountingCheckFailed
+	}
+
+	if exists {
+		zap.L().Info("accounting entries of order already created, skipped on replay", zap.String("order_id", order.Id))
+		return nil
+	}
+
+	return s.onPaymentNotify(ctx, order)
+}
+
+// onRefundNotifyReplay creates accounting entries of refund on replay of refund callback
+// only if they weren't created by the original callback.
+func (s *Service) onRefundNotifyReplay(ctx context.Context, refund *billingpb.Refund, order *billingpb.Order) error {
+	exists, err := s.hasAccountingEntries(ctx, repository.CollectionRefund, refund.CreatedOrderId)
+
+	if err != nil {
+		return callbackJournalErrorAccountingCheckFailed
+	}
+
+	if exists {
+		zap.L().Info("accounting entries of refund already created, skipped on replay", zap.String("refund_id", refund.Id))
+		return nil
+	}
+
+	return s.onRefundNotify(ctx, refund, order)
+}
+
+func (s *Service) hasAccountingEntries(ctx context.Context, sourceType, sourceId string) (bool, error) {
+	oid, err := primitive.ObjectIDFromHex(sourceId)
+
+	if err != nil {
+		return false, err
+	}
+
+	query := bson.M{
+		"object":      pkg.ObjectTypeBalanceTransaction,
+		"source.id":   oid,
+		"source.type": sourceType,
+	}
+	count, err := s.db.Collection(collectionAccountingEntry).CountDocuments(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionAccountingEntry),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (s *Service) ListCallbackJournal(
+	ctx context.Context,
+	req *internalPkg.ListCallbackJournalRequest,
+	rsp *internalPkg.ListCallbackJournalResponse,
+) error {
+	if req.Limit <= 0 {
+		req.Limit = pkg.DatabaseRequestDefaultLimit
+	}
+
+	if req.Offset <= 0 {
+		req.Offset = 0
+	}
+
+	count, err := s.callbackJournalRepository.FindCount(ctx, req)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	if count > 0 {
+		rsp.Items, err = s.callbackJournalRepository.Find(ctx, req)
+
+		if err != nil {
+			rsp.Status = billingpb.ResponseStatusSystemError
+			rsp.Message = orderErrorUnknown
+			return nil
+		}
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Count = count
+
+	return nil
+}
+
+// ReplayCallback processes failed callback from the journal again through the same path as incoming callback.
+func (s *Service) ReplayCallback(
+	ctx context.Context,
+	req *internalPkg.ReplayCallbackRequest,
+	rsp *internalPkg.ReplayCallbackResponse,
+) error {
+	entry, err := s.callbackJournalRepository.GetById(ctx, req.Id)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = callbackJournalErrorNotFound
+		return nil
+	}
+
+	if entry.Status != internalPkg.CallbackJournalStatusFailed {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = callbackJournalErrorReplayNotAllowed
+		return nil
+	}
+
+	// concurrent replays of the same callback are prevented by moving it from failed status atomically
+	entry, err = s.callbackJournalRepository.ClaimReplay(ctx, req.Id, time.Now())
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	if entry == nil {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = callbackJournalErrorReplayNotAllowed
+		return nil
+	}
+
+	cbRsp := &billingpb.PaymentNotifyResponse{}
+
+	switch entry.Type {
+	case internalPkg.CallbackJournalTypePayment:
+		cbReq := &billingpb.PaymentNotifyRequest{
+			OrderId:   entry.OrderId,
+			Request:   entry.Body,
+			Signature: entry.Signature,
+		}
+		err = s.processPaymentCallback(ctx, cbReq, cbRsp, entry, true)
+		break
+	case internalPkg.CallbackJournalTypeRefund:
+		cbReq := &billingpb.CallbackRequest{
+			Handler:   entry.Handler,
+			Body:      entry.Body,
+			Signature: entry.Signature,
+		}
+		err = s.processRefundCallback(ctx, cbReq, cbRsp, entry, true)
+		break
+	default:
+		err = callbackJournalErrorTypeUnknown
+	}
+
+	s.finishCallbackJournalEntry(ctx, entry, cbRsp, err)
+
+	if entry.Status == internalPkg.CallbackJournalStatusFailed {
+		zap.L().Error(
+			"replay of callback failed",
+			zap.String("callback_id", entry.Id),
+			zap.String("error", entry.Error),
+		)
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = callbackJournalErrorReplayFailed
+		rsp.Item = entry
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = entry
+
+	return nil
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/mongodb"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang/protobuf/proto"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	"github.com/paysuper/paysuper-billing-server/internal/database"
+	"github.com/paysuper/paysuper-billing-server/internal/mocks"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/internal/repository"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	casbinMocks "github.com/paysuper/paysuper-proto/go/casbinpb/mocks"
+	reportingMocks "github.com/paysuper/paysuper-proto/go/reporterpb/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	rabbitmq "gopkg.in/ProtocolONE/rabbitmq.v1/pkg"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type CallbackJournalTestSuite struct {
+	suite.Suite
+	service *Service
+	log     *zap.Logger
+	cache   database.CacheInterface
+
+	merchant      *billingpb.Merchant
+	project       *billingpb.Project
+	paymentMethod *billingpb.PaymentMethod
+	paymentSystem *billingpb.PaymentSystem
+}
+
+func Test_CallbackJournal(t *testing.T) {
+	suite.Run(t, new(CallbackJournalTestSuite))
+}
+
+func (suite *CallbackJournalTestSuite) SetupTest() {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		suite.FailNow("Config load failed", "%v", err)
+	}
+	cfg.CardPayApiUrl = "https://sandbox.cardpay.com"
+
+	m, err := migrate.New(
+		"file://../../migrations/tests",
+		cfg.MongoDsn)
+	assert.NoError(suite.T(), err, "Migrate init failed")
+
+	err = m.Up()
+	if err != nil && err.Error() != "no change" {
+		suite.FailNow("Migrations failed", "%v", err)
+	}
+
+	ctx, _ := context.WithTimeout(context.Background(), 50*time.Second)
+	opts := []mongodb.Option{mongodb.Context(ctx)}
+	db, err := mongodb.NewDatabase(opts...)
+	if err != nil {
+		suite.FailNow("Database connection failed", "%v", err)
+	}
+
+	suite.log, err = zap.NewProduction()
+
+	if err != nil {
+		suite.FailNow("Logger initialization failed", "%v", err)
+	}
+
+	broker, err := rabbitmq.NewBroker(cfg.BrokerAddress)
+
+	if err != nil {
+		suite.FailNow("Creating RabbitMQ publisher failed", "%v", err)
+	}
+
+	redisClient := database.NewRedis(
+		&redis.Options{
+			Addr:     cfg.RedisHost,
+			Password: cfg.RedisPassword,
+		},
+	)
+
+	redisdb := mocks.NewTestRedis()
+	suite.cache, err = database.NewCacheRedis(redisdb, "cache")
+	suite.service = NewBillingService(
+		db,
+		cfg,
+		mocks.NewGeoIpServiceTestOk(),
+		mocks.NewRepositoryServiceOk(),
+		mocks.NewTaxServiceOkMock(),
+		broker,
+		redisClient,
+		suite.cache,
+		mocks.NewCurrencyServiceMockOk(),
+		mocks.NewDocumentSignerMockOk(),
+		&reportingMocks.ReporterService{},
+		mocks.NewFormatterOK(),
+		mocks.NewBrokerMockOk(),
+		&casbinMocks.CasbinService{},
+	)
+
+	if err := suite.service.Init(); err != nil {
+		suite.FailNow("Billing service initialization failed", "%v", err)
+	}
+
+	suite.merchant, suite.project, suite.paymentMethod, suite.paymentSystem = helperCreateEntitiesForTests(suite.Suite, suite.service)
+}
+
+func (suite *CallbackJournalTestSuite) TearDownTest() {
+	err := suite.service.db.Drop()
+
+	if err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	err = suite.service.db.Close()
+
+	if err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *CallbackJournalTestSuite) TestCallbackJournal_PaymentCallbackProcess_Journaled() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+
+	entry := suite.getJournalEntry(internalPkg.CallbackJournalTypePayment, order.Id)
+	assert.Equal(suite.T(), internalPkg.CallbackJournalStatusSuccess, entry.Status)
+	assert.Equal(suite.T(), suite.paymentSystem.Handler, entry.Handler)
+	assert.NotEmpty(suite.T(), entry.Body)
+	assert.NotEmpty(suite.T(), entry.Signature)
+	assert.Empty(suite.T(), entry.Error)
+}
+
+func (suite *CallbackJournalTestSuite) TestCallbackJournal_ProcessRefundCallback_Journaled() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	refund := helperMakeRefund(suite.Suite, suite.service, order, 10, false)
+
+	entry := suite.getJournalEntry(internalPkg.CallbackJournalTypeRefund, order.Id)
+	assert.Equal(suite.T(), internalPkg.CallbackJournalStatusSuccess, entry.Status)
+	assert.Equal(suite.T(), refund.Id, entry.RefundId)
+	assert.Equal(suite.T(), billingpb.PaymentSystemHandlerCardPay, entry.Handler)
+}
+
+func (suite *CallbackJournalTestSuite) TestCallbackJournal_PaymentCallbackProcess_OrderNotFound() {
+	req := &billingpb.PaymentNotifyRequest{
+		OrderId:   primitive.NewObjectID().Hex(),
+		Request:   []byte(`{"payment_data":{}}`),
+		Signature: "signature",
+	}
+	err := suite.service.PaymentCallbackProcess(context.TODO(), req, &billingpb.PaymentNotifyResponse{})
+	assert.Equal(suite.T(), orderErrorNotFound, err)
+
+	entry := suite.getJournalEntry(internalPkg.CallbackJournalTypePayment, req.OrderId)
+	assert.Equal(suite.T(), internalPkg.CallbackJournalStatusFailed, entry.Status)
+	assert.Equal(suite.T(), req.Request, entry.Body)
+	assert.Equal(suite.T(), orderErrorNotFound.Error(), entry.Error)
+}
+
+func (suite *CallbackJournalTestSuite) TestCallbackJournal_ReplayCallback_Payment_Ok() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	entry := suite.getJournalEntry(internalPkg.CallbackJournalTypePayment, order.Id)
+	count := suite.getAccountingEntriesCount(repository.CollectionOrder, order.Id)
+	assert.True(suite.T(), count > 0)
+
+	suite.failCallback(entry)
+
+	rsp := &internalPkg.ReplayCallbackResponse{}
+	err := suite.service.ReplayCallback(context.TODO(), &internalPkg.ReplayCallbackRequest{Id: entry.Id}, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), internalPkg.CallbackJournalStatusSuccess, rsp.Item.Status)
+	assert.EqualValues(suite.T(), 1, rsp.Item.ReplayCount)
+	assert.NotNil(suite.T(), rsp.Item.ReplayedAt)
+
+	// accounting entries created by the original callback must not be booked again
+	assert.Equal(suite.T(), count, suite.getAccountingEntriesCount(repository.CollectionOrder, order.Id))
+}
+
+func (suite *CallbackJournalTestSuite) TestCallbackJournal_ReplayCallback_Refund_Ok() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	refund := helperMakeRefund(suite.Suite, suite.service, order, 10, false)
+	entry := suite.getJournalEntry(internalPkg.CallbackJournalTypeRefund, order.Id)
+	count := suite.getAccountingEntriesCount(repository.CollectionRefund, refund.CreatedOrderId)
+	assert.True(suite.T(), count > 0)
+
+	suite.failCallback(entry)
+
+	rsp := &internalPkg.ReplayCallbackResponse{}
+	err := suite.service.ReplayCallback(context.TODO(), &internalPkg.ReplayCallbackRequest{Id: entry.Id}, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), internalPkg.CallbackJournalStatusSuccess, rsp.Item.Status)
+	assert.Equal(suite.T(), count, suite.getAccountingEntriesCount(repository.CollectionRefund, refund.CreatedOrderId))
+}
+
+func (suite *CallbackJournalTestSuite) TestCallbackJournal_ReplayCallback_NotFound() {
+	rsp := &internalPkg.ReplayCallbackResponse{}
+	err := suite.service.ReplayCallback(context.TODO(), &internalPkg.ReplayCallbackRequest{Id: "unknown"}, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), callbackJournalErrorNotFound, rsp.Message)
+}
+
+func (suite *CallbackJournalTestSuite) TestCallbackJournal_ReplayCallback_NotAllowed() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	entry := suite.getJournalEntry(internalPkg.CallbackJournalTypePayment, order.Id)
+
+	rsp := &internalPkg.ReplayCallbackResponse{}
+	err := suite.service.ReplayCallback(context.TODO(), &internalPkg.ReplayCallbackRequest{Id: entry.Id}, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), callbackJournalErrorReplayNotAllowed, rsp.Message)
+}
+
+func (suite *CallbackJournalTestSuite) TestCallbackJournal_ReplayCallback_Failed() {
+	req := &billingpb.PaymentNotifyRequest{OrderId: primitive.NewObjectID().Hex()}
+	_ = suite.service.PaymentCallbackProcess(context.TODO(), req, &billingpb.PaymentNotifyResponse{})
+	entry := suite.getJournalEntry(internalPkg.CallbackJournalTypePayment, req.OrderId)
+
+	rsp := &internalPkg.ReplayCallbackResponse{}
+	err := suite.service.ReplayCallback(context.TODO(), &internalPkg.ReplayCallbackRequest{Id: entry.Id}, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusSystemError, rsp.Status)
+	assert.Equal(suite.T(), callbackJournalErrorReplayFailed, rsp.Message)
+	assert.Equal(suite.T(), internalPkg.CallbackJournalStatusFailed, rsp.Item.Status)
+	assert.EqualValues(suite.T(), 1, rsp.Item.ReplayCount)
+}
+
+func (suite *CallbackJournalTestSuite) TestCallbackJournal_LockAccountingSource() {
+	sourceId := primitive.NewObjectID().Hex()
+	unlock, err := suite.service.lockAccountingSource(context.TODO(), repository.CollectionOrder, sourceId)
+	assert.NoError(suite.T(), err)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*redisLockWaitInterval)
+	defer cancel()
+
+	_, err = suite.service.lockAccountingSource(ctx, repository.CollectionOrder, sourceId)
+	assert.Equal(suite.T(), callbackJournalErrorAccountingLocked, err)
+
+	unlock()
+
+	unlock, err = suite.service.lockAccountingSource(context.TODO(), repository.CollectionOrder, sourceId)
+	assert.NoError(suite.T(), err)
+	unlock()
+}
+
+func (suite *CallbackJournalTestSuite) TestCallbackJournal_FinishCallbackJournalEntry_Skipped() {
+	entry := suite.service.newCallbackJournalEntry(context.TODO(), internalPkg.CallbackJournalTypePayment, "", []byte("{}"), "")
+	rsp := &billingpb.PaymentNotifyResponse{Status: pkg.StatusTemporary, Error: "skipped"}
+	suite.service.finishCallbackJournalEntry(context.TODO(), entry, rsp, nil)
+
+	entry, err := suite.service.callbackJournalRepository.GetById(context.TODO(), entry.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.CallbackJournalStatusSkipped, entry.Status)
+	assert.Equal(suite.T(), pkg.StatusTemporary, entry.ResponseStatus)
+}
+
+func (suite *CallbackJournalTestSuite) getJournalEntry(callbackType, orderId string) *internalPkg.CallbackJournalEntry {
+	req := &internalPkg.ListCallbackJournalRequest{Type: callbackType, OrderId: orderId}
+	rsp := &internalPkg.ListCallbackJournalResponse{}
+	err := suite.service.ListCallbackJournal(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.EqualValues(suite.T(), 1, rsp.Count)
+	assert.Len(suite.T(), rsp.Items, 1)
+
+	return rsp.Items[0]
+}
+
+// failCallback marks processed callback as failed, like processing of it was interrupted halfway
+func (suite *CallbackJournalTestSuite) failCallback(entry *internalPkg.CallbackJournalEntry) {
+	h, err := suite.service.paymentSystemGateway.getGateway(entry.Handler)
+	assert.NoError(suite.T(), err)
+
+	var data proto.Message
+
+	if entry.Type == internalPkg.CallbackJournalTypePayment {
+		data, err = h.DecodePaymentCallback(entry.Body)
+	} else {
+		data, err = h.DecodeRefundCallback(entry.Body)
+	}
+
+	assert.NoError(suite.T(), err)
+
+	transactionId, status := h.GetCallbackTransaction(data)
+	id := fmt.Sprintf(callbackTransactionIdMask, entry.Handler, entry.Type, transactionId, status)
+	err = suite.service.callbackTransactionRepository.Delete(context.TODO(), id)
+	assert.NoError(suite.T(), err)
+
+	entry.Status = internalPkg.CallbackJournalStatusFailed
+	err = suite.service.callbackJournalRepository.Update(context.TODO(), entry)
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *CallbackJournalTestSuite) getAccountingEntriesCount(sourceType, sourceId string) int64 {
+	oid, err := primitive.ObjectIDFromHex(sourceId)
+	assert.NoError(suite.T(), err)
+
+	query := bson.M{"source.id": oid, "source.type": sourceType}
+	count, err := suite.service.db.Collection(collectionAccountingEntry).CountDocuments(context.TODO(), query)
+	assert.NoError(suite.T(), err)
+
+	return count
+}
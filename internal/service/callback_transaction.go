@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"github.com/paysuper/paysuper-proto/go/recurringpb"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	callbackTransactionIdMask = "%s:%s:%s:%s"
+
+	// processing of notification which wasn't finished during the ttl is considered as died
+	// and notification can be processed again
+	callbackTransactionLockTtl      = time.Minute
+	callbackTransactionWaitTimeout  = 5 * time.Second
+	callbackTransactionWaitInterval = 100 * time.Millisecond
+)
+
+var (
+	callbackTransactionErrorDuplicate  = newBillingServerErrorMsg("ct000001", "notification about transaction in the same status is already processed")
+	callbackTransactionErrorConflict   = newBillingServerErrorMsg("ct000002", "notification conflicts with final status of transaction received earlier and is flagged for review")
+	callbackTransactionErrorInProgress = newBillingServerErrorMsg("ct000003", "notification about transaction in the same status is processing now")
+
+	orderFinalPrivateStatuses = map[int32]bool{
+		recurringpb.OrderStatusPaymentSystemComplete: true,
+		recurringpb.OrderStatusPaymentSystemDeclined: true,
+		recurringpb.OrderStatusPaymentSystemCanceled: true,
+		recurringpb.OrderStatusRefund:                true,
+		recurringpb.OrderStatusChargeback:            true,
+		pkg.OrderStatusPaymentSystemVoided:           true,
+	}
+	refundFinalStatuses = map[int32]bool{
+		pkg.RefundStatusCompleted:             true,
+		pkg.RefundStatusPaymentSystemDeclined: true,
+		pkg.RefundStatusPaymentSystemCanceled: true,
+	}
+)
+
+// claimCallbackTransaction acquires processing of notification about transaction in payment system, so repeated
+// and concurrent notifications about transaction in the same status are processed only once.
+// Nil is returned without error if notification doesn't contain identifier of transaction.
+// Error callbackTransactionErrorDuplicate is returned with result of the notification processed earlier
+// and callbackTransactionErrorConflict is returned if transaction already got other final status.
+func (s *Service) claimCallbackTransaction(
+	ctx context.Context,
+	entry *internalPkg.CallbackJournalEntry,
+	handler, transactionId, status string,
+) (*internalPkg.CallbackTransaction, error) {
+	if transactionId == "" {
+		return nil, nil
+	}
+
+	now := time.Now()
+	tx := &internalPkg.CallbackTransaction{
+		Id:                fmt.Sprintf(callbackTransactionIdMask, handler, entry.Type, transactionId, status),
+		Handler:           handler,
+		Type:              entry.Type,
+		TransactionId:     transactionId,
+		Status:            status,
+		State:             internalPkg.CallbackTransactionStateProcessing,
+		CallbackJournalId: entry.Id,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+
+	txs, err := s.callbackTransactionRepository.FindByTransactionId(ctx, handler, entry.Type, transactionId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range txs {
+		if v.Id == tx.Id || v.State != internalPkg.CallbackTransactionStateProcessed || !v.IsFinal {
+			continue
+		}
+
+		zap.L().Warn(
+			callbackTransactionErrorConflict.Message,
+			zap.String("handler", handler),
+			zap.String("transaction_id", transactionId),
+			zap.String("status", status),
+			zap.String("final_status", v.Status),
+			zap.String("callback_id", entry.Id),
+		)
+
+		tx.State = internalPkg.CallbackTransactionStateConflict
+		tx.ResponseError = callbackTransactionErrorConflict.Message
+		_, _ = s.callbackTransactionRepository.Claim(ctx, tx)
+
+		return tx, callbackTransactionErrorConflict
+	}
+
+	deadline := now.Add(callbackTransactionWaitTimeout)
+
+	for {
+		ok, err := s.callbackTransactionRepository.Claim(ctx, tx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			return tx, nil
+		}
+
+		existing, err := s.callbackTransactionRepository.GetById(ctx, tx.Id)
+
+		if err == mongo.ErrNoDocuments {
+			// processing of other notification failed and lock was released
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch existing.State {
+		case internalPkg.CallbackTransactionStateProcessed:
+			return existing, callbackTransactionErrorDuplicate
+		case internalPkg.CallbackTransactionStateConflict:
+			return existing, callbackTransactionErrorConflict
+		}
+
+		tx.UpdatedAt = time.Now()
+		ok, err = s.callbackTransactionRepository.Reclaim(ctx, tx, tx.UpdatedAt.Add(-callbackTransactionLockTtl))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			return tx, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, callbackTransactionErrorInProgress
+		}
+
+		time.Sleep(callbackTransactionWaitInterval)
+	}
+}
+
+// finishCallbackTransaction saves result of notification processing, so repeated notifications get the same response.
+// Lock of notification which processing failed is released to allow payment system to send it again.
+func (s *Service) finishCallbackTransaction(
+	ctx context.Context,
+	tx *internalPkg.CallbackTransaction,
+	rsp *billingpb.PaymentNotifyResponse,
+	err error,
+	isFinal bool,
+) {
+	if tx == nil || tx.State != internalPkg.CallbackTransactionStateProcessing {
+		return
+	}
+
+	okStatus, _ := getCallbackResponseStatuses(tx.Type)
+
+	if err != nil || (rsp.Status != okStatus && rsp.Status != pkg.StatusTemporary) {
+		_ = s.callbackTransactionRepository.Delete(ctx, tx.Id)
+		return
+	}
+
+	tx.State = internalPkg.CallbackTransactionStateProcessed
+	tx.IsFinal = isFinal
+	tx.ResponseStatus = rsp.Status
+	tx.ResponseError = rsp.Error
+	tx.UpdatedAt = time.Now()
+
+	_ = s.callbackTransactionRepository.Update(ctx, tx)
+}
+
+// setCallbackTransactionResponse fills response to notification which wasn't processed by idempotency check.
+// Conflicting notification is confirmed to payment system to stop its resending, order isn't changed by it.
+func (s *Service) setCallbackTransactionResponse(
+	entry *internalPkg.CallbackJournalEntry,
+	tx *internalPkg.CallbackTransaction,
+	rsp *billingpb.PaymentNotifyResponse,
+	err error,
+) {
+	okStatus, errorStatus := getCallbackResponseStatuses(entry.Type)
+
+	switch err {
+	case callbackTransactionErrorDuplicate:
+		entry.Status = internalPkg.CallbackJournalStatusDuplicate
+		rsp.Status = tx.ResponseStatus
+		rsp.Error = tx.ResponseError
+	case callbackTransactionErrorConflict:
+		entry.Status = internalPkg.CallbackJournalStatusConflict
+		rsp.Status = okStatus
+		rsp.Error = callbackTransactionErrorConflict.Message
+	default:
+		rsp.Status = errorStatus
+		rsp.Error = err.Error()
+	}
+}
+
+func getCallbackResponseStatuses(callbackType string) (int32, int32) {
+	if callbackType == internalPkg.CallbackJournalTypeRefund {
+		return billingpb.ResponseStatusOk, billingpb.ResponseStatusSystemError
+	}
+
+	return pkg.StatusOK, pkg.StatusErrorSystem
+}
@@ -0,0 +1,352 @@
+package service
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/go-redis/redis"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/mongodb"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	"github.com/paysuper/paysuper-billing-server/internal/database"
+	"github.com/paysuper/paysuper-billing-server/internal/mocks"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	casbinMocks "github.com/paysuper/paysuper-proto/go/casbinpb/mocks"
+	"github.com/paysuper/paysuper-proto/go/recurringpb"
+	reportingMocks "github.com/paysuper/paysuper-proto/go/reporterpb/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	rabbitmq "gopkg.in/ProtocolONE/rabbitmq.v1/pkg"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"sync"
+	"testing"
+	"time"
+)
+
+type CallbackTransactionTestSuite struct {
+	suite.Suite
+	service *Service
+	log     *zap.Logger
+	cache   database.CacheInterface
+
+	merchant      *billingpb.Merchant
+	project       *billingpb.Project
+	paymentMethod *billingpb.PaymentMethod
+	paymentSystem *billingpb.PaymentSystem
+}
+
+func Test_CallbackTransaction(t *testing.T) {
+	suite.Run(t, new(CallbackTransactionTestSuite))
+}
+
+func (suite *CallbackTransactionTestSuite) SetupTest() {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		suite.FailNow("Config load failed", "%v", err)
+	}
+	cfg.CardPayApiUrl = "https://sandbox.cardpay.com"
+
+	m, err := migrate.New(
+		"file://../../migrations/tests",
+		cfg.MongoDsn)
+	assert.NoError(suite.T(), err, "Migrate init failed")
+
+	err = m.Up()
+	if err != nil && err.Error() != "no change" {
+		suite.FailNow("Migrations failed", "%v", err)
+	}
+
+	ctx, _ := context.WithTimeout(context.Background(), 50*time.Second)
+	opts := []mongodb.Option{mongodb.Context(ctx)}
+	db, err := mongodb.NewDatabase(opts...)
+	if err != nil {
+		suite.FailNow("Database connection failed", "%v", err)
+	}
+
+	suite.log, err = zap.NewProduction()
+
+	if err != nil {
+		suite.FailNow("Logger initialization failed", "%v", err)
+	}
+
+	broker, err := rabbitmq.NewBroker(cfg.BrokerAddress)
+
+	if err != nil {
+		suite.FailNow("Creating RabbitMQ publisher failed", "%v", err)
+	}
+
+	redisClient := database.NewRedis(
+		&redis.Options{
+			Addr:     cfg.RedisHost,
+			Password: cfg.RedisPassword,
+		},
+	)
+
+	redisdb := mocks.NewTestRedis()
+	suite.cache, err = database.NewCacheRedis(redisdb, "cache")
+	suite.service = NewBillingService(
+		db,
+		cfg,
+		mocks.NewGeoIpServiceTestOk(),
+		mocks.NewRepositoryServiceOk(),
+		mocks.NewTaxServiceOkMock(),
+		broker,
+		redisClient,
+		suite.cache,
+		mocks.NewCurrencyServiceMockOk(),
+		mocks.NewDocumentSignerMockOk(),
+		&reportingMocks.ReporterService{},
+		mocks.NewFormatterOK(),
+		mocks.NewBrokerMockOk(),
+		&casbinMocks.CasbinService{},
+	)
+
+	if err := suite.service.Init(); err != nil {
+		suite.FailNow("Billing service initialization failed", "%v", err)
+	}
+
+	suite.merchant, suite.project, suite.paymentMethod, suite.paymentSystem = helperCreateEntitiesForTests(suite.Suite, suite.service)
+}
+
+func (suite *CallbackTransactionTestSuite) TearDownTest() {
+	err := suite.service.db.Drop()
+
+	if err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	err = suite.service.db.Close()
+
+	if err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *CallbackTransactionTestSuite) TestCallbackTransaction_PaymentCallbackProcess_Duplicate() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	callback := suite.getPaymentCallback(order)
+	count := suite.getAccountingEntriesCount(order.Id)
+
+	req := suite.getPaymentNotifyRequest(order, callback)
+	rsp := &billingpb.PaymentNotifyResponse{}
+	err := suite.service.PaymentCallbackProcess(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), pkg.StatusOK, rsp.Status)
+	assert.Empty(suite.T(), rsp.Error)
+
+	assert.Equal(suite.T(), count, suite.getAccountingEntriesCount(order.Id))
+	assert.Equal(suite.T(), internalPkg.CallbackJournalStatusDuplicate, suite.getLastJournalEntry(order.Id).Status)
+}
+
+func (suite *CallbackTransactionTestSuite) TestCallbackTransaction_PaymentCallbackProcess_Concurrent() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	count := suite.getAccountingEntriesCount(order.Id)
+
+	// new transaction of the same order, so callbacks of it weren't processed yet
+	callback := suite.getPaymentCallback(order)
+	callback.PaymentData.Id = primitive.NewObjectID().Hex()
+	order.PrivateStatus = recurringpb.OrderStatusPaymentSystemCreate
+	err := suite.service.orderRepository.Update(context.TODO(), order)
+	assert.NoError(suite.T(), err)
+
+	_, err = suite.service.db.Collection(collectionAccountingEntry).DeleteMany(context.TODO(), bson.M{})
+	assert.NoError(suite.T(), err)
+
+	var wg sync.WaitGroup
+	statuses := make(chan int32, 5)
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			rsp := &billingpb.PaymentNotifyResponse{}
+			err := suite.service.PaymentCallbackProcess(context.TODO(), suite.getPaymentNotifyRequest(order, callback), rsp)
+			assert.NoError(suite.T(), err)
+			statuses <- rsp.Status
+		}()
+	}
+
+	wg.Wait()
+	close(statuses)
+
+	for status := range statuses {
+		assert.Equal(suite.T(), pkg.StatusOK, status)
+	}
+
+	assert.Equal(suite.T(), count, suite.getAccountingEntriesCount(order.Id))
+}
+
+func (suite *CallbackTransactionTestSuite) TestCallbackTransaction_PaymentCallbackProcess_Conflict() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	callback := suite.getPaymentCallback(order)
+	callback.PaymentData.Status = billingpb.CardPayPaymentResponseStatusDeclined
+
+	req := suite.getPaymentNotifyRequest(order, callback)
+	rsp := &billingpb.PaymentNotifyResponse{}
+	err := suite.service.PaymentCallbackProcess(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), pkg.StatusOK, rsp.Status)
+	assert.Equal(suite.T(), callbackTransactionErrorConflict.Message, rsp.Error)
+
+	order2, err := suite.service.orderRepository.GetById(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), recurringpb.OrderStatusPaymentSystemComplete, order2.PrivateStatus)
+	assert.Equal(suite.T(), internalPkg.CallbackJournalStatusConflict, suite.getLastJournalEntry(order.Id).Status)
+
+	txs, err := suite.service.callbackTransactionRepository.FindByTransactionId(
+		context.TODO(),
+		suite.paymentSystem.Handler,
+		internalPkg.CallbackJournalTypePayment,
+		callback.PaymentData.Id,
+	)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), txs, 2)
+	assert.Equal(suite.T(), internalPkg.CallbackTransactionStateProcessed, txs[0].State)
+	assert.True(suite.T(), txs[0].IsFinal)
+	assert.Equal(suite.T(), internalPkg.CallbackTransactionStateConflict, txs[1].State)
+}
+
+func (suite *CallbackTransactionTestSuite) TestCallbackTransaction_PaymentCallbackProcess_StaleLock() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	callback := suite.getPaymentCallback(order)
+	callback.PaymentData.Id = primitive.NewObjectID().Hex()
+
+	// processing of callback died and didn't release the lock
+	updatedAt := time.Now().Add(-2 * callbackTransactionLockTtl)
+	tx := &internalPkg.CallbackTransaction{
+		Id:            suite.getCallbackTransactionId(callback),
+		Handler:       suite.paymentSystem.Handler,
+		Type:          internalPkg.CallbackJournalTypePayment,
+		TransactionId: callback.PaymentData.Id,
+		Status:        callback.PaymentData.Status,
+		State:         internalPkg.CallbackTransactionStateProcessing,
+		CreatedAt:     updatedAt,
+		UpdatedAt:     updatedAt,
+	}
+	ok, err := suite.service.callbackTransactionRepository.Claim(context.TODO(), tx)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	rsp := &billingpb.PaymentNotifyResponse{}
+	err = suite.service.PaymentCallbackProcess(context.TODO(), suite.getPaymentNotifyRequest(order, callback), rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), pkg.StatusOK, rsp.Status)
+
+	tx, err = suite.service.callbackTransactionRepository.GetById(context.TODO(), tx.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.CallbackTransactionStateProcessed, tx.State)
+}
+
+func (suite *CallbackTransactionTestSuite) TestCallbackTransaction_PaymentCallbackProcess_InvalidSignature() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	callback := suite.getPaymentCallback(order)
+	callback.PaymentData.Id = primitive.NewObjectID().Hex()
+
+	req := suite.getPaymentNotifyRequest(order, callback)
+	req.Signature = "invalid_signature"
+	rsp := &billingpb.PaymentNotifyResponse{}
+	err := suite.service.PaymentCallbackProcess(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), pkg.StatusErrorValidation, rsp.Status)
+
+	// forged notification doesn't claim transaction
+	_, err = suite.service.callbackTransactionRepository.GetById(context.TODO(), suite.getCallbackTransactionId(callback))
+	assert.Equal(suite.T(), mongo.ErrNoDocuments, err)
+}
+
+func (suite *CallbackTransactionTestSuite) TestCallbackTransaction_ProcessRefundCallback_Duplicate() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	refund := helperMakeRefund(suite.Suite, suite.service, order, 10, false)
+
+	req := &internalPkg.ListCallbackJournalRequest{Type: internalPkg.CallbackJournalTypeRefund, OrderId: order.Id}
+	entries, err := suite.service.callbackJournalRepository.Find(context.TODO(), req)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), entries, 1)
+
+	cbReq := &billingpb.CallbackRequest{
+		Handler:   entries[0].Handler,
+		Body:      entries[0].Body,
+		Signature: entries[0].Signature,
+	}
+	rsp := &billingpb.PaymentNotifyResponse{}
+	err = suite.service.ProcessRefundCallback(context.TODO(), cbReq, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	entries, err = suite.service.callbackJournalRepository.Find(context.TODO(), req)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), entries, 2)
+	assert.Equal(suite.T(), internalPkg.CallbackJournalStatusDuplicate, entries[0].Status)
+	assert.Equal(suite.T(), refund.Id, entries[1].RefundId)
+}
+
+func (suite *CallbackTransactionTestSuite) TestCallbackTransaction_ClaimCallbackTransaction_WithoutTransactionId() {
+	entry := &internalPkg.CallbackJournalEntry{Id: primitive.NewObjectID().Hex(), Type: internalPkg.CallbackJournalTypePayment}
+	tx, err := suite.service.claimCallbackTransaction(context.TODO(), entry, paymentSystemHandlerMockOk, "", "")
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), tx)
+}
+
+func (suite *CallbackTransactionTestSuite) getPaymentCallback(order *billingpb.Order) *billingpb.CardPayPaymentCallback {
+	req := &internalPkg.ListCallbackJournalRequest{Type: internalPkg.CallbackJournalTypePayment, OrderId: order.Id}
+	entries, err := suite.service.callbackJournalRepository.Find(context.TODO(), req)
+	assert.NoError(suite.T(), err)
+	assert.NotEmpty(suite.T(), entries)
+
+	callback := &billingpb.CardPayPaymentCallback{}
+	err = json.Unmarshal(entries[len(entries)-1].Body, callback)
+	assert.NoError(suite.T(), err)
+
+	return callback
+}
+
+func (suite *CallbackTransactionTestSuite) getPaymentNotifyRequest(
+	order *billingpb.Order,
+	callback *billingpb.CardPayPaymentCallback,
+) *billingpb.PaymentNotifyRequest {
+	buf, err := json.Marshal(callback)
+	assert.NoError(suite.T(), err)
+
+	hash := sha512.New()
+	hash.Write([]byte(string(buf) + order.PaymentMethod.Params.SecretCallback))
+
+	return &billingpb.PaymentNotifyRequest{
+		OrderId:   order.Id,
+		Request:   buf,
+		Signature: hex.EncodeToString(hash.Sum(nil)),
+	}
+}
+
+func (suite *CallbackTransactionTestSuite) getCallbackTransactionId(callback *billingpb.CardPayPaymentCallback) string {
+	return suite.paymentSystem.Handler + ":" + internalPkg.CallbackJournalTypePayment + ":" +
+		callback.PaymentData.Id + ":" + callback.PaymentData.Status
+}
+
+func (suite *CallbackTransactionTestSuite) getLastJournalEntry(orderId string) *internalPkg.CallbackJournalEntry {
+	req := &internalPkg.ListCallbackJournalRequest{Type: internalPkg.CallbackJournalTypePayment, OrderId: orderId, Limit: 1}
+	entries, err := suite.service.callbackJournalRepository.Find(context.TODO(), req)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), entries, 1)
+
+	return entries[0]
+}
+
+func (suite *CallbackTransactionTestSuite) getAccountingEntriesCount(orderId string) int64 {
+	oid, err := primitive.ObjectIDFromHex(orderId)
+	assert.NoError(suite.T(), err)
+
+	count, err := suite.service.db.Collection(collectionAccountingEntry).CountDocuments(context.TODO(), bson.M{"source.id": oid})
+	assert.NoError(suite.T(), err)
+
+	return count
+}
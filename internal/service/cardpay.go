@@ -7,19 +7,20 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 	"github.com/paysuper/paysuper-billing-server/pkg"
 	"github.com/paysuper/paysuper-proto/go/billingpb"
 	"github.com/paysuper/paysuper-proto/go/recurringpb"
 	tools "github.com/paysuper/paysuper-tools/string"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.uber.org/zap"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 )
 
@@ -37,9 +38,27 @@ const (
 
 	cardPayMaxItemNameLength        = 50
 	cardPayMaxItemDescriptionLength = 200
+
+	cardPayTokenLockTtl          = 30 * time.Second
+	cardPayTokenLockWaitInterval = 100 * time.Millisecond
+	cardPayTokenLockAttempts     = 50
+
+	cardPayOperationChangeStatus = "CHANGE_STATUS"
+	cardPayStatusToComplete      = "COMPLETE"
+	cardPayStatusToReverse       = "REVERSE"
+	cardPayPaymentStatusVoided   = "VOIDED"
 )
 
 var (
+	cardPayPaymentMethodGroups = []string{
+		recurringpb.PaymentSystemGroupAliasBankCard,
+		recurringpb.PaymentSystemGroupAliasQiwi,
+		recurringpb.PaymentSystemGroupAliasWebMoney,
+		recurringpb.PaymentSystemGroupAliasNeteller,
+		recurringpb.PaymentSystemGroupAliasAlipay,
+		recurringpb.PaymentSystemGroupAliasBitcoin,
+	}
+
 	successRefundResponseStatuses = map[string]bool{
 		billingpb.CardPayPaymentResponseStatusAuthorized: true,
 		billingpb.CardPayPaymentResponseStatusInProgress: true,
@@ -47,12 +66,16 @@ var (
 		billingpb.CardPayPaymentResponseStatusRefunded:   true,
 		billingpb.CardPayPaymentResponseStatusCompleted:  true,
 	}
+
+	cardPayTwoStepPaymentStatuses = map[string]bool{
+		billingpb.CardPayPaymentResponseStatusAuthorized: true,
+		cardPayPaymentStatusVoided:                       true,
+	}
 )
 
 type cardPay struct {
-	mu         sync.Mutex
 	httpClient *http.Client
-	tokens     map[string]*cardPayToken
+	tokenStore PaymentSystemTokenStoreInterface
 }
 
 type cardPayTransport struct {
@@ -93,6 +116,7 @@ type CardPayPaymentData struct {
 	Amount     float64 `json:"amount"`
 	Descriptor string  `json:"dynamic_descriptor"`
 	Note       string  `json:"note"`
+	Preauth    bool    `json:"preauth,omitempty"`
 }
 
 type CardPayRecurringData struct {
@@ -230,14 +254,29 @@ type CardPayRefundResponse struct {
 	EwalletAccount interface{}                       `json:"ewallet_account,omitempty"`
 }
 
+type CardPayChangeStatusPaymentData struct {
+	StatusTo string  `json:"status_to"`
+	Amount   float64 `json:"amount,omitempty"`
+}
+
+type CardPayChangeStatusRequest struct {
+	Request     *CardPayRequest                 `json:"request"`
+	Operation   string                          `json:"operation"`
+	PaymentData *CardPayChangeStatusPaymentData `json:"payment_data"`
+}
+
 func (m *CardPayRefundResponse) IsSuccessStatus() bool {
 	v, ok := successRefundResponseStatuses[m.RefundData.Status]
 	return ok && v == true
 }
 
+func init() {
+	RegisterPaymentSystemHandler(billingpb.PaymentSystemHandlerCardPay, newCardPayHandler)
+}
+
 func newCardPayHandler() Gate {
 	return &cardPay{
-		tokens: make(map[string]*cardPayToken),
+		tokenStore: newPaymentSystemTokenMemoryStore(),
 		httpClient: &http.Client{
 			Transport: &cardPayTransport{},
 			Timeout:   defaultHttpClientTimeout * time.Second,
@@ -249,6 +288,36 @@ func (h *cardPay) CreatePayment(
 	order *billingpb.Order,
 	successUrl, failUrl string,
 	requisites map[string]string,
+) (string, error) {
+	return h.createPayment(order, successUrl, failUrl, requisites, false)
+}
+
+func (h *cardPay) AuthorizePayment(
+	order *billingpb.Order,
+	successUrl, failUrl string,
+	requisites map[string]string,
+) (string, error) {
+	// CardPay supports preauthorization for bank cards only
+	if order.PaymentMethod.ExternalId != recurringpb.PaymentSystemGroupAliasBankCard {
+		return "", paymentSystemErrorTwoStepNotSupported
+	}
+
+	return h.createPayment(order, successUrl, failUrl, requisites, true)
+}
+
+func (h *cardPay) CapturePayment(order *billingpb.Order, amount float64) error {
+	return h.changePaymentStatus(order, cardPayStatusToComplete, amount)
+}
+
+func (h *cardPay) VoidPayment(order *billingpb.Order) error {
+	return h.changePaymentStatus(order, cardPayStatusToReverse, 0)
+}
+
+func (h *cardPay) createPayment(
+	order *billingpb.Order,
+	successUrl, failUrl string,
+	requisites map[string]string,
+	preauth bool,
 ) (string, error) {
 	err := h.auth(order)
 
@@ -262,6 +331,15 @@ func (h *cardPay) CreatePayment(
 		return "", nil
 	}
 
+	if preauth {
+		// recurring payments can't be preauthorized
+		if request.PaymentData == nil {
+			return "", paymentSystemErrorTwoStepNotSupported
+		}
+
+		request.PaymentData.Preauth = true
+	}
+
 	action := pkg.PaymentSystemActionCreatePayment
 
 	if request.RecurringData != nil {
@@ -292,6 +370,11 @@ func (h *cardPay) CreatePayment(
 	}
 
 	token := h.getToken(order)
+
+	if token == nil {
+		return "", paymentSystemErrorAuthenticateFailed
+	}
+
 	auth := strings.Title(token.TokenType) + " " + token.AccessToken
 
 	req.Header.Add(HeaderContentType, MIMEApplicationJSON)
@@ -387,7 +470,7 @@ func (h *cardPay) ProcessPayment(order *billingpb.Order, message proto.Message,
 		return err
 	}
 
-	if !req.IsPaymentAllowedStatus() {
+	if !req.IsPaymentAllowedStatus() && !cardPayTwoStepPaymentStatuses[req.GetStatus()] {
 		return newBillingServerResponseError(pkg.StatusErrorValidation, paymentSystemErrorRequestStatusIsInvalid)
 	}
 
@@ -449,6 +532,13 @@ func (h *cardPay) ProcessPayment(order *billingpb.Order, message proto.Message,
 		order.PrivateStatus = recurringpb.OrderStatusPaymentSystemComplete
 		order.IsRefundAllowed = order.PaymentMethod.RefundAllowed
 		break
+	case billingpb.CardPayPaymentResponseStatusAuthorized:
+		order.PrivateStatus = pkg.OrderStatusPaymentSystemAuthorized
+		break
+	case cardPayPaymentStatusVoided:
+		order.PrivateStatus = pkg.OrderStatusPaymentSystemVoided
+		order.CanceledAt = ptypes.TimestampNow()
+		break
 	default:
 		return newBillingServerResponseError(pkg.StatusTemporary, paymentSystemErrorRequestTemporarySkipped)
 	}
@@ -485,6 +575,30 @@ func (h *cardPay) GetRecurringId(request proto.Message) string {
 	return request.(*billingpb.CardPayPaymentCallback).RecurringData.Filing.Id
 }
 
+func (h *cardPay) DecodePaymentCallback(raw []byte) (proto.Message, error) {
+	return decodeCardPayPaymentCallback(raw)
+}
+
+func (h *cardPay) DecodeRefundCallback(raw []byte) (proto.Message, error) {
+	return decodeCardPayRefundCallback(raw)
+}
+
+func (h *cardPay) GetRefundId(request proto.Message) string {
+	return request.(*billingpb.CardPayRefundCallback).MerchantOrder.Id
+}
+
+func (h *cardPay) CheckCallbackSignature(order *billingpb.Order, raw, signature string) error {
+	return h.checkCallbackRequestSignature(order, raw, signature)
+}
+
+func (h *cardPay) GetCallbackTransaction(request proto.Message) (string, string) {
+	return getCardPayCallbackTransaction(request)
+}
+
+func (h *cardPay) GetPaymentMethodGroups() []string {
+	return cardPayPaymentMethodGroups
+}
+
 func (h *cardPay) auth(order *billingpb.Order) error {
 	if token := h.getToken(order); token != nil {
 		return nil
@@ -549,7 +663,7 @@ func (h *cardPay) auth(order *billingpb.Order) error {
 		return err
 	}
 
-	err = h.setToken(b, order.PaymentMethod.ExternalId)
+	err = h.setToken(b, h.getTokenKey(order))
 
 	if err != nil {
 		return err
@@ -558,11 +672,11 @@ func (h *cardPay) auth(order *billingpb.Order) error {
 	return nil
 }
 
-func (h *cardPay) refresh(order *billingpb.Order) error {
+func (h *cardPay) refresh(order *billingpb.Order, token *cardPayToken) error {
 	data := url.Values{
 		cardPayRequestFieldGrantType:    []string{cardPayGrantTypeRefreshToken},
 		cardPayRequestFieldTerminalCode: []string{order.PaymentMethod.Params.TerminalId},
-		cardPayRequestFieldRefreshToken: []string{h.tokens[order.PaymentMethod.ExternalId].RefreshToken},
+		cardPayRequestFieldRefreshToken: []string{token.RefreshToken},
 	}
 
 	qUrl, err := h.getUrl(order.GetPaymentSystemApiUrl(), pkg.PaymentSystemActionRefresh)
@@ -602,14 +716,14 @@ func (h *cardPay) refresh(order *billingpb.Order) error {
 		return err
 	}
 
-	if err := h.setToken(b, order.PaymentMethod.ExternalId); err != nil {
+	if err := h.setToken(b, h.getTokenKey(order)); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (h *cardPay) getUrl(apiUrl, action string) (string, error) {
+func (h *cardPay) getUrl(apiUrl, action string, args ...interface{}) (string, error) {
 	u, err := url.ParseRequestURI(apiUrl)
 
 	if err != nil {
@@ -623,11 +737,23 @@ func (h *cardPay) getUrl(apiUrl, action string) (string, error) {
 
 	u.Path = pkg.CardPayPaths[action].Path
 
+	if len(args) > 0 {
+		u.Path = fmt.Sprintf(u.Path, args...)
+	}
+
 	return u.String(), nil
 }
 
-func (h *cardPay) setToken(b []byte, pmKey string) error {
-	h.mu.Lock()
+func (h *cardPay) setTokenStore(store PaymentSystemTokenStoreInterface) {
+	h.tokenStore = store
+}
+
+// getTokenKey returns key of token in the token store, token is issued by CardPay for terminal.
+func (h *cardPay) getTokenKey(order *billingpb.Order) string {
+	return billingpb.PaymentSystemHandlerCardPay + ":" + order.PaymentMethod.Params.TerminalId
+}
+
+func (h *cardPay) setToken(b []byte, key string) error {
 	token := new(cardPayToken)
 	err := json.Unmarshal(b, &token)
 
@@ -635,39 +761,124 @@ func (h *cardPay) setToken(b []byte, pmKey string) error {
 		return err
 	}
 
-	token.AccessTokenExpireTime = time.Now().Add(time.Second * time.Duration(token.AccessTokenExpire))
-	token.RefreshTokenExpireTime = time.Now().Add(time.Second * time.Duration(token.RefreshTokenExpire))
+	now := time.Now()
+	token.AccessTokenExpireTime = now.Add(time.Second * time.Duration(token.AccessTokenExpire))
+	token.RefreshTokenExpireTime = now.Add(time.Second * time.Duration(token.RefreshTokenExpire))
 
-	h.tokens[pmKey] = token
-	h.mu.Unlock()
+	expire := token.RefreshTokenExpireTime.Sub(now)
 
-	return nil
+	if token.AccessTokenExpire > token.RefreshTokenExpire {
+		expire = token.AccessTokenExpireTime.Sub(now)
+	}
+
+	if expire <= 0 {
+		return paymentSystemErrorAuthenticateFailed
+	}
+
+	b, err = json.Marshal(token)
+
+	if err != nil {
+		return err
+	}
+
+	return h.tokenStore.Set(key, b, expire)
 }
 
-func (h *cardPay) getToken(order *billingpb.Order) *cardPayToken {
-	token, ok := h.tokens[order.PaymentMethod.ExternalId]
+func (h *cardPay) getStoredToken(key string) *cardPayToken {
+	b, err := h.tokenStore.Get(key)
 
-	if !ok {
+	if err != nil {
 		return nil
 	}
 
-	tn := time.Now().Unix()
+	token := new(cardPayToken)
 
-	if token.AccessTokenExpire > 0 && token.AccessTokenExpireTime.Unix() >= tn {
-		return token
+	if err = json.Unmarshal(b, token); err != nil {
+		zap.L().Error(
+			"cardpay API: stored token is invalid",
+			zap.Error(err),
+			zap.String("key", key),
+		)
+		return nil
 	}
 
-	if token.RefreshTokenExpire <= 0 || token.RefreshTokenExpireTime.Unix() < tn {
+	return token
+}
+
+func (h *cardPay) getToken(order *billingpb.Order) *cardPayToken {
+	key := h.getTokenKey(order)
+	token := h.getStoredToken(key)
+
+	if token == nil {
 		return nil
 	}
 
-	err := h.refresh(order)
+	if token.isAccessTokenValid() {
+		return token
+	}
 
-	if err != nil {
+	if !token.isRefreshTokenValid() {
 		return nil
 	}
 
-	return h.tokens[order.PaymentMethod.ExternalId]
+	return h.refreshToken(order, key)
+}
+
+// refreshToken refreshes token of terminal under distributed lock, so refresh token is used only once
+// when several instances of billing server found expired token at the same time. Instances which couldn't
+// acquire lock wait for the token refreshed by lock owner.
+func (h *cardPay) refreshToken(order *billingpb.Order, key string) *cardPayToken {
+	owner := primitive.NewObjectID().Hex()
+
+	for i := 0; i < cardPayTokenLockAttempts; i++ {
+		locked, err := h.tokenStore.Lock(key, owner, cardPayTokenLockTtl)
+
+		if err != nil {
+			return nil
+		}
+
+		if !locked {
+			time.Sleep(cardPayTokenLockWaitInterval)
+
+			if token := h.getStoredToken(key); token != nil && token.isAccessTokenValid() {
+				return token
+			}
+
+			continue
+		}
+
+		defer func() {
+			_ = h.tokenStore.Unlock(key, owner)
+		}()
+
+		// token could be refreshed by other instance between reading of token and acquiring of lock
+		token := h.getStoredToken(key)
+
+		if token == nil || token.isAccessTokenValid() {
+			return token
+		}
+
+		if !token.isRefreshTokenValid() || h.refresh(order, token) != nil {
+			return nil
+		}
+
+		return h.getStoredToken(key)
+	}
+
+	zap.L().Error(
+		"cardpay API: waiting of token refresh by other instance timed out",
+		zap.String("key", key),
+	)
+
+	return nil
+}
+
+func (t *cardPayToken) isAccessTokenValid() bool {
+	return t.AccessTokenExpire > 0 && t.AccessTokenExpireTime.After(time.Now())
+}
+
+func (t *cardPayToken) isRefreshTokenValid() bool {
+	return t.RefreshTokenExpire > 0 && t.RefreshTokenExpireTime.After(time.Now())
 }
 
 func (h *cardPay) getCardPayOrder(
@@ -934,6 +1145,11 @@ func (h *cardPay) CreateRefund(order *billingpb.Order, refund *billingpb.Refund)
 	}
 
 	token := h.getToken(order)
+
+	if token == nil {
+		return errors.New(pkg.PaymentSystemErrorCreateRefundFailed)
+	}
+
 	auth := strings.Title(token.TokenType) + " " + token.AccessToken
 
 	req.Header.Add(HeaderContentType, MIMEApplicationJSON)
@@ -1002,6 +1218,90 @@ func (h *cardPay) CreateRefund(order *billingpb.Order, refund *billingpb.Refund)
 	return nil
 }
 
+// changePaymentStatus captures or reverses (voids) preauthorized payment. Amount is used for capture only,
+// zero amount captures payment fully.
+func (h *cardPay) changePaymentStatus(order *billingpb.Order, statusTo string, amount float64) error {
+	err := h.auth(order)
+
+	if err != nil {
+		return err
+	}
+
+	u, err := h.getUrl(order.GetPaymentSystemApiUrl(), pkg.PaymentSystemActionChangeStatus, order.Transaction)
+
+	if err != nil {
+		return err
+	}
+
+	data := &CardPayChangeStatusRequest{
+		Request: &CardPayRequest{
+			Id:   primitive.NewObjectID().Hex(),
+			Time: time.Now().UTC().Format(cardPayDateFormat),
+		},
+		Operation: cardPayOperationChangeStatus,
+		PaymentData: &CardPayChangeStatusPaymentData{
+			StatusTo: statusTo,
+			Amount:   amount,
+		},
+	}
+
+	b, _ := json.Marshal(data)
+	req, err := http.NewRequest(pkg.CardPayPaths[pkg.PaymentSystemActionChangeStatus].Method, u, bytes.NewBuffer(b))
+
+	if err != nil {
+		zap.L().Error(
+			"cardpay API: create change payment status request failed",
+			zap.Error(err),
+			zap.String("method", pkg.CardPayPaths[pkg.PaymentSystemActionChangeStatus].Method),
+			zap.String("url", u),
+			zap.ByteString(pkg.LogFieldRequest, b),
+			zap.String("order_id", order.Id),
+		)
+		return err
+	}
+
+	token := h.getToken(order)
+
+	if token == nil {
+		return paymentSystemErrorAuthenticateFailed
+	}
+
+	req.Header.Add(HeaderContentType, MIMEApplicationJSON)
+	req.Header.Add(HeaderAuthorization, strings.Title(token.TokenType)+" "+token.AccessToken)
+
+	resp, err := h.httpClient.Do(req)
+
+	if err != nil {
+		zap.L().Error(
+			"cardpay API: send change payment status request failed",
+			zap.Error(err),
+			zap.String("url", u),
+			zap.ByteString(pkg.LogFieldRequest, b),
+			zap.String("order_id", order.Id),
+		)
+		return err
+	}
+
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			return
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		zap.L().Error(
+			"cardpay API: change payment status response returned with bad http status",
+			zap.Int("status", resp.StatusCode),
+			zap.String("url", u),
+			zap.ByteString(pkg.LogFieldRequest, b),
+			zap.String("order_id", order.Id),
+		)
+		return paymentSystemErrorChangeStatusFailed
+	}
+
+	return nil
+}
+
 func (h *cardPay) ProcessRefund(
 	order *billingpb.Order,
 	refund *billingpb.Refund,
@@ -1073,3 +1373,44 @@ func (h *CardPayOrderRecurringResponse) IsSuccessStatus() bool {
 	return status == billingpb.CardPayPaymentResponseStatusInProgress || status == billingpb.CardPayPaymentResponseStatusPending ||
 		status == billingpb.CardPayPaymentResponseStatusAuthorized || status == billingpb.CardPayPaymentResponseStatusCompleted
 }
+
+func decodeCardPayPaymentCallback(raw []byte) (proto.Message, error) {
+	data := &billingpb.CardPayPaymentCallback{}
+	err := json.Unmarshal(raw, data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func decodeCardPayRefundCallback(raw []byte) (proto.Message, error) {
+	data := &billingpb.CardPayRefundCallback{}
+	err := json.Unmarshal(raw, data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if data.RefundData == nil || data.MerchantOrder == nil {
+		return nil, errors.New(callbackRequestIncorrect)
+	}
+
+	return data, nil
+}
+
+func getCardPayCallbackTransaction(request proto.Message) (string, string) {
+	switch req := request.(type) {
+	case *billingpb.CardPayPaymentCallback:
+		return req.GetId(), req.GetStatus()
+	case *billingpb.CardPayRefundCallback:
+		if req.RefundData == nil {
+			return "", ""
+		}
+
+		return req.RefundData.Id, req.RefundData.Status
+	}
+
+	return "", ""
+}
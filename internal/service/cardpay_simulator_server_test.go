@@ -0,0 +1,627 @@
+package service
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	tools "github.com/paysuper/paysuper-tools/string"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CardPaySimulatorScenarioApprove         = "approve"
+	CardPaySimulatorScenarioDecline         = "decline"
+	CardPaySimulatorScenario3ds             = "3ds"
+	CardPaySimulatorScenarioDelayedCallback = "delayed_callback"
+	CardPaySimulatorScenarioRefundDecline   = "refund_decline"
+	CardPaySimulatorScenarioTokenExpired    = "token_expired"
+	CardPaySimulatorScenarioCaptureDecline  = "capture_decline"
+
+	CardPaySimulatorCallbackTypePayment = "payment"
+	CardPaySimulatorCallbackTypeRefund  = "refund"
+
+	cardPaySimulatorPath3ds            = "/3ds/"
+	cardPaySimulatorPathPayment        = "/api/payments/"
+	cardPaySimulatorTokenType          = "bearer"
+	cardPaySimulatorAccessTokenExpire  = 300
+	cardPaySimulatorRefreshTokenExpire = 900
+	cardPaySimulatorCallbackDelay      = time.Second
+	cardPaySimulatorDeclineCode        = "05"
+	cardPaySimulatorDeclineReason      = "Do not honor"
+)
+
+// CardPaySimulatorCallback is a callback prepared by simulator and signed with terminal callback secret.
+// Id is identifier of order for payment callback and identifier of refund for refund callback.
+type CardPaySimulatorCallback struct {
+	Type      string
+	Id        string
+	Body      []byte
+	Signature string
+	releaseAt time.Time
+}
+
+// CardPaySimulator is an in-process http server which imitates CardPay API to make possible testing
+// of the real cardpay handler without access to CardPay sandbox. Result of every payment is defined by scenario,
+// callbacks are not sent anywhere but queued to be passed to the billing server by test.
+type CardPaySimulator struct {
+	URL           string
+	CallbackDelay time.Duration
+
+	server        *httptest.Server
+	mx            sync.Mutex
+	scenario      string
+	scenarios     map[string]string
+	terminals     map[string]*cardPaySimulatorTerminal
+	accessTokens  map[string]*cardPaySimulatorToken
+	refreshTokens map[string]*cardPaySimulatorToken
+	payments      map[string]*cardPaySimulatorPayment
+	callbacks     []*CardPaySimulatorCallback
+	requests      map[string]int
+}
+
+type cardPaySimulatorTerminal struct {
+	secret         string
+	secretCallback string
+}
+
+type cardPaySimulatorToken struct {
+	terminalId string
+	expireAt   time.Time
+}
+
+type cardPaySimulatorPayment struct {
+	id         string
+	terminalId string
+	scenario   string
+	filingId   string
+	status     string
+	request    *CardPayOrder
+}
+
+func NewCardPaySimulator() *CardPaySimulator {
+	s := &CardPaySimulator{
+		CallbackDelay: cardPaySimulatorCallbackDelay,
+		scenario:      CardPaySimulatorScenarioApprove,
+		scenarios:     make(map[string]string),
+		terminals:     make(map[string]*cardPaySimulatorTerminal),
+		accessTokens:  make(map[string]*cardPaySimulatorToken),
+		refreshTokens: make(map[string]*cardPaySimulatorToken),
+		payments:      make(map[string]*cardPaySimulatorPayment),
+		requests:      make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(pkg.CardPayPaths[pkg.PaymentSystemActionAuthenticate].Path, s.handleAuth)
+	mux.HandleFunc(pkg.CardPayPaths[pkg.PaymentSystemActionCreatePayment].Path, s.handlePayment)
+	mux.HandleFunc(pkg.CardPayPaths[pkg.PaymentSystemActionRecurringPayment].Path, s.handlePayment)
+	mux.HandleFunc(pkg.CardPayPaths[pkg.PaymentSystemActionRefund].Path, s.handleRefund)
+	mux.HandleFunc(cardPaySimulatorPathPayment, s.handleChangeStatus)
+	mux.HandleFunc(cardPaySimulatorPath3ds, s.handle3ds)
+
+	s.server = httptest.NewServer(mux)
+	s.URL = s.server.URL
+
+	return s
+}
+
+func (s *CardPaySimulator) Close() {
+	s.server.Close()
+}
+
+// AddTerminal registers terminal credentials accepted by simulator.
+func (s *CardPaySimulator) AddTerminal(terminalId, secret, secretCallback string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.terminals[terminalId] = &cardPaySimulatorTerminal{secret: secret, secretCallback: secretCallback}
+}
+
+// AddPaymentMethodTerminals registers all terminals from test and production settings of payment method.
+func (s *CardPaySimulator) AddPaymentMethodTerminals(pm *billingpb.PaymentMethod) {
+	for _, settings := range []map[string]*billingpb.PaymentMethodParams{pm.TestSettings, pm.ProductionSettings} {
+		for _, v := range settings {
+			s.AddTerminal(v.TerminalId, v.Secret, v.SecretCallback)
+		}
+	}
+}
+
+// SetScenario sets scenario for all payments which haven't own scenario set by SetOrderScenario.
+func (s *CardPaySimulator) SetScenario(scenario string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.scenario = scenario
+}
+
+func (s *CardPaySimulator) SetOrderScenario(orderId, scenario string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.scenarios[orderId] = scenario
+}
+
+// Callbacks returns callbacks which are ready to be sent and removes them from queue.
+func (s *CardPaySimulator) Callbacks() []*CardPaySimulatorCallback {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	var ready, pending []*CardPaySimulatorCallback
+	now := time.Now()
+
+	for _, v := range s.callbacks {
+		if v.releaseAt.After(now) {
+			pending = append(pending, v)
+			continue
+		}
+
+		ready = append(ready, v)
+	}
+
+	s.callbacks = pending
+
+	return ready
+}
+
+// PendingCallbacks returns count of callbacks in queue including delayed callbacks.
+func (s *CardPaySimulator) PendingCallbacks() int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return len(s.callbacks)
+}
+
+// RequestsCount returns count of requests processed by simulator for path of CardPay API.
+func (s *CardPaySimulator) RequestsCount(path string) int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return s.requests[path]
+}
+
+func (s *CardPaySimulator) handleAuth(w http.ResponseWriter, r *http.Request) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.requests[r.URL.Path]++
+
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	terminalId := r.PostForm.Get(cardPayRequestFieldTerminalCode)
+	terminal, ok := s.terminals[terminalId]
+
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	accessTokenExpire := cardPaySimulatorAccessTokenExpire
+
+	switch r.PostForm.Get(cardPayRequestFieldGrantType) {
+	case cardPayGrantTypePassword:
+		if terminal.secret != r.PostForm.Get(cardPayRequestFieldPassword) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		// first access token expires immediately to make client refresh it before payment request
+		if s.scenario == CardPaySimulatorScenarioTokenExpired {
+			accessTokenExpire = 0
+		}
+		break
+	case cardPayGrantTypeRefreshToken:
+		refreshToken := r.PostForm.Get(cardPayRequestFieldRefreshToken)
+		token, ok := s.refreshTokens[refreshToken]
+
+		if !ok || token.terminalId != terminalId || token.expireAt.Before(time.Now()) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		delete(s.refreshTokens, refreshToken)
+		break
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	token := &cardPayToken{
+		TokenType:          cardPaySimulatorTokenType,
+		AccessToken:        primitive.NewObjectID().Hex(),
+		RefreshToken:       primitive.NewObjectID().Hex(),
+		AccessTokenExpire:  accessTokenExpire,
+		RefreshTokenExpire: cardPaySimulatorRefreshTokenExpire,
+	}
+	now := time.Now()
+	s.accessTokens[token.AccessToken] = &cardPaySimulatorToken{
+		terminalId: terminalId,
+		expireAt:   now.Add(time.Duration(accessTokenExpire) * time.Second),
+	}
+	s.refreshTokens[token.RefreshToken] = &cardPaySimulatorToken{
+		terminalId: terminalId,
+		expireAt:   now.Add(cardPaySimulatorRefreshTokenExpire * time.Second),
+	}
+
+	s.writeJson(w, http.StatusOK, token)
+}
+
+func (s *CardPaySimulator) handlePayment(w http.ResponseWriter, r *http.Request) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.requests[r.URL.Path]++
+	terminalId, ok := s.authorize(r)
+
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	req := &CardPayOrder{}
+
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil || req.MerchantOrder == nil ||
+		(req.PaymentData == nil && req.RecurringData == nil) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	scenario, ok := s.scenarios[req.MerchantOrder.Id]
+
+	if !ok {
+		scenario = s.scenario
+	}
+
+	payment := &cardPaySimulatorPayment{
+		id:         primitive.NewObjectID().Hex(),
+		terminalId: terminalId,
+		scenario:   scenario,
+		request:    req,
+	}
+
+	if req.RecurringData != nil {
+		payment.filingId = primitive.NewObjectID().Hex()
+
+		if req.RecurringData.Filing != nil {
+			payment.filingId = req.RecurringData.Filing.Id
+		}
+	}
+
+	s.payments[payment.id] = payment
+
+	// payment by saved card doesn't require customer actions and result is returned immediately
+	if req.RecurringData != nil && req.RecurringData.Filing != nil {
+		status := billingpb.CardPayPaymentResponseStatusInProgress
+
+		if scenario == CardPaySimulatorScenarioDecline {
+			status = billingpb.CardPayPaymentResponseStatusDeclined
+		}
+
+		s.addPaymentCallback(payment, scenario)
+		s.writeJson(w, http.StatusOK, &CardPayOrderRecurringResponse{
+			RecurringData: &CardPayOrderRecurringResponseRecurringData{
+				Id:       payment.id,
+				Filing:   &CardPayRecurringDataFiling{Id: payment.filingId},
+				Status:   status,
+				Amount:   req.RecurringData.Amount,
+				Currency: req.RecurringData.Currency,
+				Created:  time.Now().UTC().Format(cardPayDateFormat),
+			},
+		})
+		return
+	}
+
+	rsp := &CardPayOrderResponse{}
+
+	switch scenario {
+	case CardPaySimulatorScenario3ds:
+		rsp.RedirectUrl = s.URL + cardPaySimulatorPath3ds + payment.id
+		break
+	case CardPaySimulatorScenarioDecline:
+		rsp.RedirectUrl = req.ReturnUrls.DeclineUrl
+		s.addPaymentCallback(payment, scenario)
+		break
+	default:
+		rsp.RedirectUrl = req.ReturnUrls.SuccessUrl
+		s.addPaymentCallback(payment, scenario)
+	}
+
+	s.writeJson(w, http.StatusOK, rsp)
+}
+
+// handle3ds imitates customer passing 3-D Secure authentication by redirect url returned on payment creation.
+func (s *CardPaySimulator) handle3ds(w http.ResponseWriter, r *http.Request) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.requests[cardPaySimulatorPath3ds]++
+	payment, ok := s.payments[strings.TrimPrefix(r.URL.Path, cardPaySimulatorPath3ds)]
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	s.addPaymentCallback(payment, CardPaySimulatorScenarioApprove)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *CardPaySimulator) handleRefund(w http.ResponseWriter, r *http.Request) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.requests[r.URL.Path]++
+
+	if _, ok := s.authorize(r); !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	req := &CardPayRefundRequest{}
+
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil || req.MerchantOrder == nil ||
+		req.PaymentData == nil || req.RefundData == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	payment, ok := s.payments[req.PaymentData.Id]
+
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	refundId := primitive.NewObjectID().Hex()
+	created := time.Now().UTC().Format(cardPayDateFormat)
+	status := billingpb.CardPayPaymentResponseStatusCompleted
+
+	if payment.scenario == CardPaySimulatorScenarioRefundDecline || s.scenario == CardPaySimulatorScenarioRefundDecline {
+		status = billingpb.CardPayPaymentResponseStatusDeclined
+	}
+
+	s.addCallback(
+		CardPaySimulatorCallbackTypeRefund,
+		req.MerchantOrder.Id,
+		payment.terminalId,
+		&billingpb.CardPayRefundCallback{
+			MerchantOrder: &billingpb.CardPayMerchantOrder{Id: req.MerchantOrder.Id},
+			PaymentMethod: payment.request.PaymentMethod,
+			PaymentData: &billingpb.CardPayRefundCallbackPaymentData{
+				Id:              payment.id,
+				RemainingAmount: s.getPaymentAmount(payment) - req.RefundData.Amount,
+			},
+			RefundData: &billingpb.CardPayRefundCallbackRefundData{
+				Amount:   req.RefundData.Amount,
+				Created:  created,
+				Id:       refundId,
+				Currency: req.RefundData.Currency,
+				Status:   status,
+				AuthCode: primitive.NewObjectID().Hex(),
+				Rrn:      primitive.NewObjectID().Hex(),
+			},
+			CallbackTime: created,
+		},
+		time.Time{},
+	)
+
+	s.writeJson(w, http.StatusCreated, &CardPayRefundResponse{
+		PaymentMethod: payment.request.PaymentMethod,
+		MerchantOrder: req.MerchantOrder,
+		RefundData: &CardPayRefundResponseRefundData{
+			Id:       refundId,
+			Created:  created,
+			Status:   billingpb.CardPayPaymentResponseStatusInProgress,
+			Amount:   req.RefundData.Amount,
+			Currency: req.RefundData.Currency,
+		},
+		PaymentData: &CardPayRefundResponsePaymentData{Id: payment.id},
+	})
+}
+
+// handleChangeStatus captures or voids preauthorized payment. Capture is declined by capture_decline scenario.
+func (s *CardPaySimulator) handleChangeStatus(w http.ResponseWriter, r *http.Request) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.requests[cardPaySimulatorPathPayment]++
+
+	if r.Method != http.MethodPatch {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, ok := s.authorize(r); !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	req := &CardPayChangeStatusRequest{}
+
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil || req.Operation != cardPayOperationChangeStatus ||
+		req.PaymentData == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	payment, ok := s.payments[strings.TrimPrefix(r.URL.Path, cardPaySimulatorPathPayment)]
+
+	if !ok || payment.status != billingpb.CardPayPaymentResponseStatusAuthorized {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	amount := s.getPaymentAmount(payment)
+
+	switch req.PaymentData.StatusTo {
+	case cardPayStatusToComplete:
+		if payment.scenario == CardPaySimulatorScenarioCaptureDecline || req.PaymentData.Amount > amount {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if req.PaymentData.Amount > 0 {
+			amount = req.PaymentData.Amount
+		}
+
+		payment.status = billingpb.CardPayPaymentResponseStatusCompleted
+		break
+	case cardPayStatusToReverse:
+		payment.status = cardPayPaymentStatusVoided
+		break
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.queuePaymentCallback(payment, payment.status, amount, time.Time{})
+	s.writeJson(w, http.StatusOK, map[string]interface{}{
+		"payment_data": map[string]interface{}{
+			"id":     payment.id,
+			"status": payment.status,
+			"amount": amount,
+		},
+	})
+}
+
+func (s *CardPaySimulator) authorize(r *http.Request) (string, bool) {
+	auth := strings.SplitN(r.Header.Get(HeaderAuthorization), " ", 2)
+
+	if len(auth) != 2 || strings.ToLower(auth[0]) != cardPaySimulatorTokenType {
+		return "", false
+	}
+
+	token, ok := s.accessTokens[auth[1]]
+
+	if !ok || !token.expireAt.After(time.Now()) {
+		return "", false
+	}
+
+	return token.terminalId, true
+}
+
+func (s *CardPaySimulator) addPaymentCallback(payment *cardPaySimulatorPayment, scenario string) {
+	status := billingpb.CardPayPaymentResponseStatusCompleted
+	releaseAt := time.Time{}
+
+	// preauthorized payment waits for capture or void
+	if payment.request.PaymentData != nil && payment.request.PaymentData.Preauth {
+		status = billingpb.CardPayPaymentResponseStatusAuthorized
+	}
+
+	if scenario == CardPaySimulatorScenarioDecline {
+		status = billingpb.CardPayPaymentResponseStatusDeclined
+	}
+
+	if scenario == CardPaySimulatorScenarioDelayedCallback {
+		releaseAt = time.Now().Add(s.CallbackDelay)
+	}
+
+	payment.status = status
+	s.queuePaymentCallback(payment, status, s.getPaymentAmount(payment), releaseAt)
+}
+
+func (s *CardPaySimulator) queuePaymentCallback(
+	payment *cardPaySimulatorPayment,
+	status string,
+	amount float64,
+	releaseAt time.Time,
+) {
+	req := payment.request
+	is3ds := payment.scenario == CardPaySimulatorScenario3ds
+
+	callback := &billingpb.CardPayPaymentCallback{
+		PaymentMethod: req.PaymentMethod,
+		CallbackTime:  time.Now().UTC().Format(cardPayDateFormat),
+		MerchantOrder: &billingpb.CardPayMerchantOrder{
+			Id:          req.MerchantOrder.Id,
+			Description: req.MerchantOrder.Description,
+		},
+	}
+
+	if req.Customer != nil {
+		callback.Customer = &billingpb.CardPayCustomer{
+			Email: req.Customer.Email,
+			Ip:    req.Customer.Ip,
+			Id:    req.Customer.Account,
+		}
+	}
+
+	if req.CardAccount != nil && req.CardAccount.Card != nil {
+		callback.CardAccount = &billingpb.CallbackCardPayBankCardAccount{
+			Holder:             req.CardAccount.Card.HolderName,
+			IssuingCountryCode: "RU",
+			MaskedPan:          tools.MaskBankCardNumber(req.CardAccount.Card.Pan),
+			Token:              primitive.NewObjectID().Hex(),
+		}
+	}
+
+	if req.RecurringData != nil {
+		callback.RecurringData = &billingpb.CardPayCallbackRecurringData{
+			Id:          payment.id,
+			Amount:      amount,
+			Currency:    req.RecurringData.Currency,
+			Description: req.Description,
+			Is_3D:       is3ds,
+			Rrn:         primitive.NewObjectID().Hex(),
+			Status:      status,
+			Filing:      &billingpb.CardPayCallbackRecurringDataFilling{Id: payment.filingId},
+		}
+	} else {
+		callback.PaymentData = &billingpb.CallbackCardPayPaymentData{
+			Id:          payment.id,
+			Amount:      amount,
+			Currency:    req.PaymentData.Currency,
+			Description: req.Description,
+			Is_3D:       is3ds,
+			Rrn:         primitive.NewObjectID().Hex(),
+			Status:      status,
+		}
+
+		if status == billingpb.CardPayPaymentResponseStatusDeclined {
+			callback.PaymentData.DeclineCode = cardPaySimulatorDeclineCode
+			callback.PaymentData.DeclineReason = cardPaySimulatorDeclineReason
+		}
+	}
+
+	s.addCallback(CardPaySimulatorCallbackTypePayment, req.MerchantOrder.Id, payment.terminalId, callback, releaseAt)
+}
+
+func (s *CardPaySimulator) addCallback(callbackType, id, terminalId string, data interface{}, releaseAt time.Time) {
+	b, _ := json.Marshal(data)
+
+	hash := sha512.New()
+	hash.Write([]byte(string(b) + s.terminals[terminalId].secretCallback))
+
+	s.callbacks = append(s.callbacks, &CardPaySimulatorCallback{
+		Type:      callbackType,
+		Id:        id,
+		Body:      b,
+		Signature: hex.EncodeToString(hash.Sum(nil)),
+		releaseAt: releaseAt,
+	})
+}
+
+func (s *CardPaySimulator) getPaymentAmount(payment *cardPaySimulatorPayment) float64 {
+	if payment.request.RecurringData != nil {
+		return payment.request.RecurringData.Amount
+	}
+
+	return payment.request.PaymentData.Amount
+}
+
+func (s *CardPaySimulator) writeJson(w http.ResponseWriter, status int, data interface{}) {
+	b, _ := json.Marshal(data)
+
+	w.Header().Set(HeaderContentType, MIMEApplicationJSON)
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
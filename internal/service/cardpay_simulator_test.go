@@ -0,0 +1,563 @@
+package service
+
+import (
+	"context"
+	"github.com/go-redis/redis"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/mongodb"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang/protobuf/proto"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	"github.com/paysuper/paysuper-billing-server/internal/database"
+	"github.com/paysuper/paysuper-billing-server/internal/mocks"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	casbinMocks "github.com/paysuper/paysuper-proto/go/casbinpb/mocks"
+	"github.com/paysuper/paysuper-proto/go/recurringpb"
+	reportingMocks "github.com/paysuper/paysuper-proto/go/reporterpb/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	rabbitmq "gopkg.in/ProtocolONE/rabbitmq.v1/pkg"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const (
+	cardPaySimulatorTestSuccessUrl = "http://localhost/success"
+	cardPaySimulatorTestFailUrl    = "http://localhost/fail"
+)
+
+type CardPaySimulatorTestSuite struct {
+	suite.Suite
+	simulator *CardPaySimulator
+	handler   Gate
+	order     *billingpb.Order
+}
+
+func Test_CardPaySimulator(t *testing.T) {
+	suite.Run(t, new(CardPaySimulatorTestSuite))
+}
+
+func (suite *CardPaySimulatorTestSuite) SetupTest() {
+	suite.simulator = NewCardPaySimulator()
+	suite.handler = newCardPayHandler()
+
+	suite.order = proto.Clone(orderSimpleBankCard).(*billingpb.Order)
+	suite.order.Id = primitive.NewObjectID().Hex()
+	suite.order.ChargeAmount = 10.2
+	suite.order.ChargeCurrency = "RUB"
+	suite.order.PaymentMethod.Params.ApiUrl = suite.simulator.URL
+	suite.order.PaymentMethod.RefundAllowed = true
+
+	params := suite.order.PaymentMethod.Params
+	suite.simulator.AddTerminal(params.TerminalId, params.Secret, params.SecretCallback)
+}
+
+func (suite *CardPaySimulatorTestSuite) TearDownTest() {
+	suite.simulator.Close()
+}
+
+func (suite *CardPaySimulatorTestSuite) TestCardPaySimulator_Approve_Ok() {
+	url := suite.createPayment()
+	assert.Equal(suite.T(), cardPaySimulatorTestSuccessUrl, url)
+
+	suite.processPaymentCallback()
+	assert.EqualValues(suite.T(), recurringpb.OrderStatusPaymentSystemComplete, suite.order.PrivateStatus)
+	assert.NotEmpty(suite.T(), suite.order.Transaction)
+	assert.True(suite.T(), suite.order.IsRefundAllowed)
+	assert.Equal(suite.T(), 1, suite.simulator.RequestsCount(pkg.CardPayPaths[pkg.PaymentSystemActionAuthenticate].Path))
+}
+
+func (suite *CardPaySimulatorTestSuite) TestCardPaySimulator_Decline_Ok() {
+	suite.simulator.SetOrderScenario(suite.order.Id, CardPaySimulatorScenarioDecline)
+
+	url := suite.createPayment()
+	assert.Equal(suite.T(), cardPaySimulatorTestFailUrl, url)
+
+	suite.processPaymentCallback()
+	assert.EqualValues(suite.T(), recurringpb.OrderStatusPaymentSystemDeclined, suite.order.PrivateStatus)
+	assert.NotNil(suite.T(), suite.order.Cancellation)
+	assert.Equal(suite.T(), cardPaySimulatorDeclineCode, suite.order.Cancellation.Code)
+	assert.Equal(suite.T(), cardPaySimulatorDeclineReason, suite.order.Cancellation.Reason)
+}
+
+func (suite *CardPaySimulatorTestSuite) TestCardPaySimulator_3ds_Ok() {
+	suite.simulator.SetScenario(CardPaySimulatorScenario3ds)
+
+	url := suite.createPayment()
+	assert.Contains(suite.T(), url, suite.simulator.URL+cardPaySimulatorPath3ds)
+	assert.Empty(suite.T(), suite.simulator.Callbacks())
+
+	rsp, err := http.Get(url)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusOK, rsp.StatusCode)
+
+	suite.processPaymentCallback()
+	assert.EqualValues(suite.T(), recurringpb.OrderStatusPaymentSystemComplete, suite.order.PrivateStatus)
+}
+
+func (suite *CardPaySimulatorTestSuite) TestCardPaySimulator_DelayedCallback_Ok() {
+	suite.simulator.SetScenario(CardPaySimulatorScenarioDelayedCallback)
+	suite.simulator.CallbackDelay = 100 * time.Millisecond
+
+	suite.createPayment()
+	assert.Empty(suite.T(), suite.simulator.Callbacks())
+	assert.Equal(suite.T(), 1, suite.simulator.PendingCallbacks())
+
+	time.Sleep(suite.simulator.CallbackDelay)
+
+	suite.processPaymentCallback()
+	assert.EqualValues(suite.T(), recurringpb.OrderStatusPaymentSystemComplete, suite.order.PrivateStatus)
+	assert.Equal(suite.T(), 0, suite.simulator.PendingCallbacks())
+}
+
+func (suite *CardPaySimulatorTestSuite) TestCardPaySimulator_TokenExpired_Ok() {
+	suite.simulator.SetScenario(CardPaySimulatorScenarioTokenExpired)
+
+	suite.createPayment()
+	assert.Equal(suite.T(), 2, suite.simulator.RequestsCount(pkg.CardPayPaths[pkg.PaymentSystemActionAuthenticate].Path))
+
+	suite.processPaymentCallback()
+	assert.EqualValues(suite.T(), recurringpb.OrderStatusPaymentSystemComplete, suite.order.PrivateStatus)
+}
+
+func (suite *CardPaySimulatorTestSuite) TestCardPaySimulator_InvalidTerminalSecret_Error() {
+	suite.order.PaymentMethod.Params.Secret = "invalid_secret"
+
+	_, err := suite.handler.CreatePayment(suite.order, cardPaySimulatorTestSuccessUrl, cardPaySimulatorTestFailUrl, bankCardRequisites)
+	assert.Equal(suite.T(), paymentSystemErrorAuthenticateFailed, err)
+	assert.Equal(suite.T(), 0, suite.simulator.PendingCallbacks())
+}
+
+func (suite *CardPaySimulatorTestSuite) TestCardPaySimulator_InvalidCallbackSignature_Error() {
+	suite.createPayment()
+
+	callbacks := suite.simulator.Callbacks()
+	assert.Len(suite.T(), callbacks, 1)
+
+	message, err := suite.handler.DecodePaymentCallback(callbacks[0].Body)
+	assert.NoError(suite.T(), err)
+
+	err = suite.handler.ProcessPayment(suite.order, message, string(callbacks[0].Body), "invalid_signature")
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), paymentSystemErrorRequestSignatureIsInvalid, err.(*billingpb.ResponseError).Message)
+}
+
+func (suite *CardPaySimulatorTestSuite) TestCardPaySimulator_Refund_Ok() {
+	suite.createPayment()
+	suite.processPaymentCallback()
+
+	refund := suite.createRefund()
+	assert.Equal(suite.T(), pkg.RefundStatusInProgress, refund.Status)
+	assert.NotEmpty(suite.T(), refund.ExternalId)
+
+	suite.processRefundCallback(refund)
+	assert.Equal(suite.T(), pkg.RefundStatusCompleted, refund.Status)
+}
+
+func (suite *CardPaySimulatorTestSuite) TestCardPaySimulator_RefundDecline_Ok() {
+	suite.simulator.SetOrderScenario(suite.order.Id, CardPaySimulatorScenarioRefundDecline)
+	suite.createPayment()
+	suite.processPaymentCallback()
+	assert.EqualValues(suite.T(), recurringpb.OrderStatusPaymentSystemComplete, suite.order.PrivateStatus)
+
+	refund := suite.createRefund()
+	assert.Equal(suite.T(), pkg.RefundStatusInProgress, refund.Status)
+
+	suite.processRefundCallback(refund)
+	assert.Equal(suite.T(), pkg.RefundStatusPaymentSystemDeclined, refund.Status)
+}
+
+func (suite *CardPaySimulatorTestSuite) TestCardPaySimulator_RefundUnknownPayment_Error() {
+	suite.createPayment()
+	suite.order.Transaction = primitive.NewObjectID().Hex()
+
+	refund := &billingpb.Refund{Id: primitive.NewObjectID().Hex(), Amount: 5, Currency: "RUB"}
+	err := suite.handler.CreateRefund(suite.order, refund)
+	assert.EqualError(suite.T(), err, pkg.PaymentSystemErrorCreateRefundFailed)
+	assert.Equal(suite.T(), pkg.RefundStatusRejected, refund.Status)
+}
+
+func (suite *CardPaySimulatorTestSuite) TestCardPaySimulator_SharedTokenStore_Ok() {
+	store := newPaymentSystemTokenRedisStore(mocks.NewTestRedis())
+	suite.handler.(*cardPay).setTokenStore(store)
+	suite.createPayment()
+
+	handler := newCardPayHandler()
+	handler.(*cardPay).setTokenStore(store)
+
+	order := proto.Clone(suite.order).(*billingpb.Order)
+	order.Id = primitive.NewObjectID().Hex()
+	_, err := handler.CreatePayment(order, cardPaySimulatorTestSuccessUrl, cardPaySimulatorTestFailUrl, bankCardRequisites)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, suite.simulator.RequestsCount(pkg.CardPayPaths[pkg.PaymentSystemActionAuthenticate].Path))
+}
+
+func (suite *CardPaySimulatorTestSuite) TestCardPaySimulator_TokenRefreshLocked_Ok() {
+	suite.simulator.SetScenario(CardPaySimulatorScenarioTokenExpired)
+	handler := suite.handler.(*cardPay)
+	key := handler.getTokenKey(suite.order)
+
+	err := handler.auth(suite.order)
+	assert.NoError(suite.T(), err)
+
+	ok, err := handler.tokenStore.Lock(key, "other_instance", time.Minute)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	go func() {
+		time.Sleep(3 * cardPayTokenLockWaitInterval)
+		_ = handler.setToken(
+			[]byte(`{"token_type": "bearer", "access_token": "refreshed", "expires_in": 300, "refresh_expires_in": 900}`),
+			key,
+		)
+		_ = handler.tokenStore.Unlock(key, "other_instance")
+	}()
+
+	token := handler.getToken(suite.order)
+	assert.NotNil(suite.T(), token)
+	assert.Equal(suite.T(), "refreshed", token.AccessToken)
+	assert.Equal(suite.T(), 1, suite.simulator.RequestsCount(pkg.CardPayPaths[pkg.PaymentSystemActionAuthenticate].Path))
+}
+
+func (suite *CardPaySimulatorTestSuite) TestCardPaySimulator_AuthorizeCapture_Ok() {
+	suite.authorizePayment()
+
+	err := suite.handler.CapturePayment(suite.order, 5)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, suite.simulator.RequestsCount(cardPaySimulatorPathPayment))
+
+	suite.order.ChargeAmount = 5
+	suite.processPaymentCallback()
+	assert.EqualValues(suite.T(), recurringpb.OrderStatusPaymentSystemComplete, suite.order.PrivateStatus)
+}
+
+func (suite *CardPaySimulatorTestSuite) TestCardPaySimulator_AuthorizeVoid_Ok() {
+	suite.authorizePayment()
+
+	err := suite.handler.VoidPayment(suite.order)
+	assert.NoError(suite.T(), err)
+
+	suite.processPaymentCallback()
+	assert.EqualValues(suite.T(), pkg.OrderStatusPaymentSystemVoided, suite.order.PrivateStatus)
+	assert.NotNil(suite.T(), suite.order.CanceledAt)
+
+	// voided payment can't be captured
+	err = suite.handler.CapturePayment(suite.order, suite.order.ChargeAmount)
+	assert.Equal(suite.T(), paymentSystemErrorChangeStatusFailed, err)
+}
+
+func (suite *CardPaySimulatorTestSuite) TestCardPaySimulator_CaptureDecline_Error() {
+	suite.simulator.SetOrderScenario(suite.order.Id, CardPaySimulatorScenarioCaptureDecline)
+	suite.authorizePayment()
+
+	err := suite.handler.CapturePayment(suite.order, suite.order.ChargeAmount)
+	assert.Equal(suite.T(), paymentSystemErrorChangeStatusFailed, err)
+	assert.Empty(suite.T(), suite.simulator.Callbacks())
+}
+
+func (suite *CardPaySimulatorTestSuite) TestCardPaySimulator_AuthorizeEWallet_NotSupported() {
+	suite.order.PaymentMethod.ExternalId = recurringpb.PaymentSystemGroupAliasQiwi
+
+	_, err := suite.handler.AuthorizePayment(suite.order, cardPaySimulatorTestSuccessUrl, cardPaySimulatorTestFailUrl, bankCardRequisites)
+	assert.Equal(suite.T(), paymentSystemErrorTwoStepNotSupported, err)
+	assert.Equal(suite.T(), 0, suite.simulator.RequestsCount(pkg.CardPayPaths[pkg.PaymentSystemActionAuthenticate].Path))
+}
+
+func (suite *CardPaySimulatorTestSuite) createPayment() string {
+	url, err := suite.handler.CreatePayment(suite.order, cardPaySimulatorTestSuccessUrl, cardPaySimulatorTestFailUrl, bankCardRequisites)
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), recurringpb.OrderStatusPaymentSystemCreate, suite.order.PrivateStatus)
+
+	return url
+}
+
+func (suite *CardPaySimulatorTestSuite) authorizePayment() {
+	url, err := suite.handler.AuthorizePayment(suite.order, cardPaySimulatorTestSuccessUrl, cardPaySimulatorTestFailUrl, bankCardRequisites)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), cardPaySimulatorTestSuccessUrl, url)
+
+	suite.processPaymentCallback()
+	assert.EqualValues(suite.T(), pkg.OrderStatusPaymentSystemAuthorized, suite.order.PrivateStatus)
+	assert.NotEmpty(suite.T(), suite.order.Transaction)
+}
+
+func (suite *CardPaySimulatorTestSuite) processPaymentCallback() {
+	callbacks := suite.simulator.Callbacks()
+	assert.Len(suite.T(), callbacks, 1)
+	assert.Equal(suite.T(), CardPaySimulatorCallbackTypePayment, callbacks[0].Type)
+	assert.Equal(suite.T(), suite.order.Id, callbacks[0].Id)
+
+	message, err := suite.handler.DecodePaymentCallback(callbacks[0].Body)
+	assert.NoError(suite.T(), err)
+
+	err = suite.handler.ProcessPayment(suite.order, message, string(callbacks[0].Body), callbacks[0].Signature)
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *CardPaySimulatorTestSuite) createRefund() *billingpb.Refund {
+	refund := &billingpb.Refund{
+		Id:       primitive.NewObjectID().Hex(),
+		Amount:   5,
+		Currency: suite.order.ChargeCurrency,
+		Reason:   "unit test",
+	}
+	err := suite.handler.CreateRefund(suite.order, refund)
+	assert.NoError(suite.T(), err)
+
+	return refund
+}
+
+func (suite *CardPaySimulatorTestSuite) processRefundCallback(refund *billingpb.Refund) {
+	callbacks := suite.simulator.Callbacks()
+	assert.Len(suite.T(), callbacks, 1)
+	assert.Equal(suite.T(), CardPaySimulatorCallbackTypeRefund, callbacks[0].Type)
+
+	message, err := suite.handler.DecodeRefundCallback(callbacks[0].Body)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), refund.Id, suite.handler.GetRefundId(message))
+
+	err = suite.handler.ProcessRefund(suite.order, refund, message, string(callbacks[0].Body), callbacks[0].Signature)
+	assert.NoError(suite.T(), err)
+}
+
+type CardPaySimulatorLifecycleTestSuite struct {
+	suite.Suite
+	service   *Service
+	log       *zap.Logger
+	cache     database.CacheInterface
+	simulator *CardPaySimulator
+
+	project       *billingpb.Project
+	paymentMethod *billingpb.PaymentMethod
+}
+
+func Test_CardPaySimulatorLifecycle(t *testing.T) {
+	suite.Run(t, new(CardPaySimulatorLifecycleTestSuite))
+}
+
+func (suite *CardPaySimulatorLifecycleTestSuite) SetupTest() {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		suite.FailNow("Config load failed", "%v", err)
+	}
+
+	suite.simulator = NewCardPaySimulator()
+	cfg.CardPayApiUrl = suite.simulator.URL
+	cfg.CardPayApiSandboxUrl = suite.simulator.URL
+
+	m, err := migrate.New(
+		"file://../../migrations/tests",
+		cfg.MongoDsn)
+	assert.NoError(suite.T(), err, "Migrate init failed")
+
+	err = m.Up()
+	if err != nil && err.Error() != "no change" {
+		suite.FailNow("Migrations failed", "%v", err)
+	}
+
+	ctx, _ := context.WithTimeout(context.Background(), 50*time.Second)
+	opts := []mongodb.Option{mongodb.Context(ctx)}
+	db, err := mongodb.NewDatabase(opts...)
+	if err != nil {
+		suite.FailNow("Database connection failed", "%v", err)
+	}
+
+	suite.log, err = zap.NewProduction()
+
+	if err != nil {
+		suite.FailNow("Logger initialization failed", "%v", err)
+	}
+
+	broker, err := rabbitmq.NewBroker(cfg.BrokerAddress)
+
+	if err != nil {
+		suite.FailNow("Creating RabbitMQ publisher failed", "%v", err)
+	}
+
+	redisClient := database.NewRedis(
+		&redis.Options{
+			Addr:     cfg.RedisHost,
+			Password: cfg.RedisPassword,
+		},
+	)
+
+	redisdb := mocks.NewTestRedis()
+	suite.cache, err = database.NewCacheRedis(redisdb, "cache")
+	suite.service = NewBillingService(
+		db,
+		cfg,
+		mocks.NewGeoIpServiceTestOk(),
+		mocks.NewRepositoryServiceOk(),
+		mocks.NewTaxServiceOkMock(),
+		broker,
+		redisClient,
+		suite.cache,
+		mocks.NewCurrencyServiceMockOk(),
+		mocks.NewDocumentSignerMockOk(),
+		&reportingMocks.ReporterService{},
+		mocks.NewFormatterOK(),
+		mocks.NewBrokerMockOk(),
+		&casbinMocks.CasbinService{},
+	)
+
+	if err := suite.service.Init(); err != nil {
+		suite.FailNow("Billing service initialization failed", "%v", err)
+	}
+
+	var ps *billingpb.PaymentSystem
+	_, suite.project, suite.paymentMethod, ps = helperCreateEntitiesForTests(suite.Suite, suite.service)
+
+	ps.Handler = billingpb.PaymentSystemHandlerCardPay
+	err = suite.service.paymentSystem.Update(context.TODO(), ps)
+
+	if err != nil {
+		suite.FailNow("Payment system update failed", "%v", err)
+	}
+
+	suite.simulator.AddPaymentMethodTerminals(suite.paymentMethod)
+}
+
+func (suite *CardPaySimulatorLifecycleTestSuite) TearDownTest() {
+	suite.simulator.Close()
+
+	err := suite.service.db.Drop()
+
+	if err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	err = suite.service.db.Close()
+
+	if err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *CardPaySimulatorLifecycleTestSuite) TestCardPaySimulatorLifecycle_PaymentAndRefund_Ok() {
+	order := suite.createAndPayOrder(CardPaySimulatorScenarioApprove)
+	assert.EqualValues(suite.T(), recurringpb.OrderStatusPaymentSystemComplete, order.PrivateStatus)
+	assert.Equal(suite.T(), billingpb.PaymentSystemHandlerCardPay, order.PaymentMethod.Handler)
+
+	refund := suite.createAndProcessRefund(order)
+	assert.Equal(suite.T(), pkg.RefundStatusCompleted, refund.Status)
+}
+
+func (suite *CardPaySimulatorLifecycleTestSuite) TestCardPaySimulatorLifecycle_Decline_Ok() {
+	order := suite.createAndPayOrder(CardPaySimulatorScenarioDecline)
+	assert.EqualValues(suite.T(), recurringpb.OrderStatusPaymentSystemDeclined, order.PrivateStatus)
+}
+
+func (suite *CardPaySimulatorLifecycleTestSuite) TestCardPaySimulatorLifecycle_RefundDecline_Ok() {
+	order := suite.createAndPayOrder(CardPaySimulatorScenarioRefundDecline)
+	assert.EqualValues(suite.T(), recurringpb.OrderStatusPaymentSystemComplete, order.PrivateStatus)
+
+	refund := suite.createAndProcessRefund(order)
+	assert.Equal(suite.T(), pkg.RefundStatusPaymentSystemDeclined, refund.Status)
+}
+
+func (suite *CardPaySimulatorLifecycleTestSuite) createAndPayOrder(scenario string) *billingpb.Order {
+	centrifugoMock := &mocks.CentrifugoInterface{}
+	centrifugoMock.On("GetChannelToken", mock.Anything, mock.Anything).Return("token")
+	centrifugoMock.On("Publish", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	suite.service.centrifugoDashboard = centrifugoMock
+	suite.service.centrifugoPaymentForm = centrifugoMock
+
+	req := &billingpb.OrderCreateRequest{
+		Type:        pkg.OrderType_simple,
+		ProjectId:   suite.project.Id,
+		Amount:      100,
+		Currency:    "RUB",
+		Account:     "unit test",
+		Description: "unit test",
+		OrderId:     primitive.NewObjectID().Hex(),
+		User: &billingpb.OrderUser{
+			Id:    primitive.NewObjectID().Hex(),
+			Email: "test@unit.unit",
+			Ip:    "127.0.0.1",
+			Address: &billingpb.OrderBillingAddress{
+				Country: "RU",
+			},
+		},
+	}
+	rsp := &billingpb.OrderCreateProcessResponse{}
+	err := suite.service.OrderCreateProcess(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	suite.simulator.SetOrderScenario(rsp.Item.Id, scenario)
+
+	req1 := &billingpb.PaymentCreateRequest{
+		Data: map[string]string{
+			billingpb.PaymentCreateFieldOrderId:         rsp.Item.Uuid,
+			billingpb.PaymentCreateFieldPaymentMethodId: suite.paymentMethod.Id,
+			billingpb.PaymentCreateFieldEmail:           "test@unit.unit",
+			billingpb.PaymentCreateFieldPan:             "4000000000000002",
+			billingpb.PaymentCreateFieldCvv:             "123",
+			billingpb.PaymentCreateFieldMonth:           "02",
+			billingpb.PaymentCreateFieldYear:            time.Now().AddDate(1, 0, 0).Format("2006"),
+			billingpb.PaymentCreateFieldHolder:          "MR. CARD HOLDER",
+		},
+		Ip: "127.0.0.1",
+	}
+	rsp1 := &billingpb.PaymentCreateResponse{}
+	err = suite.service.PaymentCreateProcess(context.TODO(), req1, rsp1)
+	assert.NoError(suite.T(), err)
+	assert.Equalf(suite.T(), billingpb.ResponseStatusOk, rsp1.Status, "%v", rsp1.Message)
+
+	callbacks := suite.simulator.Callbacks()
+	assert.Len(suite.T(), callbacks, 1)
+
+	req2 := &billingpb.PaymentNotifyRequest{
+		OrderId:   callbacks[0].Id,
+		Request:   callbacks[0].Body,
+		Signature: callbacks[0].Signature,
+	}
+	rsp2 := &billingpb.PaymentNotifyResponse{}
+	err = suite.service.PaymentCallbackProcess(context.TODO(), req2, rsp2)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), pkg.StatusOK, rsp2.Status)
+
+	order, err := suite.service.orderRepository.GetById(context.TODO(), rsp.Item.Id)
+	assert.NoError(suite.T(), err)
+
+	return order
+}
+
+func (suite *CardPaySimulatorLifecycleTestSuite) createAndProcessRefund(order *billingpb.Order) *billingpb.Refund {
+	req := &billingpb.CreateRefundRequest{
+		OrderId:    order.Uuid,
+		Amount:     10,
+		CreatorId:  primitive.NewObjectID().Hex(),
+		Reason:     "unit test",
+		MerchantId: order.GetMerchantId(),
+	}
+	rsp := &billingpb.CreateRefundResponse{}
+	err := suite.service.CreateRefund(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equalf(suite.T(), billingpb.ResponseStatusOk, rsp.Status, "%v", rsp.Message)
+
+	callbacks := suite.simulator.Callbacks()
+	assert.Len(suite.T(), callbacks, 1)
+	assert.Equal(suite.T(), rsp.Item.Id, callbacks[0].Id)
+
+	req1 := &billingpb.CallbackRequest{
+		Handler:   billingpb.PaymentSystemHandlerCardPay,
+		Body:      callbacks[0].Body,
+		Signature: callbacks[0].Signature,
+	}
+	rsp1 := &billingpb.PaymentNotifyResponse{}
+	err = suite.service.ProcessRefundCallback(context.TODO(), req1, rsp1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp1.Status)
+
+	refund, err := suite.service.refundRepository.GetById(context.TODO(), rsp.Item.Id)
+	assert.NoError(suite.T(), err)
+
+	return refund
+}
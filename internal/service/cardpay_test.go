@@ -1,6 +1,7 @@
 package service
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/golang/protobuf/ptypes"
 	"github.com/paysuper/paysuper-billing-server/internal/config"
@@ -14,6 +15,7 @@ import (
 	"go.uber.org/zap/zapcore"
 	"go.uber.org/zap/zaptest/observer"
 	"testing"
+	"time"
 )
 
 var (
@@ -137,3 +139,59 @@ func (suite *CardPayTestSuite) TestCardPay_CreatePayment_Mock_Ok() {
 	assert.NoError(suite.T(), err)
 	assert.NotEmpty(suite.T(), url)
 }
+
+func (suite *CardPayTestSuite) TestCardPay_DecodePaymentCallback_Ok() {
+	raw, err := json.Marshal(&billingpb.CardPayPaymentCallback{
+		PaymentMethod: recurringpb.PaymentSystemGroupAliasBankCard,
+		CallbackTime:  time.Now().Format(cardPayDateFormat),
+		MerchantOrder: &billingpb.CardPayMerchantOrder{Id: primitive.NewObjectID().Hex()},
+	})
+	assert.NoError(suite.T(), err)
+
+	message, err := suite.handler.DecodePaymentCallback(raw)
+	assert.NoError(suite.T(), err)
+	assert.IsType(suite.T(), &billingpb.CardPayPaymentCallback{}, message)
+	assert.Equal(suite.T(), recurringpb.PaymentSystemGroupAliasBankCard, message.(*billingpb.CardPayPaymentCallback).PaymentMethod)
+}
+
+func (suite *CardPayTestSuite) TestCardPay_DecodePaymentCallback_InvalidJson_Error() {
+	message, err := suite.handler.DecodePaymentCallback([]byte(`{"payment_method":`))
+	assert.Error(suite.T(), err)
+	assert.Nil(suite.T(), message)
+}
+
+func (suite *CardPayTestSuite) TestCardPay_DecodeRefundCallback_Ok() {
+	refundId := primitive.NewObjectID().Hex()
+	raw, err := json.Marshal(&billingpb.CardPayRefundCallback{
+		MerchantOrder: &billingpb.CardPayMerchantOrder{Id: refundId},
+		RefundData: &billingpb.CardPayRefundCallbackRefundData{
+			Amount:   10,
+			Currency: "RUB",
+			Status:   billingpb.CardPayPaymentResponseStatusCompleted,
+		},
+	})
+	assert.NoError(suite.T(), err)
+
+	message, err := suite.handler.DecodeRefundCallback(raw)
+	assert.NoError(suite.T(), err)
+	assert.IsType(suite.T(), &billingpb.CardPayRefundCallback{}, message)
+	assert.Equal(suite.T(), refundId, suite.handler.GetRefundId(message))
+}
+
+func (suite *CardPayTestSuite) TestCardPay_DecodeRefundCallback_RefundDataNotFound_Error() {
+	raw, err := json.Marshal(&billingpb.CardPayRefundCallback{
+		MerchantOrder: &billingpb.CardPayMerchantOrder{Id: primitive.NewObjectID().Hex()},
+	})
+	assert.NoError(suite.T(), err)
+
+	message, err := suite.handler.DecodeRefundCallback(raw)
+	assert.Error(suite.T(), err)
+	assert.EqualError(suite.T(), err, callbackRequestIncorrect)
+	assert.Nil(suite.T(), message)
+}
+
+func (suite *CardPayTestSuite) TestCardPay_GetPaymentMethodGroups_Ok() {
+	groups := suite.handler.GetPaymentMethodGroups()
+	assert.Contains(suite.T(), groups, recurringpb.PaymentSystemGroupAliasBankCard)
+	assert.Contains(suite.T(), groups, recurringpb.PaymentSystemGroupAliasBitcoin)
+}
@@ -0,0 +1,782 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang/protobuf/ptypes"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/internal/repository"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"github.com/paysuper/paysuper-proto/go/recurringpb"
+	tools "github.com/paysuper/paysuper-tools/number"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	disputeChargebackReasonMask = "Chargeback by dispute %s"
+	disputeReversalReasonMask   = "Reversal of chargeback by dispute %s"
+	disputeNotificationMask     = "Dispute of order %s was moved to status \"%s\""
+	disputeOverdueComment       = "response deadline expired"
+
+	disputeCentrifugoMessageCode = "dp000100"
+)
+
+var (
+	disputeErrorOrderNotFound        = newBillingServerErrorMsg("dp000001", "order of dispute not found")
+	disputeErrorOrderNotDisputable   = newBillingServerErrorMsg("dp000002", "order can't be disputed in its current status")
+	disputeErrorStatusInvalid        = newBillingServerErrorMsg("dp000003", "dispute can be opened in inquiry or chargeback status only")
+	disputeErrorAmountInvalid        = newBillingServerErrorMsg("dp000004", "amount of dispute must be positive and not exceed not refunded amount of order")
+	disputeErrorAlreadyExists        = newBillingServerErrorMsg("dp000005", "order already has an open dispute")
+	disputeErrorNotFound             = newBillingServerErrorMsg("dp000006", "dispute not found")
+	disputeErrorTransitionNotAllowed = newBillingServerErrorMsg("dp000007", "dispute can't be moved to the status from its current status")
+	disputeErrorEvidenceRequired     = newBillingServerErrorMsg("dp000008", "dispute must have at least one evidence to be submitted")
+	disputeErrorEvidenceInvalid      = newBillingServerErrorMsg("dp000009", "name and url of evidence are required")
+	disputeErrorClosed               = newBillingServerErrorMsg("dp000010", "dispute is already closed")
+	disputeErrorChangedConcurrently  = newBillingServerErrorMsg("dp000011", "dispute was changed concurrently, reload dispute and try again")
+
+	// disputeStatusTransitions contains statuses to which dispute can be moved from the status,
+	// won and lost disputes are closed and can't be moved to any other status.
+	disputeStatusTransitions = map[string][]string{
+		internalPkg.DisputeStatusInquiry: {
+			internalPkg.DisputeStatusChargeback,
+			internalPkg.DisputeStatusEvidenceSubmitted,
+			internalPkg.DisputeStatusWon,
+			internalPkg.DisputeStatusLost,
+		},
+		internalPkg.DisputeStatusChargeback: {
+			internalPkg.DisputeStatusEvidenceSubmitted,
+			internalPkg.DisputeStatusWon,
+			internalPkg.DisputeStatusLost,
+		},
+		internalPkg.DisputeStatusEvidenceSubmitted: {
+			internalPkg.DisputeStatusPreArbitration,
+			internalPkg.DisputeStatusWon,
+			internalPkg.DisputeStatusLost,
+		},
+		internalPkg.DisputeStatusPreArbitration: {
+			internalPkg.DisputeStatusEvidenceSubmitted,
+			internalPkg.DisputeStatusWon,
+			internalPkg.DisputeStatusLost,
+		},
+	}
+)
+
+// CreateDispute opens dispute of the order. Chargeback of the order is booked immediately
+// if dispute is opened in chargeback status.
+func (s *Service) CreateDispute(
+	ctx context.Context,
+	req *internalPkg.CreateDisputeRequest,
+	rsp *internalPkg.DisputeResponse,
+) error {
+	if req.Status == "" {
+		req.Status = internalPkg.DisputeStatusInquiry
+	}
+
+	if req.Status != internalPkg.DisputeStatusInquiry && req.Status != internalPkg.DisputeStatusChargeback {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = disputeErrorStatusInvalid
+		return nil
+	}
+
+	order, err := s.getOrderByUuid(ctx, req.OrderId)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = disputeErrorOrderNotFound
+		return nil
+	}
+
+	if !isOrderStatusTransitionAllowed(order.PrivateStatus, recurringpb.OrderStatusChargeback) {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = disputeErrorOrderNotDisputable
+		return nil
+	}
+
+	_, err = s.disputeRepository.GetActiveByOrderId(ctx, order.Id)
+
+	if err == nil {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = disputeErrorAlreadyExists
+		return nil
+	}
+
+	if err != mongo.ErrNoDocuments {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	refundedAmount, err := s.refundRepository.GetAmountByOrderId(ctx, order.Id)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	available := tools.FormatAmount(order.ChargeAmount - refundedAmount)
+
+	if req.Amount == 0 {
+		req.Amount = available
+	}
+
+	if req.Amount <= 0 || req.Amount > available {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = disputeErrorAmountInvalid
+		return nil
+	}
+
+	now := time.Now()
+	dispute := &internalPkg.Dispute{
+		Id:                 primitive.NewObjectID().Hex(),
+		OrderId:            order.Id,
+		OrderUuid:          order.Uuid,
+		MerchantId:         order.GetMerchantId(),
+		ProjectId:          order.GetProjectId(),
+		ExternalId:         req.ExternalId,
+		ReasonCode:         req.ReasonCode,
+		Reason:             req.Reason,
+		Amount:             req.Amount,
+		Currency:           order.ChargeCurrency,
+		Status:             req.Status,
+		DueAt:              s.getDisputeDueAt(req.Status, req.DueAt, now),
+		Evidences:          []*internalPkg.DisputeEvidence{},
+		OrderPrivateStatus: order.PrivateStatus,
+		OrderPublicStatus:  order.Status,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+		History: []*internalPkg.DisputeEvent{
+			{To: req.Status, Comment: req.Reason, CreatorId: req.CreatorId, CreatedAt: now},
+		},
+	}
+
+	if err = s.disputeRepository.Insert(ctx, dispute); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	// dispute which chargeback failed stays in chargeback status, chargeback is booked again when dispute is lost
+	if dispute.Status == internalPkg.DisputeStatusChargeback {
+		if err = s.bookDisputeChargeback(ctx, dispute, order, req.CreatorId); err != nil {
+			rsp.Status = billingpb.ResponseStatusSystemError
+			rsp.Message = orderErrorUnknown
+			return nil
+		}
+	}
+
+	s.notifyDisputeChanged(ctx, dispute)
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = dispute
+
+	return nil
+}
+
+// ChangeDisputeStatus moves dispute to the status by the decision of issuer or by the response of merchant.
+// Outcome of the dispute is booked in accounting.
+func (s *Service) ChangeDisputeStatus(
+	ctx context.Context,
+	req *internalPkg.ChangeDisputeStatusRequest,
+	rsp *internalPkg.DisputeResponse,
+) error {
+	dispute, err := s.disputeRepository.GetById(ctx, req.Id)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = disputeErrorNotFound
+		return nil
+	}
+
+	if !isDisputeStatusTransitionAllowed(dispute.Status, req.Status) {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = disputeErrorTransitionNotAllowed
+		return nil
+	}
+
+	if req.Status == internalPkg.DisputeStatusEvidenceSubmitted && len(dispute.Evidences) <= 0 {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = disputeErrorEvidenceRequired
+		return nil
+	}
+
+	if err = s.setDisputeStatus(ctx, dispute, req.Status, req.DueAt, req.Comment, req.CreatorId); err != nil {
+		if err == disputeErrorChangedConcurrently {
+			rsp.Status = billingpb.ResponseStatusBadData
+			rsp.Message = disputeErrorChangedConcurrently
+			return nil
+		}
+
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = dispute
+
+	return nil
+}
+
+func (s *Service) AddDisputeEvidence(
+	ctx context.Context,
+	req *internalPkg.AddDisputeEvidenceRequest,
+	rsp *internalPkg.DisputeResponse,
+) error {
+	if req.Name == "" || req.Url == "" {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = disputeErrorEvidenceInvalid
+		return nil
+	}
+
+	dispute, err := s.disputeRepository.GetById(ctx, req.Id)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = disputeErrorNotFound
+		return nil
+	}
+
+	if isDisputeClosed(dispute.Status) {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = disputeErrorClosed
+		return nil
+	}
+
+	now := time.Now()
+	evidence := &internalPkg.DisputeEvidence{
+		Id:          primitive.NewObjectID().Hex(),
+		Name:        req.Name,
+		Url:         req.Url,
+		Description: req.Description,
+		CreatorId:   req.CreatorId,
+		CreatedAt:   now,
+	}
+	ok, err := s.disputeRepository.AddEvidence(ctx, dispute.Id, evidence, now)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	if !ok {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = disputeErrorClosed
+		return nil
+	}
+
+	dispute.Evidences = append(dispute.Evidences, evidence)
+	dispute.UpdatedAt = now
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = dispute
+
+	return nil
+}
+
+func (s *Service) GetDispute(
+	ctx context.Context,
+	req *internalPkg.GetDisputeRequest,
+	rsp *internalPkg.DisputeResponse,
+) error {
+	dispute, err := s.disputeRepository.GetById(ctx, req.Id)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			rsp.Status = billingpb.ResponseStatusNotFound
+			rsp.Message = disputeErrorNotFound
+			return nil
+		}
+
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = dispute
+
+	return nil
+}
+
+func (s *Service) ListDisputes(
+	ctx context.Context,
+	req *internalPkg.ListDisputesRequest,
+	rsp *internalPkg.ListDisputesResponse,
+) error {
+	if req.Limit <= 0 {
+		req.Limit = pkg.DatabaseRequestDefaultLimit
+	}
+
+	if req.Offset <= 0 {
+		req.Offset = 0
+	}
+
+	count, err := s.disputeRepository.FindCount(ctx, req)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	if count > 0 {
+		rsp.Items, err = s.disputeRepository.Find(ctx, req)
+
+		if err != nil {
+			rsp.Status = billingpb.ResponseStatusSystemError
+			rsp.Message = orderErrorUnknown
+			return nil
+		}
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Count = count
+
+	return nil
+}
+
+// CloseOverdueDisputes closes as lost open disputes which merchant didn't respond to before the deadline
+// and returns the number of closed disputes.
+func (s *Service) CloseOverdueDisputes(ctx context.Context) (int, error) {
+	counter := 0
+	disputes, err := s.disputeRepository.FindOverdue(ctx, time.Now())
+
+	if err != nil {
+		return counter, err
+	}
+
+	for _, dispute := range disputes {
+		err = s.setDisputeStatus(ctx, dispute, internalPkg.DisputeStatusLost, 0, disputeOverdueComment, "")
+
+		if err != nil {
+			zap.L().Error(
+				"Closing of overdue dispute failed",
+				zap.Error(err),
+				zap.String("dispute_id", dispute.Id),
+			)
+			continue
+		}
+
+		counter++
+	}
+
+	return counter, nil
+}
+
+// setDisputeStatus moves dispute to the status and books chargeback of order when dispute is moved to chargeback
+// or lost, booked chargeback is reversed when dispute is won. Status is changed only if status, chargeback and
+// its reversal of dispute weren't changed concurrently, otherwise disputeErrorChangedConcurrently is returned.
+func (s *Service) setDisputeStatus(
+	ctx context.Context,
+	dispute *internalPkg.Dispute,
+	status string,
+	dueAt int64,
+	comment, creatorId string,
+) error {
+	from := dispute.Status
+	isChargeback := status == internalPkg.DisputeStatusChargeback || status == internalPkg.DisputeStatusLost
+	isReversal := status == internalPkg.DisputeStatusWon && dispute.RefundId != "" && !dispute.IsReversed
+
+	if isChargeback && dispute.RefundId != "" {
+		// booking of chargeback claimed by the dispute could be interrupted, then it's finished
+		booked, err := s.isDisputeChargebackBooked(ctx, dispute)
+
+		if err != nil {
+			return err
+		}
+
+		isChargeback = !booked
+	}
+
+	if isChargeback || isReversal {
+		order, err := s.getOrderById(ctx, dispute.OrderId)
+
+		if err != nil {
+			return err
+		}
+
+		if isReversal {
+			err = s.reverseDisputeChargeback(ctx, dispute, order)
+		} else {
+			err = s.bookDisputeChargeback(ctx, dispute, order, creatorId)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	dispute.History = append(dispute.History, &internalPkg.DisputeEvent{
+		From:      dispute.Status,
+		To:        status,
+		Comment:   comment,
+		CreatorId: creatorId,
+		CreatedAt: now,
+	})
+	dispute.Status = status
+	dispute.DueAt = s.getDisputeDueAt(status, dueAt, now)
+	dispute.UpdatedAt = now
+
+	if isDisputeClosed(status) {
+		dispute.ClosedAt = &now
+	}
+
+	ok, err := s.disputeRepository.UpdateStatus(ctx, dispute, from)
+
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return disputeErrorChangedConcurrently
+	}
+
+	s.notifyDisputeChanged(ctx, dispute)
+
+	return nil
+}
+
+// bookDisputeChargeback creates completed chargeback refund of the disputed amount, the refund is booked
+// in accounting with chargeback fees of payment system and merchant. Refund is claimed on dispute before
+// it's created, so chargeback is booked once per dispute. Every step of booking is skipped if it was done
+// by the booking which was interrupted, so booking of claimed refund is finished by the next call.
+func (s *Service) bookDisputeChargeback(
+	ctx context.Context,
+	dispute *internalPkg.Dispute,
+	order *billingpb.Order,
+	creatorId string,
+) error {
+	// chargeback is a refund of order, so refunded amount of order isn't changed by other refund meanwhile
+	unlock, ok, err := s.acquireRedisLock(
+		ctx,
+		fmt.Sprintf(refundOrderLockKey, order.Id),
+		refundOrderLockTtl,
+		refundOrderLockWaitTimeout,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return disputeErrorChangedConcurrently
+	}
+
+	defer unlock()
+
+	refund, err := s.getDisputeChargebackRefund(ctx, dispute, order, creatorId)
+
+	if err != nil {
+		return err
+	}
+
+	if refund.CreatedOrderId == "" {
+		refundOrder, err := s.orderRepository.GetByRefundReceiptNumber(ctx, refund.Id)
+
+		if err != nil {
+			if err != mongo.ErrNoDocuments {
+				return err
+			}
+
+			refundOrder, err = s.createOrderByRefund(ctx, order, refund)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		refund.CreatedOrderId = refundOrder.Id
+
+		if err = s.refundRepository.Update(ctx, refund); err != nil {
+			return err
+		}
+	}
+
+	refundedAmount, err := s.refundRepository.GetAmountByOrderId(ctx, order.Id)
+
+	if err != nil {
+		return err
+	}
+
+	if refundedAmount >= order.ChargeAmount && order.PrivateStatus != recurringpb.OrderStatusChargeback {
+		order.PrivateStatus = recurringpb.OrderStatusChargeback
+		order.Status = recurringpb.OrderPublicStatusChargeback
+		order.UpdatedAt = ptypes.TimestampNow()
+		order.RefundedAt = ptypes.TimestampNow()
+		order.Refunded = true
+		order.IsRefundAllowed = false
+		order.Refund = &billingpb.OrderNotificationRefund{
+			Amount:        refundedAmount,
+			Currency:      order.ChargeCurrency,
+			Reason:        refund.Reason,
+			ReceiptNumber: refund.Id,
+		}
+
+		if err = s.updateOrderWithCause(ctx, order, internalPkg.OrderStatusEventCauseDispute); err != nil {
+			return err
+		}
+	}
+
+	booked, err := s.hasAccountingEntries(ctx, repository.CollectionRefund, refund.CreatedOrderId)
+
+	if err != nil || booked {
+		return err
+	}
+
+	if err = s.onRefundNotify(ctx, refund, order); err != nil {
+		zap.L().Error(
+			pkg.MethodFinishedWithError,
+			zap.String("method", "onRefundNotify"),
+			zap.Error(err),
+			zap.String("dispute_id", dispute.Id),
+			zap.String("refund_id", refund.Id),
+		)
+		return err
+	}
+
+	return nil
+}
+
+// getDisputeChargebackRefund returns refund of the dispute chargeback. New refund is claimed on dispute
+// before it's created, refund claimed by the interrupted booking is created if it wasn't created yet.
+func (s *Service) getDisputeChargebackRefund(
+	ctx context.Context,
+	dispute *internalPkg.Dispute,
+	order *billingpb.Order,
+	creatorId string,
+) (*billingpb.Refund, error) {
+	if dispute.RefundId != "" {
+		refund, err := s.refundRepository.GetById(ctx, dispute.RefundId)
+
+		if err != mongo.ErrNoDocuments {
+			return refund, err
+		}
+	} else {
+		refundId := primitive.NewObjectID().Hex()
+		ok, err := s.disputeRepository.ClaimChargeback(ctx, dispute, refundId)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			return nil, disputeErrorChangedConcurrently
+		}
+
+		dispute.RefundId = refundId
+	}
+
+	refund := &billingpb.Refund{
+		Id: dispute.RefundId,
+		OriginalOrder: &billingpb.RefundOrder{
+			Id:   order.Id,
+			Uuid: order.Uuid,
+		},
+		Amount:    dispute.Amount,
+		CreatorId: creatorId,
+		Reason:    fmt.Sprintf(disputeChargebackReasonMask, dispute.Id),
+		Currency:  order.ChargeCurrency,
+		Status:    pkg.RefundStatusCompleted,
+		CreatedAt: ptypes.TimestampNow(),
+		UpdatedAt: ptypes.TimestampNow(),
+		PayerData: &billingpb.RefundPayerData{
+			Country: order.GetCountry(),
+			Zip:     order.GetPostalCode(),
+			State:   order.GetState(),
+		},
+		IsChargeback: true,
+	}
+
+	if order.Tax != nil {
+		refund.SalesTax = float32(tools.GetPercentPartFromAmount(refund.Amount, order.Tax.Rate))
+	}
+
+	if err := s.refundRepository.Insert(ctx, refund); err != nil {
+		// refund wasn't created, so chargeback can be booked again
+		if s.disputeRepository.ReleaseChargeback(ctx, dispute.Id, refund.Id) == nil {
+			dispute.RefundId = ""
+		}
+
+		return nil, err
+	}
+
+	return refund, nil
+}
+
+// isDisputeChargebackBooked checks that refund claimed by the dispute chargeback was created with its order
+// and booked in accounting.
+func (s *Service) isDisputeChargebackBooked(ctx context.Context, dispute *internalPkg.Dispute) (bool, error) {
+	refund, err := s.refundRepository.GetById(ctx, dispute.RefundId)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	if refund.CreatedOrderId == "" {
+		return false, nil
+	}
+
+	return s.hasAccountingEntries(ctx, repository.CollectionRefund, refund.CreatedOrderId)
+}
+
+// reverseDisputeChargeback books reversal of the chargeback and restores status which order had before
+// the chargeback. Refund of chargeback is kept, so order can't be refunded after dispute. Reversal is claimed
+// on dispute before it's booked, so chargeback is reversed once per dispute.
+func (s *Service) reverseDisputeChargeback(
+	ctx context.Context,
+	dispute *internalPkg.Dispute,
+	order *billingpb.Order,
+) error {
+	refund, err := s.refundRepository.GetById(ctx, dispute.RefundId)
+
+	if err != nil {
+		return err
+	}
+
+	ok, err := s.disputeRepository.ClaimReversal(ctx, dispute)
+
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return disputeErrorChangedConcurrently
+	}
+
+	dispute.IsReversed = true
+
+	if err = s.bookDisputeReversal(ctx, dispute, refund, order); err != nil {
+		// accounting entries of reversal aren't created twice, so reversal can be booked again
+		if s.disputeRepository.ReleaseReversal(ctx, dispute.Id) == nil {
+			dispute.IsReversed = false
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// bookDisputeReversal books accounting entries of the reversal and restores status of order.
+func (s *Service) bookDisputeReversal(
+	ctx context.Context,
+	dispute *internalPkg.Dispute,
+	refund *billingpb.Refund,
+	order *billingpb.Order,
+) error {
+	err := s.onDisputeReversalNotify(ctx, dispute, refund, order)
+
+	if err != nil && err != accountingEntryAlreadyCreated {
+		zap.L().Error(
+			pkg.MethodFinishedWithError,
+			zap.String("method", "onDisputeReversalNotify"),
+			zap.Error(err),
+			zap.String("dispute_id", dispute.Id),
+			zap.String("refund_id", refund.Id),
+		)
+		return err
+	}
+
+	if order.PrivateStatus == recurringpb.OrderStatusChargeback {
+		order.PrivateStatus = dispute.OrderPrivateStatus
+		order.Status = dispute.OrderPublicStatus
+		order.UpdatedAt = ptypes.TimestampNow()
+		order.RefundedAt = nil
+		order.Refunded = false
+		order.Refund = nil
+
+		if err = s.updateOrderWithCause(ctx, order, internalPkg.OrderStatusEventCauseDispute); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// notifyDisputeChanged notifies merchant about the new status of dispute and sends the event to admin channel.
+func (s *Service) notifyDisputeChanged(ctx context.Context, dispute *internalPkg.Dispute) {
+	msg := fmt.Sprintf(disputeNotificationMask, dispute.OrderUuid, dispute.Status)
+
+	if _, err := s.addNotification(ctx, msg, dispute.MerchantId, "", nil); err != nil {
+		zap.L().Error(
+			"Merchant notification about dispute failed",
+			zap.Error(err),
+			zap.String("dispute_id", dispute.Id),
+		)
+	}
+
+	event := map[string]interface{}{
+		"id":          dispute.Id,
+		"code":        disputeCentrifugoMessageCode,
+		"message":     msg,
+		"order_id":    dispute.OrderUuid,
+		"merchant_id": dispute.MerchantId,
+		"status":      dispute.Status,
+		"due_at":      dispute.DueAt,
+	}
+
+	if err := s.centrifugoDashboard.Publish(ctx, s.cfg.CentrifugoAdminChannel, event); err != nil {
+		zap.L().Error(
+			"[Centrifugo] Send admin notification about dispute failed",
+			zap.Error(err),
+			zap.Any("msg", event),
+		)
+	}
+}
+
+// getDisputeDueAt returns response deadline of dispute in the status, deadline set by payment system
+// takes precedence over the configured response time. Disputes waiting for decision of issuer have no deadline.
+func (s *Service) getDisputeDueAt(status string, dueAt int64, now time.Time) *time.Time {
+	if isDisputeClosed(status) {
+		return nil
+	}
+
+	if dueAt > 0 {
+		t := time.Unix(dueAt, 0)
+		return &t
+	}
+
+	var seconds int64
+
+	switch status {
+	case internalPkg.DisputeStatusInquiry:
+		seconds = s.cfg.DisputeInquiryResponseTime
+	case internalPkg.DisputeStatusChargeback:
+		seconds = s.cfg.DisputeChargebackResponseTime
+	case internalPkg.DisputeStatusPreArbitration:
+		seconds = s.cfg.DisputePreArbitrationResponseTime
+	}
+
+	if seconds <= 0 {
+		return nil
+	}
+
+	t := now.Add(time.Duration(seconds) * time.Second)
+
+	return &t
+}
+
+func isDisputeStatusTransitionAllowed(from, to string) bool {
+	for _, v := range disputeStatusTransitions[from] {
+		if v == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isDisputeClosed(status string) bool {
+	return status == internalPkg.DisputeStatusWon || status == internalPkg.DisputeStatusLost
+}
@@ -0,0 +1,458 @@
+package service
+
+import (
+	"context"
+	"github.com/go-redis/redis"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/mongodb"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	"github.com/paysuper/paysuper-billing-server/internal/database"
+	"github.com/paysuper/paysuper-billing-server/internal/mocks"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/internal/repository"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	casbinMocks "github.com/paysuper/paysuper-proto/go/casbinpb/mocks"
+	"github.com/paysuper/paysuper-proto/go/recurringpb"
+	reportingMocks "github.com/paysuper/paysuper-proto/go/reporterpb/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	rabbitmq "gopkg.in/ProtocolONE/rabbitmq.v1/pkg"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type DisputeTestSuite struct {
+	suite.Suite
+	service *Service
+	log     *zap.Logger
+	cache   database.CacheInterface
+
+	merchant      *billingpb.Merchant
+	project       *billingpb.Project
+	paymentMethod *billingpb.PaymentMethod
+	paymentSystem *billingpb.PaymentSystem
+}
+
+func Test_Dispute(t *testing.T) {
+	suite.Run(t, new(DisputeTestSuite))
+}
+
+func (suite *DisputeTestSuite) SetupTest() {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		suite.FailNow("Config load failed", "%v", err)
+	}
+	cfg.CardPayApiUrl = "https://sandbox.cardpay.com"
+
+	m, err := migrate.New(
+		"file://../../migrations/tests",
+		cfg.MongoDsn)
+	assert.NoError(suite.T(), err, "Migrate init failed")
+
+	err = m.Up()
+	if err != nil && err.Error() != "no change" {
+		suite.FailNow("Migrations failed", "%v", err)
+	}
+
+	ctx, _ := context.WithTimeout(context.Background(), 50*time.Second)
+	opts := []mongodb.Option{mongodb.Context(ctx)}
+	db, err := mongodb.NewDatabase(opts...)
+	if err != nil {
+		suite.FailNow("Database connection failed", "%v", err)
+	}
+
+	suite.log, err = zap.NewProduction()
+
+	if err != nil {
+		suite.FailNow("Logger initialization failed", "%v", err)
+	}
+
+	broker, err := rabbitmq.NewBroker(cfg.BrokerAddress)
+
+	if err != nil {
+		suite.FailNow("Creating RabbitMQ publisher failed", "%v", err)
+	}
+
+	redisClient := database.NewRedis(
+		&redis.Options{
+			Addr:     cfg.RedisHost,
+			Password: cfg.RedisPassword,
+		},
+	)
+
+	redisdb := mocks.NewTestRedis()
+	suite.cache, err = database.NewCacheRedis(redisdb, "cache")
+	suite.service = NewBillingService(
+		db,
+		cfg,
+		mocks.NewGeoIpServiceTestOk(),
+		mocks.NewRepositoryServiceOk(),
+		mocks.NewTaxServiceOkMock(),
+		broker,
+		redisClient,
+		suite.cache,
+		mocks.NewCurrencyServiceMockOk(),
+		mocks.NewDocumentSignerMockOk(),
+		&reportingMocks.ReporterService{},
+		mocks.NewFormatterOK(),
+		mocks.NewBrokerMockOk(),
+		&casbinMocks.CasbinService{},
+	)
+
+	if err := suite.service.Init(); err != nil {
+		suite.FailNow("Billing service initialization failed", "%v", err)
+	}
+
+	suite.merchant, suite.project, suite.paymentMethod, suite.paymentSystem = helperCreateEntitiesForTests(suite.Suite, suite.service)
+
+	centrifugoMock := &mocks.CentrifugoInterface{}
+	centrifugoMock.On("GetChannelToken", mock.Anything, mock.Anything).Return("token")
+	centrifugoMock.On("Publish", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	suite.service.centrifugoDashboard = centrifugoMock
+	suite.service.centrifugoPaymentForm = centrifugoMock
+}
+
+func (suite *DisputeTestSuite) TearDownTest() {
+	err := suite.service.db.Drop()
+
+	if err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	err = suite.service.db.Close()
+
+	if err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *DisputeTestSuite) TestDispute_CreateDispute_Ok() {
+	order := suite.createAndPayOrder()
+
+	req := &internalPkg.CreateDisputeRequest{OrderId: order.Uuid, ReasonCode: "10.4", Reason: "fraud"}
+	rsp := &internalPkg.DisputeResponse{}
+	err := suite.service.CreateDispute(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), internalPkg.DisputeStatusInquiry, rsp.Item.Status)
+	assert.Equal(suite.T(), order.Id, rsp.Item.OrderId)
+	assert.Equal(suite.T(), suite.merchant.Id, rsp.Item.MerchantId)
+	assert.Equal(suite.T(), order.ChargeAmount, rsp.Item.Amount)
+	assert.Equal(suite.T(), order.ChargeCurrency, rsp.Item.Currency)
+	assert.NotNil(suite.T(), rsp.Item.DueAt)
+	assert.Empty(suite.T(), rsp.Item.RefundId)
+	assert.Len(suite.T(), rsp.Item.History, 1)
+
+	rsp1 := &internalPkg.DisputeResponse{}
+	err = suite.service.GetDispute(context.TODO(), &internalPkg.GetDisputeRequest{Id: rsp.Item.Id}, rsp1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp1.Status)
+	assert.Equal(suite.T(), rsp.Item.Id, rsp1.Item.Id)
+
+	rsp2 := &internalPkg.DisputeResponse{}
+	err = suite.service.CreateDispute(context.TODO(), req, rsp2)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp2.Status)
+	assert.Equal(suite.T(), disputeErrorAlreadyExists, rsp2.Message)
+}
+
+func (suite *DisputeTestSuite) TestDispute_CreateDispute_OrderNotFound() {
+	req := &internalPkg.CreateDisputeRequest{OrderId: primitive.NewObjectID().Hex()}
+	rsp := &internalPkg.DisputeResponse{}
+	err := suite.service.CreateDispute(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), disputeErrorOrderNotFound, rsp.Message)
+}
+
+func (suite *DisputeTestSuite) TestDispute_CreateDispute_StatusOrAmountInvalid() {
+	order := suite.createAndPayOrder()
+
+	req := &internalPkg.CreateDisputeRequest{OrderId: order.Uuid, Status: internalPkg.DisputeStatusWon}
+	rsp := &internalPkg.DisputeResponse{}
+	err := suite.service.CreateDispute(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), disputeErrorStatusInvalid, rsp.Message)
+
+	req = &internalPkg.CreateDisputeRequest{OrderId: order.Uuid, Amount: order.ChargeAmount + 1}
+	rsp = &internalPkg.DisputeResponse{}
+	err = suite.service.CreateDispute(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), disputeErrorAmountInvalid, rsp.Message)
+}
+
+func (suite *DisputeTestSuite) TestDispute_CreateDispute_Chargeback_Ok() {
+	order := suite.createAndPayOrder()
+	dispute := suite.createDispute(order, internalPkg.DisputeStatusChargeback)
+	assert.NotEmpty(suite.T(), dispute.RefundId)
+
+	refund, err := suite.service.refundRepository.GetById(context.TODO(), dispute.RefundId)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), refund.IsChargeback)
+	assert.Equal(suite.T(), pkg.RefundStatusCompleted, refund.Status)
+	assert.Equal(suite.T(), order.ChargeAmount, refund.Amount)
+	assert.NotEmpty(suite.T(), refund.CreatedOrderId)
+
+	order, err = suite.service.orderRepository.GetById(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), recurringpb.OrderStatusChargeback, order.PrivateStatus)
+	assert.Equal(suite.T(), recurringpb.OrderPublicStatusChargeback, order.Status)
+
+	entries := suite.getRefundAccountingEntries(refund)
+	assert.NotNil(suite.T(), entries[pkg.AccountingEntryTypeRealRefund])
+	assert.NotNil(suite.T(), entries[pkg.AccountingEntryTypeRealRefundFee])
+	assert.NotNil(suite.T(), entries[pkg.AccountingEntryTypeMerchantRefund])
+	assert.Nil(suite.T(), entries[pkg.AccountingEntryTypeRealChargebackReversal])
+}
+
+func (suite *DisputeTestSuite) TestDispute_ChangeDisputeStatus_TransitionNotAllowed() {
+	order := suite.createAndPayOrder()
+	dispute := suite.createDispute(order, internalPkg.DisputeStatusInquiry)
+
+	req := &internalPkg.ChangeDisputeStatusRequest{Id: dispute.Id, Status: internalPkg.DisputeStatusPreArbitration}
+	rsp := &internalPkg.DisputeResponse{}
+	err := suite.service.ChangeDisputeStatus(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), disputeErrorTransitionNotAllowed, rsp.Message)
+}
+
+func (suite *DisputeTestSuite) TestDispute_ChangeDisputeStatus_EvidenceRequired() {
+	order := suite.createAndPayOrder()
+	dispute := suite.createDispute(order, internalPkg.DisputeStatusInquiry)
+
+	req := &internalPkg.ChangeDisputeStatusRequest{Id: dispute.Id, Status: internalPkg.DisputeStatusEvidenceSubmitted}
+	rsp := &internalPkg.DisputeResponse{}
+	err := suite.service.ChangeDisputeStatus(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), disputeErrorEvidenceRequired, rsp.Message)
+
+	req1 := &internalPkg.AddDisputeEvidenceRequest{Id: dispute.Id, Name: "receipt.pdf", Url: "https://cdn.unit.test/receipt.pdf"}
+	rsp1 := &internalPkg.DisputeResponse{}
+	err = suite.service.AddDisputeEvidence(context.TODO(), req1, rsp1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp1.Status)
+	assert.Len(suite.T(), rsp1.Item.Evidences, 1)
+
+	rsp = &internalPkg.DisputeResponse{}
+	err = suite.service.ChangeDisputeStatus(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), internalPkg.DisputeStatusEvidenceSubmitted, rsp.Item.Status)
+	assert.Nil(suite.T(), rsp.Item.DueAt)
+	assert.Len(suite.T(), rsp.Item.History, 2)
+}
+
+func (suite *DisputeTestSuite) TestDispute_ChangeDisputeStatus_Lost_ChargebackBooked() {
+	order := suite.createAndPayOrder()
+	dispute := suite.createDispute(order, internalPkg.DisputeStatusInquiry)
+
+	req := &internalPkg.ChangeDisputeStatusRequest{Id: dispute.Id, Status: internalPkg.DisputeStatusLost}
+	rsp := &internalPkg.DisputeResponse{}
+	err := suite.service.ChangeDisputeStatus(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.NotEmpty(suite.T(), rsp.Item.RefundId)
+	assert.NotNil(suite.T(), rsp.Item.ClosedAt)
+
+	order, err = suite.service.orderRepository.GetById(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), recurringpb.OrderStatusChargeback, order.PrivateStatus)
+
+	req1 := &internalPkg.AddDisputeEvidenceRequest{Id: dispute.Id, Name: "receipt.pdf", Url: "https://cdn.unit.test/receipt.pdf"}
+	rsp1 := &internalPkg.DisputeResponse{}
+	err = suite.service.AddDisputeEvidence(context.TODO(), req1, rsp1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp1.Status)
+	assert.Equal(suite.T(), disputeErrorClosed, rsp1.Message)
+}
+
+func (suite *DisputeTestSuite) TestDispute_ChangeDisputeStatus_Won_ChargebackReversed() {
+	order := suite.createAndPayOrder()
+	status := order.PrivateStatus
+	dispute := suite.createDispute(order, internalPkg.DisputeStatusChargeback)
+
+	req := &internalPkg.ChangeDisputeStatusRequest{Id: dispute.Id, Status: internalPkg.DisputeStatusWon}
+	rsp := &internalPkg.DisputeResponse{}
+	err := suite.service.ChangeDisputeStatus(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.True(suite.T(), rsp.Item.IsReversed)
+
+	order, err = suite.service.orderRepository.GetById(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), status, order.PrivateStatus)
+	assert.False(suite.T(), order.Refunded)
+
+	refund, err := suite.service.refundRepository.GetById(context.TODO(), dispute.RefundId)
+	assert.NoError(suite.T(), err)
+
+	entries := suite.getRefundAccountingEntries(refund)
+	assert.NotNil(suite.T(), entries[pkg.AccountingEntryTypeRealChargebackReversal])
+	assert.Equal(
+		suite.T(),
+		entries[pkg.AccountingEntryTypeRealRefund].Amount,
+		entries[pkg.AccountingEntryTypeRealChargebackReversal].Amount,
+	)
+	assert.NotNil(suite.T(), entries[pkg.AccountingEntryTypeMerchantRoyaltyCorrection])
+	assert.Equal(
+		suite.T(),
+		entries[pkg.AccountingEntryTypeMerchantRefund].Amount,
+		entries[pkg.AccountingEntryTypeMerchantRoyaltyCorrection].Amount,
+	)
+}
+
+func (suite *DisputeTestSuite) TestDispute_SetDisputeStatus_ChargebackBookedOnce() {
+	order := suite.createAndPayOrder()
+	dispute := suite.createDispute(order, internalPkg.DisputeStatusInquiry)
+
+	// stale copies of dispute, e.g. loaded by daemon and by admin at the same time
+	dispute1, err := suite.service.disputeRepository.GetById(context.TODO(), dispute.Id)
+	assert.NoError(suite.T(), err)
+	dispute2, err := suite.service.disputeRepository.GetById(context.TODO(), dispute.Id)
+	assert.NoError(suite.T(), err)
+
+	err = suite.service.setDisputeStatus(context.TODO(), dispute1, internalPkg.DisputeStatusLost, 0, "", "")
+	assert.NoError(suite.T(), err)
+
+	err = suite.service.setDisputeStatus(context.TODO(), dispute2, internalPkg.DisputeStatusLost, 0, "", "")
+	assert.Equal(suite.T(), disputeErrorChangedConcurrently, err)
+
+	err = suite.service.setDisputeStatus(context.TODO(), dispute2, internalPkg.DisputeStatusWon, 0, "", "")
+	assert.Equal(suite.T(), disputeErrorChangedConcurrently, err)
+
+	refundedAmount, err := suite.service.refundRepository.GetAmountByOrderId(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), dispute.Amount, refundedAmount)
+
+	dispute3, err := suite.service.disputeRepository.GetById(context.TODO(), dispute.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.DisputeStatusLost, dispute3.Status)
+	assert.Equal(suite.T(), dispute1.RefundId, dispute3.RefundId)
+	assert.False(suite.T(), dispute3.IsReversed)
+}
+
+func (suite *DisputeTestSuite) TestDispute_ChangeDisputeStatus_InterruptedChargebackFinished() {
+	order := suite.createAndPayOrder()
+	dispute := suite.createDispute(order, internalPkg.DisputeStatusInquiry)
+
+	// booking was interrupted after refund was claimed and created
+	refund, err := suite.service.getDisputeChargebackRefund(context.TODO(), dispute, order, "")
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), refund.CreatedOrderId)
+
+	req := &internalPkg.ChangeDisputeStatusRequest{Id: dispute.Id, Status: internalPkg.DisputeStatusLost}
+	rsp := &internalPkg.DisputeResponse{}
+	err = suite.service.ChangeDisputeStatus(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), refund.Id, rsp.Item.RefundId)
+
+	refund, err = suite.service.refundRepository.GetById(context.TODO(), refund.Id)
+	assert.NoError(suite.T(), err)
+	assert.NotEmpty(suite.T(), refund.CreatedOrderId)
+
+	refundedAmount, err := suite.service.refundRepository.GetAmountByOrderId(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), dispute.Amount, refundedAmount)
+
+	order, err = suite.service.orderRepository.GetById(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), recurringpb.OrderStatusChargeback, order.PrivateStatus)
+
+	entries := suite.getRefundAccountingEntries(refund)
+	assert.NotNil(suite.T(), entries[pkg.AccountingEntryTypeRealRefund])
+	assert.NotNil(suite.T(), entries[pkg.AccountingEntryTypeMerchantRefund])
+
+	booked, err := suite.service.isDisputeChargebackBooked(context.TODO(), rsp.Item)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), booked)
+}
+
+func (suite *DisputeTestSuite) TestDispute_ListDisputes_Ok() {
+	order := suite.createAndPayOrder()
+	dispute := suite.createDispute(order, internalPkg.DisputeStatusInquiry)
+
+	req := &internalPkg.ListDisputesRequest{MerchantId: suite.merchant.Id}
+	rsp := &internalPkg.ListDisputesResponse{}
+	err := suite.service.ListDisputes(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.EqualValues(suite.T(), 1, rsp.Count)
+	assert.Equal(suite.T(), dispute.Id, rsp.Items[0].Id)
+
+	req.Status = internalPkg.DisputeStatusWon
+	rsp = &internalPkg.ListDisputesResponse{}
+	err = suite.service.ListDisputes(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), 0, rsp.Count)
+	assert.Empty(suite.T(), rsp.Items)
+}
+
+func (suite *DisputeTestSuite) TestDispute_CloseOverdueDisputes_Ok() {
+	order := suite.createAndPayOrder()
+
+	req := &internalPkg.CreateDisputeRequest{OrderId: order.Uuid, DueAt: time.Now().Add(-time.Minute).Unix()}
+	rsp := &internalPkg.DisputeResponse{}
+	err := suite.service.CreateDispute(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	count, err := suite.service.CloseOverdueDisputes(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, count)
+
+	dispute, err := suite.service.disputeRepository.GetById(context.TODO(), rsp.Item.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.DisputeStatusLost, dispute.Status)
+	assert.NotEmpty(suite.T(), dispute.RefundId)
+
+	count, err = suite.service.CloseOverdueDisputes(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, count)
+}
+
+func (suite *DisputeTestSuite) createAndPayOrder() *billingpb.Order {
+	return helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+}
+
+func (suite *DisputeTestSuite) createDispute(order *billingpb.Order, status string) *internalPkg.Dispute {
+	req := &internalPkg.CreateDisputeRequest{OrderId: order.Uuid, Status: status, Reason: "fraud"}
+	rsp := &internalPkg.DisputeResponse{}
+	err := suite.service.CreateDispute(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	return rsp.Item
+}
+
+func (suite *DisputeTestSuite) getRefundAccountingEntries(refund *billingpb.Refund) map[string]*billingpb.AccountingEntry {
+	var accountingEntries []*billingpb.AccountingEntry
+
+	oid, err := primitive.ObjectIDFromHex(refund.CreatedOrderId)
+	assert.NoError(suite.T(), err)
+	filter := bson.M{"source.id": oid, "source.type": repository.CollectionRefund}
+
+	cursor, err := suite.service.db.Collection(collectionAccountingEntry).Find(context.TODO(), filter)
+	assert.NoError(suite.T(), err)
+	err = cursor.All(context.TODO(), &accountingEntries)
+	assert.NoError(suite.T(), err)
+
+	entries := make(map[string]*billingpb.AccountingEntry)
+
+	for _, v := range accountingEntries {
+		entries[v.Type] = v
+	}
+
+	return entries
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"github.com/paysuper/paysuper-proto/go/postmarkpb"
+	"github.com/streadway/amqp"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	"strconv"
+	"time"
+)
+
+const (
+	subscriptionCanceledByDunningMessage = "Subscription %s was canceled because its renewal payment failed after all retries: %s"
+)
+
+var (
+	dunningErrorRetryIntervalsInvalid = newBillingServerErrorMsg("dn000001", "retry intervals of dunning policy must be positive and contain at least one interval")
+	dunningErrorMaxAttemptsInvalid    = newBillingServerErrorMsg("dn000002", "maximum number of retries must be greater than or equal to zero")
+	dunningErrorRetryHourInvalid      = newBillingServerErrorMsg("dn000003", "hour of retries must be between 0 and 23")
+)
+
+func (s *Service) GetDunningPolicy(
+	ctx context.Context,
+	req *internalPkg.DunningPolicyRequest,
+	rsp *internalPkg.DunningPolicyResponse,
+) error {
+	if _, err := s.project.GetById(ctx, req.ProjectId); err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = projectErrorNotFound
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = s.getDunningPolicy(ctx, req.ProjectId)
+
+	return nil
+}
+
+// SetDunningPolicy overrides the default dunning policy for the project.
+func (s *Service) SetDunningPolicy(
+	ctx context.Context,
+	req *internalPkg.DunningPolicy,
+	rsp *internalPkg.DunningPolicyResponse,
+) error {
+	if len(req.RetryIntervals) == 0 {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = dunningErrorRetryIntervalsInvalid
+		return nil
+	}
+
+	for _, v := range req.RetryIntervals {
+		if v <= 0 {
+			rsp.Status = billingpb.ResponseStatusBadData
+			rsp.Message = dunningErrorRetryIntervalsInvalid
+			return nil
+		}
+	}
+
+	if req.MaxAttempts < 0 {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = dunningErrorMaxAttemptsInvalid
+		return nil
+	}
+
+	if req.RetryHour != nil && (*req.RetryHour < 0 || *req.RetryHour > 23) {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = dunningErrorRetryHourInvalid
+		return nil
+	}
+
+	if _, err := s.project.GetById(ctx, req.ProjectId); err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = projectErrorNotFound
+		return nil
+	}
+
+	req.UpdatedAt = time.Now()
+
+	if err := s.dunningPolicyRepository.Upsert(ctx, req.ProjectId, req); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = req
+
+	return nil
+}
+
+// getDunningPolicy returns dunning policy of the project or the default policy if project didn't override it.
+func (s *Service) getDunningPolicy(ctx context.Context, projectId string) *internalPkg.DunningPolicy {
+	policy := &internalPkg.DunningPolicy{}
+	err := s.dunningPolicyRepository.GetByOwnerId(ctx, projectId, policy)
+
+	if err == nil {
+		return policy
+	}
+
+	if err != mongo.ErrNoDocuments {
+		zap.L().Error("dunning policy of project not loaded", zap.Error(err), zap.String("project_id", projectId))
+	}
+
+	policy = &internalPkg.DunningPolicy{
+		ProjectId:                     projectId,
+		RetryIntervals:                s.cfg.DunningRetryIntervals,
+		MaxAttempts:                   s.cfg.DunningMaxAttempts,
+		HardDeclineCodes:              s.cfg.DunningHardDeclineCodes,
+		InsufficientFundsDeclineCodes: s.cfg.DunningInsufficientFundsDeclineCodes,
+	}
+
+	if s.cfg.DunningRetryHour >= 0 {
+		retryHour := s.cfg.DunningRetryHour
+		policy.RetryHour = &retryHour
+	}
+
+	return policy
+}
+
+// failSubscriptionRenewal applies dunning policy of the project to the subscription which renewal payment failed.
+// Payment is retried by the schedule of policy and customer gets letter with link to update the card.
+// Subscription is canceled and merchant is notified when payment can't be retried anymore.
+// Returns false if status or period of the subscription was changed by other process, it isn't saved then.
+func (s *Service) failSubscriptionRenewal(
+	ctx context.Context,
+	subscription *internalPkg.Subscription,
+	declineCode, reason string,
+) bool {
+	status, periodEnd := subscription.Status, subscription.CurrentPeriodEnd
+	policy := s.getDunningPolicy(ctx, subscription.ProjectId)
+	declineType := getDunningDeclineType(policy, declineCode)
+	now := time.Now()
+
+	subscription.FailedAttempts++
+	subscription.LastChargeError = reason
+	subscription.UpdatedAt = now
+
+	isCanceled := declineType == internalPkg.DunningDeclineTypeHard || subscription.FailedAttempts > policy.MaxAttempts
+
+	if isCanceled {
+		subscription.Status = internalPkg.SubscriptionStatusCanceled
+		subscription.CanceledAt = &now
+		subscription.RetryAt = time.Time{}
+	} else {
+		subscription.Status = internalPkg.SubscriptionStatusPastDue
+		subscription.RetryAt = getDunningRetryAt(policy, subscription.FailedAttempts, declineType, now)
+	}
+
+	ok, err := s.subscriptionRepository.UpdateIf(ctx, subscription, status, periodEnd)
+
+	if err != nil {
+		return true
+	}
+
+	if !ok {
+		return false
+	}
+
+	if isCanceled {
+		s.notifyMerchantSubscriptionCanceled(ctx, subscription)
+		return true
+	}
+
+	s.sendSubscriptionPaymentFailedEmail(subscription)
+
+	return true
+}
+
+func (s *Service) sendSubscriptionPaymentFailedEmail(subscription *internalPkg.Subscription) {
+	payload := &postmarkpb.Payload{
+		TemplateAlias: s.cfg.EmailTemplates.SubscriptionPaymentFailed,
+		TemplateModel: map[string]string{
+			"subscription_id": subscription.Id,
+			"amount":          strconv.FormatFloat(subscription.Amount, 'f', 2, 64),
+			"currency":        subscription.Currency,
+			"decline_reason":  subscription.LastChargeError,
+			"retry_date":      subscription.RetryAt.UTC().Format("2006-01-02"),
+			"update_card_url": s.cfg.GetSubscriptionCardUrl(subscription.Id),
+		},
+		To: subscription.User.Email,
+	}
+
+	err := s.postmarkBroker.Publish(postmarkpb.PostmarkSenderTopicName, payload, amqp.Table{})
+
+	if err != nil {
+		zap.L().Error(
+			"Publication message about failed subscription payment to queue failed",
+			zap.Error(err),
+			zap.String("subscription_id", subscription.Id),
+		)
+	}
+}
+
+func (s *Service) notifyMerchantSubscriptionCanceled(ctx context.Context, subscription *internalPkg.Subscription) {
+	msg := fmt.Sprintf(subscriptionCanceledByDunningMessage, subscription.Id, subscription.LastChargeError)
+
+	if _, err := s.addNotification(ctx, msg, subscription.MerchantId, "", nil); err != nil {
+		zap.L().Error(
+			"Send merchant notification about canceled subscription failed",
+			zap.Error(err),
+			zap.String("subscription_id", subscription.Id),
+		)
+	}
+}
+
+func getDunningDeclineType(policy *internalPkg.DunningPolicy, declineCode string) string {
+	if declineCode == "" {
+		return internalPkg.DunningDeclineTypeSoft
+	}
+
+	for _, v := range policy.HardDeclineCodes {
+		if v == declineCode {
+			return internalPkg.DunningDeclineTypeHard
+		}
+	}
+
+	for _, v := range policy.InsufficientFundsDeclineCodes {
+		if v == declineCode {
+			return internalPkg.DunningDeclineTypeInsufficientFunds
+		}
+	}
+
+	return internalPkg.DunningDeclineTypeSoft
+}
+
+// getDunningRetryAt returns time of retry after the failed attempt. Retry after decline for insufficient funds
+// is moved forward to the hour of retries, e.g. to the morning when salaries are usually paid.
+func getDunningRetryAt(policy *internalPkg.DunningPolicy, attempt int32, declineType string, now time.Time) time.Time {
+	if len(policy.RetryIntervals) == 0 {
+		return now
+	}
+
+	i := int(attempt) - 1
+
+	if i >= len(policy.RetryIntervals) {
+		i = len(policy.RetryIntervals) - 1
+	}
+
+	if i < 0 {
+		i = 0
+	}
+
+	retryAt := now.Add(time.Duration(policy.RetryIntervals[i]) * time.Second)
+
+	if declineType != internalPkg.DunningDeclineTypeInsufficientFunds || policy.RetryHour == nil {
+		return retryAt
+	}
+
+	t := retryAt.UTC()
+	moved := time.Date(t.Year(), t.Month(), t.Day(), int(*policy.RetryHour), 0, 0, 0, time.UTC)
+
+	if moved.Before(t) {
+		moved = moved.AddDate(0, 0, 1)
+	}
+
+	return moved
+}
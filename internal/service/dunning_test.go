@@ -0,0 +1,358 @@
+package service
+
+import (
+	"context"
+	"github.com/go-redis/redis"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/mongodb"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	"github.com/paysuper/paysuper-billing-server/internal/database"
+	"github.com/paysuper/paysuper-billing-server/internal/mocks"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	casbinMocks "github.com/paysuper/paysuper-proto/go/casbinpb/mocks"
+	"github.com/paysuper/paysuper-proto/go/postmarkpb"
+	reportingMocks "github.com/paysuper/paysuper-proto/go/reporterpb/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	rabbitmq "gopkg.in/ProtocolONE/rabbitmq.v1/pkg"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type DunningTestSuite struct {
+	suite.Suite
+	service *Service
+	log     *zap.Logger
+	cache   database.CacheInterface
+
+	merchant      *billingpb.Merchant
+	project       *billingpb.Project
+	paymentMethod *billingpb.PaymentMethod
+	paymentSystem *billingpb.PaymentSystem
+}
+
+func Test_Dunning(t *testing.T) {
+	suite.Run(t, new(DunningTestSuite))
+}
+
+func (suite *DunningTestSuite) SetupTest() {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		suite.FailNow("Config load failed", "%v", err)
+	}
+	cfg.CardPayApiUrl = "https://sandbox.cardpay.com"
+
+	m, err := migrate.New(
+		"file://../../migrations/tests",
+		cfg.MongoDsn)
+	assert.NoError(suite.T(), err, "Migrate init failed")
+
+	err = m.Up()
+	if err != nil && err.Error() != "no change" {
+		suite.FailNow("Migrations failed", "%v", err)
+	}
+
+	ctx, _ := context.WithTimeout(context.Background(), 50*time.Second)
+	opts := []mongodb.Option{mongodb.Context(ctx)}
+	db, err := mongodb.NewDatabase(opts...)
+	if err != nil {
+		suite.FailNow("Database connection failed", "%v", err)
+	}
+
+	suite.log, err = zap.NewProduction()
+
+	if err != nil {
+		suite.FailNow("Logger initialization failed", "%v", err)
+	}
+
+	broker, err := rabbitmq.NewBroker(cfg.BrokerAddress)
+
+	if err != nil {
+		suite.FailNow("Creating RabbitMQ publisher failed", "%v", err)
+	}
+
+	redisClient := database.NewRedis(
+		&redis.Options{
+			Addr:     cfg.RedisHost,
+			Password: cfg.RedisPassword,
+		},
+	)
+
+	redisdb := mocks.NewTestRedis()
+	suite.cache, err = database.NewCacheRedis(redisdb, "cache")
+	suite.service = NewBillingService(
+		db,
+		cfg,
+		mocks.NewGeoIpServiceTestOk(),
+		mocks.NewRepositoryServiceOk(),
+		mocks.NewTaxServiceOkMock(),
+		broker,
+		redisClient,
+		suite.cache,
+		mocks.NewCurrencyServiceMockOk(),
+		mocks.NewDocumentSignerMockOk(),
+		&reportingMocks.ReporterService{},
+		mocks.NewFormatterOK(),
+		mocks.NewBrokerMockOk(),
+		&casbinMocks.CasbinService{},
+	)
+
+	if err := suite.service.Init(); err != nil {
+		suite.FailNow("Billing service initialization failed", "%v", err)
+	}
+
+	suite.merchant, suite.project, suite.paymentMethod, suite.paymentSystem = helperCreateEntitiesForTests(suite.Suite, suite.service)
+
+	centrifugoMock := &mocks.CentrifugoInterface{}
+	centrifugoMock.On("GetChannelToken", mock.Anything, mock.Anything).Return("token")
+	centrifugoMock.On("Publish", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	suite.service.centrifugoDashboard = centrifugoMock
+	suite.service.centrifugoPaymentForm = centrifugoMock
+}
+
+func (suite *DunningTestSuite) TearDownTest() {
+	err := suite.service.db.Drop()
+
+	if err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	err = suite.service.db.Close()
+
+	if err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *DunningTestSuite) TestDunning_GetDunningPolicy_Default() {
+	req := &internalPkg.DunningPolicyRequest{ProjectId: suite.project.Id}
+	rsp := &internalPkg.DunningPolicyResponse{}
+	err := suite.service.GetDunningPolicy(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), suite.service.cfg.DunningRetryIntervals, rsp.Item.RetryIntervals)
+	assert.Equal(suite.T(), suite.service.cfg.DunningMaxAttempts, rsp.Item.MaxAttempts)
+	assert.NotNil(suite.T(), rsp.Item.RetryHour)
+	assert.Equal(suite.T(), suite.service.cfg.DunningRetryHour, *rsp.Item.RetryHour)
+}
+
+func (suite *DunningTestSuite) TestDunning_GetDunningPolicy_ProjectNotFound() {
+	req := &internalPkg.DunningPolicyRequest{ProjectId: primitive.NewObjectID().Hex()}
+	rsp := &internalPkg.DunningPolicyResponse{}
+	err := suite.service.GetDunningPolicy(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), projectErrorNotFound, rsp.Message)
+}
+
+func (suite *DunningTestSuite) TestDunning_SetDunningPolicy_Ok() {
+	req := &internalPkg.DunningPolicy{
+		ProjectId:        suite.project.Id,
+		RetryIntervals:   []int64{3600},
+		MaxAttempts:      1,
+		HardDeclineCodes: []string{"41"},
+	}
+	rsp := &internalPkg.DunningPolicyResponse{}
+	err := suite.service.SetDunningPolicy(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	rsp1 := &internalPkg.DunningPolicyResponse{}
+	err = suite.service.GetDunningPolicy(context.TODO(), &internalPkg.DunningPolicyRequest{ProjectId: suite.project.Id}, rsp1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp1.Status)
+	assert.Equal(suite.T(), []int64{3600}, rsp1.Item.RetryIntervals)
+	assert.Equal(suite.T(), int32(1), rsp1.Item.MaxAttempts)
+	assert.Nil(suite.T(), rsp1.Item.RetryHour)
+	assert.Equal(suite.T(), []string{"41"}, rsp1.Item.HardDeclineCodes)
+}
+
+func (suite *DunningTestSuite) TestDunning_SetDunningPolicy_RetryIntervalsInvalid() {
+	req := &internalPkg.DunningPolicy{ProjectId: suite.project.Id, RetryIntervals: []int64{3600, 0}}
+	rsp := &internalPkg.DunningPolicyResponse{}
+	err := suite.service.SetDunningPolicy(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), dunningErrorRetryIntervalsInvalid, rsp.Message)
+}
+
+func (suite *DunningTestSuite) TestDunning_SetDunningPolicy_RetryHourInvalid() {
+	retryHour := int32(24)
+	req := &internalPkg.DunningPolicy{ProjectId: suite.project.Id, RetryIntervals: []int64{3600}, RetryHour: &retryHour}
+	rsp := &internalPkg.DunningPolicyResponse{}
+	err := suite.service.SetDunningPolicy(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), dunningErrorRetryHourInvalid, rsp.Message)
+}
+
+func (suite *DunningTestSuite) TestDunning_SetDunningPolicy_ProjectNotFound() {
+	req := &internalPkg.DunningPolicy{ProjectId: primitive.NewObjectID().Hex(), RetryIntervals: []int64{3600}}
+	rsp := &internalPkg.DunningPolicyResponse{}
+	err := suite.service.SetDunningPolicy(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), projectErrorNotFound, rsp.Message)
+}
+
+func (suite *DunningTestSuite) TestDunning_GetDunningRetryAt() {
+	retryHour := int32(9)
+	policy := &internalPkg.DunningPolicy{RetryIntervals: []int64{3600, 86400}, RetryHour: &retryHour}
+	now := time.Date(2020, 2, 7, 12, 30, 0, 0, time.UTC)
+
+	retryAt := getDunningRetryAt(policy, 1, internalPkg.DunningDeclineTypeSoft, now)
+	assert.Equal(suite.T(), now.Add(time.Hour), retryAt)
+
+	retryAt = getDunningRetryAt(policy, 2, internalPkg.DunningDeclineTypeSoft, now)
+	assert.Equal(suite.T(), now.Add(24*time.Hour), retryAt)
+
+	// the last interval is used for the rest of attempts
+	retryAt = getDunningRetryAt(policy, 5, internalPkg.DunningDeclineTypeSoft, now)
+	assert.Equal(suite.T(), now.Add(24*time.Hour), retryAt)
+
+	retryAt = getDunningRetryAt(policy, 1, internalPkg.DunningDeclineTypeInsufficientFunds, now)
+	assert.Equal(suite.T(), time.Date(2020, 2, 8, 9, 0, 0, 0, time.UTC), retryAt)
+
+	policy.RetryHour = nil
+	retryAt = getDunningRetryAt(policy, 1, internalPkg.DunningDeclineTypeInsufficientFunds, now)
+	assert.Equal(suite.T(), now.Add(time.Hour), retryAt)
+}
+
+func (suite *DunningTestSuite) TestDunning_GetDunningDeclineType() {
+	policy := &internalPkg.DunningPolicy{
+		HardDeclineCodes:              []string{"41", "43"},
+		InsufficientFundsDeclineCodes: []string{"51"},
+	}
+	assert.Equal(suite.T(), internalPkg.DunningDeclineTypeHard, getDunningDeclineType(policy, "43"))
+	assert.Equal(suite.T(), internalPkg.DunningDeclineTypeInsufficientFunds, getDunningDeclineType(policy, "51"))
+	assert.Equal(suite.T(), internalPkg.DunningDeclineTypeSoft, getDunningDeclineType(policy, "05"))
+	assert.Equal(suite.T(), internalPkg.DunningDeclineTypeSoft, getDunningDeclineType(policy, ""))
+}
+
+func (suite *DunningTestSuite) TestDunning_FailSubscriptionRenewal_RetryScheduled() {
+	postmarkBroker := &mocks.BrokerInterface{}
+	postmarkBroker.On("Publish", postmarkpb.PostmarkSenderTopicName, mock.Anything, mock.Anything).Return(nil)
+	suite.service.postmarkBroker = postmarkBroker
+
+	subscription := suite.createSubscription()
+	now := time.Now()
+	suite.service.failSubscriptionRenewal(context.TODO(), subscription, "05", "do not honor")
+
+	subscription, err := suite.service.subscriptionRepository.GetById(context.TODO(), subscription.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.SubscriptionStatusPastDue, subscription.Status)
+	assert.Equal(suite.T(), int32(1), subscription.FailedAttempts)
+	assert.Equal(suite.T(), "do not honor", subscription.LastChargeError)
+	assert.InDelta(suite.T(), now.Add(24*time.Hour).Unix(), subscription.RetryAt.Unix(), 10)
+
+	postmarkBroker.AssertNumberOfCalls(suite.T(), "Publish", 1)
+	payload := postmarkBroker.Calls[0].Arguments.Get(1).(*postmarkpb.Payload)
+	assert.Equal(suite.T(), subscription.User.Email, payload.To)
+	assert.Equal(suite.T(), suite.service.cfg.EmailTemplates.SubscriptionPaymentFailed, payload.TemplateAlias)
+	assert.Equal(suite.T(), suite.service.cfg.GetSubscriptionCardUrl(subscription.Id), payload.TemplateModel["update_card_url"])
+}
+
+func (suite *DunningTestSuite) TestDunning_FailSubscriptionRenewal_AllRetriesFailed() {
+	subscription := suite.createSubscription()
+	subscription.Status = internalPkg.SubscriptionStatusPastDue
+	subscription.FailedAttempts = suite.service.cfg.DunningMaxAttempts
+	assert.NoError(suite.T(), suite.service.subscriptionRepository.Update(context.TODO(), subscription))
+	suite.service.failSubscriptionRenewal(context.TODO(), subscription, "05", "do not honor")
+
+	subscription, err := suite.service.subscriptionRepository.GetById(context.TODO(), subscription.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.SubscriptionStatusCanceled, subscription.Status)
+	assert.Equal(suite.T(), suite.service.cfg.DunningMaxAttempts+1, subscription.FailedAttempts)
+	assert.NotNil(suite.T(), subscription.CanceledAt)
+	assert.True(suite.T(), subscription.RetryAt.IsZero())
+
+	var notification *billingpb.Notification
+	oid, err := primitive.ObjectIDFromHex(suite.merchant.Id)
+	assert.NoError(suite.T(), err)
+	err = suite.service.db.Collection(collectionNotification).
+		FindOne(context.TODO(), bson.M{"merchant_id": oid}).
+		Decode(&notification)
+	assert.NoError(suite.T(), err)
+	assert.Contains(suite.T(), notification.Message, subscription.Id)
+}
+
+func (suite *DunningTestSuite) TestDunning_FailSubscriptionRenewal_HardDecline() {
+	postmarkBroker := &mocks.BrokerInterface{}
+	postmarkBroker.On("Publish", postmarkpb.PostmarkSenderTopicName, mock.Anything, mock.Anything).Return(nil)
+	suite.service.postmarkBroker = postmarkBroker
+
+	subscription := suite.createSubscription()
+	suite.service.failSubscriptionRenewal(context.TODO(), subscription, "43", "stolen card")
+
+	subscription, err := suite.service.subscriptionRepository.GetById(context.TODO(), subscription.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.SubscriptionStatusCanceled, subscription.Status)
+	assert.Equal(suite.T(), int32(1), subscription.FailedAttempts)
+	postmarkBroker.AssertNotCalled(suite.T(), "Publish", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *DunningTestSuite) TestDunning_FailSubscriptionRenewal_SubscriptionChanged() {
+	subscription := suite.createSubscription()
+	canceled := *subscription
+	canceled.Status = internalPkg.SubscriptionStatusCanceled
+	assert.NoError(suite.T(), suite.service.subscriptionRepository.Update(context.TODO(), &canceled))
+
+	ok := suite.service.failSubscriptionRenewal(context.TODO(), subscription, "05", "do not honor")
+	assert.False(suite.T(), ok)
+
+	subscription, err := suite.service.subscriptionRepository.GetById(context.TODO(), subscription.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.SubscriptionStatusCanceled, subscription.Status)
+	assert.Zero(suite.T(), subscription.FailedAttempts)
+}
+
+func (suite *DunningTestSuite) TestDunning_FailSubscriptionRenewal_ProjectPolicy() {
+	rsp := &internalPkg.DunningPolicyResponse{}
+	err := suite.service.SetDunningPolicy(
+		context.TODO(),
+		&internalPkg.DunningPolicy{ProjectId: suite.project.Id, RetryIntervals: []int64{60}, MaxAttempts: 0},
+		rsp,
+	)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	subscription := suite.createSubscription()
+	suite.service.failSubscriptionRenewal(context.TODO(), subscription, "05", "do not honor")
+
+	subscription, err = suite.service.subscriptionRepository.GetById(context.TODO(), subscription.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.SubscriptionStatusCanceled, subscription.Status)
+}
+
+func (suite *DunningTestSuite) createSubscription() *internalPkg.Subscription {
+	now := time.Now()
+	subscription := &internalPkg.Subscription{
+		Id:         primitive.NewObjectID().Hex(),
+		PlanId:     primitive.NewObjectID().Hex(),
+		MerchantId: suite.merchant.Id,
+		ProjectId:  suite.project.Id,
+		User: &billingpb.OrderUser{
+			Id:    primitive.NewObjectID().Hex(),
+			Email: "test@unit.unit",
+		},
+		Status:             internalPkg.SubscriptionStatusActive,
+		Amount:             100,
+		Currency:           "RUB",
+		CurrentPeriodStart: now.AddDate(0, -1, 0),
+		CurrentPeriodEnd:   now,
+		NextBillingAt:      now,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}
+	err := suite.service.subscriptionRepository.Insert(context.TODO(), subscription)
+	assert.NoError(suite.T(), err)
+
+	return subscription
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/paysuper/paysuper-billing-server/internal/helper"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	"sort"
+	"time"
+)
+
+const (
+	duplicatePaymentRefundReasonMask = "Duplicate payment of order #%s"
+	duplicatePaymentNotificationMask = "Order %s is a duplicate payment of order %s, please review it"
+)
+
+var (
+	duplicatePaymentErrorActionInvalid = newBillingServerErrorMsg("du000001", "action of duplicate payment policy must be refund or review")
+	duplicatePaymentErrorWindowInvalid = newBillingServerErrorMsg("du000002", "window of duplicate payment policy must be positive")
+
+	duplicatePaymentActions = []string{internalPkg.DuplicatePaymentActionRefund, internalPkg.DuplicatePaymentActionReview}
+)
+
+func (s *Service) GetDuplicatePaymentPolicy(
+	ctx context.Context,
+	req *internalPkg.DuplicatePaymentPolicyRequest,
+	rsp *internalPkg.DuplicatePaymentPolicyResponse,
+) error {
+	if _, err := s.merchantRepository.GetById(ctx, req.MerchantId); err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = merchantErrorNotFound
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = s.getDuplicatePaymentPolicy(ctx, req.MerchantId)
+
+	return nil
+}
+
+// SetDuplicatePaymentPolicy overrides the default policy of duplicate payments for the merchant.
+func (s *Service) SetDuplicatePaymentPolicy(
+	ctx context.Context,
+	req *internalPkg.DuplicatePaymentPolicy,
+	rsp *internalPkg.DuplicatePaymentPolicyResponse,
+) error {
+	if !helper.Contains(duplicatePaymentActions, req.Action) {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = duplicatePaymentErrorActionInvalid
+		return nil
+	}
+
+	if req.Window <= 0 {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = duplicatePaymentErrorWindowInvalid
+		return nil
+	}
+
+	if _, err := s.merchantRepository.GetById(ctx, req.MerchantId); err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = merchantErrorNotFound
+		return nil
+	}
+
+	req.UpdatedAt = time.Now()
+
+	if err := s.duplicatePolicyRepository.Upsert(ctx, req.MerchantId, req); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = req
+
+	return nil
+}
+
+func (s *Service) ListDuplicatePayments(
+	ctx context.Context,
+	req *internalPkg.ListDuplicatePaymentsRequest,
+	rsp *internalPkg.ListDuplicatePaymentsResponse,
+) error {
+	if req.Limit <= 0 {
+		req.Limit = pkg.DatabaseRequestDefaultLimit
+	}
+
+	if req.Offset <= 0 {
+		req.Offset = 0
+	}
+
+	count, err := s.duplicatePaymentRepository.FindCount(ctx, req)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	if count > 0 {
+		rsp.Items, err = s.duplicatePaymentRepository.Find(ctx, req)
+
+		if err != nil {
+			rsp.Status = billingpb.ResponseStatusSystemError
+			rsp.Message = orderErrorUnknown
+			return nil
+		}
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Count = count
+
+	return nil
+}
+
+// getDuplicatePaymentPolicy returns duplicate payment policy of the merchant or the default policy
+// if merchant didn't override it.
+func (s *Service) getDuplicatePaymentPolicy(ctx context.Context, merchantId string) *internalPkg.DuplicatePaymentPolicy {
+	policy := &internalPkg.DuplicatePaymentPolicy{}
+	err := s.duplicatePolicyRepository.GetByOwnerId(ctx, merchantId, policy)
+
+	if err == nil {
+		return policy
+	}
+
+	if err != mongo.ErrNoDocuments {
+		zap.L().Error("duplicate payment policy of merchant not loaded", zap.Error(err), zap.String("merchant_id", merchantId))
+	}
+
+	return &internalPkg.DuplicatePaymentPolicy{
+		MerchantId: merchantId,
+		Action:     s.cfg.DuplicatePaymentAction,
+		Window:     s.cfg.DuplicatePaymentWindow,
+	}
+}
+
+// processDuplicatePayment checks that the order processed by payment system pays for the same purchase as other
+// order processed during the window of merchant policy. Duplicate order is refunded or left for review
+// of merchant depending on the policy, review is also required when the refund can't be created. Duplicate
+// payment is saved before the refund, so the order is refunded once if its callback is processed concurrently.
+func (s *Service) processDuplicatePayment(ctx context.Context, order *billingpb.Order) {
+	if order.ProjectOrderId == "" || order.GetUser().GetId() == "" {
+		return
+	}
+
+	policy := s.getDuplicatePaymentPolicy(ctx, order.GetMerchantId())
+	processedAfter := time.Now().Add(-time.Duration(policy.Window) * time.Second)
+	orders, err := s.orderRepository.FindProcessedByProjectOrderId(
+		ctx,
+		order.GetProjectId(),
+		order.ProjectOrderId,
+		processedAfter,
+	)
+
+	if err != nil {
+		return
+	}
+
+	original := getOriginalOrderOfDuplicate(order, orders)
+
+	if original == nil {
+		return
+	}
+
+	duplicate := &internalPkg.DuplicatePayment{
+		Id:                order.Id,
+		OrderUuid:         order.Uuid,
+		OriginalOrderId:   original.Id,
+		OriginalOrderUuid: original.Uuid,
+		MerchantId:        order.GetMerchantId(),
+		ProjectId:         order.GetProjectId(),
+		ProjectOrderId:    order.ProjectOrderId,
+		CustomerId:        order.GetUser().GetId(),
+		Amount:            order.OrderAmount,
+		Currency:          order.Currency,
+		Action:            policy.Action,
+		CreatedAt:         time.Now(),
+	}
+
+	claimed, err := s.duplicatePaymentRepository.Claim(ctx, duplicate)
+
+	if err != nil || !claimed {
+		return
+	}
+
+	if duplicate.Action == internalPkg.DuplicatePaymentActionRefund {
+		s.refundDuplicatePayment(ctx, order, duplicate)
+		_ = s.duplicatePaymentRepository.Update(ctx, duplicate)
+	}
+
+	if duplicate.Action == internalPkg.DuplicatePaymentActionReview {
+		s.notifyDuplicatePayment(ctx, duplicate)
+	}
+}
+
+// refundDuplicatePayment creates refund of the whole duplicate order, duplicate is moved to review
+// if refund failed.
+func (s *Service) refundDuplicatePayment(ctx context.Context, order *billingpb.Order, duplicate *internalPkg.DuplicatePayment) {
+	req := &billingpb.CreateRefundRequest{
+		OrderId:    order.Uuid,
+		Amount:     order.ChargeAmount,
+		Reason:     fmt.Sprintf(duplicatePaymentRefundReasonMask, duplicate.OriginalOrderUuid),
+		MerchantId: order.GetMerchantId(),
+	}
+	rsp := &billingpb.CreateRefundResponse{}
+	err := s.CreateRefund(ctx, req, rsp)
+
+	if err == nil && rsp.Status == billingpb.ResponseStatusOk {
+		duplicate.RefundId = rsp.Item.Id
+		return
+	}
+
+	msg := rsp.Message
+
+	if err != nil {
+		msg = refundErrorUnknown
+	}
+
+	zap.L().Error(
+		"Refund of duplicate payment failed",
+		zap.Error(err),
+		zap.String("order_id", order.Id),
+		zap.Any("message", msg),
+	)
+
+	duplicate.Action = internalPkg.DuplicatePaymentActionReview
+
+	if msg != nil {
+		duplicate.ErrorCode = msg.Code
+		duplicate.ErrorMessage = msg.Message
+	}
+}
+
+func (s *Service) notifyDuplicatePayment(ctx context.Context, duplicate *internalPkg.DuplicatePayment) {
+	msg := fmt.Sprintf(duplicatePaymentNotificationMask, duplicate.OrderUuid, duplicate.OriginalOrderUuid)
+
+	if _, err := s.addNotification(ctx, msg, duplicate.MerchantId, "", nil); err != nil {
+		zap.L().Error(
+			"Merchant notification about duplicate payment failed",
+			zap.Error(err),
+			zap.String("order_id", duplicate.Id),
+		)
+	}
+}
+
+// getOriginalOrderOfDuplicate returns the earliest order processed before the order which was paid by the same
+// customer for the same amount and products as the order.
+func getOriginalOrderOfDuplicate(order *billingpb.Order, orders []*billingpb.Order) *billingpb.Order {
+	var original *billingpb.Order
+
+	for _, o := range orders {
+		if o.Id == order.Id || o.GetUser().GetId() != order.GetUser().GetId() ||
+			o.OrderAmount != order.OrderAmount || o.Currency != order.Currency ||
+			!isSameProducts(o.Products, order.Products) || !isOrderClosedBefore(o, order) {
+			continue
+		}
+
+		if original == nil || isOrderClosedBefore(o, original) {
+			original = o
+		}
+	}
+
+	return original
+}
+
+func isSameProducts(products1, products2 []string) bool {
+	if len(products1) != len(products2) {
+		return false
+	}
+
+	sorted1 := append([]string(nil), products1...)
+	sorted2 := append([]string(nil), products2...)
+	sort.Strings(sorted1)
+	sort.Strings(sorted2)
+
+	for i := range sorted1 {
+		if sorted1[i] != sorted2[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isOrderClosedBefore(order1, order2 *billingpb.Order) bool {
+	closedAt1, err1 := ptypes.Timestamp(order1.PaymentMethodOrderClosedAt)
+	closedAt2, err2 := ptypes.Timestamp(order2.PaymentMethodOrderClosedAt)
+
+	return err1 == nil && (err2 != nil || closedAt1.Before(closedAt2))
+}
@@ -0,0 +1,376 @@
+package service
+
+import (
+	"context"
+	"github.com/go-redis/redis"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/mongodb"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	"github.com/paysuper/paysuper-billing-server/internal/database"
+	"github.com/paysuper/paysuper-billing-server/internal/mocks"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	casbinMocks "github.com/paysuper/paysuper-proto/go/casbinpb/mocks"
+	reportingMocks "github.com/paysuper/paysuper-proto/go/reporterpb/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	rabbitmq "gopkg.in/ProtocolONE/rabbitmq.v1/pkg"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"strings"
+	"testing"
+	"time"
+)
+
+type DuplicatePaymentTestSuite struct {
+	suite.Suite
+	service *Service
+	log     *zap.Logger
+	cache   database.CacheInterface
+
+	merchant      *billingpb.Merchant
+	project       *billingpb.Project
+	paymentMethod *billingpb.PaymentMethod
+	paymentSystem *billingpb.PaymentSystem
+}
+
+func Test_DuplicatePayment(t *testing.T) {
+	suite.Run(t, new(DuplicatePaymentTestSuite))
+}
+
+func (suite *DuplicatePaymentTestSuite) SetupTest() {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		suite.FailNow("Config load failed", "%v", err)
+	}
+	cfg.CardPayApiUrl = "https://sandbox.cardpay.com"
+
+	m, err := migrate.New(
+		"file://../../migrations/tests",
+		cfg.MongoDsn)
+	assert.NoError(suite.T(), err, "Migrate init failed")
+
+	err = m.Up()
+	if err != nil && err.Error() != "no change" {
+		suite.FailNow("Migrations failed", "%v", err)
+	}
+
+	ctx, _ := context.WithTimeout(context.Background(), 50*time.Second)
+	opts := []mongodb.Option{mongodb.Context(ctx)}
+	db, err := mongodb.NewDatabase(opts...)
+	if err != nil {
+		suite.FailNow("Database connection failed", "%v", err)
+	}
+
+	suite.log, err = zap.NewProduction()
+
+	if err != nil {
+		suite.FailNow("Logger initialization failed", "%v", err)
+	}
+
+	broker, err := rabbitmq.NewBroker(cfg.BrokerAddress)
+
+	if err != nil {
+		suite.FailNow("Creating RabbitMQ publisher failed", "%v", err)
+	}
+
+	redisClient := database.NewRedis(
+		&redis.Options{
+			Addr:     cfg.RedisHost,
+			Password: cfg.RedisPassword,
+		},
+	)
+
+	redisdb := mocks.NewTestRedis()
+	suite.cache, err = database.NewCacheRedis(redisdb, "cache")
+	suite.service = NewBillingService(
+		db,
+		cfg,
+		mocks.NewGeoIpServiceTestOk(),
+		mocks.NewRepositoryServiceOk(),
+		mocks.NewTaxServiceOkMock(),
+		broker,
+		redisClient,
+		suite.cache,
+		mocks.NewCurrencyServiceMockOk(),
+		mocks.NewDocumentSignerMockOk(),
+		&reportingMocks.ReporterService{},
+		mocks.NewFormatterOK(),
+		mocks.NewBrokerMockOk(),
+		&casbinMocks.CasbinService{},
+	)
+
+	if err := suite.service.Init(); err != nil {
+		suite.FailNow("Billing service initialization failed", "%v", err)
+	}
+
+	suite.merchant, suite.project, suite.paymentMethod, suite.paymentSystem = helperCreateEntitiesForTests(suite.Suite, suite.service)
+
+	centrifugoMock := &mocks.CentrifugoInterface{}
+	centrifugoMock.On("GetChannelToken", mock.Anything, mock.Anything).Return("token")
+	centrifugoMock.On("Publish", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	suite.service.centrifugoDashboard = centrifugoMock
+	suite.service.centrifugoPaymentForm = centrifugoMock
+}
+
+func (suite *DuplicatePaymentTestSuite) TearDownTest() {
+	err := suite.service.db.Drop()
+
+	if err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	err = suite.service.db.Close()
+
+	if err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *DuplicatePaymentTestSuite) TestDuplicatePayment_GetDuplicatePaymentPolicy_Default() {
+	req := &internalPkg.DuplicatePaymentPolicyRequest{MerchantId: suite.merchant.Id}
+	rsp := &internalPkg.DuplicatePaymentPolicyResponse{}
+	err := suite.service.GetDuplicatePaymentPolicy(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), suite.service.cfg.DuplicatePaymentAction, rsp.Item.Action)
+	assert.Equal(suite.T(), suite.service.cfg.DuplicatePaymentWindow, rsp.Item.Window)
+
+	req.MerchantId = primitive.NewObjectID().Hex()
+	err = suite.service.GetDuplicatePaymentPolicy(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), merchantErrorNotFound, rsp.Message)
+}
+
+func (suite *DuplicatePaymentTestSuite) TestDuplicatePayment_SetDuplicatePaymentPolicy_Ok() {
+	suite.setPolicy(internalPkg.DuplicatePaymentActionRefund, 600)
+
+	req := &internalPkg.DuplicatePaymentPolicyRequest{MerchantId: suite.merchant.Id}
+	rsp := &internalPkg.DuplicatePaymentPolicyResponse{}
+	err := suite.service.GetDuplicatePaymentPolicy(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), internalPkg.DuplicatePaymentActionRefund, rsp.Item.Action)
+	assert.EqualValues(suite.T(), 600, rsp.Item.Window)
+}
+
+func (suite *DuplicatePaymentTestSuite) TestDuplicatePayment_SetDuplicatePaymentPolicy_Invalid() {
+	policies := map[*internalPkg.DuplicatePaymentPolicy]*billingpb.ResponseErrorMessage{
+		{MerchantId: suite.merchant.Id, Action: "cancel", Window: 600}:                               duplicatePaymentErrorActionInvalid,
+		{MerchantId: suite.merchant.Id, Action: internalPkg.DuplicatePaymentActionReview, Window: 0}: duplicatePaymentErrorWindowInvalid,
+	}
+
+	for policy, message := range policies {
+		rsp := &internalPkg.DuplicatePaymentPolicyResponse{}
+		err := suite.service.SetDuplicatePaymentPolicy(context.TODO(), policy, rsp)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+		assert.Equal(suite.T(), message, rsp.Message)
+	}
+
+	policy := &internalPkg.DuplicatePaymentPolicy{
+		MerchantId: primitive.NewObjectID().Hex(),
+		Action:     internalPkg.DuplicatePaymentActionReview,
+		Window:     600,
+	}
+	rsp := &internalPkg.DuplicatePaymentPolicyResponse{}
+	err := suite.service.SetDuplicatePaymentPolicy(context.TODO(), policy, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+}
+
+func (suite *DuplicatePaymentTestSuite) TestDuplicatePayment_PaymentCallbackProcess_Review() {
+	original := suite.payOrder(suite.createOrder(100))
+	order := suite.createDuplicateOrder(original, 100)
+	order = suite.payOrder(order)
+
+	duplicates := suite.listDuplicatePayments()
+	assert.Len(suite.T(), duplicates, 1)
+	assert.Equal(suite.T(), order.Id, duplicates[0].Id)
+	assert.Equal(suite.T(), original.Id, duplicates[0].OriginalOrderId)
+	assert.Equal(suite.T(), original.ProjectOrderId, duplicates[0].ProjectOrderId)
+	assert.Equal(suite.T(), original.User.Id, duplicates[0].CustomerId)
+	assert.Equal(suite.T(), internalPkg.DuplicatePaymentActionReview, duplicates[0].Action)
+	assert.Empty(suite.T(), duplicates[0].RefundId)
+
+	req := &billingpb.ListingNotificationRequest{MerchantId: suite.merchant.Id, Limit: 100}
+	rsp := &billingpb.Notifications{}
+	err := suite.service.ListNotifications(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+
+	found := false
+
+	for _, notification := range rsp.Items {
+		if strings.Contains(notification.Message, order.Uuid) && strings.Contains(notification.Message, original.Uuid) {
+			found = true
+		}
+	}
+
+	assert.True(suite.T(), found)
+}
+
+func (suite *DuplicatePaymentTestSuite) TestDuplicatePayment_PaymentCallbackProcess_Refund() {
+	suite.setPolicy(internalPkg.DuplicatePaymentActionRefund, 600)
+
+	original := suite.payOrder(suite.createOrder(100))
+	order := suite.createDuplicateOrder(original, 100)
+	order = suite.payOrder(order)
+
+	duplicates := suite.listDuplicatePayments()
+	assert.Len(suite.T(), duplicates, 1)
+	assert.Equal(suite.T(), internalPkg.DuplicatePaymentActionRefund, duplicates[0].Action)
+	assert.NotEmpty(suite.T(), duplicates[0].RefundId)
+
+	refund, err := suite.service.refundRepository.GetById(context.TODO(), duplicates[0].RefundId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), order.Id, refund.OriginalOrder.Id)
+	assert.Equal(suite.T(), order.ChargeAmount, refund.Amount)
+	assert.Contains(suite.T(), refund.Reason, original.Uuid)
+
+	refunds, err := suite.service.refundRepository.FindByOrderUuid(context.TODO(), original.Uuid, 10, 0)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), refunds)
+}
+
+func (suite *DuplicatePaymentTestSuite) TestDuplicatePayment_ProcessDuplicatePayment_RefundedOnce() {
+	suite.setPolicy(internalPkg.DuplicatePaymentActionRefund, 600)
+
+	original := suite.payOrder(suite.createOrder(100))
+	order := suite.payOrder(suite.createDuplicateOrder(original, 100))
+
+	order, err := suite.service.orderRepository.GetById(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	suite.service.processDuplicatePayment(context.TODO(), order)
+
+	assert.Len(suite.T(), suite.listDuplicatePayments(), 1)
+
+	refunds, err := suite.service.refundRepository.FindByOrderUuid(context.TODO(), order.Uuid, 0, 0)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), refunds, 1)
+}
+
+func (suite *DuplicatePaymentTestSuite) TestDuplicatePayment_GetOriginalOrderOfDuplicate_ClosedBefore() {
+	closedAt, err := ptypes.TimestampProto(time.Now().Add(-time.Minute))
+	assert.NoError(suite.T(), err)
+	order := &billingpb.Order{
+		Id:                         primitive.NewObjectID().Hex(),
+		User:                       &billingpb.OrderUser{Id: primitive.NewObjectID().Hex()},
+		OrderAmount:                100,
+		Currency:                   "RUB",
+		PaymentMethodOrderClosedAt: closedAt,
+	}
+
+	later := &billingpb.Order{
+		Id:                         primitive.NewObjectID().Hex(),
+		User:                       order.User,
+		OrderAmount:                order.OrderAmount,
+		Currency:                   order.Currency,
+		PaymentMethodOrderClosedAt: ptypes.TimestampNow(),
+	}
+	assert.Nil(suite.T(), getOriginalOrderOfDuplicate(order, []*billingpb.Order{order, later}))
+
+	closedAt, err = ptypes.TimestampProto(time.Now().Add(-time.Hour))
+	assert.NoError(suite.T(), err)
+	earlier := &billingpb.Order{
+		Id:                         primitive.NewObjectID().Hex(),
+		User:                       order.User,
+		OrderAmount:                order.OrderAmount,
+		Currency:                   order.Currency,
+		PaymentMethodOrderClosedAt: closedAt,
+	}
+	assert.Equal(suite.T(), earlier, getOriginalOrderOfDuplicate(order, []*billingpb.Order{later, order, earlier}))
+}
+
+func (suite *DuplicatePaymentTestSuite) TestDuplicatePayment_PaymentCallbackProcess_DifferentAmount() {
+	suite.setPolicy(internalPkg.DuplicatePaymentActionRefund, 600)
+
+	original := suite.payOrder(suite.createOrder(100))
+	suite.payOrder(suite.createDuplicateOrder(original, 150))
+
+	assert.Empty(suite.T(), suite.listDuplicatePayments())
+}
+
+func (suite *DuplicatePaymentTestSuite) TestDuplicatePayment_PaymentCallbackProcess_OutsideWindow() {
+	suite.setPolicy(internalPkg.DuplicatePaymentActionRefund, 600)
+
+	original := suite.payOrder(suite.createOrder(100))
+	closedAt, err := ptypes.TimestampProto(time.Now().Add(-time.Hour))
+	assert.NoError(suite.T(), err)
+	original.PaymentMethodOrderClosedAt = closedAt
+	err = suite.service.orderRepository.Update(context.TODO(), original)
+	assert.NoError(suite.T(), err)
+
+	suite.payOrder(suite.createDuplicateOrder(original, 100))
+
+	assert.Empty(suite.T(), suite.listDuplicatePayments())
+}
+
+func (suite *DuplicatePaymentTestSuite) setPolicy(action string, window int64) {
+	policy := &internalPkg.DuplicatePaymentPolicy{
+		MerchantId: suite.merchant.Id,
+		Action:     action,
+		Window:     window,
+	}
+	rsp := &internalPkg.DuplicatePaymentPolicyResponse{}
+	err := suite.service.SetDuplicatePaymentPolicy(context.TODO(), policy, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+}
+
+func (suite *DuplicatePaymentTestSuite) createOrder(amount float64) *billingpb.Order {
+	req := &billingpb.OrderCreateRequest{
+		Type:        pkg.OrderType_simple,
+		ProjectId:   suite.project.Id,
+		Amount:      amount,
+		Currency:    "RUB",
+		Account:     "unit test",
+		Description: "unit test",
+		OrderId:     primitive.NewObjectID().Hex(),
+		User: &billingpb.OrderUser{
+			Id:    primitive.NewObjectID().Hex(),
+			Email: "test@unit.unit",
+			Ip:    "127.0.0.1",
+			Address: &billingpb.OrderBillingAddress{
+				Country: "RU",
+			},
+		},
+	}
+	rsp := &billingpb.OrderCreateProcessResponse{}
+	err := suite.service.OrderCreateProcess(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	return rsp.Item
+}
+
+// createDuplicateOrder creates order of the same customer with the project order identifier of original order,
+// which bypasses the check of project order identifier on order creation.
+func (suite *DuplicatePaymentTestSuite) createDuplicateOrder(original *billingpb.Order, amount float64) *billingpb.Order {
+	order := suite.createOrder(amount)
+	order.ProjectOrderId = original.ProjectOrderId
+	order.User.Id = original.User.Id
+	err := suite.service.orderRepository.Update(context.TODO(), order)
+	assert.NoError(suite.T(), err)
+
+	return order
+}
+
+func (suite *DuplicatePaymentTestSuite) payOrder(order *billingpb.Order) *billingpb.Order {
+	return helperPayOrder(suite.Suite, suite.service, order, suite.paymentMethod, "RU")
+}
+
+func (suite *DuplicatePaymentTestSuite) listDuplicatePayments() []*internalPkg.DuplicatePayment {
+	req := &internalPkg.ListDuplicatePaymentsRequest{MerchantId: suite.merchant.Id}
+	rsp := &internalPkg.ListDuplicatePaymentsResponse{}
+	err := suite.service.ListDuplicatePayments(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	return rsp.Items
+}
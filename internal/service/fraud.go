@@ -0,0 +1,348 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	orderPrivateMetadataKeyFraudCheckId    = "FraudCheckId"
+	orderPrivateMetadataKeyFraudScore      = "FraudScore"
+	orderPrivateMetadataKeyFraudDecision   = "FraudDecision"
+	orderPrivateMetadataKeyCardFingerprint = "CardFingerprint"
+
+	// Minimal number of payments of project in the currency to detect anomalous amount.
+	fraudAmountAnomalyMinPayments = 10
+)
+
+var (
+	fraudErrorPaymentBlocked       = newBillingServerErrorMsg("fr000001", "payment was declined by fraud screening")
+	fraudErrorScoresInvalid        = newBillingServerErrorMsg("fr000002", "review score of fraud policy must be positive and block score must be greater than or equal to it")
+	fraudErrorVelocityInvalid      = newBillingServerErrorMsg("fr000003", "velocity window and limit of fraud policy must be positive")
+	fraudErrorAmountAnomalyInvalid = newBillingServerErrorMsg("fr000004", "amount anomaly factor of fraud policy must be greater than 1 or zero to disable the rule")
+	fraudErrorCheckNotFound        = newBillingServerErrorMsg("fr000005", "fraud check of order not found")
+
+	// Score of the built-in rules of fraud screening.
+	fraudRuleScores = map[string]int32{
+		internalPkg.FraudRuleVelocityIp:                40,
+		internalPkg.FraudRuleVelocityEmail:             30,
+		internalPkg.FraudRuleVelocityCustomer:          30,
+		internalPkg.FraudRuleVelocityCard:              40,
+		internalPkg.FraudRuleBinIpCountryMismatch:      25,
+		internalPkg.FraudRuleBinBillingCountryMismatch: 20,
+		internalPkg.FraudRuleIpBillingCountryMismatch:  15,
+		internalPkg.FraudRuleDisposableEmail:           30,
+		internalPkg.FraudRuleAmountAnomaly:             25,
+	}
+)
+
+func (s *Service) GetFraudPolicy(
+	ctx context.Context,
+	req *internalPkg.FraudPolicyRequest,
+	rsp *internalPkg.FraudPolicyResponse,
+) error {
+	if _, err := s.project.GetById(ctx, req.ProjectId); err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = projectErrorNotFound
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = s.getFraudPolicy(ctx, req.ProjectId)
+
+	return nil
+}
+
+// SetFraudPolicy overrides the default fraud screening policy for the project.
+func (s *Service) SetFraudPolicy(
+	ctx context.Context,
+	req *internalPkg.FraudPolicy,
+	rsp *internalPkg.FraudPolicyResponse,
+) error {
+	if req.ReviewScore <= 0 || req.BlockScore < req.ReviewScore {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = fraudErrorScoresInvalid
+		return nil
+	}
+
+	if req.VelocityWindow <= 0 || req.VelocityLimit <= 0 {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = fraudErrorVelocityInvalid
+		return nil
+	}
+
+	if req.AmountAnomalyFactor != 0 && req.AmountAnomalyFactor <= 1 {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = fraudErrorAmountAnomalyInvalid
+		return nil
+	}
+
+	if _, err := s.project.GetById(ctx, req.ProjectId); err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = projectErrorNotFound
+		return nil
+	}
+
+	req.UpdatedAt = time.Now()
+
+	if err := s.fraudPolicyRepository.Upsert(ctx, req.ProjectId, req); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = req
+
+	return nil
+}
+
+func (s *Service) GetOrderFraudCheck(
+	ctx context.Context,
+	req *internalPkg.OrderFraudCheckRequest,
+	rsp *internalPkg.OrderFraudCheckResponse,
+) error {
+	check, err := s.orderFraudCheckRepository.GetByOrderId(ctx, req.OrderId)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			rsp.Status = billingpb.ResponseStatusNotFound
+			rsp.Message = fraudErrorCheckNotFound
+			return nil
+		}
+
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = check
+
+	return nil
+}
+
+// getFraudPolicy returns fraud policy of the project or the default policy if project didn't override it.
+func (s *Service) getFraudPolicy(ctx context.Context, projectId string) *internalPkg.FraudPolicy {
+	policy := &internalPkg.FraudPolicy{}
+	err := s.fraudPolicyRepository.GetByOwnerId(ctx, projectId, policy)
+
+	if err == nil {
+		return policy
+	}
+
+	if err != mongo.ErrNoDocuments {
+		zap.L().Error("fraud policy of project not loaded", zap.Error(err), zap.String("project_id", projectId))
+	}
+
+	return &internalPkg.FraudPolicy{
+		ProjectId:           projectId,
+		ReviewScore:         s.cfg.FraudReviewScore,
+		BlockScore:          s.cfg.FraudBlockScore,
+		VelocityWindow:      s.cfg.FraudVelocityWindow,
+		VelocityLimit:       s.cfg.FraudVelocityLimit,
+		AmountAnomalyFactor: s.cfg.FraudAmountAnomalyFactor,
+	}
+}
+
+// checkOrderFraud scores the payment attempt of order by the built-in rules and makes decision by the thresholds
+// of the project fraud policy. Result is stored for the velocity rules and its summary is stored on the order.
+func (s *Service) checkOrderFraud(ctx context.Context, order *billingpb.Order, ip string) *internalPkg.OrderFraudCheck {
+	policy := s.getFraudPolicy(ctx, order.Project.Id)
+	now := time.Now()
+
+	check := &internalPkg.OrderFraudCheck{
+		Id:              primitive.NewObjectID().Hex(),
+		OrderId:         order.Id,
+		OrderUuid:       order.Uuid,
+		ProjectId:       order.Project.Id,
+		Ip:              ip,
+		CardFingerprint: getOrderCardFingerprint(order),
+		Amount:          order.TotalPaymentAmount,
+		Currency:        order.Currency,
+		Rules:           []*internalPkg.FraudRuleTriggered{},
+		CreatedAt:       now,
+	}
+
+	if order.User != nil {
+		check.Email = strings.ToLower(order.User.Email)
+		check.CustomerId = order.User.Id
+	}
+
+	s.checkOrderFraudVelocity(ctx, check, policy)
+	checkOrderFraudCountries(check, order)
+	s.checkOrderFraudEmail(check)
+	s.checkOrderFraudAmount(ctx, check, policy)
+
+	for _, v := range check.Rules {
+		check.Score += v.Score
+	}
+
+	switch {
+	case check.Score >= policy.BlockScore:
+		check.Decision = internalPkg.FraudDecisionBlock
+	case check.Score >= policy.ReviewScore:
+		check.Decision = internalPkg.FraudDecisionReview
+	default:
+		check.Decision = internalPkg.FraudDecisionAllow
+	}
+
+	if err := s.orderFraudCheckRepository.Insert(ctx, check); err != nil {
+		return check
+	}
+
+	if order.PrivateMetadata == nil {
+		order.PrivateMetadata = make(map[string]string)
+	}
+
+	order.PrivateMetadata[orderPrivateMetadataKeyFraudCheckId] = check.Id
+	order.PrivateMetadata[orderPrivateMetadataKeyFraudScore] = strconv.Itoa(int(check.Score))
+	order.PrivateMetadata[orderPrivateMetadataKeyFraudDecision] = check.Decision
+
+	return check
+}
+
+func (s *Service) checkOrderFraudVelocity(
+	ctx context.Context,
+	check *internalPkg.OrderFraudCheck,
+	policy *internalPkg.FraudPolicy,
+) {
+	since := check.CreatedAt.Add(-time.Duration(policy.VelocityWindow) * time.Second)
+	identities := []struct {
+		rule, field, value string
+	}{
+		{internalPkg.FraudRuleVelocityIp, "ip", check.Ip},
+		{internalPkg.FraudRuleVelocityEmail, "email", check.Email},
+		{internalPkg.FraudRuleVelocityCustomer, "customer_id", check.CustomerId},
+		{internalPkg.FraudRuleVelocityCard, "card_fingerprint", check.CardFingerprint},
+	}
+
+	for _, v := range identities {
+		if v.value == "" {
+			continue
+		}
+
+		count, err := s.orderFraudCheckRepository.CountSince(ctx, v.field, v.value, since)
+
+		if err != nil || count < int64(policy.VelocityLimit) {
+			continue
+		}
+
+		details := fmt.Sprintf("%d payment attempts during %d seconds", count+1, policy.VelocityWindow)
+		addFraudRule(check, v.rule, details)
+	}
+}
+
+func checkOrderFraudCountries(check *internalPkg.OrderFraudCheck, order *billingpb.Order) {
+	binCountry := order.PaymentRequisites[billingpb.PaymentCreateBankCardFieldIssuerCountryIsoCode]
+	ipCountry := order.PaymentIpCountry
+	billingCountry := order.GetCountry()
+
+	if binCountry != "" && ipCountry != "" && binCountry != ipCountry {
+		addFraudRule(check, internalPkg.FraudRuleBinIpCountryMismatch, binCountry+" != "+ipCountry)
+	}
+
+	if binCountry != "" && billingCountry != "" && binCountry != billingCountry {
+		addFraudRule(check, internalPkg.FraudRuleBinBillingCountryMismatch, binCountry+" != "+billingCountry)
+	}
+
+	if ipCountry != "" && billingCountry != "" && ipCountry != billingCountry {
+		addFraudRule(check, internalPkg.FraudRuleIpBillingCountryMismatch, ipCountry+" != "+billingCountry)
+	}
+}
+
+func (s *Service) checkOrderFraudEmail(check *internalPkg.OrderFraudCheck) {
+	i := strings.LastIndex(check.Email, "@")
+
+	if i < 0 {
+		return
+	}
+
+	domain := check.Email[i+1:]
+
+	for _, v := range s.cfg.FraudDisposableEmailDomains {
+		if strings.ToLower(v) == domain {
+			addFraudRule(check, internalPkg.FraudRuleDisposableEmail, domain)
+			return
+		}
+	}
+}
+
+func (s *Service) checkOrderFraudAmount(
+	ctx context.Context,
+	check *internalPkg.OrderFraudCheck,
+	policy *internalPkg.FraudPolicy,
+) {
+	if policy.AmountAnomalyFactor <= 0 {
+		return
+	}
+
+	since := check.CreatedAt.Add(-time.Duration(s.cfg.FraudAmountAnomalyPeriod) * time.Second)
+	average, count, err := s.orderFraudCheckRepository.GetAverageAmount(ctx, check.ProjectId, check.Currency, since)
+
+	if err != nil || count < fraudAmountAnomalyMinPayments {
+		return
+	}
+
+	if check.Amount > average*policy.AmountAnomalyFactor {
+		details := fmt.Sprintf("amount %.2f exceeds average amount %.2f %s", check.Amount, average, check.Currency)
+		addFraudRule(check, internalPkg.FraudRuleAmountAnomaly, details)
+	}
+}
+
+func addFraudRule(check *internalPkg.OrderFraudCheck, rule, details string) {
+	check.Rules = append(check.Rules, &internalPkg.FraudRuleTriggered{
+		Rule:    rule,
+		Score:   fraudRuleScores[rule],
+		Details: details,
+	})
+}
+
+// setOrderCardFingerprint stores fingerprint of the bank card of order payment on the order. Stored card is
+// identified by its recurring identifier of payment system, new card by keyed hash of the full card number,
+// so masked numbers of different cards with the same expiration date don't share fingerprint.
+func (s *Service) setOrderCardFingerprint(order *billingpb.Order, data map[string]string) {
+	var value string
+
+	if recurringId := data[billingpb.PaymentCreateFieldRecurringId]; recurringId != "" {
+		hash := sha256.Sum256([]byte(recurringId))
+		value = hex.EncodeToString(hash[:])
+	} else if pan := data[billingpb.PaymentCreateFieldPan]; pan != "" {
+		mac := hmac.New(sha256.New, []byte(s.cfg.FraudCardFingerprintKey))
+		mac.Write([]byte(pan))
+		value = hex.EncodeToString(mac.Sum(nil))
+	}
+
+	if value == "" {
+		return
+	}
+
+	if order.PrivateMetadata == nil {
+		order.PrivateMetadata = make(map[string]string)
+	}
+
+	order.PrivateMetadata[orderPrivateMetadataKeyCardFingerprint] = value
+}
+
+// getOrderCardFingerprint returns fingerprint of the bank card of order payment or empty string if payment
+// isn't made by bank card.
+func getOrderCardFingerprint(order *billingpb.Order) string {
+	return order.PrivateMetadata[orderPrivateMetadataKeyCardFingerprint]
+}
+
+// isOrderFraudReview checks that payment of order was marked for review by fraud screening. Payment of such
+// order is only authorized and held until it's captured or voided manually or by the authorization expiration.
+func isOrderFraudReview(order *billingpb.Order) bool {
+	return order.PrivateMetadata[orderPrivateMetadataKeyFraudDecision] == internalPkg.FraudDecisionReview
+}
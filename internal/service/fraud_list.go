@@ -0,0 +1,607 @@
+package service
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// Maximal number of entries in one bulk import.
+	fraudListImportMaxEntries = 10000
+
+	// Maximal length of BIN prefix, card number is stored masked with first 6 digits only.
+	fraudListBinMaxLength = 6
+)
+
+var (
+	fraudListErrorBlocked            = newBillingServerErrorMsg("fl000001", "payment was declined by block list")
+	fraudListErrorListInvalid        = newBillingServerErrorMsg("fl000002", "list of entry must be block or allow")
+	fraudListErrorTypeInvalid        = newBillingServerErrorMsg("fl000003", "type of list entry is unknown")
+	fraudListErrorValueInvalid       = newBillingServerErrorMsg("fl000004", "value of list entry is invalid for its type")
+	fraudListErrorEntryNotFound      = newBillingServerErrorMsg("fl000005", "list entry not found")
+	fraudListErrorEntryAlreadyExists = newBillingServerErrorMsg("fl000006", "list entry with the same type and value already exists")
+	fraudListErrorImportEmpty        = newBillingServerErrorMsg("fl000007", "list of imported entries is empty")
+	fraudListErrorImportTooLarge     = newBillingServerErrorMsg("fl000008", "too many entries in one import")
+
+	fraudListBinRegex             = regexp.MustCompile("^[0-9]{1,6}$")
+	fraudListCardFingerprintRegex = regexp.MustCompile("^[0-9a-f]{64}$")
+	fraudListCountryRegex         = regexp.MustCompile("^[A-Z]{2}$")
+)
+
+func (s *Service) CreateFraudListEntry(
+	ctx context.Context,
+	req *internalPkg.FraudListEntry,
+	rsp *internalPkg.FraudListEntryResponse,
+) error {
+	if err := validateFraudListEntry(req); err != nil {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = err
+		return nil
+	}
+
+	if req.MerchantId != "" {
+		if _, err := s.merchantRepository.GetById(ctx, req.MerchantId); err != nil {
+			rsp.Status = billingpb.ResponseStatusNotFound
+			rsp.Message = merchantErrorNotFound
+			return nil
+		}
+	}
+
+	_, err := s.fraudListEntryRepository.GetByValue(ctx, req.MerchantId, req.Type, req.Value)
+
+	if err == nil {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = fraudListErrorEntryAlreadyExists
+		return nil
+	}
+
+	if err != mongo.ErrNoDocuments {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	req.Id = primitive.NewObjectID().Hex()
+	req.Hits = 0
+	req.LastHitAt = nil
+	req.CreatedAt = time.Now()
+	req.UpdatedAt = req.CreatedAt
+
+	if err = s.fraudListEntryRepository.Insert(ctx, req); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = req
+
+	return nil
+}
+
+// UpdateFraudListEntry changes list, value or comment of the entry, merchant and hit counter of entry are kept.
+func (s *Service) UpdateFraudListEntry(
+	ctx context.Context,
+	req *internalPkg.FraudListEntry,
+	rsp *internalPkg.FraudListEntryResponse,
+) error {
+	entry, err := s.fraudListEntryRepository.GetById(ctx, req.Id)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = fraudListErrorEntryNotFound
+		return nil
+	}
+
+	req.MerchantId = entry.MerchantId
+
+	if err := validateFraudListEntry(req); err != nil {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = err
+		return nil
+	}
+
+	if req.Type != entry.Type || req.Value != entry.Value {
+		_, err = s.fraudListEntryRepository.GetByValue(ctx, entry.MerchantId, req.Type, req.Value)
+
+		if err == nil {
+			rsp.Status = billingpb.ResponseStatusBadData
+			rsp.Message = fraudListErrorEntryAlreadyExists
+			return nil
+		}
+
+		if err != mongo.ErrNoDocuments {
+			rsp.Status = billingpb.ResponseStatusSystemError
+			rsp.Message = orderErrorUnknown
+			return nil
+		}
+	}
+
+	entry.List = req.List
+	entry.Type = req.Type
+	entry.Value = req.Value
+	entry.RangeStart = req.RangeStart
+	entry.RangeEnd = req.RangeEnd
+	entry.Comment = req.Comment
+	entry.UpdatedAt = time.Now()
+
+	if err = s.fraudListEntryRepository.Update(ctx, entry); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = entry
+
+	return nil
+}
+
+func (s *Service) DeleteFraudListEntry(
+	ctx context.Context,
+	req *internalPkg.FraudListEntryRequest,
+	rsp *internalPkg.FraudListEntryResponse,
+) error {
+	entry, err := s.fraudListEntryRepository.GetById(ctx, req.Id)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = fraudListErrorEntryNotFound
+		return nil
+	}
+
+	if err = s.fraudListEntryRepository.Delete(ctx, entry.Id); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = entry
+
+	return nil
+}
+
+func (s *Service) GetFraudListEntry(
+	ctx context.Context,
+	req *internalPkg.FraudListEntryRequest,
+	rsp *internalPkg.FraudListEntryResponse,
+) error {
+	entry, err := s.fraudListEntryRepository.GetById(ctx, req.Id)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = fraudListErrorEntryNotFound
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = entry
+
+	return nil
+}
+
+func (s *Service) ListFraudListEntries(
+	ctx context.Context,
+	req *internalPkg.ListFraudListEntriesRequest,
+	rsp *internalPkg.ListFraudListEntriesResponse,
+) error {
+	if req.Limit <= 0 {
+		req.Limit = pkg.DatabaseRequestDefaultLimit
+	}
+
+	if req.Offset <= 0 {
+		req.Offset = 0
+	}
+
+	count, err := s.fraudListEntryRepository.FindCount(ctx, req)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	if count > 0 {
+		rsp.Items, err = s.fraudListEntryRepository.Find(ctx, req)
+
+		if err != nil {
+			rsp.Status = billingpb.ResponseStatusSystemError
+			rsp.Message = orderErrorUnknown
+			return nil
+		}
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Count = count
+
+	return nil
+}
+
+// ImportFraudListEntries adds entries to the list in bulk. Invalid entries are returned with errors, entries
+// which already exist in the lists of the merchant are skipped, other entries are imported.
+func (s *Service) ImportFraudListEntries(
+	ctx context.Context,
+	req *internalPkg.ImportFraudListEntriesRequest,
+	rsp *internalPkg.ImportFraudListEntriesResponse,
+) error {
+	if req.List != internalPkg.FraudListBlock && req.List != internalPkg.FraudListAllow {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = fraudListErrorListInvalid
+		return nil
+	}
+
+	if len(req.Entries) <= 0 {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = fraudListErrorImportEmpty
+		return nil
+	}
+
+	if len(req.Entries) > fraudListImportMaxEntries {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = fraudListErrorImportTooLarge
+		return nil
+	}
+
+	if req.MerchantId != "" {
+		if _, err := s.merchantRepository.GetById(ctx, req.MerchantId); err != nil {
+			rsp.Status = billingpb.ResponseStatusNotFound
+			rsp.Message = merchantErrorNotFound
+			return nil
+		}
+	}
+
+	now := time.Now()
+	imported := make(map[string]bool)
+	var entries []*internalPkg.FraudListEntry
+
+	for i, v := range req.Entries {
+		entry := &internalPkg.FraudListEntry{
+			Id:         primitive.NewObjectID().Hex(),
+			MerchantId: req.MerchantId,
+			List:       req.List,
+			Type:       v.Type,
+			Value:      v.Value,
+			Comment:    v.Comment,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+
+		if err := validateFraudListEntry(entry); err != nil {
+			rsp.Errors = append(rsp.Errors, &internalPkg.FraudListImportError{Index: int32(i), Value: v.Value, Message: err})
+			continue
+		}
+
+		key := entry.Type + ":" + entry.Value
+
+		if imported[key] {
+			rsp.Skipped++
+			continue
+		}
+
+		imported[key] = true
+		_, err := s.fraudListEntryRepository.GetByValue(ctx, entry.MerchantId, entry.Type, entry.Value)
+
+		if err == nil {
+			rsp.Skipped++
+			continue
+		}
+
+		if err != mongo.ErrNoDocuments {
+			rsp.Status = billingpb.ResponseStatusSystemError
+			rsp.Message = orderErrorUnknown
+			return nil
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if len(entries) > 0 {
+		if err := s.fraudListEntryRepository.MultipleInsert(ctx, entries); err != nil {
+			rsp.Status = billingpb.ResponseStatusSystemError
+			rsp.Message = orderErrorUnknown
+			return nil
+		}
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Imported = int32(len(entries))
+
+	return nil
+}
+
+func (s *Service) ListFraudListBlockedAttempts(
+	ctx context.Context,
+	req *internalPkg.ListFraudListBlockedAttemptsRequest,
+	rsp *internalPkg.ListFraudListBlockedAttemptsResponse,
+) error {
+	if req.Limit <= 0 {
+		req.Limit = pkg.DatabaseRequestDefaultLimit
+	}
+
+	if req.Offset <= 0 {
+		req.Offset = 0
+	}
+
+	count, err := s.fraudListAttemptRepository.FindCount(ctx, req)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	if count > 0 {
+		rsp.Items, err = s.fraudListAttemptRepository.Find(ctx, req)
+
+		if err != nil {
+			rsp.Status = billingpb.ResponseStatusSystemError
+			rsp.Message = orderErrorUnknown
+			return nil
+		}
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Count = count
+
+	return nil
+}
+
+// validateFraudListEntry checks list and type of the entry and normalizes its value, e.g. single IP address
+// is stored as is and IP range is stored by its network address.
+func validateFraudListEntry(entry *internalPkg.FraudListEntry) *billingpb.ResponseErrorMessage {
+	if entry.List != internalPkg.FraudListBlock && entry.List != internalPkg.FraudListAllow {
+		return fraudListErrorListInvalid
+	}
+
+	value := strings.TrimSpace(entry.Value)
+	entry.RangeStart = ""
+	entry.RangeEnd = ""
+
+	switch entry.Type {
+	case internalPkg.FraudListEntryTypeEmail:
+		value = strings.ToLower(value)
+		i := strings.LastIndex(value, "@")
+
+		if i <= 0 || i == len(value)-1 {
+			return fraudListErrorValueInvalid
+		}
+	case internalPkg.FraudListEntryTypeIp:
+		if strings.Contains(value, "/") {
+			_, ipNet, err := net.ParseCIDR(value)
+
+			if err != nil {
+				return fraudListErrorValueInvalid
+			}
+
+			value = ipNet.String()
+			last := make(net.IP, len(ipNet.IP))
+
+			for i := range ipNet.IP {
+				last[i] = ipNet.IP[i] | ^ipNet.Mask[i]
+			}
+
+			entry.RangeStart = internalPkg.GetFraudListIpRangeKey(ipNet.IP)
+			entry.RangeEnd = internalPkg.GetFraudListIpRangeKey(last)
+		} else {
+			ip := net.ParseIP(value)
+
+			if ip == nil {
+				return fraudListErrorValueInvalid
+			}
+
+			value = ip.String()
+		}
+	case internalPkg.FraudListEntryTypeBin:
+		if !fraudListBinRegex.MatchString(value) {
+			return fraudListErrorValueInvalid
+		}
+	case internalPkg.FraudListEntryTypeCardFingerprint:
+		value = strings.ToLower(value)
+
+		if !fraudListCardFingerprintRegex.MatchString(value) {
+			return fraudListErrorValueInvalid
+		}
+	case internalPkg.FraudListEntryTypeCustomerId:
+		if value == "" {
+			return fraudListErrorValueInvalid
+		}
+	case internalPkg.FraudListEntryTypeCountry:
+		value = strings.ToUpper(value)
+
+		if !fraudListCountryRegex.MatchString(value) {
+			return fraudListErrorValueInvalid
+		}
+	default:
+		return fraudListErrorTypeInvalid
+	}
+
+	entry.Value = value
+
+	return nil
+}
+
+// checkFraudLists matches the order attempt against the block and allow lists of the order merchant and
+// the platform-wide lists. Match of the platform-wide block list declines attempt regardless of allow lists,
+// match of the allow list takes precedence over match of the merchant block list only. Allow lists don't exempt
+// attempt from fraud screening. Attempt declined by the block list is stored with the matched entry, attempt
+// of order creation is stored without order which isn't created. Lists aren't checked on database errors.
+func (s *Service) checkFraudLists(
+	ctx context.Context,
+	order *billingpb.Order,
+	ip, stage string,
+) *internalPkg.FraudListEntry {
+	values := getOrderFraudListValues(order, ip)
+	entries, err := s.fraudListEntryRepository.FindByValues(ctx, order.GetMerchantId(), values)
+
+	if err != nil || len(entries) <= 0 {
+		return nil
+	}
+
+	var platformBlocked, merchantBlocked, allowed []*internalPkg.FraudListEntry
+	matchedValues := map[string]string{}
+
+	for _, entry := range entries {
+		value, ok := matchFraudListEntry(entry, values)
+
+		if !ok {
+			continue
+		}
+
+		matchedValues[entry.Id] = value
+
+		switch {
+		case entry.List == internalPkg.FraudListAllow:
+			allowed = append(allowed, entry)
+		case entry.MerchantId == "":
+			platformBlocked = append(platformBlocked, entry)
+		default:
+			merchantBlocked = append(merchantBlocked, entry)
+		}
+	}
+
+	matched := platformBlocked
+
+	if len(matched) <= 0 {
+		matched = allowed
+	}
+
+	if len(matched) <= 0 {
+		matched = merchantBlocked
+	}
+
+	if len(matched) <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	ids := make([]string, len(matched))
+
+	for i, entry := range matched {
+		ids[i] = entry.Id
+	}
+
+	_ = s.fraudListEntryRepository.IncrementHits(ctx, ids, now)
+
+	entry := matched[0]
+
+	if entry.List == internalPkg.FraudListAllow {
+		return nil
+	}
+
+	attempt := &internalPkg.FraudListBlockedAttempt{
+		Id:             primitive.NewObjectID().Hex(),
+		EntryId:        entry.Id,
+		MerchantId:     order.GetMerchantId(),
+		ProjectId:      order.GetProjectId(),
+		ProjectOrderId: order.ProjectOrderId,
+		Stage:          stage,
+		Type:           entry.Type,
+		Value:          entry.Value,
+		MatchedValue:   matchedValues[entry.Id],
+		CreatedAt:      now,
+	}
+
+	if stage != internalPkg.FraudListStageOrderCreate {
+		attempt.OrderId = order.Id
+		attempt.OrderUuid = order.Uuid
+	}
+
+	if err = s.fraudListAttemptRepository.Insert(ctx, attempt); err != nil {
+		zap.L().Error("blocked attempt not stored", zap.Error(err), zap.Any("attempt", attempt))
+	}
+
+	return entry
+}
+
+// getOrderFraudListValues returns values of the order attempt by types of list entries. BIN values are all
+// prefixes of the card number to be matched by the prefixes stored in the lists.
+func getOrderFraudListValues(order *billingpb.Order, ip string) map[string][]string {
+	values := map[string][]string{}
+	add := func(entryType, value string) {
+		if value != "" {
+			values[entryType] = append(values[entryType], value)
+		}
+	}
+
+	if order.User != nil {
+		add(internalPkg.FraudListEntryTypeEmail, strings.ToLower(order.User.Email))
+		add(internalPkg.FraudListEntryTypeCustomerId, order.User.Id)
+		add(internalPkg.FraudListEntryTypeCustomerId, order.User.ExternalId)
+
+		if ip == "" {
+			ip = order.User.Ip
+		}
+	}
+
+	if parsed := net.ParseIP(ip); parsed != nil {
+		add(internalPkg.FraudListEntryTypeIp, parsed.String())
+	}
+
+	add(internalPkg.FraudListEntryTypeCountry, order.GetCountry())
+
+	if order.PaymentIpCountry != order.GetCountry() {
+		add(internalPkg.FraudListEntryTypeCountry, order.PaymentIpCountry)
+	}
+
+	if order.PaymentRequisites == nil {
+		return values
+	}
+
+	binCountry := order.PaymentRequisites[billingpb.PaymentCreateBankCardFieldIssuerCountryIsoCode]
+
+	if binCountry != order.GetCountry() && binCountry != order.PaymentIpCountry {
+		add(internalPkg.FraudListEntryTypeCountry, binCountry)
+	}
+
+	pan := order.PaymentRequisites[billingpb.PaymentCreateFieldPan]
+
+	for i := 1; i <= fraudListBinMaxLength && i <= len(pan); i++ {
+		if pan[i-1] < '0' || pan[i-1] > '9' {
+			break
+		}
+
+		add(internalPkg.FraudListEntryTypeBin, pan[:i])
+	}
+
+	add(internalPkg.FraudListEntryTypeCardFingerprint, getOrderCardFingerprint(order))
+
+	return values
+}
+
+// matchFraudListEntry returns the value of attempt matched by the entry. IP entry with range matches any
+// address of the range, other entries match equal values.
+func matchFraudListEntry(entry *internalPkg.FraudListEntry, values map[string][]string) (string, bool) {
+	var ipNet *net.IPNet
+
+	if entry.Type == internalPkg.FraudListEntryTypeIp && strings.Contains(entry.Value, "/") {
+		_, n, err := net.ParseCIDR(entry.Value)
+
+		if err != nil {
+			return "", false
+		}
+
+		ipNet = n
+	}
+
+	for _, v := range values[entry.Type] {
+		if ipNet != nil && ipNet.Contains(net.ParseIP(v)) {
+			return v, true
+		}
+
+		if ipNet == nil && v == entry.Value {
+			return v, true
+		}
+	}
+
+	return "", false
+}
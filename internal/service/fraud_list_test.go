@@ -0,0 +1,538 @@
+package service
+
+import (
+	"context"
+	"github.com/go-redis/redis"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/mongodb"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	"github.com/paysuper/paysuper-billing-server/internal/database"
+	"github.com/paysuper/paysuper-billing-server/internal/mocks"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	casbinMocks "github.com/paysuper/paysuper-proto/go/casbinpb/mocks"
+	reportingMocks "github.com/paysuper/paysuper-proto/go/reporterpb/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	rabbitmq "gopkg.in/ProtocolONE/rabbitmq.v1/pkg"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"net"
+	"testing"
+	"time"
+)
+
+type FraudListTestSuite struct {
+	suite.Suite
+	service *Service
+	log     *zap.Logger
+	cache   database.CacheInterface
+
+	merchant      *billingpb.Merchant
+	project       *billingpb.Project
+	paymentMethod *billingpb.PaymentMethod
+	paymentSystem *billingpb.PaymentSystem
+}
+
+func Test_FraudList(t *testing.T) {
+	suite.Run(t, new(FraudListTestSuite))
+}
+
+func (suite *FraudListTestSuite) SetupTest() {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		suite.FailNow("Config load failed", "%v", err)
+	}
+	cfg.CardPayApiUrl = "https://sandbox.cardpay.com"
+
+	m, err := migrate.New(
+		"file://../../migrations/tests",
+		cfg.MongoDsn)
+	assert.NoError(suite.T(), err, "Migrate init failed")
+
+	err = m.Up()
+	if err != nil && err.Error() != "no change" {
+		suite.FailNow("Migrations failed", "%v", err)
+	}
+
+	ctx, _ := context.WithTimeout(context.Background(), 50*time.Second)
+	opts := []mongodb.Option{mongodb.Context(ctx)}
+	db, err := mongodb.NewDatabase(opts...)
+	if err != nil {
+		suite.FailNow("Database connection failed", "%v", err)
+	}
+
+	suite.log, err = zap.NewProduction()
+
+	if err != nil {
+		suite.FailNow("Logger initialization failed", "%v", err)
+	}
+
+	broker, err := rabbitmq.NewBroker(cfg.BrokerAddress)
+
+	if err != nil {
+		suite.FailNow("Creating RabbitMQ publisher failed", "%v", err)
+	}
+
+	redisClient := database.NewRedis(
+		&redis.Options{
+			Addr:     cfg.RedisHost,
+			Password: cfg.RedisPassword,
+		},
+	)
+
+	redisdb := mocks.NewTestRedis()
+	suite.cache, err = database.NewCacheRedis(redisdb, "cache")
+	suite.service = NewBillingService(
+		db,
+		cfg,
+		mocks.NewGeoIpServiceTestOk(),
+		mocks.NewRepositoryServiceOk(),
+		mocks.NewTaxServiceOkMock(),
+		broker,
+		redisClient,
+		suite.cache,
+		mocks.NewCurrencyServiceMockOk(),
+		mocks.NewDocumentSignerMockOk(),
+		&reportingMocks.ReporterService{},
+		mocks.NewFormatterOK(),
+		mocks.NewBrokerMockOk(),
+		&casbinMocks.CasbinService{},
+	)
+
+	if err := suite.service.Init(); err != nil {
+		suite.FailNow("Billing service initialization failed", "%v", err)
+	}
+
+	suite.merchant, suite.project, suite.paymentMethod, suite.paymentSystem = helperCreateEntitiesForTests(suite.Suite, suite.service)
+
+	centrifugoMock := &mocks.CentrifugoInterface{}
+	centrifugoMock.On("GetChannelToken", mock.Anything, mock.Anything).Return("token")
+	centrifugoMock.On("Publish", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	suite.service.centrifugoDashboard = centrifugoMock
+	suite.service.centrifugoPaymentForm = centrifugoMock
+}
+
+func (suite *FraudListTestSuite) TearDownTest() {
+	err := suite.service.db.Drop()
+
+	if err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	err = suite.service.db.Close()
+
+	if err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *FraudListTestSuite) TestFraudList_CreateFraudListEntry_Ok() {
+	req := suite.getEntry(internalPkg.FraudListEntryTypeIp, " 10.20.30.40/16 ")
+	rsp := &internalPkg.FraudListEntryResponse{}
+	err := suite.service.CreateFraudListEntry(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.NotEmpty(suite.T(), rsp.Item.Id)
+	assert.Equal(suite.T(), "10.20.0.0/16", rsp.Item.Value)
+
+	rsp1 := &internalPkg.FraudListEntryResponse{}
+	err = suite.service.GetFraudListEntry(context.TODO(), &internalPkg.FraudListEntryRequest{Id: rsp.Item.Id}, rsp1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp1.Status)
+	assert.Equal(suite.T(), suite.merchant.Id, rsp1.Item.MerchantId)
+	assert.Equal(suite.T(), internalPkg.FraudListBlock, rsp1.Item.List)
+}
+
+func (suite *FraudListTestSuite) TestFraudList_CreateFraudListEntry_ValueInvalid() {
+	values := map[string]string{
+		internalPkg.FraudListEntryTypeEmail:           "unit.unit",
+		internalPkg.FraudListEntryTypeIp:              "127.0.0.256",
+		internalPkg.FraudListEntryTypeBin:             "4000000",
+		internalPkg.FraudListEntryTypeCardFingerprint: "fingerprint",
+		internalPkg.FraudListEntryTypeCustomerId:      " ",
+		internalPkg.FraudListEntryTypeCountry:         "RUS",
+	}
+
+	for entryType, value := range values {
+		rsp := &internalPkg.FraudListEntryResponse{}
+		err := suite.service.CreateFraudListEntry(context.TODO(), suite.getEntry(entryType, value), rsp)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status, entryType)
+		assert.Equal(suite.T(), fraudListErrorValueInvalid, rsp.Message, entryType)
+	}
+}
+
+func (suite *FraudListTestSuite) TestFraudList_CreateFraudListEntry_ListOrTypeInvalid() {
+	req := suite.getEntry(internalPkg.FraudListEntryTypeCountry, "RU")
+	req.List = "unknown"
+	rsp := &internalPkg.FraudListEntryResponse{}
+	err := suite.service.CreateFraudListEntry(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), fraudListErrorListInvalid, rsp.Message)
+
+	req = suite.getEntry("unknown", "RU")
+	err = suite.service.CreateFraudListEntry(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), fraudListErrorTypeInvalid, rsp.Message)
+}
+
+func (suite *FraudListTestSuite) TestFraudList_CreateFraudListEntry_MerchantNotFound() {
+	req := suite.getEntry(internalPkg.FraudListEntryTypeCountry, "RU")
+	req.MerchantId = primitive.NewObjectID().Hex()
+	rsp := &internalPkg.FraudListEntryResponse{}
+	err := suite.service.CreateFraudListEntry(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), merchantErrorNotFound, rsp.Message)
+}
+
+func (suite *FraudListTestSuite) TestFraudList_CreateFraudListEntry_AlreadyExists() {
+	rsp := &internalPkg.FraudListEntryResponse{}
+	err := suite.service.CreateFraudListEntry(context.TODO(), suite.getEntry(internalPkg.FraudListEntryTypeCountry, "RU"), rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	req := suite.getEntry(internalPkg.FraudListEntryTypeCountry, "ru")
+	req.List = internalPkg.FraudListAllow
+	err = suite.service.CreateFraudListEntry(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), fraudListErrorEntryAlreadyExists, rsp.Message)
+
+	req = suite.getEntry(internalPkg.FraudListEntryTypeCountry, "RU")
+	req.MerchantId = ""
+	err = suite.service.CreateFraudListEntry(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+}
+
+func (suite *FraudListTestSuite) TestFraudList_UpdateDeleteFraudListEntry_Ok() {
+	rsp := &internalPkg.FraudListEntryResponse{}
+	err := suite.service.CreateFraudListEntry(context.TODO(), suite.getEntry(internalPkg.FraudListEntryTypeEmail, "test@unit.unit"), rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	req := &internalPkg.FraudListEntry{
+		Id:         rsp.Item.Id,
+		MerchantId: primitive.NewObjectID().Hex(),
+		List:       internalPkg.FraudListAllow,
+		Type:       internalPkg.FraudListEntryTypeEmail,
+		Value:      "Trusted@Unit.Unit",
+		Comment:    "trusted customer",
+	}
+	rsp1 := &internalPkg.FraudListEntryResponse{}
+	err = suite.service.UpdateFraudListEntry(context.TODO(), req, rsp1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp1.Status)
+	assert.Equal(suite.T(), suite.merchant.Id, rsp1.Item.MerchantId)
+	assert.Equal(suite.T(), internalPkg.FraudListAllow, rsp1.Item.List)
+	assert.Equal(suite.T(), "trusted@unit.unit", rsp1.Item.Value)
+	assert.Equal(suite.T(), "trusted customer", rsp1.Item.Comment)
+
+	err = suite.service.DeleteFraudListEntry(context.TODO(), &internalPkg.FraudListEntryRequest{Id: rsp.Item.Id}, rsp1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp1.Status)
+
+	err = suite.service.GetFraudListEntry(context.TODO(), &internalPkg.FraudListEntryRequest{Id: rsp.Item.Id}, rsp1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp1.Status)
+	assert.Equal(suite.T(), fraudListErrorEntryNotFound, rsp1.Message)
+}
+
+func (suite *FraudListTestSuite) TestFraudList_UpdateFraudListEntry_NotFound() {
+	req := suite.getEntry(internalPkg.FraudListEntryTypeCountry, "RU")
+	req.Id = primitive.NewObjectID().Hex()
+	rsp := &internalPkg.FraudListEntryResponse{}
+	err := suite.service.UpdateFraudListEntry(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), fraudListErrorEntryNotFound, rsp.Message)
+}
+
+func (suite *FraudListTestSuite) TestFraudList_ImportFraudListEntries_Ok() {
+	rsp := &internalPkg.FraudListEntryResponse{}
+	err := suite.service.CreateFraudListEntry(context.TODO(), suite.getEntry(internalPkg.FraudListEntryTypeCountry, "RU"), rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	req := &internalPkg.ImportFraudListEntriesRequest{
+		MerchantId: suite.merchant.Id,
+		List:       internalPkg.FraudListBlock,
+		Entries: []*internalPkg.FraudListEntry{
+			{Type: internalPkg.FraudListEntryTypeEmail, Value: "test@unit.unit"},
+			{Type: internalPkg.FraudListEntryTypeEmail, Value: "TEST@unit.unit"},
+			{Type: internalPkg.FraudListEntryTypeCountry, Value: "RU"},
+			{Type: internalPkg.FraudListEntryTypeBin, Value: "400000", Comment: "stolen cards"},
+			{Type: internalPkg.FraudListEntryTypeIp, Value: "localhost"},
+		},
+	}
+	rsp1 := &internalPkg.ImportFraudListEntriesResponse{}
+	err = suite.service.ImportFraudListEntries(context.TODO(), req, rsp1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp1.Status)
+	assert.EqualValues(suite.T(), 2, rsp1.Imported)
+	assert.EqualValues(suite.T(), 2, rsp1.Skipped)
+	assert.Len(suite.T(), rsp1.Errors, 1)
+	assert.EqualValues(suite.T(), 4, rsp1.Errors[0].Index)
+	assert.Equal(suite.T(), fraudListErrorValueInvalid, rsp1.Errors[0].Message)
+
+	req1 := &internalPkg.ListFraudListEntriesRequest{MerchantId: suite.merchant.Id}
+	rsp2 := &internalPkg.ListFraudListEntriesResponse{}
+	err = suite.service.ListFraudListEntries(context.TODO(), req1, rsp2)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp2.Status)
+	assert.EqualValues(suite.T(), 3, rsp2.Count)
+	assert.Len(suite.T(), rsp2.Items, 3)
+}
+
+func (suite *FraudListTestSuite) TestFraudList_ImportFraudListEntries_Invalid() {
+	req := &internalPkg.ImportFraudListEntriesRequest{List: internalPkg.FraudListAllow}
+	rsp := &internalPkg.ImportFraudListEntriesResponse{}
+	err := suite.service.ImportFraudListEntries(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), fraudListErrorImportEmpty, rsp.Message)
+
+	req.List = ""
+	err = suite.service.ImportFraudListEntries(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), fraudListErrorListInvalid, rsp.Message)
+}
+
+func (suite *FraudListTestSuite) TestFraudList_OrderCreateProcess_Blocked() {
+	req := suite.getEntry(internalPkg.FraudListEntryTypeEmail, "test@unit.unit")
+	req.MerchantId = ""
+	rsp := &internalPkg.FraudListEntryResponse{}
+	err := suite.service.CreateFraudListEntry(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	rsp1 := suite.createOrder()
+	assert.Equal(suite.T(), billingpb.ResponseStatusForbidden, rsp1.Status)
+	assert.Equal(suite.T(), fraudListErrorBlocked, rsp1.Message)
+
+	req1 := &internalPkg.ListFraudListBlockedAttemptsRequest{EntryId: rsp.Item.Id}
+	rsp2 := &internalPkg.ListFraudListBlockedAttemptsResponse{}
+	err = suite.service.ListFraudListBlockedAttempts(context.TODO(), req1, rsp2)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp2.Status)
+	assert.EqualValues(suite.T(), 1, rsp2.Count)
+	assert.Equal(suite.T(), internalPkg.FraudListStageOrderCreate, rsp2.Items[0].Stage)
+	assert.Equal(suite.T(), suite.merchant.Id, rsp2.Items[0].MerchantId)
+	assert.Equal(suite.T(), "test@unit.unit", rsp2.Items[0].MatchedValue)
+	assert.NotEmpty(suite.T(), rsp2.Items[0].ProjectOrderId)
+	assert.Empty(suite.T(), rsp2.Items[0].OrderId)
+	assert.Empty(suite.T(), rsp2.Items[0].OrderUuid)
+
+	entry, err := suite.service.fraudListEntryRepository.GetById(context.TODO(), rsp.Item.Id)
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), 1, entry.Hits)
+}
+
+func (suite *FraudListTestSuite) TestFraudList_PaymentCreateProcess_Blocked() {
+	rsp := &internalPkg.FraudListEntryResponse{}
+	err := suite.service.CreateFraudListEntry(context.TODO(), suite.getEntry(internalPkg.FraudListEntryTypeBin, "4000"), rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	rsp1 := suite.createOrder()
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp1.Status)
+
+	rsp2 := suite.payOrder(rsp1.Item)
+	assert.Equal(suite.T(), billingpb.ResponseStatusForbidden, rsp2.Status)
+	assert.Equal(suite.T(), fraudListErrorBlocked, rsp2.Message)
+
+	req := &internalPkg.ListFraudListBlockedAttemptsRequest{OrderId: rsp1.Item.Id}
+	rsp3 := &internalPkg.ListFraudListBlockedAttemptsResponse{}
+	err = suite.service.ListFraudListBlockedAttempts(context.TODO(), req, rsp3)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp3.Status)
+	assert.EqualValues(suite.T(), 1, rsp3.Count)
+	assert.Equal(suite.T(), rsp.Item.Id, rsp3.Items[0].EntryId)
+	assert.Equal(suite.T(), internalPkg.FraudListStagePaymentCreate, rsp3.Items[0].Stage)
+	assert.Equal(suite.T(), "4000", rsp3.Items[0].MatchedValue)
+}
+
+func (suite *FraudListTestSuite) TestFraudList_PaymentCreateProcess_IpRangeBlocked() {
+	rsp := &internalPkg.FraudListEntryResponse{}
+	err := suite.service.CreateFraudListEntry(context.TODO(), suite.getEntry(internalPkg.FraudListEntryTypeIp, "127.0.0.0/24"), rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	rsp1 := suite.createOrder()
+	assert.Equal(suite.T(), billingpb.ResponseStatusForbidden, rsp1.Status)
+	assert.Equal(suite.T(), fraudListErrorBlocked, rsp1.Message)
+
+	rsp2 := &internalPkg.ListFraudListBlockedAttemptsResponse{}
+	req := &internalPkg.ListFraudListBlockedAttemptsRequest{MerchantId: suite.merchant.Id}
+	err = suite.service.ListFraudListBlockedAttempts(context.TODO(), req, rsp2)
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), 1, rsp2.Count)
+	assert.Equal(suite.T(), "127.0.0.1", rsp2.Items[0].MatchedValue)
+}
+
+func (suite *FraudListTestSuite) TestFraudList_PaymentCreateProcess_Allowed() {
+	rsp := &internalPkg.FraudListEntryResponse{}
+	err := suite.service.CreateFraudListEntry(context.TODO(), suite.getEntry(internalPkg.FraudListEntryTypeCountry, "UA"), rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	req := suite.getEntry(internalPkg.FraudListEntryTypeEmail, "test@unit.unit")
+	req.List = internalPkg.FraudListAllow
+	err = suite.service.CreateFraudListEntry(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	rsp1 := suite.createOrder()
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp1.Status)
+
+	rsp2 := suite.payOrder(rsp1.Item)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp2.Status)
+
+	// allowed payment is screened as usual
+	order, err := suite.service.orderRepository.GetById(context.TODO(), rsp1.Item.Id)
+	assert.NoError(suite.T(), err)
+	assert.Contains(suite.T(), order.PrivateMetadata, orderPrivateMetadataKeyFraudCheckId)
+
+	entry, err := suite.service.fraudListEntryRepository.GetById(context.TODO(), rsp.Item.Id)
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), 2, entry.Hits)
+}
+
+func (suite *FraudListTestSuite) TestFraudList_PaymentCreateProcess_PlatformBlockedAndMerchantAllowed() {
+	req := suite.getEntry(internalPkg.FraudListEntryTypeBin, "4000")
+	req.MerchantId = ""
+	rsp := &internalPkg.FraudListEntryResponse{}
+	err := suite.service.CreateFraudListEntry(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	platformEntry := rsp.Item
+
+	req = suite.getEntry(internalPkg.FraudListEntryTypeEmail, "test@unit.unit")
+	req.List = internalPkg.FraudListAllow
+	rsp = &internalPkg.FraudListEntryResponse{}
+	err = suite.service.CreateFraudListEntry(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	rsp1 := suite.createOrder()
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp1.Status)
+
+	rsp2 := suite.payOrder(rsp1.Item)
+	assert.Equal(suite.T(), billingpb.ResponseStatusForbidden, rsp2.Status)
+	assert.Equal(suite.T(), fraudListErrorBlocked, rsp2.Message)
+
+	req1 := &internalPkg.ListFraudListBlockedAttemptsRequest{OrderId: rsp1.Item.Id}
+	rsp3 := &internalPkg.ListFraudListBlockedAttemptsResponse{}
+	err = suite.service.ListFraudListBlockedAttempts(context.TODO(), req1, rsp3)
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), 1, rsp3.Count)
+	assert.Equal(suite.T(), platformEntry.Id, rsp3.Items[0].EntryId)
+	assert.Equal(suite.T(), rsp1.Item.Uuid, rsp3.Items[0].OrderUuid)
+}
+
+func (suite *FraudListTestSuite) TestFraudList_CreateFraudListEntry_IpRange() {
+	rsp := &internalPkg.FraudListEntryResponse{}
+	err := suite.service.CreateFraudListEntry(context.TODO(), suite.getEntry(internalPkg.FraudListEntryTypeIp, "10.1.2.3/16"), rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), "10.1.0.0/16", rsp.Item.Value)
+	assert.Equal(suite.T(), internalPkg.GetFraudListIpRangeKey(net.ParseIP("10.1.0.0")), rsp.Item.RangeStart)
+	assert.Equal(suite.T(), internalPkg.GetFraudListIpRangeKey(net.ParseIP("10.1.255.255")), rsp.Item.RangeEnd)
+
+	req := suite.getEntry(internalPkg.FraudListEntryTypeIp, "10.1.2.3")
+	req.Id = rsp.Item.Id
+	err = suite.service.UpdateFraudListEntry(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Empty(suite.T(), rsp.Item.RangeStart)
+	assert.Empty(suite.T(), rsp.Item.RangeEnd)
+}
+
+func (suite *FraudListTestSuite) TestFraudList_GetOrderFraudListValues() {
+	order := &billingpb.Order{
+		User: &billingpb.OrderUser{
+			Id:         "customer",
+			ExternalId: "external",
+			Email:      "Test@Unit.Unit",
+			Ip:         "127.0.0.2",
+			Address:    &billingpb.OrderBillingAddress{Country: "RU"},
+		},
+		PaymentIpCountry: "RU",
+		PaymentRequisites: map[string]string{
+			billingpb.PaymentCreateFieldPan:                          "400000******0002",
+			billingpb.PaymentCreateBankCardFieldIssuerCountryIsoCode: "UA",
+		},
+	}
+	suite.service.setOrderCardFingerprint(order, map[string]string{billingpb.PaymentCreateFieldPan: "4000000000000002"})
+	values := getOrderFraudListValues(order, "127.0.0.1")
+	assert.Equal(suite.T(), []string{"test@unit.unit"}, values[internalPkg.FraudListEntryTypeEmail])
+	assert.Equal(suite.T(), []string{"customer", "external"}, values[internalPkg.FraudListEntryTypeCustomerId])
+	assert.Equal(suite.T(), []string{"127.0.0.1"}, values[internalPkg.FraudListEntryTypeIp])
+	assert.Equal(suite.T(), []string{"RU", "UA"}, values[internalPkg.FraudListEntryTypeCountry])
+	assert.Equal(suite.T(), []string{"4", "40", "400", "4000", "40000", "400000"}, values[internalPkg.FraudListEntryTypeBin])
+	assert.Len(suite.T(), values[internalPkg.FraudListEntryTypeCardFingerprint], 1)
+}
+
+func (suite *FraudListTestSuite) getEntry(entryType, value string) *internalPkg.FraudListEntry {
+	return &internalPkg.FraudListEntry{
+		MerchantId: suite.merchant.Id,
+		List:       internalPkg.FraudListBlock,
+		Type:       entryType,
+		Value:      value,
+	}
+}
+
+func (suite *FraudListTestSuite) createOrder() *billingpb.OrderCreateProcessResponse {
+	req := &billingpb.OrderCreateRequest{
+		Type:        pkg.OrderType_simple,
+		ProjectId:   suite.project.Id,
+		Amount:      100,
+		Currency:    "RUB",
+		Account:     "unit test",
+		Description: "unit test",
+		OrderId:     primitive.NewObjectID().Hex(),
+		User: &billingpb.OrderUser{
+			Id:    primitive.NewObjectID().Hex(),
+			Email: "test@unit.unit",
+			Ip:    "127.0.0.1",
+			Address: &billingpb.OrderBillingAddress{
+				Country: "RU",
+			},
+		},
+	}
+	rsp := &billingpb.OrderCreateProcessResponse{}
+	err := suite.service.OrderCreateProcess(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+
+	return rsp
+}
+
+func (suite *FraudListTestSuite) payOrder(order *billingpb.Order) *billingpb.PaymentCreateResponse {
+	req := &billingpb.PaymentCreateRequest{
+		Data: map[string]string{
+			billingpb.PaymentCreateFieldOrderId:         order.Uuid,
+			billingpb.PaymentCreateFieldPaymentMethodId: suite.paymentMethod.Id,
+			billingpb.PaymentCreateFieldEmail:           "test@unit.unit",
+			billingpb.PaymentCreateFieldPan:             "4000000000000002",
+			billingpb.PaymentCreateFieldCvv:             "123",
+			billingpb.PaymentCreateFieldMonth:           "02",
+			billingpb.PaymentCreateFieldYear:            time.Now().AddDate(1, 0, 0).Format("2006"),
+			billingpb.PaymentCreateFieldHolder:          "MR. CARD HOLDER",
+		},
+		Ip: "127.0.0.1",
+	}
+	rsp := &billingpb.PaymentCreateResponse{}
+	err := suite.service.PaymentCreateProcess(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+
+	return rsp
+}
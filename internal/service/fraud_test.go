@@ -0,0 +1,483 @@
+package service
+
+import (
+	"context"
+	"github.com/go-redis/redis"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/mongodb"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	"github.com/paysuper/paysuper-billing-server/internal/database"
+	"github.com/paysuper/paysuper-billing-server/internal/mocks"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	casbinMocks "github.com/paysuper/paysuper-proto/go/casbinpb/mocks"
+	reportingMocks "github.com/paysuper/paysuper-proto/go/reporterpb/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	rabbitmq "gopkg.in/ProtocolONE/rabbitmq.v1/pkg"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type FraudTestSuite struct {
+	suite.Suite
+	service *Service
+	log     *zap.Logger
+	cache   database.CacheInterface
+
+	merchant      *billingpb.Merchant
+	project       *billingpb.Project
+	paymentMethod *billingpb.PaymentMethod
+	paymentSystem *billingpb.PaymentSystem
+}
+
+func Test_Fraud(t *testing.T) {
+	suite.Run(t, new(FraudTestSuite))
+}
+
+func (suite *FraudTestSuite) SetupTest() {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		suite.FailNow("Config load failed", "%v", err)
+	}
+	cfg.CardPayApiUrl = "https://sandbox.cardpay.com"
+
+	m, err := migrate.New(
+		"file://../../migrations/tests",
+		cfg.MongoDsn)
+	assert.NoError(suite.T(), err, "Migrate init failed")
+
+	err = m.Up()
+	if err != nil && err.Error() != "no change" {
+		suite.FailNow("Migrations failed", "%v", err)
+	}
+
+	ctx, _ := context.WithTimeout(context.Background(), 50*time.Second)
+	opts := []mongodb.Option{mongodb.Context(ctx)}
+	db, err := mongodb.NewDatabase(opts...)
+	if err != nil {
+		suite.FailNow("Database connection failed", "%v", err)
+	}
+
+	suite.log, err = zap.NewProduction()
+
+	if err != nil {
+		suite.FailNow("Logger initialization failed", "%v", err)
+	}
+
+	broker, err := rabbitmq.NewBroker(cfg.BrokerAddress)
+
+	if err != nil {
+		suite.FailNow("Creating RabbitMQ publisher failed", "%v", err)
+	}
+
+	redisClient := database.NewRedis(
+		&redis.Options{
+			Addr:     cfg.RedisHost,
+			Password: cfg.RedisPassword,
+		},
+	)
+
+	redisdb := mocks.NewTestRedis()
+	suite.cache, err = database.NewCacheRedis(redisdb, "cache")
+	suite.service = NewBillingService(
+		db,
+		cfg,
+		mocks.NewGeoIpServiceTestOk(),
+		mocks.NewRepositoryServiceOk(),
+		mocks.NewTaxServiceOkMock(),
+		broker,
+		redisClient,
+		suite.cache,
+		mocks.NewCurrencyServiceMockOk(),
+		mocks.NewDocumentSignerMockOk(),
+		&reportingMocks.ReporterService{},
+		mocks.NewFormatterOK(),
+		mocks.NewBrokerMockOk(),
+		&casbinMocks.CasbinService{},
+	)
+
+	if err := suite.service.Init(); err != nil {
+		suite.FailNow("Billing service initialization failed", "%v", err)
+	}
+
+	suite.merchant, suite.project, suite.paymentMethod, suite.paymentSystem = helperCreateEntitiesForTests(suite.Suite, suite.service)
+
+	centrifugoMock := &mocks.CentrifugoInterface{}
+	centrifugoMock.On("GetChannelToken", mock.Anything, mock.Anything).Return("token")
+	centrifugoMock.On("Publish", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	suite.service.centrifugoDashboard = centrifugoMock
+	suite.service.centrifugoPaymentForm = centrifugoMock
+}
+
+func (suite *FraudTestSuite) TearDownTest() {
+	err := suite.service.db.Drop()
+
+	if err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	err = suite.service.db.Close()
+
+	if err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *FraudTestSuite) TestFraud_GetFraudPolicy_Default() {
+	req := &internalPkg.FraudPolicyRequest{ProjectId: suite.project.Id}
+	rsp := &internalPkg.FraudPolicyResponse{}
+	err := suite.service.GetFraudPolicy(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), suite.service.cfg.FraudReviewScore, rsp.Item.ReviewScore)
+	assert.Equal(suite.T(), suite.service.cfg.FraudBlockScore, rsp.Item.BlockScore)
+	assert.Equal(suite.T(), suite.service.cfg.FraudVelocityWindow, rsp.Item.VelocityWindow)
+	assert.Equal(suite.T(), suite.service.cfg.FraudVelocityLimit, rsp.Item.VelocityLimit)
+	assert.Equal(suite.T(), suite.service.cfg.FraudAmountAnomalyFactor, rsp.Item.AmountAnomalyFactor)
+}
+
+func (suite *FraudTestSuite) TestFraud_GetFraudPolicy_ProjectNotFound() {
+	req := &internalPkg.FraudPolicyRequest{ProjectId: primitive.NewObjectID().Hex()}
+	rsp := &internalPkg.FraudPolicyResponse{}
+	err := suite.service.GetFraudPolicy(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), projectErrorNotFound, rsp.Message)
+}
+
+func (suite *FraudTestSuite) TestFraud_SetFraudPolicy_Ok() {
+	req := suite.getPolicy(20, 50)
+	rsp := &internalPkg.FraudPolicyResponse{}
+	err := suite.service.SetFraudPolicy(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	rsp1 := &internalPkg.FraudPolicyResponse{}
+	err = suite.service.GetFraudPolicy(context.TODO(), &internalPkg.FraudPolicyRequest{ProjectId: suite.project.Id}, rsp1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp1.Status)
+	assert.Equal(suite.T(), int32(20), rsp1.Item.ReviewScore)
+	assert.Equal(suite.T(), int32(50), rsp1.Item.BlockScore)
+	assert.Equal(suite.T(), int64(60), rsp1.Item.VelocityWindow)
+	assert.Equal(suite.T(), int32(10), rsp1.Item.VelocityLimit)
+	assert.Equal(suite.T(), float64(5), rsp1.Item.AmountAnomalyFactor)
+}
+
+func (suite *FraudTestSuite) TestFraud_SetFraudPolicy_ScoresInvalid() {
+	req := suite.getPolicy(50, 20)
+	rsp := &internalPkg.FraudPolicyResponse{}
+	err := suite.service.SetFraudPolicy(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), fraudErrorScoresInvalid, rsp.Message)
+
+	req = suite.getPolicy(0, 20)
+	err = suite.service.SetFraudPolicy(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), fraudErrorScoresInvalid, rsp.Message)
+}
+
+func (suite *FraudTestSuite) TestFraud_SetFraudPolicy_VelocityInvalid() {
+	req := suite.getPolicy(20, 50)
+	req.VelocityLimit = 0
+	rsp := &internalPkg.FraudPolicyResponse{}
+	err := suite.service.SetFraudPolicy(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), fraudErrorVelocityInvalid, rsp.Message)
+}
+
+func (suite *FraudTestSuite) TestFraud_SetFraudPolicy_AmountAnomalyInvalid() {
+	req := suite.getPolicy(20, 50)
+	req.AmountAnomalyFactor = 0.5
+	rsp := &internalPkg.FraudPolicyResponse{}
+	err := suite.service.SetFraudPolicy(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), fraudErrorAmountAnomalyInvalid, rsp.Message)
+}
+
+func (suite *FraudTestSuite) TestFraud_SetFraudPolicy_ProjectNotFound() {
+	req := suite.getPolicy(20, 50)
+	req.ProjectId = primitive.NewObjectID().Hex()
+	rsp := &internalPkg.FraudPolicyResponse{}
+	err := suite.service.SetFraudPolicy(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), projectErrorNotFound, rsp.Message)
+}
+
+func (suite *FraudTestSuite) TestFraud_PaymentCreateProcess_Review() {
+	order, rsp := suite.createPayment("test@unit.unit")
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	// BIN country of test card is UA, IP country and billing country are RU
+	assert.Equal(suite.T(), internalPkg.FraudDecisionReview, order.PrivateMetadata[orderPrivateMetadataKeyFraudDecision])
+	assert.Equal(suite.T(), "45", order.PrivateMetadata[orderPrivateMetadataKeyFraudScore])
+
+	rsp1 := &internalPkg.OrderFraudCheckResponse{}
+	err := suite.service.GetOrderFraudCheck(context.TODO(), &internalPkg.OrderFraudCheckRequest{OrderId: order.Id}, rsp1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp1.Status)
+	assert.Equal(suite.T(), order.PrivateMetadata[orderPrivateMetadataKeyFraudCheckId], rsp1.Item.Id)
+	assert.Equal(suite.T(), int32(45), rsp1.Item.Score)
+	assert.Equal(suite.T(), internalPkg.FraudDecisionReview, rsp1.Item.Decision)
+	assert.Equal(suite.T(), "127.0.0.1", rsp1.Item.Ip)
+	assert.NotEmpty(suite.T(), rsp1.Item.CardFingerprint)
+
+	rules := suite.getRules(rsp1.Item)
+	assert.ElementsMatch(
+		suite.T(),
+		[]string{internalPkg.FraudRuleBinIpCountryMismatch, internalPkg.FraudRuleBinBillingCountryMismatch},
+		rules,
+	)
+}
+
+func (suite *FraudTestSuite) TestFraud_PaymentCreateProcess_Allow() {
+	rsp := &internalPkg.FraudPolicyResponse{}
+	err := suite.service.SetFraudPolicy(context.TODO(), suite.getPolicy(50, 100), rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	order, rsp1 := suite.createPayment("test@unit.unit")
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp1.Status)
+	assert.Equal(suite.T(), internalPkg.FraudDecisionAllow, order.PrivateMetadata[orderPrivateMetadataKeyFraudDecision])
+}
+
+func (suite *FraudTestSuite) TestFraud_PaymentCreateProcess_Block() {
+	rsp := &internalPkg.FraudPolicyResponse{}
+	err := suite.service.SetFraudPolicy(context.TODO(), suite.getPolicy(20, 60), rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	order, rsp1 := suite.createPayment("test@mailinator.com")
+	assert.Equal(suite.T(), billingpb.ResponseStatusForbidden, rsp1.Status)
+	assert.Equal(suite.T(), fraudErrorPaymentBlocked, rsp1.Message)
+	assert.Equal(suite.T(), internalPkg.FraudDecisionBlock, order.PrivateMetadata[orderPrivateMetadataKeyFraudDecision])
+
+	check, err := suite.service.orderFraudCheckRepository.GetByOrderId(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int32(75), check.Score)
+	assert.Contains(suite.T(), suite.getRules(check), internalPkg.FraudRuleDisposableEmail)
+}
+
+func (suite *FraudTestSuite) TestFraud_PaymentCreateProcess_Velocity() {
+	policy := suite.getPolicy(100, 200)
+	policy.VelocityLimit = 1
+	rsp := &internalPkg.FraudPolicyResponse{}
+	err := suite.service.SetFraudPolicy(context.TODO(), policy, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	order, rsp1 := suite.createPayment("test@unit.unit")
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp1.Status)
+
+	check, err := suite.service.orderFraudCheckRepository.GetByOrderId(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.NotContains(suite.T(), suite.getRules(check), internalPkg.FraudRuleVelocityIp)
+
+	order, rsp1 = suite.createPayment("test@unit.unit")
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp1.Status)
+
+	check, err = suite.service.orderFraudCheckRepository.GetByOrderId(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	rules := suite.getRules(check)
+	assert.Contains(suite.T(), rules, internalPkg.FraudRuleVelocityIp)
+	assert.Contains(suite.T(), rules, internalPkg.FraudRuleVelocityEmail)
+	assert.Contains(suite.T(), rules, internalPkg.FraudRuleVelocityCard)
+}
+
+func (suite *FraudTestSuite) TestFraud_CheckOrderFraudAmount() {
+	policy := suite.getPolicy(20, 50)
+	projectId := primitive.NewObjectID().Hex()
+
+	for i := 0; i < fraudAmountAnomalyMinPayments; i++ {
+		check := &internalPkg.OrderFraudCheck{
+			Id:        primitive.NewObjectID().Hex(),
+			OrderId:   primitive.NewObjectID().Hex(),
+			ProjectId: projectId,
+			Amount:    10,
+			Currency:  "USD",
+			CreatedAt: time.Now(),
+		}
+		err := suite.service.orderFraudCheckRepository.Insert(context.TODO(), check)
+		assert.NoError(suite.T(), err)
+	}
+
+	check := &internalPkg.OrderFraudCheck{ProjectId: projectId, Amount: 50, Currency: "USD", CreatedAt: time.Now()}
+	suite.service.checkOrderFraudAmount(context.TODO(), check, policy)
+	assert.Empty(suite.T(), check.Rules)
+
+	check.Amount = 51
+	suite.service.checkOrderFraudAmount(context.TODO(), check, policy)
+	assert.Len(suite.T(), check.Rules, 1)
+	assert.Equal(suite.T(), internalPkg.FraudRuleAmountAnomaly, check.Rules[0].Rule)
+
+	check = &internalPkg.OrderFraudCheck{ProjectId: projectId, Amount: 1000, Currency: "EUR", CreatedAt: time.Now()}
+	suite.service.checkOrderFraudAmount(context.TODO(), check, policy)
+	assert.Empty(suite.T(), check.Rules)
+}
+
+func (suite *FraudTestSuite) TestFraud_CheckOrderFraudEmail() {
+	check := &internalPkg.OrderFraudCheck{Email: "test@unit.unit"}
+	suite.service.checkOrderFraudEmail(check)
+	assert.Empty(suite.T(), check.Rules)
+
+	check.Email = "test@yopmail.com"
+	suite.service.checkOrderFraudEmail(check)
+	assert.Len(suite.T(), check.Rules, 1)
+	assert.Equal(suite.T(), internalPkg.FraudRuleDisposableEmail, check.Rules[0].Rule)
+}
+
+func (suite *FraudTestSuite) TestFraud_GetOrderFraudCheck_NotFound() {
+	req := &internalPkg.OrderFraudCheckRequest{OrderId: primitive.NewObjectID().Hex()}
+	rsp := &internalPkg.OrderFraudCheckResponse{}
+	err := suite.service.GetOrderFraudCheck(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), fraudErrorCheckNotFound, rsp.Message)
+}
+
+func (suite *FraudTestSuite) TestFraud_SetOrderCardFingerprint() {
+	order := &billingpb.Order{}
+	suite.service.setOrderCardFingerprint(order, map[string]string{billingpb.PaymentCreateFieldPan: "4000000000000002"})
+	fingerprint := getOrderCardFingerprint(order)
+	assert.Len(suite.T(), fingerprint, 64)
+
+	// different cards with the same masked number and expiration date have different fingerprints
+	order1 := &billingpb.Order{}
+	suite.service.setOrderCardFingerprint(order1, map[string]string{billingpb.PaymentCreateFieldPan: "4000001111110002"})
+	assert.NotEmpty(suite.T(), getOrderCardFingerprint(order1))
+	assert.NotEqual(suite.T(), fingerprint, getOrderCardFingerprint(order1))
+
+	order1 = &billingpb.Order{}
+	suite.service.setOrderCardFingerprint(order1, map[string]string{billingpb.PaymentCreateFieldPan: "4000000000000002"})
+	assert.Equal(suite.T(), fingerprint, getOrderCardFingerprint(order1))
+
+	data := map[string]string{
+		billingpb.PaymentCreateFieldPan:         "400000******0002",
+		billingpb.PaymentCreateFieldRecurringId: "recurring_id",
+	}
+	order1 = &billingpb.Order{}
+	suite.service.setOrderCardFingerprint(order1, data)
+	assert.Len(suite.T(), getOrderCardFingerprint(order1), 64)
+	assert.NotEqual(suite.T(), fingerprint, getOrderCardFingerprint(order1))
+
+	order1 = &billingpb.Order{}
+	suite.service.setOrderCardFingerprint(order1, map[string]string{billingpb.PaymentCreateFieldEWallet: "wallet"})
+	assert.Empty(suite.T(), getOrderCardFingerprint(order1))
+}
+
+func (suite *FraudTestSuite) TestFraud_CreatePaymentInPaymentSystem_Review() {
+	order := &billingpb.Order{
+		Id:              primitive.NewObjectID().Hex(),
+		ProductType:     pkg.OrderType_simple,
+		PrivateMetadata: map[string]string{orderPrivateMetadataKeyFraudDecision: internalPkg.FraudDecisionReview},
+	}
+
+	h := &mocks.PaymentSystem{}
+	h.On("AuthorizePayment", order, mock.Anything, mock.Anything, mock.Anything).Return("http://localhost", nil)
+
+	url, err := suite.service.createPaymentInPaymentSystem(h, order, map[string]string{})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "http://localhost", url)
+	h.AssertNotCalled(suite.T(), "CreatePayment", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	order.PrivateMetadata[orderPrivateMetadataKeyFraudDecision] = internalPkg.FraudDecisionAllow
+	h.On("CreatePayment", order, mock.Anything, mock.Anything, mock.Anything).Return("http://localhost", nil)
+
+	_, err = suite.service.createPaymentInPaymentSystem(h, order, map[string]string{})
+	assert.NoError(suite.T(), err)
+	h.AssertNumberOfCalls(suite.T(), "AuthorizePayment", 1)
+	h.AssertNumberOfCalls(suite.T(), "CreatePayment", 1)
+}
+
+func (suite *FraudTestSuite) TestFraud_ProcessPaymentAuthorized_Review() {
+	order := &billingpb.Order{
+		Id:              primitive.NewObjectID().Hex(),
+		ProductType:     pkg.OrderType_simple,
+		PrivateStatus:   pkg.OrderStatusPaymentSystemAuthorized,
+		ChargeAmount:    100,
+		PrivateMetadata: map[string]string{orderPrivateMetadataKeyFraudDecision: internalPkg.FraudDecisionReview},
+	}
+
+	h := &mocks.PaymentSystem{}
+	suite.service.processPaymentAuthorized(context.TODO(), h, order)
+	h.AssertNotCalled(suite.T(), "CapturePayment", mock.Anything, mock.Anything)
+	h.AssertNotCalled(suite.T(), "VoidPayment", mock.Anything)
+}
+
+func (suite *FraudTestSuite) getPolicy(reviewScore, blockScore int32) *internalPkg.FraudPolicy {
+	return &internalPkg.FraudPolicy{
+		ProjectId:           suite.project.Id,
+		ReviewScore:         reviewScore,
+		BlockScore:          blockScore,
+		VelocityWindow:      60,
+		VelocityLimit:       10,
+		AmountAnomalyFactor: 5,
+	}
+}
+
+func (suite *FraudTestSuite) getRules(check *internalPkg.OrderFraudCheck) []string {
+	var rules []string
+
+	for _, v := range check.Rules {
+		rules = append(rules, v.Rule)
+	}
+
+	return rules
+}
+
+func (suite *FraudTestSuite) createPayment(email string) (*billingpb.Order, *billingpb.PaymentCreateResponse) {
+	req := &billingpb.OrderCreateRequest{
+		Type:        pkg.OrderType_simple,
+		ProjectId:   suite.project.Id,
+		Amount:      100,
+		Currency:    "RUB",
+		Account:     "unit test",
+		Description: "unit test",
+		OrderId:     primitive.NewObjectID().Hex(),
+		User: &billingpb.OrderUser{
+			Id:    primitive.NewObjectID().Hex(),
+			Email: email,
+			Ip:    "127.0.0.1",
+			Address: &billingpb.OrderBillingAddress{
+				Country: "RU",
+			},
+		},
+	}
+	rsp := &billingpb.OrderCreateProcessResponse{}
+	err := suite.service.OrderCreateProcess(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	req1 := &billingpb.PaymentCreateRequest{
+		Data: map[string]string{
+			billingpb.PaymentCreateFieldOrderId:         rsp.Item.Uuid,
+			billingpb.PaymentCreateFieldPaymentMethodId: suite.paymentMethod.Id,
+			billingpb.PaymentCreateFieldEmail:           email,
+			billingpb.PaymentCreateFieldPan:             "4000000000000002",
+			billingpb.PaymentCreateFieldCvv:             "123",
+			billingpb.PaymentCreateFieldMonth:           "02",
+			billingpb.PaymentCreateFieldYear:            time.Now().AddDate(1, 0, 0).Format("2006"),
+			billingpb.PaymentCreateFieldHolder:          "MR. CARD HOLDER",
+		},
+		Ip: "127.0.0.1",
+	}
+	rsp1 := &billingpb.PaymentCreateResponse{}
+	err = suite.service.PaymentCreateProcess(context.TODO(), req1, rsp1)
+	assert.NoError(suite.T(), err)
+
+	order, err := suite.service.orderRepository.GetById(context.TODO(), rsp.Item.Id)
+	assert.NoError(suite.T(), err)
+
+	return order, rsp1
+}
@@ -217,6 +217,8 @@ type KeyRepositoryInterface interface {
 	FinishRedeemById(context.Context, string) (*billingpb.Key, error)
 	CountKeysByProductPlatform(context.Context, string, string) (int64, error)
 	FindUnfinished(context.Context) ([]*billingpb.Key, error)
+	RevokeById(context.Context, string, string) (*billingpb.Key, error)
+	FindByOrderId(context.Context, string) ([]*billingpb.Key, error)
 }
 
 func newKeyRepository(svc *Service) *Key {
@@ -374,3 +376,51 @@ func (h *Key) FindUnfinished(ctx context.Context) ([]*billingpb.Key, error) {
 
 	return keys, nil
 }
+
+// RevokeById marks the key sold by the order as revoked by the refund, revoked key is kept linked to the order
+// and can't be reserved again.
+func (h *Key) RevokeById(ctx context.Context, id, refundId string) (*billingpb.Key, error) {
+	var key *billingpb.Key
+	oid, _ := primitive.ObjectIDFromHex(id)
+	query := bson.M{"_id": oid}
+	update := bson.M{
+		"$set": bson.M{
+			"revoked_at": time.Now().UTC(),
+			"refund_id":  refundId,
+		},
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := h.svc.db.Collection(collectionKey).FindOneAndUpdate(ctx, query, update, opts).Decode(&key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if key == nil {
+		return nil, errors.KeyErrorNotFound
+	}
+
+	return key, nil
+}
+
+// FindByOrderId returns keys reserved or sold by the order.
+func (h *Key) FindByOrderId(ctx context.Context, orderId string) ([]*billingpb.Key, error) {
+	var keys []*billingpb.Key
+	oid, _ := primitive.ObjectIDFromHex(orderId)
+	query := bson.M{"order_id": oid}
+
+	cursor, err := h.svc.db.Collection(collectionKey).Find(ctx, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &keys)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/golang/protobuf/ptypes"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
 	"github.com/paysuper/paysuper-billing-server/pkg"
 	"github.com/paysuper/paysuper-proto/go/billingpb"
 	"github.com/paysuper/paysuper-proto/go/recurringpb"
@@ -826,7 +827,7 @@ func (s *Service) ChangeCodeInOrder(ctx context.Context, req *billingpb.ChangeCo
 	s.sendMailWithCode(ctx, order, keyRsp.Key)
 	order.PrivateStatus = recurringpb.OrderStatusItemReplaced
 
-	err = s.updateOrder(ctx, order)
+	err = s.updateOrderWithCause(ctx, order, internalPkg.OrderStatusEventCauseItemReplaced)
 	if err != nil {
 		zap.S().Error("Error during updating order", "err", err.Error(), "data", req)
 		res.Status = http.StatusInternalServerError
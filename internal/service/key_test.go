@@ -141,6 +141,29 @@ func (suite *KeyTestSuite) TestKey_GetById_Error_NotFound() {
 	assert.Error(suite.T(), err)
 }
 
+func (suite *KeyTestSuite) TestKey_FindByOrderId_Ok() {
+	orderId := primitive.NewObjectID().Hex()
+
+	for _, id := range []string{orderId, orderId, primitive.NewObjectID().Hex()} {
+		key := &billingpb.Key{
+			Id:           primitive.NewObjectID().Hex(),
+			PlatformId:   "steam",
+			KeyProductId: primitive.NewObjectID().Hex(),
+			OrderId:      id,
+			Code:         primitive.NewObjectID().Hex(),
+		}
+		assert.NoError(suite.T(), suite.service.keyRepository.Insert(ctx, key))
+	}
+
+	keys, err := suite.service.keyRepository.FindByOrderId(ctx, orderId)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), keys, 2)
+
+	for _, key := range keys {
+		assert.Equal(suite.T(), orderId, key.OrderId)
+	}
+}
+
 func (suite *KeyTestSuite) TestKey_ReserveKey_Ok() {
 	key := &billingpb.Key{
 		Id:           primitive.NewObjectID().Hex(),
@@ -0,0 +1,671 @@
+package service
+
+import (
+	"context"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/paysuper/paysuper-billing-server/internal/helper"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/internal/repository"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	tools "github.com/paysuper/paysuper-tools/number"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"time"
+)
+
+var (
+	ledgerErrorPeriodInvalid   = newBillingServerErrorMsg("lg000001", "period of ledger report is invalid")
+	ledgerErrorCurrencyInvalid = newBillingServerErrorMsg("lg000002", "currency of ledger report not supported")
+	ledgerErrorAccountUnknown  = newBillingServerErrorMsg("lg000003", "unknown ledger account")
+
+	ledgerAccounts = []string{
+		internalPkg.LedgerAccountPaymentSystem,
+		internalPkg.LedgerAccountCustomerClearing,
+		internalPkg.LedgerAccountTaxPayable,
+		internalPkg.LedgerAccountMerchantPayable,
+		internalPkg.LedgerAccountMerchantReserve,
+		internalPkg.LedgerAccountFeeIncome,
+		internalPkg.LedgerAccountPaymentSystemCost,
+		internalPkg.LedgerAccountFxResult,
+		internalPkg.LedgerAccountAdjustments,
+		internalPkg.LedgerAccountMemo,
+		internalPkg.LedgerAccountMemoContra,
+	}
+
+	// Debit and credit accounts of the accounting entry types. Totals, profits and cost values calculated
+	// for reports don't move money and are booked to the memo accounts.
+	ledgerAccountsByEntryType = map[string]*ledgerEntryAccounts{
+		pkg.AccountingEntryTypeRealGrossRevenue:                    {internalPkg.LedgerAccountPaymentSystem, internalPkg.LedgerAccountCustomerClearing},
+		pkg.AccountingEntryTypeRealTaxFee:                          {internalPkg.LedgerAccountCustomerClearing, internalPkg.LedgerAccountTaxPayable},
+		pkg.AccountingEntryTypeCentralBankTaxFee:                   {internalPkg.LedgerAccountFxResult, internalPkg.LedgerAccountTaxPayable},
+		pkg.AccountingEntryTypeRealTaxFeeTotal:                     ledgerMemoAccounts,
+		pkg.AccountingEntryTypePsGrossRevenueFx:                    {internalPkg.LedgerAccountCustomerClearing, internalPkg.LedgerAccountFxResult},
+		pkg.AccountingEntryTypePsGrossRevenueFxTaxFee:              {internalPkg.LedgerAccountFxResult, internalPkg.LedgerAccountTaxPayable},
+		pkg.AccountingEntryTypePsGrossRevenueFxProfit:              ledgerMemoAccounts,
+		pkg.AccountingEntryTypeMerchantGrossRevenue:                {internalPkg.LedgerAccountCustomerClearing, internalPkg.LedgerAccountMerchantPayable},
+		pkg.AccountingEntryTypeMerchantTaxFeeCostValue:             ledgerMemoAccounts,
+		pkg.AccountingEntryTypeMerchantTaxFeeCentralBankFx:         ledgerMemoAccounts,
+		pkg.AccountingEntryTypeMerchantTaxFee:                      {internalPkg.LedgerAccountMerchantPayable, internalPkg.LedgerAccountCustomerClearing},
+		pkg.AccountingEntryTypePsMethodFee:                         {internalPkg.LedgerAccountMerchantPayable, internalPkg.LedgerAccountFeeIncome},
+		pkg.AccountingEntryTypeMerchantMethodFee:                   ledgerMemoAccounts,
+		pkg.AccountingEntryTypeMerchantMethodFeeCostValue:          {internalPkg.LedgerAccountPaymentSystemCost, internalPkg.LedgerAccountPaymentSystem},
+		pkg.AccountingEntryTypePsMarkupMerchantMethodFee:           ledgerMemoAccounts,
+		pkg.AccountingEntryTypeMerchantMethodFixedFee:              {internalPkg.LedgerAccountMerchantPayable, internalPkg.LedgerAccountFeeIncome},
+		pkg.AccountingEntryTypeRealMerchantMethodFixedFee:          ledgerMemoAccounts,
+		pkg.AccountingEntryTypeMarkupMerchantMethodFixedFeeFx:      ledgerMemoAccounts,
+		pkg.AccountingEntryTypeRealMerchantMethodFixedFeeCostValue: {internalPkg.LedgerAccountPaymentSystemCost, internalPkg.LedgerAccountPaymentSystem},
+		pkg.AccountingEntryTypePsMethodFixedFeeProfit:              ledgerMemoAccounts,
+		pkg.AccountingEntryTypeMerchantPsFixedFee:                  {internalPkg.LedgerAccountMerchantPayable, internalPkg.LedgerAccountFeeIncome},
+		pkg.AccountingEntryTypeRealMerchantPsFixedFee:              ledgerMemoAccounts,
+		pkg.AccountingEntryTypeMarkupMerchantPsFixedFee:            ledgerMemoAccounts,
+		pkg.AccountingEntryTypePsMethodProfit:                      ledgerMemoAccounts,
+		pkg.AccountingEntryTypeMerchantNetRevenue:                  ledgerMemoAccounts,
+		pkg.AccountingEntryTypePsProfitTotal:                       ledgerMemoAccounts,
+		pkg.AccountingEntryTypeRealRefund:                          {internalPkg.LedgerAccountCustomerClearing, internalPkg.LedgerAccountPaymentSystem},
+		pkg.AccountingEntryTypeRealRefundTaxFee:                    ledgerMemoAccounts,
+		pkg.AccountingEntryTypeRealRefundFee:                       {internalPkg.LedgerAccountPaymentSystemCost, internalPkg.LedgerAccountPaymentSystem},
+		pkg.AccountingEntryTypeRealRefundFixedFee:                  {internalPkg.LedgerAccountPaymentSystemCost, internalPkg.LedgerAccountPaymentSystem},
+		pkg.AccountingEntryTypeMerchantRefund:                      {internalPkg.LedgerAccountMerchantPayable, internalPkg.LedgerAccountCustomerClearing},
+		pkg.AccountingEntryTypePsMerchantRefundFx:                  {internalPkg.LedgerAccountFxResult, internalPkg.LedgerAccountCustomerClearing},
+		pkg.AccountingEntryTypeMerchantRefundFee:                   {internalPkg.LedgerAccountMerchantPayable, internalPkg.LedgerAccountFeeIncome},
+		pkg.AccountingEntryTypePsMarkupMerchantRefundFee:           ledgerMemoAccounts,
+		pkg.AccountingEntryTypeMerchantRefundFixedFeeCostValue:     ledgerMemoAccounts,
+		pkg.AccountingEntryTypeMerchantRefundFixedFee:              {internalPkg.LedgerAccountMerchantPayable, internalPkg.LedgerAccountFeeIncome},
+		pkg.AccountingEntryTypePsMerchantRefundFixedFeeFx:          ledgerMemoAccounts,
+		pkg.AccountingEntryTypePsMerchantRefundFixedFeeProfit:      ledgerMemoAccounts,
+		pkg.AccountingEntryTypeReverseTaxFee:                       {internalPkg.LedgerAccountTaxPayable, internalPkg.LedgerAccountCustomerClearing},
+		pkg.AccountingEntryTypeReverseTaxFeeDelta:                  {internalPkg.LedgerAccountTaxPayable, internalPkg.LedgerAccountFxResult},
+		pkg.AccountingEntryTypePsReverseTaxFeeDelta:                ledgerMemoAccounts,
+		pkg.AccountingEntryTypeMerchantReverseTaxFee:               {internalPkg.LedgerAccountCustomerClearing, internalPkg.LedgerAccountMerchantPayable},
+		pkg.AccountingEntryTypeMerchantReverseRevenue:              ledgerMemoAccounts,
+		pkg.AccountingEntryTypePsRefundProfit:                      ledgerMemoAccounts,
+		pkg.AccountingEntryTypeMerchantRollingReserveCreate:        {internalPkg.LedgerAccountMerchantPayable, internalPkg.LedgerAccountMerchantReserve},
+		pkg.AccountingEntryTypeMerchantRollingReserveRelease:       {internalPkg.LedgerAccountMerchantReserve, internalPkg.LedgerAccountMerchantPayable},
+		pkg.AccountingEntryTypeMerchantRoyaltyCorrection:           {internalPkg.LedgerAccountAdjustments, internalPkg.LedgerAccountMerchantPayable},
+		pkg.AccountingEntryTypeRealChargebackReversal:              {internalPkg.LedgerAccountPaymentSystem, internalPkg.LedgerAccountCustomerClearing},
+	}
+
+	ledgerMemoAccounts = &ledgerEntryAccounts{internalPkg.LedgerAccountMemo, internalPkg.LedgerAccountMemoContra}
+
+	// Factors of amounts of the order and refund entries, sum of amounts multiplied by them is the share
+	// of the merchant in customer money of the source document. Share is computed from saved entries
+	// for corrections of the entries and for entries saved before the journal.
+	ledgerClearingSettlementFactors = map[string]float64{
+		pkg.AccountingEntryTypeRealGrossRevenue:       1,
+		pkg.AccountingEntryTypePsGrossRevenueFx:       -1,
+		pkg.AccountingEntryTypeRealTaxFee:             -1,
+		pkg.AccountingEntryTypeRealRefund:             -1,
+		pkg.AccountingEntryTypeMerchantRefund:         1,
+		pkg.AccountingEntryTypeReverseTaxFee:          1,
+		pkg.AccountingEntryTypeRealChargebackReversal: 1,
+	}
+
+	// Sources of manual corrections, they aren't backed by customer money and their customer clearing side
+	// is booked to the adjustments account.
+	ledgerManualCorrectionSourceTypes = map[string]bool{
+		repository.CollectionMerchant:                  true,
+		repository.CollectionAccountingCorrectionBatch: true,
+	}
+)
+
+type ledgerEntryAccounts struct {
+	debit  string
+	credit string
+}
+
+type ledgerClearingKey struct {
+	sourceType string
+	sourceId   string
+	currency   string
+}
+
+type ledgerClearing struct {
+	line    *internalPkg.LedgerEntry
+	balance float64
+}
+
+// GetTrialBalance returns opening balances, turnovers and closing balances of all accounts of the operating
+// company in the currency for the period. Total debit and credit of balanced books are equal.
+func (s *Service) GetTrialBalance(
+	ctx context.Context,
+	req *internalPkg.TrialBalanceRequest,
+	rsp *internalPkg.TrialBalanceResponse,
+) error {
+	filter, msg := s.getLedgerEntryFilter(ctx, req.OperatingCompanyId, req.Currency, req.From, req.To)
+
+	if msg != nil {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = msg
+		return nil
+	}
+
+	turnovers, err := s.ledgerEntryRepository.GetTurnovers(ctx, filter)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	from := filter.From
+	filter.From = time.Time{}
+	filter.To = from
+	openingTurnovers, err := s.ledgerEntryRepository.GetTurnovers(ctx, filter)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	balance := &internalPkg.TrialBalance{
+		OperatingCompanyId: req.OperatingCompanyId,
+		Currency:           req.Currency,
+		From:               time.Unix(req.From, 0),
+		To:                 time.Unix(req.To, 0),
+	}
+	accounts := make(map[string]*internalPkg.TrialBalanceAccount)
+
+	for _, account := range ledgerAccounts {
+		accounts[account] = &internalPkg.TrialBalanceAccount{Account: account}
+	}
+
+	for _, turnover := range openingTurnovers {
+		if account, ok := accounts[turnover.Account]; ok {
+			account.OpeningBalance = tools.ToPrecise(turnover.Debit - turnover.Credit)
+		}
+	}
+
+	for _, turnover := range turnovers {
+		if account, ok := accounts[turnover.Account]; ok {
+			account.Debit = tools.ToPrecise(turnover.Debit)
+			account.Credit = tools.ToPrecise(turnover.Credit)
+		}
+	}
+
+	for _, name := range ledgerAccounts {
+		account := accounts[name]
+
+		if account.OpeningBalance == 0 && account.Debit == 0 && account.Credit == 0 {
+			continue
+		}
+
+		account.ClosingBalance = tools.ToPrecise(account.OpeningBalance + account.Debit - account.Credit)
+		balance.TotalDebit += account.Debit
+		balance.TotalCredit += account.Credit
+		balance.Accounts = append(balance.Accounts, account)
+	}
+
+	balance.TotalDebit = tools.ToPrecise(balance.TotalDebit)
+	balance.TotalCredit = tools.ToPrecise(balance.TotalCredit)
+	balance.IsBalanced = balance.TotalDebit == balance.TotalCredit
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = balance
+
+	return nil
+}
+
+// GetAccountLedger returns lines of the account of the operating company in the currency for the period
+// with opening and closing balances of the account.
+func (s *Service) GetAccountLedger(
+	ctx context.Context,
+	req *internalPkg.AccountLedgerRequest,
+	rsp *internalPkg.AccountLedgerResponse,
+) error {
+	if !helper.Contains(ledgerAccounts, req.Account) {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = ledgerErrorAccountUnknown
+		return nil
+	}
+
+	filter, msg := s.getLedgerEntryFilter(ctx, req.OperatingCompanyId, req.Currency, req.From, req.To)
+
+	if msg != nil {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = msg
+		return nil
+	}
+
+	if req.Limit <= 0 {
+		req.Limit = pkg.DatabaseRequestDefaultLimit
+	}
+
+	if req.Offset <= 0 {
+		req.Offset = 0
+	}
+
+	filter.Account = req.Account
+	ledger := &internalPkg.AccountLedger{Account: req.Account}
+
+	count, err := s.ledgerEntryRepository.FindCount(ctx, filter)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	if count > 0 {
+		ledger.Items, err = s.ledgerEntryRepository.Find(ctx, filter, req.Limit, req.Offset)
+
+		if err != nil {
+			rsp.Status = billingpb.ResponseStatusSystemError
+			rsp.Message = orderErrorUnknown
+			return nil
+		}
+	}
+
+	turnovers, err := s.ledgerEntryRepository.GetTurnovers(ctx, filter)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	from := filter.From
+	filter.From = time.Time{}
+	filter.To = from
+	openingTurnovers, err := s.ledgerEntryRepository.GetTurnovers(ctx, filter)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	for _, turnover := range openingTurnovers {
+		ledger.OpeningBalance = tools.ToPrecise(turnover.Debit - turnover.Credit)
+	}
+
+	for _, turnover := range turnovers {
+		ledger.Debit = tools.ToPrecise(turnover.Debit)
+		ledger.Credit = tools.ToPrecise(turnover.Credit)
+	}
+
+	ledger.ClosingBalance = tools.ToPrecise(ledger.OpeningBalance + ledger.Debit - ledger.Credit)
+	ledger.Count = count
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = ledger
+
+	return nil
+}
+
+// RebuildLedger books accounting entries which aren't booked to the journal yet, such as entries saved before
+// the journal was introduced, and returns the number of booked journals. Not booked entries of every source
+// document are booked by one journal with the share of the merchant computed from the saved order and refund
+// entries, source document which entries can't be booked by balanced journal is logged and skipped.
+func (s *Service) RebuildLedger(ctx context.Context) (int, error) {
+	var entries []*billingpb.AccountingEntry
+
+	counter := 0
+	opts := options.Find().SetSort(bson.D{{"source.type", 1}, {"source.id", 1}, {"created_at", 1}})
+	cursor, err := s.db.Collection(collectionAccountingEntry).Find(ctx, bson.M{}, opts)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionAccountingEntry),
+		)
+		return counter, err
+	}
+
+	defer cursor.Close(ctx)
+
+	book := func() error {
+		ok, err := s.bookLedgerSourceEntries(ctx, entries)
+
+		if ok {
+			counter++
+		}
+
+		entries = nil
+
+		return err
+	}
+
+	for cursor.Next(ctx) {
+		entry := &billingpb.AccountingEntry{}
+
+		if err = cursor.Decode(entry); err != nil {
+			zap.L().Error(
+				pkg.ErrorQueryCursorExecutionFailed,
+				zap.Error(err),
+				zap.String(pkg.ErrorDatabaseFieldCollection, collectionAccountingEntry),
+			)
+			return counter, err
+		}
+
+		if len(entries) > 0 && (entries[0].GetSource().GetType() != entry.GetSource().GetType() ||
+			entries[0].GetSource().GetId() != entry.GetSource().GetId()) {
+			if err = book(); err != nil {
+				return counter, err
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err = cursor.Err(); err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionAccountingEntry),
+		)
+		return counter, err
+	}
+
+	if len(entries) > 0 {
+		if err = book(); err != nil {
+			return counter, err
+		}
+	}
+
+	return counter, nil
+}
+
+// bookLedgerSourceEntries books accounting entries of the source document which aren't booked to the journal yet,
+// false is returned if there are no such entries or their journal is unbalanced.
+func (s *Service) bookLedgerSourceEntries(ctx context.Context, entries []*billingpb.AccountingEntry) (bool, error) {
+	ids := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		ids = append(ids, entry.Id)
+	}
+
+	booked, err := s.ledgerEntryRepository.GetBookedAccountingEntryIds(ctx, ids)
+
+	if err != nil {
+		return false, err
+	}
+
+	isBooked := make(map[string]bool, len(booked))
+
+	for _, id := range booked {
+		isBooked[id] = true
+	}
+
+	var items []interface{}
+
+	for _, entry := range entries {
+		if !isBooked[entry.Id] {
+			items = append(items, entry)
+		}
+	}
+
+	if len(items) <= 0 {
+		return false, nil
+	}
+
+	journal, err := getLedgerJournal(items, getLedgerClearingSettlements(items), false)
+
+	if err != nil {
+		zap.L().Error(
+			"Accounting entries of source document can't be booked to journal",
+			zap.Error(err),
+			zap.String("source.type", entries[0].GetSource().GetType()),
+			zap.String("source.id", entries[0].GetSource().GetId()),
+		)
+		return false, nil
+	}
+
+	if len(journal) <= 0 {
+		return false, nil
+	}
+
+	if err = s.ledgerEntryRepository.MultipleInsert(ctx, journal); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// getLedgerEntryFilter validates the request of ledger report and returns filter of journal lines for
+// the period, end of the period is moved to the next second to include lines of its last second.
+func (s *Service) getLedgerEntryFilter(
+	ctx context.Context,
+	operatingCompanyId, currency string,
+	from, to int64,
+) (*internalPkg.LedgerEntryFilter, *billingpb.ResponseErrorMessage) {
+	if from <= 0 || to < from {
+		return nil, ledgerErrorPeriodInvalid
+	}
+
+	if !helper.Contains(s.supportedCurrencies, currency) {
+		return nil, ledgerErrorCurrencyInvalid
+	}
+
+	if !s.operatingCompany.Exists(ctx, operatingCompanyId) {
+		return nil, errorOperatingCompanyNotFound
+	}
+
+	filter := &internalPkg.LedgerEntryFilter{
+		OperatingCompanyId: operatingCompanyId,
+		Currency:           currency,
+		From:               time.Unix(from, 0),
+		To:                 time.Unix(to, 0).Add(time.Second),
+	}
+
+	return filter, nil
+}
+
+// getJournal books accounting entries of the handler to the journal, entries of manual correction requests
+// are booked as manual corrections.
+func (h *accountingEntry) getJournal() ([]*internalPkg.LedgerEntry, error) {
+	return getLedgerJournal(h.accountingEntries, h.clearingSettlements, h.req != nil)
+}
+
+// setLedgerClearingSettlement sets the share of the merchant in customer money of the source document
+// of the entry in the currency of the entry.
+func (h *accountingEntry) setLedgerClearingSettlement(entry *billingpb.AccountingEntry, amount float64) {
+	if h.clearingSettlements == nil {
+		h.clearingSettlements = make(map[ledgerClearingKey]float64)
+	}
+
+	key := ledgerClearingKey{sourceType: entry.Source.Type, sourceId: entry.Source.Id, currency: entry.Currency}
+	h.clearingSettlements[key] = amount
+}
+
+// getLedgerJournal books accounting entries to the debit and credit accounts. Entry with negative amount is booked
+// to the opposite sides, entries with zero amount aren't booked. Customer clearing side of manual correction
+// is booked to the adjustments account. Customer clearing account of every source document must net to zero:
+// balance left in it by entries of the source must be equal to the expected share of the merchant in customer
+// money of the source, which is settled to the merchant payable account. The journal with clearing balance
+// different from the share or with lines of one source document booked for different merchants is unbalanced.
+func getLedgerJournal(
+	entries []interface{},
+	settlements map[ledgerClearingKey]float64,
+	isManualCorrection bool,
+) ([]*internalPkg.LedgerEntry, error) {
+	var (
+		journal      []*internalPkg.LedgerEntry
+		clearingKeys []ledgerClearingKey
+	)
+
+	journalId := primitive.NewObjectID().Hex()
+	now := time.Now()
+	clearings := make(map[ledgerClearingKey]*ledgerClearing)
+
+	for _, item := range entries {
+		entry := item.(*billingpb.AccountingEntry)
+		debit, credit, amount, err := getLedgerBooking(entry)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if amount == 0 {
+			continue
+		}
+
+		if isManualCorrection || ledgerManualCorrectionSourceTypes[entry.GetSource().GetType()] {
+			debit = getLedgerManualCorrectionAccount(debit)
+			credit = getLedgerManualCorrectionAccount(credit)
+		}
+
+		date, err := ptypes.Timestamp(entry.CreatedAt)
+
+		if err != nil {
+			date = now
+		}
+
+		line := &internalPkg.LedgerEntry{
+			JournalId:          journalId,
+			AccountingEntryId:  entry.Id,
+			EntryType:          entry.Type,
+			Currency:           entry.Currency,
+			OperatingCompanyId: entry.OperatingCompanyId,
+			MerchantId:         entry.MerchantId,
+			SourceId:           entry.GetSource().GetId(),
+			SourceType:         entry.GetSource().GetType(),
+			Date:               date,
+			CreatedAt:          now,
+		}
+
+		debitLine := *line
+		debitLine.Id = primitive.NewObjectID().Hex()
+		debitLine.Account = debit
+		debitLine.Debit = amount
+
+		creditLine := *line
+		creditLine.Id = primitive.NewObjectID().Hex()
+		creditLine.Account = credit
+		creditLine.Credit = amount
+
+		journal = append(journal, &debitLine, &creditLine)
+
+		if debit != internalPkg.LedgerAccountCustomerClearing && credit != internalPkg.LedgerAccountCustomerClearing {
+			continue
+		}
+
+		key := ledgerClearingKey{sourceType: line.SourceType, sourceId: line.SourceId, currency: line.Currency}
+		clearing, ok := clearings[key]
+
+		if !ok {
+			clearing = &ledgerClearing{line: line}
+			clearings[key] = clearing
+			clearingKeys = append(clearingKeys, key)
+		}
+
+		if clearing.line.MerchantId != line.MerchantId || clearing.line.OperatingCompanyId != line.OperatingCompanyId {
+			return nil, accountingEntryErrorJournalUnbalanced
+		}
+
+		if debit == internalPkg.LedgerAccountCustomerClearing {
+			clearing.balance += amount
+		} else {
+			clearing.balance -= amount
+		}
+	}
+
+	for key, settlement := range settlements {
+		if _, ok := clearings[key]; !ok && tools.ToPrecise(settlement) != 0 {
+			return nil, accountingEntryErrorJournalUnbalanced
+		}
+	}
+
+	for _, key := range clearingKeys {
+		clearing := clearings[key]
+		settlement := tools.ToPrecise(settlements[key])
+
+		if tools.ToPrecise(clearing.balance+settlement) != 0 {
+			return nil, accountingEntryErrorJournalUnbalanced
+		}
+
+		if settlement == 0 {
+			continue
+		}
+
+		if clearing.line.MerchantId == "" {
+			return nil, accountingEntryErrorJournalUnbalanced
+		}
+
+		journal = append(journal, getLedgerClearingSettlement(clearing.line, settlement)...)
+	}
+
+	return journal, nil
+}
+
+// getLedgerClearingSettlements returns shares of the merchant in customer money of source documents computed
+// from amounts of the saved order and refund entries.
+func getLedgerClearingSettlements(entries []interface{}) map[ledgerClearingKey]float64 {
+	settlements := make(map[ledgerClearingKey]float64)
+
+	for _, item := range entries {
+		entry := item.(*billingpb.AccountingEntry)
+		factor, ok := ledgerClearingSettlementFactors[entry.Type]
+
+		if !ok || ledgerManualCorrectionSourceTypes[entry.GetSource().GetType()] {
+			continue
+		}
+
+		key := ledgerClearingKey{
+			sourceType: entry.GetSource().GetType(),
+			sourceId:   entry.GetSource().GetId(),
+			currency:   entry.Currency,
+		}
+		settlements[key] += factor * tools.ToPrecise(entry.Amount)
+	}
+
+	return settlements
+}
+
+// getLedgerClearingSettlement returns lines settling the share of the merchant from the customer clearing account
+// to the merchant payable account, negative share is charged to the merchant. Lines copy the source document
+// of the template line.
+func getLedgerClearingSettlement(template *internalPkg.LedgerEntry, settlement float64) []*internalPkg.LedgerEntry {
+	debitLine := *template
+	debitLine.Id = primitive.NewObjectID().Hex()
+	debitLine.AccountingEntryId = ""
+	debitLine.EntryType = internalPkg.LedgerEntryTypeClearingSettlement
+
+	creditLine := debitLine
+	creditLine.Id = primitive.NewObjectID().Hex()
+
+	if settlement > 0 {
+		debitLine.Account = internalPkg.LedgerAccountCustomerClearing
+		creditLine.Account = internalPkg.LedgerAccountMerchantPayable
+	} else {
+		debitLine.Account = internalPkg.LedgerAccountMerchantPayable
+		creditLine.Account = internalPkg.LedgerAccountCustomerClearing
+		settlement = -settlement
+	}
+
+	debitLine.Debit = settlement
+	creditLine.Credit = settlement
+
+	return []*internalPkg.LedgerEntry{&debitLine, &creditLine}
+}
+
+// getLedgerManualCorrectionAccount returns the account of manual correction booked instead of the account.
+func getLedgerManualCorrectionAccount(account string) string {
+	if account == internalPkg.LedgerAccountCustomerClearing {
+		return internalPkg.LedgerAccountAdjustments
+	}
+
+	return account
+}
+
+// getLedgerBooking returns debit and credit accounts of the accounting entry and positive amount booked to them,
+// accounts are swapped for entry with negative amount.
+func getLedgerBooking(entry *billingpb.AccountingEntry) (string, string, float64, error) {
+	accounts, ok := ledgerAccountsByEntryType[entry.Type]
+
+	if !ok {
+		return "", "", 0, accountingEntryErrorLedgerAccountsNotFound
+	}
+
+	amount := tools.ToPrecise(entry.Amount)
+
+	if amount < 0 {
+		return accounts.credit, accounts.debit, -amount, nil
+	}
+
+	return accounts.debit, accounts.credit, amount, nil
+}
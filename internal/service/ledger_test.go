@@ -0,0 +1,477 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/go-redis/redis"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/mongodb"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	"github.com/paysuper/paysuper-billing-server/internal/database"
+	"github.com/paysuper/paysuper-billing-server/internal/mocks"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/internal/repository"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	casbinMocks "github.com/paysuper/paysuper-proto/go/casbinpb/mocks"
+	reportingMocks "github.com/paysuper/paysuper-proto/go/reporterpb/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	rabbitmq "gopkg.in/ProtocolONE/rabbitmq.v1/pkg"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type LedgerTestSuite struct {
+	suite.Suite
+	service *Service
+	log     *zap.Logger
+	cache   database.CacheInterface
+
+	merchant      *billingpb.Merchant
+	project       *billingpb.Project
+	paymentMethod *billingpb.PaymentMethod
+	paymentSystem *billingpb.PaymentSystem
+}
+
+func Test_Ledger(t *testing.T) {
+	suite.Run(t, new(LedgerTestSuite))
+}
+
+func (suite *LedgerTestSuite) SetupTest() {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		suite.FailNow("Config load failed", "%v", err)
+	}
+	cfg.CardPayApiUrl = "https://sandbox.cardpay.com"
+
+	m, err := migrate.New(
+		"file://../../migrations/tests",
+		cfg.MongoDsn)
+	assert.NoError(suite.T(), err, "Migrate init failed")
+
+	err = m.Up()
+	if err != nil && err.Error() != "no change" {
+		suite.FailNow("Migrations failed", "%v", err)
+	}
+
+	ctx, _ := context.WithTimeout(context.Background(), 50*time.Second)
+	opts := []mongodb.Option{mongodb.Context(ctx)}
+	db, err := mongodb.NewDatabase(opts...)
+	if err != nil {
+		suite.FailNow("Database connection failed", "%v", err)
+	}
+
+	suite.log, err = zap.NewProduction()
+
+	if err != nil {
+		suite.FailNow("Logger initialization failed", "%v", err)
+	}
+
+	broker, err := rabbitmq.NewBroker(cfg.BrokerAddress)
+
+	if err != nil {
+		suite.FailNow("Creating RabbitMQ publisher failed", "%v", err)
+	}
+
+	redisClient := database.NewRedis(
+		&redis.Options{
+			Addr:     cfg.RedisHost,
+			Password: cfg.RedisPassword,
+		},
+	)
+
+	redisdb := mocks.NewTestRedis()
+	suite.cache, err = database.NewCacheRedis(redisdb, "cache")
+	suite.service = NewBillingService(
+		db,
+		cfg,
+		mocks.NewGeoIpServiceTestOk(),
+		mocks.NewRepositoryServiceOk(),
+		mocks.NewTaxServiceOkMock(),
+		broker,
+		redisClient,
+		suite.cache,
+		mocks.NewCurrencyServiceMockOk(),
+		mocks.NewDocumentSignerMockOk(),
+		&reportingMocks.ReporterService{},
+		mocks.NewFormatterOK(),
+		mocks.NewBrokerMockOk(),
+		&casbinMocks.CasbinService{},
+	)
+
+	if err := suite.service.Init(); err != nil {
+		suite.FailNow("Billing service initialization failed", "%v", err)
+	}
+
+	suite.merchant, suite.project, suite.paymentMethod, suite.paymentSystem = helperCreateEntitiesForTests(suite.Suite, suite.service)
+
+	centrifugoMock := &mocks.CentrifugoInterface{}
+	centrifugoMock.On("GetChannelToken", mock.Anything, mock.Anything).Return("token")
+	centrifugoMock.On("Publish", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	suite.service.centrifugoDashboard = centrifugoMock
+	suite.service.centrifugoPaymentForm = centrifugoMock
+}
+
+func (suite *LedgerTestSuite) TearDownTest() {
+	err := suite.service.db.Drop()
+
+	if err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	err = suite.service.db.Close()
+
+	if err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *LedgerTestSuite) TestLedger_AllAccountingEntryTypesMapped_Ok() {
+	for entryType := range availableAccountingEntries {
+		accounts, ok := ledgerAccountsByEntryType[entryType]
+		assert.True(suite.T(), ok, entryType)
+		assert.NotEqual(suite.T(), accounts.debit, accounts.credit, entryType)
+		assert.Contains(suite.T(), ledgerAccounts, accounts.debit, entryType)
+		assert.Contains(suite.T(), ledgerAccounts, accounts.credit, entryType)
+	}
+}
+
+func (suite *LedgerTestSuite) TestLedger_GetJournal_Ok() {
+	source := &billingpb.AccountingEntrySource{Id: primitive.NewObjectID().Hex(), Type: repository.CollectionOrder}
+	entry := suite.getAccountingEntry(pkg.AccountingEntryTypeRealGrossRevenue, 100, source)
+	handler := &accountingEntry{
+		Service: suite.service,
+		ctx:     context.TODO(),
+		accountingEntries: []interface{}{
+			entry,
+			suite.getAccountingEntry(pkg.AccountingEntryTypeMerchantTaxFee, -10, source),
+			suite.getAccountingEntry(pkg.AccountingEntryTypePsProfitTotal, 0, source),
+		},
+	}
+	handler.setLedgerClearingSettlement(entry, 90)
+
+	journal, err := handler.getJournal()
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), journal, 6)
+	assert.Equal(suite.T(), journal[0].JournalId, journal[5].JournalId)
+
+	assert.Equal(suite.T(), internalPkg.LedgerAccountPaymentSystem, journal[0].Account)
+	assert.Equal(suite.T(), float64(100), journal[0].Debit)
+	assert.Equal(suite.T(), internalPkg.LedgerAccountCustomerClearing, journal[1].Account)
+	assert.Equal(suite.T(), float64(100), journal[1].Credit)
+
+	assert.Equal(suite.T(), internalPkg.LedgerAccountCustomerClearing, journal[2].Account)
+	assert.Equal(suite.T(), float64(10), journal[2].Debit)
+	assert.Equal(suite.T(), internalPkg.LedgerAccountMerchantPayable, journal[3].Account)
+	assert.Equal(suite.T(), float64(10), journal[3].Credit)
+
+	assert.Equal(suite.T(), internalPkg.LedgerEntryTypeClearingSettlement, journal[4].EntryType)
+	assert.Empty(suite.T(), journal[4].AccountingEntryId)
+	assert.Equal(suite.T(), source.Id, journal[4].SourceId)
+	assert.Equal(suite.T(), internalPkg.LedgerAccountCustomerClearing, journal[4].Account)
+	assert.Equal(suite.T(), float64(90), journal[4].Debit)
+	assert.Equal(suite.T(), internalPkg.LedgerAccountMerchantPayable, journal[5].Account)
+	assert.Equal(suite.T(), float64(90), journal[5].Credit)
+}
+
+func (suite *LedgerTestSuite) TestLedger_GetJournal_ClearingDiffersFromSettlement_Error() {
+	source := &billingpb.AccountingEntrySource{Id: primitive.NewObjectID().Hex(), Type: repository.CollectionOrder}
+	entry := suite.getAccountingEntry(pkg.AccountingEntryTypeRealGrossRevenue, 100, source)
+	handler := &accountingEntry{
+		Service: suite.service,
+		ctx:     context.TODO(),
+		accountingEntries: []interface{}{
+			entry,
+			suite.getAccountingEntry(pkg.AccountingEntryTypeRealTaxFee, 10, source),
+		},
+	}
+	handler.setLedgerClearingSettlement(entry, 100)
+
+	journal, err := handler.getJournal()
+	assert.Equal(suite.T(), accountingEntryErrorJournalUnbalanced, err)
+	assert.Nil(suite.T(), journal)
+
+	handler.accountingEntries = []interface{}{
+		suite.getAccountingEntry(pkg.AccountingEntryTypePsProfitTotal, 100, source),
+	}
+	journal, err = handler.getJournal()
+	assert.Equal(suite.T(), accountingEntryErrorJournalUnbalanced, err)
+	assert.Nil(suite.T(), journal)
+}
+
+func (suite *LedgerTestSuite) TestLedger_GetJournal_ManualCorrection_Ok() {
+	source := &billingpb.AccountingEntrySource{Id: primitive.NewObjectID().Hex(), Type: repository.CollectionOrder}
+	handler := &accountingEntry{
+		Service: suite.service,
+		ctx:     context.TODO(),
+		req:     &billingpb.CreateAccountingEntryRequest{},
+		accountingEntries: []interface{}{
+			suite.getAccountingEntry(pkg.AccountingEntryTypeRealGrossRevenue, 10, source),
+		},
+	}
+
+	journal, err := handler.getJournal()
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), journal, 2)
+	assert.Equal(suite.T(), internalPkg.LedgerAccountPaymentSystem, journal[0].Account)
+	assert.Equal(suite.T(), float64(10), journal[0].Debit)
+	assert.Equal(suite.T(), internalPkg.LedgerAccountAdjustments, journal[1].Account)
+	assert.Equal(suite.T(), float64(10), journal[1].Credit)
+}
+
+func (suite *LedgerTestSuite) TestLedger_GetJournal_ClearingNotSettled_Error() {
+	source := &billingpb.AccountingEntrySource{Id: suite.merchant.Id, Type: repository.CollectionMerchant}
+	handler := &accountingEntry{
+		Service: suite.service,
+		ctx:     context.TODO(),
+		accountingEntries: []interface{}{
+			suite.getAccountingEntry(pkg.AccountingEntryTypeMerchantRoyaltyCorrection, 50, source),
+			suite.getAccountingEntry(pkg.AccountingEntryTypeRealChargebackReversal, 50, source),
+		},
+	}
+
+	journal, err := handler.getJournal()
+	assert.Equal(suite.T(), accountingEntryErrorJournalUnbalanced, err)
+	assert.Nil(suite.T(), journal)
+}
+
+func (suite *LedgerTestSuite) TestLedger_GetJournal_SourceOfDifferentMerchants_Error() {
+	source := &billingpb.AccountingEntrySource{Id: primitive.NewObjectID().Hex(), Type: repository.CollectionRefund}
+	entry := suite.getAccountingEntry(pkg.AccountingEntryTypeMerchantRefund, 100, source)
+	entry.MerchantId = primitive.NewObjectID().Hex()
+	handler := &accountingEntry{
+		Service: suite.service,
+		ctx:     context.TODO(),
+		accountingEntries: []interface{}{
+			suite.getAccountingEntry(pkg.AccountingEntryTypeRealRefund, 100, source),
+			entry,
+		},
+	}
+
+	journal, err := handler.getJournal()
+	assert.Equal(suite.T(), accountingEntryErrorJournalUnbalanced, err)
+	assert.Nil(suite.T(), journal)
+}
+
+func (suite *LedgerTestSuite) TestLedger_GetJournal_UnknownType_Error() {
+	handler := &accountingEntry{
+		Service: suite.service,
+		ctx:     context.TODO(),
+		accountingEntries: []interface{}{
+			&billingpb.AccountingEntry{Id: "1", Type: "unknown", Amount: 100, Currency: "USD"},
+		},
+	}
+
+	journal, err := handler.getJournal()
+	assert.Equal(suite.T(), accountingEntryErrorLedgerAccountsNotFound, err)
+	assert.Nil(suite.T(), journal)
+}
+
+func (suite *LedgerTestSuite) TestLedger_GetTrialBalance_Ok() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	req := &internalPkg.TrialBalanceRequest{
+		OperatingCompanyId: suite.merchant.OperatingCompanyId,
+		Currency:           order.GetMerchantRoyaltyCurrency(),
+		From:               time.Now().Add(-time.Hour).Unix(),
+		To:                 time.Now().Add(time.Hour).Unix(),
+	}
+	rsp := &internalPkg.TrialBalanceResponse{}
+	err := suite.service.GetTrialBalance(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.True(suite.T(), rsp.Item.IsBalanced)
+	assert.NotEmpty(suite.T(), rsp.Item.Accounts)
+	assert.True(suite.T(), rsp.Item.TotalDebit > 0)
+	assert.Equal(suite.T(), rsp.Item.TotalDebit, rsp.Item.TotalCredit)
+
+	for _, account := range rsp.Item.Accounts {
+		assert.Zero(suite.T(), account.OpeningBalance)
+		assert.Equal(suite.T(), account.ClosingBalance, account.Debit-account.Credit)
+
+		if account.Account == internalPkg.LedgerAccountCustomerClearing {
+			assert.Zero(suite.T(), account.ClosingBalance)
+		}
+	}
+
+	req.From = time.Now().Add(time.Hour).Unix()
+	req.To = time.Now().Add(2 * time.Hour).Unix()
+	rsp = &internalPkg.TrialBalanceResponse{}
+	err = suite.service.GetTrialBalance(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.True(suite.T(), rsp.Item.IsBalanced)
+	assert.Zero(suite.T(), rsp.Item.TotalDebit)
+
+	for _, account := range rsp.Item.Accounts {
+		assert.Zero(suite.T(), account.Debit)
+		assert.Zero(suite.T(), account.Credit)
+		assert.Equal(suite.T(), account.OpeningBalance, account.ClosingBalance)
+	}
+}
+
+func (suite *LedgerTestSuite) TestLedger_GetTrialBalance_PeriodInvalid_Error() {
+	req := &internalPkg.TrialBalanceRequest{
+		OperatingCompanyId: suite.merchant.OperatingCompanyId,
+		Currency:           "USD",
+		From:               time.Now().Unix(),
+		To:                 time.Now().Add(-time.Hour).Unix(),
+	}
+	rsp := &internalPkg.TrialBalanceResponse{}
+	err := suite.service.GetTrialBalance(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), ledgerErrorPeriodInvalid, rsp.Message)
+	assert.Nil(suite.T(), rsp.Item)
+}
+
+func (suite *LedgerTestSuite) TestLedger_GetTrialBalance_CurrencyInvalid_Error() {
+	req := &internalPkg.TrialBalanceRequest{
+		OperatingCompanyId: suite.merchant.OperatingCompanyId,
+		Currency:           "XXX",
+		From:               time.Now().Add(-time.Hour).Unix(),
+		To:                 time.Now().Unix(),
+	}
+	rsp := &internalPkg.TrialBalanceResponse{}
+	err := suite.service.GetTrialBalance(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), ledgerErrorCurrencyInvalid, rsp.Message)
+}
+
+func (suite *LedgerTestSuite) TestLedger_GetTrialBalance_OperatingCompanyNotFound_Error() {
+	req := &internalPkg.TrialBalanceRequest{
+		OperatingCompanyId: "ffffffffffffffffffffffff",
+		Currency:           "USD",
+		From:               time.Now().Add(-time.Hour).Unix(),
+		To:                 time.Now().Unix(),
+	}
+	rsp := &internalPkg.TrialBalanceResponse{}
+	err := suite.service.GetTrialBalance(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), errorOperatingCompanyNotFound, rsp.Message)
+}
+
+func (suite *LedgerTestSuite) TestLedger_GetAccountLedger_Ok() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	req := &internalPkg.AccountLedgerRequest{
+		OperatingCompanyId: suite.merchant.OperatingCompanyId,
+		Currency:           order.GetMerchantRoyaltyCurrency(),
+		Account:            internalPkg.LedgerAccountMerchantPayable,
+		From:               time.Now().Add(-time.Hour).Unix(),
+		To:                 time.Now().Add(time.Hour).Unix(),
+	}
+	rsp := &internalPkg.AccountLedgerResponse{}
+	err := suite.service.GetAccountLedger(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.True(suite.T(), rsp.Item.Count > 0)
+	assert.Len(suite.T(), rsp.Item.Items, int(rsp.Item.Count))
+	assert.Zero(suite.T(), rsp.Item.OpeningBalance)
+	assert.Equal(suite.T(), rsp.Item.ClosingBalance, rsp.Item.Debit-rsp.Item.Credit)
+
+	for _, item := range rsp.Item.Items {
+		assert.Equal(suite.T(), internalPkg.LedgerAccountMerchantPayable, item.Account)
+		assert.Equal(suite.T(), order.Id, item.SourceId)
+	}
+}
+
+func (suite *LedgerTestSuite) TestLedger_GetAccountLedger_AccountUnknown_Error() {
+	req := &internalPkg.AccountLedgerRequest{
+		OperatingCompanyId: suite.merchant.OperatingCompanyId,
+		Currency:           "USD",
+		Account:            "unknown",
+		From:               time.Now().Add(-time.Hour).Unix(),
+		To:                 time.Now().Unix(),
+	}
+	rsp := &internalPkg.AccountLedgerResponse{}
+	err := suite.service.GetAccountLedger(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), ledgerErrorAccountUnknown, rsp.Message)
+	assert.Nil(suite.T(), rsp.Item)
+}
+
+func (suite *LedgerTestSuite) TestLedger_SaveAccountingEntries_JournalInsertFailed_RolledBack() {
+	source := &billingpb.AccountingEntrySource{Id: primitive.NewObjectID().Hex(), Type: repository.CollectionOrder}
+	entry := suite.getAccountingEntry(pkg.AccountingEntryTypeRealGrossRevenue, 100, source)
+
+	ledgerEntryRepository := &mocks.LedgerEntryRepositoryInterface{}
+	ledgerEntryRepository.On("MultipleInsert", mock.Anything, mock.Anything).Return(errors.New("some error"))
+	ledgerEntryRepository.On("DeleteByJournalId", mock.Anything, mock.Anything).Return(nil)
+	suite.service.ledgerEntryRepository = ledgerEntryRepository
+
+	handler := &accountingEntry{
+		Service:           suite.service,
+		ctx:               context.TODO(),
+		accountingEntries: []interface{}{entry},
+	}
+	handler.setLedgerClearingSettlement(entry, 100)
+	err := handler.saveAccountingEntries()
+	assert.Error(suite.T(), err)
+	ledgerEntryRepository.AssertCalled(suite.T(), "DeleteByJournalId", mock.Anything, mock.Anything)
+
+	oid, _ := primitive.ObjectIDFromHex(entry.Id)
+	count, err := suite.service.db.Collection(collectionAccountingEntry).CountDocuments(context.TODO(), bson.M{"_id": oid})
+	assert.NoError(suite.T(), err)
+	assert.Zero(suite.T(), count)
+}
+
+func (suite *LedgerTestSuite) TestLedger_RebuildLedger_Ok() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	filter := &internalPkg.LedgerEntryFilter{
+		OperatingCompanyId: suite.merchant.OperatingCompanyId,
+		Currency:           order.GetMerchantRoyaltyCurrency(),
+	}
+
+	lines, err := suite.service.ledgerEntryRepository.Find(context.TODO(), filter, 100, 0)
+	assert.NoError(suite.T(), err)
+	assert.NotEmpty(suite.T(), lines)
+
+	err = suite.service.ledgerEntryRepository.DeleteByJournalId(context.TODO(), lines[0].JournalId)
+	assert.NoError(suite.T(), err)
+
+	count, err := suite.service.RebuildLedger(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, count)
+
+	rebuilt, err := suite.service.ledgerEntryRepository.Find(context.TODO(), filter, 100, 0)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), rebuilt, len(lines))
+
+	filter.Account = internalPkg.LedgerAccountCustomerClearing
+	turnovers, err := suite.service.ledgerEntryRepository.GetTurnovers(context.TODO(), filter)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), turnovers, 1)
+	assert.InDelta(suite.T(), turnovers[0].Debit, turnovers[0].Credit, 0.001)
+
+	count, err = suite.service.RebuildLedger(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Zero(suite.T(), count)
+}
+
+func (suite *LedgerTestSuite) getAccountingEntry(
+	entryType string,
+	amount float64,
+	source *billingpb.AccountingEntrySource,
+) *billingpb.AccountingEntry {
+	return &billingpb.AccountingEntry{
+		Id:                 primitive.NewObjectID().Hex(),
+		Object:             pkg.ObjectTypeBalanceTransaction,
+		Type:               entryType,
+		Source:             source,
+		MerchantId:         suite.merchant.Id,
+		OperatingCompanyId: suite.merchant.OperatingCompanyId,
+		Amount:             amount,
+		Currency:           "USD",
+		CreatedAt:          ptypes.TimestampNow(),
+	}
+}
@@ -16,6 +16,14 @@ import (
 type PaymentSystemMockOk struct{}
 type PaymentSystemMockError struct{}
 
+func init() {
+	RegisterPaymentSystemHandler(paymentSystemHandlerMockOk, NewPaymentSystemMockOk)
+	RegisterPaymentSystemHandler(paymentSystemHandlerMockError, NewPaymentSystemMockError)
+	RegisterPaymentSystemHandler(paymentSystemHandlerCardPayMock, NewCardPayMock)
+	RegisterPaymentSystemHandler(paymentSystemHandlerCardPayMockUnavailable, NewCardPayMockUnavailable)
+	RegisterPaymentSystemHandler(paymentSystemHandlerCardPayMockTwoStep, NewCardPayMockTwoStep)
+}
+
 func NewPaymentSystemMockOk() Gate {
 	return &PaymentSystemMockOk{}
 }
@@ -34,6 +42,8 @@ func NewCardPayMock() Gate {
 			},
 			nil,
 		)
+	cpMock.On("AuthorizePayment", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return("", paymentSystemErrorTwoStepNotSupported)
 	cpMock.On("ProcessPayment", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
 		Return(
 			func(order *billingpb.Order, message proto.Message, raw, signature string) error {
@@ -63,6 +73,47 @@ func NewCardPayMock() Gate {
 			},
 			nil,
 		)
+	cpMock.On("DecodePaymentCallback", mock.Anything).
+		Return(
+			func(raw []byte) proto.Message {
+				message, _ := decodeCardPayPaymentCallback(raw)
+				return message
+			},
+			func(raw []byte) error {
+				_, err := decodeCardPayPaymentCallback(raw)
+				return err
+			},
+		)
+	cpMock.On("DecodeRefundCallback", mock.Anything).
+		Return(
+			func(raw []byte) proto.Message {
+				message, _ := decodeCardPayRefundCallback(raw)
+				return message
+			},
+			func(raw []byte) error {
+				_, err := decodeCardPayRefundCallback(raw)
+				return err
+			},
+		)
+	cpMock.On("GetRefundId", mock.Anything).
+		Return(
+			func(request proto.Message) string {
+				return request.(*billingpb.CardPayRefundCallback).MerchantOrder.Id
+			},
+		)
+	cpMock.On("CheckCallbackSignature", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	cpMock.On("GetCallbackTransaction", mock.Anything).
+		Return(
+			func(request proto.Message) string {
+				id, _ := getCardPayCallbackTransaction(request)
+				return id
+			},
+			func(request proto.Message) string {
+				_, status := getCardPayCallbackTransaction(request)
+				return status
+			},
+		)
+	cpMock.On("GetPaymentMethodGroups").Return(cardPayPaymentMethodGroups)
 	cpMock.On("IsRecurringCallback", mock.Anything).Return(false)
 	cpMock.On("GetRecurringId", mock.Anything).Return("0987654321")
 	cpMock.On("CreateRefund", mock.Anything, mock.Anything).
@@ -94,10 +145,103 @@ func NewCardPayMock() Gate {
 	return cpMock
 }
 
+// NewCardPayMockTwoStep returns mock of CardPay handler which authorizes payments and sets status of order
+// by status from payment notification.
+func NewCardPayMockTwoStep() Gate {
+	cpMock := &mocks.PaymentSystem{}
+	cpMock.On("AuthorizePayment", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(
+			func(order *billingpb.Order, successUrl, failUrl string, requisites map[string]string) string {
+				order.PrivateStatus = recurringpb.OrderStatusPaymentSystemCreate
+				return "http://localhost"
+			},
+			nil,
+		)
+	cpMock.On("ProcessPayment", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(
+			func(order *billingpb.Order, message proto.Message, raw, signature string) error {
+				req := message.(*billingpb.CardPayPaymentCallback)
+
+				switch req.GetStatus() {
+				case billingpb.CardPayPaymentResponseStatusAuthorized:
+					order.PrivateStatus = pkg.OrderStatusPaymentSystemAuthorized
+				case cardPayPaymentStatusVoided:
+					order.PrivateStatus = pkg.OrderStatusPaymentSystemVoided
+				case billingpb.CardPayPaymentResponseStatusCompleted:
+					order.PrivateStatus = recurringpb.OrderStatusPaymentSystemComplete
+				default:
+					order.PrivateStatus = recurringpb.OrderStatusPaymentSystemDeclined
+				}
+
+				order.PaymentMethodTxnParams = map[string]string{
+					"emission_country": "US",
+					"pan":              req.CardAccount.MaskedPan,
+					"card_holder":      "UNIT TEST",
+				}
+				order.Transaction = req.GetId()
+				order.PaymentMethodOrderClosedAt = ptypes.TimestampNow()
+
+				return nil
+			},
+		)
+	cpMock.On("CapturePayment", mock.Anything, mock.Anything).Return(nil)
+	cpMock.On("VoidPayment", mock.Anything).Return(nil)
+	cpMock.On("DecodePaymentCallback", mock.Anything).
+		Return(
+			func(raw []byte) proto.Message {
+				message, _ := decodeCardPayPaymentCallback(raw)
+				return message
+			},
+			func(raw []byte) error {
+				_, err := decodeCardPayPaymentCallback(raw)
+				return err
+			},
+		)
+	cpMock.On("CheckCallbackSignature", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	cpMock.On("GetCallbackTransaction", mock.Anything).
+		Return(
+			func(request proto.Message) string {
+				id, _ := getCardPayCallbackTransaction(request)
+				return id
+			},
+			func(request proto.Message) string {
+				_, status := getCardPayCallbackTransaction(request)
+				return status
+			},
+		)
+	cpMock.On("GetPaymentMethodGroups").Return(cardPayPaymentMethodGroups)
+	cpMock.On("IsRecurringCallback", mock.Anything).Return(false)
+
+	return cpMock
+}
+
+func NewCardPayMockUnavailable() Gate {
+	cpMock := &mocks.PaymentSystem{}
+	cpMock.On("CreatePayment", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return("", errors.New("dial tcp: connect: connection refused"))
+	cpMock.On("AuthorizePayment", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return("", errors.New("dial tcp: connect: connection refused"))
+	cpMock.On("GetPaymentMethodGroups").Return(cardPayPaymentMethodGroups)
+
+	return cpMock
+}
+
 func (m *PaymentSystemMockOk) CreatePayment(order *billingpb.Order, successUrl, failUrl string, requisites map[string]string) (string, error) {
 	return "", nil
 }
 
+func (m *PaymentSystemMockOk) AuthorizePayment(order *billingpb.Order, successUrl, failUrl string, requisites map[string]string) (string, error) {
+	return "", nil
+}
+
+func (m *PaymentSystemMockOk) CapturePayment(order *billingpb.Order, amount float64) error {
+	return nil
+}
+
+func (m *PaymentSystemMockOk) VoidPayment(order *billingpb.Order) error {
+	return nil
+}
+
 func (m *PaymentSystemMockOk) ProcessPayment(order *billingpb.Order, message proto.Message, raw, signature string) error {
 	return nil
 }
@@ -110,6 +254,30 @@ func (m *PaymentSystemMockOk) GetRecurringId(request proto.Message) string {
 	return ""
 }
 
+func (m *PaymentSystemMockOk) DecodePaymentCallback(raw []byte) (proto.Message, error) {
+	return nil, paymentSystemErrorCallbackNotSupported
+}
+
+func (m *PaymentSystemMockOk) DecodeRefundCallback(raw []byte) (proto.Message, error) {
+	return nil, paymentSystemErrorCallbackNotSupported
+}
+
+func (m *PaymentSystemMockOk) GetRefundId(request proto.Message) string {
+	return ""
+}
+
+func (m *PaymentSystemMockOk) CheckCallbackSignature(order *billingpb.Order, raw, signature string) error {
+	return nil
+}
+
+func (m *PaymentSystemMockOk) GetCallbackTransaction(request proto.Message) (string, string) {
+	return "", ""
+}
+
+func (m *PaymentSystemMockOk) GetPaymentMethodGroups() []string {
+	return cardPayPaymentMethodGroups
+}
+
 func (m *PaymentSystemMockOk) CreateRefund(order *billingpb.Order, refund *billingpb.Refund) error {
 	refund.Status = pkg.RefundStatusInProgress
 	refund.ExternalId = primitive.NewObjectID().Hex()
@@ -128,6 +296,18 @@ func (m *PaymentSystemMockError) CreatePayment(order *billingpb.Order, successUr
 	return "", nil
 }
 
+func (m *PaymentSystemMockError) AuthorizePayment(order *billingpb.Order, successUrl, failUrl string, requisites map[string]string) (string, error) {
+	return "", paymentSystemErrorTwoStepNotSupported
+}
+
+func (m *PaymentSystemMockError) CapturePayment(order *billingpb.Order, amount float64) error {
+	return paymentSystemErrorTwoStepNotSupported
+}
+
+func (m *PaymentSystemMockError) VoidPayment(order *billingpb.Order) error {
+	return paymentSystemErrorTwoStepNotSupported
+}
+
 func (m *PaymentSystemMockError) ProcessPayment(order *billingpb.Order, message proto.Message, raw, signature string) error {
 	return nil
 }
@@ -140,6 +320,30 @@ func (m *PaymentSystemMockError) GetRecurringId(request proto.Message) string {
 	return ""
 }
 
+func (m *PaymentSystemMockError) DecodePaymentCallback(raw []byte) (proto.Message, error) {
+	return nil, paymentSystemErrorCallbackNotSupported
+}
+
+func (m *PaymentSystemMockError) DecodeRefundCallback(raw []byte) (proto.Message, error) {
+	return nil, paymentSystemErrorCallbackNotSupported
+}
+
+func (m *PaymentSystemMockError) GetRefundId(request proto.Message) string {
+	return ""
+}
+
+func (m *PaymentSystemMockError) CheckCallbackSignature(order *billingpb.Order, raw, signature string) error {
+	return nil
+}
+
+func (m *PaymentSystemMockError) GetCallbackTransaction(request proto.Message) (string, string) {
+	return "", ""
+}
+
+func (m *PaymentSystemMockError) GetPaymentMethodGroups() []string {
+	return cardPayPaymentMethodGroups
+}
+
 func (m *PaymentSystemMockError) CreateRefund(order *billingpb.Order, refund *billingpb.Refund) error {
 	refund.Status = pkg.RefundStatusRejected
 	return errors.New(pkg.PaymentSystemErrorCreateRefundFailed)
@@ -10,12 +10,12 @@ import (
 	"fmt"
 	geoip "github.com/ProtocolONE/geoip-service/pkg/proto"
 	"github.com/golang/protobuf/jsonpb"
-	protobuf "github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 	structpb "github.com/golang/protobuf/ptypes/struct"
 	"github.com/google/uuid"
 	"github.com/jinzhu/copier"
 	"github.com/paysuper/paysuper-billing-server/internal/helper"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
 	"github.com/paysuper/paysuper-billing-server/pkg"
 	"github.com/paysuper/paysuper-proto/go/billingpb"
 	"github.com/paysuper/paysuper-proto/go/currenciespb"
@@ -132,6 +132,8 @@ var (
 	orderErrorWrongPrivateStatus                              = newBillingServerErrorMsg("fm000075", "order has wrong private status and cannot be recreated")
 	orderCountryChangeRestrictedError                         = newBillingServerErrorMsg("fm000076", "change country is not allowed")
 	orderErrorVatPayerUnknown                                 = newBillingServerErrorMsg("fm000077", "vat payer unknown")
+	orderErrorStatusTransitionNotAllowed                      = newBillingServerErrorMsg("fm000078", "transition of order to the status isn't allowed")
+	orderErrorStatusConflict                                  = newBillingServerErrorMsg("fm000079", "order status was changed by another process")
 
 	virtualCurrencyPayoutCurrencyMissed = newBillingServerErrorMsg("vc000001", "virtual currency don't have price in merchant payout currency")
 
@@ -177,6 +179,7 @@ type PaymentCreateProcessor struct {
 	ip             string
 	acceptLanguage string
 	userAgent      string
+	storedCard     *recurringpb.SavedCard
 	checked        struct {
 		order         *billingpb.Order
 		project       *billingpb.Project
@@ -539,12 +542,19 @@ func (s *Service) OrderCreateProcess(
 		return err
 	}
 
+	if entry := s.checkFraudLists(ctx, order, "", internalPkg.FraudListStageOrderCreate); entry != nil {
+		rsp.Status = billingpb.ResponseStatusForbidden
+		rsp.Message = fraudListErrorBlocked
+		return nil
+	}
+
 	if err = s.orderRepository.Insert(ctx, order); err != nil {
 		rsp.Status = billingpb.ResponseStatusBadData
 		rsp.Message = orderErrorCanNotCreate
 		return nil
 	}
 
+	s.holdVirtualCurrency(ctx, order)
 	rsp.Item = order
 
 	return nil
@@ -885,6 +895,17 @@ func (s *Service) PaymentCreateProcess(
 	ctx context.Context,
 	req *billingpb.PaymentCreateRequest,
 	rsp *billingpb.PaymentCreateResponse,
+) error {
+	return s.paymentCreateProcess(ctx, req, rsp, nil)
+}
+
+// paymentCreateProcess creates payment of order. Payment is created by the stored card without card data
+// from the payment form if the card is passed, e.g. for renewal of subscription.
+func (s *Service) paymentCreateProcess(
+	ctx context.Context,
+	req *billingpb.PaymentCreateRequest,
+	rsp *billingpb.PaymentCreateResponse,
+	storedCard *recurringpb.SavedCard,
 ) error {
 	processor := &PaymentCreateProcessor{
 		service:        s,
@@ -892,6 +913,7 @@ func (s *Service) PaymentCreateProcess(
 		ip:             req.Ip,
 		acceptLanguage: req.AcceptLanguage,
 		userAgent:      req.UserAgent,
+		storedCard:     storedCard,
 	}
 
 	err := processor.processPaymentFormData(ctx)
@@ -1037,6 +1059,28 @@ func (s *Service) PaymentCreateProcess(
 		return err
 	}
 
+	s.setOrderCardFingerprint(order, req.Data)
+	if entry := s.checkFraudLists(ctx, order, req.Ip, internalPkg.FraudListStagePaymentCreate); entry != nil {
+		rsp.Status = billingpb.ResponseStatusForbidden
+		rsp.Message = fraudListErrorBlocked
+		return nil
+	}
+
+	// Payments by the stored card without customer, e.g. renewals of subscriptions, aren't screened
+	if storedCard == nil {
+		check := s.checkOrderFraud(ctx, order, req.Ip)
+
+		if check.Decision == internalPkg.FraudDecisionBlock {
+			if err = s.updateOrder(ctx, order); err != nil {
+				zap.L().Error("s.updateOrder Method failed", zap.Error(err), zap.Any("order", order))
+			}
+
+			rsp.Status = billingpb.ResponseStatusForbidden
+			rsp.Message = fraudErrorPaymentBlocked
+			return nil
+		}
+	}
+
 	err = s.updateOrder(ctx, order)
 
 	if err != nil {
@@ -1062,26 +1106,77 @@ func (s *Service) PaymentCreateProcess(
 		return nil
 	}
 
-	h, err := s.paymentSystemGateway.getGateway(order.PaymentMethod.Handler)
+	routing := &internalPkg.OrderPaymentRouting{
+		Id:        primitive.NewObjectID().Hex(),
+		OrderId:   order.Id,
+		OrderUuid: order.Uuid,
+		CreatedAt: time.Now(),
+	}
+	_, isRecurring := req.Data[billingpb.PaymentCreateFieldRecurringId]
+	candidates, err := s.getPaymentRoutingCandidates(ctx, order, processor.checked.paymentMethod, routing, isRecurring)
 
 	if err != nil {
-		zap.S().Errorw(pkg.MethodFinishedWithError, "err", err.Error())
+		zap.L().Error(
+			"payment routing failed",
+			zap.Error(err),
+			zap.Any("order", order),
+			zap.Any("routing", routing),
+		)
+		_ = s.saveFailedOrderPaymentRouting(ctx, order, routing)
+
 		if e, ok := err.(*billingpb.ResponseErrorMessage); ok {
-			rsp.Status = billingpb.ResponseStatusSystemError
+			rsp.Status = billingpb.ResponseStatusBadData
+
+			if e == paymentSystemErrorHandlerNotFound {
+				rsp.Status = billingpb.ResponseStatusSystemError
+			}
+
 			rsp.Message = e
 			return nil
 		}
 		return err
 	}
 
-	url, err := h.CreatePayment(order, s.cfg.GetRedirectUrlSuccess(nil), s.cfg.GetRedirectUrlFail(nil), req.Data)
+	var url string
+
+	for _, candidate := range candidates {
+		order.PaymentMethod.PaymentSystemId = candidate.paymentSystem.Id
+		order.PaymentMethod.Handler = candidate.paymentSystem.Handler
+		order.PaymentMethod.Params = candidate.params
+
+		url, err = s.createPaymentInPaymentSystem(candidate.handler, order, req.Data)
+
+		attempt := &internalPkg.PaymentRoutingAttempt{
+			PaymentSystemId: candidate.paymentSystem.Id,
+			Handler:         candidate.paymentSystem.Handler,
+			Cost:            candidate.cost,
+			CostCurrency:    order.ChargeCurrency,
+			Status:          getPaymentRoutingAttemptStatus(err),
+			CreatedAt:       time.Now(),
+		}
+		routing.Attempts = append(routing.Attempts, attempt)
+
+		if err == nil {
+			break
+		}
+
+		attempt.Error = err.Error()
 
-	if err != nil {
 		zap.L().Error(
 			"h.CreatePayment Method failed",
 			zap.Error(err),
+			zap.String(pkg.LogFieldHandler, candidate.paymentSystem.Handler),
 			zap.Any("order", order),
 		)
+
+		if !isPaymentRoutingFailoverError(err) {
+			break
+		}
+	}
+
+	if err != nil {
+		_ = s.saveFailedOrderPaymentRouting(ctx, order, routing)
+
 		if e, ok := err.(*billingpb.ResponseErrorMessage); ok {
 			rsp.Status = billingpb.ResponseStatusSystemError
 			rsp.Message = e
@@ -1093,7 +1188,10 @@ func (s *Service) PaymentCreateProcess(
 		return nil
 	}
 
-	err = s.updateOrder(ctx, order)
+	// payment is created in payment system already, so the order is saved even if routing wasn't saved
+	_ = s.saveOrderPaymentRouting(ctx, order, routing)
+
+	err = s.updateOrderWithCause(ctx, order, internalPkg.OrderStatusEventCausePaymentCreate)
 	if err != nil {
 		zap.S().Errorf("Order create in payment system failed", "err", err.Error(), "order", order)
 
@@ -1103,6 +1201,12 @@ func (s *Service) PaymentCreateProcess(
 			rsp.Message = e
 			return nil
 		}
+		// order got result of payment from payment system while payment was created
+		if _, ok := err.(*orderStatusTransitionError); ok {
+			rsp.Status = billingpb.ResponseStatusBadData
+			rsp.Message = orderErrorStatusTransitionNotAllowed
+			return nil
+		}
 		return err
 	}
 
@@ -1110,7 +1214,7 @@ func (s *Service) PaymentCreateProcess(
 	rsp.RedirectUrl = url
 	rsp.NeedRedirect = true
 
-	if _, ok := req.Data[billingpb.PaymentCreateFieldRecurringId]; ok && url == "" {
+	if isRecurring && url == "" {
 		rsp.NeedRedirect = false
 	}
 
@@ -1138,39 +1242,90 @@ func (s *Service) PaymentCallbackProcess(
 	req *billingpb.PaymentNotifyRequest,
 	rsp *billingpb.PaymentNotifyResponse,
 ) error {
+	entry := s.newCallbackJournalEntry(ctx, internalPkg.CallbackJournalTypePayment, "", req.Request, req.Signature)
+	entry.OrderId = req.OrderId
+
+	err := s.processPaymentCallback(ctx, req, rsp, entry, false)
+	s.finishCallbackJournalEntry(ctx, entry, rsp, err)
+
+	return err
+}
+
+// processPaymentCallback processes payment notification of payment system, entry of callbacks journal
+// is filled by the handler of payment system. Accounting entries aren't created again on replay of callback.
+func (s *Service) processPaymentCallback(
+	ctx context.Context,
+	req *billingpb.PaymentNotifyRequest,
+	rsp *billingpb.PaymentNotifyResponse,
+	entry *internalPkg.CallbackJournalEntry,
+	replay bool,
+) (err error) {
 	order, err := s.getOrderById(ctx, req.OrderId)
 
 	if err != nil {
 		return orderErrorNotFound
 	}
 
-	var data protobuf.Message
-
 	ps, err := s.paymentSystem.GetById(ctx, order.PaymentMethod.PaymentSystemId)
 	if err != nil {
 		return orderErrorPaymentSystemInactive
 	}
 
-	switch ps.Handler {
-	case billingpb.PaymentSystemHandlerCardPay, paymentSystemHandlerCardPayMock:
-		data = &billingpb.CardPayPaymentCallback{}
-		err := json.Unmarshal(req.Request, data)
+	entry.Handler = ps.Handler
+	h, err := s.paymentSystemGateway.getGateway(ps.Handler)
 
-		if err != nil {
-			return errors.New(paymentRequestIncorrect)
-		}
-		break
-	default:
+	if err != nil {
 		return orderErrorPaymentMethodNotFound
 	}
 
-	h, err := s.paymentSystemGateway.getGateway(ps.Handler)
+	data, err := h.DecodePaymentCallback(req.Request)
+
+	if err != nil {
+		if err == paymentSystemErrorCallbackNotSupported {
+			return orderErrorPaymentMethodNotFound
+		}
+
+		return errors.New(paymentRequestIncorrect)
+	}
+
+	// notification with invalid signature must not claim transaction, otherwise forged notification
+	// would get the transaction processed as duplicate or conflicting before the genuine one
+	if sErr := h.CheckCallbackSignature(order, string(req.Request), req.Signature); sErr != nil {
+		if e, ok := sErr.(*billingpb.ResponseError); ok {
+			rsp.Status = e.Status
+			rsp.Error = e.Error()
+			return nil
+		}
+		return sErr
+	}
+
+	transactionId, status := h.GetCallbackTransaction(data)
+	tx, err := s.claimCallbackTransaction(ctx, entry, ps.Handler, transactionId, status)
+
+	if err != nil {
+		s.setCallbackTransactionResponse(entry, tx, rsp, err)
+		return nil
+	}
+
+	defer func() {
+		s.finishCallbackTransaction(ctx, tx, rsp, err, orderFinalPrivateStatuses[order.PrivateStatus])
+	}()
+
+	// order could be changed by notification processed while transaction was claimed
+	if tx != nil {
+		if order, err = s.getOrderById(ctx, req.OrderId); err != nil {
+			return orderErrorNotFound
+		}
+	}
+
+	restoreChargeAmount, err := s.applyPaymentCapture(ctx, order)
 
 	if err != nil {
 		return err
 	}
 
 	pErr := h.ProcessPayment(order, data, string(req.Request), req.Signature)
+	restoreChargeAmount()
 
 	if pErr != nil {
 		pErr, _ := pErr.(*billingpb.ResponseError)
@@ -1204,7 +1359,7 @@ func (s *Service) PaymentCallbackProcess(
 		break
 	}
 
-	err = s.updateOrder(ctx, order)
+	err = s.updateOrderWithCause(ctx, order, internalPkg.OrderStatusEventCausePaymentCallback)
 
 	if err != nil {
 		zap.S().Errorw(pkg.MethodFinishedWithError, "err", err.Error())
@@ -1213,10 +1368,29 @@ func (s *Service) PaymentCallbackProcess(
 			rsp.Error = e.Message
 			return nil
 		}
+		// notification came out of order and can't change status of order anymore
+		if _, ok := err.(*orderStatusTransitionError); ok {
+			if pErr == nil {
+				rsp.Status = pkg.StatusErrorValidation
+				rsp.Error = err.Error()
+			}
+			return nil
+		}
 		return err
 	}
 
 	if pErr == nil {
+		// accounting entries of two-step payment are created when captured payment is completed
+		switch order.PrivateStatus {
+		case pkg.OrderStatusPaymentSystemAuthorized:
+			s.processPaymentAuthorized(ctx, h, order)
+			rsp.Status = pkg.StatusOK
+			return nil
+		case pkg.OrderStatusPaymentSystemVoided:
+			rsp.Status = pkg.StatusOK
+			return nil
+		}
+
 		if order.PrivateStatus == recurringpb.OrderStatusPaymentSystemComplete {
 			err = s.paymentSystemPaymentCallbackComplete(ctx, order)
 
@@ -1227,7 +1401,7 @@ func (s *Service) PaymentCallbackProcess(
 			}
 		}
 
-		err = s.onPaymentNotify(ctx, order)
+		err = s.processPaymentAccounting(ctx, order, replay)
 
 		if err != nil {
 			zap.L().Error(
@@ -1248,12 +1422,18 @@ func (s *Service) PaymentCallbackProcess(
 
 		if order.PrivateStatus == recurringpb.OrderStatusPaymentSystemComplete {
 			s.sendMailWithReceipt(ctx, order)
+			s.processDuplicatePayment(ctx, order)
 		}
 
+		recurringId := ""
+
 		if h.IsRecurringCallback(data) {
-			s.saveRecurringCard(ctx, order, h.GetRecurringId(data))
+			recurringId = h.GetRecurringId(data)
+			s.saveRecurringCard(ctx, order, recurringId)
 		}
 
+		s.processSubscriptionOrder(ctx, order, recurringId)
+
 		rsp.Status = pkg.StatusOK
 	}
 
@@ -1691,19 +1871,74 @@ func (s *Service) saveRecurringCard(ctx context.Context, order *billingpb.Order,
 		if err != nil {
 			zap.S().Errorf("Failed to update order after save recurruing card", "err", err.Error())
 		}
+
+		email := order.User.Email
+
+		if email == "" {
+			email = order.ReceiptEmail
+		}
+
+		_, _ = s.syncSavedPaymentMethods(ctx, order.User.Id, email)
 	}
 }
 
 func (s *Service) updateOrder(ctx context.Context, order *billingpb.Order) error {
-	ps := order.GetPublicStatus()
-
-	zap.S().Debug("[updateOrder] updating order", "order_id", order.Id, "status", ps)
+	return s.updateOrderWithCause(ctx, order, internalPkg.OrderStatusEventCauseOrderUpdate)
+}
 
+// updateOrderWithCause saves order if transition of its private status is allowed by the order state machine
+// and stores the transition with the cause of it.
+func (s *Service) updateOrderWithCause(ctx context.Context, order *billingpb.Order, cause string) error {
 	originalOrder, _ := s.getOrderById(ctx, order.Id)
 
+	return s.replaceOrder(ctx, order, originalOrder, cause)
+}
+
+// updateOrderFromStatus saves order like updateOrderWithCause only if private status of the stored order
+// equals to the passed one, otherwise orderErrorStatusConflict is returned.
+func (s *Service) updateOrderFromStatus(
+	ctx context.Context,
+	order *billingpb.Order,
+	privateStatus int32,
+	cause string,
+) error {
+	originalOrder, err := s.getOrderById(ctx, order.Id)
+
+	if err != nil {
+		return err
+	}
+
+	if originalOrder.PrivateStatus != privateStatus {
+		return orderErrorStatusConflict
+	}
+
+	return s.replaceOrder(ctx, order, originalOrder, cause)
+}
+
+func (s *Service) replaceOrder(
+	ctx context.Context,
+	order *billingpb.Order,
+	originalOrder *billingpb.Order,
+	cause string,
+) error {
+	ps := getOrderPublicStatus(order)
+
+	zap.S().Debug("[updateOrder] updating order", "order_id", order.Id, "status", ps)
+
 	statusChanged := false
 	if originalOrder != nil {
-		ops := originalOrder.GetPublicStatus()
+		if err := checkOrderStatusTransition(originalOrder, order); err != nil {
+			zap.L().Error(
+				orderErrorStatusTransitionNotAllowed.Message,
+				zap.String("order_id", order.Id),
+				zap.Int32("from", originalOrder.PrivateStatus),
+				zap.Int32("to", order.PrivateStatus),
+				zap.String("cause", cause),
+			)
+			return err
+		}
+
+		ops := getOrderPublicStatus(originalOrder)
 		zap.S().Debug("[updateOrder] no original order status", "order_id", order.Id, "status", ops)
 		statusChanged = ops != ps
 	} else {
@@ -1721,7 +1956,25 @@ func (s *Service) updateOrder(ctx context.Context, order *billingpb.Order) error
 		}
 	}
 
-	if err := s.orderRepository.Update(ctx, order); err != nil {
+	if originalOrder != nil {
+		// order is saved only if its status wasn't changed by another process after the transition check
+		ok, err := s.orderRepository.UpdateWithPrivateStatus(ctx, order, originalOrder.PrivateStatus)
+
+		if err != nil {
+			return orderErrorUnknown
+		}
+
+		if !ok {
+			zap.L().Error(
+				orderErrorStatusConflict.Message,
+				zap.String("order_id", order.Id),
+				zap.Int32("from", originalOrder.PrivateStatus),
+				zap.Int32("to", order.PrivateStatus),
+				zap.String("cause", cause),
+			)
+			return orderErrorStatusConflict
+		}
+	} else if err := s.orderRepository.Update(ctx, order); err != nil {
 		if err == mongo.ErrNoDocuments {
 			return orderErrorNotFound
 		}
@@ -1730,10 +1983,18 @@ func (s *Service) updateOrder(ctx context.Context, order *billingpb.Order) error
 
 	zap.S().Debug("[updateOrder] updating order success", "order_id", order.Id, "status_changed", statusChanged, "type", order.ProductType)
 
+	if originalOrder != nil && originalOrder.PrivateStatus != order.PrivateStatus {
+		s.saveOrderStatusEvent(ctx, order, originalOrder.PrivateStatus, cause)
+	}
+
 	if order.ProductType == pkg.OrderType_key {
 		s.orderNotifyKeyProducts(context.TODO(), order)
 	}
 
+	if order.VirtualCurrencyAmount > 0 {
+		s.orderNotifyVirtualCurrencyHold(ctx, order)
+	}
+
 	if statusChanged && order.NeedCallbackNotification() {
 		s.orderNotifyMerchant(ctx, order)
 	}
@@ -1742,7 +2003,7 @@ func (s *Service) updateOrder(ctx context.Context, order *billingpb.Order) error
 }
 
 func (s *Service) orderNotifyKeyProducts(ctx context.Context, order *billingpb.Order) {
-	zap.S().Debug("[orderNotifyKeyProducts] called", "order_id", order.Id, "status", order.GetPublicStatus(), "is product notified: ", order.IsKeyProductNotified)
+	zap.S().Debug("[orderNotifyKeyProducts] called", "order_id", order.Id, "status", getOrderPublicStatus(order), "is product notified: ", order.IsKeyProductNotified)
 
 	if order.IsKeyProductNotified {
 		return
@@ -1750,7 +2011,7 @@ func (s *Service) orderNotifyKeyProducts(ctx context.Context, order *billingpb.O
 
 	keys := order.Keys
 	var err error
-	switch order.GetPublicStatus() {
+	switch getOrderPublicStatus(order) {
 	case recurringpb.OrderPublicStatusCanceled, recurringpb.OrderPublicStatusRejected:
 		for _, key := range keys {
 			zap.S().Infow("[orderNotifyKeyProducts] trying to cancel reserving key", "order_id", order.Id, "key", key)
@@ -1987,7 +2248,7 @@ func (s *Service) sendMailWithCode(_ context.Context, order *billingpb.Order, ke
 }
 
 func (s *Service) orderNotifyMerchant(ctx context.Context, order *billingpb.Order) {
-	zap.S().Debug("[orderNotifyMerchant] try to send notify merchant to rmq", "order_id", order.Id, "status", order.GetPublicStatus())
+	zap.S().Debug("[orderNotifyMerchant] try to send notify merchant to rmq", "order_id", order.Id, "status", getOrderPublicStatus(order))
 
 	err := s.broker.Publish(recurringpb.PayOneTopicNotifyPaymentName, order, amqp.Table{"x-retry-count": int32(0)})
 	if err != nil {
@@ -1998,7 +2259,7 @@ func (s *Service) orderNotifyMerchant(ctx context.Context, order *billingpb.Orde
 	} else {
 		zap.S().Debug("[orderNotifyMerchant] send notify merchant to rmq failed", "order_id", order.Id)
 	}
-	order.SetNotificationStatus(order.GetPublicStatus(), err == nil)
+	order.SetNotificationStatus(getOrderPublicStatus(order), err == nil)
 
 	if err = s.orderRepository.Update(ctx, order); err != nil {
 		zap.S().Debug("[orderNotifyMerchant] notification status update failed", "order_id", order.Id)
@@ -2750,6 +3011,11 @@ func (v *PaymentFormProcessor) processRenderFormPaymentMethods(
 			continue
 		}
 
+		// don't offer payment method while circuit of its payment system is open
+		if !v.service.paymentSystemHealth.IsAvailable(ps.Handler) {
+			continue
+		}
+
 		if v.order.OrderAmount < pm.MinPaymentAmount ||
 			(pm.MaxPaymentAmount > 0 && v.order.OrderAmount > pm.MaxPaymentAmount) {
 			continue
@@ -2821,6 +3087,7 @@ func (v *PaymentFormProcessor) processPaymentMethodsData(pm *billingpb.PaymentFo
 				pm.SavedCards = append(pm.SavedCards, d)
 			}
 
+			v.service.sortSavedCards(context.TODO(), v.order.User.Id, pm.SavedCards)
 		}
 	}
 
@@ -3070,8 +3337,10 @@ func (v *PaymentCreateProcessor) processPaymentFormData(ctx context.Context) err
 	delete(v.data, billingpb.PaymentCreateFieldEmail)
 
 	if pm.IsBankCard() == true {
-		if id, ok := v.data[billingpb.PaymentCreateFieldStoredCardId]; ok {
-			storedCard, err := v.service.rep.FindSavedCardById(context.TODO(), &recurringpb.FindByStringValue{Value: id})
+		storedCard := v.storedCard
+
+		if id, ok := v.data[billingpb.PaymentCreateFieldStoredCardId]; ok && storedCard == nil {
+			storedCard, err = v.service.rep.FindSavedCardById(context.TODO(), &recurringpb.FindByStringValue{Value: id})
 
 			if err != nil {
 				v.service.logError("Get data about stored card failed", []interface{}{"err", err.Error(), "id", id})
@@ -3081,9 +3350,11 @@ func (v *PaymentCreateProcessor) processPaymentFormData(ctx context.Context) err
 				v.service.logError("Get data about stored card failed", []interface{}{"id", id})
 				return orderGetSavedCardError
 			}
+		}
 
+		if storedCard != nil {
 			if storedCard.Token != order.User.Id {
-				v.service.logError("Alarm: user try use not own bank card for payment", []interface{}{"user_id", order.User.Id, "card_id", id})
+				v.service.logError("Alarm: user try use not own bank card for payment", []interface{}{"user_id", order.User.Id, "card_id", storedCard.Id})
 				return orderErrorRecurringCardNotOwnToUser
 			}
 
@@ -3092,6 +3363,8 @@ func (v *PaymentCreateProcessor) processPaymentFormData(ctx context.Context) err
 			order.PaymentRequisites[billingpb.PaymentCreateFieldYear] = storedCard.Expire.Year
 			order.PaymentRequisites[billingpb.PaymentCreateFieldHolder] = storedCard.CardHolder
 			order.PaymentRequisites[billingpb.PaymentCreateFieldRecurringId] = storedCard.RecurringId
+
+			v.service.markSavedPaymentMethodUsed(ctx, storedCard.Id)
 		} else {
 			validator := &bankCardValidator{
 				Pan:    v.data[billingpb.PaymentCreateFieldPan],
@@ -4007,7 +4280,7 @@ func (s *Service) applyCountryRestriction(
 	}
 	order.PrivateStatus = recurringpb.OrderStatusPaymentSystemDeclined
 	restricted = true
-	err = s.updateOrder(ctx, order)
+	err = s.updateOrderWithCause(ctx, order, internalPkg.OrderStatusEventCauseCountryRestriction)
 	if err != nil && err.Error() == orderErrorNotFound.Error() {
 		err = nil
 	}
@@ -4455,6 +4728,8 @@ func (s *Service) OrderReCreateProcess(
 		return nil
 	}
 
+	s.holdVirtualCurrency(ctx, newOrder)
+
 	res.Item = newOrder
 
 	return nil
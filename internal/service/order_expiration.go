@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"github.com/golang/protobuf/ptypes"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"github.com/paysuper/paysuper-proto/go/recurringpb"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	orderCancellationCodeExpired   = "expired"
+	orderCancellationReasonExpired = "order wasn't paid during its lifetime"
+
+	orderExpirationBatchSize = 100
+)
+
+var (
+	orderExpirationErrorLifetimeInvalid = newBillingServerErrorMsg("oe000001", "lifetime of orders must be greater than or equal to zero")
+)
+
+// ExpireAbandonedOrders cancels orders which weren't paid during the lifetime of orders of their project
+// and returns number of canceled orders.
+func (s *Service) ExpireAbandonedOrders(ctx context.Context) (int, error) {
+	counter := 0
+	now := time.Now()
+	lifetimes, err := s.projectOrderLifetimeRepository.GetAll(ctx)
+
+	if err != nil {
+		return counter, err
+	}
+
+	excludeProjectIds := make([]string, 0, len(lifetimes))
+
+	for _, v := range lifetimes {
+		excludeProjectIds = append(excludeProjectIds, v.ProjectId)
+		filter := &internalPkg.NotPaidOrderFilter{
+			CreatedBefore: now.Add(-time.Duration(v.Lifetime) * time.Second),
+			ProjectId:     v.ProjectId,
+		}
+		count, err := s.expireNotPaidOrders(ctx, filter)
+		counter += count
+
+		if err != nil {
+			return counter, err
+		}
+	}
+
+	filter := &internalPkg.NotPaidOrderFilter{
+		CreatedBefore:     now.Add(-s.cfg.GetOrderLifetime()),
+		ExcludeProjectIds: excludeProjectIds,
+	}
+	count, err := s.expireNotPaidOrders(ctx, filter)
+
+	return counter + count, err
+}
+
+// expireNotPaidOrders cancels orders selected by the filter batch by batch and returns number of canceled orders.
+func (s *Service) expireNotPaidOrders(ctx context.Context, filter *internalPkg.NotPaidOrderFilter) (int, error) {
+	counter := 0
+	filter.Limit = orderExpirationBatchSize
+
+	for {
+		orders, err := s.orderRepository.FindNotPaid(ctx, filter)
+
+		if err != nil {
+			return counter, err
+		}
+
+		counter += s.expireOrders(ctx, orders)
+
+		if int64(len(orders)) < filter.Limit {
+			return counter, nil
+		}
+
+		filter.AfterId = orders[len(orders)-1].Id
+	}
+}
+
+// expireOrders cancels orders as expired. Keys reserved and virtual currency held by the orders are released
+// by updateOrder, merchant is notified about canceled order as usual.
+func (s *Service) expireOrders(ctx context.Context, orders []*billingpb.Order) int {
+	var ids []string
+
+	for _, order := range orders {
+		order.PrivateStatus = recurringpb.OrderStatusPaymentSystemCanceled
+		order.Status = recurringpb.OrderPublicStatusCanceled
+		order.Canceled = true
+		order.CanceledAt = ptypes.TimestampNow()
+		order.Cancellation = &billingpb.OrderNotificationCancellation{
+			Code:   orderCancellationCodeExpired,
+			Reason: orderCancellationReasonExpired,
+		}
+
+		// payment of the order can be created by customer after the order was selected
+		err := s.updateOrderFromStatus(ctx, order, recurringpb.OrderStatusNew, internalPkg.OrderStatusEventCauseOrderExpiration)
+
+		if err == orderErrorStatusConflict {
+			zap.L().Info("order isn't new anymore, expiration skipped", zap.String("order_id", order.Id))
+			continue
+		}
+
+		if err != nil {
+			zap.L().Error("expiration of order failed", zap.Error(err), zap.String("order_id", order.Id))
+			continue
+		}
+
+		if !order.NeedCallbackNotification() {
+			s.orderNotifyMerchant(ctx, order)
+		}
+
+		ids = append(ids, order.Id)
+	}
+
+	if len(ids) > 0 {
+		if err := s.updateOrderView(ctx, ids); err != nil {
+			zap.L().Error("update view of expired orders failed", zap.Error(err), zap.Strings("order_ids", ids))
+		}
+	}
+
+	return len(ids)
+}
+
+// holdVirtualCurrency holds virtual currency of the project by the order until the order is paid or canceled.
+func (s *Service) holdVirtualCurrency(ctx context.Context, order *billingpb.Order) {
+	if order.VirtualCurrencyAmount <= 0 {
+		return
+	}
+
+	hold := &internalPkg.VirtualCurrencyHold{
+		OrderId:   order.Id,
+		ProjectId: order.Project.Id,
+		Amount:    order.VirtualCurrencyAmount,
+		Status:    internalPkg.VirtualCurrencyHoldStatusHeld,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	if order.User != nil {
+		hold.UserId = order.User.Id
+	}
+
+	if err := s.virtualCurrencyHoldRepository.Insert(ctx, hold); err != nil {
+		zap.L().Error("hold of virtual currency failed", zap.Error(err), zap.String("order_id", order.Id))
+	}
+}
+
+// orderNotifyVirtualCurrencyHold releases virtual currency held by canceled or rejected order
+// and captures virtual currency held by processed order.
+func (s *Service) orderNotifyVirtualCurrencyHold(ctx context.Context, order *billingpb.Order) {
+	var status string
+
+	switch getOrderPublicStatus(order) {
+	case recurringpb.OrderPublicStatusCanceled, recurringpb.OrderPublicStatusRejected:
+		status = internalPkg.VirtualCurrencyHoldStatusReleased
+	case recurringpb.OrderPublicStatusProcessed:
+		status = internalPkg.VirtualCurrencyHoldStatusCaptured
+	default:
+		return
+	}
+
+	if _, err := s.virtualCurrencyHoldRepository.Finish(ctx, order.Id, status); err != nil {
+		zap.L().Error(
+			"finishing of virtual currency hold failed",
+			zap.Error(err),
+			zap.String("order_id", order.Id),
+			zap.String("status", status),
+		)
+	}
+}
+
+func (s *Service) GetProjectOrderLifetime(
+	ctx context.Context,
+	req *internalPkg.ProjectOrderLifetimeRequest,
+	rsp *internalPkg.ProjectOrderLifetimeResponse,
+) error {
+	if _, err := s.project.GetById(ctx, req.ProjectId); err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = projectErrorNotFound
+		return nil
+	}
+
+	lifetime, err := s.projectOrderLifetimeRepository.GetByProjectId(ctx, req.ProjectId)
+
+	if err != nil && err != mongo.ErrNoDocuments {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	if lifetime == nil {
+		lifetime = &internalPkg.ProjectOrderLifetime{
+			ProjectId: req.ProjectId,
+			Lifetime:  int64(s.cfg.GetOrderLifetime().Seconds()),
+		}
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = lifetime
+
+	return nil
+}
+
+// SetProjectOrderLifetime overrides lifetime of orders of the project, zero lifetime resets it to the default value.
+func (s *Service) SetProjectOrderLifetime(
+	ctx context.Context,
+	req *internalPkg.ProjectOrderLifetimeRequest,
+	rsp *internalPkg.ProjectOrderLifetimeResponse,
+) error {
+	if req.Lifetime < 0 {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = orderExpirationErrorLifetimeInvalid
+		return nil
+	}
+
+	if _, err := s.project.GetById(ctx, req.ProjectId); err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = projectErrorNotFound
+		return nil
+	}
+
+	if req.Lifetime == 0 {
+		if err := s.projectOrderLifetimeRepository.Delete(ctx, req.ProjectId); err != nil {
+			rsp.Status = billingpb.ResponseStatusSystemError
+			rsp.Message = orderErrorUnknown
+			return nil
+		}
+
+		return s.GetProjectOrderLifetime(ctx, req, rsp)
+	}
+
+	lifetime := &internalPkg.ProjectOrderLifetime{
+		ProjectId: req.ProjectId,
+		Lifetime:  req.Lifetime,
+		UpdatedAt: time.Now(),
+	}
+
+	if err := s.projectOrderLifetimeRepository.Upsert(ctx, lifetime); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = lifetime
+
+	return nil
+}
@@ -0,0 +1,345 @@
+package service
+
+import (
+	"context"
+	"github.com/go-redis/redis"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/mongodb"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	"github.com/paysuper/paysuper-billing-server/internal/database"
+	"github.com/paysuper/paysuper-billing-server/internal/mocks"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	casbinMocks "github.com/paysuper/paysuper-proto/go/casbinpb/mocks"
+	"github.com/paysuper/paysuper-proto/go/recurringpb"
+	reportingMocks "github.com/paysuper/paysuper-proto/go/reporterpb/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	rabbitmq "gopkg.in/ProtocolONE/rabbitmq.v1/pkg"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type OrderExpirationTestSuite struct {
+	suite.Suite
+	service *Service
+	log     *zap.Logger
+	cache   database.CacheInterface
+
+	merchant      *billingpb.Merchant
+	project       *billingpb.Project
+	paymentMethod *billingpb.PaymentMethod
+	paymentSystem *billingpb.PaymentSystem
+}
+
+func Test_OrderExpiration(t *testing.T) {
+	suite.Run(t, new(OrderExpirationTestSuite))
+}
+
+func (suite *OrderExpirationTestSuite) SetupTest() {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		suite.FailNow("Config load failed", "%v", err)
+	}
+	cfg.CardPayApiUrl = "https://sandbox.cardpay.com"
+
+	m, err := migrate.New(
+		"file://../../migrations/tests",
+		cfg.MongoDsn)
+	assert.NoError(suite.T(), err, "Migrate init failed")
+
+	err = m.Up()
+	if err != nil && err.Error() != "no change" {
+		suite.FailNow("Migrations failed", "%v", err)
+	}
+
+	ctx, _ := context.WithTimeout(context.Background(), 50*time.Second)
+	opts := []mongodb.Option{mongodb.Context(ctx)}
+	db, err := mongodb.NewDatabase(opts...)
+	if err != nil {
+		suite.FailNow("Database connection failed", "%v", err)
+	}
+
+	suite.log, err = zap.NewProduction()
+
+	if err != nil {
+		suite.FailNow("Logger initialization failed", "%v", err)
+	}
+
+	broker, err := rabbitmq.NewBroker(cfg.BrokerAddress)
+
+	if err != nil {
+		suite.FailNow("Creating RabbitMQ publisher failed", "%v", err)
+	}
+
+	redisClient := database.NewRedis(
+		&redis.Options{
+			Addr:     cfg.RedisHost,
+			Password: cfg.RedisPassword,
+		},
+	)
+
+	redisdb := mocks.NewTestRedis()
+	suite.cache, err = database.NewCacheRedis(redisdb, "cache")
+	suite.service = NewBillingService(
+		db,
+		cfg,
+		mocks.NewGeoIpServiceTestOk(),
+		mocks.NewRepositoryServiceOk(),
+		mocks.NewTaxServiceOkMock(),
+		broker,
+		redisClient,
+		suite.cache,
+		mocks.NewCurrencyServiceMockOk(),
+		mocks.NewDocumentSignerMockOk(),
+		&reportingMocks.ReporterService{},
+		mocks.NewFormatterOK(),
+		mocks.NewBrokerMockOk(),
+		&casbinMocks.CasbinService{},
+	)
+
+	if err := suite.service.Init(); err != nil {
+		suite.FailNow("Billing service initialization failed", "%v", err)
+	}
+
+	suite.merchant, suite.project, suite.paymentMethod, suite.paymentSystem = helperCreateEntitiesForTests(suite.Suite, suite.service)
+}
+
+func (suite *OrderExpirationTestSuite) TearDownTest() {
+	err := suite.service.db.Drop()
+
+	if err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	err = suite.service.db.Close()
+
+	if err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *OrderExpirationTestSuite) TestOrderExpiration_ExpireAbandonedOrders_Ok() {
+	order := suite.createOrder(time.Now().Add(-suite.service.cfg.GetOrderLifetime() - time.Minute))
+	order2 := suite.createOrder(time.Now())
+
+	paidOrder := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	paidOrder.CreatedAt, _ = ptypes.TimestampProto(time.Now().Add(-suite.service.cfg.GetOrderLifetime() - time.Minute))
+	err := suite.service.orderRepository.Update(context.TODO(), paidOrder)
+	assert.NoError(suite.T(), err)
+
+	count, err := suite.service.ExpireAbandonedOrders(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, count)
+
+	order, err = suite.service.orderRepository.GetById(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), recurringpb.OrderStatusPaymentSystemCanceled, order.PrivateStatus)
+	assert.Equal(suite.T(), recurringpb.OrderPublicStatusCanceled, order.GetPublicStatus())
+	assert.True(suite.T(), order.Canceled)
+	assert.NotNil(suite.T(), order.CanceledAt)
+	assert.NotNil(suite.T(), order.Cancellation)
+	assert.Equal(suite.T(), orderCancellationCodeExpired, order.Cancellation.Code)
+
+	events, err := suite.service.orderStatusEventRepository.FindByOrderId(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), events, 1)
+	assert.Equal(suite.T(), internalPkg.OrderStatusEventCauseOrderExpiration, events[0].Cause)
+
+	oid, err := primitive.ObjectIDFromHex(order.Id)
+	assert.NoError(suite.T(), err)
+	count2, err := suite.service.db.Collection(collectionOrderView).
+		CountDocuments(context.TODO(), bson.M{"_id": oid, "status": recurringpb.OrderPublicStatusCanceled})
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), 1, count2)
+
+	order2, err = suite.service.orderRepository.GetById(context.TODO(), order2.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), recurringpb.OrderStatusNew, order2.PrivateStatus)
+
+	paidOrder, err = suite.service.orderRepository.GetById(context.TODO(), paidOrder.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), recurringpb.OrderStatusPaymentSystemComplete, paidOrder.PrivateStatus)
+}
+
+func (suite *OrderExpirationTestSuite) TestOrderExpiration_ExpireAbandonedOrders_ReleaseVirtualCurrency() {
+	order := suite.createOrder(time.Now().Add(-suite.service.cfg.GetOrderLifetime() - time.Minute))
+	order.VirtualCurrencyAmount = 10
+	err := suite.service.orderRepository.Update(context.TODO(), order)
+	assert.NoError(suite.T(), err)
+	suite.service.holdVirtualCurrency(context.TODO(), order)
+
+	count, err := suite.service.ExpireAbandonedOrders(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, count)
+
+	hold, err := suite.service.virtualCurrencyHoldRepository.GetByOrderId(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), 10, hold.Amount)
+	assert.Equal(suite.T(), internalPkg.VirtualCurrencyHoldStatusReleased, hold.Status)
+}
+
+func (suite *OrderExpirationTestSuite) TestOrderExpiration_ExpireAbandonedOrders_PaymentCreated() {
+	order := suite.createOrder(time.Now().Add(-suite.service.cfg.GetOrderLifetime() - time.Minute))
+	helperSetOrderPrivateStatus(suite.Suite, suite.service, order, recurringpb.OrderStatusPaymentSystemCreate)
+
+	count, err := suite.service.ExpireAbandonedOrders(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, count)
+
+	order, err = suite.service.orderRepository.GetById(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), recurringpb.OrderStatusPaymentSystemCreate, order.PrivateStatus)
+}
+
+func (suite *OrderExpirationTestSuite) TestOrderExpiration_ExpireOrders_PaymentCreatedAfterSelection() {
+	order := suite.createOrder(time.Now().Add(-suite.service.cfg.GetOrderLifetime() - time.Minute))
+	orders, err := suite.service.orderRepository.FindNotPaid(
+		context.TODO(),
+		&internalPkg.NotPaidOrderFilter{CreatedBefore: time.Now(), Limit: orderExpirationBatchSize},
+	)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), orders, 1)
+
+	helperSetOrderPrivateStatus(suite.Suite, suite.service, order, recurringpb.OrderStatusPaymentSystemCreate)
+
+	count := suite.service.expireOrders(context.TODO(), orders)
+	assert.Equal(suite.T(), 0, count)
+
+	order, err = suite.service.orderRepository.GetById(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), recurringpb.OrderStatusPaymentSystemCreate, order.PrivateStatus)
+	assert.False(suite.T(), order.Canceled)
+}
+
+func (suite *OrderExpirationTestSuite) TestOrderExpiration_ExpireAbandonedOrders_ProjectLifetime() {
+	order := suite.createOrder(time.Now().Add(-2 * time.Minute))
+	order2 := suite.createOrder(time.Now().Add(-suite.service.cfg.GetOrderLifetime() - time.Minute))
+
+	count, err := suite.service.ExpireAbandonedOrders(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, count)
+
+	req := &internalPkg.ProjectOrderLifetimeRequest{ProjectId: suite.project.Id, Lifetime: 60}
+	rsp := &internalPkg.ProjectOrderLifetimeResponse{}
+	err = suite.service.SetProjectOrderLifetime(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	count, err = suite.service.ExpireAbandonedOrders(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, count)
+
+	order, err = suite.service.orderRepository.GetById(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), recurringpb.OrderStatusPaymentSystemCanceled, order.PrivateStatus)
+
+	order2, err = suite.service.orderRepository.GetById(context.TODO(), order2.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), recurringpb.OrderStatusPaymentSystemCanceled, order2.PrivateStatus)
+}
+
+func (suite *OrderExpirationTestSuite) TestOrderExpiration_ExpireAbandonedOrders_ProjectLifetimeLongerThanDefault() {
+	order := suite.createOrder(time.Now().Add(-suite.service.cfg.GetOrderLifetime() - time.Minute))
+
+	req := &internalPkg.ProjectOrderLifetimeRequest{
+		ProjectId: suite.project.Id,
+		Lifetime:  int64(suite.service.cfg.GetOrderLifetime().Seconds()) * 2,
+	}
+	rsp := &internalPkg.ProjectOrderLifetimeResponse{}
+	err := suite.service.SetProjectOrderLifetime(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	count, err := suite.service.ExpireAbandonedOrders(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, count)
+
+	order, err = suite.service.orderRepository.GetById(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), recurringpb.OrderStatusNew, order.PrivateStatus)
+}
+
+func (suite *OrderExpirationTestSuite) TestOrderExpiration_GetProjectOrderLifetime_Default() {
+	req := &internalPkg.ProjectOrderLifetimeRequest{ProjectId: suite.project.Id}
+	rsp := &internalPkg.ProjectOrderLifetimeResponse{}
+	err := suite.service.GetProjectOrderLifetime(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), suite.service.cfg.OrderLifetime, rsp.Item.Lifetime)
+}
+
+func (suite *OrderExpirationTestSuite) TestOrderExpiration_SetProjectOrderLifetime_Reset() {
+	req := &internalPkg.ProjectOrderLifetimeRequest{ProjectId: suite.project.Id, Lifetime: 60}
+	rsp := &internalPkg.ProjectOrderLifetimeResponse{}
+	err := suite.service.SetProjectOrderLifetime(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), int64(60), rsp.Item.Lifetime)
+
+	req.Lifetime = 0
+	rsp = &internalPkg.ProjectOrderLifetimeResponse{}
+	err = suite.service.SetProjectOrderLifetime(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), suite.service.cfg.OrderLifetime, rsp.Item.Lifetime)
+
+	lifetimes, err := suite.service.projectOrderLifetimeRepository.GetAll(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), lifetimes)
+}
+
+func (suite *OrderExpirationTestSuite) TestOrderExpiration_SetProjectOrderLifetime_LifetimeInvalid() {
+	req := &internalPkg.ProjectOrderLifetimeRequest{ProjectId: suite.project.Id, Lifetime: -1}
+	rsp := &internalPkg.ProjectOrderLifetimeResponse{}
+	err := suite.service.SetProjectOrderLifetime(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), orderExpirationErrorLifetimeInvalid, rsp.Message)
+}
+
+func (suite *OrderExpirationTestSuite) TestOrderExpiration_SetProjectOrderLifetime_ProjectNotFound() {
+	req := &internalPkg.ProjectOrderLifetimeRequest{ProjectId: primitive.NewObjectID().Hex(), Lifetime: 60}
+	rsp := &internalPkg.ProjectOrderLifetimeResponse{}
+	err := suite.service.SetProjectOrderLifetime(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), projectErrorNotFound, rsp.Message)
+}
+
+func (suite *OrderExpirationTestSuite) createOrder(createdAt time.Time) *billingpb.Order {
+	req := &billingpb.OrderCreateRequest{
+		Type:        pkg.OrderType_simple,
+		ProjectId:   suite.project.Id,
+		Amount:      100,
+		Currency:    "RUB",
+		Account:     "unit test",
+		Description: "unit test",
+		OrderId:     primitive.NewObjectID().Hex(),
+		User: &billingpb.OrderUser{
+			Email: "test@unit.unit",
+			Ip:    "127.0.0.1",
+		},
+	}
+
+	rsp := &billingpb.OrderCreateProcessResponse{}
+	err := suite.service.OrderCreateProcess(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	order := rsp.Item
+	order.CreatedAt, err = ptypes.TimestampProto(createdAt)
+	assert.NoError(suite.T(), err)
+
+	err = suite.service.orderRepository.Update(context.TODO(), order)
+	assert.NoError(suite.T(), err)
+
+	return order
+}
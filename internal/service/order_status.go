@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"github.com/paysuper/paysuper-proto/go/recurringpb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// orderStatusTransitions is the state machine of order private status, it contains statuses to which order can be
+// moved from the status. Order in the status which isn't in the list can't be moved to any other status.
+// Order can get result of payment from status "new" if notification of payment system outruns saving of created payment.
+// Payment of order which wasn't created, was declined or canceled by payment system can be retried by customer.
+var orderStatusTransitions = map[int32][]int32{
+	recurringpb.OrderStatusNew: {
+		recurringpb.OrderStatusPaymentSystemCreate,
+		recurringpb.OrderStatusPaymentSystemRejectOnCreate,
+		recurringpb.OrderStatusPaymentSystemReject,
+		recurringpb.OrderStatusPaymentSystemDeclined,
+		recurringpb.OrderStatusPaymentSystemCanceled,
+		recurringpb.OrderStatusPaymentSystemComplete,
+		pkg.OrderStatusPaymentSystemAuthorized,
+	},
+	recurringpb.OrderStatusPaymentSystemCreate: {
+		recurringpb.OrderStatusPaymentSystemReject,
+		recurringpb.OrderStatusPaymentSystemDeclined,
+		recurringpb.OrderStatusPaymentSystemCanceled,
+		recurringpb.OrderStatusPaymentSystemComplete,
+		pkg.OrderStatusPaymentSystemAuthorized,
+	},
+	recurringpb.OrderStatusPaymentSystemRejectOnCreate: orderStatusPaymentRetryTransitions,
+	recurringpb.OrderStatusPaymentSystemDeclined:       orderStatusPaymentRetryTransitions,
+	recurringpb.OrderStatusPaymentSystemCanceled:       orderStatusPaymentRetryTransitions,
+	recurringpb.OrderStatusPaymentSystemReject: {
+		recurringpb.OrderStatusPaymentSystemDeclined,
+		recurringpb.OrderStatusPaymentSystemCanceled,
+		recurringpb.OrderStatusPaymentSystemComplete,
+		pkg.OrderStatusPaymentSystemAuthorized,
+	},
+	pkg.OrderStatusPaymentSystemAuthorized: {
+		recurringpb.OrderStatusPaymentSystemDeclined,
+		recurringpb.OrderStatusPaymentSystemCanceled,
+		recurringpb.OrderStatusPaymentSystemComplete,
+		pkg.OrderStatusPaymentSystemVoided,
+	},
+	recurringpb.OrderStatusPaymentSystemComplete: {
+		recurringpb.OrderStatusProjectComplete,
+		recurringpb.OrderStatusProjectReject,
+		recurringpb.OrderStatusItemReplaced,
+		recurringpb.OrderStatusRefund,
+		recurringpb.OrderStatusChargeback,
+	},
+	recurringpb.OrderStatusProjectComplete: {
+		recurringpb.OrderStatusItemReplaced,
+		recurringpb.OrderStatusRefund,
+		recurringpb.OrderStatusChargeback,
+	},
+	recurringpb.OrderStatusProjectReject: {
+		recurringpb.OrderStatusRefund,
+		recurringpb.OrderStatusChargeback,
+	},
+	recurringpb.OrderStatusItemReplaced: {
+		recurringpb.OrderStatusRefund,
+		recurringpb.OrderStatusChargeback,
+	},
+	// Order is restored to the status before chargeback when dispute of payment is won by merchant.
+	recurringpb.OrderStatusChargeback: {
+		recurringpb.OrderStatusPaymentSystemComplete,
+		recurringpb.OrderStatusProjectComplete,
+		recurringpb.OrderStatusProjectReject,
+		recurringpb.OrderStatusItemReplaced,
+	},
+}
+
+// orderStatusPaymentRetryTransitions contains statuses to which order can be moved by retry of payment.
+var orderStatusPaymentRetryTransitions = []int32{
+	recurringpb.OrderStatusPaymentSystemCreate,
+	recurringpb.OrderStatusPaymentSystemRejectOnCreate,
+	recurringpb.OrderStatusPaymentSystemReject,
+	recurringpb.OrderStatusPaymentSystemDeclined,
+	recurringpb.OrderStatusPaymentSystemCanceled,
+	recurringpb.OrderStatusPaymentSystemComplete,
+	pkg.OrderStatusPaymentSystemAuthorized,
+}
+
+// orderStatusTransitionError is returned on attempt to save order with private status which isn't allowed
+// by the state machine from the current status of order.
+type orderStatusTransitionError struct {
+	OrderId string
+	From    int32
+	To      int32
+}
+
+func (e *orderStatusTransitionError) Error() string {
+	return fmt.Sprintf("%s: %d -> %d", orderErrorStatusTransitionNotAllowed.Message, e.From, e.To)
+}
+
+func isOrderStatusTransitionAllowed(from, to int32) bool {
+	if from == to {
+		return true
+	}
+
+	for _, v := range orderStatusTransitions[from] {
+		if v == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+func checkOrderStatusTransition(originalOrder, order *billingpb.Order) error {
+	if isOrderStatusTransitionAllowed(originalOrder.PrivateStatus, order.PrivateStatus) {
+		return nil
+	}
+
+	return &orderStatusTransitionError{
+		OrderId: order.Id,
+		From:    originalOrder.PrivateStatus,
+		To:      order.PrivateStatus,
+	}
+}
+
+// saveOrderStatusEvent stores transition of order private status. Order isn't rolled back if the event can't be saved,
+// error is only logged by repository.
+func (s *Service) saveOrderStatusEvent(ctx context.Context, order *billingpb.Order, from int32, cause string) {
+	event := &internalPkg.OrderStatusEvent{
+		Id:        primitive.NewObjectID().Hex(),
+		OrderId:   order.Id,
+		OrderUuid: order.Uuid,
+		From:      from,
+		To:        order.PrivateStatus,
+		Cause:     cause,
+		CreatedAt: time.Now(),
+	}
+
+	_ = s.orderStatusEventRepository.Insert(ctx, event)
+}
+
+func (s *Service) GetOrderStatusEvents(
+	ctx context.Context,
+	req *billingpb.GetOrderRequest,
+	rsp *internalPkg.OrderStatusEventsResponse,
+) error {
+	order, err := s.getOrderByUuid(ctx, req.OrderId)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = orderErrorNotFound
+		return nil
+	}
+
+	rsp.Items, err = s.orderStatusEventRepository.FindByOrderId(ctx, order.Id)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+
+	return nil
+}
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/go-redis/redis"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/mongodb"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	"github.com/paysuper/paysuper-billing-server/internal/database"
+	"github.com/paysuper/paysuper-billing-server/internal/mocks"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	casbinMocks "github.com/paysuper/paysuper-proto/go/casbinpb/mocks"
+	"github.com/paysuper/paysuper-proto/go/recurringpb"
+	reportingMocks "github.com/paysuper/paysuper-proto/go/reporterpb/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	rabbitmq "gopkg.in/ProtocolONE/rabbitmq.v1/pkg"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type OrderStatusTestSuite struct {
+	suite.Suite
+	service *Service
+	log     *zap.Logger
+	cache   database.CacheInterface
+
+	merchant      *billingpb.Merchant
+	project       *billingpb.Project
+	paymentMethod *billingpb.PaymentMethod
+	paymentSystem *billingpb.PaymentSystem
+}
+
+func Test_OrderStatus(t *testing.T) {
+	suite.Run(t, new(OrderStatusTestSuite))
+}
+
+func (suite *OrderStatusTestSuite) SetupTest() {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		suite.FailNow("Config load failed", "%v", err)
+	}
+	cfg.CardPayApiUrl = "https://sandbox.cardpay.com"
+
+	m, err := migrate.New(
+		"file://../../migrations/tests",
+		cfg.MongoDsn)
+	assert.NoError(suite.T(), err, "Migrate init failed")
+
+	err = m.Up()
+	if err != nil && err.Error() != "no change" {
+		suite.FailNow("Migrations failed", "%v", err)
+	}
+
+	ctx, _ := context.WithTimeout(context.Background(), 50*time.Second)
+	opts := []mongodb.Option{mongodb.Context(ctx)}
+	db, err := mongodb.NewDatabase(opts...)
+	if err != nil {
+		suite.FailNow("Database connection failed", "%v", err)
+	}
+
+	suite.log, err = zap.NewProduction()
+
+	if err != nil {
+		suite.FailNow("Logger initialization failed", "%v", err)
+	}
+
+	broker, err := rabbitmq.NewBroker(cfg.BrokerAddress)
+
+	if err != nil {
+		suite.FailNow("Creating RabbitMQ publisher failed", "%v", err)
+	}
+
+	redisClient := database.NewRedis(
+		&redis.Options{
+			Addr:     cfg.RedisHost,
+			Password: cfg.RedisPassword,
+		},
+	)
+
+	redisdb := mocks.NewTestRedis()
+	suite.cache, err = database.NewCacheRedis(redisdb, "cache")
+	suite.service = NewBillingService(
+		db,
+		cfg,
+		mocks.NewGeoIpServiceTestOk(),
+		mocks.NewRepositoryServiceOk(),
+		mocks.NewTaxServiceOkMock(),
+		broker,
+		redisClient,
+		suite.cache,
+		mocks.NewCurrencyServiceMockOk(),
+		mocks.NewDocumentSignerMockOk(),
+		&reportingMocks.ReporterService{},
+		mocks.NewFormatterOK(),
+		mocks.NewBrokerMockOk(),
+		&casbinMocks.CasbinService{},
+	)
+
+	if err := suite.service.Init(); err != nil {
+		suite.FailNow("Billing service initialization failed", "%v", err)
+	}
+
+	suite.merchant, suite.project, suite.paymentMethod, suite.paymentSystem = helperCreateEntitiesForTests(suite.Suite, suite.service)
+}
+
+func (suite *OrderStatusTestSuite) TearDownTest() {
+	err := suite.service.db.Drop()
+
+	if err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	err = suite.service.db.Close()
+
+	if err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *OrderStatusTestSuite) TestOrderStatus_IsOrderStatusTransitionAllowed() {
+	assert.True(suite.T(), isOrderStatusTransitionAllowed(recurringpb.OrderStatusNew, recurringpb.OrderStatusPaymentSystemCreate))
+	assert.True(suite.T(), isOrderStatusTransitionAllowed(recurringpb.OrderStatusNew, recurringpb.OrderStatusPaymentSystemDeclined))
+	assert.True(suite.T(), isOrderStatusTransitionAllowed(recurringpb.OrderStatusPaymentSystemCreate, recurringpb.OrderStatusPaymentSystemComplete))
+	assert.True(suite.T(), isOrderStatusTransitionAllowed(recurringpb.OrderStatusPaymentSystemReject, recurringpb.OrderStatusPaymentSystemComplete))
+	assert.True(suite.T(), isOrderStatusTransitionAllowed(pkg.OrderStatusPaymentSystemAuthorized, pkg.OrderStatusPaymentSystemVoided))
+	assert.True(suite.T(), isOrderStatusTransitionAllowed(recurringpb.OrderStatusPaymentSystemComplete, recurringpb.OrderStatusRefund))
+	assert.True(suite.T(), isOrderStatusTransitionAllowed(recurringpb.OrderStatusItemReplaced, recurringpb.OrderStatusChargeback))
+	assert.True(suite.T(), isOrderStatusTransitionAllowed(recurringpb.OrderStatusRefund, recurringpb.OrderStatusRefund))
+	assert.True(suite.T(), isOrderStatusTransitionAllowed(recurringpb.OrderStatusChargeback, recurringpb.OrderStatusProjectComplete))
+
+	// payment of order can be retried after failed attempt
+	for _, from := range []int32{
+		recurringpb.OrderStatusPaymentSystemRejectOnCreate,
+		recurringpb.OrderStatusPaymentSystemDeclined,
+		recurringpb.OrderStatusPaymentSystemCanceled,
+	} {
+		assert.True(suite.T(), isOrderStatusTransitionAllowed(from, recurringpb.OrderStatusPaymentSystemCreate))
+		assert.True(suite.T(), isOrderStatusTransitionAllowed(from, recurringpb.OrderStatusPaymentSystemComplete))
+	}
+
+	assert.False(suite.T(), isOrderStatusTransitionAllowed(recurringpb.OrderStatusPaymentSystemComplete, recurringpb.OrderStatusNew))
+	assert.False(suite.T(), isOrderStatusTransitionAllowed(recurringpb.OrderStatusPaymentSystemComplete, recurringpb.OrderStatusPaymentSystemCreate))
+	assert.False(suite.T(), isOrderStatusTransitionAllowed(recurringpb.OrderStatusPaymentSystemComplete, recurringpb.OrderStatusPaymentSystemReject))
+	assert.False(suite.T(), isOrderStatusTransitionAllowed(recurringpb.OrderStatusPaymentSystemComplete, recurringpb.OrderStatusPaymentSystemDeclined))
+	assert.False(suite.T(), isOrderStatusTransitionAllowed(recurringpb.OrderStatusRefund, recurringpb.OrderStatusPaymentSystemComplete))
+	assert.False(suite.T(), isOrderStatusTransitionAllowed(recurringpb.OrderStatusPaymentSystemDeclined, recurringpb.OrderStatusRefund))
+	assert.False(suite.T(), isOrderStatusTransitionAllowed(recurringpb.OrderStatusPaymentSystemCanceled, recurringpb.OrderStatusProjectComplete))
+	assert.False(suite.T(), isOrderStatusTransitionAllowed(pkg.OrderStatusPaymentSystemVoided, pkg.OrderStatusPaymentSystemAuthorized))
+	assert.False(suite.T(), isOrderStatusTransitionAllowed(recurringpb.OrderStatusChargeback, recurringpb.OrderStatusRefund))
+}
+
+func (suite *OrderStatusTestSuite) TestOrderStatus_UpdateOrder_EventsSaved() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+
+	rsp := &internalPkg.OrderStatusEventsResponse{}
+	err := suite.service.GetOrderStatusEvents(context.TODO(), &billingpb.GetOrderRequest{OrderId: order.Uuid}, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Len(suite.T(), rsp.Items, 2)
+
+	assert.Equal(suite.T(), order.Id, rsp.Items[0].OrderId)
+	assert.Equal(suite.T(), recurringpb.OrderStatusNew, rsp.Items[0].From)
+	assert.Equal(suite.T(), recurringpb.OrderStatusPaymentSystemCreate, rsp.Items[0].To)
+	assert.Equal(suite.T(), internalPkg.OrderStatusEventCausePaymentCreate, rsp.Items[0].Cause)
+	assert.False(suite.T(), rsp.Items[0].CreatedAt.IsZero())
+
+	assert.Equal(suite.T(), recurringpb.OrderStatusPaymentSystemCreate, rsp.Items[1].From)
+	assert.Equal(suite.T(), recurringpb.OrderStatusPaymentSystemComplete, rsp.Items[1].To)
+	assert.Equal(suite.T(), internalPkg.OrderStatusEventCausePaymentCallback, rsp.Items[1].Cause)
+}
+
+func (suite *OrderStatusTestSuite) TestOrderStatus_UpdateOrder_StatusNotChanged_EventNotSaved() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+
+	order.Description = "unit test"
+	err := suite.service.updateOrder(context.TODO(), order)
+	assert.NoError(suite.T(), err)
+
+	events, err := suite.service.orderStatusEventRepository.FindByOrderId(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), events, 2)
+}
+
+func (suite *OrderStatusTestSuite) TestOrderStatus_UpdateOrder_ProcessedToCreated_Error() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+
+	order.PrivateStatus = recurringpb.OrderStatusPaymentSystemCreate
+	err := suite.service.updateOrder(context.TODO(), order)
+	assert.Error(suite.T(), err)
+	assert.IsType(suite.T(), &orderStatusTransitionError{}, err)
+
+	e := err.(*orderStatusTransitionError)
+	assert.Equal(suite.T(), order.Id, e.OrderId)
+	assert.Equal(suite.T(), recurringpb.OrderStatusPaymentSystemComplete, e.From)
+	assert.Equal(suite.T(), recurringpb.OrderStatusPaymentSystemCreate, e.To)
+
+	order2, err := suite.service.orderRepository.GetById(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), recurringpb.OrderStatusPaymentSystemComplete, order2.PrivateStatus)
+
+	events, err := suite.service.orderStatusEventRepository.FindByOrderId(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), events, 2)
+}
+
+func (suite *OrderStatusTestSuite) TestOrderStatus_UpdateOrder_RefundedToProcessed_Error() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+
+	order.PrivateStatus = recurringpb.OrderStatusRefund
+	err := suite.service.updateOrder(context.TODO(), order)
+	assert.NoError(suite.T(), err)
+
+	order.PrivateStatus = recurringpb.OrderStatusPaymentSystemComplete
+	err = suite.service.updateOrder(context.TODO(), order)
+	assert.IsType(suite.T(), &orderStatusTransitionError{}, err)
+
+	order2, err := suite.service.orderRepository.GetById(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), recurringpb.OrderStatusRefund, order2.PrivateStatus)
+}
+
+func (suite *OrderStatusTestSuite) TestOrderStatus_UpdateOrder_StatusChangedConcurrently_Error() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+
+	orderRepositoryMock := &mocks.OrderRepositoryInterface{}
+	orderRepositoryMock.On("GetById", mock.Anything, order.Id).Return(order, nil)
+	orderRepositoryMock.On("UpdateWithPrivateStatus", mock.Anything, mock.Anything, int32(recurringpb.OrderStatusPaymentSystemComplete)).
+		Return(false, nil)
+	suite.service.orderRepository = orderRepositoryMock
+
+	changed := *order
+	changed.PrivateStatus = recurringpb.OrderStatusRefund
+	err := suite.service.updateOrder(context.TODO(), &changed)
+	assert.Equal(suite.T(), orderErrorStatusConflict, err)
+	orderRepositoryMock.AssertNotCalled(suite.T(), "Update", mock.Anything, mock.Anything)
+
+	events, err := suite.service.orderStatusEventRepository.FindByOrderId(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), events, 2)
+}
+
+func (suite *OrderStatusTestSuite) TestOrderStatus_UpdateOrder_RetryDeclinedPayment_Ok() {
+	req := &billingpb.OrderCreateRequest{
+		Type:        pkg.OrderType_simple,
+		ProjectId:   suite.project.Id,
+		Currency:    "RUB",
+		Amount:      100,
+		Account:     "unit test",
+		Description: "unit test",
+		OrderId:     primitive.NewObjectID().Hex(),
+	}
+	rsp := &billingpb.OrderCreateProcessResponse{}
+	err := suite.service.OrderCreateProcess(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	order := rsp.Item
+
+	statuses := []int32{
+		recurringpb.OrderStatusPaymentSystemCreate,
+		recurringpb.OrderStatusPaymentSystemDeclined,
+		recurringpb.OrderStatusPaymentSystemCreate,
+		recurringpb.OrderStatusPaymentSystemCanceled,
+		recurringpb.OrderStatusPaymentSystemRejectOnCreate,
+		recurringpb.OrderStatusPaymentSystemComplete,
+	}
+
+	for _, status := range statuses {
+		order.PrivateStatus = status
+		err = suite.service.updateOrder(context.TODO(), order)
+		assert.NoError(suite.T(), err)
+	}
+
+	events, err := suite.service.orderStatusEventRepository.FindByOrderId(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), events, len(statuses))
+}
+
+func (suite *OrderStatusTestSuite) TestOrderStatus_PaymentCallbackProcess_OutOfOrder() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+
+	// notification about other transaction of the order which was declined
+	callback := suite.getPaymentCallback(order)
+	callback.PaymentData.Id = primitive.NewObjectID().Hex()
+	callback.PaymentData.Status = billingpb.CardPayPaymentResponseStatusDeclined
+
+	rsp := &billingpb.PaymentNotifyResponse{}
+	err := suite.service.PaymentCallbackProcess(context.TODO(), suite.getPaymentNotifyRequest(order, callback), rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), pkg.StatusErrorValidation, rsp.Status)
+	assert.Contains(suite.T(), rsp.Error, orderErrorStatusTransitionNotAllowed.Message)
+
+	order2, err := suite.service.orderRepository.GetById(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), recurringpb.OrderStatusPaymentSystemComplete, order2.PrivateStatus)
+}
+
+func (suite *OrderStatusTestSuite) TestOrderStatus_GetOrderStatusEvents_NotFound() {
+	rsp := &internalPkg.OrderStatusEventsResponse{}
+	err := suite.service.GetOrderStatusEvents(context.TODO(), &billingpb.GetOrderRequest{OrderId: "unknown"}, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), orderErrorNotFound, rsp.Message)
+}
+
+func (suite *OrderStatusTestSuite) getPaymentCallback(order *billingpb.Order) *billingpb.CardPayPaymentCallback {
+	req := &internalPkg.ListCallbackJournalRequest{Type: internalPkg.CallbackJournalTypePayment, OrderId: order.Id}
+	entries, err := suite.service.callbackJournalRepository.Find(context.TODO(), req)
+	assert.NoError(suite.T(), err)
+	assert.NotEmpty(suite.T(), entries)
+
+	callback := &billingpb.CardPayPaymentCallback{}
+	err = json.Unmarshal(entries[len(entries)-1].Body, callback)
+	assert.NoError(suite.T(), err)
+
+	return callback
+}
+
+func (suite *OrderStatusTestSuite) getPaymentNotifyRequest(
+	order *billingpb.Order,
+	callback *billingpb.CardPayPaymentCallback,
+) *billingpb.PaymentNotifyRequest {
+	buf, err := json.Marshal(callback)
+	assert.NoError(suite.T(), err)
+
+	hash := sha512.New()
+	hash.Write([]byte(string(buf) + order.PaymentMethod.Params.SecretCallback))
+
+	return &billingpb.PaymentNotifyRequest{
+		OrderId:   order.Id,
+		Request:   buf,
+		Signature: hex.EncodeToString(hash.Sum(nil)),
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/paysuper/paysuper-billing-server/internal/config"
 	"github.com/paysuper/paysuper-billing-server/internal/database"
 	"github.com/paysuper/paysuper-billing-server/internal/mocks"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
 	"github.com/paysuper/paysuper-billing-server/internal/repository"
 	"github.com/paysuper/paysuper-billing-server/pkg"
 	"github.com/paysuper/paysuper-proto/go/billingpb"
@@ -4496,8 +4497,7 @@ func (suite *OrderTestSuite) TestOrder_ProcessPaymentFormData_OrderHasEndedStatu
 	assert.Equal(suite.T(), rsp1.Status, billingpb.ResponseStatusOk)
 	rsp := rsp1.Item
 
-	rsp.PrivateStatus = recurringpb.OrderStatusProjectComplete
-	err = suite.service.updateOrder(context.TODO(), rsp)
+	helperSetOrderPrivateStatus(suite.Suite, suite.service, rsp, recurringpb.OrderStatusProjectComplete)
 
 	data := map[string]string{
 		billingpb.PaymentCreateFieldOrderId:         rsp.Uuid,
@@ -6497,8 +6497,7 @@ func (suite *OrderTestSuite) TestOrder_IsOrderCanBePaying_HasEndedStatus_Error()
 	assert.Equal(suite.T(), rsp0.Status, billingpb.ResponseStatusOk)
 	rsp := rsp0.Item
 
-	rsp.PrivateStatus = recurringpb.OrderStatusProjectComplete
-	err = suite.service.updateOrder(context.TODO(), rsp)
+	helperSetOrderPrivateStatus(suite.Suite, suite.service, rsp, recurringpb.OrderStatusProjectComplete)
 	assert.NoError(suite.T(), err)
 
 	req1 := &billingpb.IsOrderCanBePayingRequest{
@@ -6803,9 +6802,7 @@ func (suite *OrderTestSuite) TestOrder_orderNotifyMerchant_Ok() {
 	assert.False(suite.T(), order.GetNotificationStatus(recurringpb.OrderPublicStatusProcessed))
 	assert.Equal(suite.T(), len(order.IsNotificationsSent), 0)
 
-	order.PrivateStatus = recurringpb.OrderStatusProjectComplete
-	err = suite.service.updateOrder(context.TODO(), order)
-	assert.NoError(suite.T(), err)
+	helperSetOrderPrivateStatus(suite.Suite, suite.service, order, recurringpb.OrderStatusProjectComplete)
 
 	ps = order.GetPublicStatus()
 	assert.Equal(suite.T(), ps, recurringpb.OrderPublicStatusProcessed)
@@ -8470,6 +8467,11 @@ func (suite *OrderTestSuite) TestOrder_OrderCreateProcessVirtualCurrency_Ok() {
 	assert.Equal(suite.T(), "RUB", rsp.Item.Currency)
 	assert.Equal(suite.T(), "virtual", rsp.Item.Items[0].Currency)
 	assert.EqualValues(suite.T(), 100, rsp.Item.Items[0].Amount)
+
+	hold, err := suite.service.virtualCurrencyHoldRepository.GetByOrderId(context.TODO(), rsp.Item.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), rsp.Item.VirtualCurrencyAmount, hold.Amount)
+	assert.Equal(suite.T(), internalPkg.VirtualCurrencyHoldStatusHeld, hold.Status)
 }
 
 func (suite *OrderTestSuite) TestOrder_CreateOrderByTokenWithVirtualCurrency_Ok() {
@@ -8611,22 +8613,6 @@ func (suite *OrderTestSuite) TestOrder_PaymentFormJsonDataProcess_MinSystemLimit
 
 func (suite *OrderTestSuite) TestOrder_ReCreateOrder_Ok() {
 	shouldBe := require.New(suite.T())
-	req := &billingpb.OrderCreateRequest{
-		Type:        pkg.OrderType_simple,
-		ProjectId:   suite.project.Id,
-		Currency:    "RUB",
-		Amount:      100,
-		Account:     "unit test",
-		Description: "unit test",
-		OrderId:     primitive.NewObjectID().Hex(),
-	}
-
-	rsp0 := &billingpb.OrderCreateProcessResponse{}
-	err := suite.service.OrderCreateProcess(context.TODO(), req, rsp0)
-
-	shouldBe.Nil(err)
-	shouldBe.Equal(rsp0.Status, billingpb.ResponseStatusOk)
-	order := rsp0.Item
 
 	allowedStatuses := []int32{
 		recurringpb.OrderStatusPaymentSystemRejectOnCreate,
@@ -8640,8 +8626,24 @@ func (suite *OrderTestSuite) TestOrder_ReCreateOrder_Ok() {
 	}
 
 	for _, status := range allowedStatuses {
-		order.PrivateStatus = status
-		shouldBe.NoError(suite.service.updateOrder(ctx, order))
+		req := &billingpb.OrderCreateRequest{
+			Type:        pkg.OrderType_simple,
+			ProjectId:   suite.project.Id,
+			Currency:    "RUB",
+			Amount:      100,
+			Account:     "unit test",
+			Description: "unit test",
+			OrderId:     primitive.NewObjectID().Hex(),
+		}
+
+		rsp0 := &billingpb.OrderCreateProcessResponse{}
+		err := suite.service.OrderCreateProcess(context.TODO(), req, rsp0)
+
+		shouldBe.Nil(err)
+		shouldBe.Equal(rsp0.Status, billingpb.ResponseStatusOk)
+		order := rsp0.Item
+
+		helperSetOrderPrivateStatus(suite.Suite, suite.service, order, status)
 
 		rsp1 := &billingpb.OrderCreateProcessResponse{}
 		shouldBe.NoError(suite.service.OrderReCreateProcess(context.TODO(), &billingpb.OrderReCreateProcessRequest{OrderId: order.GetUuid()}, rsp1))
@@ -3094,6 +3094,53 @@ func (s *Service) doUpdateOrderView(ctx context.Context, match bson.M) error {
 				"preserveNullAndEmptyArrays": true,
 			},
 		},
+		{
+			"$lookup": bson.M{
+				"from":         "order_fraud_check",
+				"localField":   "_id",
+				"foreignField": "order_oid",
+				"as":           "fraud_check",
+			},
+		},
+		{
+			"$addFields": bson.M{
+				"fraud_check": bson.M{
+					"$let": bson.M{
+						"vars": bson.M{
+							"check": bson.M{
+								"$reduce": bson.M{
+									"input":        "$fraud_check",
+									"initialValue": nil,
+									"in": bson.M{
+										"$cond": list{
+											bson.M{
+												"$or": list{
+													bson.M{"$eq": list{"$$value", nil}},
+													bson.M{"$gt": list{"$$this.created_at", "$$value.created_at"}},
+												},
+											},
+											"$$this",
+											"$$value",
+										},
+									},
+								},
+							},
+						},
+						"in": bson.M{
+							"$cond": list{
+								bson.M{"$eq": list{"$$check", nil}},
+								"$$REMOVE",
+								bson.M{
+									"score":    "$$check.score",
+									"decision": "$$check.decision",
+									"rules":    "$$check.rules",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
 		{
 			"$addFields": bson.M{
 				"order_charge": bson.M{
@@ -3216,6 +3263,7 @@ func (s *Service) doUpdateOrderView(ctx context.Context, match bson.M) error {
 				"is_high_risk":                                      1,
 				"payment_ip_country":                                1,
 				"is_ip_country_mismatch_bin":                        1,
+				"fraud_check":                                       1,
 				"order_charge":                                      1,
 				"order_charge_before_vat":                           1,
 				"billing_country_changed_by_user":                   1,
@@ -0,0 +1,350 @@
+package service
+
+import (
+	"context"
+	"github.com/golang/protobuf/ptypes"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"github.com/paysuper/paysuper-proto/go/recurringpb"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	"time"
+)
+
+var (
+	paymentAuthorizationErrorNotAuthorized        = newBillingServerErrorMsg("pa000001", "payment of order isn't authorized")
+	paymentAuthorizationErrorCaptureAmountInvalid = newBillingServerErrorMsg("pa000002", "capture amount must be greater than zero and not greater than authorized amount")
+	paymentAuthorizationErrorCaptureRequested     = newBillingServerErrorMsg("pa000003", "capture of payment is already requested")
+	paymentAuthorizationErrorCaptureFailed        = newBillingServerErrorMsg("pa000004", "authorized payment can't be captured")
+	paymentAuthorizationErrorVoidFailed           = newBillingServerErrorMsg("pa000005", "authorized payment can't be voided")
+)
+
+// getOrderPublicStatus returns public status of order with respect to statuses of two-step payments,
+// which are unknown to billingpb.Order.GetPublicStatus.
+func getOrderPublicStatus(order *billingpb.Order) string {
+	switch order.PrivateStatus {
+	case pkg.OrderStatusPaymentSystemAuthorized:
+		return recurringpb.OrderPublicStatusCreated
+	case pkg.OrderStatusPaymentSystemVoided:
+		return recurringpb.OrderPublicStatusCanceled
+	}
+
+	return order.GetPublicStatus()
+}
+
+// createPaymentInPaymentSystem creates payment for order in payment system. Payment for key products is only
+// authorized and captured after confirmation that keys are still reserved for the order, payment marked
+// for review by fraud screening is only authorized and held until manual capture or void,
+// if payment system doesn't support two-step payments then payment is created as usual.
+func (s *Service) createPaymentInPaymentSystem(h Gate, order *billingpb.Order, requisites map[string]string) (string, error) {
+	successUrl := s.cfg.GetRedirectUrlSuccess(nil)
+	failUrl := s.cfg.GetRedirectUrlFail(nil)
+
+	if order.ProductType == pkg.OrderType_key || isOrderFraudReview(order) {
+		url, err := h.AuthorizePayment(order, successUrl, failUrl, requisites)
+
+		if err != paymentSystemErrorTwoStepNotSupported {
+			return url, err
+		}
+	}
+
+	return h.CreatePayment(order, successUrl, failUrl, requisites)
+}
+
+// processPaymentAuthorized captures authorized payment if all keys of order are still reserved for it,
+// otherwise authorization is voided. Failed capture is only logged, authorization which wasn't captured
+// will be voided by VoidExpiredAuthorizations. Payment marked for review by fraud screening isn't captured.
+func (s *Service) processPaymentAuthorized(ctx context.Context, h Gate, order *billingpb.Order) {
+	if isOrderFraudReview(order) {
+		zap.L().Info("authorized payment is held for fraud review", zap.String("order_id", order.Id))
+		return
+	}
+
+	if order.ProductType != pkg.OrderType_key || s.isOrderKeysReserved(ctx, order) {
+		_, _ = s.capturePayment(ctx, h, order, order.ChargeAmount)
+		return
+	}
+
+	zap.L().Info("keys aren't reserved for order anymore, payment authorization will be voided", zap.String("order_id", order.Id))
+	_ = s.voidPayment(ctx, h, order)
+}
+
+func (s *Service) isOrderKeysReserved(ctx context.Context, order *billingpb.Order) bool {
+	if len(order.Keys) <= 0 {
+		return false
+	}
+
+	for _, keyId := range order.Keys {
+		key, err := s.keyRepository.GetById(ctx, keyId)
+
+		if err != nil {
+			zap.L().Error(
+				"get reserved key failed",
+				zap.Error(err),
+				zap.String("order_id", order.Id),
+				zap.String("key_id", keyId),
+			)
+			return false
+		}
+
+		reservedTo, err := ptypes.Timestamp(key.ReservedTo)
+
+		if err != nil || key.OrderId != order.Id || !reservedTo.After(time.Now()) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *Service) capturePayment(
+	ctx context.Context,
+	h Gate,
+	order *billingpb.Order,
+	amount float64,
+) (*internalPkg.PaymentCapture, error) {
+	if order.PrivateStatus != pkg.OrderStatusPaymentSystemAuthorized {
+		return nil, paymentAuthorizationErrorNotAuthorized
+	}
+
+	if amount <= 0 || amount > order.ChargeAmount {
+		return nil, paymentAuthorizationErrorCaptureAmountInvalid
+	}
+
+	capture := &internalPkg.PaymentCapture{
+		OrderId:          order.Id,
+		AuthorizedAmount: order.ChargeAmount,
+		CapturedAmount:   amount,
+		Currency:         order.ChargeCurrency,
+		CreatedAt:        time.Now(),
+	}
+	ok, err := s.paymentCaptureRepository.Claim(ctx, capture)
+
+	if err != nil {
+		return nil, paymentAuthorizationErrorCaptureFailed
+	}
+
+	if !ok {
+		return nil, paymentAuthorizationErrorCaptureRequested
+	}
+
+	err = h.CapturePayment(order, amount)
+
+	if err != nil {
+		zap.L().Error(
+			"capture of authorized payment failed",
+			zap.Error(err),
+			zap.String("order_id", order.Id),
+			zap.Float64("amount", amount),
+		)
+
+		// capture may be requested again if payment system rejected the request
+		_ = s.paymentCaptureRepository.Delete(ctx, order.Id)
+		return nil, paymentAuthorizationErrorCaptureFailed
+	}
+
+	return capture, nil
+}
+
+// getPaymentCapture returns requested capture of authorized payment of order or nil if capture wasn't requested.
+func (s *Service) getPaymentCapture(ctx context.Context, order *billingpb.Order) (*internalPkg.PaymentCapture, error) {
+	capture, err := s.paymentCaptureRepository.GetByOrderId(ctx, order.Id)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String("order_id", order.Id),
+		)
+		return nil, err
+	}
+
+	return capture, nil
+}
+
+// applyPaymentCapture sets captured amount as charge amount of authorized order before processing of payment
+// notification, because notification about completed payment contains captured amount and accounting entries
+// must be created by captured amount too. Returns function which restores the authorized amount if the
+// notification didn't complete the payment.
+func (s *Service) applyPaymentCapture(ctx context.Context, order *billingpb.Order) (func(), error) {
+	if order.PrivateStatus != pkg.OrderStatusPaymentSystemAuthorized {
+		return func() {}, nil
+	}
+
+	capture, err := s.getPaymentCapture(ctx, order)
+
+	if err != nil || capture == nil {
+		return func() {}, err
+	}
+
+	order.ChargeAmount = capture.CapturedAmount
+
+	return func() {
+		if order.PrivateStatus != recurringpb.OrderStatusPaymentSystemComplete {
+			order.ChargeAmount = capture.AuthorizedAmount
+		}
+	}, nil
+}
+
+func (s *Service) voidPayment(ctx context.Context, h Gate, order *billingpb.Order) error {
+	if order.PrivateStatus != pkg.OrderStatusPaymentSystemAuthorized {
+		return paymentAuthorizationErrorNotAuthorized
+	}
+
+	capture, err := s.getPaymentCapture(ctx, order)
+
+	if err != nil {
+		return paymentAuthorizationErrorVoidFailed
+	}
+
+	if capture != nil {
+		return paymentAuthorizationErrorCaptureRequested
+	}
+
+	err = h.VoidPayment(order)
+
+	if err != nil {
+		zap.L().Error(
+			"void of authorized payment failed",
+			zap.Error(err),
+			zap.String("order_id", order.Id),
+		)
+		return paymentAuthorizationErrorVoidFailed
+	}
+
+	order.PrivateStatus = pkg.OrderStatusPaymentSystemVoided
+	order.CanceledAt = ptypes.TimestampNow()
+
+	return s.updateOrderWithCause(ctx, order, internalPkg.OrderStatusEventCausePaymentVoid)
+}
+
+func (s *Service) CapturePayment(
+	ctx context.Context,
+	req *internalPkg.PaymentAuthorizationRequest,
+	rsp *internalPkg.PaymentAuthorizationResponse,
+) error {
+	var capture *internalPkg.PaymentCapture
+	order, h, err := s.getAuthorizedOrder(ctx, req.OrderId)
+
+	if err == nil {
+		amount := req.Amount
+
+		if amount == 0 {
+			amount = order.ChargeAmount
+		}
+
+		capture, err = s.capturePayment(ctx, h, order, amount)
+	}
+
+	if err != nil {
+		rsp.Status, rsp.Message = getPaymentAuthorizationErrorStatus(err)
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = order
+	rsp.Capture = capture
+
+	return nil
+}
+
+func (s *Service) VoidPayment(
+	ctx context.Context,
+	req *internalPkg.PaymentAuthorizationRequest,
+	rsp *internalPkg.PaymentAuthorizationResponse,
+) error {
+	order, h, err := s.getAuthorizedOrder(ctx, req.OrderId)
+
+	if err == nil {
+		err = s.voidPayment(ctx, h, order)
+	}
+
+	if err != nil {
+		rsp.Status, rsp.Message = getPaymentAuthorizationErrorStatus(err)
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = order
+
+	return nil
+}
+
+// VoidExpiredAuthorizations voids authorized payments which weren't captured during the authorization ttl
+// and returns number of voided payments.
+func (s *Service) VoidExpiredAuthorizations(ctx context.Context) (int, error) {
+	counter := 0
+	before := time.Now().Add(-s.cfg.GetPaymentAuthorizationTtl())
+	orders, err := s.orderRepository.FindByPrivateStatus(ctx, pkg.OrderStatusPaymentSystemAuthorized, before)
+
+	if err != nil {
+		return counter, err
+	}
+
+	for _, order := range orders {
+		h, err := s.paymentSystemGateway.getGateway(order.PaymentMethod.Handler)
+
+		if err != nil {
+			zap.L().Error(
+				"payment system handler of authorized order not found",
+				zap.Error(err),
+				zap.String("order_id", order.Id),
+				zap.String(pkg.LogFieldHandler, order.PaymentMethod.Handler),
+			)
+			continue
+		}
+
+		// payment with requested capture isn't voided
+		if err = s.voidPayment(ctx, h, order); err != nil {
+			continue
+		}
+
+		counter++
+	}
+
+	return counter, nil
+}
+
+func (s *Service) getAuthorizedOrder(ctx context.Context, uuid string) (*billingpb.Order, Gate, error) {
+	order, err := s.orderRepository.GetByUuid(ctx, uuid)
+
+	if err != nil {
+		return nil, nil, orderErrorNotFound
+	}
+
+	if order.PrivateStatus != pkg.OrderStatusPaymentSystemAuthorized {
+		return nil, nil, paymentAuthorizationErrorNotAuthorized
+	}
+
+	h, err := s.paymentSystemGateway.getGateway(order.PaymentMethod.Handler)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return order, h, nil
+}
+
+func getPaymentAuthorizationErrorStatus(err error) (int32, *billingpb.ResponseErrorMessage) {
+	e, ok := err.(*billingpb.ResponseErrorMessage)
+
+	if !ok {
+		return billingpb.ResponseStatusSystemError, orderErrorUnknown
+	}
+
+	switch e {
+	case orderErrorNotFound:
+		return billingpb.ResponseStatusNotFound, e
+	case paymentAuthorizationErrorNotAuthorized,
+		paymentAuthorizationErrorCaptureRequested,
+		paymentAuthorizationErrorCaptureAmountInvalid:
+		return billingpb.ResponseStatusBadData, e
+	}
+
+	return billingpb.ResponseStatusSystemError, e
+}
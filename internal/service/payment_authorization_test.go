@@ -0,0 +1,302 @@
+package service
+
+import (
+	"context"
+	"github.com/go-redis/redis"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/mongodb"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	"github.com/paysuper/paysuper-billing-server/internal/database"
+	"github.com/paysuper/paysuper-billing-server/internal/mocks"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	casbinMocks "github.com/paysuper/paysuper-proto/go/casbinpb/mocks"
+	"github.com/paysuper/paysuper-proto/go/recurringpb"
+	reportingMocks "github.com/paysuper/paysuper-proto/go/reporterpb/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	rabbitmq "gopkg.in/ProtocolONE/rabbitmq.v1/pkg"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type PaymentAuthorizationTestSuite struct {
+	suite.Suite
+	service *Service
+	log     *zap.Logger
+	cache   database.CacheInterface
+
+	merchant      *billingpb.Merchant
+	project       *billingpb.Project
+	paymentMethod *billingpb.PaymentMethod
+	paymentSystem *billingpb.PaymentSystem
+}
+
+func Test_PaymentAuthorization(t *testing.T) {
+	suite.Run(t, new(PaymentAuthorizationTestSuite))
+}
+
+func (suite *PaymentAuthorizationTestSuite) SetupTest() {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		suite.FailNow("Config load failed", "%v", err)
+	}
+	cfg.CardPayApiUrl = "https://sandbox.cardpay.com"
+
+	m, err := migrate.New(
+		"file://../../migrations/tests",
+		cfg.MongoDsn)
+	assert.NoError(suite.T(), err, "Migrate init failed")
+
+	err = m.Up()
+	if err != nil && err.Error() != "no change" {
+		suite.FailNow("Migrations failed", "%v", err)
+	}
+
+	ctx, _ := context.WithTimeout(context.Background(), 50*time.Second)
+	opts := []mongodb.Option{mongodb.Context(ctx)}
+	db, err := mongodb.NewDatabase(opts...)
+	if err != nil {
+		suite.FailNow("Database connection failed", "%v", err)
+	}
+
+	suite.log, err = zap.NewProduction()
+
+	if err != nil {
+		suite.FailNow("Logger initialization failed", "%v", err)
+	}
+
+	broker, err := rabbitmq.NewBroker(cfg.BrokerAddress)
+
+	if err != nil {
+		suite.FailNow("Creating RabbitMQ publisher failed", "%v", err)
+	}
+
+	redisClient := database.NewRedis(
+		&redis.Options{
+			Addr:     cfg.RedisHost,
+			Password: cfg.RedisPassword,
+		},
+	)
+
+	redisdb := mocks.NewTestRedis()
+	suite.cache, err = database.NewCacheRedis(redisdb, "cache")
+	suite.service = NewBillingService(
+		db,
+		cfg,
+		mocks.NewGeoIpServiceTestOk(),
+		mocks.NewRepositoryServiceOk(),
+		mocks.NewTaxServiceOkMock(),
+		broker,
+		redisClient,
+		suite.cache,
+		mocks.NewCurrencyServiceMockOk(),
+		mocks.NewDocumentSignerMockOk(),
+		&reportingMocks.ReporterService{},
+		mocks.NewFormatterOK(),
+		mocks.NewBrokerMockOk(),
+		&casbinMocks.CasbinService{},
+	)
+
+	if err := suite.service.Init(); err != nil {
+		suite.FailNow("Billing service initialization failed", "%v", err)
+	}
+
+	suite.merchant, suite.project, suite.paymentMethod, suite.paymentSystem = helperCreateEntitiesForTests(suite.Suite, suite.service)
+}
+
+func (suite *PaymentAuthorizationTestSuite) TearDownTest() {
+	err := suite.service.db.Drop()
+
+	if err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	err = suite.service.db.Close()
+
+	if err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *PaymentAuthorizationTestSuite) TestPaymentAuthorization_CapturePayment_Ok() {
+	order := suite.createAuthorizedOrder(time.Now())
+
+	req := &internalPkg.PaymentAuthorizationRequest{OrderId: order.Uuid}
+	rsp := &internalPkg.PaymentAuthorizationResponse{}
+	err := suite.service.CapturePayment(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), order.ChargeAmount, rsp.Item.ChargeAmount)
+	assert.Equal(suite.T(), order.ChargeAmount, rsp.Capture.CapturedAmount)
+
+	order, err = suite.service.orderRepository.GetByUuid(context.TODO(), order.Uuid)
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), pkg.OrderStatusPaymentSystemAuthorized, order.PrivateStatus)
+
+	capture, err := suite.service.paymentCaptureRepository.GetByOrderId(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), order.ChargeAmount, capture.AuthorizedAmount)
+
+	// second capture of the same authorization isn't allowed
+	rsp = &internalPkg.PaymentAuthorizationResponse{}
+	err = suite.service.CapturePayment(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), paymentAuthorizationErrorCaptureRequested, rsp.Message)
+}
+
+func (suite *PaymentAuthorizationTestSuite) TestPaymentAuthorization_CapturePayment_Partial() {
+	order := suite.createAuthorizedOrder(time.Now())
+	amount := order.ChargeAmount / 2
+
+	req := &internalPkg.PaymentAuthorizationRequest{OrderId: order.Uuid, Amount: amount}
+	rsp := &internalPkg.PaymentAuthorizationResponse{}
+	err := suite.service.CapturePayment(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), amount, rsp.Capture.CapturedAmount)
+
+	// charge amount of order is changed only when payment system completes the captured payment
+	order2, err := suite.service.orderRepository.GetByUuid(context.TODO(), order.Uuid)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), order.ChargeAmount, order2.ChargeAmount)
+
+	capture, err := suite.service.paymentCaptureRepository.GetByOrderId(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), order.ChargeAmount, capture.AuthorizedAmount)
+	assert.Equal(suite.T(), amount, capture.CapturedAmount)
+}
+
+func (suite *PaymentAuthorizationTestSuite) TestPaymentAuthorization_ApplyPaymentCapture() {
+	order := suite.createAuthorizedOrder(time.Now())
+	authorized := order.ChargeAmount
+	amount := authorized / 2
+
+	req := &internalPkg.PaymentAuthorizationRequest{OrderId: order.Uuid, Amount: amount}
+	rsp := &internalPkg.PaymentAuthorizationResponse{}
+	err := suite.service.CapturePayment(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	// declined capture keeps the authorized amount
+	restore, err := suite.service.applyPaymentCapture(context.TODO(), order)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), amount, order.ChargeAmount)
+	order.PrivateStatus = recurringpb.OrderStatusPaymentSystemDeclined
+	restore()
+	assert.Equal(suite.T(), authorized, order.ChargeAmount)
+
+	order.PrivateStatus = pkg.OrderStatusPaymentSystemAuthorized
+	restore, err = suite.service.applyPaymentCapture(context.TODO(), order)
+	assert.NoError(suite.T(), err)
+	order.PrivateStatus = recurringpb.OrderStatusPaymentSystemComplete
+	restore()
+	assert.Equal(suite.T(), amount, order.ChargeAmount)
+}
+
+func (suite *PaymentAuthorizationTestSuite) TestPaymentAuthorization_CapturePayment_AmountInvalid() {
+	order := suite.createAuthorizedOrder(time.Now())
+
+	req := &internalPkg.PaymentAuthorizationRequest{OrderId: order.Uuid, Amount: order.ChargeAmount + 1}
+	rsp := &internalPkg.PaymentAuthorizationResponse{}
+	err := suite.service.CapturePayment(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), paymentAuthorizationErrorCaptureAmountInvalid, rsp.Message)
+}
+
+func (suite *PaymentAuthorizationTestSuite) TestPaymentAuthorization_CapturePayment_NotAuthorized() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+
+	req := &internalPkg.PaymentAuthorizationRequest{OrderId: order.Uuid}
+	rsp := &internalPkg.PaymentAuthorizationResponse{}
+	err := suite.service.CapturePayment(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), paymentAuthorizationErrorNotAuthorized, rsp.Message)
+}
+
+func (suite *PaymentAuthorizationTestSuite) TestPaymentAuthorization_CapturePayment_NotFound() {
+	req := &internalPkg.PaymentAuthorizationRequest{OrderId: "unknown"}
+	rsp := &internalPkg.PaymentAuthorizationResponse{}
+	err := suite.service.CapturePayment(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), orderErrorNotFound, rsp.Message)
+}
+
+func (suite *PaymentAuthorizationTestSuite) TestPaymentAuthorization_VoidPayment_Ok() {
+	order := suite.createAuthorizedOrder(time.Now())
+
+	req := &internalPkg.PaymentAuthorizationRequest{OrderId: order.Uuid}
+	rsp := &internalPkg.PaymentAuthorizationResponse{}
+	err := suite.service.VoidPayment(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	order, err = suite.service.orderRepository.GetByUuid(context.TODO(), order.Uuid)
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), pkg.OrderStatusPaymentSystemVoided, order.PrivateStatus)
+	assert.NotNil(suite.T(), order.CanceledAt)
+	assert.Equal(suite.T(), recurringpb.OrderPublicStatusCanceled, getOrderPublicStatus(order))
+}
+
+func (suite *PaymentAuthorizationTestSuite) TestPaymentAuthorization_VoidExpiredAuthorizations_Ok() {
+	ttl := suite.service.cfg.GetPaymentAuthorizationTtl()
+	expired := suite.createAuthorizedOrder(time.Now().Add(-2 * ttl))
+	active := suite.createAuthorizedOrder(time.Now())
+	captured := suite.createAuthorizedOrder(time.Now().Add(-2 * ttl))
+
+	rsp := &internalPkg.PaymentAuthorizationResponse{}
+	err := suite.service.CapturePayment(context.TODO(), &internalPkg.PaymentAuthorizationRequest{OrderId: captured.Uuid}, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	count, err := suite.service.VoidExpiredAuthorizations(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, count)
+
+	expected := map[string]int32{
+		expired.Id:  pkg.OrderStatusPaymentSystemVoided,
+		active.Id:   pkg.OrderStatusPaymentSystemAuthorized,
+		captured.Id: pkg.OrderStatusPaymentSystemAuthorized,
+	}
+
+	for id, status := range expected {
+		order, err := suite.service.orderRepository.GetById(context.TODO(), id)
+		assert.NoError(suite.T(), err)
+		assert.EqualValues(suite.T(), status, order.PrivateStatus)
+	}
+}
+
+func (suite *PaymentAuthorizationTestSuite) TestPaymentAuthorization_GetOrderPublicStatus() {
+	order := &billingpb.Order{PrivateStatus: pkg.OrderStatusPaymentSystemAuthorized}
+	assert.Equal(suite.T(), recurringpb.OrderPublicStatusCreated, getOrderPublicStatus(order))
+
+	order.PrivateStatus = pkg.OrderStatusPaymentSystemVoided
+	assert.Equal(suite.T(), recurringpb.OrderPublicStatusCanceled, getOrderPublicStatus(order))
+
+	order.PrivateStatus = recurringpb.OrderStatusPaymentSystemComplete
+	assert.Equal(suite.T(), order.GetPublicStatus(), getOrderPublicStatus(order))
+}
+
+func (suite *PaymentAuthorizationTestSuite) createAuthorizedOrder(authorizedAt time.Time) *billingpb.Order {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+
+	closedAt, err := ptypes.TimestampProto(authorizedAt)
+	assert.NoError(suite.T(), err)
+
+	order.PrivateStatus = pkg.OrderStatusPaymentSystemAuthorized
+	order.PaymentMethod.Handler = paymentSystemHandlerCardPayMockTwoStep
+	order.PaymentMethodOrderClosedAt = closedAt
+	err = suite.service.orderRepository.Update(context.TODO(), order)
+	assert.NoError(suite.T(), err)
+
+	return order
+}
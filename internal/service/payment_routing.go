@@ -0,0 +1,509 @@
+package service
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"github.com/paysuper/paysuper-proto/go/currenciespb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	"sort"
+	"time"
+)
+
+const (
+	orderPrivateMetadataKeyPaymentRoutingId = "PaymentRoutingId"
+)
+
+var (
+	paymentRouteErrorNotFound               = newBillingServerErrorMsg("pr000001", "payment route not found")
+	paymentRouteErrorPaymentMethodNotFound  = newBillingServerErrorMsg("pr000002", "payment method of payment route not found")
+	paymentRouteErrorCandidatesEmpty        = newBillingServerErrorMsg("pr000003", "payment route must contain at least one payment system")
+	paymentRouteErrorPaymentSystemNotFound  = newBillingServerErrorMsg("pr000004", "payment system of payment route not found")
+	paymentRouteErrorStrategyInvalid        = newBillingServerErrorMsg("pr000005", "payment route strategy is invalid")
+	paymentRouteErrorPaymentSystemDuplicate = newBillingServerErrorMsg("pr000006", "payment system can't be added to payment route twice")
+	paymentRoutingErrorNotFound             = newBillingServerErrorMsg("pr000007", "payment routing for order not found")
+)
+
+// paymentRoutingCandidate is a payment system which is able to process the order payment.
+type paymentRoutingCandidate struct {
+	paymentSystem *billingpb.PaymentSystem
+	handler       Gate
+	params        *billingpb.PaymentMethodParams
+	priority      int32
+	cost          float64
+}
+
+func (s *Service) SetPaymentRoute(
+	ctx context.Context,
+	req *internalPkg.PaymentRoute,
+	rsp *internalPkg.PaymentRouteResponse,
+) error {
+	var (
+		route = req
+		err   error
+	)
+
+	if req.Id != "" {
+		route, err = s.paymentRouteRepository.GetById(ctx, req.Id)
+
+		if err != nil {
+			rsp.Status = billingpb.ResponseStatusNotFound
+			rsp.Message = paymentRouteErrorNotFound
+			return nil
+		}
+
+		route.PaymentMethodId = req.PaymentMethodId
+		route.Region = req.Region
+		route.Currency = req.Currency
+		route.MccCode = req.MccCode
+		route.Strategy = req.Strategy
+		route.Candidates = req.Candidates
+		route.IsActive = req.IsActive
+	} else {
+		route.Id = primitive.NewObjectID().Hex()
+		route.CreatedAt = time.Now()
+	}
+
+	if route.Strategy == "" {
+		route.Strategy = internalPkg.PaymentRouteStrategyCost
+	}
+
+	if route.Strategy != internalPkg.PaymentRouteStrategyCost && route.Strategy != internalPkg.PaymentRouteStrategyPriority {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = paymentRouteErrorStrategyInvalid
+		return nil
+	}
+
+	if _, err = s.paymentMethod.GetById(ctx, route.PaymentMethodId); err != nil {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = paymentRouteErrorPaymentMethodNotFound
+		return nil
+	}
+
+	if len(route.Candidates) <= 0 {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = paymentRouteErrorCandidatesEmpty
+		return nil
+	}
+
+	paymentSystems := make(map[string]bool)
+
+	for _, v := range route.Candidates {
+		if paymentSystems[v.PaymentSystemId] {
+			rsp.Status = billingpb.ResponseStatusBadData
+			rsp.Message = paymentRouteErrorPaymentSystemDuplicate
+			return nil
+		}
+
+		if _, err = s.paymentSystem.GetById(ctx, v.PaymentSystemId); err != nil {
+			rsp.Status = billingpb.ResponseStatusBadData
+			rsp.Message = paymentRouteErrorPaymentSystemNotFound
+			return nil
+		}
+
+		paymentSystems[v.PaymentSystemId] = true
+	}
+
+	route.UpdatedAt = time.Now()
+
+	if req.Id != "" {
+		err = s.paymentRouteRepository.Update(ctx, route)
+	} else {
+		err = s.paymentRouteRepository.Insert(ctx, route)
+	}
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = route
+
+	return nil
+}
+
+func (s *Service) GetPaymentRoutes(
+	ctx context.Context,
+	req *internalPkg.GetPaymentRoutesRequest,
+	rsp *internalPkg.GetPaymentRoutesResponse,
+) error {
+	routes, err := s.paymentRouteRepository.FindByPaymentMethodId(ctx, req.PaymentMethodId)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Items = routes
+
+	return nil
+}
+
+func (s *Service) DeletePaymentRoute(
+	ctx context.Context,
+	req *internalPkg.PaymentRouteRequest,
+	rsp *billingpb.ResponseError,
+) error {
+	if _, err := s.paymentRouteRepository.GetById(ctx, req.Id); err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = paymentRouteErrorNotFound
+		return nil
+	}
+
+	if err := s.paymentRouteRepository.Delete(ctx, req.Id); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+
+	return nil
+}
+
+func (s *Service) GetOrderPaymentRouting(
+	ctx context.Context,
+	req *billingpb.GetOrderRequest,
+	rsp *internalPkg.OrderPaymentRoutingResponse,
+) error {
+	routing, err := s.orderPaymentRoutingRepository.GetByOrderUuid(ctx, req.OrderId)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+
+		if err == mongo.ErrNoDocuments {
+			rsp.Status = billingpb.ResponseStatusNotFound
+			rsp.Message = paymentRoutingErrorNotFound
+		}
+
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = routing
+
+	return nil
+}
+
+// getPaymentRoutingCandidates returns payment systems able to process the order payment ordered by route strategy.
+// If payment route for the order isn't configured, then payment system linked to the payment method is used.
+// Every rejected payment system is registered as routing attempt. If there are no available candidates,
+// then the reason of rejection of the first payment system in the route is returned.
+func (s *Service) getPaymentRoutingCandidates(
+	ctx context.Context,
+	order *billingpb.Order,
+	pm *billingpb.PaymentMethod,
+	routing *internalPkg.OrderPaymentRouting,
+	isRecurring bool,
+) ([]*paymentRoutingCandidate, error) {
+	country, err := s.country.GetByIsoCodeA2(ctx, order.GetCountry())
+
+	if err != nil {
+		return nil, orderErrorCountryByPaymentAccountNotFound
+	}
+
+	route, err := s.paymentRouteRepository.GetByParams(ctx, pm.Id, country.PayerTariffRegion, order.ChargeCurrency, order.MccCode)
+
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+
+		route = &internalPkg.PaymentRoute{
+			Strategy:   internalPkg.PaymentRouteStrategyPriority,
+			Candidates: []*internalPkg.PaymentRouteCandidate{{PaymentSystemId: pm.PaymentSystemId}},
+		}
+	}
+
+	routing.RouteId = route.Id
+	routing.Strategy = route.Strategy
+
+	var (
+		candidates   []*paymentRoutingCandidate
+		firstErr     error
+		estimateCost = route.Strategy == internalPkg.PaymentRouteStrategyCost && len(route.Candidates) > 1
+	)
+
+	for _, v := range route.Candidates {
+		candidate, err := s.getPaymentRoutingCandidate(ctx, order, pm, v, country, estimateCost)
+
+		if err == nil && isRecurring && candidate.paymentSystem.Handler != order.PaymentMethod.Handler {
+			// recurring identifiers are issued by the payment system handler and can't be used in other one
+			err = paymentSystemErrorPaymentMethodNotSupported
+		}
+
+		if err != nil {
+			status := internalPkg.PaymentRoutingAttemptStatusUnavailable
+
+			if err == paymentSystemErrorPaymentMethodNotSupported {
+				status = internalPkg.PaymentRoutingAttemptStatusUnsupported
+			} else if err == orderErrorCostsRatesNotFound {
+				status = internalPkg.PaymentRoutingAttemptStatusNoCosts
+			} else if err == orderErrorPaymentMethodEmptySettings {
+				status = internalPkg.PaymentRoutingAttemptStatusNoSettings
+			}
+
+			routing.Attempts = append(routing.Attempts, &internalPkg.PaymentRoutingAttempt{
+				PaymentSystemId: v.PaymentSystemId,
+				Status:          status,
+				Error:           err.Error(),
+				CreatedAt:       time.Now(),
+			})
+
+			if firstErr == nil {
+				firstErr = err
+			}
+
+			continue
+		}
+
+		candidates = append(candidates, candidate)
+	}
+
+	if len(candidates) <= 0 {
+		return nil, firstErr
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if route.Strategy == internalPkg.PaymentRouteStrategyCost && candidates[i].cost != candidates[j].cost {
+			return candidates[i].cost < candidates[j].cost
+		}
+
+		return candidates[i].priority < candidates[j].priority
+	})
+
+	return candidates, nil
+}
+
+func (s *Service) getPaymentRoutingCandidate(
+	ctx context.Context,
+	order *billingpb.Order,
+	pm *billingpb.PaymentMethod,
+	routeCandidate *internalPkg.PaymentRouteCandidate,
+	country *billingpb.Country,
+	estimateCost bool,
+) (*paymentRoutingCandidate, error) {
+	ps, err := s.paymentSystem.GetById(ctx, routeCandidate.PaymentSystemId)
+
+	if err != nil {
+		return nil, orderErrorPaymentSystemInactive
+	}
+
+	if !ps.IsActive {
+		return nil, orderErrorPaymentSystemInactive
+	}
+
+	h, err := s.paymentSystemGateway.getGateway(ps.Handler)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.paymentSystemHealth.IsAvailable(ps.Handler) {
+		return nil, paymentSystemErrorCircuitOpen
+	}
+
+	if !isPaymentMethodGroupSupported(h, order.PaymentMethod.ExternalId) {
+		return nil, paymentSystemErrorPaymentMethodNotSupported
+	}
+
+	params, err := s.getPaymentRoutingSettings(order, pm, routeCandidate)
+
+	if err != nil {
+		return nil, err
+	}
+
+	candidate := &paymentRoutingCandidate{
+		paymentSystem: ps,
+		handler:       h,
+		params:        params,
+		priority:      routeCandidate.Priority,
+	}
+
+	// tariffs of the order payment method were checked before routing
+	if !estimateCost && routeCandidate.CostMethodName == "" {
+		return candidate, nil
+	}
+
+	methodName := routeCandidate.CostMethodName
+
+	if methodName == "" {
+		methodName, err = order.GetCostPaymentMethodName()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cost, err := s.paymentChannelCostSystem.Get(
+		ctx,
+		methodName,
+		country.PayerTariffRegion,
+		country.IsoCodeA2,
+		order.MccCode,
+		order.OperatingCompanyId,
+	)
+
+	if err != nil {
+		return nil, orderErrorCostsRatesNotFound
+	}
+
+	candidate.cost, err = s.getPaymentRoutingCost(ctx, order, cost)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return candidate, nil
+}
+
+// getPaymentRoutingSettings returns terminal settings of the route candidate payment system for the order.
+// Settings of the payment method are used when the candidate hasn't own settings
+// and the candidate payment system is linked to the payment method.
+func (s *Service) getPaymentRoutingSettings(
+	order *billingpb.Order,
+	pm *billingpb.PaymentMethod,
+	routeCandidate *internalPkg.PaymentRouteCandidate,
+) (*billingpb.PaymentMethodParams, error) {
+	settings := &billingpb.PaymentMethod{
+		ProductionSettings: routeCandidate.ProductionSettings,
+		TestSettings:       routeCandidate.TestSettings,
+	}
+
+	if routeCandidate.PaymentSystemId == pm.PaymentSystemId &&
+		len(routeCandidate.ProductionSettings) <= 0 && len(routeCandidate.TestSettings) <= 0 {
+		settings = pm
+	}
+
+	brand, err := order.GetCostPaymentMethodName()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.paymentMethod.GetPaymentSettings(
+		settings,
+		order.ChargeCurrency,
+		order.MccCode,
+		order.OperatingCompanyId,
+		brand,
+		order.IsProduction,
+	)
+}
+
+// getPaymentRoutingCost estimates payment system fee for the order in the order charge currency.
+func (s *Service) getPaymentRoutingCost(
+	ctx context.Context,
+	order *billingpb.Order,
+	cost *billingpb.PaymentChannelCostSystem,
+) (float64, error) {
+	fixAmount := cost.FixAmount
+
+	if fixAmount > 0 && cost.FixAmountCurrency != order.ChargeCurrency {
+		req := &currenciespb.ExchangeCurrencyCurrentCommonRequest{
+			From:              cost.FixAmountCurrency,
+			To:                order.ChargeCurrency,
+			RateType:          currenciespb.RateTypePaysuper,
+			ExchangeDirection: currenciespb.ExchangeDirectionBuy,
+			Amount:            fixAmount,
+		}
+		rsp, err := s.curService.ExchangeCurrencyCurrentCommon(ctx, req)
+
+		if err != nil {
+			zap.L().Error(
+				pkg.ErrorGrpcServiceCallFailed,
+				zap.Error(err),
+				zap.String(errorFieldService, "CurrencyRatesService"),
+				zap.String(errorFieldMethod, "ExchangeCurrencyCurrentCommon"),
+				zap.Any(errorFieldRequest, req),
+				zap.Any(errorFieldEntrySource, order.Id),
+			)
+
+			return 0, orderErrorConvertionCurrency
+		}
+
+		fixAmount = rsp.ExchangedAmount
+	}
+
+	return s.FormatAmount(order.ChargeAmount*cost.Percent+fixAmount, order.ChargeCurrency), nil
+}
+
+// isPaymentRoutingFailoverError checks that payment creation error caused by payment system side
+// (transport error, unavailability or decline) and payment can be routed to the next payment system.
+func isPaymentRoutingFailoverError(err error) bool {
+	e, ok := err.(*billingpb.ResponseErrorMessage)
+
+	if !ok {
+		return true
+	}
+
+	return e == paymentSystemErrorCreateRequestFailed ||
+		e == paymentSystemErrorRecurringFailed ||
+		e == paymentSystemErrorCircuitOpen
+}
+
+func getPaymentRoutingAttemptStatus(err error) string {
+	if err == nil {
+		return internalPkg.PaymentRoutingAttemptStatusSuccess
+	}
+
+	if err == paymentSystemErrorRecurringFailed {
+		return internalPkg.PaymentRoutingAttemptStatusDeclined
+	}
+
+	// other payment is the probe of payment system which circuit is half open
+	if err == paymentSystemErrorCircuitOpen {
+		return internalPkg.PaymentRoutingAttemptStatusUnavailable
+	}
+
+	return internalPkg.PaymentRoutingAttemptStatusFailed
+}
+
+// saveOrderPaymentRouting saves routing decision of the order and links it to the order by private metadata,
+// the order must be saved by caller.
+func (s *Service) saveOrderPaymentRouting(ctx context.Context, order *billingpb.Order, routing *internalPkg.OrderPaymentRouting) error {
+	routing.PaymentSystemId = order.PaymentMethod.PaymentSystemId
+	routing.Handler = order.PaymentMethod.Handler
+
+	if err := s.orderPaymentRoutingRepository.Insert(ctx, routing); err != nil {
+		zap.L().Error(
+			"payment routing of order not saved",
+			zap.Error(err),
+			zap.String("order_id", order.Id),
+			zap.String("routing_id", routing.Id),
+		)
+		return err
+	}
+
+	if order.PrivateMetadata == nil {
+		order.PrivateMetadata = make(map[string]string)
+	}
+
+	order.PrivateMetadata[orderPrivateMetadataKeyPaymentRoutingId] = routing.Id
+
+	return nil
+}
+
+// saveFailedOrderPaymentRouting saves routing decision of the order which payment wasn't created in any payment
+// system and the order with link to it, so failed routing can be found by the order.
+func (s *Service) saveFailedOrderPaymentRouting(ctx context.Context, order *billingpb.Order, routing *internalPkg.OrderPaymentRouting) error {
+	if err := s.saveOrderPaymentRouting(ctx, order, routing); err != nil {
+		return err
+	}
+
+	err := s.updateOrder(ctx, order)
+
+	if err != nil {
+		zap.L().Error("s.updateOrder Method failed", zap.Error(err), zap.Any("order", order))
+	}
+
+	return err
+}
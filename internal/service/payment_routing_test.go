@@ -0,0 +1,452 @@
+package service
+
+import (
+	"context"
+	"github.com/go-redis/redis"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/mongodb"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	"github.com/paysuper/paysuper-billing-server/internal/database"
+	"github.com/paysuper/paysuper-billing-server/internal/mocks"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	casbinMocks "github.com/paysuper/paysuper-proto/go/casbinpb/mocks"
+	reportingMocks "github.com/paysuper/paysuper-proto/go/reporterpb/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	rabbitmq "gopkg.in/ProtocolONE/rabbitmq.v1/pkg"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type PaymentRoutingTestSuite struct {
+	suite.Suite
+	service *Service
+	log     *zap.Logger
+	cache   database.CacheInterface
+
+	merchant      *billingpb.Merchant
+	project       *billingpb.Project
+	paymentMethod *billingpb.PaymentMethod
+	paymentSystem *billingpb.PaymentSystem
+}
+
+func Test_PaymentRouting(t *testing.T) {
+	suite.Run(t, new(PaymentRoutingTestSuite))
+}
+
+func (suite *PaymentRoutingTestSuite) SetupTest() {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		suite.FailNow("Config load failed", "%v", err)
+	}
+	cfg.CardPayApiUrl = "https://sandbox.cardpay.com"
+
+	m, err := migrate.New(
+		"file://../../migrations/tests",
+		cfg.MongoDsn)
+	assert.NoError(suite.T(), err, "Migrate init failed")
+
+	err = m.Up()
+	if err != nil && err.Error() != "no change" {
+		suite.FailNow("Migrations failed", "%v", err)
+	}
+
+	ctx, _ := context.WithTimeout(context.Background(), 50*time.Second)
+	opts := []mongodb.Option{mongodb.Context(ctx)}
+	db, err := mongodb.NewDatabase(opts...)
+	if err != nil {
+		suite.FailNow("Database connection failed", "%v", err)
+	}
+
+	suite.log, err = zap.NewProduction()
+
+	if err != nil {
+		suite.FailNow("Logger initialization failed", "%v", err)
+	}
+
+	broker, err := rabbitmq.NewBroker(cfg.BrokerAddress)
+
+	if err != nil {
+		suite.FailNow("Creating RabbitMQ publisher failed", "%v", err)
+	}
+
+	redisClient := database.NewRedis(
+		&redis.Options{
+			Addr:     cfg.RedisHost,
+			Password: cfg.RedisPassword,
+		},
+	)
+
+	redisdb := mocks.NewTestRedis()
+	suite.cache, err = database.NewCacheRedis(redisdb, "cache")
+	suite.service = NewBillingService(
+		db,
+		cfg,
+		mocks.NewGeoIpServiceTestOk(),
+		mocks.NewRepositoryServiceOk(),
+		mocks.NewTaxServiceOkMock(),
+		broker,
+		redisClient,
+		suite.cache,
+		mocks.NewCurrencyServiceMockOk(),
+		mocks.NewDocumentSignerMockOk(),
+		&reportingMocks.ReporterService{},
+		mocks.NewFormatterOK(),
+		mocks.NewBrokerMockOk(),
+		&casbinMocks.CasbinService{},
+	)
+
+	if err := suite.service.Init(); err != nil {
+		suite.FailNow("Billing service initialization failed", "%v", err)
+	}
+
+	suite.merchant, suite.project, suite.paymentMethod, suite.paymentSystem = helperCreateEntitiesForTests(suite.Suite, suite.service)
+}
+
+func (suite *PaymentRoutingTestSuite) TearDownTest() {
+	err := suite.service.db.Drop()
+
+	if err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	err = suite.service.db.Close()
+
+	if err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *PaymentRoutingTestSuite) TestPaymentRouting_SetPaymentRoute_Ok() {
+	ps := suite.createPaymentSystem(paymentSystemHandlerCardPayMock)
+
+	req := &internalPkg.PaymentRoute{
+		PaymentMethodId: suite.paymentMethod.Id,
+		Candidates: []*internalPkg.PaymentRouteCandidate{
+			{PaymentSystemId: suite.paymentSystem.Id, Priority: 1},
+			{PaymentSystemId: ps.Id, Priority: 2},
+		},
+		IsActive: true,
+	}
+	rsp := &internalPkg.PaymentRouteResponse{}
+	err := suite.service.SetPaymentRoute(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.NotEmpty(suite.T(), rsp.Item.Id)
+	assert.Equal(suite.T(), internalPkg.PaymentRouteStrategyCost, rsp.Item.Strategy)
+
+	rsp2 := &internalPkg.GetPaymentRoutesResponse{}
+	err = suite.service.GetPaymentRoutes(context.TODO(), &internalPkg.GetPaymentRoutesRequest{PaymentMethodId: suite.paymentMethod.Id}, rsp2)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp2.Status)
+	assert.Len(suite.T(), rsp2.Items, 1)
+	assert.Len(suite.T(), rsp2.Items[0].Candidates, 2)
+
+	rsp3 := &billingpb.ResponseError{}
+	err = suite.service.DeletePaymentRoute(context.TODO(), &internalPkg.PaymentRouteRequest{Id: rsp.Item.Id}, rsp3)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp3.Status)
+}
+
+func (suite *PaymentRoutingTestSuite) TestPaymentRouting_SetPaymentRoute_CandidatesEmpty() {
+	req := &internalPkg.PaymentRoute{PaymentMethodId: suite.paymentMethod.Id}
+	rsp := &internalPkg.PaymentRouteResponse{}
+	err := suite.service.SetPaymentRoute(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), paymentRouteErrorCandidatesEmpty, rsp.Message)
+}
+
+func (suite *PaymentRoutingTestSuite) TestPaymentRouting_SetPaymentRoute_PaymentSystemNotFound() {
+	req := &internalPkg.PaymentRoute{
+		PaymentMethodId: suite.paymentMethod.Id,
+		Candidates: []*internalPkg.PaymentRouteCandidate{
+			{PaymentSystemId: primitive.NewObjectID().Hex()},
+		},
+	}
+	rsp := &internalPkg.PaymentRouteResponse{}
+	err := suite.service.SetPaymentRoute(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), paymentRouteErrorPaymentSystemNotFound, rsp.Message)
+}
+
+func (suite *PaymentRoutingTestSuite) TestPaymentRouting_SetPaymentRoute_StrategyInvalid() {
+	req := &internalPkg.PaymentRoute{
+		PaymentMethodId: suite.paymentMethod.Id,
+		Strategy:        "random",
+		Candidates: []*internalPkg.PaymentRouteCandidate{
+			{PaymentSystemId: suite.paymentSystem.Id},
+		},
+	}
+	rsp := &internalPkg.PaymentRouteResponse{}
+	err := suite.service.SetPaymentRoute(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), paymentRouteErrorStrategyInvalid, rsp.Message)
+}
+
+func (suite *PaymentRoutingTestSuite) TestPaymentRouting_DeletePaymentRoute_NotFound() {
+	rsp := &billingpb.ResponseError{}
+	err := suite.service.DeletePaymentRoute(context.TODO(), &internalPkg.PaymentRouteRequest{Id: primitive.NewObjectID().Hex()}, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), paymentRouteErrorNotFound, rsp.Message)
+}
+
+func (suite *PaymentRoutingTestSuite) TestPaymentRouting_PaymentCreateProcess_WithoutRoute() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	assert.Equal(suite.T(), suite.paymentSystem.Id, order.PaymentMethod.PaymentSystemId)
+
+	rsp := &internalPkg.OrderPaymentRoutingResponse{}
+	err := suite.service.GetOrderPaymentRouting(context.TODO(), &billingpb.GetOrderRequest{OrderId: order.Uuid}, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Empty(suite.T(), rsp.Item.RouteId)
+	assert.Equal(suite.T(), suite.paymentSystem.Id, rsp.Item.PaymentSystemId)
+	assert.Len(suite.T(), rsp.Item.Attempts, 1)
+	assert.Equal(suite.T(), internalPkg.PaymentRoutingAttemptStatusSuccess, rsp.Item.Attempts[0].Status)
+	assert.Equal(suite.T(), rsp.Item.Id, order.PrivateMetadata[orderPrivateMetadataKeyPaymentRoutingId])
+}
+
+func (suite *PaymentRoutingTestSuite) TestPaymentRouting_PaymentCreateProcess_FailoverToNextPaymentSystem() {
+	unavailable := suite.createPaymentSystem(paymentSystemHandlerCardPayMockUnavailable)
+	route := suite.createPaymentRoute(
+		internalPkg.PaymentRouteStrategyPriority,
+		suite.getPaymentRouteCandidate(unavailable.Id, 1, "routing_unavailable"),
+		&internalPkg.PaymentRouteCandidate{PaymentSystemId: suite.paymentSystem.Id, Priority: 2},
+	)
+
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	assert.Equal(suite.T(), suite.paymentSystem.Id, order.PaymentMethod.PaymentSystemId)
+
+	routing, err := suite.service.orderPaymentRoutingRepository.GetByOrderUuid(context.TODO(), order.Uuid)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), route.Id, routing.RouteId)
+	assert.Equal(suite.T(), suite.paymentSystem.Id, routing.PaymentSystemId)
+	assert.Len(suite.T(), routing.Attempts, 2)
+	assert.Equal(suite.T(), unavailable.Id, routing.Attempts[0].PaymentSystemId)
+	assert.Equal(suite.T(), internalPkg.PaymentRoutingAttemptStatusFailed, routing.Attempts[0].Status)
+	assert.NotEmpty(suite.T(), routing.Attempts[0].Error)
+	assert.Equal(suite.T(), suite.paymentSystem.Id, routing.Attempts[1].PaymentSystemId)
+	assert.Equal(suite.T(), internalPkg.PaymentRoutingAttemptStatusSuccess, routing.Attempts[1].Status)
+}
+
+func (suite *PaymentRoutingTestSuite) TestPaymentRouting_PaymentCreateProcess_FailoverToTerminalOfNextPaymentSystem() {
+	unavailable := suite.createPaymentSystem(paymentSystemHandlerCardPayMockUnavailable)
+	reserve := suite.createPaymentSystem(paymentSystemHandlerCardPayMock)
+	suite.createPaymentRoute(
+		internalPkg.PaymentRouteStrategyPriority,
+		suite.getPaymentRouteCandidate(unavailable.Id, 1, "routing_unavailable"),
+		suite.getPaymentRouteCandidate(reserve.Id, 2, "routing_reserve"),
+	)
+
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	assert.Equal(suite.T(), reserve.Id, order.PaymentMethod.PaymentSystemId)
+	assert.Equal(suite.T(), reserve.Handler, order.PaymentMethod.Handler)
+	assert.Equal(suite.T(), "routing_reserve", order.PaymentMethod.Params.TerminalId)
+
+	routing, err := suite.service.orderPaymentRoutingRepository.GetByOrderUuid(context.TODO(), order.Uuid)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), routing.Attempts, 2)
+	assert.Equal(suite.T(), internalPkg.PaymentRoutingAttemptStatusFailed, routing.Attempts[0].Status)
+	assert.Equal(suite.T(), internalPkg.PaymentRoutingAttemptStatusSuccess, routing.Attempts[1].Status)
+}
+
+func (suite *PaymentRoutingTestSuite) TestPaymentRouting_PaymentCreateProcess_PaymentSystemWithoutSettingsSkipped() {
+	ps := suite.createPaymentSystem(paymentSystemHandlerCardPayMock)
+	suite.createPaymentRoute(
+		internalPkg.PaymentRouteStrategyPriority,
+		&internalPkg.PaymentRouteCandidate{PaymentSystemId: ps.Id, Priority: 1},
+		&internalPkg.PaymentRouteCandidate{PaymentSystemId: suite.paymentSystem.Id, Priority: 2},
+	)
+
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	assert.Equal(suite.T(), suite.paymentSystem.Id, order.PaymentMethod.PaymentSystemId)
+	assert.Equal(suite.T(), "15985", order.PaymentMethod.Params.TerminalId)
+
+	routing, err := suite.service.orderPaymentRoutingRepository.GetByOrderUuid(context.TODO(), order.Uuid)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), routing.Attempts, 2)
+	assert.Equal(suite.T(), ps.Id, routing.Attempts[0].PaymentSystemId)
+	assert.Equal(suite.T(), internalPkg.PaymentRoutingAttemptStatusNoSettings, routing.Attempts[0].Status)
+	assert.Equal(suite.T(), internalPkg.PaymentRoutingAttemptStatusSuccess, routing.Attempts[1].Status)
+}
+
+func (suite *PaymentRoutingTestSuite) TestPaymentRouting_PaymentCreateProcess_CheapestPaymentSystem() {
+	cheap := suite.createPaymentSystem(paymentSystemHandlerCardPayMock)
+	suite.createPaymentRoute(
+		internalPkg.PaymentRouteStrategyCost,
+		&internalPkg.PaymentRouteCandidate{PaymentSystemId: suite.paymentSystem.Id, Priority: 1},
+		&internalPkg.PaymentRouteCandidate{
+			PaymentSystemId:    cheap.Id,
+			Priority:           2,
+			CostMethodName:     "ROUTING_CHEAP",
+			ProductionSettings: suite.getPaymentRouteSettings(suite.paymentMethod.ProductionSettings, "routing_cheap"),
+			TestSettings:       suite.getPaymentRouteSettings(suite.paymentMethod.TestSettings, "routing_cheap"),
+		},
+	)
+
+	cost := &billingpb.PaymentChannelCostSystem{
+		Name:               "ROUTING_CHEAP",
+		Region:             billingpb.TariffRegionRussiaAndCis,
+		Country:            "RU",
+		Percent:            0.001,
+		FixAmountCurrency:  "USD",
+		IsActive:           true,
+		MccCode:            billingpb.MccCodeLowRisk,
+		OperatingCompanyId: suite.merchant.OperatingCompanyId,
+	}
+	err := suite.service.paymentChannelCostSystem.MultipleInsert(context.TODO(), []*billingpb.PaymentChannelCostSystem{cost})
+	assert.NoError(suite.T(), err)
+
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	assert.Equal(suite.T(), cheap.Id, order.PaymentMethod.PaymentSystemId)
+	assert.Equal(suite.T(), "routing_cheap", order.PaymentMethod.Params.TerminalId)
+
+	routing, err := suite.service.orderPaymentRoutingRepository.GetByOrderUuid(context.TODO(), order.Uuid)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), cheap.Id, routing.PaymentSystemId)
+	assert.Len(suite.T(), routing.Attempts, 1)
+	assert.Equal(suite.T(), internalPkg.PaymentRoutingAttemptStatusSuccess, routing.Attempts[0].Status)
+}
+
+func (suite *PaymentRoutingTestSuite) TestPaymentRouting_PaymentCreateProcess_AllPaymentSystemsFailed() {
+	unavailable := suite.createPaymentSystem(paymentSystemHandlerCardPayMockUnavailable)
+	suite.createPaymentRoute(
+		internalPkg.PaymentRouteStrategyPriority,
+		suite.getPaymentRouteCandidate(unavailable.Id, 1, "routing_unavailable"),
+	)
+
+	centrifugoMock := &mocks.CentrifugoInterface{}
+	centrifugoMock.On("GetChannelToken", mock.Anything, mock.Anything).Return("token")
+	centrifugoMock.On("Publish", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	suite.service.centrifugoPaymentForm = centrifugoMock
+
+	req := &billingpb.OrderCreateRequest{
+		Type:        pkg.OrderType_simple,
+		ProjectId:   suite.project.Id,
+		Amount:      100,
+		Currency:    "RUB",
+		Account:     "unit test",
+		Description: "unit test",
+		User: &billingpb.OrderUser{
+			Email:   "test@unit.unit",
+			Ip:      "127.0.0.1",
+			Address: &billingpb.OrderBillingAddress{Country: "RU"},
+		},
+	}
+	rsp := &billingpb.OrderCreateProcessResponse{}
+	err := suite.service.OrderCreateProcess(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	req1 := &billingpb.PaymentCreateRequest{
+		Data: map[string]string{
+			billingpb.PaymentCreateFieldOrderId:         rsp.Item.Uuid,
+			billingpb.PaymentCreateFieldPaymentMethodId: suite.paymentMethod.Id,
+			billingpb.PaymentCreateFieldEmail:           "test@unit.unit",
+			billingpb.PaymentCreateFieldPan:             "4000000000000002",
+			billingpb.PaymentCreateFieldCvv:             "123",
+			billingpb.PaymentCreateFieldMonth:           "02",
+			billingpb.PaymentCreateFieldYear:            time.Now().AddDate(1, 0, 0).Format("2006"),
+			billingpb.PaymentCreateFieldHolder:          "MR. CARD HOLDER",
+		},
+		Ip: "127.0.0.1",
+	}
+	rsp1 := &billingpb.PaymentCreateResponse{}
+	err = suite.service.PaymentCreateProcess(context.TODO(), req1, rsp1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp1.Status)
+
+	routing, err := suite.service.orderPaymentRoutingRepository.GetByOrderUuid(context.TODO(), rsp.Item.Uuid)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), routing.Attempts, 1)
+	assert.Equal(suite.T(), internalPkg.PaymentRoutingAttemptStatusFailed, routing.Attempts[0].Status)
+
+	order, err := suite.service.orderRepository.GetById(context.TODO(), rsp.Item.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), routing.Id, order.PrivateMetadata[orderPrivateMetadataKeyPaymentRoutingId])
+}
+
+func (suite *PaymentRoutingTestSuite) TestPaymentRouting_GetOrderPaymentRouting_NotFound() {
+	rsp := &internalPkg.OrderPaymentRoutingResponse{}
+	err := suite.service.GetOrderPaymentRouting(context.TODO(), &billingpb.GetOrderRequest{OrderId: "unknown"}, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), paymentRoutingErrorNotFound, rsp.Message)
+}
+
+func (suite *PaymentRoutingTestSuite) TestPaymentRouting_IsPaymentRoutingFailoverError() {
+	assert.True(suite.T(), isPaymentRoutingFailoverError(paymentSystemErrorCreateRequestFailed))
+	assert.True(suite.T(), isPaymentRoutingFailoverError(paymentSystemErrorRecurringFailed))
+	assert.False(suite.T(), isPaymentRoutingFailoverError(paymentSystemErrorEWalletIdentifierIsInvalid))
+}
+
+func (suite *PaymentRoutingTestSuite) createPaymentSystem(handler string) *billingpb.PaymentSystem {
+	ps := &billingpb.PaymentSystem{
+		Id:                 primitive.NewObjectID().Hex(),
+		Name:               "Routing " + handler,
+		AccountingCurrency: "RUB",
+		AccountingPeriod:   "every-day",
+		IsActive:           true,
+		Handler:            handler,
+	}
+	err := suite.service.paymentSystem.Insert(context.TODO(), ps)
+	assert.NoError(suite.T(), err)
+
+	return ps
+}
+
+func (suite *PaymentRoutingTestSuite) getPaymentRouteCandidate(
+	paymentSystemId string,
+	priority int32,
+	terminalId string,
+) *internalPkg.PaymentRouteCandidate {
+	return &internalPkg.PaymentRouteCandidate{
+		PaymentSystemId:    paymentSystemId,
+		Priority:           priority,
+		ProductionSettings: suite.getPaymentRouteSettings(suite.paymentMethod.ProductionSettings, terminalId),
+		TestSettings:       suite.getPaymentRouteSettings(suite.paymentMethod.TestSettings, terminalId),
+	}
+}
+
+func (suite *PaymentRoutingTestSuite) getPaymentRouteSettings(
+	settings map[string]*billingpb.PaymentMethodParams,
+	terminalId string,
+) map[string]*billingpb.PaymentMethodParams {
+	result := make(map[string]*billingpb.PaymentMethodParams, len(settings))
+
+	for k, v := range settings {
+		params := *v
+		params.TerminalId = terminalId
+		result[k] = &params
+	}
+
+	return result
+}
+
+func (suite *PaymentRoutingTestSuite) createPaymentRoute(
+	strategy string,
+	candidates ...*internalPkg.PaymentRouteCandidate,
+) *internalPkg.PaymentRoute {
+	req := &internalPkg.PaymentRoute{
+		PaymentMethodId: suite.paymentMethod.Id,
+		Strategy:        strategy,
+		Candidates:      candidates,
+		IsActive:        true,
+	}
+	rsp := &internalPkg.PaymentRouteResponse{}
+	err := suite.service.SetPaymentRoute(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	return rsp.Item
+}
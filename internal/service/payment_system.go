@@ -12,9 +12,11 @@ import (
 )
 
 const (
-	paymentSystemHandlerMockOk      = "mock_ok"
-	paymentSystemHandlerMockError   = "mock_error"
-	paymentSystemHandlerCardPayMock = "cardpay_mock"
+	paymentSystemHandlerMockOk                 = "mock_ok"
+	paymentSystemHandlerMockError              = "mock_error"
+	paymentSystemHandlerCardPayMock            = "cardpay_mock"
+	paymentSystemHandlerCardPayMockUnavailable = "cardpay_mock_unavailable"
+	paymentSystemHandlerCardPayMockTwoStep     = "cardpay_mock_two_step"
 
 	defaultHttpClientTimeout = 10
 
@@ -37,38 +39,87 @@ var (
 	paymentSystemErrorRefundRequestAmountOrCurrencyIsInvalid = newBillingServerErrorMsg("ph000012", "amount or currency from request not match with value in refund")
 	paymentSystemErrorRequestTemporarySkipped                = newBillingServerErrorMsg("ph000013", "notification skipped with temporary status")
 	paymentSystemErrorRecurringFailed                        = newBillingServerErrorMsg("ph000014", "recurring payment failed")
+	paymentSystemErrorCallbackNotSupported                   = newBillingServerErrorMsg("ph000015", "payment system doesn't support callbacks of this type")
+	paymentSystemErrorPaymentMethodNotSupported              = newBillingServerErrorMsg("ph000016", "payment method isn't supported by payment system")
+	paymentSystemErrorTwoStepNotSupported                    = newBillingServerErrorMsg("ph000020", "payment system doesn't support two-step payments")
+	paymentSystemErrorChangeStatusFailed                     = newBillingServerErrorMsg("ph000021", "payment status can't be changed in payment system")
 
-	registry = map[string]func() Gate{
-		billingpb.PaymentSystemHandlerCardPay: newCardPayHandler,
-		paymentSystemHandlerMockOk:            NewPaymentSystemMockOk,
-		paymentSystemHandlerMockError:         NewPaymentSystemMockError,
-		paymentSystemHandlerCardPayMock:       NewCardPayMock,
-	}
+	registry   = make(map[string]func() Gate)
+	registryMx sync.RWMutex
 )
 
+// Gate is the interface that must be implemented by every payment system handler.
+// Handler decodes and validates notifications of the payment system itself, so core callback processing
+// doesn't need to know anything about format of them.
 type Gate interface {
 	CreatePayment(order *billingpb.Order, successUrl, failUrl string, requisites map[string]string) (string, error)
+	// AuthorizePayment creates payment which only holds funds on customer account, funds should be charged later
+	// by CapturePayment or released by VoidPayment. Error paymentSystemErrorTwoStepNotSupported is returned
+	// if payment system or payment method doesn't support two-step payments.
+	AuthorizePayment(order *billingpb.Order, successUrl, failUrl string, requisites map[string]string) (string, error)
+	// CapturePayment charges authorized payment fully or partially, result of capture comes with payment notification.
+	CapturePayment(order *billingpb.Order, amount float64) error
+	// VoidPayment releases funds held by authorized payment.
+	VoidPayment(order *billingpb.Order) error
 	ProcessPayment(order *billingpb.Order, message proto.Message, raw, signature string) error
 	IsRecurringCallback(request proto.Message) bool
 	GetRecurringId(request proto.Message) string
 	CreateRefund(order *billingpb.Order, refund *billingpb.Refund) error
 	ProcessRefund(order *billingpb.Order, refund *billingpb.Refund, message proto.Message, raw, signature string) error
+	// DecodePaymentCallback parses raw body of payment notification and checks that it has required fields.
+	DecodePaymentCallback(raw []byte) (proto.Message, error)
+	// DecodeRefundCallback parses raw body of refund notification and checks that it has required fields.
+	DecodeRefundCallback(raw []byte) (proto.Message, error)
+	// GetRefundId returns identifier of refund in billing server from decoded refund notification.
+	GetRefundId(request proto.Message) string
+	// CheckCallbackSignature checks signature of raw payment or refund notification about payment of order.
+	CheckCallbackSignature(order *billingpb.Order, raw, signature string) error
+	// GetCallbackTransaction returns identifier of transaction in payment system and status of transaction
+	// from decoded payment or refund notification, they are used to detect repeated notifications.
+	GetCallbackTransaction(request proto.Message) (string, string)
+	// GetPaymentMethodGroups returns list of payment method groups (external identifiers of payment methods)
+	// which payment system is able to process.
+	GetPaymentMethodGroups() []string
 }
 
 type Gateway struct {
-	gateways map[string]Gate
-	mx       sync.Mutex
+	gateways   map[string]Gate
+	health     PaymentSystemHealthInterface
+	tokenStore PaymentSystemTokenStoreInterface
+	mx         sync.Mutex
+}
+
+// RegisterPaymentSystemHandler makes payment system handler available by the provided name.
+// Handler packages should call it from their init function.
+// If RegisterPaymentSystemHandler is called twice with the same name or if initFn is nil, it panics.
+func RegisterPaymentSystemHandler(name string, initFn func() Gate) {
+	registryMx.Lock()
+	defer registryMx.Unlock()
+
+	if initFn == nil {
+		panic("payment system: register handler initialization function is nil")
+	}
+
+	if _, ok := registry[name]; ok {
+		panic("payment system: register called twice for handler " + name)
+	}
+
+	registry[name] = initFn
 }
 
 func (s *Service) newPaymentSystemGateway() *Gateway {
 	paymentSystem := &Gateway{
-		gateways: make(map[string]Gate),
+		gateways:   make(map[string]Gate),
+		health:     s.paymentSystemHealth,
+		tokenStore: newPaymentSystemTokenRedisStore(s.redis),
 	}
 	return paymentSystem
 }
 
 func (m *Gateway) getGateway(name string) (Gate, error) {
+	registryMx.RLock()
 	initFn, ok := registry[name]
+	registryMx.RUnlock()
 
 	if !ok {
 		return nil, paymentSystemErrorHandlerNotFound
@@ -78,7 +129,13 @@ func (m *Gateway) getGateway(name string) (Gate, error) {
 	gateway, ok := m.gateways[name]
 
 	if !ok {
-		gateway = initFn()
+		gate := initFn()
+
+		if v, ok := gate.(paymentSystemTokenAware); ok && m.tokenStore != nil {
+			v.setTokenStore(m.tokenStore)
+		}
+
+		gateway = newHealthTrackedGate(name, gate, m.health)
 		m.gateways[name] = gateway
 	}
 
@@ -86,6 +143,16 @@ func (m *Gateway) getGateway(name string) (Gate, error) {
 	return gateway, nil
 }
 
+func isPaymentMethodGroupSupported(h Gate, group string) bool {
+	for _, v := range h.GetPaymentMethodGroups() {
+		if v == group {
+			return true
+		}
+	}
+
+	return false
+}
+
 type PaymentSystemServiceInterface interface {
 	GetById(context.Context, string) (*billingpb.PaymentSystem, error)
 	Insert(context.Context, *billingpb.PaymentSystem) error
@@ -0,0 +1,590 @@
+package service
+
+import (
+	"context"
+	"github.com/golang/protobuf/proto"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"github.com/paysuper/paysuper-proto/go/recurringpb"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	paymentSystemHealthBuckets       = 10
+	paymentSystemHealthDefaultWindow = 300
+
+	paymentSystemOperationCreatePayment = "create_payment"
+	paymentSystemOperationCreateRefund  = "create_refund"
+	paymentSystemOperationAuthorize     = "authorize_payment"
+	paymentSystemOperationCapture       = "capture_payment"
+	paymentSystemOperationVoid          = "void_payment"
+
+	paymentSystemRequestResultSuccess = "success"
+	paymentSystemRequestResultError   = "error"
+
+	paymentSystemPaymentResultApproved = "approved"
+	paymentSystemPaymentResultDeclined = "declined"
+)
+
+var (
+	paymentSystemErrorCircuitOpen    = newBillingServerErrorMsg("ph000017", "payment system is temporarily unavailable")
+	paymentSystemErrorHealthNotFound = newBillingServerErrorMsg("ph000018", "health of payment system handler not found")
+
+	paymentSystemCircuitStateValues = map[string]float64{
+		internalPkg.PaymentSystemCircuitStateClosed:   0,
+		internalPkg.PaymentSystemCircuitStateHalfOpen: 1,
+		internalPkg.PaymentSystemCircuitStateOpen:     2,
+	}
+
+	paymentSystemRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "paysuper_billing",
+			Subsystem: "payment_system",
+			Name:      "requests_total",
+			Help:      "Number of requests to payment systems API by handler, operation and result.",
+		},
+		[]string{"handler", "operation", "result"},
+	)
+	paymentSystemRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "paysuper_billing",
+			Subsystem: "payment_system",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of requests to payment systems API.",
+			Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		},
+		[]string{"handler", "operation"},
+	)
+	paymentSystemPaymentsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "paysuper_billing",
+			Subsystem: "payment_system",
+			Name:      "payments_total",
+			Help:      "Number of payments results received from payment systems by handler and result.",
+		},
+		[]string{"handler", "result"},
+	)
+	paymentSystemErrorRate = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "paysuper_billing",
+			Subsystem: "payment_system",
+			Name:      "error_rate",
+			Help:      "Rate of failed requests to payment system API over the rolling window.",
+		},
+		[]string{"handler"},
+	)
+	paymentSystemDeclineRate = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "paysuper_billing",
+			Subsystem: "payment_system",
+			Name:      "decline_rate",
+			Help:      "Rate of declined payments over the rolling window.",
+		},
+		[]string{"handler"},
+	)
+	paymentSystemCircuitState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "paysuper_billing",
+			Subsystem: "payment_system",
+			Name:      "circuit_state",
+			Help:      "State of payment system circuit breaker: 0 - closed, 1 - half open, 2 - open.",
+		},
+		[]string{"handler"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(
+		paymentSystemRequestsTotal,
+		paymentSystemRequestDuration,
+		paymentSystemPaymentsTotal,
+		paymentSystemErrorRate,
+		paymentSystemDeclineRate,
+		paymentSystemCircuitState,
+	)
+}
+
+// PaymentSystemHealthInterface tracks behaviour of payment system handlers and breaks the circuit
+// for handler when its error rate or decline rate exceeds the configured threshold.
+// Circuit which is open longer than open timeout lets the only probe payment through, the circuit is closed
+// if the probe payment is approved and opened again if request of the probe fails or the payment is declined.
+type PaymentSystemHealthInterface interface {
+	// RecordRequest registers the request to payment system API for the order with its latency and error.
+	RecordRequest(handler, orderId, operation string, latency time.Duration, err error)
+	// RecordPaymentResult registers approved or declined payment of the order.
+	RecordPaymentResult(handler, orderId string, declined bool)
+	// IsAvailable checks that payment can be made by the handler, i.e. circuit is closed or the probe payment
+	// can be made. It doesn't change state of circuit, so it's used to show payment methods and to route payments.
+	IsAvailable(handler string) bool
+	// AcquirePayment is called before the payment of the order by the handler. It moves circuit which is open longer
+	// than open timeout to half open state and reserves the probe payment for the order, false is returned while
+	// circuit is open or probe payment of other order isn't finished.
+	AcquirePayment(handler, orderId string) bool
+	// GetAll returns health of all tracked handlers.
+	GetAll() []*internalPkg.PaymentSystemHealth
+	// Reset closes circuit of the handler and clears its statistic.
+	Reset(handler string) bool
+}
+
+type paymentSystemHealthBucket struct {
+	start      int64
+	requests   int64
+	errors     int64
+	approvals  int64
+	declines   int64
+	latency    time.Duration
+	maxLatency time.Duration
+}
+
+type paymentSystemHealthState struct {
+	state    string
+	openedAt time.Time
+	buckets  [paymentSystemHealthBuckets]paymentSystemHealthBucket
+	// order of the probe payment made in half open state and time of its start
+	probeOrderId string
+	probeAt      time.Time
+}
+
+type paymentSystemHealth struct {
+	mx          sync.Mutex
+	handlers    map[string]*paymentSystemHealthState
+	window      time.Duration
+	openTimeout time.Duration
+	minRequests int64
+	errorRate   float64
+	declineRate float64
+	now         func() time.Time
+}
+
+func newPaymentSystemHealth(cfg *config.PaymentSystemConfig) PaymentSystemHealthInterface {
+	window := cfg.HealthWindow
+
+	if window < paymentSystemHealthBuckets {
+		window = paymentSystemHealthDefaultWindow
+	}
+
+	return &paymentSystemHealth{
+		handlers:    make(map[string]*paymentSystemHealthState),
+		window:      time.Duration(window) * time.Second,
+		openTimeout: time.Duration(cfg.HealthOpenTimeout) * time.Second,
+		minRequests: cfg.HealthMinRequests,
+		errorRate:   cfg.HealthErrorRate,
+		declineRate: cfg.HealthDeclineRate,
+		now:         time.Now,
+	}
+}
+
+func (s *Service) GetPaymentSystemsHealth(
+	_ context.Context,
+	req *internalPkg.PaymentSystemHealthRequest,
+	rsp *internalPkg.GetPaymentSystemsHealthResponse,
+) error {
+	for _, v := range s.paymentSystemHealth.GetAll() {
+		if req.Handler != "" && v.Handler != req.Handler {
+			continue
+		}
+
+		rsp.Items = append(rsp.Items, v)
+	}
+
+	if req.Handler != "" && len(rsp.Items) <= 0 {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = paymentSystemErrorHealthNotFound
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+
+	return nil
+}
+
+func (s *Service) ResetPaymentSystemHealth(
+	_ context.Context,
+	req *internalPkg.PaymentSystemHealthRequest,
+	rsp *billingpb.ResponseError,
+) error {
+	if !s.paymentSystemHealth.Reset(req.Handler) {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = paymentSystemErrorHealthNotFound
+		return nil
+	}
+
+	zap.L().Info("payment system circuit was reset manually", zap.String("handler", req.Handler))
+	rsp.Status = billingpb.ResponseStatusOk
+
+	return nil
+}
+
+// isPaymentSystemFailure checks that error of request to payment system API caused by payment system itself,
+// like timeout, transport error or unexpected http status, not by invalid data of payment.
+func isPaymentSystemFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	e, ok := err.(*billingpb.ResponseErrorMessage)
+
+	return !ok || e == paymentSystemErrorCreateRequestFailed || e == paymentSystemErrorChangeStatusFailed
+}
+
+func (h *paymentSystemHealth) RecordRequest(handler, orderId, operation string, latency time.Duration, err error) {
+	result := paymentSystemRequestResultSuccess
+	failed := isPaymentSystemFailure(err)
+
+	if failed {
+		result = paymentSystemRequestResultError
+	}
+
+	paymentSystemRequestsTotal.WithLabelValues(handler, operation, result).Inc()
+	paymentSystemRequestDuration.WithLabelValues(handler, operation).Observe(latency.Seconds())
+
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	state := h.getState(handler)
+	bucket := h.getBucket(state)
+	bucket.requests++
+	bucket.latency += latency
+
+	if latency > bucket.maxLatency {
+		bucket.maxLatency = latency
+	}
+
+	if failed {
+		bucket.errors++
+	}
+
+	if !h.isProbe(state, orderId) {
+		h.evaluate(handler, state)
+		return
+	}
+
+	// failed request of the probe payment means that payment system isn't recovered yet,
+	// otherwise the circuit waits for result of the probe payment
+	if failed && (operation == paymentSystemOperationCreatePayment || operation == paymentSystemOperationAuthorize) {
+		zap.L().Info("payment system probe payment failed", zap.String("handler", handler), zap.String("order_id", orderId))
+		h.open(handler, state)
+	}
+}
+
+func (h *paymentSystemHealth) RecordPaymentResult(handler, orderId string, declined bool) {
+	result := paymentSystemPaymentResultApproved
+
+	if declined {
+		result = paymentSystemPaymentResultDeclined
+	}
+
+	paymentSystemPaymentsTotal.WithLabelValues(handler, result).Inc()
+
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	state := h.getState(handler)
+	bucket := h.getBucket(state)
+
+	if declined {
+		bucket.declines++
+	} else {
+		bucket.approvals++
+	}
+
+	if !h.isProbe(state, orderId) {
+		h.evaluate(handler, state)
+		return
+	}
+
+	if declined {
+		zap.L().Info("payment system probe payment declined", zap.String("handler", handler), zap.String("order_id", orderId))
+		h.open(handler, state)
+		return
+	}
+
+	zap.L().Info("payment system circuit is closed by probe payment", zap.String("handler", handler), zap.String("order_id", orderId))
+	h.close(handler, state)
+}
+
+func (h *paymentSystemHealth) IsAvailable(handler string) bool {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	state, ok := h.handlers[handler]
+
+	return !ok || h.canMakePayment(state, "")
+}
+
+func (h *paymentSystemHealth) AcquirePayment(handler, orderId string) bool {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	state, ok := h.handlers[handler]
+
+	if !ok || state.state == internalPkg.PaymentSystemCircuitStateClosed {
+		return true
+	}
+
+	if !h.canMakePayment(state, orderId) {
+		return false
+	}
+
+	if state.probeOrderId != orderId {
+		state.probeOrderId = orderId
+		state.probeAt = h.now()
+	}
+
+	if state.state == internalPkg.PaymentSystemCircuitStateOpen {
+		state.state = internalPkg.PaymentSystemCircuitStateHalfOpen
+		paymentSystemCircuitState.WithLabelValues(handler).Set(paymentSystemCircuitStateValues[state.state])
+
+		zap.L().Info("payment system circuit is half open", zap.String("handler", handler), zap.String("order_id", orderId))
+	}
+
+	return true
+}
+
+// canMakePayment checks that payment of the order can be made in the current state of circuit. Probe payment
+// which didn't get result during open timeout is considered lost, so payment of other order can be the probe.
+func (h *paymentSystemHealth) canMakePayment(state *paymentSystemHealthState, orderId string) bool {
+	switch state.state {
+	case internalPkg.PaymentSystemCircuitStateClosed:
+		return true
+	case internalPkg.PaymentSystemCircuitStateHalfOpen:
+		return (orderId != "" && state.probeOrderId == orderId) || h.now().Sub(state.probeAt) >= h.openTimeout
+	}
+
+	return h.now().Sub(state.openedAt) >= h.openTimeout
+}
+
+func (h *paymentSystemHealth) isProbe(state *paymentSystemHealthState, orderId string) bool {
+	return state.state == internalPkg.PaymentSystemCircuitStateHalfOpen && orderId != "" && state.probeOrderId == orderId
+}
+
+func (h *paymentSystemHealth) GetAll() []*internalPkg.PaymentSystemHealth {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	result := make([]*internalPkg.PaymentSystemHealth, 0, len(h.handlers))
+
+	for handler, state := range h.handlers {
+		result = append(result, h.getSnapshot(handler, state))
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Handler < result[j].Handler
+	})
+
+	return result
+}
+
+func (h *paymentSystemHealth) Reset(handler string) bool {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	state, ok := h.handlers[handler]
+
+	if !ok {
+		return false
+	}
+
+	h.close(handler, state)
+
+	return true
+}
+
+func (h *paymentSystemHealth) getState(handler string) *paymentSystemHealthState {
+	state, ok := h.handlers[handler]
+
+	if !ok {
+		state = &paymentSystemHealthState{state: internalPkg.PaymentSystemCircuitStateClosed}
+		h.handlers[handler] = state
+	}
+
+	return state
+}
+
+// getBucket returns bucket of the rolling window for current time, outdated bucket is cleared before reuse.
+func (h *paymentSystemHealth) getBucket(state *paymentSystemHealthState) *paymentSystemHealthBucket {
+	size := int64(h.window) / paymentSystemHealthBuckets
+	start := h.now().UnixNano() / size * size
+	bucket := &state.buckets[(start/size)%paymentSystemHealthBuckets]
+
+	if bucket.start != start {
+		*bucket = paymentSystemHealthBucket{start: start}
+	}
+
+	return bucket
+}
+
+func (h *paymentSystemHealth) getSnapshot(handler string, state *paymentSystemHealthState) *internalPkg.PaymentSystemHealth {
+	var latency time.Duration
+
+	snapshot := &internalPkg.PaymentSystemHealth{
+		Handler:  handler,
+		State:    state.state,
+		OpenedAt: state.openedAt,
+	}
+	from := h.now().UnixNano() - int64(h.window)
+
+	for _, v := range state.buckets {
+		if v.start <= from {
+			continue
+		}
+
+		snapshot.Requests += v.requests
+		snapshot.Errors += v.errors
+		snapshot.Approvals += v.approvals
+		snapshot.Declines += v.declines
+		latency += v.latency
+
+		if ms := v.maxLatency.Milliseconds(); ms > snapshot.MaxLatencyMs {
+			snapshot.MaxLatencyMs = ms
+		}
+	}
+
+	if snapshot.Requests > 0 {
+		snapshot.ErrorRate = float64(snapshot.Errors) / float64(snapshot.Requests)
+		snapshot.AvgLatencyMs = latency.Milliseconds() / snapshot.Requests
+	}
+
+	if payments := snapshot.Approvals + snapshot.Declines; payments > 0 {
+		snapshot.DeclineRate = float64(snapshot.Declines) / float64(payments)
+	}
+
+	return snapshot
+}
+
+func (h *paymentSystemHealth) evaluate(handler string, state *paymentSystemHealthState) {
+	snapshot := h.getSnapshot(handler, state)
+
+	paymentSystemErrorRate.WithLabelValues(handler).Set(snapshot.ErrorRate)
+	paymentSystemDeclineRate.WithLabelValues(handler).Set(snapshot.DeclineRate)
+
+	if state.state != internalPkg.PaymentSystemCircuitStateClosed {
+		return
+	}
+
+	if (snapshot.Requests >= h.minRequests && snapshot.ErrorRate >= h.errorRate) ||
+		(snapshot.Approvals+snapshot.Declines >= h.minRequests && snapshot.DeclineRate >= h.declineRate) {
+		zap.L().Error(
+			"payment system circuit is open",
+			zap.String("handler", handler),
+			zap.Any("health", snapshot),
+		)
+		h.open(handler, state)
+	}
+}
+
+func (h *paymentSystemHealth) open(handler string, state *paymentSystemHealthState) {
+	state.state = internalPkg.PaymentSystemCircuitStateOpen
+	state.openedAt = h.now()
+	state.probeOrderId = ""
+	state.probeAt = time.Time{}
+	paymentSystemCircuitState.WithLabelValues(handler).Set(paymentSystemCircuitStateValues[state.state])
+}
+
+func (h *paymentSystemHealth) close(handler string, state *paymentSystemHealthState) {
+	state.state = internalPkg.PaymentSystemCircuitStateClosed
+	state.openedAt = time.Time{}
+	state.probeOrderId = ""
+	state.probeAt = time.Time{}
+	state.buckets = [paymentSystemHealthBuckets]paymentSystemHealthBucket{}
+	paymentSystemCircuitState.WithLabelValues(handler).Set(paymentSystemCircuitStateValues[state.state])
+	paymentSystemErrorRate.WithLabelValues(handler).Set(0)
+	paymentSystemDeclineRate.WithLabelValues(handler).Set(0)
+}
+
+// healthTrackedGate decorates payment system handler with recording of its requests and payments results,
+// new payments aren't sent to payment system while its circuit is open.
+type healthTrackedGate struct {
+	Gate
+	handler string
+	health  PaymentSystemHealthInterface
+}
+
+func newHealthTrackedGate(handler string, gate Gate, health PaymentSystemHealthInterface) Gate {
+	return &healthTrackedGate{Gate: gate, handler: handler, health: health}
+}
+
+func (g *healthTrackedGate) CreatePayment(
+	order *billingpb.Order,
+	successUrl, failUrl string,
+	requisites map[string]string,
+) (string, error) {
+	if !g.health.AcquirePayment(g.handler, order.Id) {
+		return "", paymentSystemErrorCircuitOpen
+	}
+
+	start := time.Now()
+	url, err := g.Gate.CreatePayment(order, successUrl, failUrl, requisites)
+	g.health.RecordRequest(g.handler, order.Id, paymentSystemOperationCreatePayment, time.Since(start), err)
+
+	if err == paymentSystemErrorRecurringFailed {
+		g.health.RecordPaymentResult(g.handler, order.Id, true)
+	}
+
+	return url, err
+}
+
+func (g *healthTrackedGate) AuthorizePayment(
+	order *billingpb.Order,
+	successUrl, failUrl string,
+	requisites map[string]string,
+) (string, error) {
+	if !g.health.AcquirePayment(g.handler, order.Id) {
+		return "", paymentSystemErrorCircuitOpen
+	}
+
+	start := time.Now()
+	url, err := g.Gate.AuthorizePayment(order, successUrl, failUrl, requisites)
+	g.health.RecordRequest(g.handler, order.Id, paymentSystemOperationAuthorize, time.Since(start), err)
+
+	return url, err
+}
+
+func (g *healthTrackedGate) CapturePayment(order *billingpb.Order, amount float64) error {
+	start := time.Now()
+	err := g.Gate.CapturePayment(order, amount)
+	g.health.RecordRequest(g.handler, order.Id, paymentSystemOperationCapture, time.Since(start), err)
+
+	return err
+}
+
+func (g *healthTrackedGate) VoidPayment(order *billingpb.Order) error {
+	start := time.Now()
+	err := g.Gate.VoidPayment(order)
+	g.health.RecordRequest(g.handler, order.Id, paymentSystemOperationVoid, time.Since(start), err)
+
+	return err
+}
+
+func (g *healthTrackedGate) CreateRefund(order *billingpb.Order, refund *billingpb.Refund) error {
+	start := time.Now()
+	err := g.Gate.CreateRefund(order, refund)
+	g.health.RecordRequest(g.handler, order.Id, paymentSystemOperationCreateRefund, time.Since(start), err)
+
+	return err
+}
+
+// ProcessPayment records result of the payment only when callback is processed successfully and changes
+// status of the order, so repeated callbacks and callbacks rejected by payment system handler aren't counted.
+func (g *healthTrackedGate) ProcessPayment(order *billingpb.Order, message proto.Message, raw, signature string) error {
+	status := order.PrivateStatus
+	err := g.Gate.ProcessPayment(order, message, raw, signature)
+
+	if err != nil || order.PrivateStatus == status {
+		return err
+	}
+
+	switch order.PrivateStatus {
+	case recurringpb.OrderStatusPaymentSystemComplete:
+		g.health.RecordPaymentResult(g.handler, order.Id, false)
+	case recurringpb.OrderStatusPaymentSystemDeclined:
+		g.health.RecordPaymentResult(g.handler, order.Id, true)
+	}
+
+	return err
+}
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/protobuf/proto"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	"github.com/paysuper/paysuper-billing-server/internal/mocks"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"github.com/paysuper/paysuper-proto/go/recurringpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+)
+
+type PaymentSystemHealthTestSuite struct {
+	suite.Suite
+	health *paymentSystemHealth
+	now    time.Time
+}
+
+func Test_PaymentSystemHealth(t *testing.T) {
+	suite.Run(t, new(PaymentSystemHealthTestSuite))
+}
+
+func (suite *PaymentSystemHealthTestSuite) SetupTest() {
+	cfg := &config.PaymentSystemConfig{
+		HealthWindow:      100,
+		HealthMinRequests: 4,
+		HealthErrorRate:   0.5,
+		HealthDeclineRate: 0.75,
+		HealthOpenTimeout: 30,
+	}
+	suite.now = time.Now()
+	suite.health = newPaymentSystemHealth(cfg).(*paymentSystemHealth)
+	suite.health.now = func() time.Time {
+		return suite.now
+	}
+}
+
+func (suite *PaymentSystemHealthTestSuite) TestPaymentSystemHealth_OpenByErrorRate() {
+	suite.health.RecordRequest("cardpay", "", paymentSystemOperationCreatePayment, time.Second, nil)
+	suite.health.RecordRequest("cardpay", "", paymentSystemOperationCreatePayment, time.Second, errors.New("timeout"))
+	suite.health.RecordRequest("cardpay", "", paymentSystemOperationCreatePayment, time.Second, nil)
+	assert.True(suite.T(), suite.health.IsAvailable("cardpay"))
+
+	suite.health.RecordRequest("cardpay", "", paymentSystemOperationCreatePayment, time.Second, paymentSystemErrorCreateRequestFailed)
+	assert.False(suite.T(), suite.health.IsAvailable("cardpay"))
+
+	items := suite.health.GetAll()
+	assert.Len(suite.T(), items, 1)
+	assert.Equal(suite.T(), internalPkg.PaymentSystemCircuitStateOpen, items[0].State)
+	assert.EqualValues(suite.T(), 4, items[0].Requests)
+	assert.EqualValues(suite.T(), 2, items[0].Errors)
+	assert.Equal(suite.T(), 0.5, items[0].ErrorRate)
+	assert.EqualValues(suite.T(), 1000, items[0].AvgLatencyMs)
+}
+
+func (suite *PaymentSystemHealthTestSuite) TestPaymentSystemHealth_PaymentDataErrorsNotCounted() {
+	for i := 0; i < 4; i++ {
+		suite.health.RecordRequest("cardpay", "", paymentSystemOperationCreatePayment, time.Second, paymentSystemErrorEWalletIdentifierIsInvalid)
+	}
+
+	assert.True(suite.T(), suite.health.IsAvailable("cardpay"))
+	assert.EqualValues(suite.T(), 0, suite.health.GetAll()[0].Errors)
+}
+
+func (suite *PaymentSystemHealthTestSuite) TestPaymentSystemHealth_OpenByDeclineRate() {
+	suite.health.RecordPaymentResult("cardpay", "", false)
+	suite.health.RecordPaymentResult("cardpay", "", true)
+	suite.health.RecordPaymentResult("cardpay", "", true)
+	suite.health.RecordPaymentResult("cardpay", "", true)
+	assert.False(suite.T(), suite.health.IsAvailable("cardpay"))
+	assert.Equal(suite.T(), 0.75, suite.health.GetAll()[0].DeclineRate)
+}
+
+func (suite *PaymentSystemHealthTestSuite) TestPaymentSystemHealth_HalfOpen() {
+	for i := 0; i < 4; i++ {
+		suite.health.RecordRequest("cardpay", "", paymentSystemOperationCreatePayment, time.Second, errors.New("timeout"))
+	}
+	assert.False(suite.T(), suite.health.IsAvailable("cardpay"))
+	assert.False(suite.T(), suite.health.AcquirePayment("cardpay", "order1"))
+
+	suite.now = suite.now.Add(31 * time.Second)
+	assert.True(suite.T(), suite.health.IsAvailable("cardpay"))
+	assert.Equal(suite.T(), internalPkg.PaymentSystemCircuitStateOpen, suite.health.GetAll()[0].State)
+
+	assert.True(suite.T(), suite.health.AcquirePayment("cardpay", "order1"))
+	assert.Equal(suite.T(), internalPkg.PaymentSystemCircuitStateHalfOpen, suite.health.GetAll()[0].State)
+
+	suite.health.RecordRequest("cardpay", "order1", paymentSystemOperationCreatePayment, time.Second, errors.New("timeout"))
+	assert.False(suite.T(), suite.health.IsAvailable("cardpay"))
+	assert.Equal(suite.T(), internalPkg.PaymentSystemCircuitStateOpen, suite.health.GetAll()[0].State)
+
+	suite.now = suite.now.Add(31 * time.Second)
+	assert.True(suite.T(), suite.health.AcquirePayment("cardpay", "order2"))
+
+	suite.health.RecordRequest("cardpay", "order2", paymentSystemOperationCreatePayment, time.Second, nil)
+	assert.Equal(suite.T(), internalPkg.PaymentSystemCircuitStateHalfOpen, suite.health.GetAll()[0].State)
+
+	suite.health.RecordPaymentResult("cardpay", "order2", false)
+
+	items := suite.health.GetAll()
+	assert.Equal(suite.T(), internalPkg.PaymentSystemCircuitStateClosed, items[0].State)
+	assert.EqualValues(suite.T(), 0, items[0].Requests)
+	assert.True(suite.T(), suite.health.AcquirePayment("cardpay", "order3"))
+}
+
+func (suite *PaymentSystemHealthTestSuite) TestPaymentSystemHealth_HalfOpen_SingleProbe() {
+	for i := 0; i < 4; i++ {
+		suite.health.RecordRequest("cardpay", "", paymentSystemOperationCreatePayment, time.Second, errors.New("timeout"))
+	}
+
+	suite.now = suite.now.Add(31 * time.Second)
+	assert.True(suite.T(), suite.health.AcquirePayment("cardpay", "order1"))
+	assert.True(suite.T(), suite.health.AcquirePayment("cardpay", "order1"))
+	assert.False(suite.T(), suite.health.AcquirePayment("cardpay", "order2"))
+	assert.False(suite.T(), suite.health.IsAvailable("cardpay"))
+
+	// results of payments other than the probe don't change the circuit
+	suite.health.RecordPaymentResult("cardpay", "order0", false)
+	assert.Equal(suite.T(), internalPkg.PaymentSystemCircuitStateHalfOpen, suite.health.GetAll()[0].State)
+
+	suite.health.RecordPaymentResult("cardpay", "order1", true)
+	assert.Equal(suite.T(), internalPkg.PaymentSystemCircuitStateOpen, suite.health.GetAll()[0].State)
+	assert.False(suite.T(), suite.health.AcquirePayment("cardpay", "order2"))
+}
+
+func (suite *PaymentSystemHealthTestSuite) TestPaymentSystemHealth_HalfOpen_LostProbe() {
+	for i := 0; i < 4; i++ {
+		suite.health.RecordRequest("cardpay", "", paymentSystemOperationCreatePayment, time.Second, errors.New("timeout"))
+	}
+
+	suite.now = suite.now.Add(31 * time.Second)
+	assert.True(suite.T(), suite.health.AcquirePayment("cardpay", "order1"))
+	suite.health.RecordRequest("cardpay", "order1", paymentSystemOperationCreatePayment, time.Second, nil)
+	assert.False(suite.T(), suite.health.AcquirePayment("cardpay", "order2"))
+
+	suite.now = suite.now.Add(31 * time.Second)
+	assert.True(suite.T(), suite.health.IsAvailable("cardpay"))
+	assert.True(suite.T(), suite.health.AcquirePayment("cardpay", "order2"))
+	assert.False(suite.T(), suite.health.AcquirePayment("cardpay", "order1"))
+}
+
+func (suite *PaymentSystemHealthTestSuite) TestPaymentSystemHealth_RollingWindow() {
+	suite.health.RecordRequest("cardpay", "", paymentSystemOperationCreatePayment, time.Second, errors.New("timeout"))
+	suite.health.RecordRequest("cardpay", "", paymentSystemOperationCreatePayment, time.Second, errors.New("timeout"))
+	suite.health.RecordRequest("cardpay", "", paymentSystemOperationCreatePayment, time.Second, errors.New("timeout"))
+
+	suite.now = suite.now.Add(101 * time.Second)
+	suite.health.RecordRequest("cardpay", "", paymentSystemOperationCreatePayment, time.Second, errors.New("timeout"))
+
+	assert.True(suite.T(), suite.health.IsAvailable("cardpay"))
+	assert.EqualValues(suite.T(), 1, suite.health.GetAll()[0].Requests)
+}
+
+func (suite *PaymentSystemHealthTestSuite) TestPaymentSystemHealth_Reset() {
+	assert.False(suite.T(), suite.health.Reset("cardpay"))
+
+	for i := 0; i < 4; i++ {
+		suite.health.RecordRequest("cardpay", "", paymentSystemOperationCreatePayment, time.Second, errors.New("timeout"))
+	}
+	assert.False(suite.T(), suite.health.IsAvailable("cardpay"))
+
+	assert.True(suite.T(), suite.health.Reset("cardpay"))
+	assert.True(suite.T(), suite.health.IsAvailable("cardpay"))
+}
+
+func (suite *PaymentSystemHealthTestSuite) TestPaymentSystemHealth_TrackedGate() {
+	ps := &mocks.PaymentSystem{}
+	ps.On("CreatePayment", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return("", paymentSystemErrorRecurringFailed)
+	ps.On("ProcessPayment", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(
+			func(order *billingpb.Order, message proto.Message, raw, signature string) error {
+				order.PrivateStatus = recurringpb.OrderStatusPaymentSystemComplete
+				return nil
+			},
+		)
+
+	h := newHealthTrackedGate("cardpay", ps, suite.health)
+	_, err := h.CreatePayment(&billingpb.Order{Id: "order1"}, "", "", nil)
+	assert.Equal(suite.T(), paymentSystemErrorRecurringFailed, err)
+
+	items := suite.health.GetAll()
+	assert.Len(suite.T(), items, 1)
+	assert.EqualValues(suite.T(), 1, items[0].Requests)
+	assert.EqualValues(suite.T(), 0, items[0].Errors)
+	assert.EqualValues(suite.T(), 1, items[0].Declines)
+
+	order := &billingpb.Order{Id: "order1", PrivateStatus: recurringpb.OrderStatusPaymentSystemCreate}
+	err = h.ProcessPayment(order, nil, "", "")
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), 1, suite.health.GetAll()[0].Approvals)
+
+	// repeated callback doesn't change status of order
+	err = h.ProcessPayment(order, nil, "", "")
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), 1, suite.health.GetAll()[0].Approvals)
+}
+
+func (suite *PaymentSystemHealthTestSuite) TestPaymentSystemHealth_TrackedGate_ProcessPaymentError() {
+	ps := &mocks.PaymentSystem{}
+	ps.On("ProcessPayment", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(
+			func(order *billingpb.Order, message proto.Message, raw, signature string) error {
+				order.PrivateStatus = recurringpb.OrderStatusPaymentSystemDeclined
+				return newBillingServerResponseError(pkg.StatusErrorValidation, paymentSystemErrorRequestSignatureIsInvalid)
+			},
+		)
+
+	h := newHealthTrackedGate("cardpay", ps, suite.health)
+	err := h.ProcessPayment(&billingpb.Order{Id: "order1"}, nil, "", "")
+	assert.Error(suite.T(), err)
+	assert.Empty(suite.T(), suite.health.GetAll())
+}
+
+func (suite *PaymentSystemHealthTestSuite) TestPaymentSystemHealth_TrackedGate_CircuitOpen() {
+	ps := &mocks.PaymentSystem{}
+	h := newHealthTrackedGate("cardpay", ps, suite.health)
+
+	for i := 0; i < 4; i++ {
+		suite.health.RecordRequest("cardpay", "", paymentSystemOperationCreatePayment, time.Second, errors.New("timeout"))
+	}
+
+	_, err := h.CreatePayment(&billingpb.Order{Id: "order1"}, "", "", nil)
+	assert.Equal(suite.T(), paymentSystemErrorCircuitOpen, err)
+	ps.AssertNotCalled(suite.T(), "CreatePayment", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *PaymentSystemHealthTestSuite) TestPaymentSystemHealth_GetPaymentSystemsHealth() {
+	s := &Service{paymentSystemHealth: suite.health}
+	suite.health.RecordRequest("cardpay", "", paymentSystemOperationCreatePayment, time.Second, nil)
+
+	rsp := &internalPkg.GetPaymentSystemsHealthResponse{}
+	err := s.GetPaymentSystemsHealth(context.TODO(), &internalPkg.PaymentSystemHealthRequest{}, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Len(suite.T(), rsp.Items, 1)
+
+	rsp = &internalPkg.GetPaymentSystemsHealthResponse{}
+	err = s.GetPaymentSystemsHealth(context.TODO(), &internalPkg.PaymentSystemHealthRequest{Handler: "unknown"}, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), paymentSystemErrorHealthNotFound, rsp.Message)
+}
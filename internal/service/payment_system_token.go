@@ -0,0 +1,176 @@
+package service
+
+import (
+	"fmt"
+	"github.com/go-redis/redis"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+const (
+	paymentSystemTokenStorageKey = "payment_system:token:%s"
+	paymentSystemTokenLockKey    = "payment_system:token:lock:%s"
+
+	// compare and delete, so lock expired by ttl and acquired by other owner won't be released
+	paymentSystemTokenUnlockScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+)
+
+var (
+	paymentSystemErrorTokenNotFound = newBillingServerErrorMsg("ph000019", "payment system token not found")
+)
+
+// PaymentSystemTokenStoreInterface is a storage of payment system API tokens shared between instances of billing server.
+type PaymentSystemTokenStoreInterface interface {
+	// Get returns token by key, error paymentSystemErrorTokenNotFound is returned if token not exists or expired.
+	Get(key string) ([]byte, error)
+	// Set saves token by key, token becomes unavailable after the expire duration.
+	Set(key string, value []byte, expire time.Duration) error
+	// Lock tries to acquire lock of key for the owner and returns false if lock is held by other owner.
+	// Lock is released automatically after the ttl to not block other instances if owner died.
+	Lock(key, owner string, ttl time.Duration) (bool, error)
+	// Unlock releases lock of key if it's still held by the owner.
+	Unlock(key, owner string) error
+}
+
+// paymentSystemTokenAware is implemented by payment system handlers which use tokens of payment system API,
+// gateway provides shared token store to them on initialization.
+type paymentSystemTokenAware interface {
+	setTokenStore(store PaymentSystemTokenStoreInterface)
+}
+
+type paymentSystemTokenRedisStore struct {
+	redis redis.Cmdable
+}
+
+type paymentSystemTokenMemoryStore struct {
+	mx     sync.Mutex
+	tokens map[string]*paymentSystemTokenMemoryItem
+	locks  map[string]*paymentSystemTokenMemoryItem
+}
+
+type paymentSystemTokenMemoryItem struct {
+	value    []byte
+	expireAt time.Time
+}
+
+func newPaymentSystemTokenRedisStore(redis redis.Cmdable) PaymentSystemTokenStoreInterface {
+	return &paymentSystemTokenRedisStore{redis: redis}
+}
+
+// newPaymentSystemTokenMemoryStore returns store which keeps tokens in memory of process,
+// it's used by handlers created out of gateway.
+func newPaymentSystemTokenMemoryStore() PaymentSystemTokenStoreInterface {
+	return &paymentSystemTokenMemoryStore{
+		tokens: make(map[string]*paymentSystemTokenMemoryItem),
+		locks:  make(map[string]*paymentSystemTokenMemoryItem),
+	}
+}
+
+func (s *paymentSystemTokenRedisStore) Get(key string) ([]byte, error) {
+	b, err := s.redis.Get(fmt.Sprintf(paymentSystemTokenStorageKey, key)).Bytes()
+
+	if err != nil {
+		if err != redis.Nil {
+			zap.L().Error(
+				"Get payment system token from Redis failed",
+				zap.Error(err),
+				zap.String("key", key),
+			)
+		}
+
+		return nil, paymentSystemErrorTokenNotFound
+	}
+
+	return b, nil
+}
+
+func (s *paymentSystemTokenRedisStore) Set(key string, value []byte, expire time.Duration) error {
+	err := s.redis.Set(fmt.Sprintf(paymentSystemTokenStorageKey, key), value, expire).Err()
+
+	if err != nil {
+		zap.L().Error(
+			"Save payment system token to Redis failed",
+			zap.Error(err),
+			zap.String("key", key),
+		)
+	}
+
+	return err
+}
+
+func (s *paymentSystemTokenRedisStore) Lock(key, owner string, ttl time.Duration) (bool, error) {
+	ok, err := s.redis.SetNX(fmt.Sprintf(paymentSystemTokenLockKey, key), owner, ttl).Result()
+
+	if err != nil {
+		zap.L().Error(
+			"Acquire payment system token lock in Redis failed",
+			zap.Error(err),
+			zap.String("key", key),
+		)
+		return false, err
+	}
+
+	return ok, nil
+}
+
+func (s *paymentSystemTokenRedisStore) Unlock(key, owner string) error {
+	err := s.redis.Eval(paymentSystemTokenUnlockScript, []string{fmt.Sprintf(paymentSystemTokenLockKey, key)}, owner).Err()
+
+	if err != nil && err != redis.Nil {
+		zap.L().Error(
+			"Release payment system token lock in Redis failed",
+			zap.Error(err),
+			zap.String("key", key),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (s *paymentSystemTokenMemoryStore) Get(key string) ([]byte, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	item, ok := s.tokens[key]
+
+	if !ok || !item.expireAt.After(time.Now()) {
+		return nil, paymentSystemErrorTokenNotFound
+	}
+
+	return item.value, nil
+}
+
+func (s *paymentSystemTokenMemoryStore) Set(key string, value []byte, expire time.Duration) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.tokens[key] = &paymentSystemTokenMemoryItem{value: value, expireAt: time.Now().Add(expire)}
+
+	return nil
+}
+
+func (s *paymentSystemTokenMemoryStore) Lock(key, owner string, ttl time.Duration) (bool, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if item, ok := s.locks[key]; ok && item.expireAt.After(time.Now()) {
+		return false, nil
+	}
+
+	s.locks[key] = &paymentSystemTokenMemoryItem{value: []byte(owner), expireAt: time.Now().Add(ttl)}
+
+	return true, nil
+}
+
+func (s *paymentSystemTokenMemoryStore) Unlock(key, owner string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if item, ok := s.locks[key]; ok && string(item.value) == owner {
+		delete(s.locks, key)
+	}
+
+	return nil
+}
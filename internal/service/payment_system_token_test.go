@@ -0,0 +1,95 @@
+package service
+
+import (
+	"github.com/paysuper/paysuper-billing-server/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+)
+
+type PaymentSystemTokenStoreTestSuite struct {
+	suite.Suite
+	stores map[string]PaymentSystemTokenStoreInterface
+}
+
+func Test_PaymentSystemTokenStore(t *testing.T) {
+	suite.Run(t, new(PaymentSystemTokenStoreTestSuite))
+}
+
+func (suite *PaymentSystemTokenStoreTestSuite) SetupTest() {
+	suite.stores = map[string]PaymentSystemTokenStoreInterface{
+		"redis":  newPaymentSystemTokenRedisStore(mocks.NewTestRedis()),
+		"memory": newPaymentSystemTokenMemoryStore(),
+	}
+}
+
+func (suite *PaymentSystemTokenStoreTestSuite) TestPaymentSystemTokenStore_SetGet_Ok() {
+	for name, store := range suite.stores {
+		err := store.Set("cardpay:123456", []byte("token"), time.Minute)
+		assert.NoError(suite.T(), err, name)
+
+		b, err := store.Get("cardpay:123456")
+		assert.NoError(suite.T(), err, name)
+		assert.Equal(suite.T(), []byte("token"), b, name)
+	}
+}
+
+func (suite *PaymentSystemTokenStoreTestSuite) TestPaymentSystemTokenStore_Get_NotFound() {
+	for name, store := range suite.stores {
+		b, err := store.Get("cardpay:123456")
+		assert.Equal(suite.T(), paymentSystemErrorTokenNotFound, err, name)
+		assert.Nil(suite.T(), b, name)
+	}
+}
+
+func (suite *PaymentSystemTokenStoreTestSuite) TestPaymentSystemTokenStore_Get_Expired() {
+	store := suite.stores["memory"]
+	err := store.Set("cardpay:123456", []byte("token"), time.Millisecond)
+	assert.NoError(suite.T(), err)
+
+	time.Sleep(2 * time.Millisecond)
+
+	_, err = store.Get("cardpay:123456")
+	assert.Equal(suite.T(), paymentSystemErrorTokenNotFound, err)
+}
+
+func (suite *PaymentSystemTokenStoreTestSuite) TestPaymentSystemTokenStore_Lock_Ok() {
+	for name, store := range suite.stores {
+		ok, err := store.Lock("cardpay:123456", "owner1", time.Minute)
+		assert.NoError(suite.T(), err, name)
+		assert.True(suite.T(), ok, name)
+
+		ok, err = store.Lock("cardpay:123456", "owner2", time.Minute)
+		assert.NoError(suite.T(), err, name)
+		assert.False(suite.T(), ok, name)
+
+		// lock can't be released by other owner
+		err = store.Unlock("cardpay:123456", "owner2")
+		assert.NoError(suite.T(), err, name)
+
+		ok, err = store.Lock("cardpay:123456", "owner2", time.Minute)
+		assert.NoError(suite.T(), err, name)
+		assert.False(suite.T(), ok, name)
+
+		err = store.Unlock("cardpay:123456", "owner1")
+		assert.NoError(suite.T(), err, name)
+
+		ok, err = store.Lock("cardpay:123456", "owner2", time.Minute)
+		assert.NoError(suite.T(), err, name)
+		assert.True(suite.T(), ok, name)
+	}
+}
+
+func (suite *PaymentSystemTokenStoreTestSuite) TestPaymentSystemTokenStore_Lock_Expired() {
+	store := suite.stores["memory"]
+	ok, err := store.Lock("cardpay:123456", "owner1", time.Millisecond)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	time.Sleep(2 * time.Millisecond)
+
+	ok, err = store.Lock("cardpay:123456", "owner2", time.Minute)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+}
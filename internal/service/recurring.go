@@ -89,6 +89,8 @@ func (s *Service) DeleteSavedCard(
 		return nil
 	}
 
+	_ = s.savedPaymentMethodRepository.Delete(ctx, req.Id)
+
 	rsp.Status = billingpb.ResponseStatusOk
 
 	return nil
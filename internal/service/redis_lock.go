@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	redisLockUnlockScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+	redisLockWaitInterval = 100 * time.Millisecond
+)
+
+// acquireRedisLock acquires lock by the key in Redis and returns function which releases the lock. Lock is waited
+// for the wait timeout or until context is done, false is returned if lock wasn't acquired in this time.
+// Lock is held no longer than ttl, so ttl must cover the longest work done under the lock.
+func (s *Service) acquireRedisLock(
+	ctx context.Context,
+	key string,
+	ttl, waitTimeout time.Duration,
+) (func(), bool, error) {
+	owner := uuid.New().String()
+	deadline := time.Now().Add(waitTimeout)
+
+	for {
+		ok, err := s.redis.SetNX(key, owner, ttl).Result()
+
+		if err != nil {
+			zap.L().Error(
+				"Acquire lock in Redis failed",
+				zap.Error(err),
+				zap.String("key", key),
+			)
+			return nil, false, err
+		}
+
+		if ok {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			return nil, false, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, false, nil
+		case <-time.After(redisLockWaitInterval):
+		}
+	}
+
+	return func() {
+		err := s.redis.Eval(redisLockUnlockScript, []string{key}, owner).Err()
+
+		if err != nil && err != redis.Nil {
+			zap.L().Error(
+				"Release lock in Redis failed",
+				zap.Error(err),
+				zap.String("key", key),
+			)
+		}
+	}, true, nil
+}
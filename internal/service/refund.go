@@ -2,23 +2,29 @@ package service
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	protobuf "github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 	"github.com/google/uuid"
 	"github.com/jinzhu/copier"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
 	"github.com/paysuper/paysuper-billing-server/pkg"
 	"github.com/paysuper/paysuper-proto/go/billingpb"
 	"github.com/paysuper/paysuper-proto/go/recurringpb"
 	tools "github.com/paysuper/paysuper-tools/number"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.uber.org/zap"
 	"time"
 )
 
 const (
 	refundDefaultReasonMask = "Refund by order #%s"
+	refundOrderLockKey      = "refund_order_lock:%s"
+
+	// lock of refunds of order is held while refund is created in payment system, so it's held and waited
+	// longer than request to payment system lasts
+	refundOrderLockTtl         = 2 * time.Minute
+	refundOrderLockWaitTimeout = (defaultHttpClientTimeout + 5) * time.Second
 )
 
 var (
@@ -29,15 +35,22 @@ var (
 	refundErrorNotFound           = newBillingServerErrorMsg("rf000005", "refund with specified data not found")
 	refundErrorOrderNotFound      = newBillingServerErrorMsg("rf000006", "information about payment for refund with specified data not found")
 	refundErrorCostsRatesNotFound = newBillingServerErrorMsg("rf000007", "settings to calculate commissions for refund not found")
+	refundErrorItemsEmpty         = newBillingServerErrorMsg("rf000008", "items of order to refund not specified")
+	refundErrorItemNotFound       = newBillingServerErrorMsg("rf000009", "item to refund not found in order")
+	refundErrorItemQuantity       = newBillingServerErrorMsg("rf000010", "quantity of item to refund greater than quantity of not refunded items in order")
+	refundErrorOrderLocked        = newBillingServerErrorMsg("rf000011", "refund of order is creating by other process now. try request later")
 )
 
 type createRefundChecked struct {
-	order *billingpb.Order
+	order  *billingpb.Order
+	items  []*internalPkg.RefundedOrderItem
+	amount float64
 }
 
 type createRefundProcessor struct {
 	service *Service
 	request *billingpb.CreateRefundRequest
+	items   []*internalPkg.RefundItemRequest
 	checked *createRefundChecked
 	ctx     context.Context
 }
@@ -54,47 +67,113 @@ func (s *Service) CreateRefund(
 		ctx:     ctx,
 	}
 
-	refund, err := processor.processCreateRefund()
+	refund, err := s.createRefund(processor)
 
 	if err != nil {
-		rsp.Status = err.(*billingpb.ResponseError).Status
-		rsp.Message = err.(*billingpb.ResponseError).Message
+		if e, ok := err.(*billingpb.ResponseError); ok {
+			rsp.Status = e.Status
+			rsp.Message = e.Message
+			return nil
+		}
+		return err
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = refund
+
+	return nil
+}
+
+// CreateItemsRefund refunds the items of order, amount of refund is a part of order charge amount proportional
+// to the prices of refunded items. Keys of the key products are revoked after the refund is completed.
+func (s *Service) CreateItemsRefund(
+	ctx context.Context,
+	req *internalPkg.CreateItemsRefundRequest,
+	rsp *internalPkg.CreateItemsRefundResponse,
+) error {
+	if len(req.Items) <= 0 {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = refundErrorItemsEmpty
 
 		return nil
 	}
 
-	h, err := s.paymentSystemGateway.getGateway(processor.checked.order.PaymentMethod.Handler)
+	processor := &createRefundProcessor{
+		service: s,
+		request: &billingpb.CreateRefundRequest{
+			OrderId:    req.OrderId,
+			MerchantId: req.MerchantId,
+			CreatorId:  req.CreatorId,
+			Reason:     req.Reason,
+		},
+		items:   req.Items,
+		checked: &createRefundChecked{},
+		ctx:     ctx,
+	}
+
+	refund, err := s.createRefund(processor)
 
 	if err != nil {
-		zap.S().Errorw(pkg.MethodFinishedWithError, "err", err)
-		if e, ok := err.(*billingpb.ResponseErrorMessage); ok {
-			rsp.Status = billingpb.ResponseStatusBadData
-			rsp.Message = e
+		if e, ok := err.(*billingpb.ResponseError); ok {
+			rsp.Status = e.Status
+			rsp.Message = e.Message
 			return nil
 		}
 		return err
 	}
 
-	err = h.CreateRefund(processor.checked.order, refund)
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = refund
+	rsp.Items = processor.checked.items
+
+	return nil
+}
+
+// createRefund creates refund by the request of processor and sends it to the payment system. Refund is held
+// until approval if it matches approval policy of merchant.
+func (s *Service) createRefund(processor *createRefundProcessor) (*billingpb.Refund, error) {
+	refund, err := processor.processCreateRefund()
 
 	if err != nil {
-		rsp.Status = billingpb.ResponseStatusBadData
-		rsp.Message = refundErrorUnknown
+		return nil, err
+	}
 
-		return nil
+	held, err := s.holdRefundForApproval(processor.ctx, processor.checked.order, refund)
+
+	if err != nil {
+		return nil, err
 	}
 
-	if err = s.refundRepository.Update(ctx, refund); err != nil {
-		rsp.Status = billingpb.ResponseStatusBadData
-		rsp.Message = orderErrorUnknown
+	if held {
+		return refund, nil
+	}
 
-		return nil
+	return s.sendRefund(processor.ctx, processor.checked.order, refund)
+}
+
+// sendRefund sends the refund to the payment system of order.
+func (s *Service) sendRefund(ctx context.Context, order *billingpb.Order, refund *billingpb.Refund) (*billingpb.Refund, error) {
+	h, err := s.paymentSystemGateway.getGateway(order.PaymentMethod.Handler)
+
+	if err != nil {
+		zap.S().Errorw(pkg.MethodFinishedWithError, "err", err)
+		if e, ok := err.(*billingpb.ResponseErrorMessage); ok {
+			return nil, newBillingServerResponseError(billingpb.ResponseStatusBadData, e)
+		}
+		return nil, err
 	}
 
-	rsp.Status = billingpb.ResponseStatusOk
-	rsp.Item = refund
+	err = h.CreateRefund(order, refund)
 
-	return nil
+	if err != nil {
+		return nil, newBillingServerResponseError(billingpb.ResponseStatusBadData, refundErrorUnknown)
+	}
+
+	if err = s.refundRepository.Update(ctx, refund); err != nil {
+		return nil, newBillingServerResponseError(billingpb.ResponseStatusBadData, orderErrorUnknown)
+	}
+
+	return refund, nil
 }
 
 func (s *Service) ListRefunds(
@@ -175,31 +254,48 @@ func (s *Service) ProcessRefundCallback(
 	req *billingpb.CallbackRequest,
 	rsp *billingpb.PaymentNotifyResponse,
 ) error {
-	var data protobuf.Message
-	var refundId string
+	entry := s.newCallbackJournalEntry(ctx, internalPkg.CallbackJournalTypeRefund, req.Handler, req.Body, req.Signature)
 
-	switch req.Handler {
-	case billingpb.PaymentSystemHandlerCardPay:
-		data = &billingpb.CardPayRefundCallback{}
-		err := json.Unmarshal(req.Body, &data)
+	err := s.processRefundCallback(ctx, req, rsp, entry, false)
+	s.finishCallbackJournalEntry(ctx, entry, rsp, err)
 
-		if err != nil ||
-			data.(*billingpb.CardPayRefundCallback).RefundData == nil {
-			rsp.Status = billingpb.ResponseStatusBadData
-			rsp.Error = callbackRequestIncorrect
+	return err
+}
 
-			return nil
-		}
+// processRefundCallback processes refund notification of payment system, identifiers of refund and order
+// are saved to the entry of callbacks journal. Accounting entries aren't created again on replay of callback.
+func (s *Service) processRefundCallback(
+	ctx context.Context,
+	req *billingpb.CallbackRequest,
+	rsp *billingpb.PaymentNotifyResponse,
+	entry *internalPkg.CallbackJournalEntry,
+	replay bool,
+) (err error) {
+	ch, err := s.paymentSystemGateway.getGateway(req.Handler)
 
-		refundId = data.(*billingpb.CardPayRefundCallback).MerchantOrder.Id
-		break
-	default:
+	if err != nil {
 		rsp.Status = billingpb.ResponseStatusBadData
 		rsp.Error = callbackHandlerIncorrect
 
 		return nil
 	}
 
+	data, err := ch.DecodeRefundCallback(req.Body)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Error = callbackRequestIncorrect
+
+		if err == paymentSystemErrorCallbackNotSupported {
+			rsp.Error = callbackHandlerIncorrect
+		}
+
+		return nil
+	}
+
+	refundId := ch.GetRefundId(data)
+	entry.RefundId = refundId
+
 	refund, err := s.refundRepository.GetById(ctx, refundId)
 
 	if err != nil {
@@ -209,6 +305,7 @@ func (s *Service) ProcessRefundCallback(
 		return nil
 	}
 
+	entry.OrderId = refund.OriginalOrder.Id
 	order, err := s.getOrderById(ctx, refund.OriginalOrder.Id)
 
 	if err != nil {
@@ -232,7 +329,48 @@ func (s *Service) ProcessRefundCallback(
 		return nil
 	}
 
+	// notification with invalid signature must not claim transaction
+	if sErr := h.CheckCallbackSignature(order, string(req.Body), req.Signature); sErr != nil {
+		if e, ok := sErr.(*billingpb.ResponseError); ok {
+			rsp.Status = e.Status
+			rsp.Error = e.Error()
+			return nil
+		}
+		return sErr
+	}
+
+	transactionId, status := ch.GetCallbackTransaction(data)
+	tx, err := s.claimCallbackTransaction(ctx, entry, req.Handler, transactionId, status)
+
+	if err != nil {
+		s.setCallbackTransactionResponse(entry, tx, rsp, err)
+		return nil
+	}
+
+	isFinal := false
+	defer func() {
+		s.finishCallbackTransaction(ctx, tx, rsp, err, isFinal)
+	}()
+
+	// refund and order could be changed by notification processed while transaction was claimed
+	if tx != nil {
+		if refund, err = s.refundRepository.GetById(ctx, refundId); err != nil {
+			rsp.Status = billingpb.ResponseStatusNotFound
+			rsp.Error = refundErrorNotFound.Error()
+
+			return nil
+		}
+
+		if order, err = s.getOrderById(ctx, refund.OriginalOrder.Id); err != nil {
+			rsp.Status = billingpb.ResponseStatusNotFound
+			rsp.Error = refundErrorOrderNotFound.Error()
+
+			return nil
+		}
+	}
+
 	pErr := h.ProcessRefund(order, refund, data, string(req.Body), req.Signature)
+	isFinal = refundFinalStatuses[refund.Status]
 
 	if pErr != nil {
 		rsp.Error = pErr.Error()
@@ -308,14 +446,14 @@ func (s *Service) ProcessRefundCallback(
 				ReceiptNumber: refund.Id,
 			}
 
-			err = s.updateOrder(ctx, order)
+			err = s.updateOrderWithCause(ctx, order, internalPkg.OrderStatusEventCauseRefundCallback)
 
 			if err != nil {
 				zap.S().Errorf("Update order data failed", "err", err.Error(), "order", order)
 			}
 		}
 
-		err = s.onRefundNotify(ctx, refund, order)
+		err = s.processRefundAccounting(ctx, refund, order, replay)
 
 		if err != nil {
 			zap.L().Error(
@@ -332,6 +470,10 @@ func (s *Service) ProcessRefundCallback(
 			return nil
 		}
 
+		if refund.Status == pkg.RefundStatusCompleted {
+			s.revokeRefundedKeys(ctx, order, refund, refundedAmount == order.ChargeAmount)
+		}
+
 		s.sendMailWithReceipt(ctx, refundOrder)
 
 		rsp.Status = billingpb.ResponseStatusOk
@@ -354,6 +496,22 @@ func (s *Service) createOrderByRefund(ctx context.Context, order *billingpb.Orde
 		return nil, refundErrorUnknown
 	}
 
+	refundItems, err := s.refundItemsRepository.GetByRefundId(ctx, refund.Id)
+
+	if err != nil && err != mongo.ErrNoDocuments {
+		zap.L().Error(
+			pkg.MethodFinishedWithError,
+			zap.String("method", "GetByRefundId"),
+			zap.Error(err),
+			zap.String("refundId", refund.Id),
+		)
+		return nil, refundErrorUnknown
+	}
+
+	if refundItems != nil {
+		setRefundOrderItems(refundOrder, order, refundItems)
+	}
+
 	country, err := s.country.GetByIsoCodeA2(ctx, order.GetCountry())
 	if err != nil {
 		zap.S().Error(
@@ -434,28 +592,21 @@ func (s *Service) createOrderByRefund(ctx context.Context, order *billingpb.Orde
 }
 
 func (p *createRefundProcessor) processCreateRefund() (*billingpb.Refund, error) {
-	err := p.processOrder()
+	unlock, err := p.lockOrder()
 
 	if err != nil {
 		return nil, err
 	}
 
-	if !p.hasMoneyBackCosts(p.ctx, p.checked.order) {
-		return nil, newBillingServerResponseError(billingpb.ResponseStatusBadData, refundErrorCostsRatesNotFound)
-	}
+	defer unlock()
 
-	err = p.processRefundsByOrder()
+	err = p.validate()
 
 	if err != nil {
 		return nil, err
 	}
 
 	order := p.checked.order
-
-	if order.GetMerchantId() != p.request.MerchantId {
-		return nil, newBillingServerResponseError(billingpb.ResponseStatusBadData, refundErrorOrderNotFound)
-	}
-
 	refund := &billingpb.Refund{
 		Id: primitive.NewObjectID().Hex(),
 		OriginalOrder: &billingpb.RefundOrder{
@@ -490,13 +641,76 @@ func (p *createRefundProcessor) processCreateRefund() (*billingpb.Refund, error)
 		refund.Reason = p.request.Reason
 	}
 
+	if len(p.checked.items) > 0 {
+		refund.Amount = p.checked.amount
+	}
+
 	if err = p.service.refundRepository.Insert(p.ctx, refund); err != nil {
 		return nil, newBillingServerResponseError(billingpb.ResponseStatusBadData, orderErrorUnknown)
 	}
 
+	if len(p.checked.items) > 0 {
+		refundItems := &internalPkg.RefundItems{
+			Id:        refund.Id,
+			OrderId:   order.Id,
+			Items:     p.checked.items,
+			CreatedAt: time.Now().UTC(),
+		}
+
+		if err = p.service.refundItemsRepository.Insert(p.ctx, refundItems); err != nil {
+			return nil, newBillingServerResponseError(billingpb.ResponseStatusBadData, orderErrorUnknown)
+		}
+	}
+
 	return refund, nil
 }
 
+// lockOrder acquires lock of refunds creation for the order of request, so check of amount and items refunded
+// by other refunds of the order and insert of the new refund aren't interleaved with other refund of the same order.
+func (p *createRefundProcessor) lockOrder() (func(), error) {
+	unlock, ok, err := p.service.acquireRedisLock(
+		p.ctx,
+		fmt.Sprintf(refundOrderLockKey, p.request.OrderId),
+		refundOrderLockTtl,
+		refundOrderLockWaitTimeout,
+	)
+
+	if err != nil {
+		return nil, newBillingServerResponseError(billingpb.ResponseStatusBadData, refundErrorUnknown)
+	}
+
+	if !ok {
+		return nil, newBillingServerResponseError(billingpb.ResponseStatusBadData, refundErrorOrderLocked)
+	}
+
+	return unlock, nil
+}
+
+// validate checks that refund of the request can be created for the order without creating it.
+func (p *createRefundProcessor) validate() error {
+	err := p.processOrder()
+
+	if err != nil {
+		return err
+	}
+
+	if !p.hasMoneyBackCosts(p.ctx, p.checked.order) {
+		return newBillingServerResponseError(billingpb.ResponseStatusBadData, refundErrorCostsRatesNotFound)
+	}
+
+	err = p.processRefundsByOrder()
+
+	if err != nil {
+		return err
+	}
+
+	if p.checked.order.GetMerchantId() != p.request.MerchantId {
+		return newBillingServerResponseError(billingpb.ResponseStatusBadData, refundErrorOrderNotFound)
+	}
+
+	return nil
+}
+
 func (p *createRefundProcessor) processOrder() error {
 	order, err := p.service.getOrderByUuid(p.ctx, p.request.OrderId)
 
@@ -524,6 +738,10 @@ func (p *createRefundProcessor) processRefundsByOrder() error {
 		return newBillingServerResponseError(billingpb.ResponseStatusBadData, refundErrorUnknown)
 	}
 
+	if len(p.items) > 0 {
+		return p.processRefundItems(refundedAmount)
+	}
+
 	if refundedAmount > 0 {
 		return newBillingServerResponseError(billingpb.ResponseStatusBadData, refundErrorPaymentAmountLess)
 	}
@@ -531,6 +749,112 @@ func (p *createRefundProcessor) processRefundsByOrder() error {
 	return nil
 }
 
+// processRefundItems selects not refunded positions of order items by the requested items and calculates
+// amount of refund for each of them. Refund of the last not refunded items gets the rest of order amount.
+func (p *createRefundProcessor) processRefundItems(refundedAmount float64) error {
+	order := p.checked.order
+	refunded, err := p.service.getRefundedOrderItems(p.ctx, order)
+
+	if err != nil {
+		return newBillingServerResponseError(billingpb.ResponseStatusBadData, refundErrorUnknown)
+	}
+
+	selected := make(map[int]bool)
+
+	for _, requested := range p.items {
+		quantity := requested.Quantity
+
+		if quantity <= 0 {
+			quantity = 1
+		}
+
+		found := false
+
+		for i, item := range order.Items {
+			if item.Id != requested.ItemId {
+				continue
+			}
+
+			found = true
+
+			if quantity <= 0 || refunded[int32(i)] != nil || selected[i] {
+				continue
+			}
+
+			selected[i] = true
+			quantity--
+		}
+
+		if !found {
+			return newBillingServerResponseError(billingpb.ResponseStatusBadData, refundErrorItemNotFound)
+		}
+
+		if quantity > 0 {
+			return newBillingServerResponseError(billingpb.ResponseStatusBadData, refundErrorItemQuantity)
+		}
+	}
+
+	var itemsAmount float64
+	isLast := true
+
+	for i, item := range order.Items {
+		itemsAmount += item.Amount
+
+		if refunded[int32(i)] == nil && !selected[i] {
+			isLast = false
+		}
+	}
+
+	if itemsAmount <= 0 {
+		return newBillingServerResponseError(billingpb.ResponseStatusBadData, refundErrorNotAllowed)
+	}
+
+	keys, err := p.service.getNotRefundedOrderKeys(p.ctx, order, refunded)
+
+	if err != nil {
+		return newBillingServerResponseError(billingpb.ResponseStatusBadData, refundErrorUnknown)
+	}
+
+	var items []*internalPkg.RefundedOrderItem
+	var amount float64
+
+	for i, item := range order.Items {
+		if !selected[i] {
+			continue
+		}
+
+		refundedItem := &internalPkg.RefundedOrderItem{
+			Index:    int32(i),
+			ItemId:   item.Id,
+			Name:     item.Name,
+			Amount:   tools.FormatAmount(order.ChargeAmount * item.Amount / itemsAmount),
+			Currency: order.ChargeCurrency,
+		}
+
+		refundedItem.KeyId = takeOrderItemKey(order, i, keys)
+		amount += refundedItem.Amount
+		items = append(items, refundedItem)
+	}
+
+	if isLast {
+		rest := tools.FormatAmount(order.ChargeAmount - refundedAmount)
+		lastItem := items[len(items)-1]
+		lastItem.Amount = tools.FormatAmount(lastItem.Amount + rest - amount)
+		amount = rest
+	}
+
+	amount = tools.FormatAmount(amount)
+
+	if amount <= 0 || tools.FormatAmount(refundedAmount+amount) > order.ChargeAmount {
+		return newBillingServerResponseError(billingpb.ResponseStatusBadData, refundErrorPaymentAmountLess)
+	}
+
+	p.checked.items = items
+	p.checked.amount = amount
+
+	return nil
+}
+
 func (p *createRefundProcessor) hasMoneyBackCosts(ctx context.Context, order *billingpb.Order) bool {
 	country, err := p.service.country.GetByIsoCodeA2(ctx, order.GetCountry())
 
@@ -583,3 +907,171 @@ func (p *createRefundProcessor) hasMoneyBackCosts(ctx context.Context, order *bi
 	_, err = p.service.getMoneyBackCostMerchant(ctx, data1)
 	return err == nil
 }
+
+// getRefundedOrderItems returns items of the order refunded by not rejected refunds of the order by positions
+// of the items in the order.
+func (s *Service) getRefundedOrderItems(ctx context.Context, order *billingpb.Order) (map[int32]*internalPkg.RefundedOrderItem, error) {
+	refundItems, err := s.refundItemsRepository.FindByOrderId(ctx, order.Id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	refunded := make(map[int32]*internalPkg.RefundedOrderItem)
+
+	if len(refundItems) <= 0 {
+		return refunded, nil
+	}
+
+	refunds, err := s.refundRepository.FindByOrderUuid(ctx, order.Uuid, 0, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rejected := make(map[string]bool)
+
+	for _, refund := range refunds {
+		if refund.Status == pkg.RefundStatusRejected {
+			rejected[refund.Id] = true
+		}
+	}
+
+	for _, val := range refundItems {
+		if rejected[val.Id] {
+			continue
+		}
+
+		for _, item := range val.Items {
+			refunded[item.Index] = item
+		}
+	}
+
+	return refunded, nil
+}
+
+// getNotRefundedOrderKeys returns key products of the keys sold by the order by identifiers of the keys. Keys
+// of the items refunded by other refunds are excluded.
+func (s *Service) getNotRefundedOrderKeys(
+	ctx context.Context,
+	order *billingpb.Order,
+	refunded map[int32]*internalPkg.RefundedOrderItem,
+) (map[string]string, error) {
+	keys := make(map[string]string)
+
+	if len(order.Keys) <= 0 {
+		return keys, nil
+	}
+
+	orderKeys, err := s.keyRepository.FindByOrderId(ctx, order.Id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range orderKeys {
+		keys[key.Id] = key.KeyProductId
+	}
+
+	for _, item := range refunded {
+		delete(keys, item.KeyId)
+	}
+
+	return keys, nil
+}
+
+// takeOrderItemKey returns not refunded key of the product of order item at the position and removes it from
+// the keys. Key sold at the same position of the order is preferred to other keys of the product.
+func takeOrderItemKey(order *billingpb.Order, index int, keys map[string]string) string {
+	if index >= len(order.Products) {
+		return ""
+	}
+
+	productId := order.Products[index]
+	keyId := ""
+
+	if index < len(order.Keys) && keys[order.Keys[index]] == productId {
+		keyId = order.Keys[index]
+	} else {
+		for _, id := range order.Keys {
+			if keys[id] == productId {
+				keyId = id
+				break
+			}
+		}
+	}
+
+	delete(keys, keyId)
+
+	return keyId
+}
+
+// setRefundOrderItems leaves in the order of refund only refunded items with products and keys of them,
+// so receipt of the refund lists the refunded items.
+func setRefundOrderItems(refundOrder, order *billingpb.Order, refundItems *internalPkg.RefundItems) {
+	var items []*billingpb.OrderItem
+	var products, keys []string
+
+	for _, val := range refundItems.Items {
+		index := int(val.Index)
+
+		if index >= len(order.Items) {
+			continue
+		}
+
+		items = append(items, order.Items[index])
+
+		if index < len(order.Products) {
+			products = append(products, order.Products[index])
+		}
+
+		if val.KeyId != "" {
+			keys = append(keys, val.KeyId)
+		}
+	}
+
+	refundOrder.Items = items
+	refundOrder.Products = products
+	refundOrder.Keys = keys
+}
+
+// revokeRefundedKeys marks keys of the key products refunded by the refund as revoked. Refund without items
+// revokes all keys of the order if the order is fully refunded.
+func (s *Service) revokeRefundedKeys(ctx context.Context, order *billingpb.Order, refund *billingpb.Refund, isFullRefund bool) {
+	var keys []string
+	refundItems, err := s.refundItemsRepository.GetByRefundId(ctx, refund.Id)
+
+	if err != nil && err != mongo.ErrNoDocuments {
+		zap.L().Error(
+			pkg.MethodFinishedWithError,
+			zap.String("method", "GetByRefundId"),
+			zap.Error(err),
+			zap.String("refundId", refund.Id),
+		)
+		return
+	}
+
+	if refundItems != nil {
+		for _, item := range refundItems.Items {
+			keys = append(keys, item.KeyId)
+		}
+	} else if isFullRefund {
+		keys = order.Keys
+	}
+
+	for _, keyId := range keys {
+		if keyId == "" {
+			continue
+		}
+
+		if _, err = s.keyRepository.RevokeById(ctx, keyId, refund.Id); err != nil {
+			zap.L().Error(
+				pkg.MethodFinishedWithError,
+				zap.String("method", "RevokeById"),
+				zap.Error(err),
+				zap.String("refundId", refund.Id),
+				zap.String("keyId", keyId),
+			)
+		}
+	}
+}
@@ -0,0 +1,425 @@
+package service
+
+import (
+	"context"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/paysuper/paysuper-billing-server/internal/helper"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"github.com/paysuper/paysuper-proto/go/currenciespb"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	"time"
+)
+
+var (
+	refundApprovalErrorThresholdInvalid = newBillingServerErrorMsg("ra000001", "amount threshold of refund approval policy must be greater than or equal to zero")
+	refundApprovalErrorCurrencyInvalid  = newBillingServerErrorMsg("ra000002", "currency of refund approval policy amount threshold not supported")
+	refundApprovalErrorDaysInvalid      = newBillingServerErrorMsg("ra000003", "number of days after payment of refund approval policy must be greater than or equal to zero")
+	refundApprovalErrorNotFound         = newBillingServerErrorMsg("ra000004", "refund waiting for approval not found")
+	refundApprovalErrorNotPending       = newBillingServerErrorMsg("ra000005", "refund isn't waiting for approval")
+	refundApprovalErrorSameUser         = newBillingServerErrorMsg("ra000006", "refund must be approved by user other than creator of refund")
+	refundApprovalErrorAccessDenied     = newBillingServerErrorMsg("ra000007", "user isn't allowed to approve refunds of merchant")
+)
+
+var (
+	refundApprovalMerchantRoles = []string{billingpb.RoleMerchantOwner, billingpb.RoleMerchantAccounting}
+	refundApprovalAdminRoles    = []string{billingpb.RoleSystemAdmin, billingpb.RoleSystemFinancial}
+)
+
+func (s *Service) GetRefundApprovalPolicy(
+	ctx context.Context,
+	req *internalPkg.RefundApprovalPolicyRequest,
+	rsp *internalPkg.RefundApprovalPolicyResponse,
+) error {
+	if _, err := s.merchantRepository.GetById(ctx, req.MerchantId); err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = merchantErrorNotFound
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = s.getRefundApprovalPolicy(ctx, req.MerchantId)
+
+	return nil
+}
+
+// SetRefundApprovalPolicy sets the policy of merchant which refunds need approval of the second user.
+func (s *Service) SetRefundApprovalPolicy(
+	ctx context.Context,
+	req *internalPkg.RefundApprovalPolicy,
+	rsp *internalPkg.RefundApprovalPolicyResponse,
+) error {
+	if req.AmountThreshold < 0 {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = refundApprovalErrorThresholdInvalid
+		return nil
+	}
+
+	if req.AmountThreshold > 0 && !helper.Contains(s.supportedCurrencies, req.Currency) {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = refundApprovalErrorCurrencyInvalid
+		return nil
+	}
+
+	if req.DaysAfterPayment < 0 {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = refundApprovalErrorDaysInvalid
+		return nil
+	}
+
+	if _, err := s.merchantRepository.GetById(ctx, req.MerchantId); err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = merchantErrorNotFound
+		return nil
+	}
+
+	req.UpdatedAt = time.Now()
+
+	if err := s.refundApprovalPolicyRepository.Upsert(ctx, req.MerchantId, req); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = req
+
+	return nil
+}
+
+// ApproveRefund approves the refund waiting for approval and sends it to the payment system.
+func (s *Service) ApproveRefund(
+	ctx context.Context,
+	req *internalPkg.ChangeRefundApprovalRequest,
+	rsp *internalPkg.ChangeRefundApprovalResponse,
+) error {
+	approval, _, order, err := s.getPendingRefundApproval(ctx, req)
+
+	if err != nil {
+		rsp.Status = err.(*billingpb.ResponseError).Status
+		rsp.Message = err.(*billingpb.ResponseError).Message
+		return nil
+	}
+
+	refund, err := s.claimRefundApproval(ctx, req, pkg.RefundStatusCreated)
+
+	if err != nil {
+		rsp.Status = err.(*billingpb.ResponseError).Status
+		rsp.Message = err.(*billingpb.ResponseError).Message
+		return nil
+	}
+
+	refund, err = s.sendRefund(ctx, order, refund)
+
+	if err != nil {
+		if err1 := s.refundRepository.ReleaseApproval(ctx, req.RefundId); err1 != nil {
+			zap.L().Error("refund approval not released after refund sending failed", zap.Error(err1), zap.String("refund_id", req.RefundId))
+		}
+
+		if e, ok := err.(*billingpb.ResponseError); ok {
+			rsp.Status = e.Status
+			rsp.Message = e.Message
+			return nil
+		}
+		return err
+	}
+
+	if err = s.setRefundApprovalStatus(ctx, approval, req, internalPkg.RefundApprovalStatusApproved); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = refund
+	rsp.Approval = approval
+
+	return nil
+}
+
+// RejectRefund rejects the refund waiting for approval, amount of refund is available to refund again.
+func (s *Service) RejectRefund(
+	ctx context.Context,
+	req *internalPkg.ChangeRefundApprovalRequest,
+	rsp *internalPkg.ChangeRefundApprovalResponse,
+) error {
+	approval, _, _, err := s.getPendingRefundApproval(ctx, req)
+
+	if err != nil {
+		rsp.Status = err.(*billingpb.ResponseError).Status
+		rsp.Message = err.(*billingpb.ResponseError).Message
+		return nil
+	}
+
+	refund, err := s.claimRefundApproval(ctx, req, pkg.RefundStatusRejected)
+
+	if err != nil {
+		rsp.Status = err.(*billingpb.ResponseError).Status
+		rsp.Message = err.(*billingpb.ResponseError).Message
+		return nil
+	}
+
+	if err = s.refundRepository.Update(ctx, refund); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	if err = s.setRefundApprovalStatus(ctx, approval, req, internalPkg.RefundApprovalStatusRejected); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = refund
+	rsp.Approval = approval
+
+	return nil
+}
+
+func (s *Service) ListRefundApprovals(
+	ctx context.Context,
+	req *internalPkg.ListRefundApprovalsRequest,
+	rsp *internalPkg.ListRefundApprovalsResponse,
+) error {
+	if req.Limit <= 0 {
+		req.Limit = pkg.DatabaseRequestDefaultLimit
+	}
+
+	if req.Offset <= 0 {
+		req.Offset = 0
+	}
+
+	count, err := s.refundApprovalRepository.FindCount(ctx, req)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	if count > 0 {
+		rsp.Items, err = s.refundApprovalRepository.Find(ctx, req)
+
+		if err != nil {
+			rsp.Status = billingpb.ResponseStatusSystemError
+			rsp.Message = orderErrorUnknown
+			return nil
+		}
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Count = count
+
+	return nil
+}
+
+// getRefundApprovalPolicy returns refund approval policy of the merchant or the empty policy, which doesn't hold
+// refunds, if merchant didn't set it.
+func (s *Service) getRefundApprovalPolicy(ctx context.Context, merchantId string) *internalPkg.RefundApprovalPolicy {
+	policy := &internalPkg.RefundApprovalPolicy{}
+	err := s.refundApprovalPolicyRepository.GetByOwnerId(ctx, merchantId, policy)
+
+	if err == nil {
+		return policy
+	}
+
+	if err != mongo.ErrNoDocuments {
+		zap.L().Error("refund approval policy of merchant not loaded", zap.Error(err), zap.String("merchant_id", merchantId))
+	}
+
+	return &internalPkg.RefundApprovalPolicy{MerchantId: merchantId}
+}
+
+// holdRefundForApproval moves the created refund to the pending approval status if it matches the rules
+// of the approval policy of merchant. Chargebacks are initiated by the issuer of card and aren't held.
+func (s *Service) holdRefundForApproval(ctx context.Context, order *billingpb.Order, refund *billingpb.Refund) (bool, error) {
+	if refund.IsChargeback {
+		return false, nil
+	}
+
+	policy := s.getRefundApprovalPolicy(ctx, order.GetMerchantId())
+	reasons := s.getRefundApprovalReasons(ctx, policy, order, refund)
+
+	if len(reasons) <= 0 {
+		return false, nil
+	}
+
+	refund.Status = pkg.RefundStatusPendingApproval
+	refund.UpdatedAt = ptypes.TimestampNow()
+
+	if err := s.refundRepository.Update(ctx, refund); err != nil {
+		return false, newBillingServerResponseError(billingpb.ResponseStatusBadData, orderErrorUnknown)
+	}
+
+	approval := &internalPkg.RefundApproval{
+		Id:         refund.Id,
+		OrderId:    order.Id,
+		MerchantId: order.GetMerchantId(),
+		Amount:     refund.Amount,
+		Currency:   refund.Currency,
+		Status:     internalPkg.RefundApprovalStatusPending,
+		Reasons:    reasons,
+		CreatorId:  refund.CreatorId,
+		CreatedAt:  time.Now(),
+	}
+
+	if err := s.refundApprovalRepository.Insert(ctx, approval); err != nil {
+		return false, newBillingServerResponseError(billingpb.ResponseStatusBadData, orderErrorUnknown)
+	}
+
+	return true, nil
+}
+
+// getRefundApprovalReasons returns the rules of policy matched by the refund. Refund is held by the amount rule
+// if its amount can't be converted to the currency of policy.
+func (s *Service) getRefundApprovalReasons(
+	ctx context.Context,
+	policy *internalPkg.RefundApprovalPolicy,
+	order *billingpb.Order,
+	refund *billingpb.Refund,
+) []string {
+	var reasons []string
+
+	if policy.AmountThreshold > 0 {
+		amount := refund.Amount
+
+		if refund.Currency != policy.Currency {
+			req := &currenciespb.ExchangeCurrencyCurrentCommonRequest{
+				From:              refund.Currency,
+				To:                policy.Currency,
+				RateType:          currenciespb.RateTypePaysuper,
+				ExchangeDirection: currenciespb.ExchangeDirectionBuy,
+				Amount:            refund.Amount,
+			}
+			rsp, err := s.curService.ExchangeCurrencyCurrentCommon(ctx, req)
+
+			if err != nil {
+				zap.L().Error(
+					pkg.ErrorGrpcServiceCallFailed,
+					zap.Error(err),
+					zap.String(errorFieldService, "CurrencyRatesService"),
+					zap.String(errorFieldMethod, "ExchangeCurrencyCurrentCommon"),
+					zap.Any(errorFieldRequest, req),
+				)
+				amount = policy.AmountThreshold + 1
+			} else {
+				amount = rsp.ExchangedAmount
+			}
+		}
+
+		if amount > policy.AmountThreshold {
+			reasons = append(reasons, internalPkg.RefundApprovalReasonAmount)
+		}
+	}
+
+	if policy.DaysAfterPayment > 0 && order.PaymentMethodOrderClosedAt != nil {
+		paymentAt, err := ptypes.Timestamp(order.PaymentMethodOrderClosedAt)
+
+		if err == nil && time.Since(paymentAt) > time.Duration(policy.DaysAfterPayment)*24*time.Hour {
+			reasons = append(reasons, internalPkg.RefundApprovalReasonPaymentAge)
+		}
+	}
+
+	return reasons
+}
+
+// getPendingRefundApproval returns approval, refund and order of the refund waiting for approval if the user
+// of request is allowed to decide on it.
+func (s *Service) getPendingRefundApproval(
+	ctx context.Context,
+	req *internalPkg.ChangeRefundApprovalRequest,
+) (*internalPkg.RefundApproval, *billingpb.Refund, *billingpb.Order, error) {
+	approval, err := s.refundApprovalRepository.GetById(ctx, req.RefundId)
+
+	if err != nil || approval.MerchantId != req.MerchantId {
+		return nil, nil, nil, newBillingServerResponseError(billingpb.ResponseStatusNotFound, refundApprovalErrorNotFound)
+	}
+
+	if approval.Status != internalPkg.RefundApprovalStatusPending {
+		return nil, nil, nil, newBillingServerResponseError(billingpb.ResponseStatusBadData, refundApprovalErrorNotPending)
+	}
+
+	if req.ApproverId == approval.CreatorId {
+		return nil, nil, nil, newBillingServerResponseError(billingpb.ResponseStatusForbidden, refundApprovalErrorSameUser)
+	}
+
+	if !s.isRefundApprover(ctx, req.MerchantId, req.ApproverId) {
+		return nil, nil, nil, newBillingServerResponseError(billingpb.ResponseStatusForbidden, refundApprovalErrorAccessDenied)
+	}
+
+	refund, err := s.refundRepository.GetById(ctx, req.RefundId)
+
+	if err != nil {
+		return nil, nil, nil, newBillingServerResponseError(billingpb.ResponseStatusNotFound, refundErrorNotFound)
+	}
+
+	if refund.Status != pkg.RefundStatusPendingApproval {
+		return nil, nil, nil, newBillingServerResponseError(billingpb.ResponseStatusBadData, refundApprovalErrorNotPending)
+	}
+
+	order, err := s.getOrderById(ctx, refund.OriginalOrder.Id)
+
+	if err != nil {
+		return nil, nil, nil, newBillingServerResponseError(billingpb.ResponseStatusNotFound, refundErrorOrderNotFound)
+	}
+
+	return approval, refund, order, nil
+}
+
+// isRefundApprover checks that the user is owner or accountant of the merchant or financial manager of platform.
+func (s *Service) isRefundApprover(ctx context.Context, merchantId, userId string) bool {
+	if userId == "" {
+		return false
+	}
+
+	role, err := s.userRoleRepository.GetMerchantUserByUserId(ctx, merchantId, userId)
+
+	if err == nil && helper.Contains(refundApprovalMerchantRoles, role.Role) {
+		return true
+	}
+
+	role, err = s.userRoleRepository.GetAdminUserByUserId(ctx, userId)
+
+	return err == nil && helper.Contains(refundApprovalAdminRoles, role.Role)
+}
+
+// claimRefundApproval moves the refund waiting for approval to the status decided by the approver of request,
+// so the refund is decided only once when the same refund is approved or rejected concurrently.
+func (s *Service) claimRefundApproval(
+	ctx context.Context,
+	req *internalPkg.ChangeRefundApprovalRequest,
+	status int32,
+) (*billingpb.Refund, error) {
+	refund, err := s.refundRepository.ClaimApproval(ctx, req.RefundId, status, req.ApproverId)
+
+	if err != nil {
+		return nil, newBillingServerResponseError(billingpb.ResponseStatusSystemError, orderErrorUnknown)
+	}
+
+	if refund == nil {
+		return nil, newBillingServerResponseError(billingpb.ResponseStatusBadData, refundApprovalErrorNotPending)
+	}
+
+	refund.UpdatedAt = ptypes.TimestampNow()
+
+	return refund, nil
+}
+
+func (s *Service) setRefundApprovalStatus(
+	ctx context.Context,
+	approval *internalPkg.RefundApproval,
+	req *internalPkg.ChangeRefundApprovalRequest,
+	status string,
+) error {
+	decidedAt := time.Now()
+	approval.Status = status
+	approval.ApproverId = req.ApproverId
+	approval.Comment = req.Comment
+	approval.DecidedAt = &decidedAt
+
+	return s.refundApprovalRepository.Update(ctx, approval)
+}
@@ -0,0 +1,395 @@
+package service
+
+import (
+	"context"
+	"github.com/go-redis/redis"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/mongodb"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	"github.com/paysuper/paysuper-billing-server/internal/database"
+	"github.com/paysuper/paysuper-billing-server/internal/mocks"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/internal/repository"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	casbinMocks "github.com/paysuper/paysuper-proto/go/casbinpb/mocks"
+	reportingMocks "github.com/paysuper/paysuper-proto/go/reporterpb/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	rabbitmq "gopkg.in/ProtocolONE/rabbitmq.v1/pkg"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type RefundApprovalTestSuite struct {
+	suite.Suite
+	service *Service
+	log     *zap.Logger
+	cache   database.CacheInterface
+
+	merchant      *billingpb.Merchant
+	project       *billingpb.Project
+	paymentMethod *billingpb.PaymentMethod
+	paymentSystem *billingpb.PaymentSystem
+}
+
+func Test_RefundApproval(t *testing.T) {
+	suite.Run(t, new(RefundApprovalTestSuite))
+}
+
+func (suite *RefundApprovalTestSuite) SetupTest() {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		suite.FailNow("Config load failed", "%v", err)
+	}
+	cfg.CardPayApiUrl = "https://sandbox.cardpay.com"
+
+	m, err := migrate.New(
+		"file://../../migrations/tests",
+		cfg.MongoDsn)
+	assert.NoError(suite.T(), err, "Migrate init failed")
+
+	err = m.Up()
+	if err != nil && err.Error() != "no change" {
+		suite.FailNow("Migrations failed", "%v", err)
+	}
+
+	ctx, _ := context.WithTimeout(context.Background(), 50*time.Second)
+	opts := []mongodb.Option{mongodb.Context(ctx)}
+	db, err := mongodb.NewDatabase(opts...)
+	if err != nil {
+		suite.FailNow("Database connection failed", "%v", err)
+	}
+
+	suite.log, err = zap.NewProduction()
+
+	if err != nil {
+		suite.FailNow("Logger initialization failed", "%v", err)
+	}
+
+	broker, err := rabbitmq.NewBroker(cfg.BrokerAddress)
+
+	if err != nil {
+		suite.FailNow("Creating RabbitMQ publisher failed", "%v", err)
+	}
+
+	redisClient := database.NewRedis(
+		&redis.Options{
+			Addr:     cfg.RedisHost,
+			Password: cfg.RedisPassword,
+		},
+	)
+
+	redisdb := mocks.NewTestRedis()
+	suite.cache, err = database.NewCacheRedis(redisdb, "cache")
+	suite.service = NewBillingService(
+		db,
+		cfg,
+		mocks.NewGeoIpServiceTestOk(),
+		mocks.NewRepositoryServiceOk(),
+		mocks.NewTaxServiceOkMock(),
+		broker,
+		redisClient,
+		suite.cache,
+		mocks.NewCurrencyServiceMockOk(),
+		mocks.NewDocumentSignerMockOk(),
+		&reportingMocks.ReporterService{},
+		mocks.NewFormatterOK(),
+		mocks.NewBrokerMockOk(),
+		&casbinMocks.CasbinService{},
+	)
+
+	if err := suite.service.Init(); err != nil {
+		suite.FailNow("Billing service initialization failed", "%v", err)
+	}
+
+	suite.merchant, suite.project, suite.paymentMethod, suite.paymentSystem = helperCreateEntitiesForTests(suite.Suite, suite.service)
+
+	centrifugoMock := &mocks.CentrifugoInterface{}
+	centrifugoMock.On("GetChannelToken", mock.Anything, mock.Anything).Return("token")
+	centrifugoMock.On("Publish", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	suite.service.centrifugoDashboard = centrifugoMock
+	suite.service.centrifugoPaymentForm = centrifugoMock
+}
+
+func (suite *RefundApprovalTestSuite) TearDownTest() {
+	err := suite.service.db.Drop()
+
+	if err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	err = suite.service.db.Close()
+
+	if err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *RefundApprovalTestSuite) TestRefundApproval_SetRefundApprovalPolicy_Ok() {
+	rsp := &internalPkg.RefundApprovalPolicyResponse{}
+	err := suite.service.GetRefundApprovalPolicy(context.TODO(), &internalPkg.RefundApprovalPolicyRequest{MerchantId: suite.merchant.Id}, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Zero(suite.T(), rsp.Item.AmountThreshold)
+	assert.Zero(suite.T(), rsp.Item.DaysAfterPayment)
+
+	policy := &internalPkg.RefundApprovalPolicy{
+		MerchantId:       suite.merchant.Id,
+		AmountThreshold:  100,
+		Currency:         "EUR",
+		DaysAfterPayment: 30,
+	}
+	rsp = &internalPkg.RefundApprovalPolicyResponse{}
+	err = suite.service.SetRefundApprovalPolicy(context.TODO(), policy, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	rsp = &internalPkg.RefundApprovalPolicyResponse{}
+	err = suite.service.GetRefundApprovalPolicy(context.TODO(), &internalPkg.RefundApprovalPolicyRequest{MerchantId: suite.merchant.Id}, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), float64(100), rsp.Item.AmountThreshold)
+	assert.Equal(suite.T(), "EUR", rsp.Item.Currency)
+	assert.Equal(suite.T(), int32(30), rsp.Item.DaysAfterPayment)
+}
+
+func (suite *RefundApprovalTestSuite) TestRefundApproval_SetRefundApprovalPolicy_Invalid() {
+	policies := map[*internalPkg.RefundApprovalPolicy]*billingpb.ResponseErrorMessage{
+		{MerchantId: suite.merchant.Id, AmountThreshold: -1, Currency: "EUR"}:  refundApprovalErrorThresholdInvalid,
+		{MerchantId: suite.merchant.Id, AmountThreshold: 100, Currency: "XXX"}: refundApprovalErrorCurrencyInvalid,
+		{MerchantId: suite.merchant.Id, DaysAfterPayment: -1}:                  refundApprovalErrorDaysInvalid,
+	}
+
+	for policy, message := range policies {
+		rsp := &internalPkg.RefundApprovalPolicyResponse{}
+		err := suite.service.SetRefundApprovalPolicy(context.TODO(), policy, rsp)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+		assert.Equal(suite.T(), message, rsp.Message)
+	}
+
+	rsp := &internalPkg.RefundApprovalPolicyResponse{}
+	policy := &internalPkg.RefundApprovalPolicy{MerchantId: primitive.NewObjectID().Hex(), DaysAfterPayment: 30}
+	err := suite.service.SetRefundApprovalPolicy(context.TODO(), policy, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), merchantErrorNotFound, rsp.Message)
+}
+
+func (suite *RefundApprovalTestSuite) TestRefundApproval_CreateRefund_WithoutPolicy_NotHeld() {
+	order := suite.createAndPayOrder()
+	rsp := suite.createRefund(order)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.NotEqual(suite.T(), pkg.RefundStatusPendingApproval, rsp.Item.Status)
+
+	_, err := suite.service.refundApprovalRepository.GetById(context.TODO(), rsp.Item.Id)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *RefundApprovalTestSuite) TestRefundApproval_CreateRefund_BelowThreshold_NotHeld() {
+	suite.setPolicy(100)
+	order := suite.createAndPayOrder()
+
+	rsp := suite.createRefund(order)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.NotEqual(suite.T(), pkg.RefundStatusPendingApproval, rsp.Item.Status)
+}
+
+func (suite *RefundApprovalTestSuite) TestRefundApproval_ApproveRefund_Ok() {
+	suite.setPolicy(1)
+	order := suite.createAndPayOrder()
+
+	rsp := suite.createRefund(order)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), pkg.RefundStatusPendingApproval, rsp.Item.Status)
+
+	rsp1 := &internalPkg.ListRefundApprovalsResponse{}
+	req1 := &internalPkg.ListRefundApprovalsRequest{MerchantId: suite.merchant.Id, Status: internalPkg.RefundApprovalStatusPending}
+	err := suite.service.ListRefundApprovals(context.TODO(), req1, rsp1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp1.Status)
+	assert.EqualValues(suite.T(), 1, rsp1.Count)
+	assert.Equal(suite.T(), rsp.Item.Id, rsp1.Items[0].Id)
+	assert.Equal(suite.T(), []string{internalPkg.RefundApprovalReasonAmount}, rsp1.Items[0].Reasons)
+
+	approverId := suite.addMerchantUser(billingpb.RoleMerchantOwner)
+	rsp2 := suite.changeRefundApproval(suite.service.ApproveRefund, rsp.Item.Id, approverId)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp2.Status)
+	assert.NotEqual(suite.T(), pkg.RefundStatusPendingApproval, rsp2.Item.Status)
+	assert.Equal(suite.T(), internalPkg.RefundApprovalStatusApproved, rsp2.Approval.Status)
+	assert.Equal(suite.T(), approverId, rsp2.Approval.ApproverId)
+	assert.NotNil(suite.T(), rsp2.Approval.DecidedAt)
+	assert.Equal(suite.T(), approverId, suite.getRefundApproverId(rsp.Item.Id))
+
+	refund := helperProcessRefundCallback(suite.Suite, suite.service, order, rsp2.Item)
+	assert.Equal(suite.T(), pkg.RefundStatusCompleted, refund.Status)
+
+	rsp2 = suite.changeRefundApproval(suite.service.ApproveRefund, rsp.Item.Id, approverId)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp2.Status)
+	assert.Equal(suite.T(), refundApprovalErrorNotPending, rsp2.Message)
+}
+
+func (suite *RefundApprovalTestSuite) TestRefundApproval_RejectRefund_Ok() {
+	suite.setPolicy(1)
+	order := suite.createAndPayOrder()
+
+	rsp := suite.createRefund(order)
+	assert.Equal(suite.T(), pkg.RefundStatusPendingApproval, rsp.Item.Status)
+
+	rsp1 := suite.createRefund(order)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp1.Status)
+	assert.Equal(suite.T(), refundErrorPaymentAmountLess, rsp1.Message)
+
+	approverId := suite.addMerchantUser(billingpb.RoleMerchantAccounting)
+	rsp2 := suite.changeRefundApproval(suite.service.RejectRefund, rsp.Item.Id, approverId)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp2.Status)
+	assert.Equal(suite.T(), pkg.RefundStatusRejected, rsp2.Item.Status)
+	assert.Equal(suite.T(), internalPkg.RefundApprovalStatusRejected, rsp2.Approval.Status)
+
+	refund, err := suite.service.refundRepository.GetById(context.TODO(), rsp.Item.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), pkg.RefundStatusRejected, refund.Status)
+
+	rsp1 = suite.createRefund(order)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp1.Status)
+	assert.Equal(suite.T(), pkg.RefundStatusPendingApproval, rsp1.Item.Status)
+}
+
+func (suite *RefundApprovalTestSuite) TestRefundApproval_ApproveRefund_AccessDenied() {
+	suite.setPolicy(1)
+	order := suite.createAndPayOrder()
+
+	rsp := suite.createRefund(order)
+	assert.Equal(suite.T(), pkg.RefundStatusPendingApproval, rsp.Item.Status)
+
+	rsp1 := suite.changeRefundApproval(suite.service.ApproveRefund, rsp.Item.Id, rsp.Item.CreatorId)
+	assert.Equal(suite.T(), billingpb.ResponseStatusForbidden, rsp1.Status)
+	assert.Equal(suite.T(), refundApprovalErrorSameUser, rsp1.Message)
+
+	approverId := suite.addMerchantUser(billingpb.RoleMerchantSupport)
+	rsp1 = suite.changeRefundApproval(suite.service.ApproveRefund, rsp.Item.Id, approverId)
+	assert.Equal(suite.T(), billingpb.ResponseStatusForbidden, rsp1.Status)
+	assert.Equal(suite.T(), refundApprovalErrorAccessDenied, rsp1.Message)
+
+	rsp1 = suite.changeRefundApproval(suite.service.ApproveRefund, primitive.NewObjectID().Hex(), approverId)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp1.Status)
+	assert.Equal(suite.T(), refundApprovalErrorNotFound, rsp1.Message)
+
+	refund, err := suite.service.refundRepository.GetById(context.TODO(), rsp.Item.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), pkg.RefundStatusPendingApproval, refund.Status)
+}
+
+func (suite *RefundApprovalTestSuite) TestRefundApproval_GetRefundApprovalReasons_PaymentAge() {
+	policy := &internalPkg.RefundApprovalPolicy{MerchantId: suite.merchant.Id, DaysAfterPayment: 30}
+	order := &billingpb.Order{}
+	refund := &billingpb.Refund{Amount: 100, Currency: "RUB"}
+
+	order.PaymentMethodOrderClosedAt, _ = ptypes.TimestampProto(time.Now().Add(-29 * 24 * time.Hour))
+	reasons := suite.service.getRefundApprovalReasons(context.TODO(), policy, order, refund)
+	assert.Empty(suite.T(), reasons)
+
+	order.PaymentMethodOrderClosedAt, _ = ptypes.TimestampProto(time.Now().Add(-31 * 24 * time.Hour))
+	reasons = suite.service.getRefundApprovalReasons(context.TODO(), policy, order, refund)
+	assert.Equal(suite.T(), []string{internalPkg.RefundApprovalReasonPaymentAge}, reasons)
+
+	policy.AmountThreshold = 1
+	policy.Currency = "EUR"
+	reasons = suite.service.getRefundApprovalReasons(context.TODO(), policy, order, refund)
+	assert.Equal(suite.T(), []string{internalPkg.RefundApprovalReasonAmount, internalPkg.RefundApprovalReasonPaymentAge}, reasons)
+}
+
+func (suite *RefundApprovalTestSuite) TestRefundApproval_ApproveRefund_ClaimedByOther() {
+	suite.setPolicy(1)
+	order := suite.createAndPayOrder()
+
+	rsp := suite.createRefund(order)
+	assert.Equal(suite.T(), pkg.RefundStatusPendingApproval, rsp.Item.Status)
+
+	approverId := suite.addMerchantUser(billingpb.RoleMerchantOwner)
+	req := &internalPkg.ChangeRefundApprovalRequest{RefundId: rsp.Item.Id, MerchantId: suite.merchant.Id, ApproverId: approverId}
+	refund, err := suite.service.claimRefundApproval(context.TODO(), req, pkg.RefundStatusRejected)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), pkg.RefundStatusRejected, refund.Status)
+
+	_, err = suite.service.claimRefundApproval(context.TODO(), req, pkg.RefundStatusCreated)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), refundApprovalErrorNotPending, err.(*billingpb.ResponseError).Message)
+
+	rsp2 := suite.changeRefundApproval(suite.service.ApproveRefund, rsp.Item.Id, approverId)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp2.Status)
+	assert.Equal(suite.T(), refundApprovalErrorNotPending, rsp2.Message)
+}
+
+func (suite *RefundApprovalTestSuite) getRefundApproverId(refundId string) interface{} {
+	var document bson.M
+	oid, _ := primitive.ObjectIDFromHex(refundId)
+	err := suite.service.db.Collection(repository.CollectionRefund).FindOne(context.TODO(), bson.M{"_id": oid}).Decode(&document)
+	assert.NoError(suite.T(), err)
+
+	return document["approver_id"]
+}
+
+func (suite *RefundApprovalTestSuite) createAndPayOrder() *billingpb.Order {
+	return helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+}
+
+func (suite *RefundApprovalTestSuite) setPolicy(threshold float64) {
+	policy := &internalPkg.RefundApprovalPolicy{MerchantId: suite.merchant.Id, AmountThreshold: threshold, Currency: "EUR"}
+	rsp := &internalPkg.RefundApprovalPolicyResponse{}
+	err := suite.service.SetRefundApprovalPolicy(context.TODO(), policy, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+}
+
+func (suite *RefundApprovalTestSuite) createRefund(order *billingpb.Order) *billingpb.CreateRefundResponse {
+	req := &billingpb.CreateRefundRequest{
+		OrderId:    order.Uuid,
+		CreatorId:  primitive.NewObjectID().Hex(),
+		Reason:     "unit test",
+		MerchantId: order.GetMerchantId(),
+	}
+	rsp := &billingpb.CreateRefundResponse{}
+	err := suite.service.CreateRefund(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+
+	return rsp
+}
+
+func (suite *RefundApprovalTestSuite) addMerchantUser(role string) string {
+	userRole := &billingpb.UserRole{
+		Id:         primitive.NewObjectID().Hex(),
+		UserId:     primitive.NewObjectID().Hex(),
+		MerchantId: suite.merchant.Id,
+		Role:       role,
+	}
+	err := suite.service.userRoleRepository.AddMerchantUser(context.TODO(), userRole)
+	assert.NoError(suite.T(), err)
+
+	return userRole.UserId
+}
+
+func (suite *RefundApprovalTestSuite) changeRefundApproval(
+	fn func(context.Context, *internalPkg.ChangeRefundApprovalRequest, *internalPkg.ChangeRefundApprovalResponse) error,
+	refundId, approverId string,
+) *internalPkg.ChangeRefundApprovalResponse {
+	req := &internalPkg.ChangeRefundApprovalRequest{
+		RefundId:   refundId,
+		MerchantId: suite.merchant.Id,
+		ApproverId: approverId,
+		Comment:    "unit test",
+	}
+	rsp := &internalPkg.ChangeRefundApprovalResponse{}
+	err := fn(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+
+	return rsp
+}
@@ -0,0 +1,398 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/mongodb"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	"github.com/paysuper/paysuper-billing-server/internal/database"
+	"github.com/paysuper/paysuper-billing-server/internal/mocks"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	casbinMocks "github.com/paysuper/paysuper-proto/go/casbinpb/mocks"
+	"github.com/paysuper/paysuper-proto/go/recurringpb"
+	reportingMocks "github.com/paysuper/paysuper-proto/go/reporterpb/mocks"
+	tools "github.com/paysuper/paysuper-tools/number"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	rabbitmq "gopkg.in/ProtocolONE/rabbitmq.v1/pkg"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type RefundItemsTestSuite struct {
+	suite.Suite
+	service *Service
+	log     *zap.Logger
+	cache   database.CacheInterface
+
+	merchant      *billingpb.Merchant
+	project       *billingpb.Project
+	paymentMethod *billingpb.PaymentMethod
+	paymentSystem *billingpb.PaymentSystem
+}
+
+func Test_RefundItems(t *testing.T) {
+	suite.Run(t, new(RefundItemsTestSuite))
+}
+
+func (suite *RefundItemsTestSuite) SetupTest() {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		suite.FailNow("Config load failed", "%v", err)
+	}
+	cfg.CardPayApiUrl = "https://sandbox.cardpay.com"
+
+	m, err := migrate.New(
+		"file://../../migrations/tests",
+		cfg.MongoDsn)
+	assert.NoError(suite.T(), err, "Migrate init failed")
+
+	err = m.Up()
+	if err != nil && err.Error() != "no change" {
+		suite.FailNow("Migrations failed", "%v", err)
+	}
+
+	ctx, _ := context.WithTimeout(context.Background(), 50*time.Second)
+	opts := []mongodb.Option{mongodb.Context(ctx)}
+	db, err := mongodb.NewDatabase(opts...)
+	if err != nil {
+		suite.FailNow("Database connection failed", "%v", err)
+	}
+
+	suite.log, err = zap.NewProduction()
+
+	if err != nil {
+		suite.FailNow("Logger initialization failed", "%v", err)
+	}
+
+	broker, err := rabbitmq.NewBroker(cfg.BrokerAddress)
+
+	if err != nil {
+		suite.FailNow("Creating RabbitMQ publisher failed", "%v", err)
+	}
+
+	redisClient := database.NewRedis(
+		&redis.Options{
+			Addr:     cfg.RedisHost,
+			Password: cfg.RedisPassword,
+		},
+	)
+
+	redisdb := mocks.NewTestRedis()
+	suite.cache, err = database.NewCacheRedis(redisdb, "cache")
+	suite.service = NewBillingService(
+		db,
+		cfg,
+		mocks.NewGeoIpServiceTestOk(),
+		mocks.NewRepositoryServiceOk(),
+		mocks.NewTaxServiceOkMock(),
+		broker,
+		redisClient,
+		suite.cache,
+		mocks.NewCurrencyServiceMockOk(),
+		mocks.NewDocumentSignerMockOk(),
+		&reportingMocks.ReporterService{},
+		mocks.NewFormatterOK(),
+		mocks.NewBrokerMockOk(),
+		&casbinMocks.CasbinService{},
+	)
+
+	if err := suite.service.Init(); err != nil {
+		suite.FailNow("Billing service initialization failed", "%v", err)
+	}
+
+	suite.merchant, suite.project, suite.paymentMethod, suite.paymentSystem = helperCreateEntitiesForTests(suite.Suite, suite.service)
+
+	centrifugoMock := &mocks.CentrifugoInterface{}
+	centrifugoMock.On("GetChannelToken", mock.Anything, mock.Anything).Return("token")
+	centrifugoMock.On("Publish", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	suite.service.centrifugoDashboard = centrifugoMock
+	suite.service.centrifugoPaymentForm = centrifugoMock
+}
+
+func (suite *RefundItemsTestSuite) TearDownTest() {
+	err := suite.service.db.Drop()
+
+	if err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	err = suite.service.db.Close()
+
+	if err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *RefundItemsTestSuite) TestRefundItems_CreateItemsRefund_Ok() {
+	order, keys := suite.createAndPayOrderWithItems()
+	status := order.PrivateStatus
+
+	req := &internalPkg.CreateItemsRefundRequest{
+		OrderId:    order.Uuid,
+		MerchantId: order.GetMerchantId(),
+		CreatorId:  primitive.NewObjectID().Hex(),
+		Reason:     "unit test",
+		Items:      []*internalPkg.RefundItemRequest{{ItemId: "item_a"}},
+	}
+	rsp := &internalPkg.CreateItemsRefundResponse{}
+	err := suite.service.CreateItemsRefund(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), tools.FormatAmount(order.ChargeAmount*0.3), rsp.Item.Amount)
+	assert.Len(suite.T(), rsp.Items, 1)
+	assert.EqualValues(suite.T(), 0, rsp.Items[0].Index)
+	assert.Equal(suite.T(), keys[0], rsp.Items[0].KeyId)
+	assert.Equal(suite.T(), rsp.Item.Amount, rsp.Items[0].Amount)
+
+	refund := helperProcessRefundCallback(suite.Suite, suite.service, order, rsp.Item)
+	assert.NotEmpty(suite.T(), refund.CreatedOrderId)
+
+	refundOrder, err := suite.service.orderRepository.GetById(context.TODO(), refund.CreatedOrderId)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), refundOrder.Items, 1)
+	assert.Equal(suite.T(), "item_a", refundOrder.Items[0].Id)
+	assert.Equal(suite.T(), []string{keys[0]}, refundOrder.Keys)
+	assert.Equal(suite.T(), refund.Amount, refundOrder.ChargeAmount)
+
+	suite.assertKeyRevoked(keys[0], refund.Id)
+	suite.assertKeyNotRevoked(keys[1])
+	suite.assertKeyNotRevoked(keys[2])
+
+	order, err = suite.service.orderRepository.GetById(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), status, order.PrivateStatus)
+	assert.False(suite.T(), order.Refunded)
+}
+
+func (suite *RefundItemsTestSuite) TestRefundItems_CreateItemsRefund_LastItems_RestOfAmount() {
+	order, keys := suite.createAndPayOrderWithItems()
+
+	rsp := suite.createItemsRefund(order, &internalPkg.RefundItemRequest{ItemId: "item_b"})
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	refund := helperProcessRefundCallback(suite.Suite, suite.service, order, rsp.Item)
+
+	rsp = suite.createItemsRefund(order, &internalPkg.RefundItemRequest{ItemId: "item_a", Quantity: 2})
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Len(suite.T(), rsp.Items, 2)
+	assert.Equal(suite.T(), tools.FormatAmount(order.ChargeAmount-refund.Amount), rsp.Item.Amount)
+	assert.Equal(suite.T(), rsp.Item.Amount, tools.FormatAmount(rsp.Items[0].Amount+rsp.Items[1].Amount))
+	refund2 := helperProcessRefundCallback(suite.Suite, suite.service, order, rsp.Item)
+
+	suite.assertKeyRevoked(keys[0], refund2.Id)
+	suite.assertKeyRevoked(keys[1], refund2.Id)
+	suite.assertKeyRevoked(keys[2], refund.Id)
+
+	order, err := suite.service.orderRepository.GetById(context.TODO(), order.Id)
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), recurringpb.OrderStatusRefund, order.PrivateStatus)
+	assert.True(suite.T(), order.Refunded)
+}
+
+func (suite *RefundItemsTestSuite) TestRefundItems_CreateItemsRefund_ItemsEmpty() {
+	order, _ := suite.createAndPayOrderWithItems()
+
+	rsp := suite.createItemsRefund(order)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), refundErrorItemsEmpty, rsp.Message)
+}
+
+func (suite *RefundItemsTestSuite) TestRefundItems_CreateItemsRefund_ItemNotFound() {
+	order, _ := suite.createAndPayOrderWithItems()
+
+	rsp := suite.createItemsRefund(order, &internalPkg.RefundItemRequest{ItemId: "item_c"})
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), refundErrorItemNotFound, rsp.Message)
+}
+
+func (suite *RefundItemsTestSuite) TestRefundItems_CreateItemsRefund_QuantityExceeded() {
+	order, _ := suite.createAndPayOrderWithItems()
+
+	rsp := suite.createItemsRefund(order, &internalPkg.RefundItemRequest{ItemId: "item_a", Quantity: 3})
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), refundErrorItemQuantity, rsp.Message)
+
+	rsp = suite.createItemsRefund(order, &internalPkg.RefundItemRequest{ItemId: "item_a", Quantity: 2})
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	rsp = suite.createItemsRefund(order, &internalPkg.RefundItemRequest{ItemId: "item_a"})
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), refundErrorItemQuantity, rsp.Message)
+}
+
+func (suite *RefundItemsTestSuite) TestRefundItems_CreateRefund_AfterItemsRefund_Error() {
+	order, _ := suite.createAndPayOrderWithItems()
+
+	rsp := suite.createItemsRefund(order, &internalPkg.RefundItemRequest{ItemId: "item_b"})
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	req := &billingpb.CreateRefundRequest{
+		OrderId:    order.Uuid,
+		CreatorId:  primitive.NewObjectID().Hex(),
+		MerchantId: order.GetMerchantId(),
+	}
+	rsp1 := &billingpb.CreateRefundResponse{}
+	err := suite.service.CreateRefund(context.TODO(), req, rsp1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp1.Status)
+	assert.Equal(suite.T(), refundErrorPaymentAmountLess, rsp1.Message)
+}
+
+func (suite *RefundItemsTestSuite) TestRefundItems_ProcessRefundCallback_FullRefund_KeysRevoked() {
+	order, keys := suite.createAndPayOrderWithItems()
+	refund := helperMakeRefund(suite.Suite, suite.service, order, order.ChargeAmount, false)
+
+	for _, keyId := range keys {
+		suite.assertKeyRevoked(keyId, refund.Id)
+	}
+}
+
+func (suite *RefundItemsTestSuite) TestRefundItems_CreateItemsRefund_KeyOfItemProduct() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	productA := primitive.NewObjectID().Hex()
+	productB := primitive.NewObjectID().Hex()
+	order.Items = []*billingpb.OrderItem{
+		{Id: "item_a", Name: "Item A", Amount: 50, Currency: "RUB"},
+		{Id: "item_b", Name: "Item B", Amount: 50, Currency: "RUB"},
+	}
+	order.Products = []string{productA, productB}
+	order.Keys = []string{}
+
+	for _, productId := range []string{productB, productA} {
+		key := &billingpb.Key{
+			Id:           primitive.NewObjectID().Hex(),
+			Code:         primitive.NewObjectID().Hex(),
+			KeyProductId: productId,
+			PlatformId:   "steam",
+			OrderId:      order.Id,
+		}
+		err := suite.service.keyRepository.Insert(context.TODO(), key)
+		assert.NoError(suite.T(), err)
+		order.Keys = append(order.Keys, key.Id)
+	}
+
+	err := suite.service.updateOrder(context.TODO(), order)
+	assert.NoError(suite.T(), err)
+
+	rsp := suite.createItemsRefund(order, &internalPkg.RefundItemRequest{ItemId: "item_a"})
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Len(suite.T(), rsp.Items, 1)
+	assert.Equal(suite.T(), order.Keys[1], rsp.Items[0].KeyId)
+
+	rsp = suite.createItemsRefund(order, &internalPkg.RefundItemRequest{ItemId: "item_b"})
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Len(suite.T(), rsp.Items, 1)
+	assert.Equal(suite.T(), order.Keys[0], rsp.Items[0].KeyId)
+}
+
+func (suite *RefundItemsTestSuite) TestRefundItems_CreateItemsRefund_OrderLocked() {
+	order, _ := suite.createAndPayOrderWithItems()
+
+	unlock, ok, err := suite.service.acquireRedisLock(
+		context.TODO(),
+		fmt.Sprintf(refundOrderLockKey, order.Uuid),
+		refundOrderLockTtl,
+		refundOrderLockWaitTimeout,
+	)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*redisLockWaitInterval)
+	defer cancel()
+
+	req := &internalPkg.CreateItemsRefundRequest{
+		OrderId:    order.Uuid,
+		MerchantId: order.GetMerchantId(),
+		CreatorId:  primitive.NewObjectID().Hex(),
+		Items:      []*internalPkg.RefundItemRequest{{ItemId: "item_b"}},
+	}
+	rsp := &internalPkg.CreateItemsRefundResponse{}
+	err = suite.service.CreateItemsRefund(ctx, req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), refundErrorOrderLocked, rsp.Message)
+
+	unlock()
+
+	rsp = suite.createItemsRefund(order, &internalPkg.RefundItemRequest{ItemId: "item_b"})
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+}
+
+// createAndPayOrderWithItems returns paid order with three items, two of them are the same, and keys sold by them.
+// Prices of items are 30%, 30% and 40% of order amount.
+func (suite *RefundItemsTestSuite) createAndPayOrderWithItems() (*billingpb.Order, []string) {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	keyProductId := primitive.NewObjectID().Hex()
+	order.Items = []*billingpb.OrderItem{
+		{Id: "item_a", Name: "Item A", Amount: 30, Currency: "RUB"},
+		{Id: "item_a", Name: "Item A", Amount: 30, Currency: "RUB"},
+		{Id: "item_b", Name: "Item B", Amount: 40, Currency: "RUB"},
+	}
+	order.Products = []string{keyProductId, keyProductId, keyProductId}
+	order.Keys = []string{}
+
+	for range order.Items {
+		key := &billingpb.Key{
+			Id:           primitive.NewObjectID().Hex(),
+			Code:         primitive.NewObjectID().Hex(),
+			KeyProductId: keyProductId,
+			PlatformId:   "steam",
+			OrderId:      order.Id,
+		}
+		err := suite.service.keyRepository.Insert(context.TODO(), key)
+		assert.NoError(suite.T(), err)
+		order.Keys = append(order.Keys, key.Id)
+	}
+
+	err := suite.service.updateOrder(context.TODO(), order)
+	assert.NoError(suite.T(), err)
+
+	return order, order.Keys
+}
+
+func (suite *RefundItemsTestSuite) createItemsRefund(
+	order *billingpb.Order,
+	items ...*internalPkg.RefundItemRequest,
+) *internalPkg.CreateItemsRefundResponse {
+	req := &internalPkg.CreateItemsRefundRequest{
+		OrderId:    order.Uuid,
+		MerchantId: order.GetMerchantId(),
+		CreatorId:  primitive.NewObjectID().Hex(),
+		Items:      items,
+	}
+	rsp := &internalPkg.CreateItemsRefundResponse{}
+	err := suite.service.CreateItemsRefund(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+
+	return rsp
+}
+
+func (suite *RefundItemsTestSuite) getKey(keyId string) bson.M {
+	var key bson.M
+	oid, _ := primitive.ObjectIDFromHex(keyId)
+	err := suite.service.db.Collection(collectionKey).FindOne(context.TODO(), bson.M{"_id": oid}).Decode(&key)
+	assert.NoError(suite.T(), err)
+
+	return key
+}
+
+func (suite *RefundItemsTestSuite) assertKeyRevoked(keyId, refundId string) {
+	key := suite.getKey(keyId)
+	assert.NotNil(suite.T(), key["revoked_at"])
+	assert.Equal(suite.T(), refundId, key["refund_id"])
+}
+
+func (suite *RefundItemsTestSuite) assertKeyNotRevoked(keyId string) {
+	key := suite.getKey(keyId)
+	assert.Nil(suite.T(), key["revoked_at"])
+	assert.Nil(suite.T(), key["refund_id"])
+}
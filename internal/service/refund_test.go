@@ -1155,8 +1155,7 @@ func (suite *RefundTestSuite) TestRefund_CreateRefund_WasRefunded_Error() {
 	assert.NoError(suite.T(), err)
 	assert.NotNil(suite.T(), order)
 
-	order.PrivateStatus = recurringpb.OrderStatusRefund
-	err = suite.service.updateOrder(context.TODO(), order)
+	helperSetOrderPrivateStatus(suite.Suite, suite.service, order, recurringpb.OrderStatusRefund)
 
 	req2 := &billingpb.CreateRefundRequest{
 		OrderId:   rsp.Uuid,
@@ -1216,8 +1215,7 @@ func (suite *RefundTestSuite) TestRefund_ListRefunds_Ok() {
 	assert.NoError(suite.T(), err)
 	assert.NotNil(suite.T(), order)
 
-	order.PrivateStatus = recurringpb.OrderStatusProjectComplete
-	err = suite.service.updateOrder(context.TODO(), order)
+	helperSetOrderPrivateStatus(suite.Suite, suite.service, order, recurringpb.OrderStatusProjectComplete)
 
 	req2 := &billingpb.CreateRefundRequest{
 		OrderId:    rsp.Uuid,
@@ -1308,8 +1306,7 @@ func (suite *RefundTestSuite) TestRefund_GetRefund_Ok() {
 	assert.NoError(suite.T(), err)
 	assert.NotNil(suite.T(), order)
 
-	order.PrivateStatus = recurringpb.OrderStatusProjectComplete
-	err = suite.service.updateOrder(context.TODO(), order)
+	helperSetOrderPrivateStatus(suite.Suite, suite.service, order, recurringpb.OrderStatusProjectComplete)
 
 	req2 := &billingpb.CreateRefundRequest{
 		OrderId:    rsp.Uuid,
@@ -0,0 +1,400 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	tools "github.com/paysuper/paysuper-tools/number"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	"math"
+	"time"
+)
+
+const (
+	rollingReserveCreateReasonMask  = "Rolling reserve of %g%% of gross revenue"
+	rollingReserveReleaseReasonMask = "Release of rolling reserve held for %d days"
+	rollingReserveLockKey           = "rolling_reserve_lock:%s"
+
+	rollingReserveLockTtl         = time.Minute
+	rollingReserveLockWaitTimeout = 5 * time.Second
+)
+
+var (
+	rollingReserveErrorPercentageInvalid = newBillingServerErrorMsg("rv000001", "percentage of rolling reserve must be between 0 and 100")
+	rollingReserveErrorHoldDaysInvalid   = newBillingServerErrorMsg("rv000002", "hold days of rolling reserve must be greater than or equal to zero")
+	rollingReserveErrorCapInvalid        = newBillingServerErrorMsg("rv000003", "cap of rolling reserve must be greater than or equal to zero")
+	rollingReserveErrorLocked            = newBillingServerErrorMsg("rv000004", "rolling reserve of merchant is locked by other process")
+)
+
+type rollingReserveQueryResItem struct {
+	Type    string  `bson:"_id"`
+	Amount  float64 `bson:"amount"`
+	Matured float64 `bson:"matured"`
+}
+
+func (s *Service) GetRollingReserveTerms(
+	ctx context.Context,
+	req *internalPkg.RollingReserveTermsRequest,
+	rsp *internalPkg.RollingReserveTermsResponse,
+) error {
+	if _, err := s.merchantRepository.GetById(ctx, req.MerchantId); err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = merchantErrorNotFound
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = s.getRollingReserveTerms(ctx, req.MerchantId)
+
+	return nil
+}
+
+// SetRollingReserveTerms sets terms of rolling reserve of merchant. New terms apply to payments
+// and releases after the change, held reserves aren't recomputed.
+func (s *Service) SetRollingReserveTerms(
+	ctx context.Context,
+	req *internalPkg.RollingReserveTerms,
+	rsp *internalPkg.RollingReserveTermsResponse,
+) error {
+	if req.Percentage < 0 || req.Percentage > 100 {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = rollingReserveErrorPercentageInvalid
+		return nil
+	}
+
+	if req.HoldDays < 0 {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = rollingReserveErrorHoldDaysInvalid
+		return nil
+	}
+
+	if req.Cap < 0 {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = rollingReserveErrorCapInvalid
+		return nil
+	}
+
+	if _, err := s.merchantRepository.GetById(ctx, req.MerchantId); err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = merchantErrorNotFound
+		return nil
+	}
+
+	req.UpdatedAt = time.Now()
+
+	if err := s.rollingReserveTermsRepository.Upsert(ctx, req); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = req
+
+	return nil
+}
+
+// GetRollingReserveAmounts returns held, releasable and pending amounts of rolling reserve of merchant
+// on the date by the hold period of current terms of merchant.
+func (s *Service) GetRollingReserveAmounts(
+	ctx context.Context,
+	req *internalPkg.RollingReserveAmountsRequest,
+	rsp *internalPkg.RollingReserveAmountsResponse,
+) error {
+	merchant, err := s.merchantRepository.GetById(ctx, req.MerchantId)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = merchantErrorNotFound
+		return nil
+	}
+
+	if merchant.GetPayoutCurrency() == "" {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = errorMerchantPayoutCurrencyNotSet
+		return nil
+	}
+
+	date := time.Now()
+
+	if req.Date > 0 {
+		date = time.Unix(req.Date, 0)
+	}
+
+	terms := s.getRollingReserveTerms(ctx, merchant.Id)
+	rsp.Item, err = s.getRollingReserveAmounts(ctx, merchant.Id, merchant.GetPayoutCurrency(), date, terms.HoldDays)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = accountingEntryErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+
+	return nil
+}
+
+// ReleaseRollingReserves books release entries of reserves which hold period is over for merchants with hold
+// period in their terms and returns the number of booked releases. Merchants which reserves couldn't be released
+// are skipped until the next run.
+func (s *Service) ReleaseRollingReserves(ctx context.Context) (int, error) {
+	counter := 0
+	items, err := s.rollingReserveTermsRepository.FindWithHoldPeriod(ctx)
+
+	if err != nil {
+		return counter, err
+	}
+
+	now := time.Now()
+
+	for _, terms := range items {
+		err = s.releaseRollingReserve(ctx, terms, now)
+
+		if err == nil {
+			counter++
+			continue
+		}
+
+		if err != mongo.ErrNoDocuments {
+			zap.L().Error(
+				"Rolling reserve of merchant not released",
+				zap.Error(err),
+				zap.String("merchant_id", terms.MerchantId),
+			)
+		}
+	}
+
+	return counter, nil
+}
+
+// releaseRollingReserve books release of reserve of the merchant which hold period is over on the date,
+// mongo.ErrNoDocuments is returned if there is nothing to release. Releasable amount is calculated and booked
+// under the lock of the merchant, so concurrent releases don't book the same reserve twice.
+func (s *Service) releaseRollingReserve(ctx context.Context, terms *internalPkg.RollingReserveTerms, date time.Time) error {
+	unlock, err := s.lockRollingReserve(ctx, terms.MerchantId)
+
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	merchant, err := s.merchantRepository.GetById(ctx, terms.MerchantId)
+
+	if err != nil {
+		return err
+	}
+
+	if merchant.GetPayoutCurrency() == "" {
+		return errorMerchantPayoutCurrencyNotSet
+	}
+
+	amounts, err := s.getRollingReserveAmounts(ctx, merchant.Id, merchant.GetPayoutCurrency(), date, terms.HoldDays)
+
+	if err != nil {
+		return err
+	}
+
+	if amounts.Releasable <= 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	handler := &accountingEntry{
+		Service:  s,
+		ctx:      ctx,
+		merchant: merchant,
+		req: &billingpb.CreateAccountingEntryRequest{
+			Type:       pkg.AccountingEntryTypeMerchantRollingReserveRelease,
+			MerchantId: merchant.Id,
+			Amount:     amounts.Releasable,
+			Currency:   amounts.Currency,
+			Reason:     fmt.Sprintf(rollingReserveReleaseReasonMask, terms.HoldDays),
+			Date:       date.Unix(),
+			Status:     pkg.BalanceTransactionStatusAvailable,
+		},
+	}
+
+	if err = handler.processManualCorrectionEvent(); err != nil {
+		return err
+	}
+
+	if err = handler.saveAccountingEntries(); err != nil {
+		return err
+	}
+
+	_, err = s.updateMerchantBalance(ctx, merchant.Id)
+
+	return err
+}
+
+// lockRollingReserve acquires lock of rolling reserve of the merchant in Redis and returns function which releases
+// the lock. Held amount of reserve is read and changed by reserves and releases only under this lock.
+func (s *Service) lockRollingReserve(ctx context.Context, merchantId string) (func(), error) {
+	unlock, ok, err := s.acquireRedisLock(
+		ctx,
+		fmt.Sprintf(rollingReserveLockKey, merchantId),
+		rollingReserveLockTtl,
+		rollingReserveLockWaitTimeout,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, rollingReserveErrorLocked
+	}
+
+	return unlock, nil
+}
+
+// getRollingReserveTerms returns rolling reserve terms of the merchant or the empty terms, which don't hold
+// anything, if merchant doesn't have them.
+func (s *Service) getRollingReserveTerms(ctx context.Context, merchantId string) *internalPkg.RollingReserveTerms {
+	terms, err := s.rollingReserveTermsRepository.GetByMerchantId(ctx, merchantId)
+
+	if err == nil {
+		return terms
+	}
+
+	if err != mongo.ErrNoDocuments {
+		zap.L().Error("rolling reserve terms of merchant not loaded", zap.Error(err), zap.String("merchant_id", merchantId))
+	}
+
+	return &internalPkg.RollingReserveTerms{MerchantId: merchantId}
+}
+
+// getRollingReserveAmounts sums reserves and releases of the merchant booked till the date. Releases are taken
+// from the oldest reserves, so reserves booked before the hold period are releasable if they weren't released yet.
+func (s *Service) getRollingReserveAmounts(
+	ctx context.Context,
+	merchantId, currency string,
+	date time.Time,
+	holdDays int32,
+) (*internalPkg.RollingReserveAmounts, error) {
+	merchantOid, _ := primitive.ObjectIDFromHex(merchantId)
+	maturedAt := date.AddDate(0, 0, -int(holdDays))
+	query := []bson.M{
+		{
+			"$match": bson.M{
+				"merchant_id": merchantOid,
+				"currency":    currency,
+				"type":        bson.M{"$in": accountingEntriesForRollingReserve},
+				"created_at":  bson.M{"$lte": date},
+			},
+		},
+		{
+			"$group": bson.M{
+				"_id":    "$type",
+				"amount": bson.M{"$sum": "$amount"},
+				"matured": bson.M{
+					"$sum": bson.M{"$cond": []interface{}{bson.M{"$lte": []interface{}{"$created_at", maturedAt}}, "$amount", 0}},
+				},
+			},
+		},
+	}
+
+	var items []*rollingReserveQueryResItem
+	cursor, err := s.db.Collection(collectionAccountingEntry).Aggregate(ctx, query)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorDatabaseQueryFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionAccountingEntry),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &items)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorQueryCursorExecutionFailed,
+			zap.Error(err),
+			zap.String(pkg.ErrorDatabaseFieldCollection, collectionAccountingEntry),
+			zap.Any(pkg.ErrorDatabaseFieldQuery, query),
+		)
+		return nil, err
+	}
+
+	var reserved, matured, released float64
+
+	for _, item := range items {
+		if item.Type == pkg.AccountingEntryTypeMerchantRollingReserveRelease {
+			released += item.Amount
+		} else {
+			reserved += item.Amount
+			matured += item.Matured
+		}
+	}
+
+	amounts := &internalPkg.RollingReserveAmounts{
+		MerchantId: merchantId,
+		Currency:   currency,
+		Date:       date,
+		Held:       tools.ToPrecise(math.Max(reserved-released, 0)),
+		Releasable: tools.ToPrecise(math.Max(matured-released, 0)),
+	}
+	amounts.Pending = tools.ToPrecise(amounts.Held - amounts.Releasable)
+
+	return amounts, nil
+}
+
+// addRollingReserveEntry holds part of gross revenue of the payment by rolling reserve terms of merchant
+// up to the cap of terms. Reserves aren't recomputed by reprocessing of accounting. Held amount is checked against
+// the cap under the lock of rolling reserve of merchant, the lock is released by processEvent after entries are saved,
+// so concurrent payments don't exceed the cap.
+func (h *accountingEntry) addRollingReserveEntry(grossRevenue float64) error {
+	if h.reprocessing || grossRevenue <= 0 {
+		return nil
+	}
+
+	terms := h.Service.getRollingReserveTerms(h.ctx, h.order.GetMerchantId())
+
+	if terms.Percentage <= 0 {
+		return nil
+	}
+
+	amount := tools.ToPrecise(grossRevenue * terms.Percentage / 100)
+
+	if terms.Cap > 0 {
+		unlock, err := h.Service.lockRollingReserve(h.ctx, h.order.GetMerchantId())
+
+		if err != nil {
+			return err
+		}
+
+		h.rollingReserveUnlock = unlock
+		amounts, err := h.Service.getRollingReserveAmounts(
+			h.ctx,
+			h.order.GetMerchantId(),
+			h.order.GetMerchantRoyaltyCurrency(),
+			time.Now(),
+			terms.HoldDays,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		amount = math.Min(amount, tools.ToPrecise(terms.Cap-amounts.Held))
+	}
+
+	if amount <= 0 {
+		return nil
+	}
+
+	entry := h.newEntry(pkg.AccountingEntryTypeMerchantRollingReserveCreate)
+	entry.Amount = amount
+	entry.Reason = fmt.Sprintf(rollingReserveCreateReasonMask, terms.Percentage)
+
+	return h.addEntry(entry)
+}
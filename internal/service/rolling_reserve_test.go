@@ -0,0 +1,346 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/mongodb"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	"github.com/paysuper/paysuper-billing-server/internal/database"
+	"github.com/paysuper/paysuper-billing-server/internal/mocks"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/internal/repository"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	casbinMocks "github.com/paysuper/paysuper-proto/go/casbinpb/mocks"
+	reportingMocks "github.com/paysuper/paysuper-proto/go/reporterpb/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	rabbitmq "gopkg.in/ProtocolONE/rabbitmq.v1/pkg"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type RollingReserveTestSuite struct {
+	suite.Suite
+	service *Service
+	log     *zap.Logger
+	cache   database.CacheInterface
+
+	merchant      *billingpb.Merchant
+	project       *billingpb.Project
+	paymentMethod *billingpb.PaymentMethod
+	paymentSystem *billingpb.PaymentSystem
+}
+
+func Test_RollingReserve(t *testing.T) {
+	suite.Run(t, new(RollingReserveTestSuite))
+}
+
+func (suite *RollingReserveTestSuite) SetupTest() {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		suite.FailNow("Config load failed", "%v", err)
+	}
+	cfg.CardPayApiUrl = "https://sandbox.cardpay.com"
+
+	m, err := migrate.New(
+		"file://../../migrations/tests",
+		cfg.MongoDsn)
+	assert.NoError(suite.T(), err, "Migrate init failed")
+
+	err = m.Up()
+	if err != nil && err.Error() != "no change" {
+		suite.FailNow("Migrations failed", "%v", err)
+	}
+
+	ctx, _ := context.WithTimeout(context.Background(), 50*time.Second)
+	opts := []mongodb.Option{mongodb.Context(ctx)}
+	db, err := mongodb.NewDatabase(opts...)
+	if err != nil {
+		suite.FailNow("Database connection failed", "%v", err)
+	}
+
+	suite.log, err = zap.NewProduction()
+
+	if err != nil {
+		suite.FailNow("Logger initialization failed", "%v", err)
+	}
+
+	broker, err := rabbitmq.NewBroker(cfg.BrokerAddress)
+
+	if err != nil {
+		suite.FailNow("Creating RabbitMQ publisher failed", "%v", err)
+	}
+
+	redisClient := database.NewRedis(
+		&redis.Options{
+			Addr:     cfg.RedisHost,
+			Password: cfg.RedisPassword,
+		},
+	)
+
+	redisdb := mocks.NewTestRedis()
+	suite.cache, err = database.NewCacheRedis(redisdb, "cache")
+	suite.service = NewBillingService(
+		db,
+		cfg,
+		mocks.NewGeoIpServiceTestOk(),
+		mocks.NewRepositoryServiceOk(),
+		mocks.NewTaxServiceOkMock(),
+		broker,
+		redisClient,
+		suite.cache,
+		mocks.NewCurrencyServiceMockOk(),
+		mocks.NewDocumentSignerMockOk(),
+		&reportingMocks.ReporterService{},
+		mocks.NewFormatterOK(),
+		mocks.NewBrokerMockOk(),
+		&casbinMocks.CasbinService{},
+	)
+
+	if err := suite.service.Init(); err != nil {
+		suite.FailNow("Billing service initialization failed", "%v", err)
+	}
+
+	suite.merchant, suite.project, suite.paymentMethod, suite.paymentSystem = helperCreateEntitiesForTests(suite.Suite, suite.service)
+
+	centrifugoMock := &mocks.CentrifugoInterface{}
+	centrifugoMock.On("GetChannelToken", mock.Anything, mock.Anything).Return("token")
+	centrifugoMock.On("Publish", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	suite.service.centrifugoDashboard = centrifugoMock
+	suite.service.centrifugoPaymentForm = centrifugoMock
+}
+
+func (suite *RollingReserveTestSuite) TearDownTest() {
+	err := suite.service.db.Drop()
+
+	if err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	err = suite.service.db.Close()
+
+	if err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *RollingReserveTestSuite) TestRollingReserve_SetRollingReserveTerms_Ok() {
+	rsp := suite.setTerms(10, 30, 1000)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	rsp = &internalPkg.RollingReserveTermsResponse{}
+	req := &internalPkg.RollingReserveTermsRequest{MerchantId: suite.merchant.Id}
+	err := suite.service.GetRollingReserveTerms(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), float64(10), rsp.Item.Percentage)
+	assert.EqualValues(suite.T(), 30, rsp.Item.HoldDays)
+	assert.Equal(suite.T(), float64(1000), rsp.Item.Cap)
+}
+
+func (suite *RollingReserveTestSuite) TestRollingReserve_SetRollingReserveTerms_Invalid() {
+	rsp := suite.setTerms(101, 30, 0)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), rollingReserveErrorPercentageInvalid, rsp.Message)
+
+	rsp = suite.setTerms(10, -1, 0)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), rollingReserveErrorHoldDaysInvalid, rsp.Message)
+
+	rsp = suite.setTerms(10, 30, -1)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), rollingReserveErrorCapInvalid, rsp.Message)
+}
+
+func (suite *RollingReserveTestSuite) TestRollingReserve_GetRollingReserveTerms_WithoutTerms() {
+	rsp := &internalPkg.RollingReserveTermsResponse{}
+	req := &internalPkg.RollingReserveTermsRequest{MerchantId: suite.merchant.Id}
+	err := suite.service.GetRollingReserveTerms(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Zero(suite.T(), rsp.Item.Percentage)
+	assert.Zero(suite.T(), rsp.Item.HoldDays)
+}
+
+func (suite *RollingReserveTestSuite) TestRollingReserve_Payment_ReserveBookedUpToCap() {
+	suite.setTerms(10, 30, 0)
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	reserves := suite.getOrderReserves(order.Id)
+	assert.Len(suite.T(), reserves, 1)
+	assert.True(suite.T(), reserves[0].Amount > 0)
+	assert.Equal(suite.T(), order.GetMerchantRoyaltyCurrency(), reserves[0].Currency)
+
+	suite.setTerms(10, 30, reserves[0].Amount)
+	order = helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	assert.Empty(suite.T(), suite.getOrderReserves(order.Id))
+}
+
+func (suite *RollingReserveTestSuite) TestRollingReserve_Payment_WithoutTerms_NotBooked() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	assert.Empty(suite.T(), suite.getOrderReserves(order.Id))
+}
+
+func (suite *RollingReserveTestSuite) TestRollingReserve_Payment_CapCheckedUnderLock() {
+	order := helperCreateAndPayOrder(suite.Suite, suite.service, 100, "RUB", "RU", suite.project, suite.paymentMethod)
+	suite.setTerms(10, 30, 1000)
+
+	unlock, err := suite.service.lockRollingReserve(context.TODO(), suite.merchant.Id)
+	assert.NoError(suite.T(), err)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*redisLockWaitInterval)
+	defer cancel()
+
+	handler := &accountingEntry{Service: suite.service, ctx: ctx, order: order, merchant: suite.merchant}
+	err = handler.addRollingReserveEntry(100)
+	assert.Equal(suite.T(), rollingReserveErrorLocked, err)
+	assert.Empty(suite.T(), handler.accountingEntries)
+
+	unlock()
+
+	handler = &accountingEntry{Service: suite.service, ctx: context.TODO(), order: order, merchant: suite.merchant}
+	err = handler.addRollingReserveEntry(100)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), handler.accountingEntries, 1)
+	assert.NotNil(suite.T(), handler.rollingReserveUnlock)
+
+	_, err = suite.service.lockRollingReserve(ctx, suite.merchant.Id)
+	assert.Equal(suite.T(), rollingReserveErrorLocked, err)
+
+	handler.rollingReserveUnlock()
+
+	unlock, err = suite.service.lockRollingReserve(context.TODO(), suite.merchant.Id)
+	assert.NoError(suite.T(), err)
+	unlock()
+}
+
+func (suite *RollingReserveTestSuite) TestRollingReserve_ReleaseRollingReserves_Ok() {
+	suite.setTerms(0, 30, 0)
+	suite.createReserve(100, time.Now().AddDate(0, 0, -40))
+	suite.createReserve(50, time.Now().AddDate(0, 0, -10))
+
+	amounts := suite.getAmounts(0)
+	assert.Equal(suite.T(), float64(150), amounts.Held)
+	assert.Equal(suite.T(), float64(100), amounts.Releasable)
+	assert.Equal(suite.T(), float64(50), amounts.Pending)
+
+	amounts = suite.getAmounts(time.Now().AddDate(0, 0, -20).Unix())
+	assert.Equal(suite.T(), float64(100), amounts.Held)
+	assert.Zero(suite.T(), amounts.Releasable)
+	assert.Equal(suite.T(), float64(100), amounts.Pending)
+
+	count, err := suite.service.ReleaseRollingReserves(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, count)
+
+	amounts = suite.getAmounts(0)
+	assert.Equal(suite.T(), float64(50), amounts.Held)
+	assert.Zero(suite.T(), amounts.Releasable)
+	assert.Equal(suite.T(), float64(50), amounts.Pending)
+
+	count, err = suite.service.ReleaseRollingReserves(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Zero(suite.T(), count)
+}
+
+func (suite *RollingReserveTestSuite) TestRollingReserve_ReleaseRollingReserves_MerchantLocked() {
+	terms := suite.setTerms(0, 30, 0).Item
+	suite.createReserve(100, time.Now().AddDate(0, 0, -40))
+
+	unlock, ok, err := suite.service.acquireRedisLock(
+		context.TODO(),
+		fmt.Sprintf(rollingReserveLockKey, suite.merchant.Id),
+		rollingReserveLockTtl,
+		rollingReserveLockWaitTimeout,
+	)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*redisLockWaitInterval)
+	defer cancel()
+
+	err = suite.service.releaseRollingReserve(ctx, terms, time.Now())
+	assert.Equal(suite.T(), rollingReserveErrorLocked, err)
+	assert.Equal(suite.T(), float64(100), suite.getAmounts(0).Releasable)
+
+	unlock()
+
+	err = suite.service.releaseRollingReserve(context.TODO(), terms, time.Now())
+	assert.NoError(suite.T(), err)
+	assert.Zero(suite.T(), suite.getAmounts(0).Releasable)
+}
+
+func (suite *RollingReserveTestSuite) TestRollingReserve_GetRollingReserveAmounts_MerchantNotFound() {
+	req := &internalPkg.RollingReserveAmountsRequest{MerchantId: primitive.NewObjectID().Hex()}
+	rsp := &internalPkg.RollingReserveAmountsResponse{}
+	err := suite.service.GetRollingReserveAmounts(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), merchantErrorNotFound, rsp.Message)
+}
+
+func (suite *RollingReserveTestSuite) setTerms(percentage float64, holdDays int32, reserveCap float64) *internalPkg.RollingReserveTermsResponse {
+	req := &internalPkg.RollingReserveTerms{
+		MerchantId: suite.merchant.Id,
+		Percentage: percentage,
+		HoldDays:   holdDays,
+		Cap:        reserveCap,
+	}
+	rsp := &internalPkg.RollingReserveTermsResponse{}
+	err := suite.service.SetRollingReserveTerms(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+
+	return rsp
+}
+
+func (suite *RollingReserveTestSuite) createReserve(amount float64, date time.Time) {
+	req := &billingpb.CreateAccountingEntryRequest{
+		Type:       pkg.AccountingEntryTypeMerchantRollingReserveCreate,
+		MerchantId: suite.merchant.Id,
+		Amount:     amount,
+		Currency:   suite.merchant.GetPayoutCurrency(),
+		Status:     pkg.BalanceTransactionStatusAvailable,
+		Date:       date.Unix(),
+		Reason:     "unit test",
+	}
+	rsp := &billingpb.CreateAccountingEntryResponse{}
+	err := suite.service.CreateAccountingEntry(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+}
+
+func (suite *RollingReserveTestSuite) getAmounts(date int64) *internalPkg.RollingReserveAmounts {
+	req := &internalPkg.RollingReserveAmountsRequest{MerchantId: suite.merchant.Id, Date: date}
+	rsp := &internalPkg.RollingReserveAmountsResponse{}
+	err := suite.service.GetRollingReserveAmounts(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	return rsp.Item
+}
+
+func (suite *RollingReserveTestSuite) getOrderReserves(orderId string) []*billingpb.AccountingEntry {
+	var entries []*billingpb.AccountingEntry
+
+	oid, _ := primitive.ObjectIDFromHex(orderId)
+	query := bson.M{
+		"source.id":   oid,
+		"source.type": repository.CollectionOrder,
+		"type":        pkg.AccountingEntryTypeMerchantRollingReserveCreate,
+	}
+	cursor, err := suite.service.db.Collection(collectionAccountingEntry).Find(context.TODO(), query)
+	assert.NoError(suite.T(), err)
+
+	err = cursor.All(context.TODO(), &entries)
+	assert.NoError(suite.T(), err)
+
+	return entries
+}
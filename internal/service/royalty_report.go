@@ -704,13 +704,20 @@ func (h *royaltyHandler) getRoyaltyReportRollingReserves(
 	}
 
 	for _, e := range accountingEntries {
+		amount := e.Amount
+
+		// released reserve is paid out to merchant, so it decreases reserved amount of report
+		if e.Type == pkg.AccountingEntryTypeMerchantRollingReserveRelease {
+			amount = -amount
+		}
+
 		entries = append(entries, &billingpb.RoyaltyReportCorrectionItem{
 			AccountingEntryId: e.Id,
-			Amount:            e.Amount,
+			Amount:            amount,
 			Reason:            e.Reason,
 			EntryDate:         e.CreatedAt,
 		})
-		total += e.Amount
+		total += amount
 	}
 
 	return
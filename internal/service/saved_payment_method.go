@@ -0,0 +1,436 @@
+package service
+
+import (
+	"context"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"github.com/paysuper/paysuper-proto/go/postmarkpb"
+	"github.com/paysuper/paysuper-proto/go/recurringpb"
+	"github.com/streadway/amqp"
+	"go.uber.org/zap"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	savedPaymentMethodNameMaxLength = 64
+)
+
+var (
+	recurringErrorIncorrectToken       = newBillingServerErrorMsg("re000006", "customer token is incorrect")
+	recurringErrorSavedCardNameTooLong = newBillingServerErrorMsg("re000007", "name of saved card must be at most 64 characters")
+)
+
+// ListSavedPaymentMethods returns saved cards of the customer, the default card goes first
+// and other cards are ordered by the last usage.
+func (s *Service) ListSavedPaymentMethods(
+	ctx context.Context,
+	req *internalPkg.SavedPaymentMethodsRequest,
+	rsp *internalPkg.SavedPaymentMethodsResponse,
+) error {
+	token, email, status, msg := s.getSavedPaymentMethodsOwner(ctx, req)
+
+	if msg != nil {
+		rsp.Status = status
+		rsp.Message = msg
+		return nil
+	}
+
+	methods, err := s.syncSavedPaymentMethods(ctx, token, email)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = recurringErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Items = methods
+
+	return nil
+}
+
+func (s *Service) SetDefaultSavedPaymentMethod(
+	ctx context.Context,
+	req *internalPkg.SavedPaymentMethodsRequest,
+	rsp *internalPkg.SavedPaymentMethodsResponse,
+) error {
+	token, email, status, msg := s.getSavedPaymentMethodsOwner(ctx, req)
+
+	if msg != nil {
+		rsp.Status = status
+		rsp.Message = msg
+		return nil
+	}
+
+	methods, err := s.syncSavedPaymentMethods(ctx, token, email)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = recurringErrorUnknown
+		return nil
+	}
+
+	if getSavedPaymentMethod(methods, req.Id) == nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = recurringSavedCardNotFount
+		return nil
+	}
+
+	if err = s.savedPaymentMethodRepository.SetDefault(ctx, token, req.Id); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = recurringErrorUnknown
+		return nil
+	}
+
+	for _, v := range methods {
+		v.IsDefault = v.Id == req.Id
+	}
+
+	sortSavedPaymentMethods(methods)
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Items = methods
+
+	return nil
+}
+
+// RenameSavedPaymentMethod sets the name of saved card given by customer, empty name removes it.
+func (s *Service) RenameSavedPaymentMethod(
+	ctx context.Context,
+	req *internalPkg.SavedPaymentMethodsRequest,
+	rsp *internalPkg.SavedPaymentMethodsResponse,
+) error {
+	if utf8.RuneCountInString(req.Name) > savedPaymentMethodNameMaxLength {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = recurringErrorSavedCardNameTooLong
+		return nil
+	}
+
+	token, email, status, msg := s.getSavedPaymentMethodsOwner(ctx, req)
+
+	if msg != nil {
+		rsp.Status = status
+		rsp.Message = msg
+		return nil
+	}
+
+	methods, err := s.syncSavedPaymentMethods(ctx, token, email)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = recurringErrorUnknown
+		return nil
+	}
+
+	method := getSavedPaymentMethod(methods, req.Id)
+
+	if method == nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = recurringSavedCardNotFount
+		return nil
+	}
+
+	method.Name = req.Name
+	method.UpdatedAt = time.Now()
+
+	if err = s.savedPaymentMethodRepository.Upsert(ctx, method); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = recurringErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Items = methods
+
+	return nil
+}
+
+// NotifyExpiringSavedCards sends letter to owners of saved cards expiring next month
+// and returns number of notified cards. Owner is notified about the card once.
+func (s *Service) NotifyExpiringSavedCards(ctx context.Context) (int, error) {
+	counter := 0
+	now := time.Now().UTC()
+	next := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1, 0)
+	methods, err := s.savedPaymentMethodRepository.FindExpiring(ctx, next.Format("01"), next.Format("2006"))
+
+	if err != nil {
+		return counter, err
+	}
+
+	for _, method := range methods {
+		payload := &postmarkpb.Payload{
+			TemplateAlias: s.cfg.EmailTemplates.SavedCardExpiring,
+			TemplateModel: map[string]string{
+				"name":         method.Name,
+				"masked_pan":   method.MaskedPan,
+				"brand":        method.Brand,
+				"expire_month": method.ExpireMonth,
+				"expire_year":  method.ExpireYear,
+			},
+			To: method.Email,
+		}
+
+		err = s.postmarkBroker.Publish(postmarkpb.PostmarkSenderTopicName, payload, amqp.Table{})
+
+		if err != nil {
+			zap.L().Error(
+				"Publication message about expiring saved card to queue failed",
+				zap.Error(err),
+				zap.String("saved_card_id", method.Id),
+			)
+			continue
+		}
+
+		notifiedAt := time.Now()
+		method.ExpirationNotifiedAt = &notifiedAt
+
+		if err = s.savedPaymentMethodRepository.Upsert(ctx, method); err != nil {
+			continue
+		}
+
+		counter++
+	}
+
+	return counter, nil
+}
+
+// getSavedPaymentMethodsOwner returns token of customer in the recurring repository and email of customer.
+// Customer is identified by the browser cookie or by the customer token if cookie isn't set.
+func (s *Service) getSavedPaymentMethodsOwner(
+	ctx context.Context,
+	req *internalPkg.SavedPaymentMethodsRequest,
+) (string, string, int32, *billingpb.ResponseErrorMessage) {
+	customerId := ""
+	virtualCustomerId := ""
+
+	if req.Cookie != "" {
+		customer, err := s.decryptBrowserCookie(req.Cookie)
+
+		if err != nil {
+			return "", "", billingpb.ResponseStatusBadData, recurringErrorIncorrectCookie
+		}
+
+		customerId = customer.CustomerId
+		virtualCustomerId = customer.VirtualCustomerId
+	} else {
+		token, err := s.getTokenBy(req.Token)
+
+		if err != nil {
+			return "", "", billingpb.ResponseStatusBadData, recurringErrorIncorrectToken
+		}
+
+		customerId = token.CustomerId
+	}
+
+	if customerId == "" && virtualCustomerId == "" {
+		return "", "", billingpb.ResponseStatusNotFound, recurringCustomerNotFound
+	}
+
+	if customerId == "" {
+		return virtualCustomerId, "", billingpb.ResponseStatusOk, nil
+	}
+
+	customer, err := s.getCustomerById(ctx, customerId)
+
+	if err != nil {
+		return "", "", billingpb.ResponseStatusNotFound, recurringCustomerNotFound
+	}
+
+	return customerId, customer.Email, billingpb.ResponseStatusOk, nil
+}
+
+// syncSavedPaymentMethods updates saved cards of the customer by the cards in the recurring repository
+// and returns them. Settings of customer for the card are kept, cards removed from the recurring repository
+// are removed too.
+func (s *Service) syncSavedPaymentMethods(
+	ctx context.Context,
+	token, email string,
+) ([]*internalPkg.SavedPaymentMethod, error) {
+	req := &recurringpb.SavedCardRequest{Token: token}
+	rsp, err := s.rep.FindSavedCards(ctx, req)
+
+	if err != nil {
+		zap.L().Error(
+			pkg.ErrorGrpcServiceCallFailed,
+			zap.Error(err),
+			zap.String(errorFieldService, recurringpb.PayOneRepositoryServiceName),
+			zap.String(errorFieldMethod, "FindSavedCards"),
+			zap.Any(errorFieldRequest, req),
+		)
+		return nil, err
+	}
+
+	stored, err := s.savedPaymentMethodRepository.FindByToken(ctx, token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	storedById := make(map[string]*internalPkg.SavedPaymentMethod, len(stored))
+
+	for _, v := range stored {
+		storedById[v.Id] = v
+	}
+
+	now := time.Now()
+	methods := make([]*internalPkg.SavedPaymentMethod, 0, len(rsp.SavedCards))
+
+	for _, card := range rsp.SavedCards {
+		month, year := getSavedCardExpire(card.Expire)
+		method, ok := storedById[card.Id]
+		changed := !ok
+
+		if !ok {
+			method = &internalPkg.SavedPaymentMethod{
+				Id:        card.Id,
+				Token:     token,
+				CreatedAt: now,
+			}
+		}
+
+		delete(storedById, card.Id)
+
+		if method.ExpireMonth != month || method.ExpireYear != year {
+			method.ExpireMonth = month
+			method.ExpireYear = year
+			method.ExpirationNotifiedAt = nil
+			changed = true
+		}
+
+		if method.ProjectId != card.ProjectId || method.MaskedPan != card.MaskedPan ||
+			method.CardHolder != card.CardHolder {
+			method.ProjectId = card.ProjectId
+			method.MaskedPan = card.MaskedPan
+			method.CardHolder = card.CardHolder
+			changed = true
+		}
+
+		if email != "" && method.Email != email {
+			method.Email = email
+			changed = true
+		}
+
+		if method.Brand == "" {
+			if binData := s.getBinData(ctx, card.MaskedPan); binData != nil {
+				method.Brand = binData.CardBrand
+				changed = true
+			}
+		}
+
+		if changed {
+			method.UpdatedAt = now
+
+			if err = s.savedPaymentMethodRepository.Upsert(ctx, method); err != nil {
+				return nil, err
+			}
+		}
+
+		methods = append(methods, method)
+	}
+
+	for id := range storedById {
+		if err = s.savedPaymentMethodRepository.Delete(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	sortSavedPaymentMethods(methods)
+
+	return methods, nil
+}
+
+// markSavedPaymentMethodUsed sets the last usage of the saved card. Card which isn't synchronized yet
+// gets the last usage on next payment.
+func (s *Service) markSavedPaymentMethodUsed(ctx context.Context, id string) {
+	method, err := s.savedPaymentMethodRepository.GetById(ctx, id)
+
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	method.LastUsedAt = &now
+	method.UpdatedAt = now
+
+	_ = s.savedPaymentMethodRepository.Upsert(ctx, method)
+}
+
+// sortSavedCards orders saved cards in the payment form like saved cards of the customer are ordered.
+func (s *Service) sortSavedCards(ctx context.Context, token string, cards []*billingpb.SavedCard) {
+	methods, err := s.savedPaymentMethodRepository.FindByToken(ctx, token)
+
+	if err != nil || len(methods) == 0 {
+		return
+	}
+
+	sortSavedPaymentMethods(methods)
+	positions := make(map[string]int, len(methods))
+
+	for i, v := range methods {
+		positions[v.Id] = i
+	}
+
+	position := func(id string) int {
+		if i, ok := positions[id]; ok {
+			return i
+		}
+
+		return len(positions)
+	}
+
+	sort.SliceStable(cards, func(i, j int) bool {
+		return position(cards[i].Id) < position(cards[j].Id)
+	})
+}
+
+func getSavedPaymentMethod(methods []*internalPkg.SavedPaymentMethod, id string) *internalPkg.SavedPaymentMethod {
+	for _, v := range methods {
+		if v.Id == id {
+			return v
+		}
+	}
+
+	return nil
+}
+
+func sortSavedPaymentMethods(methods []*internalPkg.SavedPaymentMethod) {
+	sort.SliceStable(methods, func(i, j int) bool {
+		a, b := methods[i], methods[j]
+
+		if a.IsDefault != b.IsDefault {
+			return a.IsDefault
+		}
+
+		if a.LastUsedAt != nil && b.LastUsedAt != nil && !a.LastUsedAt.Equal(*b.LastUsedAt) {
+			return a.LastUsedAt.After(*b.LastUsedAt)
+		}
+
+		if (a.LastUsedAt == nil) != (b.LastUsedAt == nil) {
+			return a.LastUsedAt != nil
+		}
+
+		return a.CreatedAt.After(b.CreatedAt)
+	})
+}
+
+// getSavedCardExpire returns expiration month and year of saved card in the format MM and YYYY.
+func getSavedCardExpire(expire *recurringpb.CardExpire) (string, string) {
+	if expire == nil {
+		return "", ""
+	}
+
+	month, year := expire.Month, expire.Year
+
+	if len(month) == 1 {
+		month = "0" + month
+	}
+
+	if len(year) == 2 {
+		year = "20" + year
+	}
+
+	return month, year
+}
@@ -0,0 +1,329 @@
+package service
+
+import (
+	"context"
+	"github.com/micro/go-micro/client"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	"github.com/paysuper/paysuper-billing-server/internal/database"
+	"github.com/paysuper/paysuper-billing-server/internal/mocks"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	casbinMocks "github.com/paysuper/paysuper-proto/go/casbinpb/mocks"
+	"github.com/paysuper/paysuper-proto/go/recurringpb"
+	reportingMocks "github.com/paysuper/paysuper-proto/go/reporterpb/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"strings"
+	"testing"
+	"time"
+)
+
+type savedPaymentMethodRepositoryServiceMock struct {
+	mocks.RepositoryServiceOk
+	cards []*recurringpb.SavedCard
+}
+
+func (r *savedPaymentMethodRepositoryServiceMock) FindSavedCards(
+	ctx context.Context,
+	in *recurringpb.SavedCardRequest,
+	opts ...client.CallOption,
+) (*recurringpb.SavedCardList, error) {
+	return &recurringpb.SavedCardList{SavedCards: r.cards}, nil
+}
+
+type SavedPaymentMethodTestSuite struct {
+	suite.Suite
+	service *Service
+	cookie  string
+	token   string
+	rep     *savedPaymentMethodRepositoryServiceMock
+}
+
+func Test_SavedPaymentMethod(t *testing.T) {
+	suite.Run(t, new(SavedPaymentMethodTestSuite))
+}
+
+func (suite *SavedPaymentMethodTestSuite) SetupTest() {
+	cfg, err := config.NewConfig()
+	assert.NoError(suite.T(), err, "Config load failed")
+
+	db, err := mongodb.NewDatabase()
+	assert.NoError(suite.T(), err, "Database connection failed")
+
+	redisdb := mocks.NewTestRedis()
+	cache, err := database.NewCacheRedis(redisdb, "cache")
+	casbin := &casbinMocks.CasbinService{}
+
+	suite.token = primitive.NewObjectID().Hex()
+	projectId := primitive.NewObjectID().Hex()
+	suite.rep = &savedPaymentMethodRepositoryServiceMock{
+		cards: []*recurringpb.SavedCard{
+			{
+				Id:          primitive.NewObjectID().Hex(),
+				Token:       suite.token,
+				ProjectId:   projectId,
+				MaskedPan:   "555555******4444",
+				CardHolder:  "MR. CARD HOLDER",
+				RecurringId: primitive.NewObjectID().Hex(),
+				Expire:      &recurringpb.CardExpire{Month: "1", Year: "21"},
+				IsActive:    true,
+			},
+			{
+				Id:          primitive.NewObjectID().Hex(),
+				Token:       suite.token,
+				ProjectId:   projectId,
+				MaskedPan:   "400000******0002",
+				CardHolder:  "MR. CARD HOLDER",
+				RecurringId: primitive.NewObjectID().Hex(),
+				Expire:      &recurringpb.CardExpire{Month: "12", Year: "2022"},
+				IsActive:    true,
+			},
+		},
+	}
+
+	suite.service = NewBillingService(
+		db,
+		cfg,
+		mocks.NewGeoIpServiceTestOk(),
+		suite.rep,
+		&mocks.TaxServiceOkMock{},
+		mocks.NewBrokerMockOk(),
+		nil,
+		cache,
+		mocks.NewCurrencyServiceMockOk(),
+		mocks.NewDocumentSignerMockOk(),
+		&reportingMocks.ReporterService{},
+		mocks.NewFormatterOK(),
+		mocks.NewBrokerMockOk(),
+		casbin,
+	)
+
+	if err := suite.service.Init(); err != nil {
+		suite.FailNow("Billing service initialization failed", "%v", err)
+	}
+
+	customer := &BrowserCookieCustomer{
+		VirtualCustomerId: suite.token,
+		Ip:                "127.0.0.1",
+		AcceptLanguage:    "fr-CA",
+		UserAgent:         "windows",
+		SessionCount:      0,
+	}
+	suite.cookie, err = suite.service.generateBrowserCookie(customer)
+	assert.NoError(suite.T(), err)
+	assert.NotEmpty(suite.T(), suite.cookie)
+}
+
+func (suite *SavedPaymentMethodTestSuite) TearDownTest() {
+	err := suite.service.db.Drop()
+
+	if err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	err = suite.service.db.Close()
+
+	if err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *SavedPaymentMethodTestSuite) TestSavedPaymentMethod_ListSavedPaymentMethods_Ok() {
+	rsp := suite.list()
+	assert.Len(suite.T(), rsp.Items, 2)
+
+	for _, v := range rsp.Items {
+		assert.Equal(suite.T(), suite.token, v.Token)
+		assert.False(suite.T(), v.IsDefault)
+		assert.Nil(suite.T(), v.LastUsedAt)
+	}
+
+	method := getSavedPaymentMethod(rsp.Items, suite.rep.cards[0].Id)
+	assert.NotNil(suite.T(), method)
+	assert.Equal(suite.T(), "555555******4444", method.MaskedPan)
+	assert.Equal(suite.T(), "01", method.ExpireMonth)
+	assert.Equal(suite.T(), "2021", method.ExpireYear)
+
+	methods, err := suite.service.savedPaymentMethodRepository.FindByToken(context.TODO(), suite.token)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), methods, 2)
+}
+
+func (suite *SavedPaymentMethodTestSuite) TestSavedPaymentMethod_ListSavedPaymentMethods_IncorrectCookie_Error() {
+	req := &internalPkg.SavedPaymentMethodsRequest{Cookie: primitive.NewObjectID().Hex()}
+	rsp := &internalPkg.SavedPaymentMethodsResponse{}
+	err := suite.service.ListSavedPaymentMethods(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), recurringErrorIncorrectCookie, rsp.Message)
+}
+
+func (suite *SavedPaymentMethodTestSuite) TestSavedPaymentMethod_ListSavedPaymentMethods_IncorrectToken_Error() {
+	req := &internalPkg.SavedPaymentMethodsRequest{Token: primitive.NewObjectID().Hex()}
+	rsp := &internalPkg.SavedPaymentMethodsResponse{}
+	err := suite.service.ListSavedPaymentMethods(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), recurringErrorIncorrectToken, rsp.Message)
+}
+
+func (suite *SavedPaymentMethodTestSuite) TestSavedPaymentMethod_ListSavedPaymentMethods_CustomerNotFound_Error() {
+	customer := &BrowserCookieCustomer{
+		CustomerId:     primitive.NewObjectID().Hex(),
+		Ip:             "127.0.0.1",
+		AcceptLanguage: "fr-CA",
+		UserAgent:      "windows",
+		SessionCount:   0,
+	}
+	cookie, err := suite.service.generateBrowserCookie(customer)
+	assert.NoError(suite.T(), err)
+
+	req := &internalPkg.SavedPaymentMethodsRequest{Cookie: cookie}
+	rsp := &internalPkg.SavedPaymentMethodsResponse{}
+	err = suite.service.ListSavedPaymentMethods(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), recurringCustomerNotFound, rsp.Message)
+}
+
+func (suite *SavedPaymentMethodTestSuite) TestSavedPaymentMethod_ListSavedPaymentMethods_RemovedCard_Ok() {
+	rsp := suite.list()
+	assert.Len(suite.T(), rsp.Items, 2)
+
+	removed := suite.rep.cards[0]
+	suite.rep.cards = suite.rep.cards[1:]
+
+	rsp = suite.list()
+	assert.Len(suite.T(), rsp.Items, 1)
+	assert.Equal(suite.T(), suite.rep.cards[0].Id, rsp.Items[0].Id)
+
+	_, err := suite.service.savedPaymentMethodRepository.GetById(context.TODO(), removed.Id)
+	assert.Equal(suite.T(), mongo.ErrNoDocuments, err)
+}
+
+func (suite *SavedPaymentMethodTestSuite) TestSavedPaymentMethod_ListSavedPaymentMethods_OrderedByLastUsage_Ok() {
+	suite.list()
+	suite.service.markSavedPaymentMethodUsed(context.TODO(), suite.rep.cards[0].Id)
+	time.Sleep(10 * time.Millisecond)
+	suite.service.markSavedPaymentMethodUsed(context.TODO(), suite.rep.cards[1].Id)
+
+	rsp := suite.list()
+	assert.Len(suite.T(), rsp.Items, 2)
+	assert.Equal(suite.T(), suite.rep.cards[1].Id, rsp.Items[0].Id)
+	assert.NotNil(suite.T(), rsp.Items[0].LastUsedAt)
+	assert.Equal(suite.T(), suite.rep.cards[0].Id, rsp.Items[1].Id)
+}
+
+func (suite *SavedPaymentMethodTestSuite) TestSavedPaymentMethod_SetDefaultSavedPaymentMethod_Ok() {
+	suite.list()
+	suite.service.markSavedPaymentMethodUsed(context.TODO(), suite.rep.cards[1].Id)
+
+	req := &internalPkg.SavedPaymentMethodsRequest{Cookie: suite.cookie, Id: suite.rep.cards[0].Id}
+	rsp := &internalPkg.SavedPaymentMethodsResponse{}
+	err := suite.service.SetDefaultSavedPaymentMethod(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Len(suite.T(), rsp.Items, 2)
+	assert.Equal(suite.T(), suite.rep.cards[0].Id, rsp.Items[0].Id)
+	assert.True(suite.T(), rsp.Items[0].IsDefault)
+	assert.False(suite.T(), rsp.Items[1].IsDefault)
+
+	req.Id = suite.rep.cards[1].Id
+	err = suite.service.SetDefaultSavedPaymentMethod(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	rsp = suite.list()
+	assert.Equal(suite.T(), suite.rep.cards[1].Id, rsp.Items[0].Id)
+	assert.True(suite.T(), rsp.Items[0].IsDefault)
+	assert.False(suite.T(), rsp.Items[1].IsDefault)
+}
+
+func (suite *SavedPaymentMethodTestSuite) TestSavedPaymentMethod_SetDefaultSavedPaymentMethod_NotFound_Error() {
+	req := &internalPkg.SavedPaymentMethodsRequest{Cookie: suite.cookie, Id: primitive.NewObjectID().Hex()}
+	rsp := &internalPkg.SavedPaymentMethodsResponse{}
+	err := suite.service.SetDefaultSavedPaymentMethod(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), recurringSavedCardNotFount, rsp.Message)
+}
+
+func (suite *SavedPaymentMethodTestSuite) TestSavedPaymentMethod_RenameSavedPaymentMethod_Ok() {
+	req := &internalPkg.SavedPaymentMethodsRequest{Cookie: suite.cookie, Id: suite.rep.cards[0].Id, Name: "Salary card"}
+	rsp := &internalPkg.SavedPaymentMethodsResponse{}
+	err := suite.service.RenameSavedPaymentMethod(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	rsp = suite.list()
+	method := getSavedPaymentMethod(rsp.Items, suite.rep.cards[0].Id)
+	assert.NotNil(suite.T(), method)
+	assert.Equal(suite.T(), "Salary card", method.Name)
+}
+
+func (suite *SavedPaymentMethodTestSuite) TestSavedPaymentMethod_RenameSavedPaymentMethod_NameTooLong_Error() {
+	req := &internalPkg.SavedPaymentMethodsRequest{
+		Cookie: suite.cookie,
+		Id:     suite.rep.cards[0].Id,
+		Name:   strings.Repeat("a", savedPaymentMethodNameMaxLength+1),
+	}
+	rsp := &internalPkg.SavedPaymentMethodsResponse{}
+	err := suite.service.RenameSavedPaymentMethod(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), recurringErrorSavedCardNameTooLong, rsp.Message)
+}
+
+func (suite *SavedPaymentMethodTestSuite) TestSavedPaymentMethod_RenameSavedPaymentMethod_NotFound_Error() {
+	req := &internalPkg.SavedPaymentMethodsRequest{Cookie: suite.cookie, Id: primitive.NewObjectID().Hex(), Name: "card"}
+	rsp := &internalPkg.SavedPaymentMethodsResponse{}
+	err := suite.service.RenameSavedPaymentMethod(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), recurringSavedCardNotFount, rsp.Message)
+}
+
+func (suite *SavedPaymentMethodTestSuite) TestSavedPaymentMethod_NotifyExpiringSavedCards_Ok() {
+	now := time.Now().UTC()
+	next := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1, 0)
+	suite.rep.cards[0].Expire = &recurringpb.CardExpire{Month: next.Format("01"), Year: next.Format("2006")}
+
+	_, err := suite.service.syncSavedPaymentMethods(context.TODO(), suite.token, "test@unit.unit")
+	assert.NoError(suite.T(), err)
+
+	count, err := suite.service.NotifyExpiringSavedCards(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, count)
+
+	method, err := suite.service.savedPaymentMethodRepository.GetById(context.TODO(), suite.rep.cards[0].Id)
+	assert.NoError(suite.T(), err)
+	assert.NotNil(suite.T(), method.ExpirationNotifiedAt)
+
+	count, err = suite.service.NotifyExpiringSavedCards(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Zero(suite.T(), count)
+}
+
+func (suite *SavedPaymentMethodTestSuite) TestSavedPaymentMethod_NotifyExpiringSavedCards_WithoutEmail_Ok() {
+	now := time.Now().UTC()
+	next := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1, 0)
+	suite.rep.cards[0].Expire = &recurringpb.CardExpire{Month: next.Format("01"), Year: next.Format("2006")}
+	suite.list()
+
+	count, err := suite.service.NotifyExpiringSavedCards(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Zero(suite.T(), count)
+}
+
+func (suite *SavedPaymentMethodTestSuite) list() *internalPkg.SavedPaymentMethodsResponse {
+	req := &internalPkg.SavedPaymentMethodsRequest{Cookie: suite.cookie}
+	rsp := &internalPkg.SavedPaymentMethodsResponse{}
+	err := suite.service.ListSavedPaymentMethods(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	return rsp
+}
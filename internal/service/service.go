@@ -87,8 +87,12 @@ type Service struct {
 	paymentMinLimitSystem           PaymentMinLimitSystemInterface
 	casbinService                   casbinpb.CasbinService
 	paymentSystemGateway            *Gateway
+	paymentSystemHealth             PaymentSystemHealthInterface
 	country                         repository.CountryRepositoryInterface
 	refundRepository                repository.RefundRepositoryInterface
+	refundItemsRepository           repository.RefundItemsRepositoryInterface
+	refundApprovalPolicyRepository  repository.PolicyRepositoryInterface
+	refundApprovalRepository        repository.RefundApprovalRepositoryInterface
 	orderRepository                 repository.OrderRepositoryInterface
 	userRoleRepository              repository.UserRoleRepositoryInterface
 	zipCodeRepository               repository.ZipCodeRepositoryInterface
@@ -100,6 +104,30 @@ type Service struct {
 	moneyBackCostMerchantRepository repository.MoneyBackCostMerchantRepositoryInterface
 	moneyBackCostSystemRepository   repository.MoneyBackCostSystemRepositoryInterface
 	project                         repository.ProjectRepositoryInterface
+	paymentRouteRepository          repository.PaymentRouteRepositoryInterface
+	orderPaymentRoutingRepository   repository.OrderPaymentRoutingRepositoryInterface
+	callbackJournalRepository       repository.CallbackJournalRepositoryInterface
+	callbackTransactionRepository   repository.CallbackTransactionRepositoryInterface
+	orderStatusEventRepository      repository.OrderStatusEventRepositoryInterface
+	projectOrderLifetimeRepository  repository.ProjectOrderLifetimeRepositoryInterface
+	subscriptionPlanRepository      repository.SubscriptionPlanRepositoryInterface
+	subscriptionRepository          repository.SubscriptionRepositoryInterface
+	dunningPolicyRepository         repository.PolicyRepositoryInterface
+	savedPaymentMethodRepository    repository.SavedPaymentMethodRepositoryInterface
+	fraudPolicyRepository           repository.PolicyRepositoryInterface
+	orderFraudCheckRepository       repository.OrderFraudCheckRepositoryInterface
+	fraudListEntryRepository        repository.FraudListEntryRepositoryInterface
+	fraudListAttemptRepository      repository.FraudListBlockedAttemptRepositoryInterface
+	disputeRepository               repository.DisputeRepositoryInterface
+	bulkRefundJobRepository         repository.BulkRefundJobRepositoryInterface
+	duplicatePolicyRepository       repository.PolicyRepositoryInterface
+	duplicatePaymentRepository      repository.DuplicatePaymentRepositoryInterface
+	ledgerEntryRepository           repository.LedgerEntryRepositoryInterface
+	accountingExportRepository      repository.AccountingExportRepositoryInterface
+	correctionBatchRepository       repository.AccountingCorrectionBatchRepositoryInterface
+	rollingReserveTermsRepository   repository.RollingReserveTermsRepositoryInterface
+	paymentCaptureRepository        repository.PaymentCaptureRepositoryInterface
+	virtualCurrencyHoldRepository   repository.VirtualCurrencyHoldRepositoryInterface
 }
 
 func newBillingServerResponseError(status int32, message *billingpb.ResponseErrorMessage) *billingpb.ResponseError {
@@ -174,9 +202,13 @@ func (s *Service) Init() (err error) {
 	s.paylinkService = newPaylinkService(s)
 	s.operatingCompany = newOperatingCompanyService(s)
 	s.paymentMinLimitSystem = newPaymentMinLimitSystem(s)
+	s.paymentSystemHealth = newPaymentSystemHealth(s.cfg.PaymentSystemConfig)
 	s.paymentSystemGateway = s.newPaymentSystemGateway()
 
 	s.refundRepository = repository.NewRefundRepository(s.db)
+	s.refundItemsRepository = repository.NewRefundItemsRepository(s.db)
+	s.refundApprovalPolicyRepository = repository.NewRefundApprovalPolicyRepository(s.db)
+	s.refundApprovalRepository = repository.NewRefundApprovalRepository(s.db)
 	s.orderRepository = repository.NewOrderRepository(s.db)
 	s.country = repository.NewCountryRepository(s.db, s.cacher)
 	s.userRoleRepository = repository.NewUserRoleRepository(s.db, s.cacher)
@@ -189,6 +221,30 @@ func (s *Service) Init() (err error) {
 	s.moneyBackCostMerchantRepository = repository.NewMoneyBackCostMerchantRepository(s.db, s.cacher)
 	s.moneyBackCostSystemRepository = repository.NewMoneyBackCostSystemRepository(s.db, s.cacher)
 	s.project = repository.NewProjectRepository(s.db, s.cacher)
+	s.paymentRouteRepository = repository.NewPaymentRouteRepository(s.db)
+	s.orderPaymentRoutingRepository = repository.NewOrderPaymentRoutingRepository(s.db)
+	s.callbackJournalRepository = repository.NewCallbackJournalRepository(s.db)
+	s.callbackTransactionRepository = repository.NewCallbackTransactionRepository(s.db)
+	s.orderStatusEventRepository = repository.NewOrderStatusEventRepository(s.db)
+	s.projectOrderLifetimeRepository = repository.NewProjectOrderLifetimeRepository(s.db)
+	s.subscriptionPlanRepository = repository.NewSubscriptionPlanRepository(s.db)
+	s.subscriptionRepository = repository.NewSubscriptionRepository(s.db)
+	s.dunningPolicyRepository = repository.NewDunningPolicyRepository(s.db)
+	s.savedPaymentMethodRepository = repository.NewSavedPaymentMethodRepository(s.db)
+	s.fraudPolicyRepository = repository.NewFraudPolicyRepository(s.db)
+	s.orderFraudCheckRepository = repository.NewOrderFraudCheckRepository(s.db)
+	s.fraudListEntryRepository = repository.NewFraudListEntryRepository(s.db)
+	s.fraudListAttemptRepository = repository.NewFraudListBlockedAttemptRepository(s.db)
+	s.disputeRepository = repository.NewDisputeRepository(s.db)
+	s.bulkRefundJobRepository = repository.NewBulkRefundJobRepository(s.db)
+	s.duplicatePolicyRepository = repository.NewDuplicatePaymentPolicyRepository(s.db)
+	s.duplicatePaymentRepository = repository.NewDuplicatePaymentRepository(s.db)
+	s.ledgerEntryRepository = repository.NewLedgerEntryRepository(s.db)
+	s.accountingExportRepository = repository.NewAccountingExportRepository(s.db)
+	s.correctionBatchRepository = repository.NewAccountingCorrectionBatchRepository(s.db)
+	s.rollingReserveTermsRepository = repository.NewRollingReserveTermsRepository(s.db)
+	s.paymentCaptureRepository = repository.NewPaymentCaptureRepository(s.db)
+	s.virtualCurrencyHoldRepository = repository.NewVirtualCurrencyHoldRepository(s.db)
 
 	sCurr, err := s.curService.GetSupportedCurrencies(context.TODO(), &currenciespb.EmptyRequest{})
 	if err != nil {
@@ -0,0 +1,1091 @@
+package service
+
+import (
+	"context"
+	"github.com/google/uuid"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	"github.com/paysuper/paysuper-proto/go/recurringpb"
+	tools "github.com/paysuper/paysuper-tools/number"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"strconv"
+	"time"
+)
+
+const (
+	subscriptionOrderMetadataId      = "SubscriptionId"
+	subscriptionOrderMetadataPayment = "SubscriptionPayment"
+	subscriptionOrderMetadataCredit  = "SubscriptionCredit"
+	subscriptionOrderMetadataClaim   = "SubscriptionClaim"
+
+	subscriptionOrderProcessAttempts = 3
+)
+
+var (
+	subscriptionErrorPlanNotFound            = newBillingServerErrorMsg("sb000001", "subscription plan not found")
+	subscriptionErrorPlanInactive            = newBillingServerErrorMsg("sb000002", "subscription plan is inactive")
+	subscriptionErrorPlanIntervalInvalid     = newBillingServerErrorMsg("sb000003", "billing interval of subscription plan is invalid")
+	subscriptionErrorPlanTrialInvalid        = newBillingServerErrorMsg("sb000004", "trial period of subscription plan must be greater than or equal to zero")
+	subscriptionErrorPlanPricesInvalid       = newBillingServerErrorMsg("sb000005", "subscription plan must have positive price for at least one price group")
+	subscriptionErrorPriceNotFound           = newBillingServerErrorMsg("sb000006", "subscription plan has no price for price group of customer")
+	subscriptionErrorNotFound                = newBillingServerErrorMsg("sb000007", "subscription not found")
+	subscriptionErrorUserRequired            = newBillingServerErrorMsg("sb000008", "identifier and email of customer are required for subscription")
+	subscriptionErrorTrialRequiresStoredCard = newBillingServerErrorMsg("sb000009", "subscription with trial period requires saved card of customer")
+	subscriptionErrorStatusInvalid           = newBillingServerErrorMsg("sb000010", "action isn't allowed in the current status of subscription")
+	subscriptionErrorChargeFailed            = newBillingServerErrorMsg("sb000011", "charge of subscription failed")
+
+	subscriptionIntervals = map[string]bool{
+		internalPkg.SubscriptionIntervalDay:   true,
+		internalPkg.SubscriptionIntervalWeek:  true,
+		internalPkg.SubscriptionIntervalMonth: true,
+		internalPkg.SubscriptionIntervalYear:  true,
+	}
+)
+
+func (s *Service) CreateOrUpdateSubscriptionPlan(
+	ctx context.Context,
+	req *internalPkg.SubscriptionPlan,
+	rsp *internalPkg.SubscriptionPlanResponse,
+) error {
+	project, err := s.project.GetById(ctx, req.ProjectId)
+
+	if err != nil || project.MerchantId != req.MerchantId {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = projectErrorNotFound
+		return nil
+	}
+
+	if req.IntervalCount == 0 {
+		req.IntervalCount = 1
+	}
+
+	if !subscriptionIntervals[req.Interval] || req.IntervalCount < 0 {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = subscriptionErrorPlanIntervalInvalid
+		return nil
+	}
+
+	if req.TrialDays < 0 {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = subscriptionErrorPlanTrialInvalid
+		return nil
+	}
+
+	if len(req.Prices) == 0 {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = subscriptionErrorPlanPricesInvalid
+		return nil
+	}
+
+	for _, price := range req.Prices {
+		if price.Amount <= 0 || price.Currency == "" || price.Region == "" {
+			rsp.Status = billingpb.ResponseStatusBadData
+			rsp.Message = subscriptionErrorPlanPricesInvalid
+			return nil
+		}
+	}
+
+	req.UpdatedAt = time.Now()
+
+	if req.Id == "" {
+		req.Id = primitive.NewObjectID().Hex()
+		req.CreatedAt = req.UpdatedAt
+		err = s.subscriptionPlanRepository.Insert(ctx, req)
+	} else {
+		plan, gErr := s.subscriptionPlanRepository.GetById(ctx, req.Id)
+
+		if gErr != nil || plan.ProjectId != req.ProjectId {
+			rsp.Status = billingpb.ResponseStatusNotFound
+			rsp.Message = subscriptionErrorPlanNotFound
+			return nil
+		}
+
+		req.CreatedAt = plan.CreatedAt
+		err = s.subscriptionPlanRepository.Update(ctx, req)
+	}
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = req
+
+	return nil
+}
+
+func (s *Service) GetSubscriptionPlans(
+	ctx context.Context,
+	req *internalPkg.ListSubscriptionPlansRequest,
+	rsp *internalPkg.ListSubscriptionPlansResponse,
+) error {
+	plans, err := s.subscriptionPlanRepository.FindByProjectId(ctx, req.ProjectId)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Items = plans
+
+	return nil
+}
+
+// CreateSubscription subscribes customer to the plan from the payment form. Subscription with the saved card
+// starts trial period or is charged immediately, otherwise the first order is created which customer has to pay
+// on the payment form with saving of card.
+func (s *Service) CreateSubscription(
+	ctx context.Context,
+	req *internalPkg.CreateSubscriptionRequest,
+	rsp *internalPkg.CreateSubscriptionResponse,
+) error {
+	if req.User == nil || req.User.Id == "" || req.User.Email == "" {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = subscriptionErrorUserRequired
+		return nil
+	}
+
+	plan, err := s.subscriptionPlanRepository.GetById(ctx, req.PlanId)
+
+	if err != nil || plan.ProjectId != req.ProjectId {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = subscriptionErrorPlanNotFound
+		return nil
+	}
+
+	if !plan.IsActive {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = subscriptionErrorPlanInactive
+		return nil
+	}
+
+	price, err := s.getSubscriptionPlanPrice(ctx, plan, req.User.GetCountry())
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = err.(*billingpb.ResponseErrorMessage)
+		return nil
+	}
+
+	now := time.Now()
+	subscription := &internalPkg.Subscription{
+		Id:         primitive.NewObjectID().Hex(),
+		PlanId:     plan.Id,
+		MerchantId: plan.MerchantId,
+		ProjectId:  plan.ProjectId,
+		User:       req.User,
+		Status:     internalPkg.SubscriptionStatusIncomplete,
+		Amount:     price.Amount,
+		Currency:   price.Currency,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	if req.StoredCardId != "" {
+		card, msg := s.getSubscriptionCard(ctx, req.User.Id, req.StoredCardId)
+
+		if msg != nil {
+			rsp.Status = billingpb.ResponseStatusBadData
+			rsp.Message = msg
+			return nil
+		}
+
+		subscription.Card = card
+	}
+
+	if plan.TrialDays > 0 {
+		if subscription.Card == nil {
+			rsp.Status = billingpb.ResponseStatusBadData
+			rsp.Message = subscriptionErrorTrialRequiresStoredCard
+			return nil
+		}
+
+		trialEnd := now.AddDate(0, 0, int(plan.TrialDays))
+		subscription.Status = internalPkg.SubscriptionStatusTrial
+		subscription.TrialEnd = &trialEnd
+		subscription.CurrentPeriodStart = now
+		subscription.CurrentPeriodEnd = trialEnd
+		subscription.NextBillingAt = trialEnd
+	}
+
+	if err = s.subscriptionRepository.Insert(ctx, subscription); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	if subscription.Status == internalPkg.SubscriptionStatusTrial {
+		rsp.Status = billingpb.ResponseStatusOk
+		rsp.Item = subscription
+		return nil
+	}
+
+	var order *billingpb.Order
+
+	if subscription.Card != nil {
+		order, err = s.chargeSubscription(ctx, subscription, plan, subscription.Amount, internalPkg.SubscriptionPaymentInitial)
+	} else {
+		order, err = s.createSubscriptionOrder(ctx, subscription, plan, subscription.Amount, internalPkg.SubscriptionPaymentInitial)
+	}
+
+	if order != nil {
+		subscription.LastOrderId = order.Id
+	}
+
+	if err != nil {
+		zap.L().Error(
+			"first payment of subscription failed",
+			zap.Error(err),
+			zap.String("subscription_id", subscription.Id),
+		)
+
+		canceledAt := time.Now()
+		subscription.Status = internalPkg.SubscriptionStatusCanceled
+		subscription.CanceledAt = &canceledAt
+		subscription.LastChargeError = err.Error()
+		subscription.UpdatedAt = canceledAt
+		_ = s.subscriptionRepository.Update(ctx, subscription)
+
+		if e, ok := err.(*billingpb.ResponseErrorMessage); ok {
+			rsp.Status = billingpb.ResponseStatusBadData
+			rsp.Message = e
+			return nil
+		}
+
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = subscriptionErrorChargeFailed
+		return nil
+	}
+
+	if err = s.subscriptionRepository.Update(ctx, subscription); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = subscription
+	rsp.OrderId = order.Uuid
+
+	return nil
+}
+
+func (s *Service) GetSubscription(
+	ctx context.Context,
+	req *internalPkg.SubscriptionRequest,
+	rsp *internalPkg.SubscriptionResponse,
+) error {
+	subscription, err := s.getMerchantSubscription(ctx, req)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = subscriptionErrorNotFound
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = subscription
+
+	return nil
+}
+
+// CancelSubscription cancels subscription immediately or at the end of current period, paid period isn't refunded.
+func (s *Service) CancelSubscription(
+	ctx context.Context,
+	req *internalPkg.SubscriptionRequest,
+	rsp *internalPkg.SubscriptionResponse,
+) error {
+	subscription, err := s.getMerchantSubscription(ctx, req)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = subscriptionErrorNotFound
+		return nil
+	}
+
+	if subscription.Status == internalPkg.SubscriptionStatusCanceled {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = subscriptionErrorStatusInvalid
+		return nil
+	}
+
+	now := time.Now()
+
+	if req.AtPeriodEnd && (subscription.Status == internalPkg.SubscriptionStatusTrial ||
+		subscription.Status == internalPkg.SubscriptionStatusActive) {
+		subscription.CancelAtPeriodEnd = true
+	} else {
+		subscription.Status = internalPkg.SubscriptionStatusCanceled
+		subscription.CanceledAt = &now
+	}
+
+	subscription.UpdatedAt = now
+
+	if err = s.subscriptionRepository.Update(ctx, subscription); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = subscription
+
+	return nil
+}
+
+// PauseSubscription stops renewals of subscription, the rest of current period is kept until subscription is resumed.
+func (s *Service) PauseSubscription(
+	ctx context.Context,
+	req *internalPkg.SubscriptionRequest,
+	rsp *internalPkg.SubscriptionResponse,
+) error {
+	subscription, err := s.getMerchantSubscription(ctx, req)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = subscriptionErrorNotFound
+		return nil
+	}
+
+	if subscription.Status != internalPkg.SubscriptionStatusTrial &&
+		subscription.Status != internalPkg.SubscriptionStatusActive &&
+		subscription.Status != internalPkg.SubscriptionStatusPastDue {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = subscriptionErrorStatusInvalid
+		return nil
+	}
+
+	now := time.Now()
+	subscription.StatusBeforePause = subscription.Status
+	subscription.Status = internalPkg.SubscriptionStatusPaused
+	subscription.PausedAt = &now
+	subscription.UpdatedAt = now
+
+	if err = s.subscriptionRepository.Update(ctx, subscription); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = subscription
+
+	return nil
+}
+
+// ResumeSubscription restores status of paused subscription, current period is prolonged by the time of pause.
+func (s *Service) ResumeSubscription(
+	ctx context.Context,
+	req *internalPkg.SubscriptionRequest,
+	rsp *internalPkg.SubscriptionResponse,
+) error {
+	subscription, err := s.getMerchantSubscription(ctx, req)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = subscriptionErrorNotFound
+		return nil
+	}
+
+	if subscription.Status != internalPkg.SubscriptionStatusPaused {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = subscriptionErrorStatusInvalid
+		return nil
+	}
+
+	now := time.Now()
+	paused := now.Sub(*subscription.PausedAt)
+
+	if subscription.StatusBeforePause != internalPkg.SubscriptionStatusPastDue && paused > 0 {
+		subscription.CurrentPeriodEnd = subscription.CurrentPeriodEnd.Add(paused)
+		subscription.NextBillingAt = subscription.NextBillingAt.Add(paused)
+
+		if subscription.TrialEnd != nil {
+			trialEnd := subscription.TrialEnd.Add(paused)
+			subscription.TrialEnd = &trialEnd
+		}
+	}
+
+	subscription.Status = subscription.StatusBeforePause
+	subscription.StatusBeforePause = ""
+	subscription.PausedAt = nil
+	subscription.UpdatedAt = now
+
+	if err = s.subscriptionRepository.Update(ctx, subscription); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = subscription
+
+	return nil
+}
+
+// UpdateSubscriptionCard replaces the card which is charged for renewals of subscription by other saved card
+// of customer. Failed renewal payment of past due subscription is retried with the new card by next run of daemon.
+func (s *Service) UpdateSubscriptionCard(
+	ctx context.Context,
+	req *internalPkg.UpdateSubscriptionCardRequest,
+	rsp *internalPkg.SubscriptionResponse,
+) error {
+	subscription, err := s.subscriptionRepository.GetById(ctx, req.SubscriptionId)
+
+	if err != nil || subscription.User == nil || subscription.User.Id != req.UserId {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = subscriptionErrorNotFound
+		return nil
+	}
+
+	if subscription.Status == internalPkg.SubscriptionStatusCanceled {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = subscriptionErrorStatusInvalid
+		return nil
+	}
+
+	card, msg := s.getSubscriptionCard(ctx, req.UserId, req.StoredCardId)
+
+	if msg != nil {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = msg
+		return nil
+	}
+
+	now := time.Now()
+	subscription.Card = card
+	subscription.PaymentMethodId = ""
+	subscription.UpdatedAt = now
+
+	if subscription.Status == internalPkg.SubscriptionStatusPastDue && subscription.PendingOrderId == "" {
+		subscription.RetryAt = now
+	}
+
+	if err = s.subscriptionRepository.Update(ctx, subscription); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = subscription
+
+	return nil
+}
+
+// ChangeSubscriptionPlan moves subscription to other plan of the project. If new plan is prorated, difference
+// of prices for the rest of current period is charged immediately or credited to the balance of subscription
+// which is spent on next renewals. Otherwise price of new plan is charged from the next period.
+func (s *Service) ChangeSubscriptionPlan(
+	ctx context.Context,
+	req *internalPkg.SubscriptionRequest,
+	rsp *internalPkg.SubscriptionResponse,
+) error {
+	subscription, err := s.getMerchantSubscription(ctx, req)
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = subscriptionErrorNotFound
+		return nil
+	}
+
+	if subscription.Status != internalPkg.SubscriptionStatusTrial &&
+		subscription.Status != internalPkg.SubscriptionStatusActive {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = subscriptionErrorStatusInvalid
+		return nil
+	}
+
+	plan, err := s.subscriptionPlanRepository.GetById(ctx, req.PlanId)
+
+	if err != nil || plan.ProjectId != subscription.ProjectId {
+		rsp.Status = billingpb.ResponseStatusNotFound
+		rsp.Message = subscriptionErrorPlanNotFound
+		return nil
+	}
+
+	if !plan.IsActive {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = subscriptionErrorPlanInactive
+		return nil
+	}
+
+	price, err := s.getSubscriptionPlanPrice(ctx, plan, subscription.User.GetCountry())
+
+	if err != nil {
+		rsp.Status = billingpb.ResponseStatusBadData
+		rsp.Message = err.(*billingpb.ResponseErrorMessage)
+		return nil
+	}
+
+	now := time.Now()
+	amount := float64(0)
+	period := subscription.CurrentPeriodEnd.Sub(subscription.CurrentPeriodStart)
+	remaining := subscription.CurrentPeriodEnd.Sub(now)
+
+	if plan.Proration && subscription.Status == internalPkg.SubscriptionStatusActive &&
+		price.Currency == subscription.Currency && period > 0 && remaining > 0 {
+		amount = tools.FormatAmount((price.Amount - subscription.Amount) * remaining.Seconds() / period.Seconds())
+	}
+
+	subscription.PlanId = plan.Id
+	subscription.Amount = price.Amount
+	subscription.Currency = price.Currency
+
+	if amount < 0 {
+		subscription.Balance = tools.FormatAmount(subscription.Balance - amount)
+	}
+
+	if amount > 0 {
+		order, err := s.chargeSubscription(ctx, subscription, plan, amount, internalPkg.SubscriptionPaymentProration)
+
+		if err != nil {
+			zap.L().Error(
+				"proration payment of subscription failed",
+				zap.Error(err),
+				zap.String("subscription_id", subscription.Id),
+				zap.String("plan_id", plan.Id),
+			)
+
+			if e, ok := err.(*billingpb.ResponseErrorMessage); ok {
+				rsp.Status = billingpb.ResponseStatusBadData
+				rsp.Message = e
+				return nil
+			}
+
+			rsp.Status = billingpb.ResponseStatusSystemError
+			rsp.Message = subscriptionErrorChargeFailed
+			return nil
+		}
+
+		subscription.LastOrderId = order.Id
+	}
+
+	subscription.UpdatedAt = now
+
+	if err = s.subscriptionRepository.Update(ctx, subscription); err != nil {
+		rsp.Status = billingpb.ResponseStatusSystemError
+		rsp.Message = orderErrorUnknown
+		return nil
+	}
+
+	rsp.Status = billingpb.ResponseStatusOk
+	rsp.Item = subscription
+
+	return nil
+}
+
+// ChargeSubscriptions creates renewal payments of subscriptions which current period is over and retries failed
+// renewal payments by dunning policy, returns number of charged subscriptions. Subscriptions canceled at the end
+// of period are finished.
+func (s *Service) ChargeSubscriptions(ctx context.Context) (int, error) {
+	now := time.Now()
+	subscriptions, err := s.subscriptionRepository.FindDue(ctx, now)
+
+	if err != nil {
+		return 0, err
+	}
+
+	retries, err := s.subscriptionRepository.FindRetryDue(ctx, now)
+
+	if err != nil {
+		return 0, err
+	}
+
+	subscriptions = append(subscriptions, retries...)
+
+	counter := 0
+
+	for _, v := range subscriptions {
+		claimId := uuid.New().String()
+		subscription, err := s.subscriptionRepository.Claim(ctx, v.Id, claimId, time.Now())
+
+		if err != nil || subscription == nil {
+			// subscription is charged by other process or waits for result of payment
+			continue
+		}
+
+		if !isSubscriptionDue(subscription, now) {
+			_ = s.subscriptionRepository.ReleasePendingOrder(ctx, subscription.Id, claimId)
+			continue
+		}
+
+		if subscription.CancelAtPeriodEnd {
+			now := time.Now()
+			subscription.Status = internalPkg.SubscriptionStatusCanceled
+			subscription.CanceledAt = &now
+			subscription.UpdatedAt = now
+			_ = s.subscriptionRepository.Update(ctx, subscription)
+			_ = s.subscriptionRepository.ReleasePendingOrder(ctx, subscription.Id, claimId)
+			continue
+		}
+
+		if err := s.renewSubscription(ctx, subscription, claimId); err == nil {
+			counter++
+		}
+	}
+
+	return counter, nil
+}
+
+// renewSubscription charges the price of subscription claimed by the claim identifier for the next period reduced
+// by its balance. Period is started without payment if the balance covers its price, otherwise period is started
+// when the renewal order is paid.
+func (s *Service) renewSubscription(ctx context.Context, subscription *internalPkg.Subscription, claimId string) error {
+	plan, err := s.subscriptionPlanRepository.GetById(ctx, subscription.PlanId)
+
+	if err != nil {
+		zap.L().Error("subscription plan not found", zap.Error(err), zap.String("subscription_id", subscription.Id))
+		_ = s.subscriptionRepository.ReleasePendingOrder(ctx, subscription.Id, claimId)
+		return err
+	}
+
+	amount := tools.FormatAmount(subscription.Amount - subscription.Balance)
+
+	if amount <= 0 {
+		subscription.Balance = tools.FormatAmount(subscription.Balance - subscription.Amount)
+		startSubscriptionPeriod(subscription, plan, subscription.NextBillingAt)
+		subscription.UpdatedAt = time.Now()
+		err = s.subscriptionRepository.Update(ctx, subscription)
+		_ = s.subscriptionRepository.ReleasePendingOrder(ctx, subscription.Id, claimId)
+		return err
+	}
+
+	order, err := s.chargeSubscription(ctx, subscription, plan, amount, internalPkg.SubscriptionPaymentRenewal)
+
+	if order != nil {
+		subscription.LastOrderId = order.Id
+	}
+
+	if err != nil {
+		zap.L().Error(
+			"renewal payment of subscription failed",
+			zap.Error(err),
+			zap.String("subscription_id", subscription.Id),
+		)
+		s.failSubscriptionRenewal(ctx, subscription, "", err.Error())
+		_ = s.subscriptionRepository.ReleasePendingOrder(ctx, subscription.Id, claimId)
+		return err
+	}
+
+	// result of payment could be already processed and the claim released, pending order isn't set then
+	_, err = s.subscriptionRepository.SetPendingOrder(ctx, subscription.Id, claimId, order.Id)
+
+	return err
+}
+
+// isSubscriptionDue checks the subscription has to be renewed or its failed renewal payment has to be retried.
+func isSubscriptionDue(subscription *internalPkg.Subscription, now time.Time) bool {
+	switch subscription.Status {
+	case internalPkg.SubscriptionStatusTrial, internalPkg.SubscriptionStatusActive:
+		return !subscription.NextBillingAt.After(now)
+	case internalPkg.SubscriptionStatusPastDue:
+		return !subscription.RetryAt.After(now)
+	}
+
+	return false
+}
+
+// createSubscriptionOrder creates order to pay for the subscription, order is linked with subscription
+// by its private metadata.
+func (s *Service) createSubscriptionOrder(
+	ctx context.Context,
+	subscription *internalPkg.Subscription,
+	plan *internalPkg.SubscriptionPlan,
+	amount float64,
+	payment string,
+) (*billingpb.Order, error) {
+	metadata := map[string]string{
+		subscriptionOrderMetadataId:      subscription.Id,
+		subscriptionOrderMetadataPayment: payment,
+	}
+
+	if payment == internalPkg.SubscriptionPaymentRenewal && amount < subscription.Amount {
+		metadata[subscriptionOrderMetadataCredit] = strconv.FormatFloat(subscription.Amount-amount, 'f', -1, 64)
+	}
+
+	if payment == internalPkg.SubscriptionPaymentRenewal && subscription.PendingOrderId != "" {
+		// renewal is charged by the claim of subscription, the claim is released by result of payment
+		// if it comes before the order is set as pending order of subscription
+		metadata[subscriptionOrderMetadataClaim] = subscription.PendingOrderId
+	}
+
+	req := &billingpb.OrderCreateRequest{
+		Type:        pkg.OrderType_simple,
+		ProjectId:   subscription.ProjectId,
+		Amount:      amount,
+		Currency:    subscription.Currency,
+		Account:     subscription.User.Id,
+		Description: plan.Name,
+		User: &billingpb.OrderUser{
+			Id:      subscription.User.Id,
+			Email:   subscription.User.Email,
+			Ip:      subscription.User.Ip,
+			Locale:  subscription.User.Locale,
+			Address: subscription.User.Address,
+		},
+		PrivateMetadata: metadata,
+	}
+	rsp := &billingpb.OrderCreateProcessResponse{}
+
+	if err := s.OrderCreateProcess(ctx, req, rsp); err != nil {
+		return nil, err
+	}
+
+	if rsp.Status != billingpb.ResponseStatusOk {
+		return nil, rsp.Message
+	}
+
+	return rsp.Item, nil
+}
+
+// chargeSubscription creates order of subscription and payment of it by the saved card through the payment system
+// handler which issued recurring identifier of the card. Result of payment comes with payment notification.
+func (s *Service) chargeSubscription(
+	ctx context.Context,
+	subscription *internalPkg.Subscription,
+	plan *internalPkg.SubscriptionPlan,
+	amount float64,
+	payment string,
+) (*billingpb.Order, error) {
+	if subscription.Card == nil || subscription.Card.RecurringId == "" {
+		return nil, subscriptionErrorChargeFailed
+	}
+
+	order, err := s.createSubscriptionOrder(ctx, subscription, plan, amount, payment)
+
+	if err != nil {
+		return nil, err
+	}
+
+	paymentMethodId := subscription.PaymentMethodId
+
+	if paymentMethodId == "" {
+		pm, err := s.paymentMethod.GetByGroupAndCurrency(
+			ctx,
+			order.IsProduction,
+			recurringpb.PaymentSystemGroupAliasBankCard,
+			order.Currency,
+		)
+
+		if err != nil {
+			return order, orderErrorPaymentMethodNotFound
+		}
+
+		paymentMethodId = pm.Id
+	}
+
+	req := &billingpb.PaymentCreateRequest{
+		Data: map[string]string{
+			billingpb.PaymentCreateFieldOrderId:         order.Uuid,
+			billingpb.PaymentCreateFieldPaymentMethodId: paymentMethodId,
+			billingpb.PaymentCreateFieldEmail:           subscription.User.Email,
+		},
+		Ip: subscription.User.Ip,
+	}
+
+	if address := subscription.User.Address; address != nil {
+		req.Data[billingpb.PaymentCreateFieldUserCountry] = address.Country
+		req.Data[billingpb.PaymentCreateFieldUserZip] = address.PostalCode
+	}
+
+	card := &recurringpb.SavedCard{
+		Token:       subscription.User.Id,
+		ProjectId:   subscription.ProjectId,
+		MerchantId:  subscription.MerchantId,
+		MaskedPan:   subscription.Card.MaskedPan,
+		CardHolder:  subscription.Card.CardHolder,
+		RecurringId: subscription.Card.RecurringId,
+		Expire: &recurringpb.CardExpire{
+			Month: subscription.Card.ExpireMonth,
+			Year:  subscription.Card.ExpireYear,
+		},
+	}
+	rsp := &billingpb.PaymentCreateResponse{}
+
+	if err = s.paymentCreateProcess(ctx, req, rsp, card); err != nil {
+		return order, err
+	}
+
+	if rsp.Status != billingpb.ResponseStatusOk {
+		return order, rsp.Message
+	}
+
+	return order, nil
+}
+
+// processSubscriptionOrder updates subscription by the result of payment of its order. Card saved by the first
+// payment is used for renewals, subscription which first payment didn't save the card is finished
+// at the end of paid period. Subscription changed by other process while the result was applied
+// is read and updated again.
+func (s *Service) processSubscriptionOrder(ctx context.Context, order *billingpb.Order, recurringId string) {
+	for i := 0; i < subscriptionOrderProcessAttempts; i++ {
+		if s.applySubscriptionOrder(ctx, order, recurringId) {
+			return
+		}
+	}
+
+	zap.L().Error(
+		"subscription wasn't updated by the result of payment",
+		zap.String("order_id", order.Id),
+		zap.String("subscription_id", order.PrivateMetadata[subscriptionOrderMetadataId]),
+	)
+}
+
+// applySubscriptionOrder applies the result of payment of the order to its subscription once.
+// Returns false if status or period of the subscription was changed by other process after it was read.
+func (s *Service) applySubscriptionOrder(ctx context.Context, order *billingpb.Order, recurringId string) bool {
+	id := order.PrivateMetadata[subscriptionOrderMetadataId]
+
+	if id == "" {
+		return true
+	}
+
+	isPaid := order.PrivateStatus == recurringpb.OrderStatusPaymentSystemComplete
+
+	if !isPaid && getOrderPublicStatus(order) != recurringpb.OrderPublicStatusCanceled &&
+		getOrderPublicStatus(order) != recurringpb.OrderPublicStatusRejected {
+		return true
+	}
+
+	subscription, err := s.subscriptionRepository.GetById(ctx, id)
+
+	if err != nil {
+		zap.L().Error("subscription of order not found", zap.Error(err), zap.String("order_id", order.Id))
+		return true
+	}
+
+	// repeated notification about the result of payment mustn't start period or charge balance again
+	if subscription.LastProcessedOrderId == order.Id {
+		return true
+	}
+
+	status, periodEnd := subscription.Status, subscription.CurrentPeriodEnd
+
+	plan, err := s.subscriptionPlanRepository.GetById(ctx, subscription.PlanId)
+
+	if err != nil {
+		zap.L().Error("subscription plan not found", zap.Error(err), zap.String("subscription_id", subscription.Id))
+		return true
+	}
+
+	payment := order.PrivateMetadata[subscriptionOrderMetadataPayment]
+
+	// pending order is released after the result of payment is saved, so renewal can't be charged again before
+	// the next period is started
+	defer func() {
+		pendingIds := []string{order.Id}
+
+		if claimId := order.PrivateMetadata[subscriptionOrderMetadataClaim]; claimId != "" {
+			pendingIds = append(pendingIds, claimId)
+		}
+
+		_ = s.subscriptionRepository.ReleasePendingOrder(ctx, subscription.Id, pendingIds...)
+	}()
+
+	subscription.LastOrderId = order.Id
+	subscription.LastProcessedOrderId = order.Id
+	subscription.UpdatedAt = time.Now()
+
+	if !isPaid {
+		if payment == internalPkg.SubscriptionPaymentRenewal &&
+			subscription.Status != internalPkg.SubscriptionStatusCanceled &&
+			subscription.Status != internalPkg.SubscriptionStatusPaused {
+			declineCode, reason := "", paymentSystemErrorRecurringFailed.Message
+
+			if order.Cancellation != nil {
+				declineCode = order.Cancellation.Code
+
+				if order.Cancellation.Reason != "" {
+					reason = order.Cancellation.Reason
+				}
+			}
+
+			return s.failSubscriptionRenewal(ctx, subscription, declineCode, reason)
+		}
+
+		return s.updateSubscriptionIf(ctx, subscription, status, periodEnd)
+	}
+
+	if subscription.Card == nil && recurringId != "" {
+		subscription.Card = &internalPkg.SubscriptionCard{
+			MaskedPan:   order.PaymentMethodTxnParams[billingpb.PaymentCreateFieldPan],
+			CardHolder:  order.PaymentMethodTxnParams[billingpb.PaymentCreateFieldHolder],
+			ExpireMonth: order.PaymentRequisites[billingpb.PaymentCreateFieldMonth],
+			ExpireYear:  order.PaymentRequisites[billingpb.PaymentCreateFieldYear],
+			RecurringId: recurringId,
+		}
+		subscription.PaymentMethodId = order.PaymentMethod.Id
+	}
+
+	if subscription.Status == internalPkg.SubscriptionStatusCanceled {
+		return s.updateSubscriptionIf(ctx, subscription, status, periodEnd)
+	}
+
+	switch payment {
+	case internalPkg.SubscriptionPaymentInitial:
+		startSubscriptionPeriod(subscription, plan, time.Now())
+
+		if subscription.Card == nil {
+			// card wasn't saved by the first payment, so subscription can't be renewed
+			subscription.CancelAtPeriodEnd = true
+		}
+		break
+	case internalPkg.SubscriptionPaymentRenewal:
+		if credit, err := strconv.ParseFloat(order.PrivateMetadata[subscriptionOrderMetadataCredit], 64); err == nil {
+			subscription.Balance = tools.FormatAmount(subscription.Balance - credit)
+		}
+
+		start := subscription.NextBillingAt
+
+		if start.IsZero() {
+			start = time.Now()
+		}
+
+		startSubscriptionPeriod(subscription, plan, start)
+		subscription.LastChargeError = ""
+		subscription.FailedAttempts = 0
+		subscription.RetryAt = time.Time{}
+		break
+	}
+
+	return s.updateSubscriptionIf(ctx, subscription, status, periodEnd)
+}
+
+// updateSubscriptionIf saves the subscription only if its status and end of current period weren't changed
+// by other process. Returns false if the subscription was changed, failed update isn't retried.
+func (s *Service) updateSubscriptionIf(
+	ctx context.Context,
+	subscription *internalPkg.Subscription,
+	status string,
+	periodEnd time.Time,
+) bool {
+	ok, err := s.subscriptionRepository.UpdateIf(ctx, subscription, status, periodEnd)
+
+	return err != nil || ok
+}
+
+// getSubscriptionCard returns saved card of customer to charge renewals of subscription.
+func (s *Service) getSubscriptionCard(
+	ctx context.Context,
+	userId, storedCardId string,
+) (*internalPkg.SubscriptionCard, *billingpb.ResponseErrorMessage) {
+	card, err := s.rep.FindSavedCardById(ctx, &recurringpb.FindByStringValue{Value: storedCardId})
+
+	if err != nil || card == nil || card.Id == "" {
+		return nil, orderGetSavedCardError
+	}
+
+	if card.Token != userId {
+		zap.L().Error(
+			"Alarm: user try use not own bank card for subscription",
+			zap.String("user_id", userId),
+			zap.String("card_id", storedCardId),
+		)
+		return nil, orderErrorRecurringCardNotOwnToUser
+	}
+
+	subscriptionCard := &internalPkg.SubscriptionCard{
+		MaskedPan:   card.MaskedPan,
+		CardHolder:  card.CardHolder,
+		RecurringId: card.RecurringId,
+	}
+
+	if card.Expire != nil {
+		subscriptionCard.ExpireMonth = card.Expire.Month
+		subscriptionCard.ExpireYear = card.Expire.Year
+	}
+
+	return subscriptionCard, nil
+}
+
+func (s *Service) getMerchantSubscription(
+	ctx context.Context,
+	req *internalPkg.SubscriptionRequest,
+) (*internalPkg.Subscription, error) {
+	subscription, err := s.subscriptionRepository.GetById(ctx, req.SubscriptionId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if subscription.MerchantId != req.MerchantId {
+		return nil, subscriptionErrorNotFound
+	}
+
+	return subscription, nil
+}
+
+// getSubscriptionPlanPrice returns price of the plan for price group of customer country,
+// price for price group of merchant payout currency is used if the plan has no price for customer.
+// Price of the group which isn't a region is set by currency of the group.
+func (s *Service) getSubscriptionPlanPrice(
+	ctx context.Context,
+	plan *internalPkg.SubscriptionPlan,
+	country string,
+) (*billingpb.ProductPrice, error) {
+	merchant, err := s.merchantRepository.GetById(ctx, plan.MerchantId)
+
+	if err != nil {
+		return nil, merchantErrorNotFound
+	}
+
+	var groups []*billingpb.PriceGroup
+
+	if country != "" {
+		if c, err := s.country.GetByIsoCodeA2(ctx, country); err == nil {
+			if group, err := s.priceGroupRepository.GetById(ctx, c.PriceGroupId); err == nil {
+				groups = append(groups, group)
+			}
+		}
+	}
+
+	if group, err := s.priceGroupRepository.GetByRegion(ctx, merchant.GetPayoutCurrency()); err == nil {
+		groups = append(groups, group)
+	}
+
+	for _, group := range groups {
+		for _, price := range plan.Prices {
+			if price.Currency == group.Currency && (price.Region == group.Region || price.Region == group.Currency) {
+				return price, nil
+			}
+		}
+	}
+
+	return nil, subscriptionErrorPriceNotFound
+}
+
+func startSubscriptionPeriod(
+	subscription *internalPkg.Subscription,
+	plan *internalPkg.SubscriptionPlan,
+	start time.Time,
+) {
+	subscription.CurrentPeriodStart = start
+	subscription.CurrentPeriodEnd = addSubscriptionInterval(start, plan)
+	subscription.NextBillingAt = subscription.CurrentPeriodEnd
+
+	if subscription.Status != internalPkg.SubscriptionStatusPaused {
+		subscription.Status = internalPkg.SubscriptionStatusActive
+	}
+}
+
+func addSubscriptionInterval(t time.Time, plan *internalPkg.SubscriptionPlan) time.Time {
+	count := int(plan.IntervalCount)
+
+	switch plan.Interval {
+	case internalPkg.SubscriptionIntervalDay:
+		return t.AddDate(0, 0, count)
+	case internalPkg.SubscriptionIntervalWeek:
+		return t.AddDate(0, 0, 7*count)
+	case internalPkg.SubscriptionIntervalMonth:
+		return t.AddDate(0, count, 0)
+	}
+
+	return t.AddDate(count, 0, 0)
+}
@@ -0,0 +1,741 @@
+package service
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/go-redis/redis"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/mongodb"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/micro/go-micro/client"
+	"github.com/paysuper/paysuper-billing-server/internal/config"
+	"github.com/paysuper/paysuper-billing-server/internal/database"
+	"github.com/paysuper/paysuper-billing-server/internal/mocks"
+	internalPkg "github.com/paysuper/paysuper-billing-server/internal/pkg"
+	"github.com/paysuper/paysuper-billing-server/pkg"
+	"github.com/paysuper/paysuper-proto/go/billingpb"
+	casbinMocks "github.com/paysuper/paysuper-proto/go/casbinpb/mocks"
+	"github.com/paysuper/paysuper-proto/go/recurringpb"
+	reportingMocks "github.com/paysuper/paysuper-proto/go/reporterpb/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	rabbitmq "gopkg.in/ProtocolONE/rabbitmq.v1/pkg"
+	mongodb "gopkg.in/paysuper/paysuper-database-mongo.v2"
+	"testing"
+	"time"
+)
+
+type SubscriptionTestSuite struct {
+	suite.Suite
+	service *Service
+	log     *zap.Logger
+	cache   database.CacheInterface
+
+	merchant      *billingpb.Merchant
+	project       *billingpb.Project
+	paymentMethod *billingpb.PaymentMethod
+	paymentSystem *billingpb.PaymentSystem
+}
+
+func Test_Subscription(t *testing.T) {
+	suite.Run(t, new(SubscriptionTestSuite))
+}
+
+func (suite *SubscriptionTestSuite) SetupTest() {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		suite.FailNow("Config load failed", "%v", err)
+	}
+	cfg.CardPayApiUrl = "https://sandbox.cardpay.com"
+
+	m, err := migrate.New(
+		"file://../../migrations/tests",
+		cfg.MongoDsn)
+	assert.NoError(suite.T(), err, "Migrate init failed")
+
+	err = m.Up()
+	if err != nil && err.Error() != "no change" {
+		suite.FailNow("Migrations failed", "%v", err)
+	}
+
+	ctx, _ := context.WithTimeout(context.Background(), 50*time.Second)
+	opts := []mongodb.Option{mongodb.Context(ctx)}
+	db, err := mongodb.NewDatabase(opts...)
+	if err != nil {
+		suite.FailNow("Database connection failed", "%v", err)
+	}
+
+	suite.log, err = zap.NewProduction()
+
+	if err != nil {
+		suite.FailNow("Logger initialization failed", "%v", err)
+	}
+
+	broker, err := rabbitmq.NewBroker(cfg.BrokerAddress)
+
+	if err != nil {
+		suite.FailNow("Creating RabbitMQ publisher failed", "%v", err)
+	}
+
+	redisClient := database.NewRedis(
+		&redis.Options{
+			Addr:     cfg.RedisHost,
+			Password: cfg.RedisPassword,
+		},
+	)
+
+	redisdb := mocks.NewTestRedis()
+	suite.cache, err = database.NewCacheRedis(redisdb, "cache")
+	suite.service = NewBillingService(
+		db,
+		cfg,
+		mocks.NewGeoIpServiceTestOk(),
+		mocks.NewRepositoryServiceOk(),
+		mocks.NewTaxServiceOkMock(),
+		broker,
+		redisClient,
+		suite.cache,
+		mocks.NewCurrencyServiceMockOk(),
+		mocks.NewDocumentSignerMockOk(),
+		&reportingMocks.ReporterService{},
+		mocks.NewFormatterOK(),
+		mocks.NewBrokerMockOk(),
+		&casbinMocks.CasbinService{},
+	)
+
+	if err := suite.service.Init(); err != nil {
+		suite.FailNow("Billing service initialization failed", "%v", err)
+	}
+
+	suite.merchant, suite.project, suite.paymentMethod, suite.paymentSystem = helperCreateEntitiesForTests(suite.Suite, suite.service)
+
+	centrifugoMock := &mocks.CentrifugoInterface{}
+	centrifugoMock.On("GetChannelToken", mock.Anything, mock.Anything).Return("token")
+	centrifugoMock.On("Publish", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	suite.service.centrifugoDashboard = centrifugoMock
+	suite.service.centrifugoPaymentForm = centrifugoMock
+}
+
+func (suite *SubscriptionTestSuite) TearDownTest() {
+	err := suite.service.db.Drop()
+
+	if err != nil {
+		suite.FailNow("Database deletion failed", "%v", err)
+	}
+
+	err = suite.service.db.Close()
+
+	if err != nil {
+		suite.FailNow("Database close failed", "%v", err)
+	}
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_CreateOrUpdateSubscriptionPlan_Ok() {
+	plan := suite.createPlan(100, 0, false)
+	assert.NotEmpty(suite.T(), plan.Id)
+	assert.EqualValues(suite.T(), 1, plan.IntervalCount)
+
+	createdAt := plan.CreatedAt
+	plan.Name = "updated"
+	rsp := &internalPkg.SubscriptionPlanResponse{}
+	err := suite.service.CreateOrUpdateSubscriptionPlan(context.TODO(), plan, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	rsp1 := &internalPkg.ListSubscriptionPlansResponse{}
+	err = suite.service.GetSubscriptionPlans(context.TODO(), &internalPkg.ListSubscriptionPlansRequest{ProjectId: suite.project.Id}, rsp1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp1.Status)
+	assert.Len(suite.T(), rsp1.Items, 1)
+	assert.Equal(suite.T(), "updated", rsp1.Items[0].Name)
+	assert.Equal(suite.T(), createdAt.Unix(), rsp1.Items[0].CreatedAt.Unix())
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_CreateOrUpdateSubscriptionPlan_ProjectNotFound() {
+	req := suite.getPlan(100, 0, false)
+	req.MerchantId = primitive.NewObjectID().Hex()
+	rsp := &internalPkg.SubscriptionPlanResponse{}
+	err := suite.service.CreateOrUpdateSubscriptionPlan(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), projectErrorNotFound, rsp.Message)
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_CreateOrUpdateSubscriptionPlan_IntervalInvalid() {
+	req := suite.getPlan(100, 0, false)
+	req.Interval = "quarter"
+	rsp := &internalPkg.SubscriptionPlanResponse{}
+	err := suite.service.CreateOrUpdateSubscriptionPlan(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), subscriptionErrorPlanIntervalInvalid, rsp.Message)
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_CreateOrUpdateSubscriptionPlan_PricesInvalid() {
+	req := suite.getPlan(0, 0, false)
+	rsp := &internalPkg.SubscriptionPlanResponse{}
+	err := suite.service.CreateOrUpdateSubscriptionPlan(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), subscriptionErrorPlanPricesInvalid, rsp.Message)
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_CreateSubscription_WithoutCard_Ok() {
+	plan := suite.createPlan(100, 0, false)
+
+	req := &internalPkg.CreateSubscriptionRequest{ProjectId: suite.project.Id, PlanId: plan.Id, User: suite.getUser()}
+	rsp := &internalPkg.CreateSubscriptionResponse{}
+	err := suite.service.CreateSubscription(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), internalPkg.SubscriptionStatusIncomplete, rsp.Item.Status)
+	assert.Equal(suite.T(), float64(100), rsp.Item.Amount)
+	assert.Equal(suite.T(), "RUB", rsp.Item.Currency)
+	assert.NotEmpty(suite.T(), rsp.OrderId)
+
+	order, err := suite.service.orderRepository.GetByUuid(context.TODO(), rsp.OrderId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), rsp.Item.Id, order.PrivateMetadata[subscriptionOrderMetadataId])
+	assert.Equal(suite.T(), internalPkg.SubscriptionPaymentInitial, order.PrivateMetadata[subscriptionOrderMetadataPayment])
+
+	order = helperPayOrder(suite.Suite, suite.service, order, suite.paymentMethod, "RU")
+
+	subscription, err := suite.service.subscriptionRepository.GetById(context.TODO(), rsp.Item.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.SubscriptionStatusActive, subscription.Status)
+	assert.Equal(suite.T(), order.Id, subscription.LastOrderId)
+	assert.Equal(suite.T(), subscription.CurrentPeriodStart.AddDate(0, 1, 0).Unix(), subscription.NextBillingAt.Unix())
+	// card isn't saved by payment system mock
+	assert.Nil(suite.T(), subscription.Card)
+	assert.True(suite.T(), subscription.CancelAtPeriodEnd)
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_CreateSubscription_TrialWithoutCard_Error() {
+	plan := suite.createPlan(100, 7, false)
+
+	req := &internalPkg.CreateSubscriptionRequest{ProjectId: suite.project.Id, PlanId: plan.Id, User: suite.getUser()}
+	rsp := &internalPkg.CreateSubscriptionResponse{}
+	err := suite.service.CreateSubscription(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), subscriptionErrorTrialRequiresStoredCard, rsp.Message)
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_CreateSubscription_CardNotOwnToUser_Error() {
+	plan := suite.createPlan(100, 7, false)
+	user := suite.getUser()
+	suite.service.rep = &subscriptionRepositoryServiceMock{card: suite.getSavedCard(primitive.NewObjectID().Hex())}
+
+	req := &internalPkg.CreateSubscriptionRequest{
+		ProjectId:    suite.project.Id,
+		PlanId:       plan.Id,
+		User:         user,
+		StoredCardId: primitive.NewObjectID().Hex(),
+	}
+	rsp := &internalPkg.CreateSubscriptionResponse{}
+	err := suite.service.CreateSubscription(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), orderErrorRecurringCardNotOwnToUser, rsp.Message)
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_CreateSubscription_Trial_Ok() {
+	subscription := suite.createTrialSubscription()
+	assert.Equal(suite.T(), internalPkg.SubscriptionStatusTrial, subscription.Status)
+	assert.NotNil(suite.T(), subscription.TrialEnd)
+	assert.Equal(suite.T(), subscription.CreatedAt.AddDate(0, 0, 7).Unix(), subscription.NextBillingAt.Unix())
+	assert.NotNil(suite.T(), subscription.Card)
+	assert.Equal(suite.T(), "0987654321", subscription.Card.RecurringId)
+	assert.Empty(suite.T(), subscription.LastOrderId)
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_ChargeSubscriptions_Ok() {
+	subscription := suite.createTrialSubscription()
+	nextBillingAt := time.Now().Add(-time.Hour)
+	subscription.NextBillingAt = nextBillingAt
+	subscription.PaymentMethodId = suite.paymentMethod.Id
+	err := suite.service.subscriptionRepository.Update(context.TODO(), subscription)
+	assert.NoError(suite.T(), err)
+
+	count, err := suite.service.ChargeSubscriptions(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, count)
+
+	subscription, err = suite.service.subscriptionRepository.GetById(context.TODO(), subscription.Id)
+	assert.NoError(suite.T(), err)
+	assert.NotEmpty(suite.T(), subscription.PendingOrderId)
+	assert.Equal(suite.T(), subscription.PendingOrderId, subscription.LastOrderId)
+
+	order, err := suite.service.orderRepository.GetById(context.TODO(), subscription.PendingOrderId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), recurringpb.OrderStatusPaymentSystemCreate, order.PrivateStatus)
+	assert.Equal(suite.T(), internalPkg.SubscriptionPaymentRenewal, order.PrivateMetadata[subscriptionOrderMetadataPayment])
+	assert.Equal(suite.T(), float64(100), order.OrderAmount)
+
+	// renewal waiting for result of payment isn't charged again
+	count, err = suite.service.ChargeSubscriptions(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, count)
+
+	suite.sendPaymentCallback(order)
+
+	subscription, err = suite.service.subscriptionRepository.GetById(context.TODO(), subscription.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.SubscriptionStatusActive, subscription.Status)
+	assert.Empty(suite.T(), subscription.PendingOrderId)
+	assert.Equal(suite.T(), nextBillingAt.Unix(), subscription.CurrentPeriodStart.Unix())
+	assert.Equal(suite.T(), nextBillingAt.AddDate(0, 1, 0).Unix(), subscription.NextBillingAt.Unix())
+
+	oid, err := primitive.ObjectIDFromHex(order.Id)
+	assert.NoError(suite.T(), err)
+	entries, err := suite.service.db.Collection(collectionAccountingEntry).CountDocuments(context.TODO(), bson.M{"source.id": oid})
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), entries > 0)
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_ChargeSubscriptions_BalanceCoversPrice() {
+	subscription := suite.createTrialSubscription()
+	nextBillingAt := time.Now().Add(-time.Hour)
+	subscription.NextBillingAt = nextBillingAt
+	subscription.Balance = 150
+	err := suite.service.subscriptionRepository.Update(context.TODO(), subscription)
+	assert.NoError(suite.T(), err)
+
+	count, err := suite.service.ChargeSubscriptions(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, count)
+
+	subscription, err = suite.service.subscriptionRepository.GetById(context.TODO(), subscription.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.SubscriptionStatusActive, subscription.Status)
+	assert.Equal(suite.T(), float64(50), subscription.Balance)
+	assert.Empty(suite.T(), subscription.LastOrderId)
+	assert.Equal(suite.T(), nextBillingAt.AddDate(0, 1, 0).Unix(), subscription.NextBillingAt.Unix())
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_ChargeSubscriptions_CancelAtPeriodEnd() {
+	subscription := suite.createTrialSubscription()
+
+	req := &internalPkg.SubscriptionRequest{MerchantId: suite.merchant.Id, SubscriptionId: subscription.Id, AtPeriodEnd: true}
+	rsp := &internalPkg.SubscriptionResponse{}
+	err := suite.service.CancelSubscription(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), internalPkg.SubscriptionStatusTrial, rsp.Item.Status)
+	assert.True(suite.T(), rsp.Item.CancelAtPeriodEnd)
+
+	subscription = rsp.Item
+	subscription.NextBillingAt = time.Now().Add(-time.Hour)
+	err = suite.service.subscriptionRepository.Update(context.TODO(), subscription)
+	assert.NoError(suite.T(), err)
+
+	count, err := suite.service.ChargeSubscriptions(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, count)
+
+	subscription, err = suite.service.subscriptionRepository.GetById(context.TODO(), subscription.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.SubscriptionStatusCanceled, subscription.Status)
+	assert.NotNil(suite.T(), subscription.CanceledAt)
+	assert.Empty(suite.T(), subscription.LastOrderId)
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_ProcessSubscriptionOrder_Declined() {
+	subscription := suite.createTrialSubscription()
+	subscription.Status = internalPkg.SubscriptionStatusActive
+	err := suite.service.subscriptionRepository.Update(context.TODO(), subscription)
+	assert.NoError(suite.T(), err)
+
+	orderId := primitive.NewObjectID().Hex()
+	_, err = suite.service.subscriptionRepository.Claim(context.TODO(), subscription.Id, "claim", time.Now())
+	assert.NoError(suite.T(), err)
+	ok, err := suite.service.subscriptionRepository.SetPendingOrder(context.TODO(), subscription.Id, "claim", orderId)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	order := &billingpb.Order{
+		Id:            orderId,
+		PrivateStatus: recurringpb.OrderStatusPaymentSystemDeclined,
+		PrivateMetadata: map[string]string{
+			subscriptionOrderMetadataId:      subscription.Id,
+			subscriptionOrderMetadataPayment: internalPkg.SubscriptionPaymentRenewal,
+		},
+		Cancellation: &billingpb.OrderNotificationCancellation{Code: "02", Reason: "insufficient funds"},
+	}
+	suite.service.processSubscriptionOrder(context.TODO(), order, "")
+
+	subscription, err = suite.service.subscriptionRepository.GetById(context.TODO(), subscription.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.SubscriptionStatusPastDue, subscription.Status)
+	assert.Equal(suite.T(), "insufficient funds", subscription.LastChargeError)
+	assert.Empty(suite.T(), subscription.PendingOrderId)
+	assert.Equal(suite.T(), order.Id, subscription.LastOrderId)
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_ProcessSubscriptionOrder_CompletedTwice() {
+	subscription := suite.createTrialSubscription()
+	subscription.Status = internalPkg.SubscriptionStatusActive
+	subscription.Balance = 30
+	err := suite.service.subscriptionRepository.Update(context.TODO(), subscription)
+	assert.NoError(suite.T(), err)
+
+	order := &billingpb.Order{
+		Id:            primitive.NewObjectID().Hex(),
+		PrivateStatus: recurringpb.OrderStatusPaymentSystemComplete,
+		PrivateMetadata: map[string]string{
+			subscriptionOrderMetadataId:      subscription.Id,
+			subscriptionOrderMetadataPayment: internalPkg.SubscriptionPaymentRenewal,
+			subscriptionOrderMetadataCredit:  "30",
+		},
+	}
+	suite.service.processSubscriptionOrder(context.TODO(), order, "")
+	suite.service.processSubscriptionOrder(context.TODO(), order, "")
+
+	subscription2, err := suite.service.subscriptionRepository.GetById(context.TODO(), subscription.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), order.Id, subscription2.LastProcessedOrderId)
+	assert.Zero(suite.T(), subscription2.Balance)
+	assert.Equal(suite.T(), subscription.NextBillingAt.Unix(), subscription2.CurrentPeriodStart.Unix())
+	assert.Equal(suite.T(), subscription.NextBillingAt.AddDate(0, 1, 0).Unix(), subscription2.NextBillingAt.Unix())
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_ProcessSubscriptionOrder_BeforePendingOrderSet() {
+	subscription := suite.createTrialSubscription()
+	claimed, err := suite.service.subscriptionRepository.Claim(context.TODO(), subscription.Id, "claim", time.Now())
+	assert.NoError(suite.T(), err)
+	assert.NotNil(suite.T(), claimed)
+
+	order := &billingpb.Order{
+		Id:            primitive.NewObjectID().Hex(),
+		PrivateStatus: recurringpb.OrderStatusPaymentSystemDeclined,
+		PrivateMetadata: map[string]string{
+			subscriptionOrderMetadataId:      subscription.Id,
+			subscriptionOrderMetadataPayment: internalPkg.SubscriptionPaymentRenewal,
+			subscriptionOrderMetadataClaim:   "claim",
+		},
+	}
+	suite.service.processSubscriptionOrder(context.TODO(), order, "")
+
+	// result of payment released the claim, so the order isn't set as pending order of subscription
+	ok, err := suite.service.subscriptionRepository.SetPendingOrder(context.TODO(), subscription.Id, "claim", order.Id)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+
+	subscription, err = suite.service.subscriptionRepository.GetById(context.TODO(), subscription.Id)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), subscription.PendingOrderId)
+	assert.Equal(suite.T(), internalPkg.SubscriptionStatusPastDue, subscription.Status)
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_PauseResumeSubscription_Ok() {
+	subscription := suite.createTrialSubscription()
+	nextBillingAt := subscription.NextBillingAt
+
+	req := &internalPkg.SubscriptionRequest{MerchantId: suite.merchant.Id, SubscriptionId: subscription.Id}
+	rsp := &internalPkg.SubscriptionResponse{}
+	err := suite.service.PauseSubscription(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), internalPkg.SubscriptionStatusPaused, rsp.Item.Status)
+
+	pausedAt := time.Now().Add(-24 * time.Hour)
+	subscription = rsp.Item
+	subscription.PausedAt = &pausedAt
+	subscription.NextBillingAt = time.Now().Add(-time.Hour)
+	err = suite.service.subscriptionRepository.Update(context.TODO(), subscription)
+	assert.NoError(suite.T(), err)
+
+	// paused subscription isn't charged
+	count, err := suite.service.ChargeSubscriptions(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, count)
+
+	rsp = &internalPkg.SubscriptionResponse{}
+	err = suite.service.ResumeSubscription(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), internalPkg.SubscriptionStatusTrial, rsp.Item.Status)
+	assert.Nil(suite.T(), rsp.Item.PausedAt)
+	assert.InDelta(suite.T(), time.Now().Add(23*time.Hour).Unix(), rsp.Item.NextBillingAt.Unix(), 10)
+	assert.NotEqual(suite.T(), nextBillingAt.Unix(), rsp.Item.NextBillingAt.Unix())
+
+	rsp = &internalPkg.SubscriptionResponse{}
+	err = suite.service.ResumeSubscription(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), subscriptionErrorStatusInvalid, rsp.Message)
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_CancelSubscription_Ok() {
+	subscription := suite.createTrialSubscription()
+
+	req := &internalPkg.SubscriptionRequest{MerchantId: suite.merchant.Id, SubscriptionId: subscription.Id}
+	rsp := &internalPkg.SubscriptionResponse{}
+	err := suite.service.CancelSubscription(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), internalPkg.SubscriptionStatusCanceled, rsp.Item.Status)
+	assert.NotNil(suite.T(), rsp.Item.CanceledAt)
+
+	rsp = &internalPkg.SubscriptionResponse{}
+	err = suite.service.CancelSubscription(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusBadData, rsp.Status)
+	assert.Equal(suite.T(), subscriptionErrorStatusInvalid, rsp.Message)
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_CancelSubscription_OtherMerchant_NotFound() {
+	subscription := suite.createTrialSubscription()
+
+	req := &internalPkg.SubscriptionRequest{MerchantId: primitive.NewObjectID().Hex(), SubscriptionId: subscription.Id}
+	rsp := &internalPkg.SubscriptionResponse{}
+	err := suite.service.CancelSubscription(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), subscriptionErrorNotFound, rsp.Message)
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_ChangeSubscriptionPlan_Proration() {
+	subscription := suite.createTrialSubscription()
+	now := time.Now()
+	subscription.Status = internalPkg.SubscriptionStatusActive
+	subscription.CurrentPeriodStart = now.AddDate(0, 0, -15)
+	subscription.CurrentPeriodEnd = now.AddDate(0, 0, 15)
+	subscription.NextBillingAt = subscription.CurrentPeriodEnd
+	err := suite.service.subscriptionRepository.Update(context.TODO(), subscription)
+	assert.NoError(suite.T(), err)
+
+	plan := suite.createPlan(50, 0, true)
+
+	req := &internalPkg.SubscriptionRequest{MerchantId: suite.merchant.Id, SubscriptionId: subscription.Id, PlanId: plan.Id}
+	rsp := &internalPkg.SubscriptionResponse{}
+	err = suite.service.ChangeSubscriptionPlan(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), plan.Id, rsp.Item.PlanId)
+	assert.Equal(suite.T(), float64(50), rsp.Item.Amount)
+	assert.InDelta(suite.T(), 25, rsp.Item.Balance, 0.1)
+	assert.Equal(suite.T(), subscription.NextBillingAt.Unix(), rsp.Item.NextBillingAt.Unix())
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_ChangeSubscriptionPlan_WithoutProration() {
+	subscription := suite.createTrialSubscription()
+	plan := suite.createPlan(50, 0, false)
+
+	req := &internalPkg.SubscriptionRequest{MerchantId: suite.merchant.Id, SubscriptionId: subscription.Id, PlanId: plan.Id}
+	rsp := &internalPkg.SubscriptionResponse{}
+	err := suite.service.ChangeSubscriptionPlan(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), plan.Id, rsp.Item.PlanId)
+	assert.Equal(suite.T(), float64(50), rsp.Item.Amount)
+	assert.Equal(suite.T(), float64(0), rsp.Item.Balance)
+	assert.Empty(suite.T(), rsp.Item.LastOrderId)
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_ChargeSubscriptions_RetryPastDue() {
+	subscription := suite.createTrialSubscription()
+	nextBillingAt := time.Now().Add(-48 * time.Hour)
+	subscription.Status = internalPkg.SubscriptionStatusPastDue
+	subscription.NextBillingAt = nextBillingAt
+	subscription.FailedAttempts = 1
+	subscription.RetryAt = time.Now().Add(-time.Minute)
+	subscription.PaymentMethodId = suite.paymentMethod.Id
+	err := suite.service.subscriptionRepository.Update(context.TODO(), subscription)
+	assert.NoError(suite.T(), err)
+
+	count, err := suite.service.ChargeSubscriptions(context.TODO())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, count)
+
+	subscription, err = suite.service.subscriptionRepository.GetById(context.TODO(), subscription.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.SubscriptionStatusPastDue, subscription.Status)
+	assert.NotEmpty(suite.T(), subscription.PendingOrderId)
+
+	order, err := suite.service.orderRepository.GetById(context.TODO(), subscription.PendingOrderId)
+	assert.NoError(suite.T(), err)
+	suite.sendPaymentCallback(order)
+
+	subscription, err = suite.service.subscriptionRepository.GetById(context.TODO(), subscription.Id)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), internalPkg.SubscriptionStatusActive, subscription.Status)
+	assert.Equal(suite.T(), int32(0), subscription.FailedAttempts)
+	assert.True(suite.T(), subscription.RetryAt.IsZero())
+	assert.Equal(suite.T(), nextBillingAt.Unix(), subscription.CurrentPeriodStart.Unix())
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_UpdateSubscriptionCard_Ok() {
+	subscription := suite.createTrialSubscription()
+	subscription.Status = internalPkg.SubscriptionStatusPastDue
+	subscription.FailedAttempts = 1
+	subscription.RetryAt = time.Now().Add(72 * time.Hour)
+	err := suite.service.subscriptionRepository.Update(context.TODO(), subscription)
+	assert.NoError(suite.T(), err)
+
+	card := suite.getSavedCard(subscription.User.Id)
+	card.MaskedPan = "555555******4444"
+	card.RecurringId = "1234567890"
+	suite.service.rep = &subscriptionRepositoryServiceMock{card: card}
+
+	req := &internalPkg.UpdateSubscriptionCardRequest{
+		SubscriptionId: subscription.Id,
+		UserId:         subscription.User.Id,
+		StoredCardId:   card.Id,
+	}
+	rsp := &internalPkg.SubscriptionResponse{}
+	err = suite.service.UpdateSubscriptionCard(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+	assert.Equal(suite.T(), "555555******4444", rsp.Item.Card.MaskedPan)
+	assert.Equal(suite.T(), "1234567890", rsp.Item.Card.RecurringId)
+	assert.InDelta(suite.T(), time.Now().Unix(), rsp.Item.RetryAt.Unix(), 10)
+}
+
+func (suite *SubscriptionTestSuite) TestSubscription_UpdateSubscriptionCard_OtherUser_NotFound() {
+	subscription := suite.createTrialSubscription()
+
+	req := &internalPkg.UpdateSubscriptionCardRequest{
+		SubscriptionId: subscription.Id,
+		UserId:         primitive.NewObjectID().Hex(),
+		StoredCardId:   primitive.NewObjectID().Hex(),
+	}
+	rsp := &internalPkg.SubscriptionResponse{}
+	err := suite.service.UpdateSubscriptionCard(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusNotFound, rsp.Status)
+	assert.Equal(suite.T(), subscriptionErrorNotFound, rsp.Message)
+}
+
+func (suite *SubscriptionTestSuite) getPlan(amount float64, trialDays int32, proration bool) *internalPkg.SubscriptionPlan {
+	return &internalPkg.SubscriptionPlan{
+		MerchantId: suite.project.MerchantId,
+		ProjectId:  suite.project.Id,
+		Name:       "unit test",
+		Prices: []*billingpb.ProductPrice{
+			{Amount: amount, Currency: "RUB", Region: "RUB"},
+			{Amount: amount, Currency: "USD", Region: "USD"},
+		},
+		Interval:  internalPkg.SubscriptionIntervalMonth,
+		TrialDays: trialDays,
+		Proration: proration,
+		IsActive:  true,
+	}
+}
+
+func (suite *SubscriptionTestSuite) createPlan(amount float64, trialDays int32, proration bool) *internalPkg.SubscriptionPlan {
+	rsp := &internalPkg.SubscriptionPlanResponse{}
+	err := suite.service.CreateOrUpdateSubscriptionPlan(context.TODO(), suite.getPlan(amount, trialDays, proration), rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	return rsp.Item
+}
+
+func (suite *SubscriptionTestSuite) getUser() *billingpb.OrderUser {
+	return &billingpb.OrderUser{
+		Id:      primitive.NewObjectID().Hex(),
+		Email:   "test@unit.unit",
+		Ip:      "127.0.0.1",
+		Address: &billingpb.OrderBillingAddress{Country: "RU"},
+	}
+}
+
+func (suite *SubscriptionTestSuite) getSavedCard(token string) *recurringpb.SavedCard {
+	return &recurringpb.SavedCard{
+		Id:          primitive.NewObjectID().Hex(),
+		Token:       token,
+		ProjectId:   suite.project.Id,
+		MerchantId:  suite.project.MerchantId,
+		MaskedPan:   "400000******0002",
+		CardHolder:  "MR. CARD HOLDER",
+		RecurringId: "0987654321",
+		Expire:      &recurringpb.CardExpire{Month: "02", Year: time.Now().AddDate(1, 0, 0).Format("2006")},
+		IsActive:    true,
+	}
+}
+
+func (suite *SubscriptionTestSuite) createTrialSubscription() *internalPkg.Subscription {
+	plan := suite.createPlan(100, 7, false)
+	user := suite.getUser()
+	suite.service.rep = &subscriptionRepositoryServiceMock{card: suite.getSavedCard(user.Id)}
+
+	req := &internalPkg.CreateSubscriptionRequest{
+		ProjectId:    suite.project.Id,
+		PlanId:       plan.Id,
+		User:         user,
+		StoredCardId: primitive.NewObjectID().Hex(),
+	}
+	rsp := &internalPkg.CreateSubscriptionResponse{}
+	err := suite.service.CreateSubscription(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), billingpb.ResponseStatusOk, rsp.Status)
+
+	return rsp.Item
+}
+
+func (suite *SubscriptionTestSuite) sendPaymentCallback(order *billingpb.Order) {
+	callback := &billingpb.CardPayPaymentCallback{
+		PaymentMethod: suite.paymentMethod.ExternalId,
+		CallbackTime:  time.Now().Format("2006-01-02T15:04:05Z"),
+		MerchantOrder: &billingpb.CardPayMerchantOrder{
+			Id:          order.Id,
+			Description: order.Description,
+		},
+		CardAccount: &billingpb.CallbackCardPayBankCardAccount{
+			Holder:             order.PaymentRequisites[billingpb.PaymentCreateFieldHolder],
+			IssuingCountryCode: "RU",
+			MaskedPan:          order.PaymentRequisites[billingpb.PaymentCreateFieldPan],
+			Token:              primitive.NewObjectID().Hex(),
+		},
+		Customer: &billingpb.CardPayCustomer{
+			Email: order.User.Email,
+			Ip:    order.User.Ip,
+			Id:    order.ProjectAccount,
+		},
+		PaymentData: &billingpb.CallbackCardPayPaymentData{
+			Id:          primitive.NewObjectID().Hex(),
+			Amount:      order.ChargeAmount,
+			Currency:    order.ChargeCurrency,
+			Description: order.Description,
+			Rrn:         primitive.NewObjectID().Hex(),
+			Status:      billingpb.CardPayPaymentResponseStatusCompleted,
+		},
+	}
+
+	buf, err := json.Marshal(callback)
+	assert.NoError(suite.T(), err)
+
+	hash := sha512.New()
+	hash.Write([]byte(string(buf) + order.PaymentMethod.Params.SecretCallback))
+
+	req := &billingpb.PaymentNotifyRequest{
+		OrderId:   order.Id,
+		Request:   buf,
+		Signature: hex.EncodeToString(hash.Sum(nil)),
+	}
+	rsp := &billingpb.PaymentNotifyResponse{}
+	err = suite.service.PaymentCallbackProcess(context.TODO(), req, rsp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), pkg.StatusOK, rsp.Status)
+}
+
+// subscriptionRepositoryServiceMock returns the saved card of customer by any identifier.
+type subscriptionRepositoryServiceMock struct {
+	mocks.RepositoryServiceOk
+	card *recurringpb.SavedCard
+}
+
+func (r *subscriptionRepositoryServiceMock) FindSavedCardById(
+	ctx context.Context,
+	in *recurringpb.FindByStringValue,
+	opts ...client.CallOption,
+) (*recurringpb.SavedCard, error) {
+	return r.card, nil
+}
@@ -985,6 +985,40 @@ func helperPayOrder(
 	return order
 }
 
+// helperSetOrderPrivateStatus moves order to the private status through the shortest chain of transitions
+// allowed by the state machine of order status.
+func helperSetOrderPrivateStatus(suite suite.Suite, service *Service, order *billingpb.Order, status int32) {
+	prev := map[int32]int32{order.PrivateStatus: order.PrivateStatus}
+	queue := []int32{order.PrivateStatus}
+
+	for len(queue) > 0 {
+		from := queue[0]
+		queue = queue[1:]
+
+		for _, to := range orderStatusTransitions[from] {
+			if _, ok := prev[to]; !ok {
+				prev[to] = from
+				queue = append(queue, to)
+			}
+		}
+	}
+
+	_, ok := prev[status]
+	assert.True(suite.T(), ok, "order status %d can't be reached from %d", status, order.PrivateStatus)
+
+	var chain []int32
+
+	for v := status; v != order.PrivateStatus; v = prev[v] {
+		chain = append([]int32{v}, chain...)
+	}
+
+	for _, v := range chain {
+		order.PrivateStatus = v
+		err := service.updateOrder(context.TODO(), order)
+		assert.NoError(suite.T(), err)
+	}
+}
+
 func helperMakeRefund(suite suite.Suite, service *Service, order *billingpb.Order, amount float64, isChargeback bool) *billingpb.Refund {
 	req2 := &billingpb.CreateRefundRequest{
 		OrderId:      order.Uuid,
@@ -1003,20 +1037,24 @@ func helperMakeRefund(suite suite.Suite, service *Service, order *billingpb.Orde
 	err = service.updateOrder(context.TODO(), order)
 	assert.NoError(suite.T(), err)
 
+	return helperProcessRefundCallback(suite, service, order, rsp2.Item)
+}
+
+func helperProcessRefundCallback(suite suite.Suite, service *Service, order *billingpb.Order, created *billingpb.Refund) *billingpb.Refund {
 	refundReq := &billingpb.CardPayRefundCallback{
 		MerchantOrder: &billingpb.CardPayMerchantOrder{
-			Id: rsp2.Item.Id,
+			Id: created.Id,
 		},
 		PaymentMethod: order.PaymentMethod.Group,
 		PaymentData: &billingpb.CardPayRefundCallbackPaymentData{
-			Id:              rsp2.Item.Id,
+			Id:              created.Id,
 			RemainingAmount: 90,
 		},
 		RefundData: &billingpb.CardPayRefundCallbackRefundData{
 			Amount:   10,
 			Created:  time.Now().Format(cardPayDateFormat),
 			Id:       primitive.NewObjectID().Hex(),
-			Currency: rsp2.Item.Currency,
+			Currency: created.Currency,
 			Status:   billingpb.CardPayPaymentResponseStatusCompleted,
 			AuthCode: primitive.NewObjectID().Hex(),
 			Is_3D:    true,
@@ -1047,7 +1085,7 @@ func helperMakeRefund(suite suite.Suite, service *Service, order *billingpb.Orde
 	assert.Empty(suite.T(), rsp3.Error)
 
 	var refund *billingpb.Refund
-	oid, _ := primitive.ObjectIDFromHex(rsp2.Item.Id)
+	oid, _ := primitive.ObjectIDFromHex(created.Id)
 	filter := bson.M{"_id": oid}
 	err = service.db.Collection(repository.CollectionRefund).FindOne(context.TODO(), filter).Decode(&refund)
 	assert.NotNil(suite.T(), refund)
@@ -12,6 +12,8 @@ func main() {
 
 	task := app.CliArgs.Get("task").String("")
 	date := app.CliArgs.Get("date").String("")
+	merchantId := app.CliArgs.Get("merchant").String("")
+	apply := app.CliArgs.Get("apply").Bool(false)
 
 	if task != "" {
 
@@ -40,6 +42,15 @@ func main() {
 
 		case "fix_taxes":
 			err = app.TaskFixTaxes()
+
+		case "reprocess_accounting":
+			err = app.TaskReprocessAccounting(date, merchantId, apply)
+
+		case "release_rolling_reserves":
+			err = app.TaskReleaseRollingReserves()
+
+		case "rebuild_ledger":
+			err = app.TaskRebuildLedger()
 		}
 
 		if err != nil {
@@ -54,6 +65,13 @@ func main() {
 	}
 
 	app.KeyDaemonStart()
+	app.AuthorizationDaemonStart()
+	app.OrderExpirationDaemonStart()
+	app.SubscriptionDaemonStart()
+	app.SavedCardExpirationDaemonStart()
+	app.DisputeDaemonStart()
+	app.BulkRefundDaemonStart()
+	app.AccountingExportDaemonStart()
 
 	app.Run()
 }
@@ -26,6 +26,11 @@ const (
 	RefundStatusCompleted             = int32(3)
 	RefundStatusPaymentSystemDeclined = int32(4)
 	RefundStatusPaymentSystemCanceled = int32(5)
+	RefundStatusPendingApproval       = int32(6)
+
+	// Private statuses of order with two-step payment, recurringpb doesn't know about them.
+	OrderStatusPaymentSystemAuthorized = int32(20)
+	OrderStatusPaymentSystemVoided     = int32(21)
 
 	PaymentSystemErrorCreateRefundFailed   = "refund can't be create. try request later"
 	PaymentSystemErrorCreateRefundRejected = "refund create request rejected"
@@ -49,7 +54,8 @@ const (
 	LogFieldResponse                 = "response"
 	LogFieldHandler                  = "handler"
 
-	ObjectTypeBalanceTransaction = "balance_transaction"
+	ObjectTypeBalanceTransaction           = "balance_transaction"
+	ObjectTypeBalanceTransactionCorrection = "balance_transaction_correction"
 
 	AccountingEntryTypeRealGrossRevenue                    = "real_gross_revenue"
 	AccountingEntryTypeRealTaxFee                          = "real_tax_fee"
@@ -99,6 +105,7 @@ const (
 	AccountingEntryTypeMerchantRollingReserveCreate    = "merchant_rolling_reserve_create"
 	AccountingEntryTypeMerchantRollingReserveRelease   = "merchant_rolling_reserve_release"
 	AccountingEntryTypeMerchantRoyaltyCorrection       = "merchant_royalty_correction"
+	AccountingEntryTypeRealChargebackReversal          = "real_chargeback_reversal"
 
 	BalanceTransactionStatusAvailable = "available"
 
@@ -195,6 +202,7 @@ const (
 	PaymentSystemActionCreatePayment    = "create_payment"
 	PaymentSystemActionRecurringPayment = "recurring_payment"
 	PaymentSystemActionRefund           = "refund"
+	PaymentSystemActionChangeStatus     = "change_status"
 
 	MerchantOperationTypeLowRisk  = "low-risk"
 	MerchantOperationTypeHighRisk = "high-risk"
@@ -219,6 +227,7 @@ const (
 	AdminCompanyUrl            = "%s/merchants/%s/company-info"
 	AdminOnboardingRequestsUrl = "%s/agreement-requests"
 	UserInviteUrl              = "%s/login?invite_token=%s"
+	SubscriptionCardUrl        = "%s/subscription/%s/card"
 
 	OrderType_simple         = "simple"
 	OrderType_key            = "key"
@@ -298,5 +307,9 @@ var (
 			Path:   "/api/refunds",
 			Method: http.MethodPost,
 		},
+		PaymentSystemActionChangeStatus: {
+			Path:   "/api/payments/%s",
+			Method: http.MethodPatch,
+		},
 	}
 )